@@ -25,19 +25,25 @@ import (
 	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
 	blankhost "github.com/libp2p/go-libp2p/p2p/host/blank"
 	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	"github.com/libp2p/go-libp2p/p2p/host/health"
 	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
 	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
 	routed "github.com/libp2p/go-libp2p/p2p/host/routed"
+	"github.com/libp2p/go-libp2p/p2p/host/stats"
 	"github.com/libp2p/go-libp2p/p2p/net/swarm"
 	tptu "github.com/libp2p/go-libp2p/p2p/net/upgrader"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2"
 	circuitv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
 	relayv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
 	"github.com/libp2p/go-libp2p/p2p/protocol/holepunch"
+	"github.com/libp2p/go-libp2p/p2p/security/noise"
 	"github.com/libp2p/go-libp2p/p2p/transport/quicreuse"
 	"github.com/prometheus/client_golang/prometheus"
 
 	ma "github.com/multiformats/go-multiaddr"
 	madns "github.com/multiformats/go-multiaddr-dns"
+	"github.com/quic-go/quic-go"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxevent"
 )
@@ -81,8 +87,16 @@ type Config struct {
 	// using the [ProtocolVersion] option.
 	ProtocolVersion string
 
+	// IdentifyRefreshInterval is the interval after which identify runs again on a connection.
+	// It is set using the [IdentifyRefreshInterval] option.
+	IdentifyRefreshInterval time.Duration
+
 	PeerKey crypto.PrivKey
 
+	// Profile is the name of the deployment profile whose settings are applied, for settings
+	// that weren't configured explicitly. It is set using one of the libp2p.Profile options.
+	Profile string
+
 	QUICReuse          []fx.Option
 	Transports         []fx.Option
 	Muxers             []tptu.StreamMuxer
@@ -94,7 +108,9 @@ type Config struct {
 
 	RelayCustom bool
 	Relay       bool // should the relay transport be used
+	RelayOpts   []circuitv2.Option
 
+	RelayServiceCustom bool // set if the relay service was enabled or disabled by an option
 	EnableRelayService bool // should we run a circuitv2 relay (if publicly reachable)
 	RelayServiceOpts   []relayv2.Option
 
@@ -113,24 +129,45 @@ type Config struct {
 
 	DisablePing bool
 
+	EnableOptimisticNegotiation bool
+
 	Routing RoutingC
 
 	EnableAutoRelay bool
 	AutoRelayOpts   []autorelay.Option
 	AutoNATConfig
+	NATServiceCustom bool // set if the AutoNAT service was enabled or disabled by an option
 
+	EnableAutoNATv2 bool
+
+	HolePunchingCustom  bool // set if hole punching was enabled or disabled by an option
 	EnableHolePunching  bool
 	HolePunchingOptions []holepunch.Option
 
+	EnableNATFingerprinting bool
+
+	EnableIP6LinkLocal bool
+
+	PeerstoreUnconnectedTTL time.Duration
+
+	DeferStart bool
+
 	DisableMetrics       bool
 	PrometheusRegisterer prometheus.Registerer
 
+	TracerProvider trace.TracerProvider
+
+	EnableHealthScore bool
+	HealthScoreOpts   []health.Option
+
+	StatsRecorder *stats.Recorder
+
 	DialRanker network.DialRanker
 
 	SwarmOpts []swarm.Option
 }
 
-func (cfg *Config) makeSwarm(eventBus event.Bus, enableMetrics bool) (*swarm.Swarm, error) {
+func (cfg *Config) makeSwarm(eventBus event.Bus, enableMetrics bool, healthMonitor *health.Monitor) (*swarm.Swarm, error) {
 	if cfg.Peerstore == nil {
 		return nil, fmt.Errorf("no peerstore specified")
 	}
@@ -181,10 +218,25 @@ func (cfg *Config) makeSwarm(eventBus event.Bus, enableMetrics bool) (*swarm.Swa
 	if cfg.DialRanker != nil {
 		opts = append(opts, swarm.WithDialRanker(cfg.DialRanker))
 	}
+	if cfg.EnableIP6LinkLocal {
+		opts = append(opts, swarm.WithIP6LinkLocal())
+	}
+	if cfg.TracerProvider != nil {
+		opts = append(opts, swarm.WithTracerProvider(cfg.TracerProvider))
+	}
 
+	var mt swarm.MetricsTracer
 	if enableMetrics {
-		opts = append(opts,
-			swarm.WithMetricsTracer(swarm.NewMetricsTracer(swarm.WithRegisterer(cfg.PrometheusRegisterer))))
+		mt = swarm.NewMetricsTracer(swarm.WithRegisterer(cfg.PrometheusRegisterer))
+		if healthMonitor != nil {
+			mt = healthMonitor.SwarmMetricsTracer(mt)
+		}
+	}
+	if cfg.StatsRecorder != nil {
+		mt = cfg.StatsRecorder.SwarmMetricsTracer(mt)
+	}
+	if mt != nil {
+		opts = append(opts, swarm.WithMetricsTracer(mt))
 	}
 	// TODO: Make the swarm implementation configurable.
 	return swarm.NewSwarm(pid, cfg.Peerstore, eventBus, opts...)
@@ -197,9 +249,19 @@ func (cfg *Config) addTransports(h host.Host) error {
 		return fmt.Errorf("swarm does not support transports")
 	}
 
+	var upgraderOpts []tptu.Option
+	if cfg.TracerProvider != nil {
+		upgraderOpts = append(upgraderOpts, tptu.WithTracerProvider(cfg.TracerProvider))
+	}
+
 	fxopts := []fx.Option{
 		fx.WithLogger(func() fxevent.Logger { return getFXLogger() }),
-		fx.Provide(fx.Annotate(tptu.New, fx.ParamTags(`name:"security"`))),
+		fx.Provide(fx.Annotate(
+			func(security []sec.SecureTransport, muxers []tptu.StreamMuxer, psk pnet.PSK, rcmgr network.ResourceManager, gater connmgr.ConnectionGater) (transport.Upgrader, error) {
+				return tptu.New(security, muxers, psk, rcmgr, gater, upgraderOpts...)
+			},
+			fx.ParamTags(`name:"security"`),
+		)),
 		fx.Supply(cfg.Muxers),
 		fx.Supply(h.ID()),
 		fx.Provide(func() host.Host { return h }),
@@ -253,6 +315,13 @@ func (cfg *Config) addTransports(h host.Host) error {
 							t = append(t, st)
 						}
 					}
+					if !cfg.DisableMetrics {
+						for _, st := range t {
+							if nt, ok := st.(*noise.Transport); ok {
+								nt.UseDefaultMetricsTracer(noise.NewMetricsTracer(noise.WithRegisterer(cfg.PrometheusRegisterer)))
+							}
+						}
+					}
 					return t, nil
 				},
 				fx.ParamTags(`group:"security_unordered"`),
@@ -264,7 +333,14 @@ func (cfg *Config) addTransports(h host.Host) error {
 	if cfg.QUICReuse != nil {
 		fxopts = append(fxopts, cfg.QUICReuse...)
 	} else {
-		fxopts = append(fxopts, fx.Provide(quicreuse.NewConnManager)) // TODO: close the ConnManager when shutting down the node
+		// TODO: close the ConnManager when shutting down the node
+		fxopts = append(fxopts, fx.Provide(func(key quic.StatelessResetKey, rcmgr network.ResourceManager) (*quicreuse.ConnManager, error) {
+			opts := []quicreuse.Option{quicreuse.WithResourceManager(rcmgr)}
+			if len(cfg.PSK) > 0 {
+				opts = append(opts, quicreuse.PrivateNetwork(cfg.PSK))
+			}
+			return quicreuse.NewConnManager(key, opts...)
+		}))
 	}
 
 	fxopts = append(fxopts, fx.Invoke(
@@ -281,7 +357,9 @@ func (cfg *Config) addTransports(h host.Host) error {
 		)),
 	)
 	if cfg.Relay {
-		fxopts = append(fxopts, fx.Invoke(circuitv2.AddTransport))
+		fxopts = append(fxopts, fx.Invoke(func(h host.Host, upgrader transport.Upgrader) error {
+			return circuitv2.AddTransport(h, upgrader, cfg.RelayOpts...)
+		}))
 	}
 	app := fx.New(fxopts...)
 	if err := app.Err(); err != nil {
@@ -296,7 +374,28 @@ func (cfg *Config) addTransports(h host.Host) error {
 // This function consumes the config. Do not reuse it (really!).
 func (cfg *Config) NewNode() (host.Host, error) {
 	eventBus := eventbus.NewBus(eventbus.WithMetricsTracer(eventbus.NewMetricsTracer(eventbus.WithRegisterer(cfg.PrometheusRegisterer))))
-	swrm, err := cfg.makeSwarm(eventBus, !cfg.DisableMetrics)
+	var healthMonitor *health.Monitor
+	if cfg.EnableHealthScore {
+		if cfg.DisableMetrics {
+			return nil, fmt.Errorf("cannot enable the health score; metrics are disabled")
+		}
+		opts := append([]health.Option{
+			health.WithMetricsTracer(health.NewMetricsTracer(health.WithRegisterer(cfg.PrometheusRegisterer))),
+		}, cfg.HealthScoreOpts...)
+		var err error
+		healthMonitor, err = health.NewMonitor(opts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var gater *lifecycleGater
+	if cfg.DeferStart {
+		gater = &lifecycleGater{gater: cfg.ConnectionGater}
+		cfg.ConnectionGater = gater
+	}
+
+	swrm, err := cfg.makeSwarm(eventBus, !cfg.DisableMetrics, healthMonitor)
 	if err != nil {
 		return nil, err
 	}
@@ -306,19 +405,26 @@ func (cfg *Config) NewNode() (host.Host, error) {
 	}
 
 	h, err := bhost.NewHost(swrm, &bhost.HostOpts{
-		EventBus:             eventBus,
-		ConnManager:          cfg.ConnManager,
-		AddrsFactory:         cfg.AddrsFactory,
-		NATManager:           cfg.NATManager,
-		EnablePing:           !cfg.DisablePing,
-		UserAgent:            cfg.UserAgent,
-		ProtocolVersion:      cfg.ProtocolVersion,
-		EnableHolePunching:   cfg.EnableHolePunching,
-		HolePunchingOptions:  cfg.HolePunchingOptions,
-		EnableRelayService:   cfg.EnableRelayService,
-		RelayServiceOpts:     cfg.RelayServiceOpts,
-		EnableMetrics:        !cfg.DisableMetrics,
-		PrometheusRegisterer: cfg.PrometheusRegisterer,
+		EventBus:                    eventBus,
+		ConnManager:                 cfg.ConnManager,
+		AddrsFactory:                cfg.AddrsFactory,
+		NATManager:                  cfg.NATManager,
+		EnablePing:                  !cfg.DisablePing,
+		EnableOptimisticNegotiation: cfg.EnableOptimisticNegotiation,
+		UserAgent:                   cfg.UserAgent,
+		ProtocolVersion:             cfg.ProtocolVersion,
+		IdentifyRefreshInterval:     cfg.IdentifyRefreshInterval,
+		EnableHolePunching:          cfg.EnableHolePunching,
+		HolePunchingOptions:         cfg.HolePunchingOptions,
+		EnableNATFingerprinting:     cfg.EnableNATFingerprinting,
+		EnableRelayService:          cfg.EnableRelayService,
+		RelayServiceOpts:            cfg.RelayServiceOpts,
+		EnableMetrics:               !cfg.DisableMetrics,
+		PrometheusRegisterer:        cfg.PrometheusRegisterer,
+		TracerProvider:              cfg.TracerProvider,
+		HealthMonitor:               healthMonitor,
+		EnableIP6LinkLocal:          cfg.EnableIP6LinkLocal,
+		PeerstoreUnconnectedTTL:     cfg.PeerstoreUnconnectedTTL,
 	})
 	if err != nil {
 		swrm.Close()
@@ -341,11 +447,13 @@ func (cfg *Config) NewNode() (host.Host, error) {
 		return nil, err
 	}
 
-	// TODO: This method succeeds if listening on one address succeeds. We
-	// should probably fail if listening on *any* addr fails.
-	if err := h.Network().Listen(cfg.ListenAddrs...); err != nil {
-		h.Close()
-		return nil, err
+	if !cfg.DeferStart {
+		// TODO: This method succeeds if listening on one address succeeds. We
+		// should probably fail if listening on *any* addr fails.
+		if err := h.Network().Listen(cfg.ListenAddrs...); err != nil {
+			h.Close()
+			return nil, err
+		}
 	}
 
 	// Configure routing and autorelay
@@ -396,42 +504,11 @@ func (cfg *Config) NewNode() (host.Host, error) {
 			autonat.WithPeerThrottling(cfg.AutoNATConfig.ThrottlePeerLimit))
 	}
 	if cfg.AutoNATConfig.EnableService {
-		autonatPrivKey, _, err := crypto.GenerateEd25519Key(rand.Reader)
-		if err != nil {
-			return nil, err
-		}
-		ps, err := pstoremem.NewPeerstore()
-		if err != nil {
-			return nil, err
-		}
-
-		// Pull out the pieces of the config that we _actually_ care about.
-		// Specifically, don't set up things like autorelay, listeners,
-		// identify, etc.
-		autoNatCfg := Config{
-			Transports:         cfg.Transports,
-			Muxers:             cfg.Muxers,
-			SecurityTransports: cfg.SecurityTransports,
-			Insecure:           cfg.Insecure,
-			PSK:                cfg.PSK,
-			ConnectionGater:    cfg.ConnectionGater,
-			Reporter:           cfg.Reporter,
-			PeerKey:            autonatPrivKey,
-			Peerstore:          ps,
-			DialRanker:         swarm.NoDelayDialRanker,
-		}
-
-		dialer, err := autoNatCfg.makeSwarm(eventbus.NewBus(), false)
+		dialerHost, err := cfg.makeAutoNATDialerHost()
 		if err != nil {
 			h.Close()
 			return nil, err
 		}
-		dialerHost := blankhost.NewBlankHost(dialer)
-		if err := autoNatCfg.addTransports(dialerHost); err != nil {
-			dialerHost.Close()
-			h.Close()
-			return nil, err
-		}
 		// NOTE: We're dropping the blank host here but that's fine. It
 		// doesn't really _do_ anything and doesn't even need to be
 		// closed (as long as we close the underlying network).
@@ -448,22 +525,94 @@ func (cfg *Config) NewNode() (host.Host, error) {
 	}
 	h.SetAutoNat(autonat)
 
-	// start the host background tasks
-	h.Start()
+	if cfg.EnableAutoNATv2 {
+		dialerHost, err := cfg.makeAutoNATDialerHost()
+		if err != nil {
+			h.Close()
+			return nil, err
+		}
+		an, err := autonatv2.New(h, dialerHost, autonatv2.UsingAddresses(func() []ma.Multiaddr {
+			return addrF(h.AllAddrs())
+		}))
+		if err != nil {
+			dialerHost.Close()
+			h.Close()
+			return nil, fmt.Errorf("failed to create autonat v2: %w", err)
+		}
+		h.SetAutoNATv2(an)
+	}
 
 	var ho host.Host
 	ho = h
 	if router != nil {
 		ho = routed.Wrap(h, router)
 	}
+	var arh *autorelay.AutoRelayHost
 	if ar != nil {
-		arh := autorelay.NewAutoRelayHost(ho, ar)
-		arh.Start()
+		arh = autorelay.NewAutoRelayHost(ho, ar)
 		ho = arh
 	}
+	startServices := func() {
+		// start the host background tasks
+		h.Start()
+		if arh != nil {
+			arh.Start()
+		}
+	}
+
+	if cfg.DeferStart {
+		return &lifecycleHost{
+			Host:          ho,
+			gater:         gater,
+			listenAddrs:   cfg.ListenAddrs,
+			startServices: startServices,
+		}, nil
+	}
+	startServices()
 	return ho, nil
 }
 
+// makeAutoNATDialerHost creates the host used by the AutoNAT services to dial back peers.
+// It has its own identity and peerstore, and only the transports, security and muxers of
+// the config, i.e. it doesn't listen, and doesn't run identify, autorelay, etc.
+func (cfg *Config) makeAutoNATDialerHost() (host.Host, error) {
+	autonatPrivKey, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := pstoremem.NewPeerstore()
+	if err != nil {
+		return nil, err
+	}
+
+	// Pull out the pieces of the config that we _actually_ care about.
+	// Specifically, don't set up things like autorelay, listeners,
+	// identify, etc.
+	autoNatCfg := Config{
+		Transports:         cfg.Transports,
+		Muxers:             cfg.Muxers,
+		SecurityTransports: cfg.SecurityTransports,
+		Insecure:           cfg.Insecure,
+		PSK:                cfg.PSK,
+		ConnectionGater:    cfg.ConnectionGater,
+		Reporter:           cfg.Reporter,
+		PeerKey:            autonatPrivKey,
+		Peerstore:          ps,
+		DialRanker:         swarm.NoDelayDialRanker,
+	}
+
+	dialer, err := autoNatCfg.makeSwarm(eventbus.NewBus(), false, nil)
+	if err != nil {
+		return nil, err
+	}
+	dialerHost := blankhost.NewBlankHost(dialer)
+	if err := autoNatCfg.addTransports(dialerHost); err != nil {
+		dialerHost.Close()
+		return nil, err
+	}
+	return dialerHost, nil
+}
+
 // Option is a libp2p config option that can be given to the libp2p constructor
 // (`libp2p.New`).
 type Option func(cfg *Config) error
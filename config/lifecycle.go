@@ -0,0 +1,165 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var (
+	errHostStarted    = errors.New("host already started")
+	errHostNotStarted = errors.New("host not started")
+)
+
+// lifecycleGater rejects all connections while the host is stopped.
+// Otherwise, it defers to the configured connection gater, if any.
+type lifecycleGater struct {
+	gater   connmgr.ConnectionGater
+	started atomic.Bool
+}
+
+var _ connmgr.ConnectionGater = &lifecycleGater{}
+
+func (g *lifecycleGater) InterceptPeerDial(p peer.ID) bool {
+	if !g.started.Load() {
+		return false
+	}
+	return g.gater == nil || g.gater.InterceptPeerDial(p)
+}
+
+func (g *lifecycleGater) InterceptAddrDial(p peer.ID, a ma.Multiaddr) bool {
+	if !g.started.Load() {
+		return false
+	}
+	return g.gater == nil || g.gater.InterceptAddrDial(p, a)
+}
+
+func (g *lifecycleGater) InterceptAccept(addrs network.ConnMultiaddrs) bool {
+	if !g.started.Load() {
+		return false
+	}
+	return g.gater == nil || g.gater.InterceptAccept(addrs)
+}
+
+func (g *lifecycleGater) InterceptSecured(dir network.Direction, p peer.ID, addrs network.ConnMultiaddrs) bool {
+	if !g.started.Load() {
+		return false
+	}
+	return g.gater == nil || g.gater.InterceptSecured(dir, p, addrs)
+}
+
+func (g *lifecycleGater) InterceptUpgraded(c network.Conn) (bool, control.DisconnectReason) {
+	if !g.started.Load() {
+		return false, 0
+	}
+	if g.gater == nil {
+		return true, 0
+	}
+	return g.gater.InterceptUpgraded(c)
+}
+
+// lifecycleHost is the host returned by NewNode if the DeferStart option is used.
+type lifecycleHost struct {
+	host.Host
+
+	gater       *lifecycleGater
+	listenAddrs []ma.Multiaddr
+	// startServices starts the host's background services. It's called on the first start.
+	startServices func()
+
+	mx              sync.Mutex
+	started         bool
+	servicesStarted bool
+}
+
+var (
+	_ host.Lifecycle            = &lifecycleHost{}
+	_ host.ProtocolStatsTracker = &lifecycleHost{}
+	_ host.MessageSizeLimiter   = &lifecycleHost{}
+	_ host.BatchConnector       = &lifecycleHost{}
+)
+
+func (h *lifecycleHost) Start(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if h.started {
+		return errHostStarted
+	}
+	// TODO: This method succeeds if listening on one address succeeds. We
+	// should probably fail if listening on *any* addr fails.
+	if err := h.Network().Listen(h.listenAddrs...); err != nil {
+		return err
+	}
+	h.gater.started.Store(true)
+	h.started = true
+	if !h.servicesStarted {
+		h.startServices()
+		h.servicesStarted = true
+	}
+	return nil
+}
+
+func (h *lifecycleHost) Stop(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if !h.started {
+		return errHostNotStarted
+	}
+	h.gater.started.Store(false)
+	h.started = false
+	n := h.Network()
+	if lc, ok := n.(interface{ ListenClose(...ma.Multiaddr) }); ok {
+		lc.ListenClose(n.ListenAddresses()...)
+	}
+	for _, c := range h.Network().Conns() {
+		c.Close()
+	}
+	return nil
+}
+
+func (h *lifecycleHost) Restart(ctx context.Context) error {
+	if err := h.Stop(ctx); err != nil {
+		return err
+	}
+	return h.Start(ctx)
+}
+
+// PeerProtocolStats returns the protocol usage statistics of the underlying host,
+// if it tracks them.
+func (h *lifecycleHost) PeerProtocolStats(p peer.ID) map[protocol.ID]host.ProtocolStats {
+	if t, ok := h.Host.(host.ProtocolStatsTracker); ok {
+		return t.PeerProtocolStats(p)
+	}
+	return nil
+}
+
+// SetStreamHandlerWithLimit sets the protocol handler on the underlying host,
+// enforcing the message size limit. See host.MessageSizeLimiter.
+func (h *lifecycleHost) SetStreamHandlerWithLimit(pid protocol.ID, limit host.MessageSizeLimit, handler network.StreamHandler) {
+	host.SetStreamHandlerWithLimit(h.Host, pid, limit, handler)
+}
+
+// ConnectMany connects to all peers in pis using the underlying host. See host.BatchConnector.
+func (h *lifecycleHost) ConnectMany(ctx context.Context, pis []peer.AddrInfo, opts ...host.ConnectManyOption) <-chan host.ConnectResult {
+	return host.ConnectMany(ctx, h.Host, pis, opts...)
+}
@@ -0,0 +1,42 @@
+package connmgr
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Offense is a kind of misbehavior of a remote peer.
+type Offense int
+
+const (
+	// OffenseHandshakeFailure is a failed security or stream multiplexer handshake on an inbound connection.
+	// Since the peer is not authenticated, it is charged against the IP address.
+	// Timeouts, connections closed by the remote, and connections rejected by the local node are not offenses.
+	OffenseHandshakeFailure Offense = iota
+	// OffenseProtocolViolation is a violation of the stream multiplexer protocol, e.g. a malformed frame.
+	OffenseProtocolViolation
+	// OffenseResourceLimit is a stream that was rejected because it exceeded the resource limits of
+	// the peer. Streams rejected because of limits shared by all peers are not offenses.
+	OffenseResourceLimit
+)
+
+func (o Offense) String() string {
+	switch o {
+	case OffenseHandshakeFailure:
+		return "handshake failure"
+	case OffenseProtocolViolation:
+		return "protocol violation"
+	case OffenseResourceLimit:
+		return "resource limit"
+	default:
+		return "unknown offense"
+	}
+}
+
+// OffenseRecorder records offenses.
+// The swarm and the upgrader report offenses if the connection gater implements this interface.
+type OffenseRecorder interface {
+	// RecordOffense records an offense committed by peer p, or by the remote address addr if the peer is not known.
+	RecordOffense(p peer.ID, addr ma.Multiaddr, o Offense)
+}
@@ -0,0 +1,51 @@
+package event
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// AutoRelayCandidateStage is a stage of the pipeline AutoRelay uses to select relays.
+type AutoRelayCandidateStage string
+
+const (
+	// AutoRelayCandidateFound means that the peer source returned the peer as a potential relay.
+	AutoRelayCandidateFound AutoRelayCandidateStage = "found"
+	// AutoRelayCandidateProbed means that the peer was probed successfully: it is a public node
+	// supporting circuit v2, and was added to the candidates.
+	AutoRelayCandidateProbed AutoRelayCandidateStage = "probed"
+	// AutoRelayCandidateReserved means that a reservation with the peer was obtained.
+	AutoRelayCandidateReserved AutoRelayCandidateStage = "reserved"
+	// AutoRelayCandidateDropped means that the peer was dropped from the pipeline.
+	AutoRelayCandidateDropped AutoRelayCandidateStage = "dropped"
+)
+
+// EvtAutoRelayCandidate is emitted when a potential relay moves through the AutoRelay
+// candidate pipeline. It allows debugging why a node doesn't obtain a relay address.
+type EvtAutoRelayCandidate struct {
+	// Peer is the potential relay.
+	Peer peer.ID
+	// Stage is the stage the peer reached.
+	Stage AutoRelayCandidateStage
+	// Reason is the reason the peer was dropped, if Stage is AutoRelayCandidateDropped.
+	// See the autorelay package for the possible reasons.
+	Reason string
+}
+
+// EvtCircuitLatencyMeasured is emitted when the circuit v2 client established a relayed connection.
+// It reports the latency of the circuit, which can be used to assess the performance of the relay.
+type EvtCircuitLatencyMeasured struct {
+	// Relay is the relay the circuit goes through.
+	Relay peer.ID
+	// Peer is the destination of the circuit.
+	Peer peer.ID
+	// CircuitRTT is the time it took to open the circuit. It covers the round trip to the relay and
+	// the round trip from the relay to the destination.
+	CircuitRTT time.Duration
+	// RelayRTT is the round trip time to the relay, or 0 if it is unknown.
+	RelayRTT time.Duration
+	// DestinationRTT is the round trip time from the relay to the destination, including the time
+	// the relay took to process the request, or 0 if it is unknown.
+	DestinationRTT time.Duration
+}
@@ -1,11 +1,18 @@
 package event
 
-import "github.com/libp2p/go-libp2p/core/peer"
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+)
 
 // EvtPeerIdentificationCompleted is emitted when the initial identification round for a peer is completed.
 type EvtPeerIdentificationCompleted struct {
 	// Peer is the ID of the peer whose identification succeeded.
 	Peer peer.ID
+
+	// SignedPeerRecord is the signed peer record sent by the peer, after verifying that it was
+	// signed by the peer. May be nil.
+	SignedPeerRecord *record.Envelope
 }
 
 // EvtPeerIdentificationFailed is emitted when the initial identification round for a peer failed.
@@ -3,6 +3,8 @@ package event
 import (
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 // EvtPeerConnectednessChanged should be emitted every time the "connectedness" to a
@@ -53,3 +55,72 @@ type EvtPeerConnectednessChanged struct {
 	// Connectedness is the new connectedness state.
 	Connectedness network.Connectedness
 }
+
+// EvtListenerFailed is emitted when a listener fails unexpectedly, for example because
+// of a socket error. The network attempts to restart the listener, with a backoff.
+type EvtListenerFailed struct {
+	// Addr is the address passed to Listen.
+	Addr ma.Multiaddr
+	// ListenAddr is the address the listener was listening on.
+	ListenAddr ma.Multiaddr
+	// Err is the error that caused the listener to fail.
+	Err error
+}
+
+// EvtListenerRestarted is emitted when a listener that failed was restarted.
+type EvtListenerRestarted struct {
+	// Addr is the address passed to Listen.
+	Addr ma.Multiaddr
+	// ListenAddr is the address the restarted listener is listening on.
+	// It can differ from the address of the failed listener if Addr uses port 0.
+	ListenAddr ma.Multiaddr
+	// Attempts is the number of attempts it took to restart the listener.
+	Attempts int
+}
+
+// EvtListenerClosed is emitted when a listener is closed using ListenClose.
+// The host withdraws the addresses provided by the listener: it stops advertising
+// them, and notifies connected peers of the change using identify push.
+type EvtListenerClosed struct {
+	// Addr is the address passed to Listen.
+	Addr ma.Multiaddr
+	// ListenAddr is the address the listener was listening on.
+	ListenAddr ma.Multiaddr
+}
+
+// EvtMaintenanceModeChanged is emitted when the network enters or leaves maintenance mode.
+// While in maintenance mode, the network doesn't dial any new connections. Existing connections
+// are kept, and inbound connections are still accepted.
+type EvtMaintenanceModeChanged struct {
+	// Enabled is true if the network is in maintenance mode.
+	Enabled bool
+	// Reason is the reason given for entering maintenance mode.
+	Reason string
+}
+
+// EvtDialAddrsSkipped is emitted when a peer has more addresses than the network attempts
+// to dial in a single dial, and some of its addresses were skipped. It is emitted regardless of
+// whether the dial eventually succeeds; a failed dial also reports the skipped addresses in its error.
+type EvtDialAddrsSkipped struct {
+	// Peer is the peer that was dialed.
+	Peer peer.ID
+	// Skipped are the addresses that weren't dialed.
+	Skipped []ma.Multiaddr
+}
+
+// EvtDirectConnectionUpgraded is emitted when a direct connection to a peer was established, for
+// example by hole punching, while we're connected to that peer via a relay.
+//
+// Streams on the relayed connection are not moved to the direct connection, unless the protocol opted
+// in to stream migration. Applications should re-open their streams on the direct connection, and may
+// then close the relayed connection.
+type EvtDirectConnectionUpgraded struct {
+	// Peer is the remote peer.
+	Peer peer.ID
+	// RelayedConnID is the ID of the relayed connection, see network.Conn.ID.
+	RelayedConnID string
+	// DirectConnID is the ID of the new direct connection.
+	DirectConnID string
+	// Migrated are the IDs of the streams that were migrated to the direct connection.
+	Migrated []string
+}
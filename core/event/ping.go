@@ -0,0 +1,22 @@
+package event
+
+import (
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// EvtPeerSuspected is emitted by the ping watchdog when a watched peer failed to
+// respond to a number of consecutive pings, and is now suspected to be unreachable.
+type EvtPeerSuspected struct {
+	// Peer is the peer that is suspected to be unreachable.
+	Peer peer.ID
+	// Failures is the number of consecutive failed pings.
+	Failures int
+	// Err is the error of the last failed ping.
+	Err error
+}
+
+// EvtPeerRecovered is emitted by the ping watchdog when a suspected peer responds
+// to a ping again.
+type EvtPeerRecovered struct {
+	Peer peer.ID
+}
@@ -2,6 +2,8 @@ package event
 
 import (
 	"github.com/libp2p/go-libp2p/core/network"
+
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 // EvtLocalReachabilityChanged is an event struct to be emitted when the local's
@@ -11,3 +13,15 @@ import (
 type EvtLocalReachabilityChanged struct {
 	Reachability network.Reachability
 }
+
+// EvtHostReachableAddrsChanged is an event struct to be emitted when the reachability
+// of the host's addresses changes.
+//
+// This event is usually emitted by the AutoNAT v2 subsystem, which verifies the reachability
+// of every address individually. Unknown contains the addresses that haven't been verified
+// with enough confidence yet.
+type EvtHostReachableAddrsChanged struct {
+	Reachable   []ma.Multiaddr
+	Unreachable []ma.Multiaddr
+	Unknown     []ma.Multiaddr
+}
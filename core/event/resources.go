@@ -0,0 +1,17 @@
+package event
+
+// EvtResourcePressureChanged is an event struct to be emitted when the connection manager
+// detects that the resource manager comes under pressure, or that the pressure subsided.
+//
+// While under pressure, the connection manager uses reduced watermarks. Once the pressure
+// subsides, the configured watermarks are restored.
+type EvtResourcePressureChanged struct {
+	// UnderPressure is true if the resource manager is under pressure.
+	UnderPressure bool
+	// MemoryUtilization is the utilization of the memory limit of the system scope, between 0 and 1.
+	MemoryUtilization float64
+	// LowWater is the low watermark of the connection manager in effect after this event.
+	LowWater int
+	// HighWater is the high watermark of the connection manager in effect after this event.
+	HighWater int
+}
@@ -0,0 +1,205 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// DefaultConnectConcurrency is the default number of concurrent dials used by ConnectMany.
+const DefaultConnectConcurrency = 8
+
+// ConnectResult is the result of connecting to a single peer using ConnectMany.
+type ConnectResult struct {
+	// ID is the peer that we tried to connect to.
+	ID peer.ID
+	// Err is nil if we're connected to the peer.
+	Err error
+}
+
+// ConnectManyOptions are the options for ConnectMany.
+type ConnectManyOptions struct {
+	// Concurrency is the maximum number of peers that are dialed concurrently.
+	Concurrency int
+	// Tag and TagValue are used to tag the connected peers in the connection manager.
+	// Peers aren't tagged if Tag is empty.
+	Tag      string
+	TagValue int
+	// ProtectTag is used to protect the connected peers in the connection manager.
+	// Peers aren't protected if ProtectTag is empty.
+	ProtectTag string
+}
+
+// ConnectManyOption is an option for ConnectMany.
+type ConnectManyOption func(*ConnectManyOptions) error
+
+// WithConnectConcurrency sets the maximum number of peers that are dialed concurrently.
+// Defaults to DefaultConnectConcurrency.
+func WithConnectConcurrency(n int) ConnectManyOption {
+	return func(o *ConnectManyOptions) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid concurrency: %d", n)
+		}
+		o.Concurrency = n
+		return nil
+	}
+}
+
+// WithConnectTag tags all peers that ConnectMany connected to with tag and value in the
+// connection manager, making them less likely to be trimmed. See connmgr.ConnManager.TagPeer.
+// Without this option, the connections are treated like any other connection.
+func WithConnectTag(tag string, value int) ConnectManyOption {
+	return func(o *ConnectManyOptions) error {
+		if tag == "" {
+			return errors.New("empty tag")
+		}
+		o.Tag = tag
+		o.TagValue = value
+		return nil
+	}
+}
+
+// WithConnectProtection protects all peers that ConnectMany connected to from being trimmed by
+// the connection manager, until they are unprotected using tag. See connmgr.ConnManager.Protect.
+func WithConnectProtection(tag string) ConnectManyOption {
+	return func(o *ConnectManyOptions) error {
+		if tag == "" {
+			return errors.New("empty protection tag")
+		}
+		o.ProtectTag = tag
+		return nil
+	}
+}
+
+// ParseConnectManyOptions applies opts to the default options.
+// It is used by implementations of BatchConnector.
+func ParseConnectManyOptions(opts ...ConnectManyOption) (ConnectManyOptions, error) {
+	o := ConnectManyOptions{Concurrency: DefaultConnectConcurrency}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return o, err
+		}
+	}
+	return o, nil
+}
+
+// ManageConnectedPeer tags and protects the connected peer p in cm, as configured by the options.
+// It is used by implementations of BatchConnector.
+func (o ConnectManyOptions) ManageConnectedPeer(cm connmgr.ConnManager, p peer.ID) {
+	if o.Tag != "" {
+		cm.TagPeer(p, o.Tag, o.TagValue)
+	}
+	if o.ProtectTag != "" {
+		cm.Protect(p, o.ProtectTag)
+	}
+}
+
+// BatchConnector is implemented by hosts that can connect to many peers at once.
+type BatchConnector interface {
+	// ConnectMany connects to all peers in pis, dialing at most Concurrency peers at once.
+	// It returns a channel that receives one ConnectResult for every peer, in the order the
+	// connection attempts complete. The channel is closed once all attempts have completed.
+	// If the same peer is included multiple times, its addresses are merged, and it is only
+	// dialed (and reported) once.
+	// Connected peers are tagged and protected in the connection manager if the
+	// WithConnectTag and WithConnectProtection options are used.
+	ConnectMany(ctx context.Context, pis []peer.AddrInfo, opts ...ConnectManyOption) <-chan ConnectResult
+}
+
+// ConnectMany connects h to all peers in pis. See BatchConnector for details.
+// If h doesn't implement BatchConnector, h.Connect is called for every peer.
+func ConnectMany(ctx context.Context, h Host, pis []peer.AddrInfo, opts ...ConnectManyOption) <-chan ConnectResult {
+	if bc, ok := h.(BatchConnector); ok {
+		return bc.ConnectMany(ctx, pis, opts...)
+	}
+	// invalid options are reported by RunConnectMany
+	o, _ := ParseConnectManyOptions(opts...)
+	return RunConnectMany(ctx, pis, func(ctx context.Context, pi peer.AddrInfo) error {
+		if err := h.Connect(ctx, pi); err != nil {
+			return err
+		}
+		o.ManageConnectedPeer(h.ConnManager(), pi.ID)
+		return nil
+	}, opts...)
+}
+
+// RunConnectMany calls connect for every peer in pis, calling it at most Concurrency times
+// concurrently, and returns the results as described in BatchConnector.
+// Peers that haven't been dialed when ctx is canceled are reported with the context's error.
+// It is used by implementations of BatchConnector.
+func RunConnectMany(ctx context.Context, pis []peer.AddrInfo, connect func(context.Context, peer.AddrInfo) error, opts ...ConnectManyOption) <-chan ConnectResult {
+	pis = mergeAddrInfos(pis)
+	results := make(chan ConnectResult, len(pis))
+	o, err := ParseConnectManyOptions(opts...)
+	if err != nil {
+		for _, pi := range pis {
+			results <- ConnectResult{ID: pi.ID, Err: err}
+		}
+		close(results)
+		return results
+	}
+
+	work := make(chan peer.AddrInfo)
+	workers := o.Concurrency
+	if workers > len(pis) {
+		workers = len(pis)
+	}
+	done := make(chan struct{}, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for pi := range work {
+				results <- ConnectResult{ID: pi.ID, Err: connect(ctx, pi)}
+			}
+		}()
+	}
+	go func() {
+	loop:
+		for i, pi := range pis {
+			select {
+			case work <- pi:
+			case <-ctx.Done():
+				for _, pi := range pis[i:] {
+					results <- ConnectResult{ID: pi.ID, Err: ctx.Err()}
+				}
+				break loop
+			}
+		}
+		close(work)
+		for i := 0; i < workers; i++ {
+			<-done
+		}
+		close(results)
+	}()
+	return results
+}
+
+// mergeAddrInfos merges the addresses of AddrInfos with the same peer ID,
+// preserving the order in which the peers first appear.
+func mergeAddrInfos(pis []peer.AddrInfo) []peer.AddrInfo {
+	idx := make(map[peer.ID]int, len(pis))
+	out := make([]peer.AddrInfo, 0, len(pis))
+	for _, pi := range pis {
+		i, ok := idx[pi.ID]
+		if !ok {
+			idx[pi.ID] = len(out)
+			out = append(out, peer.AddrInfo{ID: pi.ID, Addrs: append([]ma.Multiaddr(nil), pi.Addrs...)})
+			continue
+		}
+	addrs:
+		for _, a := range pi.Addrs {
+			for _, b := range out[i].Addrs {
+				if a.Equal(b) {
+					continue addrs
+				}
+			}
+			out[i].Addrs = append(out[i].Addrs, a)
+		}
+	}
+	return out
+}
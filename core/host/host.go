@@ -73,3 +73,41 @@ type Host interface {
 	// EventBus returns the hosts eventbus
 	EventBus() event.Bus
 }
+
+// Lifecycle is implemented by hosts whose construction is separated from their start,
+// for example hosts constructed using the libp2p.DeferStart option.
+// Before the host is started, it doesn't listen, and doesn't accept or dial any connections.
+// This allows applications to register stream handlers and subscribe to events before
+// the node becomes reachable.
+type Lifecycle interface {
+	// Start starts listening on the configured listen addresses, and allows connections to be
+	// accepted and dialed. The first call also starts the host's background services.
+	Start(ctx context.Context) error
+	// Stop stops listening and closes all connections. No connections are accepted or dialed
+	// until the host is started again. Stop doesn't release the host's resources, use Close for that.
+	Stop(ctx context.Context) error
+	// Restart stops and starts the host.
+	Restart(ctx context.Context) error
+}
+
+// ProtocolStats are the usage statistics of a protocol with a single peer.
+type ProtocolStats struct {
+	// StreamsInbound is the number of streams opened by the peer.
+	StreamsInbound uint64
+	// StreamsOutbound is the number of streams opened to the peer.
+	StreamsOutbound uint64
+	// BytesIn is the number of bytes read from the streams.
+	BytesIn uint64
+	// BytesOut is the number of bytes written to the streams.
+	BytesOut uint64
+	// Errors is the number of streams that were reset, or failed with an error other than EOF.
+	Errors uint64
+}
+
+// ProtocolStatsTracker is implemented by hosts that track how much every peer uses every protocol.
+// Applications can use these statistics to decide which peers to evict or prioritize.
+type ProtocolStatsTracker interface {
+	// PeerProtocolStats returns the usage statistics of all protocols used with peer p.
+	// Statistics are kept as long as the host is connected to p.
+	PeerProtocolStats(p peer.ID) map[protocol.ID]ProtocolStats
+}
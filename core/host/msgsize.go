@@ -0,0 +1,117 @@
+package host
+
+import (
+	"errors"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// ErrMessageTooLarge is returned when reading from a stream on which the remote peer sent
+// a message exceeding the MessageSizeLimit of the stream's protocol. The stream is reset.
+var ErrMessageTooLarge = errors.New("message exceeds the maximum message size of the protocol")
+
+// MessageSizeLimit limits the size of the messages a peer can send on a stream.
+type MessageSizeLimit struct {
+	// MaxSize is the maximum size of a message, in bytes. A MaxSize of 0 disables the limit.
+	MaxSize uint64
+	// Delimited is set for protocols that prefix every message with its length, encoded as an
+	// unsigned varint (as written by the delimited writers of go-msgio's pbio package).
+	// MaxSize then applies to every message, excluding the length prefix.
+	// Otherwise, MaxSize applies to all bytes the peer sends on the stream.
+	Delimited bool
+}
+
+// MessageSizeLimiter is implemented by hosts that enforce a maximum message size per protocol.
+type MessageSizeLimiter interface {
+	// SetStreamHandlerWithLimit sets the protocol handler, like SetStreamHandler.
+	// The host enforces limit on all streams of protocol pid, both inbound and outbound:
+	// once the remote peer exceeds the limit, the stream is reset, and reading from it
+	// returns ErrMessageTooLarge.
+	SetStreamHandlerWithLimit(pid protocol.ID, limit MessageSizeLimit, handler network.StreamHandler)
+}
+
+// SetStreamHandlerWithLimit sets the handler of protocol pid on h, and enforces limit on its streams.
+// If h doesn't implement MessageSizeLimiter, the limit is only enforced on inbound streams.
+func SetStreamHandlerWithLimit(h Host, pid protocol.ID, limit MessageSizeLimit, handler network.StreamHandler) {
+	if l, ok := h.(MessageSizeLimiter); ok {
+		l.SetStreamHandlerWithLimit(pid, limit, handler)
+		return
+	}
+	h.SetStreamHandler(pid, func(s network.Stream) { handler(LimitStream(s, limit)) })
+}
+
+// LimitStream returns a stream that enforces limit on the data read from s.
+func LimitStream(s network.Stream, limit MessageSizeLimit) network.Stream {
+	if limit.MaxSize == 0 {
+		return s
+	}
+	return &limitedStream{Stream: s, limit: limit}
+}
+
+type limitedStream struct {
+	network.Stream
+	limit MessageSizeLimit
+
+	err error
+	// read is the number of bytes read, if the stream isn't delimited.
+	read uint64
+	// For delimited streams: remaining is the number of bytes of the current message that are
+	// yet to be read, and length and shift are the state of the length prefix being read.
+	remaining uint64
+	length    uint64
+	shift     uint
+}
+
+func (s *limitedStream) Read(b []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	n, err := s.Stream.Read(b)
+	if accErr := s.account(b[:n]); accErr != nil {
+		s.err = accErr
+		s.Stream.Reset()
+		return 0, accErr
+	}
+	return n, err
+}
+
+// account counts the bytes read, and returns ErrMessageTooLarge if the limit is exceeded.
+func (s *limitedStream) account(b []byte) error {
+	if !s.limit.Delimited {
+		s.read += uint64(len(b))
+		if s.read > s.limit.MaxSize {
+			return ErrMessageTooLarge
+		}
+		return nil
+	}
+	for len(b) > 0 {
+		if s.remaining > 0 {
+			n := uint64(len(b))
+			if n > s.remaining {
+				n = s.remaining
+			}
+			s.remaining -= n
+			b = b[n:]
+			continue
+		}
+		// read the next byte of the length prefix
+		c := b[0]
+		b = b[1:]
+		if s.shift >= 64 {
+			return ErrMessageTooLarge
+		}
+		s.length |= uint64(c&0x7f) << s.shift
+		if s.length > s.limit.MaxSize {
+			return ErrMessageTooLarge
+		}
+		if c < 0x80 {
+			s.remaining = s.length
+			s.length = 0
+			s.shift = 0
+			continue
+		}
+		s.shift += 7
+	}
+	return nil
+}
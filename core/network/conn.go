@@ -2,6 +2,7 @@ package network
 
 import (
 	"context"
+	"errors"
 	"io"
 
 	ic "github.com/libp2p/go-libp2p/core/crypto"
@@ -49,6 +50,12 @@ type ConnectionState struct {
 	Transport string
 	// indicates whether StreamMultiplexer was selected using inlined muxer negotiation
 	UsedEarlyMuxerNegotiation bool
+	// The cipher suite negotiated by the security protocol (if known).
+	// For example: Noise_XX_25519_ChaChaPoly_SHA256 or TLS_AES_128_GCM_SHA256
+	CipherSuite string
+	// The number of key updates performed on this connection, if the transport supports
+	// key updates and keeps track of them (currently only QUIC).
+	KeyUpdates uint64
 }
 
 // ConnSecurity is the interface that one can mix into a connection interface to
@@ -91,3 +98,40 @@ type ConnScoper interface {
 	// Scope returns the user view of this connection's resource scope
 	Scope() ConnScope
 }
+
+// ErrMessagesNotSupported is returned when sending or receiving a message on a
+// connection that doesn't support messages.
+var ErrMessagesNotSupported = errors.New("connection doesn't support messages")
+
+// MessageConn is an optional interface for connections that can exchange small
+// messages with the peer, without the overhead of opening a stream. This is
+// useful for control-plane messages, like application-level pings and hints.
+//
+// Messages are delivered unreliably: they may be lost or reordered. Messages
+// that don't fit into a single packet are rejected. Received messages are
+// queued until they are read. The queue is small, and its memory is accounted
+// for in the connection's resource scope. Messages are dropped if the queue is
+// full or the memory can't be reserved.
+//
+// Messages are not associated with a protocol, and there is no dispatching of
+// messages to different protocols: every message is returned by exactly one call
+// to ReceiveMessage. Only a single component should receive messages on a
+// connection. Applications that use messages for multiple purposes need to
+// demultiplex them themselves, for example by prefixing every message with a
+// type identifier.
+//
+// Whether messages can be used depends on the transport, and, for QUIC, on the
+// peer. This needs to be checked at runtime:
+//
+//	if mc, ok := c.(MessageConn); ok && mc.SupportsMessages() {
+//		err := mc.SendMessage(msg)
+//	}
+type MessageConn interface {
+	// SupportsMessages says if messages can be exchanged on this connection.
+	SupportsMessages() bool
+	// SendMessage sends a message to the peer.
+	SendMessage(msg []byte) error
+	// ReceiveMessage blocks until a message is received, the context is canceled,
+	// or the connection is closed.
+	ReceiveMessage(ctx context.Context) ([]byte, error)
+}
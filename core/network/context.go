@@ -3,6 +3,8 @@ package network
 import (
 	"context"
 	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
 )
 
 // DialPeerTimeout is the default timeout for a single call to `DialPeer`. When
@@ -15,6 +17,8 @@ type dialPeerTimeoutCtxKey struct{}
 type forceDirectDialCtxKey struct{}
 type useTransientCtxKey struct{}
 type simConnectCtxKey struct{ isClient bool }
+type connScopeCtxKey struct{}
+type additionalConnCtxKey struct{}
 
 var noDial = noDialCtxKey{}
 var forceDirectDial = forceDirectDialCtxKey{}
@@ -40,6 +44,32 @@ func GetForceDirectDial(ctx context.Context) (forceDirect bool, reason string) {
 	return false, ""
 }
 
+// EXPERIMENTAL
+// WithAdditionalConnection constructs a new context with an option that instructs the network
+// to dial a new connection to a peer, even if a connection to it already exists.
+// Only addresses accepted by filter are dialed, and an existing connection is only reused
+// if its remote address is accepted by filter.
+// This is used to establish a second path to a peer, e.g. a QUIC connection to a peer
+// that we're already connected to via TCP.
+func WithAdditionalConnection(ctx context.Context, reason string, filter func(ma.Multiaddr) bool) context.Context {
+	return context.WithValue(ctx, additionalConnCtxKey{}, additionalConn{reason: reason, filter: filter})
+}
+
+// EXPERIMENTAL
+// GetAdditionalConnection returns true if the additional connection option is set in the context.
+func GetAdditionalConnection(ctx context.Context) (filter func(ma.Multiaddr) bool, reason string, ok bool) {
+	v, ok := ctx.Value(additionalConnCtxKey{}).(additionalConn)
+	if !ok {
+		return nil, "", false
+	}
+	return v.filter, v.reason, true
+}
+
+type additionalConn struct {
+	reason string
+	filter func(ma.Multiaddr) bool
+}
+
 // WithSimultaneousConnect constructs a new context with an option that instructs the transport
 // to apply hole punching logic where applicable.
 // EXPERIMENTAL
@@ -108,3 +138,16 @@ func GetUseTransient(ctx context.Context) (usetransient bool, reason string) {
 	}
 	return false, ""
 }
+
+// WithConnScope constructs a new context carrying the resource scope of a connection that is
+// being upgraded. Security transports use this scope to account for memory allocated before the
+// remote peer is authenticated.
+func WithConnScope(ctx context.Context, scope ConnScope) context.Context {
+	return context.WithValue(ctx, connScopeCtxKey{}, scope)
+}
+
+// GetConnScope returns the connection resource scope set in the context, if any.
+func GetConnScope(ctx context.Context) (scope ConnScope, ok bool) {
+	scope, ok = ctx.Value(connScopeCtxKey{}).(ConnScope)
+	return scope, ok
+}
@@ -57,3 +57,40 @@ func TestSimultaneousConnect(t *testing.T) {
 		require.Equal(t, reason, "foo")
 	})
 }
+
+func TestDialBudget(t *testing.T) {
+	ctx := context.Background()
+	require.False(t, HasDialBudget(ctx))
+	sctx, cancel := WithDialStage(ctx, DialStageSecurity)
+	defer cancel()
+	_, ok := sctx.Deadline()
+	require.False(t, ok)
+
+	ctx = WithDialBudget(ctx, DialBudget{Total: 10 * time.Second})
+	require.True(t, HasDialBudget(ctx))
+	// the resolution gets 1/10 of the budget
+	rctx, cancel := WithDialStage(ctx, DialStageResolve)
+	defer cancel()
+	deadline, ok := rctx.Deadline()
+	require.True(t, ok)
+	require.InDelta(t, time.Second, time.Until(deadline), float64(100*time.Millisecond))
+	// the muxer stage gets all of the remaining budget
+	mctx, cancel := WithDialStage(ctx, DialStageMuxer)
+	defer cancel()
+	deadline, ok = mctx.Deadline()
+	require.True(t, ok)
+	require.InDelta(t, 10*time.Second, time.Until(deadline), float64(100*time.Millisecond))
+
+	// custom weights
+	ctx = WithDialBudget(context.Background(), DialBudget{Total: 10 * time.Second, Weights: [4]float64{0, 1, 1, 0}})
+	tctx, cancel := WithDialStage(ctx, DialStageTransport)
+	defer cancel()
+	deadline, ok = tctx.Deadline()
+	require.True(t, ok)
+	require.InDelta(t, 5*time.Second, time.Until(deadline), float64(100*time.Millisecond))
+	mctx, cancel = WithDialStage(ctx, DialStageMuxer)
+	defer cancel()
+	deadline, ok = mctx.Deadline()
+	require.True(t, ok)
+	require.InDelta(t, 10*time.Second, time.Until(deadline), float64(100*time.Millisecond))
+}
@@ -0,0 +1,105 @@
+package network
+
+import (
+	"context"
+	"time"
+)
+
+// DialStage is a stage of establishing an outbound connection.
+type DialStage int
+
+const (
+	// DialStageResolve is the resolution of the peer's addresses (e.g. DNS).
+	DialStageResolve DialStage = iota
+	// DialStageTransport is the dial of the underlying transport connection (e.g. the TCP handshake).
+	DialStageTransport
+	// DialStageSecurity is the negotiation of the security protocol, and the security handshake.
+	DialStageSecurity
+	// DialStageMuxer is the negotiation of the stream multiplexer.
+	DialStageMuxer
+
+	numDialStages
+)
+
+func (s DialStage) String() string {
+	switch s {
+	case DialStageResolve:
+		return "resolve"
+	case DialStageTransport:
+		return "transport"
+	case DialStageSecurity:
+		return "security"
+	case DialStageMuxer:
+		return "muxer"
+	default:
+		return "unknown"
+	}
+}
+
+// DefaultDialBudgetWeights are the default relative shares of the dial budget allotted to each stage.
+var DefaultDialBudgetWeights = [numDialStages]float64{
+	DialStageResolve:   1,
+	DialStageTransport: 4,
+	DialStageSecurity:  3,
+	DialStageMuxer:     2,
+}
+
+// DialBudget is the total time allowed for establishing a connection to a peer, apportioned
+// across the stages of the dial.
+//
+// When a stage starts, it is allotted its share of the remaining budget, relative to the weights of
+// this stage and all following stages. Time not used by a stage is therefore available to the
+// following stages, and the stages never take longer than the total budget.
+// Transports that don't have separate stages (e.g. QUIC) may use all of the remaining budget.
+type DialBudget struct {
+	// Total is the total time allowed for establishing a connection.
+	Total time.Duration
+	// Weights are the relative shares of the budget allotted to each stage, indexed by DialStage.
+	// If all weights are zero, DefaultDialBudgetWeights are used.
+	Weights [numDialStages]float64
+}
+
+type dialBudgetCtxKey struct{}
+
+type dialBudget struct {
+	deadline time.Time
+	weights  [numDialStages]float64
+}
+
+// WithDialBudget returns a new context with the dial budget applied, starting now.
+// The returned context doesn't expire by itself, the dialer is responsible for applying the total
+// budget as a timeout.
+func WithDialBudget(ctx context.Context, b DialBudget) context.Context {
+	weights := b.Weights
+	if weights == [numDialStages]float64{} {
+		weights = DefaultDialBudgetWeights
+	}
+	return context.WithValue(ctx, dialBudgetCtxKey{}, &dialBudget{
+		deadline: time.Now().Add(b.Total),
+		weights:  weights,
+	})
+}
+
+// HasDialBudget returns true if a dial budget was applied to the context.
+func HasDialBudget(ctx context.Context) bool {
+	_, ok := ctx.Value(dialBudgetCtxKey{}).(*dialBudget)
+	return ok
+}
+
+// WithDialStage returns a context that expires when the time allotted to the given stage runs out.
+// If no dial budget was applied to ctx, it returns a context that only expires with ctx.
+func WithDialStage(ctx context.Context, stage DialStage) (context.Context, context.CancelFunc) {
+	b, ok := ctx.Value(dialBudgetCtxKey{}).(*dialBudget)
+	if !ok || stage < 0 || stage >= numDialStages {
+		return context.WithCancel(ctx)
+	}
+	var rest float64
+	for s := stage; s < numDialStages; s++ {
+		rest += b.weights[s]
+	}
+	if rest <= 0 {
+		return context.WithDeadline(ctx, b.deadline)
+	}
+	remaining := time.Until(b.deadline)
+	return context.WithTimeout(ctx, time.Duration(float64(remaining)*b.weights[stage]/rest))
+}
@@ -28,6 +28,10 @@ var ErrTransientConn = errors.New("transient connection to peer")
 // exceed system resource limits.
 var ErrResourceLimitExceeded = temporaryError("resource limit exceeded")
 
+// ErrPeerResourceLimitExceeded is matched by errors caused by exceeding the resource limits of a
+// single peer, as opposed to limits shared by all peers. These errors also match ErrResourceLimitExceeded.
+var ErrPeerResourceLimitExceeded = temporaryError("peer resource limit exceeded")
+
 // ErrResourceScopeClosed is returned when attempting to reserve resources in a closed resource
 // scope.
 var ErrResourceScopeClosed = errors.New("resource scope closed")
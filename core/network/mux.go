@@ -11,6 +11,10 @@ import (
 // ErrReset is returned when reading or writing on a reset stream.
 var ErrReset = errors.New("stream reset")
 
+// ErrMuxerProtocolViolation is returned by MuxedConn.AcceptStream when the connection was closed
+// because the remote peer violated the stream multiplexer protocol, e.g. by sending a malformed frame.
+var ErrMuxerProtocolViolation = errors.New("stream multiplexer protocol violation")
+
 // MuxedStream is a bidirectional io pipe within a connection.
 type MuxedStream interface {
 	io.Reader
@@ -103,6 +103,32 @@ type ConnStats struct {
 	Stats
 	// NumStreams is the number of streams on the connection.
 	NumStreams int
+	// RelayRole is our role on the circuit, if this is a relayed connection.
+	RelayRole RelayRole
+}
+
+// RelayRole is the role of a node in a relayed connection (circuit).
+type RelayRole int
+
+const (
+	// RelayRoleNone is used for connections that aren't relayed.
+	RelayRoleNone RelayRole = iota
+	// RelayRoleRelay means that we relay traffic between two other peers, i.e. we carry transit traffic.
+	// Circuits we relay aren't connections of our own, so this role is used for accounting
+	// (e.g. as the resource manager service of the relayed streams), not in ConnStats.
+	RelayRoleRelay
+	// RelayRoleClient means that we dialed the remote peer through a relay.
+	RelayRoleClient
+	// RelayRoleDestination means that the remote peer dialed us through a relay.
+	RelayRoleDestination
+)
+
+func (r RelayRole) String() string {
+	str := [...]string{"none", "relay", "client", "destination"}
+	if r < 0 || int(r) >= len(str) {
+		return unrecognized
+	}
+	return str[r]
 }
 
 // Stats stores metadata pertaining to a given Stream / Conn.
@@ -148,10 +174,46 @@ type Network interface {
 	// use the known local interfaces.
 	InterfaceListenAddresses() ([]ma.Multiaddr, error)
 
+	// ListenStatus returns the status of the listeners of this network.
+	ListenStatus() []ListenerStatus
+
 	// ResourceManager returns the ResourceManager associated with this network
 	ResourceManager() ResourceManager
 }
 
+// ListenerState is the state of a listener.
+type ListenerState int
+
+const (
+	// ListenerActive means that the listener is accepting connections.
+	ListenerActive ListenerState = iota
+	// ListenerFailed means that the listener failed unexpectedly, and is waiting to be restarted.
+	ListenerFailed
+)
+
+func (s ListenerState) String() string {
+	str := [...]string{"Active", "Failed"}
+	if s < 0 || int(s) >= len(str) {
+		return unrecognized
+	}
+	return str[s]
+}
+
+// ListenerStatus is the status of a listener.
+type ListenerStatus struct {
+	// Addr is the address passed to Listen.
+	Addr ma.Multiaddr
+	// ListenAddr is the address the listener is listening on.
+	// It differs from Addr if Addr uses port 0. It is nil if the listener failed.
+	ListenAddr ma.Multiaddr
+	State      ListenerState
+	// Err is the most recent error that caused the listener to fail, or that prevented it
+	// from being restarted. It is nil if the listener never failed.
+	Err error
+	// Restarts is the number of times the listener was restarted after a failure.
+	Restarts int
+}
+
 // Dialer represents a service that can dial out to peers
 // (this is usually just a Network, but other services may not need the whole
 // stack, and thus it becomes easier to mock)
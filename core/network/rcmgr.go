@@ -98,6 +98,20 @@ type ResourceManager interface {
 	Close() error
 }
 
+// FDManager is an optional interface implemented by resource managers that account for file
+// descriptors which are not owned by a single connection, e.g. a UDP socket shared by all QUIC
+// connections. File descriptors owned by a single connection are accounted for by OpenConnection.
+//
+// Transports type-assert the ResourceManager to FDManager, and skip the accounting if the
+// assertion fails.
+type FDManager interface {
+	// ReserveFD reserves a file descriptor used by the given transport in the system scope.
+	// It fails if the file descriptor limit would be exceeded.
+	ReserveFD(transport string) error
+	// ReleaseFD releases a file descriptor reserved using ReserveFD.
+	ReleaseFD(transport string)
+}
+
 // ResourceScopeViewer is a mixin interface providing view methods for accessing top level
 // scopes.
 type ResourceScopeViewer interface {
@@ -0,0 +1,88 @@
+package peerstore
+
+import (
+	"context"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ChangeType is the type of a change to the entries of a peerstore book.
+type ChangeType int
+
+const (
+	// ChangeAdded is reported when entries are added.
+	ChangeAdded ChangeType = iota
+	// ChangeRemoved is reported when entries are removed explicitly.
+	ChangeRemoved
+	// ChangeExpired is reported when entries are removed because their TTL expired.
+	ChangeExpired
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeExpired:
+		return "expired"
+	default:
+		return "unknown"
+	}
+}
+
+// AddrChange is a change to the addresses of a peer.
+type AddrChange struct {
+	Peer  peer.ID
+	Type  ChangeType
+	Addrs []ma.Multiaddr
+}
+
+// ProtoChange is a change to the protocols of a peer.
+type ProtoChange struct {
+	Peer      peer.ID
+	Type      ChangeType
+	Protocols []protocol.ID
+}
+
+// KeyChange is a change to the keys of a peer.
+// Keys never expire, so the type is either ChangeAdded or ChangeRemoved.
+type KeyChange struct {
+	Peer peer.ID
+	Type ChangeType
+	// Private is set if the private key of the peer was added.
+	// The key itself is not included. Use KeyBook.PrivKey to retrieve it.
+	Private bool
+}
+
+// The following interfaces are implemented by books that can notify about changes to their
+// entries, so that higher layers can react to changes without polling. Callers should
+// type-assert on them, for example:
+//
+//	if n, ok := aPeerstore.(AddrBookNotifier); ok {
+//	    changes := n.SubscribeAddrChanges(ctx)
+//	}
+//
+// The returned channel is closed once the context is canceled. Changes are delivered in
+// order, but are dropped if the subscriber doesn't keep up: subscribers that need a
+// consistent view should re-read the book after receiving a change.
+
+// AddrBookNotifier is implemented by address books that report changes to the stored addresses.
+// Addresses are reported as expired when they are garbage collected, which may happen some
+// time after their TTL expired.
+type AddrBookNotifier interface {
+	SubscribeAddrChanges(ctx context.Context) <-chan AddrChange
+}
+
+// ProtoBookNotifier is implemented by protocol books that report changes to the stored protocols.
+type ProtoBookNotifier interface {
+	SubscribeProtoChanges(ctx context.Context) <-chan ProtoChange
+}
+
+// KeyBookNotifier is implemented by key books that report changes to the stored keys.
+type KeyBookNotifier interface {
+	SubscribeKeyChanges(ctx context.Context) <-chan KeyChange
+}
@@ -0,0 +1,36 @@
+package peerstore
+
+import "github.com/libp2p/go-libp2p/core/peer"
+
+// LabelBook is implemented by peerstores that can label peers, and look up peers by their labels.
+// A label is a key-value pair, e.g. role=relay. A peer has at most one value for every key.
+// This allows applications and connection manager policies to group peers without maintaining
+// separate indexes. Callers should type-assert on it, for example:
+//
+//	if lb, ok := aPeerstore.(LabelBook); ok {
+//	    relays := lb.PeersWithLabel("role", "relay")
+//	}
+//
+// Labels are removed when the peer is removed using RemovePeer.
+type LabelBook interface {
+	// Label sets the label key of peer p to value, replacing the previous value.
+	Label(p peer.ID, key, value string) error
+
+	// Unlabel removes the label key from peer p.
+	Unlabel(p peer.ID, key string)
+
+	// GetLabel returns the value of the label key of peer p, and whether the label is set.
+	GetLabel(p peer.ID, key string) (value string, ok bool)
+
+	// Labels returns all labels of peer p.
+	Labels(p peer.ID) map[string]string
+
+	// PeersWithLabel returns all peers whose label key is set to value.
+	PeersWithLabel(key, value string) peer.IDSlice
+
+	// PeersWithLabelKey returns all peers that have the label key set, no matter its value.
+	PeersWithLabelKey(key string) peer.IDSlice
+
+	// RemovePeer removes all labels of a peer.
+	RemovePeer(peer.ID)
+}
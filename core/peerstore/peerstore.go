@@ -180,6 +180,21 @@ type CertifiedAddrBook interface {
 	GetPeerRecord(p peer.ID) *record.Envelope
 }
 
+// RecordRenewalNotifier is implemented by certified address books that notify their users
+// before a signed peer record expires, so that a fresh record can be requested from the peer
+// before its certified addresses are lost.
+//
+// A signed peer record expires after the TTL it was consumed with. Consuming a record again
+// (or a newer one) resets its expiration time. Updating the TTL of the record's addresses using
+// AddrBook.UpdateAddrs also updates the expiration time of the record.
+type RecordRenewalNotifier interface {
+	// NotifyRecordRenewal registers f to be called for a peer when its signed peer record will
+	// expire within the given duration. f is called at most once per expiration time, from a
+	// background go-routine, and must not block.
+	// Calling the returned function unregisters f.
+	NotifyRecordRenewal(before time.Duration, f func(peer.ID)) (cancel func())
+}
+
 // GetCertifiedAddrBook is a helper to "upcast" an AddrBook to a
 // CertifiedAddrBook by using type assertion. If the given AddrBook
 // is also a CertifiedAddrBook, it will be returned, and the ok return
@@ -0,0 +1,33 @@
+package sec
+
+import (
+	"context"
+
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// Negotiation describes how the security protocol of a connection was negotiated.
+//
+// The negotiation happens before the connection is secured, so a man-in-the-middle
+// can tamper with it. Security transports that support it can include the negotiation
+// in their (authenticated) handshake, and detect such a downgrade.
+type Negotiation struct {
+	// Protocol is the negotiated security protocol.
+	Protocol protocol.ID
+	// Supported are the security protocols supported by the local node, in order of preference.
+	Supported []protocol.ID
+}
+
+type negotiationCtxKey struct{}
+
+// WithNegotiation constructs a new context carrying the result of the security protocol negotiation.
+// It is passed to SecureInbound and SecureOutbound.
+func WithNegotiation(ctx context.Context, n Negotiation) context.Context {
+	return context.WithValue(ctx, negotiationCtxKey{}, n)
+}
+
+// GetNegotiation returns the security protocol negotiation set in the context, if any.
+func GetNegotiation(ctx context.Context) (n Negotiation, ok bool) {
+	n, ok = ctx.Value(negotiationCtxKey{}).(Negotiation)
+	return n, ok
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/sec"
+	sectest "github.com/libp2p/go-libp2p/p2p/security/testsuite"
 
 	"github.com/stretchr/testify/require"
 )
@@ -127,3 +128,11 @@ func testReadWrite(t *testing.T, clientConn, serverConn sec.SecureConn) {
 	require.NoError(t, err)
 	require.Equal(t, before, after, "message mismatch")
 }
+
+func TestConformance(t *testing.T) {
+	// The plaintext transport doesn't protect the integrity of the data.
+	sectest.Run(t, func(t *testing.T) (sec.SecureTransport, peer.ID) {
+		tr := newTestTransport(t, crypto.Ed25519, 256)
+		return tr, tr.LocalPeer()
+	}, sectest.Subtests)
+}
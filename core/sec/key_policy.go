@@ -0,0 +1,58 @@
+package sec
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/crypto/pb"
+)
+
+// ErrKeyNotAllowed is returned when a remote peer's identity key is rejected by a KeyPolicy.
+var ErrKeyNotAllowed = errors.New("identity key not allowed by key policy")
+
+// KeyPolicy restricts the identity keys accepted from remote peers during the handshake,
+// for deployments that need to enforce a crypto policy.
+// The zero value accepts all keys.
+type KeyPolicy struct {
+	// AllowedTypes are the allowed key types, e.g. crypto.Ed25519.
+	// If empty, all key types are allowed.
+	AllowedTypes []pb.KeyType
+	// MinRSABits is the minimum size of RSA keys, in bits.
+	// RSA keys smaller than crypto.MinRsaKeyBits are always rejected.
+	MinRSABits int
+}
+
+// Check returns an error wrapping ErrKeyNotAllowed if k is not allowed by the policy.
+func (p *KeyPolicy) Check(k crypto.PubKey) error {
+	if p == nil {
+		return nil
+	}
+	if len(p.AllowedTypes) > 0 {
+		var allowed bool
+		for _, t := range p.AllowedTypes {
+			if k.Type() == t {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%w: key type %s", ErrKeyNotAllowed, k.Type())
+		}
+	}
+	if k.Type() == pb.KeyType_RSA && p.MinRSABits > 0 {
+		std, err := crypto.PubKeyToStdKey(k)
+		if err != nil {
+			return err
+		}
+		rsaKey, ok := std.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: unexpected RSA key type %T", ErrKeyNotAllowed, std)
+		}
+		if bits := rsaKey.N.BitLen(); bits < p.MinRSABits {
+			return fmt.Errorf("%w: RSA key has %d bits, need at least %d", ErrKeyNotAllowed, bits, p.MinRSABits)
+		}
+	}
+	return nil
+}
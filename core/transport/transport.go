@@ -6,6 +6,7 @@ import (
 	"context"
 	"errors"
 	"net"
+	"strings"
 
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -84,6 +85,51 @@ type Resolver interface {
 	Resolve(ctx context.Context, maddr ma.Multiaddr) ([]ma.Multiaddr, error)
 }
 
+// Capabilities are optional features of a transport, beyond reliable streams.
+type Capabilities uint32
+
+const (
+	// CapabilityDatagram means that connections can send unreliable datagrams, see network.MessageConn.
+	CapabilityDatagram Capabilities = 1 << iota
+	// CapabilityEarlyData means that data can be sent before the handshake completes (0-RTT).
+	CapabilityEarlyData
+)
+
+// Has returns true if all capabilities in c are supported.
+func (caps Capabilities) Has(c Capabilities) bool {
+	return caps&c == c
+}
+
+func (caps Capabilities) String() string {
+	var s []string
+	if caps.Has(CapabilityDatagram) {
+		s = append(s, "datagram")
+	}
+	if caps.Has(CapabilityEarlyData) {
+		s = append(s, "early-data")
+	}
+	return "[" + strings.Join(s, " ") + "]"
+}
+
+// CapabilityReporter can be optionally implemented by transports that support any of the
+// optional Capabilities.
+type CapabilityReporter interface {
+	// Capabilities returns the capabilities of connections to and from the given listen address.
+	Capabilities(laddr ma.Multiaddr) Capabilities
+}
+
+// PeerHintConn can be implemented by inbound connections whose transport learns the ID of the
+// remote peer before the security handshake, for example from the STOP message of a relayed
+// connection. The upgrader passes the hint to the connection gater, to reject unwanted peers before
+// spending resources on the handshake.
+//
+// The hint is not authenticated: it is only used to reject connections, and the security handshake
+// fails unless the remote peer proves that it is the hinted peer.
+type PeerHintConn interface {
+	// RemotePeerHint returns the ID of the remote peer, or an empty peer ID if it is not known.
+	RemotePeerHint() peer.ID
+}
+
 // Listener is an interface closely resembling the net.Listener interface. The
 // only real difference is that Accept() returns Conn's of the type in this
 // package, and also exposes a Multiaddr method as opposed to a regular Addr
@@ -122,5 +168,10 @@ type Upgrader interface {
 	// UpgradeListener upgrades the passed multiaddr-net listener into a full libp2p-transport listener.
 	UpgradeListener(Transport, manet.Listener) Listener
 	// Upgrade upgrades the multiaddr/net connection into a full libp2p-transport connection.
+	//
+	// For outbound connections, p is the peer we dialed. For inbound connections, p is optional:
+	// if the transport learned the remote peer's ID before the security handshake (see PeerHintConn),
+	// the connection gater is applied before the handshake, and the handshake fails unless the
+	// remote peer is p.
 	Upgrade(ctx context.Context, t Transport, maconn manet.Conn, dir network.Direction, p peer.ID, scope network.ConnManagementScope) (CapableConn, error)
 }
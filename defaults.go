@@ -205,7 +205,11 @@ var Defaults Option = func(cfg *Config) error {
 // FallbackDefaults applies default options to the libp2p node if and only if no
 // other relevant options have been applied. will be appended to the options
 // passed into New.
+// If a profile was selected, its options take precedence over the default options.
 var FallbackDefaults Option = func(cfg *Config) error {
+	if err := applyProfile(cfg); err != nil {
+		return err
+	}
 	for _, def := range defaults {
 		if !def.fallback(cfg) {
 			continue
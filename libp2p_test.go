@@ -3,24 +3,36 @@ package libp2p
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/libp2p/go-libp2p/core/connmgr"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/host/stats"
 	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2"
 	"github.com/libp2p/go-libp2p/p2p/security/noise"
 	tls "github.com/libp2p/go-libp2p/p2p/security/tls"
 	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
 	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
 	webtransport "github.com/libp2p/go-libp2p/p2p/transport/webtransport"
 
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
 	ma "github.com/multiformats/go-multiaddr"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestNewHost(t *testing.T) {
@@ -97,6 +109,14 @@ func TestAutoNATService(t *testing.T) {
 	h.Close()
 }
 
+func TestAutoNATv2(t *testing.T) {
+	h, err := New(EnableAutoNATv2(), Transport(tcp.NewTCPTransport), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer h.Close()
+	require.Contains(t, h.Mux().Protocols(), protocol.ID(autonatv2.DialProtocol))
+	require.Contains(t, h.Mux().Protocols(), protocol.ID(autonatv2.DialBackProtocol))
+}
+
 func TestDefaultListenAddrs(t *testing.T) {
 	reTCP := regexp.MustCompile("/(ip)[4|6]/((0.0.0.0)|(::))/tcp/")
 	reQUIC := regexp.MustCompile("/(ip)[4|6]/((0.0.0.0)|(::))/udp/([0-9]*)/quic-v1")
@@ -356,3 +376,192 @@ func TestTransportCustomAddressWebTransportDoesNotStall(t *testing.T) {
 	// We did not add the certhash to the multiaddr
 	require.Equal(t, addrs[0], customAddr)
 }
+
+func TestDeferStart(t *testing.T) {
+	newHost := func(opts ...Option) host.Host {
+		h, err := New(append([]Option{
+			Transport(tcp.NewTCPTransport, tcp.DisableReuseport()),
+			ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+			DisableRelay(),
+		}, opts...)...)
+		require.NoError(t, err)
+		t.Cleanup(func() { h.Close() })
+		return h
+	}
+	h := newHost(DeferStart())
+	other := newHost()
+	lh, ok := h.(host.Lifecycle)
+	require.True(t, ok)
+	_, ok = other.(host.Lifecycle)
+	require.False(t, ok)
+
+	ctx := context.Background()
+	require.Empty(t, h.Network().ListenAddresses())
+	// dials are rejected before the host is started
+	require.Error(t, h.Connect(ctx, peer.AddrInfo{ID: other.ID(), Addrs: other.Addrs()}))
+	require.Error(t, lh.Stop(ctx))
+
+	require.NoError(t, lh.Start(ctx))
+	require.Error(t, lh.Start(ctx))
+	require.NotEmpty(t, h.Network().ListenAddresses())
+	require.NoError(t, other.Connect(ctx, peer.AddrInfo{ID: h.ID(), Addrs: h.Addrs()}))
+
+	require.NoError(t, lh.Stop(ctx))
+	require.Empty(t, h.Network().ListenAddresses())
+	require.Empty(t, h.Network().Conns())
+	require.Error(t, h.Connect(ctx, peer.AddrInfo{ID: other.ID(), Addrs: other.Addrs()}))
+
+	require.Error(t, lh.Restart(ctx))
+
+	require.NoError(t, lh.Start(ctx))
+	require.NoError(t, lh.Restart(ctx))
+	require.NotEmpty(t, h.Network().ListenAddresses())
+	require.NoError(t, h.Connect(ctx, peer.AddrInfo{ID: other.ID(), Addrs: other.Addrs()}))
+}
+
+func TestDeferStartOptionalInterfaces(t *testing.T) {
+	newHost := func(opts ...Option) host.Host {
+		h, err := New(append([]Option{NoListenAddrs, DisableRelay()}, opts...)...)
+		require.NoError(t, err)
+		t.Cleanup(func() { h.Close() })
+		return h
+	}
+	h := newHost(DeferStart())
+	other := newHost()
+	// the host returned with DeferStart implements all optional interfaces of the underlying host
+	for _, iface := range []reflect.Type{
+		reflect.TypeOf((*host.ProtocolStatsTracker)(nil)).Elem(),
+		reflect.TypeOf((*host.MessageSizeLimiter)(nil)).Elem(),
+		reflect.TypeOf((*host.BatchConnector)(nil)).Elem(),
+	} {
+		require.True(t, reflect.TypeOf(other).Implements(iface), "underlying host doesn't implement %s", iface)
+		require.True(t, reflect.TypeOf(h).Implements(iface), "host doesn't implement %s", iface)
+	}
+}
+
+func TestStatsRecorder(t *testing.T) {
+	r, err := stats.NewRecorder(dssync.MutexWrap(ds.NewMapDatastore()))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = New(StatsRecorder(r), StatsRecorder(r))
+	require.Error(t, err)
+
+	// statistics are recorded even if metrics are disabled
+	h, err := New(NoListenAddrs, Transport(tcp.NewTCPTransport), DisableMetrics(), StatsRecorder(r))
+	require.NoError(t, err)
+	defer h.Close()
+	other, err := New(ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), Transport(tcp.NewTCPTransport))
+	require.NoError(t, err)
+	defer other.Close()
+
+	require.NoError(t, h.Connect(context.Background(), peer.AddrInfo{ID: other.ID(), Addrs: other.Addrs()}))
+	require.Eventually(t, func() bool { return r.Stats().DialsSucceeded == 1 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, uint64(1), r.Stats().Transports["tcp"].Outbound)
+}
+
+func TestTracerProvider(t *testing.T) {
+	spanNames := func(sr *tracetest.SpanRecorder) map[string]sdktrace.ReadOnlySpan {
+		m := make(map[string]sdktrace.ReadOnlySpan)
+		for _, s := range sr.Ended() {
+			m[s.Name()] = s
+		}
+		return m
+	}
+
+	newHost := func(sr *tracetest.SpanRecorder, listen Option) host.Host {
+		h, err := New(
+			listen,
+			Transport(tcp.NewTCPTransport),
+			Security(noise.ID, noise.New),
+			DisableRelay(),
+			WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))),
+		)
+		require.NoError(t, err)
+		return h
+	}
+	serverSpans := tracetest.NewSpanRecorder()
+	server := newHost(serverSpans, ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	defer server.Close()
+	clientSpans := tracetest.NewSpanRecorder()
+	client := newHost(clientSpans, NoListenAddrs)
+	defer client.Close()
+
+	server.SetStreamHandler("/test", func(s network.Stream) { s.Close() })
+	client.Peerstore().AddAddrs(server.ID(), server.Addrs(), peerstore.PermanentAddrTTL)
+	s, err := client.NewStream(context.Background(), server.ID(), "/test")
+	require.NoError(t, err)
+	s.Close()
+
+	spans := spanNames(clientSpans)
+	for _, name := range []string{
+		"host.NewStream", "swarm.DialPeer", "swarm.dialAddr", "upgrader.Upgrade", "upgrader.setupSecurity",
+		"noise.handshake", "noise.stage0", "noise.stage1", "noise.stage2", "upgrader.setupMuxer",
+	} {
+		require.Contains(t, spans, name)
+	}
+	// all spans of the dial are part of the trace of the stream
+	traceID := spans["host.NewStream"].SpanContext().TraceID()
+	for _, name := range []string{"swarm.dialAddr", "noise.stage2", "upgrader.setupMuxer"} {
+		require.Equal(t, traceID, spans[name].SpanContext().TraceID(), name)
+	}
+	require.Equal(t, spans["upgrader.setupSecurity"].SpanContext().SpanID(), spans["noise.handshake"].Parent().SpanID())
+	require.Equal(t, "/test", findAttribute(t, spans["host.NewStream"], "protocol"))
+	require.Equal(t, "/noise", findAttribute(t, spans["upgrader.setupSecurity"], "security"))
+
+	require.Eventually(t, func() bool {
+		spans := spanNames(serverSpans)
+		_, ok := spans["host.negotiateProtocol"]
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+	spans = spanNames(serverSpans)
+	for _, name := range []string{"upgrader.Upgrade", "noise.handshake", "noise.stage2", "upgrader.setupMuxer"} {
+		require.Contains(t, spans, name)
+	}
+}
+
+func TestNoiseMetrics(t *testing.T) {
+	newHost := func(reg *prometheus.Registry, listen Option) host.Host {
+		// uses the default security transports
+		h, err := New(listen, Transport(tcp.NewTCPTransport), PrometheusRegisterer(reg))
+		require.NoError(t, err)
+		return h
+	}
+	serverReg := prometheus.NewRegistry()
+	server := newHost(serverReg, ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	defer server.Close()
+	clientReg := prometheus.NewRegistry()
+	client := newHost(clientReg, NoListenAddrs)
+	defer client.Close()
+
+	require.NoError(t, client.Connect(context.Background(), peer.AddrInfo{ID: server.ID(), Addrs: server.Addrs()}))
+
+	handshakes := func(reg *prometheus.Registry) uint64 {
+		mfs, err := reg.Gather()
+		require.NoError(t, err)
+		for _, mf := range mfs {
+			if mf.GetName() != "libp2p_noise_handshake_duration_seconds" {
+				continue
+			}
+			var n uint64
+			for _, m := range mf.GetMetric() {
+				n += m.GetHistogram().GetSampleCount()
+			}
+			return n
+		}
+		return 0
+	}
+	require.NotZero(t, handshakes(clientReg))
+	require.Eventually(t, func() bool { return handshakes(serverReg) > 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func findAttribute(t *testing.T, s sdktrace.ReadOnlySpan, key string) string {
+	t.Helper()
+	for _, a := range s.Attributes() {
+		if string(a.Key) == key {
+			return a.Value.AsString()
+		}
+	}
+	t.Fatalf("span %s doesn't have attribute %s", s.Name(), key)
+	return ""
+}
@@ -4,6 +4,8 @@ import (
 	"github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/libp2p/go-libp2p/p2p/host/autonat"
 	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2"
+	relayv2client "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
 	circuit "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
 	relayv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
 	"github.com/libp2p/go-libp2p/p2p/protocol/holepunch"
@@ -63,6 +65,29 @@ func SetDefaultServiceLimits(config *rcmgr.ScalingLimitConfig) {
 		rcmgr.BaseLimitIncrease{},
 	)
 
+	// autonat v2
+	addServiceAndProtocolLimit(config,
+		autonatv2.ServiceName, autonatv2.DialProtocol,
+		rcmgr.BaseLimit{StreamsInbound: 64, StreamsOutbound: 64, Streams: 64, Memory: 4 << 20},
+		rcmgr.BaseLimitIncrease{StreamsInbound: 4, StreamsOutbound: 4, Streams: 4, Memory: 2 << 20},
+	)
+	addServicePeerAndProtocolPeerLimit(
+		config,
+		autonatv2.ServiceName, autonatv2.DialProtocol,
+		rcmgr.BaseLimit{StreamsInbound: 2, StreamsOutbound: 2, Streams: 2, Memory: 1 << 20},
+		rcmgr.BaseLimitIncrease{},
+	)
+	config.AddProtocolLimit(
+		autonatv2.DialBackProtocol,
+		rcmgr.BaseLimit{StreamsInbound: 64, StreamsOutbound: 64, Streams: 64, Memory: 4 << 20},
+		rcmgr.BaseLimitIncrease{StreamsInbound: 4, StreamsOutbound: 4, Streams: 4, Memory: 2 << 20},
+	)
+	config.AddProtocolPeerLimit(
+		autonatv2.DialBackProtocol,
+		rcmgr.BaseLimit{StreamsInbound: 2, StreamsOutbound: 2, Streams: 2, Memory: 1 << 20},
+		rcmgr.BaseLimitIncrease{},
+	)
+
 	// holepunch
 	addServiceAndProtocolLimit(config,
 		holepunch.ServiceName, holepunch.Protocol,
@@ -87,6 +112,20 @@ func SetDefaultServiceLimits(config *rcmgr.ScalingLimitConfig) {
 		rcmgr.BaseLimitIncrease{},
 	)
 
+	// relay/v2 client, for our own relayed connections
+	for _, service := range [...]string{relayv2client.ClientServiceName, relayv2client.DestinationServiceName} {
+		config.AddServiceLimit(
+			service,
+			rcmgr.BaseLimit{StreamsInbound: 128, StreamsOutbound: 128, Streams: 128, Memory: 32 << 20},
+			rcmgr.BaseLimitIncrease{StreamsInbound: 128, StreamsOutbound: 128, Streams: 128, Memory: 32 << 20},
+		)
+		config.AddServicePeerLimit(
+			service,
+			rcmgr.BaseLimit{StreamsInbound: 64, StreamsOutbound: 64, Streams: 64, Memory: 16 << 20},
+			rcmgr.BaseLimitIncrease{},
+		)
+	}
+
 	// circuit protocols, both client and service
 	for _, proto := range [...]protocol.ID{circuit.ProtoIDv2Hop, circuit.ProtoIDv2Stop} {
 		config.AddProtocolLimit(
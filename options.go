@@ -8,6 +8,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"net/netip"
 	"reflect"
 	"time"
 
@@ -23,8 +24,11 @@ import (
 	"github.com/libp2p/go-libp2p/core/transport"
 	"github.com/libp2p/go-libp2p/p2p/host/autorelay"
 	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	"github.com/libp2p/go-libp2p/p2p/host/health"
+	"github.com/libp2p/go-libp2p/p2p/host/stats"
 	"github.com/libp2p/go-libp2p/p2p/net/swarm"
 	tptu "github.com/libp2p/go-libp2p/p2p/net/upgrader"
+	circuitv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
 	relayv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
 	"github.com/libp2p/go-libp2p/p2p/protocol/holepunch"
 	"github.com/libp2p/go-libp2p/p2p/transport/quicreuse"
@@ -32,6 +36,7 @@ import (
 
 	ma "github.com/multiformats/go-multiaddr"
 	madns "github.com/multiformats/go-multiaddr-dns"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/fx"
 )
 
@@ -208,6 +213,10 @@ func Peerstore(ps peerstore.Peerstore) Option {
 }
 
 // PrivateNetwork configures libp2p to use the given private network protector.
+//
+// By default, only the TCP and WebSocket transports are enabled in a private network.
+// The QUIC and WebTransport transports can be enabled explicitly, in which case
+// their UDP packets are protected using the PSK.
 func PrivateNetwork(psk pnet.PSK) Option {
 	return func(cfg *Config) error {
 		if cfg.PSK != nil {
@@ -272,11 +281,13 @@ func AddrsFactory(factory config.AddrsFactory) Option {
 // This option only configures libp2p to accept inbound connections from relays
 // and make outbound connections_through_ relays when requested by the remote peer.
 // This option supports both circuit v1 and v2 connections.
+// The options configure the relay client, e.g. to pre-connect to relays used by many of our peers.
 // (default: enabled)
-func EnableRelay() Option {
+func EnableRelay(opts ...circuitv2.Option) Option {
 	return func(cfg *Config) error {
 		cfg.RelayCustom = true
 		cfg.Relay = true
+		cfg.RelayOpts = opts
 		return nil
 	}
 }
@@ -294,12 +305,51 @@ func DisableRelay() Option {
 // if we detect that we're publicly reachable.
 func EnableRelayService(opts ...relayv2.Option) Option {
 	return func(cfg *Config) error {
+		cfg.RelayServiceCustom = true
 		cfg.EnableRelayService = true
 		cfg.RelayServiceOpts = opts
 		return nil
 	}
 }
 
+// DisableRelayService configures libp2p to not run a circuit v2 relay.
+// This is the default, unless a profile enables the relay service.
+func DisableRelayService() Option {
+	return func(cfg *Config) error {
+		cfg.RelayServiceCustom = true
+		cfg.EnableRelayService = false
+		cfg.RelayServiceOpts = nil
+		return nil
+	}
+}
+
+// EnableHealthScore configures libp2p to compute an aggregate health score of the node,
+// exported as the libp2p_health_score Prometheus metric.
+// The health score combines reachability, relay dependence, dial success rate,
+// resource pressure and connection churn into a single value between 0 and 1.
+//
+// This option requires metrics to be enabled.
+func EnableHealthScore(opts ...health.Option) Option {
+	return func(cfg *Config) error {
+		cfg.EnableHealthScore = true
+		cfg.HealthScoreOpts = opts
+		return nil
+	}
+}
+
+// StatsRecorder configures libp2p to record dial and connection statistics using r.
+// The statistics are recorded even if metrics are disabled.
+// The caller is responsible for closing r after the host was closed.
+func StatsRecorder(r *stats.Recorder) Option {
+	return func(cfg *Config) error {
+		if cfg.StatsRecorder != nil {
+			return errors.New("stats recorder already set")
+		}
+		cfg.StatsRecorder = r
+		return nil
+	}
+}
+
 // EnableAutoRelay configures libp2p to enable the AutoRelay subsystem.
 //
 // Dependencies:
@@ -370,11 +420,22 @@ func ForceReachabilityPrivate() Option {
 // to peers, and then tell them if it was successful in making such connections.
 func EnableNATService() Option {
 	return func(cfg *Config) error {
+		cfg.NATServiceCustom = true
 		cfg.AutoNATConfig.EnableService = true
 		return nil
 	}
 }
 
+// DisableNATService configures libp2p to not provide the AutoNAT service to peers.
+// This is the default, unless a profile enables the AutoNAT service.
+func DisableNATService() Option {
+	return func(cfg *Config) error {
+		cfg.NATServiceCustom = true
+		cfg.AutoNATConfig.EnableService = false
+		return nil
+	}
+}
+
 // AutoNATServiceRateLimit changes the default rate limiting configured in helping
 // other peers determine their reachability status. When set, the host will limit
 // the number of requests it responds to in each 60 second period to the set
@@ -388,6 +449,17 @@ func AutoNATServiceRateLimit(global, perPeer int, interval time.Duration) Option
 	}
 }
 
+// EnableAutoNATv2 enables AutoNAT v2, which verifies the reachability of every address of the
+// host individually. The host stops announcing (e.g. in identify) the addresses that are
+// determined to be unreachable. It also runs an AutoNAT v2 server, helping other peers
+// verify the reachability of their addresses.
+func EnableAutoNATv2() Option {
+	return func(cfg *Config) error {
+		cfg.EnableAutoNATv2 = true
+		return nil
+	}
+}
+
 // ConnectionGater configures libp2p to use the given ConnectionGater
 // to actively reject inbound/outbound connections based on the lifecycle stage
 // of the connection.
@@ -422,8 +494,25 @@ func NATPortMap() Option {
 	return NATManager(bhost.NewNATManager)
 }
 
+// NATPortForward configures libp2p to use port forwardings that were manually configured
+// on the NAT device (e.g. "my router forwards TCP port 4001"), instead of probing the network
+// for NAT devices using UPnP or NAT-PMP.
+// If externalIP is the zero value, the forwarded ports are combined with the IP addresses
+// observed by our peers.
+func NATPortForward(externalIP netip.Addr, forwards ...bhost.StaticPortForward) Option {
+	return func(cfg *Config) error {
+		nm, err := bhost.NewStaticNATManager(externalIP, forwards...)
+		if err != nil {
+			return err
+		}
+		return NATManager(nm)(cfg)
+	}
+}
+
 // NATManager will configure libp2p to use the requested NATManager. This
 // function should be passed a NATManager *constructor* that takes a libp2p Network.
+// Custom implementations of the bhost.NATManager interface can be used to replace
+// the default UPnP / NAT-PMP based port mapping.
 func NATManager(nm config.NATManagerC) Option {
 	return func(cfg *Config) error {
 		if cfg.NATManager != nil {
@@ -434,6 +523,21 @@ func NATManager(nm config.NATManagerC) Option {
 	}
 }
 
+// OptimisticNegotiation configures libp2p to optimistically select the protocol on outbound
+// streams opened for a single protocol, sending the protocol proposal together with the first
+// application data. This saves a round trip on every new stream.
+//
+// If the peer doesn't support the protocol, the error surfaces when reading from the stream
+// (instead of when opening it), and subsequent streams for this protocol to this peer negotiate
+// the protocol first, until the peer accepts it.
+// Streams to peers known to support the protocol are always negotiated optimistically.
+func OptimisticNegotiation() Option {
+	return func(cfg *Config) error {
+		cfg.EnableOptimisticNegotiation = true
+		return nil
+	}
+}
+
 // Ping will configure libp2p to support the ping service; enable by default.
 func Ping(enable bool) Option {
 	return func(cfg *Config) error {
@@ -494,6 +598,19 @@ func UserAgent(userAgent string) Option {
 	}
 }
 
+// IdentifyRefreshInterval configures libp2p to run identify again on connections after the given
+// interval. This keeps the protocols and addresses of peers up to date on connections that live
+// for a long time, even if the peer doesn't support Identify Push.
+func IdentifyRefreshInterval(d time.Duration) Option {
+	return func(cfg *Config) error {
+		if d <= 0 {
+			return errors.New("identify refresh interval must be positive")
+		}
+		cfg.IdentifyRefreshInterval = d
+		return nil
+	}
+}
+
 // MultiaddrResolver sets the libp2p dns resolver
 func MultiaddrResolver(rslv *madns.Resolver) Option {
 	return func(cfg *Config) error {
@@ -535,12 +652,78 @@ func MultiaddrResolver(rslv *madns.Resolver) Option {
 // for `AutoRelay` to connect to so that it does not need to discover Relay servers via Routing.
 func EnableHolePunching(opts ...holepunch.Option) Option {
 	return func(cfg *Config) error {
+		cfg.HolePunchingCustom = true
 		cfg.EnableHolePunching = true
 		cfg.HolePunchingOptions = opts
 		return nil
 	}
 }
 
+// DisableHolePunching configures libp2p to not attempt hole punching.
+// This is the default, unless a profile enables hole punching.
+func DisableHolePunching() Option {
+	return func(cfg *Config) error {
+		cfg.HolePunchingCustom = true
+		cfg.EnableHolePunching = false
+		cfg.HolePunchingOptions = nil
+		return nil
+	}
+}
+
+// EnableNATFingerprinting configures libp2p to collect anonymized observations of the behavior
+// of the NAT device, such as mapping consistency and port prediction success.
+// The observations never leave the node. They're exposed via the identify service and metrics.
+// The hole punching service doesn't attempt to hole punch over transport protocols for which the
+// NAT was observed to use endpoint-dependent mapping.
+func EnableNATFingerprinting() Option {
+	return func(cfg *Config) error {
+		cfg.EnableNATFingerprinting = true
+		return nil
+	}
+}
+
+// EnableIP6LinkLocal configures libp2p to use IPv6 link-local addresses (fe80::/10).
+// When listening on an unspecified IPv6 address, the link-local addresses of our interfaces are
+// advertised (without a zone ID), and link-local addresses of peers are dialed on every interface
+// that has a link-local address, unless they're scoped to one of our interfaces using /ip6zone.
+//
+// This is useful for LAN-only deployments, e.g. of embedded devices or mesh networks.
+func EnableIP6LinkLocal() Option {
+	return func(cfg *Config) error {
+		cfg.EnableIP6LinkLocal = true
+		return nil
+	}
+}
+
+// PrunePeerstore configures libp2p to prune peers that we're not connected to from the peerstore.
+// All data of connected peers and of peers protected by the connection manager is retained.
+// Disconnected peers keep their full records for a short grace period, after which only their
+// addresses are kept for ttl. Peers we never connected to, e.g. peers learned during a DHT query,
+// are removed ttl after they were added to the peerstore.
+//
+// Without pruning, addresses are only removed once their TTL expires, which can take hours.
+func PrunePeerstore(ttl time.Duration) Option {
+	return func(cfg *Config) error {
+		if ttl <= 0 {
+			return errors.New("peerstore pruning TTL must be positive")
+		}
+		cfg.PeerstoreUnconnectedTTL = ttl
+		return nil
+	}
+}
+
+// DeferStart configures libp2p to construct the host without starting it.
+// The host doesn't listen, and doesn't accept or dial any connections, until it is started.
+// This allows registering stream handlers and subscribing to events before the node is reachable.
+//
+// The returned host implements host.Lifecycle, which is used to start, stop and restart it.
+func DeferStart() Option {
+	return func(cfg *Config) error {
+		cfg.DeferStart = true
+		return nil
+	}
+}
+
 func WithDialTimeout(t time.Duration) Option {
 	return func(cfg *Config) error {
 		if t <= 0 {
@@ -551,6 +734,19 @@ func WithDialTimeout(t time.Duration) Option {
 	}
 }
 
+// WithDialBudget limits the total time it takes to connect to a peer, including address resolution,
+// the transport dial, the security handshake and the muxer negotiation, to t. The budget is apportioned
+// across these stages using network.DefaultDialBudgetWeights.
+func WithDialBudget(t time.Duration) Option {
+	return func(cfg *Config) error {
+		if t <= 0 {
+			return errors.New("dial budget needs to be positive")
+		}
+		cfg.SwarmOpts = append(cfg.SwarmOpts, swarm.WithDialBudget(network.DialBudget{Total: t}))
+		return nil
+	}
+}
+
 // DisableMetrics configures libp2p to disable prometheus metrics
 func DisableMetrics() Option {
 	return func(cfg *Config) error {
@@ -576,6 +772,23 @@ func PrometheusRegisterer(reg prometheus.Registerer) Option {
 	}
 }
 
+// WithTracerProvider records OpenTelemetry spans using tp, showing where the time to set up
+// connections and streams goes. Spans are recorded for dials, connection upgrades, the security
+// handshake (including the stages of the Noise handshake) and the protocol negotiation of streams.
+// Tracing is disabled by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(cfg *Config) error {
+		if cfg.TracerProvider != nil {
+			return errors.New("tracer provider already set")
+		}
+		if tp == nil {
+			return errors.New("tracer provider cannot be nil")
+		}
+		cfg.TracerProvider = tp
+		return nil
+	}
+}
+
 // DialRanker configures libp2p to use d as the dial ranker. To enable smart
 // dialing use `swarm.DefaultDialRanker`. use `swarm.NoDelayDialRanker` to
 // disable smart dialing.
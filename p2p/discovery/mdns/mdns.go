@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"math/rand"
+	"net"
 	"strings"
 	"sync"
 
@@ -48,9 +49,32 @@ type mdnsService struct {
 	server     *zeroconf.Server
 
 	notifee Notifee
+
+	ifaceNames  []string
+	ifaceFilter func(net.Interface) bool
+}
+
+// Option is an option for the mDNS service.
+type Option func(*mdnsService)
+
+// WithInterfaces restricts mDNS to the network interfaces with the given names.
+// By default, mDNS runs on all multicast-capable interfaces that are up.
+func WithInterfaces(names ...string) Option {
+	return func(s *mdnsService) {
+		s.ifaceNames = append(s.ifaceNames, names...)
+	}
 }
 
-func NewMdnsService(host host.Host, serviceName string, notifee Notifee) *mdnsService {
+// WithInterfaceFilter restricts mDNS to the network interfaces for which filter returns true.
+// This can be used to exclude virtual interfaces, e.g. docker0 or veth* interfaces created by container runtimes.
+// If used together with WithInterfaces, an interface needs to pass both.
+func WithInterfaceFilter(filter func(net.Interface) bool) Option {
+	return func(s *mdnsService) {
+		s.ifaceFilter = filter
+	}
+}
+
+func NewMdnsService(host host.Host, serviceName string, notifee Notifee, opts ...Option) *mdnsService {
 	if serviceName == "" {
 		serviceName = ServiceName
 	}
@@ -60,15 +84,22 @@ func NewMdnsService(host host.Host, serviceName string, notifee Notifee) *mdnsSe
 		peerName:    randomString(32 + rand.Intn(32)), // generate a random string between 32 and 63 characters long
 		notifee:     notifee,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
 	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
 	return s
 }
 
 func (s *mdnsService) Start() error {
-	if err := s.startServer(); err != nil {
+	ifaces, err := s.interfaces()
+	if err != nil {
+		return err
+	}
+	if err := s.startServer(ifaces); err != nil {
 		return err
 	}
-	s.startResolver(s.ctx)
+	s.startResolver(s.ctx, ifaces)
 	return nil
 }
 
@@ -109,7 +140,76 @@ func (s *mdnsService) getIPs(addrs []ma.Multiaddr) ([]string, error) {
 	return ips, nil
 }
 
-func (s *mdnsService) startServer() error {
+// interfaces returns the interfaces selected using WithInterfaces and WithInterfaceFilter.
+// It returns nil if no interfaces were selected, in which case zeroconf uses all multicast interfaces.
+func (s *mdnsService) interfaces() ([]net.Interface, error) {
+	if len(s.ifaceNames) == 0 && s.ifaceFilter == nil {
+		return nil, nil
+	}
+	all, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var ifaces []net.Interface
+	for _, iface := range all {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		if len(s.ifaceNames) > 0 && !containsString(s.ifaceNames, iface.Name) {
+			continue
+		}
+		if s.ifaceFilter != nil && !s.ifaceFilter(iface) {
+			continue
+		}
+		ifaces = append(ifaces, iface)
+	}
+	// zeroconf interprets an empty interface list as "all interfaces"
+	if len(ifaces) == 0 {
+		return nil, errors.New("no multicast interface matches the interface selection")
+	}
+	return ifaces, nil
+}
+
+// ipTraffic determines the IP versions to use for browsing.
+// zeroconf fails to browse if it can't join the multicast group of any of the IP versions it is configured for,
+// which is the case for IPv4 on IPv6-only networks (and vice versa).
+func ipTraffic(ifaces []net.Interface) zeroconf.IPType {
+	if len(ifaces) == 0 {
+		all, err := net.Interfaces()
+		if err != nil {
+			return zeroconf.IPv4AndIPv6
+		}
+		for _, iface := range all {
+			if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagMulticast != 0 {
+				ifaces = append(ifaces, iface)
+			}
+		}
+	}
+	var t zeroconf.IPType
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ipnet.IP.To4() != nil {
+				t |= zeroconf.IPv4
+			} else {
+				t |= zeroconf.IPv6
+			}
+		}
+	}
+	if t == 0 {
+		return zeroconf.IPv4AndIPv6
+	}
+	return t
+}
+
+func (s *mdnsService) startServer(ifaces []net.Interface) error {
 	interfaceAddrs, err := s.host.Network().InterfaceListenAddresses()
 	if err != nil {
 		return err
@@ -141,7 +241,7 @@ func (s *mdnsService) startServer() error {
 		s.peerName,
 		ips,
 		txts,
-		nil,
+		ifaces,
 	)
 	if err != nil {
 		return err
@@ -150,7 +250,7 @@ func (s *mdnsService) startServer() error {
 	return nil
 }
 
-func (s *mdnsService) startResolver(ctx context.Context) {
+func (s *mdnsService) startResolver(ctx context.Context, ifaces []net.Interface) {
 	s.resolverWG.Add(2)
 	entryChan := make(chan *zeroconf.ServiceEntry, 1000)
 	go func() {
@@ -186,12 +286,25 @@ func (s *mdnsService) startResolver(ctx context.Context) {
 	}()
 	go func() {
 		defer s.resolverWG.Done()
-		if err := zeroconf.Browse(ctx, s.serviceName, mdnsDomain, entryChan); err != nil {
+		opts := []zeroconf.ClientOption{zeroconf.SelectIPTraffic(ipTraffic(ifaces))}
+		if len(ifaces) > 0 {
+			opts = append(opts, zeroconf.SelectIfaces(ifaces))
+		}
+		if err := zeroconf.Browse(ctx, s.serviceName, mdnsDomain, entryChan, opts...); err != nil {
 			log.Debugf("zeroconf browsing failed: %s", err)
 		}
 	}()
 }
 
+func containsString(s []string, str string) bool {
+	for _, e := range s {
+		if e == str {
+			return true
+		}
+	}
+	return false
+}
+
 func randomString(l int) string {
 	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
 	s := make([]byte, 0, l)
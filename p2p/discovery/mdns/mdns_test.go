@@ -1,6 +1,7 @@
 package mdns
 
 import (
+	"net"
 	"sync"
 	"testing"
 	"time"
@@ -96,3 +97,35 @@ func TestOtherDiscovery(t *testing.T) {
 		"expected peers to find each other",
 	)
 }
+
+func TestInterfaceSelection(t *testing.T) {
+	host, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer host.Close()
+
+	t.Run("unknown interface", func(t *testing.T) {
+		s := NewMdnsService(host, "", &notif{}, WithInterfaces("does-not-exist"))
+		require.Error(t, s.Start())
+		require.NoError(t, s.Close())
+	})
+
+	t.Run("filter excluding all interfaces", func(t *testing.T) {
+		s := NewMdnsService(host, "", &notif{}, WithInterfaceFilter(func(net.Interface) bool { return false }))
+		require.Error(t, s.Start())
+		require.NoError(t, s.Close())
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		var names []string
+		s := NewMdnsService(host, "", &notif{}, WithInterfaceFilter(func(iface net.Interface) bool {
+			names = append(names, iface.Name)
+			return true
+		}))
+		ifaces, err := s.interfaces()
+		require.NoError(t, err)
+		require.Len(t, ifaces, len(names))
+		for _, iface := range ifaces {
+			require.NotZero(t, iface.Flags&net.FlagMulticast)
+		}
+	})
+}
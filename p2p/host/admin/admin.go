@@ -0,0 +1,472 @@
+// Package admin implements an optional HTTP admin API for a libp2p host.
+//
+// The admin API allows sidecar tooling to manage a node without embedding Go code: it
+// exposes connecting to and disconnecting from peers, listing peers and protocol handlers,
+// resource manager statistics, and a few runtime toggles.
+// The API is described by the OpenAPI document served at /v1/openapi.yaml.
+//
+// The admin API gives full control over the node. By default, it only listens on loopback
+// addresses, and clients must authenticate using a randomly generated bearer token, see
+// (*Server).AuthToken. Use WithAuthToken to configure the token.
+// To protect against DNS rebinding, requests are rejected unless their Host header names a
+// loopback address or the address the server listens on, see WithAllowedHosts.
+package admin
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+
+	logging "github.com/ipfs/go-log/v2"
+)
+
+var log = logging.Logger("admin")
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+const defaultConnectTimeout = 30 * time.Second
+
+type Option func(*Server) error
+
+// WithAuthToken requires clients to authenticate using the given bearer token.
+// If not set, a random token is generated.
+func WithAuthToken(token string) Option {
+	return func(s *Server) error {
+		if token == "" {
+			return errors.New("admin: auth token must not be empty")
+		}
+		s.token = token
+		return nil
+	}
+}
+
+// WithNonLoopbackListener allows the admin API to listen on non-loopback addresses.
+// Only use this on trusted networks. When listening on an unspecified address, use
+// WithAllowedHosts to allow the names clients use to reach the server.
+func WithNonLoopbackListener() Option {
+	return func(s *Server) error {
+		s.allowNonLoopback = true
+		return nil
+	}
+}
+
+// WithAllowedHosts allows requests whose Host header names one of the given hosts, in
+// addition to loopback addresses and the address the server listens on.
+// This is needed when the server is mounted on another HTTP server, or served behind a proxy.
+// Hosts are matched without their port.
+func WithAllowedHosts(hosts ...string) Option {
+	return func(s *Server) error {
+		for _, h := range hosts {
+			if h == "" {
+				return errors.New("admin: allowed host must not be empty")
+			}
+			if ip := net.ParseIP(h); ip != nil {
+				h = ip.String()
+			}
+			s.allowedHosts[h] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithConnectTimeout sets the timeout for connecting to a peer. Defaults to 30 seconds.
+func WithConnectTimeout(d time.Duration) Option {
+	return func(s *Server) error {
+		if d <= 0 {
+			return errors.New("admin: connect timeout must be positive")
+		}
+		s.connectTimeout = d
+		return nil
+	}
+}
+
+// Server serves the admin API of a host.
+// It implements http.Handler, so it can also be mounted on an existing HTTP server.
+type Server struct {
+	host             host.Host
+	token            string
+	allowNonLoopback bool
+	connectTimeout   time.Duration
+	mux              *http.ServeMux
+
+	mx           sync.RWMutex
+	server       *http.Server
+	allowedHosts map[string]struct{}
+}
+
+var _ http.Handler = (*Server)(nil)
+
+// New creates a new admin API server for h.
+func New(h host.Host, opts ...Option) (*Server, error) {
+	s := &Server{
+		host:           h,
+		connectTimeout: defaultConnectTimeout,
+		mux:            http.NewServeMux(),
+		allowedHosts:   map[string]struct{}{"localhost": {}},
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	if s.token == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("admin: failed to generate auth token: %w", err)
+		}
+		s.token = base64.RawURLEncoding.EncodeToString(b)
+	}
+	s.mux.HandleFunc("/v1/openapi.yaml", s.handleOpenAPI)
+	s.mux.HandleFunc("/v1/id", s.handleID)
+	s.mux.HandleFunc("/v1/peers", s.handlePeers)
+	s.mux.HandleFunc("/v1/connect", s.handleConnect)
+	s.mux.HandleFunc("/v1/disconnect", s.handleDisconnect)
+	s.mux.HandleFunc("/v1/protocols", s.handleProtocols)
+	s.mux.HandleFunc("/v1/resources", s.handleResources)
+	s.mux.HandleFunc("/v1/connmgr/trim", s.handleTrim)
+	s.mux.HandleFunc("/v1/log/level", s.handleLogLevel)
+	return s, nil
+}
+
+// Serve serves the admin API on the listener. It blocks until the server is closed.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.allowNonLoopback {
+		addr, ok := l.Addr().(*net.TCPAddr)
+		if !ok || !addr.IP.IsLoopback() {
+			return fmt.Errorf("admin: refusing to listen on non-loopback address %s", l.Addr())
+		}
+	}
+
+	s.mx.Lock()
+	if s.server != nil {
+		s.mx.Unlock()
+		return errors.New("admin: server already started")
+	}
+	s.server = &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	srv := s.server
+	if addr, ok := l.Addr().(*net.TCPAddr); ok {
+		s.allowedHosts[addr.IP.String()] = struct{}{}
+	}
+	s.mx.Unlock()
+
+	log.Infow("serving admin API", "addr", l.Addr())
+	if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// ListenAndServe listens on the TCP address addr, and serves the admin API.
+// It blocks until the server is closed.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return s.Serve(l)
+}
+
+// AuthToken returns the bearer token clients must send in the Authorization header.
+func (s *Server) AuthToken() string {
+	return s.token
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.isAllowedHost(r.Host) {
+		writeError(w, http.StatusForbidden, fmt.Errorf("host %q not allowed", r.Host))
+		return
+	}
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) < len(prefix) || auth[:len(prefix)] != prefix ||
+		subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(s.token)) != 1 {
+		writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+	// Browsers send cross-origin POST requests with "simple" content types without a
+	// preflight request. Requiring JSON makes sure that they can't reach the handlers.
+	if r.Method == http.MethodPost {
+		if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != "application/json" {
+			writeError(w, http.StatusUnsupportedMediaType, errors.New("content type must be application/json"))
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) isAllowedHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	// IPv6 addresses without a port are enclosed in brackets.
+	if len(host) > 1 && host[0] == '[' && host[len(host)-1] == ']' {
+		host = host[1 : len(host)-1]
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.IsLoopback() {
+			return true
+		}
+		host = ip.String()
+	}
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	_, ok := s.allowedHosts[host]
+	return ok
+}
+
+// ConnInfo describes a connection to a peer.
+type ConnInfo struct {
+	ID         string
+	LocalAddr  string
+	RemoteAddr string
+	Direction  string
+	Opened     time.Time
+	Transient  bool
+	NumStreams int
+}
+
+// PeerInfo describes a connected peer.
+type PeerInfo struct {
+	ID        peer.ID
+	Conns     []ConnInfo
+	Protocols []protocol.ID
+}
+
+// DisconnectRequest is the request of the /v1/disconnect endpoint.
+type DisconnectRequest struct {
+	ID peer.ID
+}
+
+// ResourcesResponse is the response of the /v1/resources endpoint.
+type ResourcesResponse struct {
+	System    network.ScopeStat
+	Transient network.ScopeStat
+	Services  map[string]network.ScopeStat      `json:",omitempty"`
+	Protocols map[protocol.ID]network.ScopeStat `json:",omitempty"`
+	Peers     map[peer.ID]network.ScopeStat     `json:",omitempty"`
+	// FDs is the number of file descriptors in use, by transport.
+	FDs map[string]int `json:",omitempty"`
+}
+
+// LogLevelRequest is the request of the /v1/log/level endpoint.
+// If Subsystem is empty, the level of all subsystems is set.
+type LogLevelRequest struct {
+	Subsystem string
+	Level     string
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodGet) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openAPISpec)
+}
+
+func (s *Server) handleID(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, peer.AddrInfo{ID: s.host.ID(), Addrs: s.host.Addrs()})
+}
+
+func (s *Server) handlePeers(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodGet) {
+		return
+	}
+	peers := s.host.Network().Peers()
+	infos := make([]PeerInfo, 0, len(peers))
+	for _, p := range peers {
+		info := PeerInfo{ID: p}
+		for _, c := range s.host.Network().ConnsToPeer(p) {
+			stat := c.Stat()
+			info.Conns = append(info.Conns, ConnInfo{
+				ID:         c.ID(),
+				LocalAddr:  c.LocalMultiaddr().String(),
+				RemoteAddr: c.RemoteMultiaddr().String(),
+				Direction:  stat.Direction.String(),
+				Opened:     stat.Opened,
+				Transient:  stat.Transient,
+				NumStreams: stat.NumStreams,
+			})
+		}
+		info.Protocols, _ = s.host.Peerstore().GetProtocols(p)
+		infos = append(infos, info)
+	}
+	writeJSON(w, infos)
+}
+
+func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodPost) {
+		return
+	}
+	// The addresses may be omitted if the addresses of the peer are already known.
+	var req peer.AddrInfo
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.ID == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing peer ID"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.connectTimeout)
+	defer cancel()
+	if err := s.host.Connect(ctx, req); err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleDisconnect(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req DisconnectRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.ID == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing peer ID"))
+		return
+	}
+	if err := s.host.Network().ClosePeer(req.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleProtocols(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodGet) {
+		return
+	}
+	protos := s.host.Mux().Protocols()
+	if protos == nil {
+		protos = []protocol.ID{}
+	}
+	writeJSON(w, protos)
+}
+
+func (s *Server) handleResources(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodGet) {
+		return
+	}
+	rm := s.host.Network().ResourceManager()
+	if state, ok := rm.(rcmgr.ResourceManagerState); ok {
+		stat := state.Stat()
+		writeJSON(w, ResourcesResponse(stat))
+		return
+	}
+	// Fall back to the scopes exposed by the network.ResourceManager interface.
+	var resp ResourcesResponse
+	_ = rm.ViewSystem(func(s network.ResourceScope) error {
+		resp.System = s.Stat()
+		return nil
+	})
+	_ = rm.ViewTransient(func(s network.ResourceScope) error {
+		resp.Transient = s.Stat()
+		return nil
+	})
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleTrim(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodPost) {
+		return
+	}
+	s.host.ConnManager().TrimOpenConns(r.Context())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	if !checkMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req LogLevelRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	var err error
+	if req.Subsystem == "" {
+		var lvl logging.LogLevel
+		lvl, err = logging.LevelFromString(req.Level)
+		if err == nil {
+			logging.SetAllLoggers(lvl)
+		}
+	} else {
+		err = logging.SetLogLevel(req.Subsystem, req.Level)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func checkMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return false
+	}
+	return true
+}
+
+// maxRequestSize is the maximum size of a request body.
+const maxRequestSize = 64 << 10
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debugf("failed to write response: %s", err)
+	}
+}
+
+// ErrorResponse is the response body sent when a request fails.
+type ErrorResponse struct {
+	Error string
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+}
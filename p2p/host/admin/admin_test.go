@@ -0,0 +1,250 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	blankhost "github.com/libp2p/go-libp2p/p2p/host/blank"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, s *Server, url string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+s.AuthToken())
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func post(t *testing.T, s *Server, url string, body any) *http.Response {
+	t.Helper()
+	b, err := json.Marshal(body)
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+s.AuthToken())
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestAdminAPI(t *testing.T) {
+	h1 := blankhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h1.Close()
+	h2 := blankhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h2.Close()
+	h1.SetStreamHandler("/test/1.0.0", func(s network.Stream) { s.Reset() })
+
+	s, err := New(h1)
+	require.NoError(t, err)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	resp := get(t, s, srv.URL+"/v1/id")
+	var id peer.AddrInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&id))
+	resp.Body.Close()
+	require.Equal(t, h1.ID(), id.ID)
+
+	resp = post(t, s, srv.URL+"/v1/connect", peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()})
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Equal(t, network.Connected, h1.Network().Connectedness(h2.ID()))
+
+	resp = get(t, s, srv.URL+"/v1/peers")
+	var peers []PeerInfo
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&peers))
+	resp.Body.Close()
+	require.Len(t, peers, 1)
+	require.Equal(t, h2.ID(), peers[0].ID)
+	require.Len(t, peers[0].Conns, 1)
+	require.Equal(t, "Outbound", peers[0].Conns[0].Direction)
+
+	resp = get(t, s, srv.URL+"/v1/protocols")
+	var protos []protocol.ID
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&protos))
+	resp.Body.Close()
+	require.Contains(t, protos, protocol.ID("/test/1.0.0"))
+
+	resp = get(t, s, srv.URL+"/v1/resources")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp.Body.Close()
+
+	resp = post(t, s, srv.URL+"/v1/disconnect", DisconnectRequest{ID: h2.ID()})
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.NotEqual(t, network.Connected, h1.Network().Connectedness(h2.ID()))
+
+	resp = post(t, s, srv.URL+"/v1/log/level", LogLevelRequest{Subsystem: "admin", Level: "foobar"})
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = get(t, s, srv.URL+"/v1/connect")
+	resp.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestAdminAPIAuth(t *testing.T) {
+	h := blankhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h.Close()
+
+	_, err := New(h, WithAuthToken(""))
+	require.Error(t, err)
+
+	s, err := New(h, WithAuthToken("secret"))
+	require.NoError(t, err)
+	require.Equal(t, "secret", s.AuthToken())
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	// Without WithAuthToken, a random token is required.
+	s2, err := New(h)
+	require.NoError(t, err)
+	require.NotEmpty(t, s2.AuthToken())
+	s3, err := New(h)
+	require.NoError(t, err)
+	require.NotEqual(t, s2.AuthToken(), s3.AuthToken())
+	srv2 := httptest.NewServer(s2)
+	defer srv2.Close()
+
+	for _, tc := range []struct {
+		url  string
+		auth string
+		code int
+	}{
+		{srv.URL, "", http.StatusUnauthorized},
+		{srv.URL, "Bearer wrong", http.StatusUnauthorized},
+		{srv.URL, "secret", http.StatusUnauthorized},
+		{srv.URL, "Bearer secret", http.StatusOK},
+		{srv2.URL, "", http.StatusUnauthorized},
+		{srv2.URL, "Bearer " + s2.AuthToken(), http.StatusOK},
+	} {
+		req, err := http.NewRequest(http.MethodGet, tc.url+"/v1/id", nil)
+		require.NoError(t, err)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, tc.code, resp.StatusCode, tc.auth)
+	}
+}
+
+func TestAdminAPILoopbackOnly(t *testing.T) {
+	h := blankhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h.Close()
+
+	s, err := New(h)
+	require.NoError(t, err)
+	l, err := net.Listen("tcp", "0.0.0.0:0")
+	require.NoError(t, err)
+	defer l.Close()
+	require.Error(t, s.Serve(l))
+
+	l, err = net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Serve(l) }()
+
+	var pi peer.AddrInfo
+	require.Eventually(t, func() bool {
+		req, err := http.NewRequest(http.MethodGet, "http://"+l.Addr().String()+"/v1/id", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+s.AuthToken())
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		return json.NewDecoder(resp.Body).Decode(&pi) == nil
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, h.ID(), pi.ID)
+	require.NoError(t, s.Close())
+	require.NoError(t, <-errCh)
+}
+
+func TestAdminAPIHostCheck(t *testing.T) {
+	h := blankhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h.Close()
+
+	s, err := New(h, WithAllowedHosts("admin.example"))
+	require.NoError(t, err)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		host string
+		code int
+	}{
+		{"", http.StatusOK},
+		{"localhost", http.StatusOK},
+		{"localhost:1234", http.StatusOK},
+		{"127.0.0.2:1234", http.StatusOK},
+		{"[::1]:1234", http.StatusOK},
+		{"[::1]", http.StatusOK},
+		{"admin.example:1234", http.StatusOK},
+		// DNS rebinding: a name that resolves to a loopback address.
+		{"attacker.example", http.StatusForbidden},
+		{"attacker.example:1234", http.StatusForbidden},
+		{"192.0.2.1", http.StatusForbidden},
+	} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/v1/id", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+s.AuthToken())
+		if tc.host != "" {
+			req.Host = tc.host
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, tc.code, resp.StatusCode, tc.host)
+	}
+}
+
+func TestAdminAPIContentType(t *testing.T) {
+	h := blankhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h.Close()
+
+	s, err := New(h)
+	require.NoError(t, err)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		contentType string
+		code        int
+	}{
+		{"", http.StatusUnsupportedMediaType},
+		{"text/plain", http.StatusUnsupportedMediaType},
+		{"application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"multipart/form-data; boundary=foo", http.StatusUnsupportedMediaType},
+		{"application/json", http.StatusNoContent},
+		{"application/json; charset=utf-8", http.StatusNoContent},
+	} {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/v1/log/level", strings.NewReader(`{"Subsystem":"admin","Level":"info"}`))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+s.AuthToken())
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, tc.code, resp.StatusCode, tc.contentType)
+	}
+}
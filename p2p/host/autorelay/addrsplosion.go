@@ -2,6 +2,7 @@ package autorelay
 
 import (
 	"encoding/binary"
+	"net"
 
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
@@ -35,6 +36,52 @@ func cleanupAddressSet(addrs []ma.Multiaddr) []ma.Multiaddr {
 	return sanitizeAddrsplodedSet(public, private)
 }
 
+// filterAddrFamily returns the addresses of the preferred family. If there are none,
+// or if no family is preferred, all addresses are returned.
+// Addresses that don't belong to an address family (e.g. /dnsaddr) are always kept.
+func filterAddrFamily(addrs []ma.Multiaddr, f AddrFamily) []ma.Multiaddr {
+	if f == AddrFamilyAny {
+		return addrs
+	}
+	var preferred []ma.Multiaddr
+	var hasPreferred bool
+	for _, a := range addrs {
+		switch addrFamily(a) {
+		case f:
+			hasPreferred = true
+			preferred = append(preferred, a)
+		case AddrFamilyAny:
+			preferred = append(preferred, a)
+		}
+	}
+	if !hasPreferred {
+		return addrs
+	}
+	return preferred
+}
+
+// addrFamily returns the address family of a, or AddrFamilyAny if it can't be determined.
+// IPv4-mapped IPv6 addresses are dialed using IPv4, and belong to the IPv4 family.
+func addrFamily(a ma.Multiaddr) AddrFamily {
+	first, _ := ma.SplitFirst(a)
+	if first == nil {
+		return AddrFamilyAny
+	}
+	switch first.Protocol().Code {
+	case ma.P_IP4, ma.P_DNS4:
+		return AddrFamilyIPv4
+	case ma.P_IP6:
+		if net.IP(first.RawValue()).To4() != nil {
+			return AddrFamilyIPv4
+		}
+		return AddrFamilyIPv6
+	case ma.P_IP6ZONE, ma.P_DNS6:
+		return AddrFamilyIPv6
+	default:
+		return AddrFamilyAny
+	}
+}
+
 func isRelayAddr(a ma.Multiaddr) bool {
 	isRelay := false
 
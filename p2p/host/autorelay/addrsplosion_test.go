@@ -88,3 +88,62 @@ func makeAddrList(strs ...string) []ma.Multiaddr {
 	}
 	return result
 }
+
+func TestCleanupAddrsIPv6(t *testing.T) {
+	addrs := makeAddrList(
+		"/ip6/::1/tcp/4001",
+		"/ip6/fe80::1/tcp/4001",
+		"/ip6/2001:db8::1/tcp/4001",
+		"/ip6/2001:db8::1/udp/4001/quic-v1",
+		"/ip4/1.2.3.4/tcp/4001",
+	)
+	clean := makeAddrList(
+		"/ip6/2001:db8::1/tcp/4001",
+		"/ip6/2001:db8::1/udp/4001/quic-v1",
+		"/ip4/1.2.3.4/tcp/4001",
+	)
+	require.ElementsMatch(t, clean, cleanupAddressSet(addrs))
+}
+
+func TestFilterAddrFamily(t *testing.T) {
+	dualStack := makeAddrList(
+		"/ip4/1.2.3.4/tcp/4001",
+		"/dns4/example.com/tcp/4001",
+		"/ip6/2001:db8::1/udp/4001/quic-v1",
+		"/dns6/example.com/tcp/4001",
+		"/dnsaddr/example.com",
+	)
+	require.Equal(t, dualStack, filterAddrFamily(dualStack, AddrFamilyAny))
+	require.Equal(t, makeAddrList(
+		"/ip4/1.2.3.4/tcp/4001",
+		"/dns4/example.com/tcp/4001",
+		"/dnsaddr/example.com",
+	), filterAddrFamily(dualStack, AddrFamilyIPv4))
+	require.Equal(t, makeAddrList(
+		"/ip6/2001:db8::1/udp/4001/quic-v1",
+		"/dns6/example.com/tcp/4001",
+		"/dnsaddr/example.com",
+	), filterAddrFamily(dualStack, AddrFamilyIPv6))
+
+	// If the relay isn't reachable using the preferred address family, use all addresses.
+	ipv4Only := makeAddrList("/ip4/1.2.3.4/tcp/4001", "/dnsaddr/example.com")
+	require.Equal(t, ipv4Only, filterAddrFamily(ipv4Only, AddrFamilyIPv6))
+}
+
+func TestAddrFamily(t *testing.T) {
+	for _, tc := range []struct {
+		addr   string
+		family AddrFamily
+	}{
+		{"/ip4/1.2.3.4/tcp/4001", AddrFamilyIPv4},
+		{"/dns4/example.com/tcp/4001", AddrFamilyIPv4},
+		{"/ip6/::ffff:1.2.3.4/tcp/4001", AddrFamilyIPv4},
+		{"/ip6/2001:db8::1/udp/4001/quic-v1", AddrFamilyIPv6},
+		{"/ip6zone/eth0/ip6/fe80::1/tcp/4001", AddrFamilyIPv6},
+		{"/dns6/example.com/tcp/4001", AddrFamilyIPv6},
+		{"/dns/example.com/tcp/4001", AddrFamilyAny},
+		{"/dnsaddr/example.com", AddrFamilyAny},
+	} {
+		require.Equal(t, tc.family, addrFamily(ma.StringCast(tc.addr)), tc.addr)
+	}
+}
@@ -47,9 +47,13 @@ func NewAutoRelay(bhost *basic.BasicHost, opts ...Option) (*AutoRelay, error) {
 			return nil, err
 		}
 	}
+	rf, err := newRelayFinder(bhost, conf.peerSource, &conf)
+	if err != nil {
+		return nil, err
+	}
 	r.ctx, r.ctxCancel = context.WithCancel(context.Background())
 	r.conf = &conf
-	r.relayFinder = newRelayFinder(bhost, conf.peerSource, &conf)
+	r.relayFinder = rf
 	r.metricsTracer = &wrappedMetricsTracer{conf.metricsTracer}
 	bhost.AddrsFactory = r.hostAddrs
 
@@ -117,9 +121,15 @@ func (r *AutoRelay) relayAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
 	return r.relayFinder.relayAddrs(addrs)
 }
 
+// RelayScores returns the scores of the relays we're using and of the relay candidates.
+func (r *AutoRelay) RelayScores() []RelayScore {
+	return r.relayFinder.relayScores()
+}
+
 func (r *AutoRelay) Close() error {
 	r.ctxCancel()
 	err := r.relayFinder.Stop()
 	r.refCount.Wait()
+	r.relayFinder.candidateEmitter.Close()
 	return err
 }
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -517,3 +518,48 @@ func TestNoBusyLoop0MinInterval(t *testing.T) {
 	val := atomic.LoadUint64(&calledTimes)
 	require.Less(t, val, uint64(2))
 }
+
+func TestCandidateEvents(t *testing.T) {
+	peerChan := make(chan peer.AddrInfo)
+	h := newPrivateNode(t,
+		func(context.Context, int) <-chan peer.AddrInfo { return peerChan },
+		autorelay.WithMinCandidates(1),
+		autorelay.WithNumRelays(1),
+		autorelay.WithBootDelay(0),
+		autorelay.WithMinInterval(time.Hour),
+	)
+	defer h.Close()
+	sub, err := h.EventBus().Subscribe(new(event.EvtAutoRelayCandidate))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	nextEvent := func() event.EvtAutoRelayCandidate {
+		t.Helper()
+		select {
+		case e := <-sub.Out():
+			return e.(event.EvtAutoRelayCandidate)
+		case <-time.After(10 * time.Second):
+			t.Fatal("timeout waiting for candidate event")
+		}
+		return event.EvtAutoRelayCandidate{}
+	}
+
+	// a node that doesn't support circuit v2 is dropped
+	n, err := libp2p.New(libp2p.DisableRelay(), libp2p.ForceReachabilityPublic())
+	require.NoError(t, err)
+	defer n.Close()
+	peerChan <- peer.AddrInfo{ID: n.ID(), Addrs: n.Addrs()}
+	require.Equal(t, event.EvtAutoRelayCandidate{Peer: n.ID(), Stage: event.AutoRelayCandidateFound}, nextEvent())
+	require.Equal(t,
+		event.EvtAutoRelayCandidate{Peer: n.ID(), Stage: event.AutoRelayCandidateDropped, Reason: autorelay.DropReasonNoCircuitV2},
+		nextEvent(),
+	)
+
+	r := newRelay(t)
+	defer r.Close()
+	peerChan <- peer.AddrInfo{ID: r.ID(), Addrs: r.Addrs()}
+	require.Equal(t, event.EvtAutoRelayCandidate{Peer: r.ID(), Stage: event.AutoRelayCandidateFound}, nextEvent())
+	require.Equal(t, event.EvtAutoRelayCandidate{Peer: r.ID(), Stage: event.AutoRelayCandidateProbed}, nextEvent())
+	require.Equal(t, event.EvtAutoRelayCandidate{Peer: r.ID(), Stage: event.AutoRelayCandidateReserved}, nextEvent())
+	require.Eventually(t, func() bool { return numRelays(h) > 0 }, 10*time.Second, 100*time.Millisecond)
+}
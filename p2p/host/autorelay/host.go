@@ -2,6 +2,9 @@ package autorelay
 
 import (
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
 )
 
 type AutoRelayHost struct {
@@ -18,6 +21,21 @@ func (h *AutoRelayHost) Start() {
 	h.ar.Start()
 }
 
+// PeerProtocolStats returns the protocol usage statistics of the underlying host,
+// if it tracks them.
+func (h *AutoRelayHost) PeerProtocolStats(p peer.ID) map[protocol.ID]host.ProtocolStats {
+	if t, ok := h.Host.(host.ProtocolStatsTracker); ok {
+		return t.PeerProtocolStats(p)
+	}
+	return nil
+}
+
+// SetStreamHandlerWithLimit sets the protocol handler on the underlying host,
+// enforcing the message size limit. See host.MessageSizeLimiter.
+func (h *AutoRelayHost) SetStreamHandlerWithLimit(pid protocol.ID, limit host.MessageSizeLimit, handler network.StreamHandler) {
+	host.SetStreamHandlerWithLimit(h.Host, pid, limit, handler)
+}
+
 func NewAutoRelayHost(h host.Host, ar *AutoRelay) *AutoRelayHost {
 	return &AutoRelayHost{Host: h, ar: ar}
 }
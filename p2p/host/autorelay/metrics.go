@@ -3,6 +3,7 @@ package autorelay
 import (
 	"errors"
 
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/p2p/metricshelper"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
 	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
@@ -71,6 +72,14 @@ var (
 		},
 		[]string{"type"},
 	)
+	candidatePipelineTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "candidate_pipeline_total",
+			Help:      "Candidates reaching a stage of the candidate pipeline",
+		},
+		[]string{"stage", "reason"},
+	)
 	candLoopState = prometheus.NewGauge(
 		prometheus.GaugeOpts{
 			Namespace: metricNamespace,
@@ -105,6 +114,7 @@ var (
 		relayAddressesCount,
 		candidatesCircuitV2SupportTotal,
 		candidatesTotal,
+		candidatePipelineTotal,
 		candLoopState,
 		scheduledWorkTime,
 		desiredReservations,
@@ -134,6 +144,7 @@ type MetricsTracer interface {
 	CandidateChecked(supportsCircuitV2 bool)
 	CandidateAdded(cnt int)
 	CandidateRemoved(cnt int)
+	CandidateStageReached(stage event.AutoRelayCandidateStage, reason string)
 	CandidateLoopState(state candidateLoopState)
 
 	ScheduledWorkUpdated(scheduledWork *scheduledWorkTimes)
@@ -241,6 +252,13 @@ func (mt *metricsTracer) CandidateRemoved(cnt int) {
 	candidatesTotal.WithLabelValues(*tags...).Add(float64(cnt))
 }
 
+func (mt *metricsTracer) CandidateStageReached(stage event.AutoRelayCandidateStage, reason string) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+	*tags = append(*tags, string(stage), reason)
+	candidatePipelineTotal.WithLabelValues(*tags...).Inc()
+}
+
 func (mt *metricsTracer) CandidateLoopState(state candidateLoopState) {
 	candLoopState.Set(float64(state))
 }
@@ -354,6 +372,12 @@ func (mt *wrappedMetricsTracer) CandidateRemoved(cnt int) {
 	}
 }
 
+func (mt *wrappedMetricsTracer) CandidateStageReached(stage event.AutoRelayCandidateStage, reason string) {
+	if mt.mt != nil {
+		mt.mt.CandidateStageReached(stage, reason)
+	}
+}
+
 func (mt *wrappedMetricsTracer) ScheduledWorkUpdated(scheduledWork *scheduledWorkTimes) {
 	if mt.mt != nil {
 		mt.mt.ScheduledWorkUpdated(scheduledWork)
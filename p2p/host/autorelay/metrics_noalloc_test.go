@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/client"
 	pbv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/pb"
 )
@@ -34,6 +35,13 @@ func TestMetricsNoAllocNoCover(t *testing.T) {
 		client.ReservationError{Status: pbv2.Status_MALFORMED_MESSAGE},
 		nil,
 	}
+	stages := []event.AutoRelayCandidateStage{
+		event.AutoRelayCandidateFound,
+		event.AutoRelayCandidateProbed,
+		event.AutoRelayCandidateReserved,
+		event.AutoRelayCandidateDropped,
+	}
+	reasons := []string{"", DropReasonBackoff, DropReasonNoCircuitV2, DropReasonReservationFailed}
 	tr := NewMetricsTracer()
 	tests := map[string]func(){
 		"RelayFinderStatus":          func() { tr.RelayFinderStatus(rand.Intn(2) == 1) },
@@ -45,6 +53,7 @@ func TestMetricsNoAllocNoCover(t *testing.T) {
 		"CandidateChecked":           func() { tr.CandidateChecked(rand.Intn(2) == 1) },
 		"CandidateAdded":             func() { tr.CandidateAdded(rand.Intn(10)) },
 		"CandidateRemoved":           func() { tr.CandidateRemoved(rand.Intn(10)) },
+		"CandidateStageReached":      func() { tr.CandidateStageReached(stages[rand.Intn(len(stages))], reasons[rand.Intn(len(reasons))]) },
 		"ScheduledWorkUpdated":       func() { tr.ScheduledWorkUpdated(&scheduledWork[rand.Intn(len(scheduledWork))]) },
 		"DesiredReservations":        func() { tr.DesiredReservations(rand.Intn(10)) },
 		"CandidateLoopState":         func() { tr.CandidateLoopState(candidateLoopState(rand.Intn(10))) },
@@ -42,6 +42,10 @@ type config struct {
 	setMinCandidates bool
 	// see WithMetricsTracer
 	metricsTracer MetricsTracer
+	// see WithPreferredAddrFamily
+	addrFamily AddrFamily
+	// see WithMaxRelayLatency
+	maxRelayLatency time.Duration
 }
 
 var defaultConfig = config{
@@ -231,3 +235,46 @@ func WithMetricsTracer(mt MetricsTracer) Option {
 		return nil
 	}
 }
+
+// AddrFamily is an IP address family.
+type AddrFamily int
+
+const (
+	// AddrFamilyAny doesn't prefer any address family.
+	AddrFamilyAny AddrFamily = iota
+	// AddrFamilyIPv4 is the IPv4 address family.
+	AddrFamilyIPv4
+	// AddrFamilyIPv6 is the IPv6 address family.
+	AddrFamilyIPv6
+)
+
+// WithPreferredAddrFamily configures the address family preferred for circuit addresses.
+// If a relay is reachable using addresses of the preferred family, only circuit addresses
+// using these addresses are advertised for that relay. Otherwise, all of the relay's addresses
+// are used, so dual-stack and single-stack relays can be used with either preference.
+// Defaults to AddrFamilyAny.
+func WithPreferredAddrFamily(f AddrFamily) Option {
+	return func(c *config) error {
+		switch f {
+		case AddrFamilyAny, AddrFamilyIPv4, AddrFamilyIPv6:
+		default:
+			return errors.New("invalid address family")
+		}
+		c.addrFamily = f
+		return nil
+	}
+}
+
+// WithMaxRelayLatency sets the maximum expected latency of circuits through a relay (see RelayScore).
+// The latency of the relays we're using is checked periodically. If a relay is slower, for example
+// because it is overloaded, we stop using it and obtain a reservation with another relay.
+// Defaults to 0, which disables dropping slow relays.
+func WithMaxRelayLatency(d time.Duration) Option {
+	return func(c *config) error {
+		if d < 0 {
+			return errors.New("max relay latency must not be negative")
+		}
+		c.maxRelayLatency = d
+		return nil
+	}
+}
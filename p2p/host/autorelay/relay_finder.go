@@ -28,8 +28,8 @@ const protoIDv2 = circuitv2_proto.ProtoIDv2Hop
 // Candidate: Once we connect to a node and it supports relay protocol,
 // we call it a candidate, and consider using it as a relay.
 // Relay: Out of the list of candidates, we select a relay to connect to.
-// Currently, we just randomly select a candidate, but we can employ more sophisticated
-// selection strategies here (e.g. by facotring in the RTT).
+// Candidates are selected by the expected latency of circuits through them (see RelayScore),
+// candidates with an unknown latency are selected randomly.
 
 const (
 	rsvpRefreshInterval = time.Minute
@@ -81,15 +81,48 @@ type relayFinder struct {
 	// A channel that triggers a run of `runScheduledWork`.
 	triggerRunScheduledWork chan struct{}
 	metricsTracer           MetricsTracer
+
+	candidateEmitter event.Emitter
+
+	scorer *relayScorer
 }
 
 var errAlreadyRunning = errors.New("relayFinder already running")
 
-func newRelayFinder(host *basic.BasicHost, peerSource PeerSource, conf *config) *relayFinder {
+// Reasons for dropping a potential relay, reported in the Reason field of event.EvtAutoRelayCandidate
+// and in the candidate pipeline metric.
+const (
+	// DropReasonBackoff means that we recently attempted to obtain a reservation with the node.
+	DropReasonBackoff = "backoff"
+	// DropReasonEnoughCandidates means that we already have the maximum number of candidates.
+	DropReasonEnoughCandidates = "enough candidates"
+	// DropReasonRelayInUse means that we already have a reservation with the node.
+	DropReasonRelayInUse = "relay in use"
+	// DropReasonConnectFailed means that connecting to the node failed.
+	DropReasonConnectFailed = "connection failed"
+	// DropReasonNotPublic means that the node is only reachable via a relay itself.
+	DropReasonNotPublic = "not public"
+	// DropReasonNoCircuitV2 means that the node doesn't support the circuit v2 hop protocol.
+	DropReasonNoCircuitV2 = "no circuit v2"
+	// DropReasonProbeFailed means that checking the protocols supported by the node failed,
+	// for example because identify didn't complete in time.
+	DropReasonProbeFailed = "probe failed"
+	// DropReasonExpired means that the candidate exceeded the maximum candidate age.
+	DropReasonExpired = "expired"
+	// DropReasonReservationFailed means that the node refused our reservation request.
+	DropReasonReservationFailed = "reservation failed"
+)
+
+func newRelayFinder(host *basic.BasicHost, peerSource PeerSource, conf *config) (*relayFinder, error) {
 	if peerSource == nil {
 		panic("Can not create a new relayFinder. Need a Peer Source fn or a list of static relays. Refer to the documentation around `libp2p.EnableAutoRelay`")
 	}
 
+	emitter, err := host.EventBus().Emitter(new(event.EvtAutoRelayCandidate))
+	if err != nil {
+		return nil, err
+	}
+
 	return &relayFinder{
 		bootTime:                   conf.clock.Now(),
 		host:                       host,
@@ -104,7 +137,9 @@ func newRelayFinder(host *basic.BasicHost, peerSource PeerSource, conf *config)
 		relays:                     make(map[peer.ID]*circuitv2.Reservation),
 		relayUpdated:               make(chan struct{}, 1),
 		metricsTracer:              &wrappedMetricsTracer{conf.metricsTracer},
-	}
+		candidateEmitter:           emitter,
+		scorer:                     newRelayScorer(host),
+	}, nil
 }
 
 type scheduledWorkTimes struct {
@@ -129,6 +164,12 @@ func (rf *relayFinder) background(ctx context.Context) {
 		rf.handleNewCandidates(ctx)
 	}()
 
+	rf.refCount.Add(1)
+	go func() {
+		defer rf.refCount.Done()
+		rf.scorer.run(ctx)
+	}()
+
 	subConnectedness, err := rf.host.EventBus().Subscribe(new(event.EvtPeerConnectednessChanged), eventbus.Name("autorelay (relay finder)"))
 	if err != nil {
 		log.Error("failed to subscribe to the EvtPeerConnectednessChanged")
@@ -225,7 +266,9 @@ func (rf *relayFinder) runScheduledWork(ctx context.Context, now time.Time, sche
 
 	if now.After(scheduledWork.nextRefresh) {
 		scheduledWork.nextRefresh = now.Add(rsvpRefreshInterval)
-		if rf.refreshReservations(ctx, now) {
+		refreshFailed := rf.refreshReservations(ctx, now)
+		droppedSlow := rf.checkRelayLatencies(ctx)
+		if refreshFailed || droppedSlow {
 			rf.clearCachedAddrsAndSignalAddressChange()
 		}
 	}
@@ -280,9 +323,8 @@ func (rf *relayFinder) clearOldCandidates(now time.Time) time.Time {
 	// If we don't have any candidates, we should run this again in rf.conf.maxCandidateAge.
 	nextTime := now.Add(rf.conf.maxCandidateAge)
 
-	var deleted bool
+	var deleted []peer.ID
 	rf.candidateMx.Lock()
-	defer rf.candidateMx.Unlock()
 	for id, cand := range rf.candidates {
 		expiry := cand.added.Add(rf.conf.maxCandidateAge)
 		if expiry.After(now) {
@@ -291,13 +333,17 @@ func (rf *relayFinder) clearOldCandidates(now time.Time) time.Time {
 			}
 		} else {
 			log.Debugw("deleting candidate due to age", "id", id)
-			deleted = true
+			deleted = append(deleted, id)
 			rf.removeCandidate(id)
 		}
 	}
-	if deleted {
+	rf.candidateMx.Unlock()
+	if len(deleted) > 0 {
 		rf.notifyMaybeNeedNewCandidates()
 	}
+	for _, id := range deleted {
+		rf.candidateDropped(id, DropReasonExpired)
+	}
 
 	return nextTime
 }
@@ -368,16 +414,19 @@ func (rf *relayFinder) findNodes(ctx context.Context, peerSourceRateLimiter <-ch
 				continue
 			}
 			log.Debugw("found node", "id", pi.ID)
+			rf.candidateStageReached(pi.ID, event.AutoRelayCandidateFound, "")
 			rf.candidateMx.Lock()
 			numCandidates := len(rf.candidates)
 			backoffStart, isOnBackoff := rf.backoff[pi.ID]
 			rf.candidateMx.Unlock()
 			if isOnBackoff {
 				log.Debugw("skipping node that we recently failed to obtain a reservation with", "id", pi.ID, "last attempt", rf.conf.clock.Since(backoffStart))
+				rf.candidateDropped(pi.ID, DropReasonBackoff)
 				continue
 			}
 			if numCandidates >= rf.conf.maxCandidates {
 				log.Debugw("skipping node. Already have enough candidates", "id", pi.ID, "num", numCandidates, "max", rf.conf.maxCandidates)
+				rf.candidateDropped(pi.ID, DropReasonEnoughCandidates)
 				continue
 			}
 			rf.refCount.Add(1)
@@ -396,6 +445,18 @@ func (rf *relayFinder) findNodes(ctx context.Context, peerSourceRateLimiter <-ch
 	}
 }
 
+func (rf *relayFinder) candidateStageReached(p peer.ID, stage event.AutoRelayCandidateStage, reason string) {
+	rf.metricsTracer.CandidateStageReached(stage, reason)
+	if err := rf.candidateEmitter.Emit(event.EvtAutoRelayCandidate{Peer: p, Stage: stage, Reason: reason}); err != nil {
+		log.Debugw("failed to emit candidate event", "error", err)
+	}
+}
+
+func (rf *relayFinder) candidateDropped(p peer.ID, reason string) {
+	log.Debugw("dropping relay candidate", "id", p, "reason", reason)
+	rf.candidateStageReached(p, event.AutoRelayCandidateDropped, reason)
+}
+
 func (rf *relayFinder) notifyMaybeConnectToRelay() {
 	select {
 	case rf.maybeConnectToRelayTrigger <- struct{}{}:
@@ -426,17 +487,19 @@ func (rf *relayFinder) handleNewNode(ctx context.Context, pi peer.AddrInfo) (add
 	relayInUse := rf.usingRelay(pi.ID)
 	rf.relayMx.Unlock()
 	if relayInUse {
+		rf.candidateDropped(pi.ID, DropReasonRelayInUse)
 		return false
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	tctx, cancel := context.WithTimeout(ctx, 20*time.Second)
 	defer cancel()
-	supportsV2, err := rf.tryNode(ctx, pi)
+	supportsV2, err := rf.tryNode(tctx, pi)
 	if err != nil {
 		log.Debugf("node %s not accepted as a candidate: %s", pi.ID, err)
 		if err == errProtocolNotSupported {
 			rf.metricsTracer.CandidateChecked(false)
 		}
+		rf.candidateDropped(pi.ID, probeDropReason(err))
 		return false
 	}
 	rf.metricsTracer.CandidateChecked(true)
@@ -444,6 +507,7 @@ func (rf *relayFinder) handleNewNode(ctx context.Context, pi peer.AddrInfo) (add
 	rf.candidateMx.Lock()
 	if len(rf.candidates) > rf.conf.maxCandidates {
 		rf.candidateMx.Unlock()
+		rf.candidateDropped(pi.ID, DropReasonEnoughCandidates)
 		return false
 	}
 	log.Debugw("node supports relay protocol", "peer", pi.ID, "supports circuit v2", supportsV2)
@@ -453,22 +517,49 @@ func (rf *relayFinder) handleNewNode(ctx context.Context, pi peer.AddrInfo) (add
 		supportsRelayV2: supportsV2,
 	})
 	rf.candidateMx.Unlock()
+	rf.candidateStageReached(pi.ID, event.AutoRelayCandidateProbed, "")
+
+	// Measure the RTT in the background, so we can select the best candidates.
+	// Until the measurement completes, the candidate is sorted after the candidates with a known RTT.
+	rf.refCount.Add(1)
+	go func() {
+		defer rf.refCount.Done()
+		rf.scorer.measureRTT(ctx, pi.ID)
+	}()
 	return true
 }
 
-var errProtocolNotSupported = errors.New("doesn't speak circuit v2")
+var (
+	errProtocolNotSupported = errors.New("doesn't speak circuit v2")
+	errNotPublicNode        = errors.New("not a public node")
+	errConnectToRelay       = errors.New("error connecting to relay")
+)
+
+// probeDropReason returns the reason for dropping a node that tryNode failed for.
+func probeDropReason(err error) string {
+	switch {
+	case errors.Is(err, errProtocolNotSupported):
+		return DropReasonNoCircuitV2
+	case errors.Is(err, errNotPublicNode):
+		return DropReasonNotPublic
+	case errors.Is(err, errConnectToRelay):
+		return DropReasonConnectFailed
+	default:
+		return DropReasonProbeFailed
+	}
+}
 
 // tryNode checks if a peer actually supports either circuit v2.
 // It does not modify any internal state.
 func (rf *relayFinder) tryNode(ctx context.Context, pi peer.AddrInfo) (supportsRelayV2 bool, err error) {
 	if err := rf.host.Connect(ctx, pi); err != nil {
-		return false, fmt.Errorf("error connecting to relay %s: %w", pi.ID, err)
+		return false, fmt.Errorf("%w %s: %s", errConnectToRelay, pi.ID, err)
 	}
 
 	conns := rf.host.Network().ConnsToPeer(pi.ID)
 	for _, conn := range conns {
 		if isRelayAddr(conn.RemoteMultiaddr()) {
-			return false, errors.New("not a public node")
+			return false, errNotPublicNode
 		}
 	}
 
@@ -553,6 +644,7 @@ func (rf *relayFinder) maybeConnectToRelay(ctx context.Context) {
 			rf.removeCandidate(id)
 			rf.candidateMx.Unlock()
 			rf.notifyMaybeNeedNewCandidates()
+			rf.candidateDropped(id, DropReasonRelayInUse)
 			continue
 		}
 		rsvp, err := rf.connectToRelay(ctx, cand)
@@ -560,8 +652,14 @@ func (rf *relayFinder) maybeConnectToRelay(ctx context.Context) {
 			log.Debugw("failed to connect to relay", "peer", id, "error", err)
 			rf.notifyMaybeNeedNewCandidates()
 			rf.metricsTracer.ReservationRequestFinished(false, err)
+			if errors.Is(err, errConnectToRelay) {
+				rf.candidateDropped(id, DropReasonConnectFailed)
+			} else {
+				rf.candidateDropped(id, DropReasonReservationFailed)
+			}
 			continue
 		}
+		rf.candidateStageReached(id, event.AutoRelayCandidateReserved, "")
 		log.Debugw("adding new relay", "id", id)
 		rf.relayMx.Lock()
 		rf.relays[id] = rsvp
@@ -598,7 +696,7 @@ func (rf *relayFinder) connectToRelay(ctx context.Context, cand *candidate) (*ci
 			rf.candidateMx.Lock()
 			rf.removeCandidate(cand.ai.ID)
 			rf.candidateMx.Unlock()
-			return nil, fmt.Errorf("failed to connect: %w", err)
+			return nil, fmt.Errorf("%w: %s", errConnectToRelay, err)
 		}
 	}
 
@@ -665,6 +763,83 @@ func (rf *relayFinder) refreshRelayReservation(ctx context.Context, p peer.ID) e
 	return nil
 }
 
+// checkRelayLatencies drops the relays we're using that are slower than the configured maximum latency,
+// so that we obtain a reservation with a better relay. It does nothing if no maximum latency is configured.
+// It returns true if any relay was dropped.
+func (rf *relayFinder) checkRelayLatencies(ctx context.Context) bool {
+	if rf.conf.maxRelayLatency <= 0 {
+		return false
+	}
+	rf.relayMx.Lock()
+	relays := make([]peer.ID, 0, len(rf.relays))
+	for p := range rf.relays {
+		relays = append(relays, p)
+	}
+	rf.relayMx.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range relays {
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer wg.Done()
+			rf.scorer.measureRTT(ctx, p)
+		}(p)
+	}
+	wg.Wait()
+
+	var dropped []peer.ID
+	rf.relayMx.Lock()
+	for _, p := range relays {
+		if !rf.usingRelay(p) {
+			continue
+		}
+		if l := rf.scorer.score(p).Latency(); l > rf.conf.maxRelayLatency {
+			log.Debugw("dropping slow relay", "relay", p, "latency", l)
+			delete(rf.relays, p)
+			rf.host.ConnManager().Unprotect(p, autorelayTag)
+			dropped = append(dropped, p)
+		}
+	}
+	rf.relayMx.Unlock()
+	if len(dropped) == 0 {
+		return false
+	}
+
+	// don't select the relays again right away
+	now := rf.conf.clock.Now()
+	rf.candidateMx.Lock()
+	for _, p := range dropped {
+		rf.backoff[p] = now
+	}
+	rf.candidateMx.Unlock()
+
+	rf.metricsTracer.ReservationEnded(len(dropped))
+	rf.notifyMaybeConnectToRelay()
+	rf.notifyMaybeNeedNewCandidates()
+	return true
+}
+
+// relayScores returns the scores of the relays we're using and of the candidates.
+func (rf *relayFinder) relayScores() []RelayScore {
+	peers := make(map[peer.ID]struct{})
+	rf.relayMx.Lock()
+	for p := range rf.relays {
+		peers[p] = struct{}{}
+	}
+	rf.relayMx.Unlock()
+	rf.candidateMx.Lock()
+	for p := range rf.candidates {
+		peers[p] = struct{}{}
+	}
+	rf.candidateMx.Unlock()
+
+	scores := make([]RelayScore, 0, len(peers))
+	for p := range peers {
+		scores = append(scores, rf.scorer.score(p))
+	}
+	return scores
+}
+
 // usingRelay returns if we're currently using the given relay.
 func (rf *relayFinder) usingRelay(p peer.ID) bool {
 	_, ok := rf.relays[p]
@@ -699,11 +874,11 @@ func (rf *relayFinder) selectCandidates() []*candidate {
 		}
 	}
 
-	// TODO: better relay selection strategy; this just selects random relays,
-	// but we should probably use ping latency as the selection metric
+	// Shuffle first, so that candidates with an unknown latency are selected randomly.
 	rand.Shuffle(len(candidates), func(i, j int) {
 		candidates[i], candidates[j] = candidates[j], candidates[i]
 	})
+	rf.scorer.sortCandidates(candidates)
 	return candidates
 }
 
@@ -734,7 +909,7 @@ func (rf *relayFinder) relayAddrs(addrs []ma.Multiaddr) []ma.Multiaddr {
 	// add relay specific addrs to the list
 	relayAddrCnt := 0
 	for p := range rf.relays {
-		addrs := cleanupAddressSet(rf.host.Peerstore().Addrs(p))
+		addrs := filterAddrFamily(cleanupAddressSet(rf.host.Peerstore().Addrs(p)), rf.conf.addrFamily)
 		relayAddrCnt += len(addrs)
 		circuit := ma.StringCast(fmt.Sprintf("/p2p/%s/p2p-circuit", p.Pretty()))
 		for _, addr := range addrs {
@@ -0,0 +1,161 @@
+package autorelay
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+)
+
+const (
+	// relayScoreEWMASmoothing is the weight of a new measurement in the moving averages.
+	relayScoreEWMASmoothing = 0.1
+	// maxScoredRelays is the maximum number of relays we keep circuit measurements for.
+	maxScoredRelays = 256
+	// relayPingTimeout is the timeout for measuring the round trip time to a relay.
+	relayPingTimeout = 10 * time.Second
+)
+
+// RelayScore describes the performance of a relay, as measured by us.
+type RelayScore struct {
+	Relay peer.ID
+	// RTT is the (moving average of the) round trip time to the relay, or 0 if it is unknown.
+	RTT time.Duration
+	// DestinationRTT is the moving average of the round trip time from the relay to the
+	// destinations of the circuits we opened through the relay, including the time the relay
+	// took to process our requests. It is 0 if we didn't measure any circuits through the relay.
+	// An overloaded relay is slow to process requests, which increases the DestinationRTT.
+	DestinationRTT time.Duration
+	// Circuits is the number of circuits we measured.
+	Circuits int
+}
+
+// Latency is the expected round trip time of a circuit through the relay, or 0 if it is unknown.
+// Lower is better.
+func (s RelayScore) Latency() time.Duration {
+	if s.RTT == 0 {
+		return 0
+	}
+	return s.RTT + s.DestinationRTT
+}
+
+type circuitStats struct {
+	destinationRTT time.Duration
+	circuits       int
+}
+
+// relayScorer keeps track of the performance of relays. The round trip time to relays is
+// measured using ping, and stored in the peerstore. The latency of the circuits we open through
+// relays is reported by the circuit v2 client.
+type relayScorer struct {
+	host host.Host
+
+	mx       sync.Mutex
+	circuits map[peer.ID]*circuitStats
+}
+
+func newRelayScorer(h host.Host) *relayScorer {
+	return &relayScorer{
+		host:     h,
+		circuits: make(map[peer.ID]*circuitStats),
+	}
+}
+
+// run consumes the circuit latency measurements, until ctx is canceled.
+func (s *relayScorer) run(ctx context.Context) {
+	sub, err := s.host.EventBus().Subscribe(new(event.EvtCircuitLatencyMeasured), eventbus.Name("autorelay (relay scorer)"))
+	if err != nil {
+		log.Error("failed to subscribe to the EvtCircuitLatencyMeasured")
+		return
+	}
+	defer sub.Close()
+
+	for {
+		select {
+		case e, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			s.observeCircuit(e.(event.EvtCircuitLatencyMeasured))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *relayScorer) observeCircuit(evt event.EvtCircuitLatencyMeasured) {
+	if evt.DestinationRTT == 0 {
+		// we don't know the round trip time to the relay, so we can't tell the legs apart
+		return
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	cs, ok := s.circuits[evt.Relay]
+	if !ok {
+		if len(s.circuits) >= maxScoredRelays {
+			s.evictLocked()
+		}
+		cs = &circuitStats{destinationRTT: evt.DestinationRTT}
+		s.circuits[evt.Relay] = cs
+	} else {
+		cs.destinationRTT = time.Duration(relayScoreEWMASmoothing*float64(evt.DestinationRTT) +
+			(1-relayScoreEWMASmoothing)*float64(cs.destinationRTT))
+	}
+	cs.circuits++
+}
+
+// evictLocked removes the relay with the fewest measured circuits.
+func (s *relayScorer) evictLocked() {
+	var evict peer.ID
+	min := -1
+	for p, cs := range s.circuits {
+		if min == -1 || cs.circuits < min {
+			evict, min = p, cs.circuits
+		}
+	}
+	delete(s.circuits, evict)
+}
+
+// measureRTT measures the round trip time to the relay. The result is recorded in the peerstore.
+func (s *relayScorer) measureRTT(ctx context.Context, p peer.ID) {
+	ctx, cancel := context.WithTimeout(ctx, relayPingTimeout)
+	defer cancel()
+	res := <-ping.Ping(ctx, s.host, p)
+	if res.Error != nil {
+		log.Debugw("failed to measure the round trip time to the relay", "peer", p, "error", res.Error)
+	}
+}
+
+func (s *relayScorer) score(p peer.ID) RelayScore {
+	score := RelayScore{Relay: p, RTT: s.host.Peerstore().LatencyEWMA(p)}
+	s.mx.Lock()
+	if cs, ok := s.circuits[p]; ok {
+		score.DestinationRTT = cs.destinationRTT
+		score.Circuits = cs.circuits
+	}
+	s.mx.Unlock()
+	return score
+}
+
+// sortCandidates sorts the candidates by the expected latency of circuits through them, lowest first.
+// Candidates with an unknown latency are sorted last, in their original order.
+func (s *relayScorer) sortCandidates(candidates []*candidate) {
+	latencies := make(map[peer.ID]time.Duration, len(candidates))
+	for _, c := range candidates {
+		latencies[c.ai.ID] = s.score(c.ai.ID).Latency()
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		li, lj := latencies[candidates[i].ai.ID], latencies[candidates[j].ai.ID]
+		if li == 0 || lj == 0 {
+			return lj == 0 && li != 0
+		}
+		return li < lj
+	})
+}
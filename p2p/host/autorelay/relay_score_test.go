@@ -0,0 +1,49 @@
+package autorelay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/host/blank"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelayScoreLatency(t *testing.T) {
+	require.Zero(t, RelayScore{DestinationRTT: time.Second}.Latency())
+	require.Equal(t, 3*time.Second, RelayScore{RTT: time.Second, DestinationRTT: 2 * time.Second}.Latency())
+}
+
+func TestRelayScorer(t *testing.T) {
+	h := blankhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h.Close()
+	s := newRelayScorer(h)
+
+	fast, slow, unknown := peer.ID("fast"), peer.ID("slow"), peer.ID("unknown")
+	h.Peerstore().RecordLatency(fast, 10*time.Millisecond)
+	h.Peerstore().RecordLatency(slow, 10*time.Millisecond)
+
+	// measurements without a known relay RTT are ignored
+	s.observeCircuit(event.EvtCircuitLatencyMeasured{Relay: unknown, CircuitRTT: time.Second})
+	require.Zero(t, s.score(unknown).Circuits)
+
+	s.observeCircuit(event.EvtCircuitLatencyMeasured{Relay: fast, DestinationRTT: 20 * time.Millisecond})
+	s.observeCircuit(event.EvtCircuitLatencyMeasured{Relay: slow, DestinationRTT: 500 * time.Millisecond})
+	s.observeCircuit(event.EvtCircuitLatencyMeasured{Relay: slow, DestinationRTT: 500 * time.Millisecond})
+
+	score := s.score(slow)
+	require.Equal(t, 2, score.Circuits)
+	require.Equal(t, 500*time.Millisecond, score.DestinationRTT)
+	require.Equal(t, 510*time.Millisecond, score.Latency())
+
+	cands := []*candidate{
+		{ai: peer.AddrInfo{ID: unknown}},
+		{ai: peer.AddrInfo{ID: slow}},
+		{ai: peer.AddrInfo{ID: fast}},
+	}
+	s.sortCandidates(cands)
+	require.Equal(t, []peer.ID{fast, slow, unknown}, []peer.ID{cands[0].ai.ID, cands[1].ai.ID, cands[2].ai.ID})
+}
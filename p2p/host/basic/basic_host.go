@@ -21,29 +21,45 @@ import (
 	"github.com/libp2p/go-libp2p/core/transport"
 	"github.com/libp2p/go-libp2p/p2p/host/autonat"
 	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	"github.com/libp2p/go-libp2p/p2p/host/health"
 	"github.com/libp2p/go-libp2p/p2p/host/pstoremanager"
 	"github.com/libp2p/go-libp2p/p2p/host/relaysvc"
+	"github.com/libp2p/go-libp2p/p2p/host/scoped"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2"
 	relayv2 "github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/relay"
 	"github.com/libp2p/go-libp2p/p2p/protocol/holepunch"
 	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
 	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	"github.com/libp2p/go-libp2p/p2p/tracinghelper"
 	libp2pwebtransport "github.com/libp2p/go-libp2p/p2p/transport/webtransport"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/libp2p/go-netroute"
 
+	lru "github.com/hashicorp/golang-lru/v2"
+
 	logging "github.com/ipfs/go-log/v2"
 	ma "github.com/multiformats/go-multiaddr"
 	madns "github.com/multiformats/go-multiaddr-dns"
 	manet "github.com/multiformats/go-multiaddr/net"
 	msmux "github.com/multiformats/go-multistream"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracerName is the name of the OpenTelemetry tracer of the host.
+const tracerName = "github.com/libp2p/go-libp2p/p2p/host/basic"
+
 // addrChangeTickrInterval is the interval between two address change ticks.
 var addrChangeTickrInterval = 5 * time.Second
 
 var log = logging.Logger("basichost")
 
+// maxRejectedProtocols is the maximum number of protocols rejected by peers that are remembered,
+// to avoid optimistically proposing them again.
+const maxRejectedProtocols = 1024
+
 var (
 	// DefaultNegotiationTimeout is the default value for HostOpts.NegotiationTimeout.
 	DefaultNegotiationTimeout = 10 * time.Second
@@ -80,11 +96,19 @@ type BasicHost struct {
 	cmgr         connmgr.ConnManager
 	eventbus     event.Bus
 	relayManager *relaysvc.RelayManager
+	health       *health.Monitor
 
 	AddrsFactory AddrsFactory
 
 	negtimeout time.Duration
 
+	optimisticNegotiation bool
+	// rejectedProtocols are the protocols that peers rejected when we optimistically proposed them.
+	// Streams for these protocols are negotiated before sending data, until negotiating them succeeds.
+	rejectedProtocols *lru.Cache[peerProtocol, struct{}]
+
+	ip6LinkLocal bool
+
 	emitters struct {
 		evtLocalProtocolsUpdated event.Emitter
 		evtLocalAddrsUpdated     event.Emitter
@@ -100,10 +124,23 @@ type BasicHost struct {
 	signKey                 crypto.PrivKey
 	caBook                  peerstore.CertifiedAddrBook
 
-	autoNat autonat.AutoNAT
+	autoNat   autonat.AutoNAT
+	autoNATv2 *autonatv2.AutoNAT
+
+	dialFailures dialFailures
+
+	protocolStats *protocolStats
+
+	msgLimitsMx sync.RWMutex
+	msgLimits   map[protocol.ID]host.MessageSizeLimit
+
+	tracer trace.Tracer
 }
 
 var _ host.Host = (*BasicHost)(nil)
+var _ host.ProtocolStatsTracker = (*BasicHost)(nil)
+var _ host.MessageSizeLimiter = (*BasicHost)(nil)
+var _ host.BatchConnector = (*BasicHost)(nil)
 
 // HostOpts holds options that can be passed to NewHost in order to
 // customize construction of the *BasicHost.
@@ -119,6 +156,14 @@ type HostOpts struct {
 	// If below 0, timeouts on streams will be deactivated.
 	NegotiationTimeout time.Duration
 
+	// EnableOptimisticNegotiation enables optimistic protocol negotiation on outbound streams
+	// opened for a single protocol, even if we don't know yet if the peer supports that protocol.
+	// The protocol proposal is sent together with the first application data, saving a round trip.
+	// If the peer rejects the protocol, reading from the stream fails with a multistream.ErrNotSupported
+	// error, and subsequent streams for this protocol to this peer negotiate the protocol before sending
+	// any data, until the peer accepts it.
+	EnableOptimisticNegotiation bool
+
 	// AddrsFactory holds a function which can be used to override or filter the result of Addrs.
 	// If omitted, there's no override or filtering, and the results of Addrs and AllAddrs are the same.
 	AddrsFactory AddrsFactory
@@ -148,9 +193,16 @@ type HostOpts struct {
 	// ProtocolVersion sets the protocol version for the host.
 	ProtocolVersion string
 
+	// IdentifyRefreshInterval is the interval after which identify runs again on a connection.
+	// If 0, connections are only identified once (and updated by Identify Push).
+	IdentifyRefreshInterval time.Duration
+
 	// DisableSignedPeerRecord disables the generation of Signed Peer Records on this host.
 	DisableSignedPeerRecord bool
 
+	// EnableNATFingerprinting enables the collection of anonymized NAT behavior observations by identify.
+	EnableNATFingerprinting bool
+
 	// EnableHolePunching enables the peer to initiate/respond to hole punching attempts for NAT traversal.
 	EnableHolePunching bool
 	// HolePunchingOptions are options for the hole punching service
@@ -160,6 +212,23 @@ type HostOpts struct {
 	EnableMetrics bool
 	// PrometheusRegisterer is the PrometheusRegisterer used for metrics
 	PrometheusRegisterer prometheus.Registerer
+
+	// TracerProvider records OpenTelemetry spans for the protocol negotiation of streams.
+	// Tracing is disabled if it is nil.
+	TracerProvider trace.TracerProvider
+
+	// HealthMonitor computes the aggregate health score of the host.
+	// It is started when the host is started, and closed when the host is closed.
+	HealthMonitor *health.Monitor
+
+	// EnableIP6LinkLocal advertises the IPv6 link-local addresses of our interfaces when listening
+	// on an unspecified IPv6 address. The swarm needs to be configured to dial link-local addresses
+	// as well, see swarm.WithIP6LinkLocal.
+	EnableIP6LinkLocal bool
+
+	// PeerstoreUnconnectedTTL enables pruning of the peerstore: the addresses of peers we're not
+	// connected to are removed after this time. See pstoremanager.WithUnconnectedPeerTTL.
+	PeerstoreUnconnectedTTL time.Duration
 }
 
 // NewHost constructs a new *BasicHost and activates it by attaching its stream and connection handlers to the given inet.Network.
@@ -171,7 +240,14 @@ func NewHost(n network.Network, opts *HostOpts) (*BasicHost, error) {
 		opts.EventBus = eventbus.NewBus()
 	}
 
-	psManager, err := pstoremanager.NewPeerstoreManager(n.Peerstore(), opts.EventBus)
+	var psOpts []pstoremanager.Option
+	if opts.ConnManager != nil {
+		psOpts = append(psOpts, pstoremanager.WithConnManager(opts.ConnManager))
+	}
+	if opts.PeerstoreUnconnectedTTL > 0 {
+		psOpts = append(psOpts, pstoremanager.WithUnconnectedPeerTTL(opts.PeerstoreUnconnectedTTL))
+	}
+	psManager, err := pstoremanager.NewPeerstoreManager(n.Peerstore(), opts.EventBus, psOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -189,6 +265,19 @@ func NewHost(n network.Network, opts *HostOpts) (*BasicHost, error) {
 		ctx:                     hostCtx,
 		ctxCancel:               cancel,
 		disableSignedPeerRecord: opts.DisableSignedPeerRecord,
+		optimisticNegotiation:   opts.EnableOptimisticNegotiation,
+		health:                  opts.HealthMonitor,
+		ip6LinkLocal:            opts.EnableIP6LinkLocal,
+		protocolStats:           newProtocolStats(),
+		msgLimits:               make(map[protocol.ID]host.MessageSizeLimit),
+		tracer:                  tracinghelper.Tracer(opts.TracerProvider, tracerName),
+	}
+
+	if h.optimisticNegotiation {
+		h.rejectedProtocols, err = lru.New[peerProtocol, struct{}](maxRejectedProtocols)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	h.updateLocalIpAddr()
@@ -239,6 +328,12 @@ func NewHost(n network.Network, opts *HostOpts) (*BasicHost, error) {
 	if h.disableSignedPeerRecord {
 		idOpts = append(idOpts, identify.DisableSignedPeerRecord())
 	}
+	if opts.EnableNATFingerprinting {
+		idOpts = append(idOpts, identify.EnableNATFingerprinting())
+	}
+	if opts.IdentifyRefreshInterval > 0 {
+		idOpts = append(idOpts, identify.WithRefreshInterval(opts.IdentifyRefreshInterval))
+	}
 	if opts.EnableMetrics {
 		idOpts = append(idOpts,
 			identify.WithMetricsTracer(
@@ -284,6 +379,16 @@ func NewHost(n network.Network, opts *HostOpts) (*BasicHost, error) {
 	} else {
 		h.cmgr = opts.ConnManager
 		n.Notify(h.cmgr.Notifee())
+		// Connection managers may emit events, e.g. when reacting to resource pressure.
+		if cm, ok := h.cmgr.(interface{ SetEventBus(event.Bus) error }); ok {
+			if err := cm.SetEventBus(h.eventbus); err != nil {
+				return nil, err
+			}
+		}
+		// Connection managers may need to know which protocols peers support.
+		if cm, ok := h.cmgr.(interface{ SetProtoBook(peerstore.ProtoBook) }); ok {
+			cm.SetProtoBook(h.Peerstore())
+		}
 	}
 
 	if opts.EnableRelayService {
@@ -311,6 +416,11 @@ func NewHost(n network.Network, opts *HostOpts) (*BasicHost, error) {
 	n.Notify(&network.NotifyBundle{
 		ListenF:      listenHandler,
 		ListenCloseF: listenHandler,
+		DisconnectedF: func(n network.Network, c network.Conn) {
+			if n.Connectedness(c.RemotePeer()) != network.Connected {
+				h.protocolStats.removePeer(c.RemotePeer())
+			}
+		},
 	})
 
 	return h, nil
@@ -362,8 +472,8 @@ func (h *BasicHost) updateLocalIpAddr() {
 	}
 
 	for _, addr := range ifaceAddrs {
-		// Skip link-local addrs, they're mostly useless.
-		if !manet.IsIP6LinkLocal(addr) {
+		// Skip link-local addrs, they're mostly useless, unless we're explicitly using them.
+		if h.ip6LinkLocal || !manet.IsIP6LinkLocal(addr) {
 			h.allInterfaceAddrs = append(h.allInterfaceAddrs, addr)
 		}
 	}
@@ -374,10 +484,10 @@ func (h *BasicHost) updateLocalIpAddr() {
 		// Add all addresses.
 		h.filteredInterfaceAddrs = h.allInterfaceAddrs
 	} else {
-		// Only add loopback addresses. Filter these because we might
-		// not _have_ an IPv6 loopback address.
+		// Only add loopback addresses (and link-local addresses, if enabled).
+		// Filter these because we might not _have_ an IPv6 loopback address.
 		for _, addr := range h.allInterfaceAddrs {
-			if manet.IsIPLoopback(addr) {
+			if manet.IsIPLoopback(addr) || manet.IsIP6LinkLocal(addr) {
 				h.filteredInterfaceAddrs = append(h.filteredInterfaceAddrs, addr)
 			}
 		}
@@ -389,19 +499,46 @@ func (h *BasicHost) Start() {
 	h.psManager.Start()
 	h.refCount.Add(1)
 	h.ids.Start()
+	if h.health != nil {
+		if err := h.health.Start(h); err != nil {
+			log.Errorf("failed to start health monitor: %s", err)
+		}
+	}
+	if an := h.GetAutoNATv2(); an != nil {
+		if err := an.Start(); err != nil {
+			log.Errorf("failed to start autonat v2: %s", err)
+		}
+	}
 	go h.background()
 }
 
 // newStreamHandler is the remote-opened stream handler for network.Network
 // TODO: this feels a bit wonky
 func (h *BasicHost) newStreamHandler(s network.Stream) {
+	_, span := h.tracer.Start(context.Background(), "host.negotiateProtocol", trace.WithAttributes(
+		attribute.Stringer("peer.id", s.Conn().RemotePeer()),
+		attribute.Stringer("direction", network.DirInbound),
+	))
+	protoID, handle, err := h.negotiateProtocol(s)
+	if err == nil {
+		span.SetAttributes(attribute.String("protocol", string(protoID)))
+	}
+	tracinghelper.EndSpan(span, err)
+	if err != nil {
+		s.Reset()
+		return
+	}
+	go handle(protoID, h.wrapStream(s, network.DirInbound))
+}
+
+// negotiateProtocol negotiates the protocol of the inbound stream s, and sets it on s.
+func (h *BasicHost) negotiateProtocol(s network.Stream) (protocol.ID, protocol.HandlerFunc, error) {
 	before := time.Now()
 
 	if h.negtimeout > 0 {
 		if err := s.SetDeadline(time.Now().Add(h.negtimeout)); err != nil {
 			log.Debug("setting stream deadline: ", err)
-			s.Reset()
-			return
+			return "", nil, err
 		}
 	}
 
@@ -417,27 +554,23 @@ func (h *BasicHost) newStreamHandler(s network.Stream) {
 		} else {
 			log.Debugf("protocol mux failed: %s (took %s)", err, took)
 		}
-		s.Reset()
-		return
+		return "", nil, err
 	}
 
 	if h.negtimeout > 0 {
 		if err := s.SetDeadline(time.Time{}); err != nil {
 			log.Debugf("resetting stream deadline: ", err)
-			s.Reset()
-			return
+			return "", nil, err
 		}
 	}
 
 	if err := s.SetProtocol(protoID); err != nil {
 		log.Debugf("error setting stream protocol: %s", err)
-		s.Reset()
-		return
+		return "", nil, err
 	}
 
 	log.Debugf("negotiated: %s (took %s)", protoID, took)
-
-	go handle(protoID, s)
+	return protoID, handle, nil
 }
 
 // SignalAddressChange signals to the host that it needs to determine whether our listen addresses have recently
@@ -499,6 +632,18 @@ func (h *BasicHost) background() {
 	defer h.refCount.Done()
 	var lastAddrs []ma.Multiaddr
 
+	// AutoNAT v2 determines which addresses are unreachable, and thereby which addresses we announce.
+	var reachableAddrsChanged <-chan interface{}
+	if h.GetAutoNATv2() != nil {
+		sub, err := h.eventbus.Subscribe(new(event.EvtHostReachableAddrsChanged), eventbus.Name("basic host"))
+		if err != nil {
+			log.Errorf("failed to subscribe to reachable addrs changes: %s", err)
+		} else {
+			defer sub.Close()
+			reachableAddrsChanged = sub.Out()
+		}
+	}
+
 	emitAddrChange := func(currentAddrs []ma.Multiaddr, lastAddrs []ma.Multiaddr) {
 		// nothing to do if both are nil..defensive check
 		if currentAddrs == nil && lastAddrs == nil {
@@ -551,6 +696,7 @@ func (h *BasicHost) background() {
 		select {
 		case <-ticker.C:
 		case <-h.addrChangeChan:
+		case <-reachableAddrsChanged:
 		case <-h.ctx.Done():
 			return
 		}
@@ -593,6 +739,11 @@ func (h *BasicHost) EventBus() event.Bus {
 //
 // (Thread-safe)
 func (h *BasicHost) SetStreamHandler(pid protocol.ID, handler network.StreamHandler) {
+	h.setMessageSizeLimit(pid, host.MessageSizeLimit{})
+	h.addStreamHandler(pid, handler)
+}
+
+func (h *BasicHost) addStreamHandler(pid protocol.ID, handler network.StreamHandler) {
 	h.Mux().AddHandler(pid, func(p protocol.ID, rwc io.ReadWriteCloser) error {
 		is := rwc.(network.Stream)
 		handler(is)
@@ -606,6 +757,7 @@ func (h *BasicHost) SetStreamHandler(pid protocol.ID, handler network.StreamHand
 // SetStreamHandlerMatch sets the protocol handler on the Host's Mux
 // using a matching function to do protocol comparisons
 func (h *BasicHost) SetStreamHandlerMatch(pid protocol.ID, m func(protocol.ID) bool, handler network.StreamHandler) {
+	h.setMessageSizeLimit(pid, host.MessageSizeLimit{})
 	h.Mux().AddHandlerWithFunc(pid, m, func(p protocol.ID, rwc io.ReadWriteCloser) error {
 		is := rwc.(network.Stream)
 		handler(is)
@@ -616,8 +768,27 @@ func (h *BasicHost) SetStreamHandlerMatch(pid protocol.ID, m func(protocol.ID) b
 	})
 }
 
+// SetStreamHandlerWithLimit sets the protocol handler on the Host's Mux, like SetStreamHandler.
+// limit is enforced on all streams of protocol pid, both inbound and outbound.
+// Streams on which the remote peer exceeds the limit are reset.
+func (h *BasicHost) SetStreamHandlerWithLimit(pid protocol.ID, limit host.MessageSizeLimit, handler network.StreamHandler) {
+	h.setMessageSizeLimit(pid, limit)
+	h.addStreamHandler(pid, handler)
+}
+
+func (h *BasicHost) setMessageSizeLimit(pid protocol.ID, limit host.MessageSizeLimit) {
+	h.msgLimitsMx.Lock()
+	defer h.msgLimitsMx.Unlock()
+	if limit.MaxSize == 0 {
+		delete(h.msgLimits, pid)
+		return
+	}
+	h.msgLimits[pid] = limit
+}
+
 // RemoveStreamHandler returns ..
 func (h *BasicHost) RemoveStreamHandler(pid protocol.ID) {
+	h.setMessageSizeLimit(pid, host.MessageSizeLimit{})
 	h.Mux().RemoveHandler(pid)
 	h.emitters.evtLocalProtocolsUpdated.Emit(event.EvtLocalProtocolsUpdated{
 		Removed: []protocol.ID{pid},
@@ -629,6 +800,35 @@ func (h *BasicHost) RemoveStreamHandler(pid protocol.ID) {
 // to create one. If ProtocolID is "", writes no header.
 // (Thread-safe)
 func (h *BasicHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (network.Stream, error) {
+	ctx, span := h.tracer.Start(ctx, "host.NewStream", trace.WithAttributes(
+		attribute.Stringer("peer.id", p),
+		attribute.StringSlice("protocols", protocol.ConvertToStrings(pids)),
+	))
+	s, err := h.newStream(ctx, p, pids...)
+	if err == nil {
+		span.SetAttributes(attribute.String("protocol", string(s.Protocol())))
+	}
+	tracinghelper.EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return h.wrapStream(s, network.DirOutbound), nil
+}
+
+// wrapStream wraps a stream whose protocol has been set, to track its usage and to enforce
+// the message size limit of its protocol.
+func (h *BasicHost) wrapStream(s network.Stream, dir network.Direction) network.Stream {
+	s = h.protocolStats.wrapStream(s, dir)
+	h.msgLimitsMx.RLock()
+	limit, ok := h.msgLimits[s.Protocol()]
+	h.msgLimitsMx.RUnlock()
+	if !ok {
+		return s
+	}
+	return host.LimitStream(s, limit)
+}
+
+func (h *BasicHost) newStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (network.Stream, error) {
 	// If the caller wants to prevent the host from dialing, it should use the NoDial option.
 	if nodial, _ := network.GetNoDial(ctx); !nodial {
 		err := h.Connect(ctx, peer.AddrInfo{ID: p})
@@ -665,12 +865,36 @@ func (h *BasicHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.I
 		return nil, err
 	}
 
+	// We don't know if the peer supports the protocol, but if we only have a single protocol
+	// to offer, there's no point in negotiating before sending data: the only alternative is failure.
+	// Unless the peer already rejected the protocol: then it probably will again, and failing when
+	// opening the stream is better than failing after sending data.
+	optimistic := pref == "" && h.optimisticNegotiation && len(pids) == 1 &&
+		!h.rejectedProtocols.Contains(peerProtocol{p, pids[0]})
+	if optimistic {
+		pref = pids[0]
+	}
+
 	if pref != "" {
 		s.SetProtocol(pref)
 		lzcon := msmux.NewMSSelect(s, pref)
 		return &streamWrapper{
 			Stream: s,
 			rw:     lzcon,
+			negotiated: func(err error) {
+				var errNotSupported msmux.ErrNotSupported[protocol.ID]
+				switch {
+				case errors.As(err, &errNotSupported):
+					// Our information about the peer's protocols is outdated (or we guessed wrong).
+					// Make sure we negotiate the protocol on the next stream.
+					h.Peerstore().RemoveProtocols(p, pref)
+					if h.optimisticNegotiation {
+						h.rejectedProtocols.Add(peerProtocol{p, pref}, struct{}{})
+					}
+				case err == nil && optimistic:
+					h.Peerstore().AddProtocols(p, pref)
+				}
+			},
 		}, nil
 	}
 
@@ -696,6 +920,9 @@ func (h *BasicHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.I
 
 	s.SetProtocol(selected)
 	h.Peerstore().AddProtocols(p, selected)
+	if h.optimisticNegotiation {
+		h.rejectedProtocols.Remove(peerProtocol{p, selected})
+	}
 	return s, nil
 }
 
@@ -722,7 +949,8 @@ func (h *BasicHost) Connect(ctx context.Context, pi peer.AddrInfo) error {
 	h.Peerstore().AddAddrs(pi.ID, pi.Addrs, peerstore.TempAddrTTL)
 
 	forceDirect, _ := network.GetForceDirectDial(ctx)
-	if !forceDirect {
+	_, _, additionalConn := network.GetAdditionalConnection(ctx)
+	if !forceDirect && !additionalConn {
 		if h.Network().Connectedness(pi.ID) == network.Connected {
 			return nil
 		}
@@ -731,12 +959,60 @@ func (h *BasicHost) Connect(ctx context.Context, pi peer.AddrInfo) error {
 	return h.dialPeer(ctx, pi.ID)
 }
 
+// ConnectMany connects to all peers in pis. See host.BatchConnector for details.
+//
+// Peers that aren't connected yet, and whose addresses are all in dial backoff, aren't dialed,
+// and are reported with an error wrapping swarm.ErrDialBackoff.
+func (h *BasicHost) ConnectMany(ctx context.Context, pis []peer.AddrInfo, opts ...host.ConnectManyOption) <-chan host.ConnectResult {
+	// invalid options are reported by RunConnectMany
+	o, _ := host.ParseConnectManyOptions(opts...)
+	return host.RunConnectMany(ctx, pis, func(ctx context.Context, pi peer.AddrInfo) error {
+		if h.inDialBackoff(ctx, pi) {
+			return fmt.Errorf("failed to dial %s: %w", pi.ID, swarm.ErrDialBackoff)
+		}
+		if err := h.Connect(ctx, pi); err != nil {
+			return err
+		}
+		o.ManageConnectedPeer(h.ConnManager(), pi.ID)
+		return nil
+	}, opts...)
+}
+
+// inDialBackoff returns true if we're not connected to pi, and all its known addresses are
+// in dial backoff.
+func (h *BasicHost) inDialBackoff(ctx context.Context, pi peer.AddrInfo) bool {
+	b, ok := h.Network().(interface{ Backoff() *swarm.DialBackoff })
+	if !ok {
+		return false
+	}
+	if forceDirect, _ := network.GetForceDirectDial(ctx); forceDirect {
+		return false
+	}
+	if _, _, ok := network.GetAdditionalConnection(ctx); ok {
+		return false
+	}
+	if h.Network().Connectedness(pi.ID) == network.Connected {
+		return false
+	}
+	addrs := append(h.Peerstore().Addrs(pi.ID), pi.Addrs...)
+	if len(addrs) == 0 {
+		return false
+	}
+	for _, a := range addrs {
+		if !b.Backoff().Backoff(pi.ID, a) {
+			return false
+		}
+	}
+	return true
+}
+
 // dialPeer opens a connection to peer, and makes sure to identify
 // the connection once it has been opened.
 func (h *BasicHost) dialPeer(ctx context.Context, p peer.ID) error {
 	log.Debugf("host %s dialing %s", h.ID(), p)
 	c, err := h.Network().DialPeer(ctx, p)
 	if err != nil {
+		h.dialFailures.add(p, err)
 		return fmt.Errorf("failed to dial: %w", err)
 	}
 
@@ -773,6 +1049,9 @@ func (h *BasicHost) Addrs() []ma.Multiaddr {
 	}
 
 	addrs := h.AddrsFactory(h.AllAddrs())
+	if an := h.GetAutoNATv2(); an != nil {
+		addrs = removeUnreachableAddrs(an, addrs)
+	}
 
 	s, ok := h.Network().(transportForListeninger)
 	if !ok {
@@ -802,6 +1081,18 @@ func (h *BasicHost) Addrs() []ma.Multiaddr {
 	return addrs
 }
 
+// removeUnreachableAddrs removes the addresses that AutoNAT v2 determined to be unreachable.
+func removeUnreachableAddrs(an *autonatv2.AutoNAT, addrs []ma.Multiaddr) []ma.Multiaddr {
+	out := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		if an.Reachability(a) == network.ReachabilityPrivate {
+			continue
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
 // NormalizeMultiaddr returns a multiaddr suitable for equality checks.
 // If the multiaddr is a webtransport component, it removes the certhashes.
 func (h *BasicHost) NormalizeMultiaddr(addr ma.Multiaddr) ma.Multiaddr {
@@ -858,7 +1149,8 @@ func (h *BasicHost) AllAddrs() []ma.Multiaddr {
 				// Add in the mapped addr.
 				finalAddrs = append(finalAddrs, extMaddr)
 			} else {
-				log.Warn("NAT device reported an unspecified IP as it's external address")
+				// This is expected for static port forwardings without a configured external IP.
+				log.Debug("NAT device reported an unspecified IP as it's external address")
 			}
 
 			// Did the router give us a routable public addr?
@@ -908,12 +1200,25 @@ func (h *BasicHost) AllAddrs() []ma.Multiaddr {
 		}
 		finalAddrs = append(finalAddrs, observedAddrs...)
 	}
+	// Zones only have a meaning on our host, don't advertise them.
+	for i, addr := range finalAddrs {
+		finalAddrs[i] = stripIP6Zone(addr)
+	}
 	finalAddrs = ma.Unique(finalAddrs)
 	finalAddrs = inferWebtransportAddrsFromQuic(finalAddrs)
 
 	return finalAddrs
 }
 
+// stripIP6Zone removes a leading /ip6zone component from addr.
+func stripIP6Zone(addr ma.Multiaddr) ma.Multiaddr {
+	first, rest := ma.SplitFirst(addr)
+	if first == nil || first.Protocol().Code != ma.P_IP6ZONE || rest == nil {
+		return addr
+	}
+	return rest
+}
+
 var wtComponent = ma.StringCast("/webtransport")
 
 // inferWebtransportAddrsFromQuic infers more webtransport addresses from QUIC addresses.
@@ -1003,6 +1308,36 @@ func (h *BasicHost) GetAutoNat() autonat.AutoNAT {
 	return h.autoNat
 }
 
+// PeerProtocolStats returns the usage statistics of all protocols used with peer p.
+// Statistics are kept as long as the host is connected to p.
+func (h *BasicHost) PeerProtocolStats(p peer.ID) map[protocol.ID]host.ProtocolStats {
+	return h.protocolStats.peerStats(p)
+}
+
+// SetAutoNATv2 sets the AutoNAT v2 service for the host. The host stops announcing
+// the addresses that AutoNAT v2 determines to be unreachable.
+// It must be called before Start.
+func (h *BasicHost) SetAutoNATv2(an *autonatv2.AutoNAT) {
+	h.addrMu.Lock()
+	defer h.addrMu.Unlock()
+	if h.autoNATv2 == nil {
+		h.autoNATv2 = an
+	}
+}
+
+// GetAutoNATv2 returns the host's AutoNAT v2 service, if AutoNAT v2 is enabled.
+func (h *BasicHost) GetAutoNATv2() *autonatv2.AutoNAT {
+	h.addrMu.RLock()
+	defer h.addrMu.RUnlock()
+	return h.autoNATv2
+}
+
+// Scoped returns a restricted view of the host, which only has access to the protocols and
+// peers allowed by the given policies. See the scoped package for details.
+func (h *BasicHost) Scoped(policies ...scoped.Policy) (*scoped.Host, error) {
+	return scoped.New(h, policies...)
+}
+
 // Close shuts down the Host's services (network, etc).
 func (h *BasicHost) Close() error {
 	h.closeSync.Do(func() {
@@ -1019,12 +1354,18 @@ func (h *BasicHost) Close() error {
 		if h.autoNat != nil {
 			h.autoNat.Close()
 		}
+		if h.autoNATv2 != nil {
+			h.autoNATv2.Close()
+		}
 		if h.relayManager != nil {
 			h.relayManager.Close()
 		}
 		if h.hps != nil {
 			h.hps.Close()
 		}
+		if h.health != nil {
+			h.health.Close()
+		}
 
 		_ = h.emitters.evtLocalProtocolsUpdated.Close()
 		_ = h.emitters.evtLocalAddrsUpdated.Close()
@@ -1045,13 +1386,32 @@ func (h *BasicHost) Close() error {
 	return nil
 }
 
+// peerProtocol is a protocol of a peer.
+type peerProtocol struct {
+	p     peer.ID
+	proto protocol.ID
+}
+
 type streamWrapper struct {
 	network.Stream
 	rw io.ReadWriteCloser
+
+	// negotiated, if set, is called once with the outcome of the lazy protocol negotiation.
+	negotiated     func(error)
+	negotiatedOnce sync.Once
 }
 
 func (s *streamWrapper) Read(b []byte) (int, error) {
-	return s.rw.Read(b)
+	n, err := s.rw.Read(b)
+	if s.negotiated != nil {
+		// The lazy handshake completes on the first read. Errors other than a rejection
+		// of the protocol don't tell us anything about the outcome of the negotiation.
+		var errNotSupported msmux.ErrNotSupported[protocol.ID]
+		if err == nil || errors.As(err, &errNotSupported) {
+			s.negotiatedOnce.Do(func() { s.negotiated(err) })
+		}
+	}
+	return n, err
 }
 
 func (s *streamWrapper) Write(b []byte) (int, error) {
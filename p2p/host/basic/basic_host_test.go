@@ -2,8 +2,11 @@ package basichost
 
 import (
 	"context"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"reflect"
 	"sort"
 	"strings"
@@ -18,13 +21,18 @@ import (
 	"github.com/libp2p/go-libp2p/core/peerstore"
 	"github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/core/test"
 	"github.com/libp2p/go-libp2p/p2p/host/autonat"
 	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
 	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
 	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
 
 	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
 
+	msmux "github.com/multiformats/go-multistream"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -241,6 +249,63 @@ func TestAllAddrs(t *testing.T) {
 	require.True(t, ma.Contains(h.AllAddrs(), firstAddr), "should still contain the original addr")
 }
 
+func TestAllAddrsIP6LinkLocal(t *testing.T) {
+	ifaceAddrs, err := manet.InterfaceMultiaddrs()
+	require.NoError(t, err)
+	var linkLocal ma.Multiaddr
+	for _, a := range ifaceAddrs {
+		if manet.IsIP6LinkLocal(a) {
+			linkLocal = a
+			break
+		}
+	}
+	if linkLocal == nil {
+		t.Skip("no interface with an IPv6 link-local address")
+	}
+
+	isLinkLocal := func(addrs []ma.Multiaddr) bool {
+		for _, a := range addrs {
+			if manet.IsIP6LinkLocal(a) {
+				return true
+			}
+		}
+		return false
+	}
+
+	h, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDialOnly), nil)
+	require.NoError(t, err)
+	defer h.Close()
+	require.NoError(t, h.Network().Listen(ma.StringCast("/ip6/::/tcp/0")))
+	require.False(t, isLinkLocal(h.AllAddrs()))
+
+	h, err = NewHost(swarmt.GenSwarm(t, swarmt.OptDialOnly), &HostOpts{EnableIP6LinkLocal: true})
+	require.NoError(t, err)
+	defer h.Close()
+	require.NoError(t, h.Network().Listen(ma.StringCast("/ip6/::/tcp/0")))
+	require.True(t, isLinkLocal(h.AllAddrs()))
+
+	// zones are not advertised
+	ip, err := manet.ToIP(linkLocal)
+	require.NoError(t, err)
+	h, err = NewHost(swarmt.GenSwarm(t, swarmt.OptDialOnly), nil)
+	require.NoError(t, err)
+	defer h.Close()
+	var zone string
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err)
+	for _, iface := range ifaces {
+		addrs, _ := iface.Addrs()
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+				zone = iface.Name
+			}
+		}
+	}
+	require.NoError(t, h.Network().Listen(ma.StringCast("/ip6zone/"+zone+"/ip6/"+ip.String()+"/tcp/0")))
+	require.Len(t, h.AllAddrs(), 1)
+	require.Equal(t, "/ip6/"+ip.String(), ma.Split(h.AllAddrs()[0])[0].String())
+}
+
 // getHostPair gets a new pair of hosts.
 // The first host initiates the connection to the second host.
 func getHostPair(t *testing.T) (host.Host, host.Host) {
@@ -549,6 +614,90 @@ func TestProtoDowngrade(t *testing.T) {
 	assertWait(t, connectedOn, "/testing")
 }
 
+func TestOptimisticNegotiation(t *testing.T) {
+	h1, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), &HostOpts{EnableOptimisticNegotiation: true})
+	require.NoError(t, err)
+	h1.Start()
+	defer h1.Close()
+	h2, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), nil)
+	require.NoError(t, err)
+	h2.Start()
+	defer h2.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, h1.Connect(ctx, h2.Peerstore().PeerInfo(h2.ID())))
+
+	h2.SetStreamHandler("/echo", func(s network.Stream) {
+		defer s.Close()
+		io.Copy(s, s)
+	})
+
+	// The peer supports the protocol, and the data is sent along with the protocol proposal.
+	s, err := h1.NewStream(ctx, h2.ID(), "/echo")
+	require.NoError(t, err)
+	require.Equal(t, protocol.ID("/echo"), s.Protocol())
+	_, err = s.Write([]byte("foo"))
+	require.NoError(t, err)
+	require.NoError(t, s.CloseWrite())
+	b, err := io.ReadAll(s)
+	require.NoError(t, err)
+	require.Equal(t, "foo", string(b))
+	supported, err := h1.Peerstore().SupportsProtocols(h2.ID(), "/echo")
+	require.NoError(t, err)
+	require.Equal(t, []protocol.ID{"/echo"}, supported)
+
+	// The peer doesn't support the protocol. The stream fails once we read from it.
+	s, err = h1.NewStream(ctx, h2.ID(), "/unsupported")
+	require.NoError(t, err)
+	_, err = s.Write([]byte("foo"))
+	require.NoError(t, err)
+	_, err = s.Read(make([]byte, 1))
+	var errNotSupported msmux.ErrNotSupported[protocol.ID]
+	require.ErrorAs(t, err, &errNotSupported)
+	s.Reset()
+
+	// Once the peer stops supporting the protocol, we remove it from the peerstore, and stop being optimistic.
+	h2.RemoveStreamHandler("/echo")
+	s, err = h1.NewStream(ctx, h2.ID(), "/echo")
+	require.NoError(t, err)
+	_, err = s.Read(make([]byte, 1))
+	require.ErrorAs(t, err, &errNotSupported)
+	s.Reset()
+	supported, err = h1.Peerstore().SupportsProtocols(h2.ID(), "/echo")
+	require.NoError(t, err)
+	require.Empty(t, supported)
+
+	// The peer rejected the protocol, so the next stream negotiates it before sending any data:
+	// opening the stream fails.
+	_, err = h1.NewStream(ctx, h2.ID(), "/echo")
+	require.ErrorAs(t, err, &errNotSupported)
+	_, err = h1.NewStream(ctx, h2.ID(), "/unsupported")
+	require.ErrorAs(t, err, &errNotSupported)
+
+	// Once the peer accepts the protocol again, we're optimistic again.
+	h2.SetStreamHandler("/echo", func(s network.Stream) {
+		defer s.Close()
+		io.Copy(s, s)
+	})
+	s, err = h1.NewStream(ctx, h2.ID(), "/echo")
+	require.NoError(t, err)
+	s.Close()
+	h1.Peerstore().RemoveProtocols(h2.ID(), "/echo")
+	s, err = h1.NewStream(ctx, h2.ID(), "/echo")
+	require.NoError(t, err)
+	_, err = s.Write([]byte("foo"))
+	require.NoError(t, err)
+	require.NoError(t, s.CloseWrite())
+	b, err = io.ReadAll(s)
+	require.NoError(t, err)
+	require.Equal(t, "foo", string(b))
+
+	// With multiple protocols, the protocol is negotiated when opening the stream.
+	_, err = h1.NewStream(ctx, h2.ID(), "/unsupported", "/unsupported2")
+	require.Error(t, err)
+}
+
 func TestAddrChangeImmediatelyIfAddressNonEmpty(t *testing.T) {
 	ctx := context.Background()
 	taddrs := []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/1234")}
@@ -896,3 +1045,323 @@ func TestInferWebtransportAddrsFromQuic(t *testing.T) {
 	}
 
 }
+
+func TestListenCloseWithdrawsAddrs(t *testing.T) {
+	h1, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), nil)
+	require.NoError(t, err)
+	defer h1.Close()
+	h1.Start()
+	h2, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), nil)
+	require.NoError(t, err)
+	defer h2.Close()
+	h2.Start()
+
+	listenAddrs := h1.Network().ListenAddresses()
+	require.NoError(t, h1.Network().Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0")))
+	var closed ma.Multiaddr
+	for _, a := range h1.Network().ListenAddresses() {
+		if !ma.Contains(listenAddrs, a) {
+			closed = a
+		}
+	}
+	require.NotNil(t, closed)
+	require.NoError(t, h2.Connect(context.Background(), peer.AddrInfo{ID: h1.ID(), Addrs: listenAddrs}))
+	require.Eventually(t, func() bool {
+		return ma.Contains(h2.Peerstore().Addrs(h1.ID()), closed)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	h1.Network().(*swarm.Swarm).ListenClose(closed)
+	require.Eventually(t, func() bool {
+		return !ma.Contains(h1.Addrs(), closed) && !ma.Contains(h2.Peerstore().Addrs(h1.ID()), closed)
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, network.Connected, h2.Network().Connectedness(h1.ID()))
+}
+
+func TestConnectMany(t *testing.T) {
+	h, err := NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	defer h.Close()
+	h.Start()
+
+	var pis []peer.AddrInfo
+	for i := 0; i < 5; i++ {
+		other, err := NewHost(swarmt.GenSwarm(t), nil)
+		require.NoError(t, err)
+		defer other.Close()
+		other.Start()
+		pis = append(pis, peer.AddrInfo{ID: other.ID(), Addrs: other.Addrs()})
+	}
+	// duplicate entries are only dialed once
+	pis = append(pis, pis[0])
+
+	// a peer whose addresses are all in dial backoff isn't dialed
+	backedOff := peer.AddrInfo{
+		ID:    "QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSoooo4",
+		Addrs: []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/1234")},
+	}
+	h.Network().(*swarm.Swarm).Backoff().AddBackoff(backedOff.ID, backedOff.Addrs[0])
+	pis = append(pis, backedOff)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	results := make(map[peer.ID]error)
+	for res := range h.ConnectMany(ctx, pis, host.WithConnectConcurrency(2)) {
+		_, ok := results[res.ID]
+		require.False(t, ok, "duplicate result for %s", res.ID)
+		results[res.ID] = res.Err
+	}
+	require.Len(t, results, 6)
+	for _, pi := range pis[:5] {
+		require.NoError(t, results[pi.ID])
+		require.Equal(t, network.Connected, h.Network().Connectedness(pi.ID))
+	}
+	require.ErrorIs(t, results[backedOff.ID], swarm.ErrDialBackoff)
+}
+
+func TestConnectManyConnManager(t *testing.T) {
+	cm, err := connmgr.NewConnManager(10, 20)
+	require.NoError(t, err)
+	defer cm.Close()
+	h, err := NewHost(swarmt.GenSwarm(t), &HostOpts{ConnManager: cm})
+	require.NoError(t, err)
+	defer h.Close()
+	h.Start()
+
+	var pis []peer.AddrInfo
+	for i := 0; i < 2; i++ {
+		other, err := NewHost(swarmt.GenSwarm(t), nil)
+		require.NoError(t, err)
+		defer other.Close()
+		other.Start()
+		pis = append(pis, peer.AddrInfo{ID: other.ID(), Addrs: other.Addrs()})
+	}
+	unreachable := peer.AddrInfo{
+		ID:    "QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSoooo4",
+		Addrs: []ma.Multiaddr{ma.StringCast("/ip4/127.0.0.1/tcp/1")},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for res := range h.ConnectMany(ctx, append(pis, unreachable), host.WithConnectTag("batch", 42), host.WithConnectProtection("batch")) {
+		if res.ID == unreachable.ID {
+			require.Error(t, res.Err)
+			continue
+		}
+		require.NoError(t, res.Err)
+	}
+	for _, pi := range pis {
+		require.True(t, cm.IsProtected(pi.ID, "batch"))
+		require.Equal(t, 42, cm.GetTagInfo(pi.ID).Tags["batch"])
+	}
+	// peers we didn't connect to aren't tagged or protected
+	require.False(t, cm.IsProtected(unreachable.ID, "batch"))
+	require.Nil(t, cm.GetTagInfo(unreachable.ID))
+
+	_, err = host.ParseConnectManyOptions(host.WithConnectTag("", 1))
+	require.Error(t, err)
+	_, err = host.ParseConnectManyOptions(host.WithConnectProtection(""))
+	require.Error(t, err)
+}
+
+func TestConnectManyCanceled(t *testing.T) {
+	h, err := NewHost(swarmt.GenSwarm(t), nil)
+	require.NoError(t, err)
+	defer h.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pis := []peer.AddrInfo{{ID: "QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSoooo4"}, {ID: "QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSoooo5"}}
+	var n int
+	for res := range host.ConnectMany(ctx, h, pis) {
+		require.Error(t, res.Err)
+		n++
+	}
+	require.Equal(t, 2, n)
+
+	_, err = host.ParseConnectManyOptions(host.WithConnectConcurrency(0))
+	require.Error(t, err)
+}
+
+func TestDiagnostics(t *testing.T) {
+	relayAddr := ma.StringCast("/ip4/1.2.3.4/tcp/1234/p2p/QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSoooo4/p2p-circuit")
+	h, err := NewHost(swarmt.GenSwarm(t), &HostOpts{
+		AddrsFactory: func(addrs []ma.Multiaddr) []ma.Multiaddr {
+			return append(ma.FilterAddrs(addrs, func(a ma.Multiaddr) bool {
+				_, err := a.ValueForProtocol(ma.P_TCP)
+				return err == nil
+			}), relayAddr)
+		},
+	})
+	require.NoError(t, err)
+	defer h.Close()
+	h.Start()
+
+	// dial a peer that isn't listening
+	unreachable := peer.AddrInfo{
+		ID:    test.RandPeerIDFatal(t),
+		Addrs: []ma.Multiaddr{ma.StringCast("/ip4/127.0.0.1/tcp/1")},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.Error(t, h.Connect(ctx, unreachable))
+
+	d, err := h.Diagnostics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, h.ID(), d.PeerID)
+	require.NotEmpty(t, d.ListenAddrs)
+	require.NotEmpty(t, d.FilteredAddrs, "non-TCP addresses should have been filtered")
+	require.Equal(t, network.ReachabilityUnknown.String(), d.Reachability)
+	require.False(t, d.NAT.Enabled)
+
+	var sawListen bool
+	for _, a := range d.AdvertisedAddrs {
+		if a.Addr == relayAddr.String() {
+			require.Equal(t, []string{AddrReasonRelay}, a.Reasons)
+			continue
+		}
+		require.Contains(t, a.Addr, "/tcp/")
+		require.Contains(t, a.Reasons, AddrReasonListen)
+		sawListen = true
+	}
+	require.True(t, sawListen)
+	require.Len(t, d.RelayReservations, 1)
+	relayID, err := peer.Decode("QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSoooo4")
+	require.NoError(t, err)
+	require.Equal(t, relayID, d.RelayReservations[0].Relay)
+
+	require.Len(t, d.RecentDialFailures, 1)
+	require.Equal(t, unreachable.ID, d.RecentDialFailures[0].Peer)
+	require.Equal(t, "/ip4/127.0.0.1/tcp/1", d.RecentDialFailures[0].Addr)
+
+	b, err := json.Marshal(d)
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	require.Contains(t, decoded, "advertised_addrs")
+	require.Contains(t, decoded, "recent_dial_failures")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = h.Diagnostics(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestPeerProtocolStats(t *testing.T) {
+	h1, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), nil)
+	require.NoError(t, err)
+	defer h1.Close()
+	h1.Start()
+	h2, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), nil)
+	require.NoError(t, err)
+	defer h2.Close()
+	h2.Start()
+
+	const proto = "/echo"
+	h2.SetStreamHandler(proto, func(s network.Stream) {
+		defer s.Close()
+		io.Copy(s, s)
+	})
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	require.Nil(t, h1.PeerProtocolStats(test.RandPeerIDFatal(t)))
+
+	s, err := h1.NewStream(context.Background(), h2.ID(), proto)
+	require.NoError(t, err)
+	_, err = s.Write([]byte("foobar"))
+	require.NoError(t, err)
+	require.NoError(t, s.CloseWrite())
+	b, err := io.ReadAll(s)
+	require.NoError(t, err)
+	require.Equal(t, "foobar", string(b))
+	s.Close()
+
+	// a stream that is reset counts as an error
+	s, err = h1.NewStream(context.Background(), h2.ID(), proto)
+	require.NoError(t, err)
+	require.NoError(t, s.Reset())
+
+	require.Equal(t, host.ProtocolStats{StreamsOutbound: 2, BytesIn: 6, BytesOut: 6, Errors: 1}, h1.PeerProtocolStats(h2.ID())[proto])
+	require.Eventually(t, func() bool {
+		st := h2.PeerProtocolStats(h1.ID())[proto]
+		return st.StreamsInbound == 1 && st.BytesIn == 6 && st.BytesOut == 6
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// statistics are removed when the peer disconnects
+	require.NoError(t, h1.Network().ClosePeer(h2.ID()))
+	require.Eventually(t, func() bool { return h1.PeerProtocolStats(h2.ID()) == nil }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestMessageSizeLimit(t *testing.T) {
+	h1, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), nil)
+	require.NoError(t, err)
+	defer h1.Close()
+	h1.Start()
+	h2, err := NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), nil)
+	require.NoError(t, err)
+	defer h2.Close()
+	h2.Start()
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+
+	const (
+		rawProto   = "/raw"
+		delimProto = "/delimited"
+	)
+	errs := make(chan error, 1)
+	readAll := func(s network.Stream) {
+		defer s.Close()
+		_, err := io.ReadAll(s)
+		errs <- err
+	}
+	h2.SetStreamHandlerWithLimit(rawProto, host.MessageSizeLimit{MaxSize: 10}, readAll)
+	h2.SetStreamHandlerWithLimit(delimProto, host.MessageSizeLimit{MaxSize: 10, Delimited: true}, readAll)
+
+	send := func(proto protocol.ID, data []byte) error {
+		t.Helper()
+		s, err := h1.NewStream(context.Background(), h2.ID(), proto)
+		require.NoError(t, err)
+		defer s.Close()
+		// writing fails if the peer resets the stream before all data was sent
+		s.Write(data)
+		s.CloseWrite()
+		select {
+		case err := <-errs:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+			return nil
+		}
+	}
+	delimited := func(sizes ...int) []byte {
+		var b []byte
+		for _, size := range sizes {
+			b = binary.AppendUvarint(b, uint64(size))
+			b = append(b, make([]byte, size)...)
+		}
+		return b
+	}
+
+	require.NoError(t, send(rawProto, make([]byte, 10)))
+	require.ErrorIs(t, send(rawProto, make([]byte, 11)), host.ErrMessageTooLarge)
+	// the limit applies to every message, not to the whole stream
+	require.NoError(t, send(delimProto, delimited(8, 10, 0, 3)))
+	require.ErrorIs(t, send(delimProto, delimited(8, 11)), host.ErrMessageTooLarge)
+	require.ErrorIs(t, send(delimProto, delimited(1<<20)), host.ErrMessageTooLarge)
+
+	// the limit also applies to streams we open
+	h1.SetStreamHandlerWithLimit(rawProto, host.MessageSizeLimit{MaxSize: 10}, readAll)
+	h2.SetStreamHandler(rawProto, func(s network.Stream) {
+		defer s.Close()
+		s.Write(make([]byte, 100))
+	})
+	s, err := h1.NewStream(context.Background(), h2.ID(), rawProto)
+	require.NoError(t, err)
+	_, err = io.ReadAll(s)
+	require.ErrorIs(t, err, host.ErrMessageTooLarge)
+
+	// the limit is removed with the handler
+	h1.RemoveStreamHandler(rawProto)
+	s, err = h1.NewStream(context.Background(), h2.ID(), rawProto)
+	require.NoError(t, err)
+	b, err := io.ReadAll(s)
+	require.NoError(t, err)
+	require.Len(t, b, 100)
+}
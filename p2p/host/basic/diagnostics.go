@@ -0,0 +1,309 @@
+package basichost
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/host/health"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// maxRecentDialFailures is the number of dial failures kept for the diagnostics bundle.
+const maxRecentDialFailures = 32
+
+// Reasons why an address is advertised.
+const (
+	// AddrReasonListen is used for (resolved) listen addresses.
+	AddrReasonListen = "listen"
+	// AddrReasonNATMapping is used for addresses obtained from a port mapping on our NAT device.
+	AddrReasonNATMapping = "nat_mapping"
+	// AddrReasonObserved is used for addresses that other peers observed us at.
+	AddrReasonObserved = "observed"
+	// AddrReasonRelay is used for relay addresses, i.e. addresses of relays we hold a reservation with.
+	AddrReasonRelay = "relay"
+	// AddrReasonAddrsFactory is used for addresses that were added by the AddrsFactory.
+	AddrReasonAddrsFactory = "addrs_factory"
+)
+
+// Diagnostics is a snapshot of the connectivity state of a host.
+// It is meant to be serialized to JSON and attached to bug reports.
+type Diagnostics struct {
+	Time   time.Time `json:"time"`
+	PeerID peer.ID   `json:"peer_id"`
+
+	// ListenAddrs are the addresses we're listening on.
+	ListenAddrs []string `json:"listen_addrs"`
+	// AdvertisedAddrs are the addresses we advertise to other peers, together with
+	// the reasons why they're advertised.
+	AdvertisedAddrs []AdvertisedAddr `json:"advertised_addrs"`
+	// FilteredAddrs are the addresses that were removed by the AddrsFactory.
+	FilteredAddrs []string `json:"filtered_addrs,omitempty"`
+
+	NAT               NATDiagnostics     `json:"nat"`
+	Reachability      string             `json:"reachability"`
+	RelayReservations []RelayReservation `json:"relay_reservations,omitempty"`
+	Resources         ResourceUsage      `json:"resources"`
+	// Health is only set if the host was constructed with a health monitor.
+	Health *health.Report `json:"health,omitempty"`
+	// RecentDialFailures are the most recent failed dials, oldest first.
+	RecentDialFailures []DialFailure `json:"recent_dial_failures,omitempty"`
+}
+
+// AdvertisedAddr is an address we advertise to other peers.
+type AdvertisedAddr struct {
+	Addr    string   `json:"addr"`
+	Reasons []string `json:"reasons"`
+}
+
+// NATDiagnostics describes the state of the NAT port mapping.
+type NATDiagnostics struct {
+	// Enabled is true if the host was constructed with a NAT manager.
+	Enabled bool `json:"enabled"`
+	// Discovered is true if a NAT device supporting UPnP or NAT-PMP was discovered.
+	Discovered bool         `json:"discovered"`
+	Mappings   []NATMapping `json:"mappings,omitempty"`
+}
+
+// NATMapping is a port mapping on the NAT device.
+type NATMapping struct {
+	Listen   string `json:"listen"`
+	External string `json:"external"`
+}
+
+// RelayReservation is a reservation we hold with a relay, as derived from our advertised relay addresses.
+type RelayReservation struct {
+	Relay peer.ID  `json:"relay"`
+	Addrs []string `json:"addrs"`
+}
+
+// ResourceUsage is the usage of the resource manager's system and transient scope.
+type ResourceUsage struct {
+	System    network.ScopeStat `json:"system"`
+	Transient network.ScopeStat `json:"transient"`
+}
+
+// DialFailure is a failed dial.
+type DialFailure struct {
+	Time time.Time `json:"time"`
+	Peer peer.ID   `json:"peer"`
+	// Addr is the address that failed, if the error could be attributed to a single address.
+	Addr  string `json:"addr,omitempty"`
+	Error string `json:"error"`
+}
+
+// dialFailures keeps the most recent dial failures.
+type dialFailures struct {
+	mx       sync.Mutex
+	failures []DialFailure
+}
+
+func (d *dialFailures) add(p peer.ID, err error) {
+	now := time.Now()
+	var failures []DialFailure
+	var dialErr *swarm.DialError
+	if errors.As(err, &dialErr) && len(dialErr.DialErrors) > 0 {
+		for _, te := range dialErr.DialErrors {
+			failures = append(failures, DialFailure{Time: now, Peer: p, Addr: te.Address.String(), Error: te.Cause.Error()})
+		}
+	} else {
+		failures = append(failures, DialFailure{Time: now, Peer: p, Error: err.Error()})
+	}
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	d.failures = append(d.failures, failures...)
+	if n := len(d.failures); n > maxRecentDialFailures {
+		d.failures = append(d.failures[:0], d.failures[n-maxRecentDialFailures:]...)
+	}
+}
+
+func (d *dialFailures) get() []DialFailure {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+	if len(d.failures) == 0 {
+		return nil
+	}
+	return append([]DialFailure(nil), d.failures...)
+}
+
+// Diagnostics collects a snapshot of the connectivity state of the host.
+// The result can be serialized to JSON.
+func (h *BasicHost) Diagnostics(ctx context.Context) (*Diagnostics, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	d := &Diagnostics{
+		Time:               time.Now(),
+		PeerID:             h.ID(),
+		Reachability:       network.ReachabilityUnknown.String(),
+		RecentDialFailures: h.dialFailures.get(),
+	}
+
+	listenAddrs := h.Network().ListenAddresses()
+	d.ListenAddrs = addrsToStrings(listenAddrs)
+
+	if h.natmgr != nil {
+		d.NAT.Enabled = true
+		d.NAT.Discovered = h.natmgr.HasDiscoveredNAT()
+		if d.NAT.Discovered {
+			for _, l := range listenAddrs {
+				if ext := h.natmgr.GetMapping(l); ext != nil {
+					d.NAT.Mappings = append(d.NAT.Mappings, NATMapping{Listen: l.String(), External: ext.String()})
+				}
+			}
+		}
+	}
+
+	if an := h.GetAutoNat(); an != nil {
+		d.Reachability = an.Status().String()
+	}
+
+	d.AdvertisedAddrs, d.FilteredAddrs = h.advertisedAddrsWithReasons(listenAddrs)
+	d.RelayReservations = relayReservations(d.AdvertisedAddrs)
+
+	rcmgr := h.Network().ResourceManager()
+	if err := rcmgr.ViewSystem(func(s network.ResourceScope) error {
+		d.Resources.System = s.Stat()
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := rcmgr.ViewTransient(func(s network.ResourceScope) error {
+		d.Resources.Transient = s.Stat()
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if h.health != nil {
+		r := h.health.Report()
+		d.Health = &r
+	}
+	return d, nil
+}
+
+func (h *BasicHost) advertisedAddrsWithReasons(listenAddrs []ma.Multiaddr) (advertised []AdvertisedAddr, filtered []string) {
+	h.addrMu.RLock()
+	ifaceAddrs := h.filteredInterfaceAddrs
+	h.addrMu.RUnlock()
+	resolved, _ := manet.ResolveUnspecifiedAddresses(listenAddrs, ifaceAddrs)
+
+	var observed []ma.Multiaddr
+	if h.ids != nil {
+		observed = h.ids.OwnObservedAddrs()
+	}
+	var mapped []ma.Multiaddr
+	if h.natmgr != nil && h.natmgr.HasDiscoveredNAT() {
+		for _, l := range listenAddrs {
+			if ext := h.natmgr.GetMapping(l); ext != nil {
+				mapped = append(mapped, ext)
+			}
+		}
+	}
+
+	addrs := h.Addrs()
+	for _, a := range addrs {
+		// Cert hashes are added to WebTransport addresses after the AddrsFactory ran.
+		// Ignore them when determining where the address came from.
+		base := stripCerthashes(a)
+		var reasons []string
+		if containsAddr(resolved, base) || containsAddr(listenAddrs, base) {
+			reasons = append(reasons, AddrReasonListen)
+		}
+		if containsAddr(mapped, base) {
+			reasons = append(reasons, AddrReasonNATMapping)
+		}
+		if containsAddr(observed, base) {
+			reasons = append(reasons, AddrReasonObserved)
+		}
+		if isRelayAddr(a) {
+			reasons = append(reasons, AddrReasonRelay)
+		}
+		if len(reasons) == 0 {
+			reasons = append(reasons, AddrReasonAddrsFactory)
+		}
+		advertised = append(advertised, AdvertisedAddr{Addr: a.String(), Reasons: reasons})
+	}
+
+	stripped := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		stripped = append(stripped, stripCerthashes(a))
+	}
+	for _, a := range h.AllAddrs() {
+		if !containsAddr(stripped, stripCerthashes(a)) {
+			filtered = append(filtered, a.String())
+		}
+	}
+	return advertised, filtered
+}
+
+func relayReservations(addrs []AdvertisedAddr) []RelayReservation {
+	var reservations []RelayReservation
+	index := make(map[peer.ID]int)
+	for _, a := range addrs {
+		maddr, err := ma.NewMultiaddr(a.Addr)
+		if err != nil || !isRelayAddr(maddr) {
+			continue
+		}
+		relayAddr, _ := ma.SplitFunc(maddr, func(c ma.Component) bool { return c.Protocol().Code == ma.P_CIRCUIT })
+		if relayAddr == nil {
+			continue
+		}
+		_, relay := peer.SplitAddr(relayAddr)
+		if relay == "" {
+			continue
+		}
+		i, ok := index[relay]
+		if !ok {
+			i = len(reservations)
+			index[relay] = i
+			reservations = append(reservations, RelayReservation{Relay: relay})
+		}
+		reservations[i].Addrs = append(reservations[i].Addrs, a.Addr)
+	}
+	return reservations
+}
+
+func isRelayAddr(a ma.Multiaddr) bool {
+	_, err := a.ValueForProtocol(ma.P_CIRCUIT)
+	return err == nil
+}
+
+func stripCerthashes(a ma.Multiaddr) ma.Multiaddr {
+	if _, err := a.ValueForProtocol(ma.P_CERTHASH); err != nil {
+		return a
+	}
+	var comps []ma.Multiaddr
+	ma.ForEach(a, func(c ma.Component) bool {
+		if c.Protocol().Code != ma.P_CERTHASH {
+			comps = append(comps, &c)
+		}
+		return true
+	})
+	return ma.Join(comps...)
+}
+
+func containsAddr(addrs []ma.Multiaddr, a ma.Multiaddr) bool {
+	for _, addr := range addrs {
+		if addr.Equal(a) {
+			return true
+		}
+	}
+	return false
+}
+
+func addrsToStrings(addrs []ma.Multiaddr) []string {
+	s := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		s = append(s, a.String())
+	}
+	return s
+}
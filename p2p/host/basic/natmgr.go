@@ -26,8 +26,9 @@ type NATManager interface {
 }
 
 // NewNATManager creates a NAT manager.
+// It discovers NAT devices using UPnP and NAT-PMP, and requests port mappings for our listen addresses.
 func NewNATManager(net network.Network) NATManager {
-	return newNATManager(net)
+	return newNATManager(net, discoverNAT)
 }
 
 type entry struct {
@@ -52,9 +53,10 @@ var discoverNAT = func(ctx context.Context) (nat, error) { return inat.DiscoverN
 //     as the network signals Listen() or ListenClose().
 //   - closing the natManager closes the nat and its mappings.
 type natManager struct {
-	net   network.Network
-	natMx sync.RWMutex
-	nat   nat
+	net      network.Network
+	discover func(context.Context) (nat, error)
+	natMx    sync.RWMutex
+	nat      nat
 
 	syncFlag chan struct{} // cap: 1
 
@@ -65,10 +67,11 @@ type natManager struct {
 	ctxCancel context.CancelFunc
 }
 
-func newNATManager(net network.Network) *natManager {
+func newNATManager(net network.Network, discover func(context.Context) (nat, error)) *natManager {
 	ctx, cancel := context.WithCancel(context.Background())
 	nmgr := &natManager{
 		net:       net,
+		discover:  discover,
 		syncFlag:  make(chan struct{}, 1),
 		ctx:       ctx,
 		ctxCancel: cancel,
@@ -107,7 +110,7 @@ func (nmgr *natManager) background(ctx context.Context) {
 
 	discoverCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
-	natInstance, err := discoverNAT(discoverCtx)
+	natInstance, err := nmgr.discover(discoverCtx)
 	if err != nil {
 		log.Info("DiscoverNAT error:", err)
 		return
@@ -0,0 +1,94 @@
+package basichost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// StaticPortForward is a port forwarding that was manually configured on the NAT device,
+// for example "my router forwards TCP port 4001 to this machine".
+type StaticPortForward struct {
+	// Protocol is the transport protocol of the forwarding, either "tcp" or "udp".
+	Protocol string
+	// InternalPort is the port we're listening on.
+	InternalPort int
+	// ExternalPort is the port on the NAT device that is forwarded to InternalPort.
+	// If 0, it is the same as InternalPort.
+	ExternalPort int
+}
+
+// NewStaticNATManager returns a constructor for a NAT manager that doesn't probe the network
+// for NAT devices, but uses a list of statically configured port forwardings instead.
+// This is useful for users whose routers misbehave when probed using UPnP or NAT-PMP.
+//
+// If externalIP is the zero value, the external IP address is unknown. The forwarded ports are
+// then combined with the IP addresses observed by our peers.
+func NewStaticNATManager(externalIP netip.Addr, forwards ...StaticPortForward) (func(network.Network) NATManager, error) {
+	if externalIP.IsValid() && !externalIP.IsGlobalUnicast() {
+		return nil, fmt.Errorf("external IP %s is not a global unicast address", externalIP)
+	}
+	if len(forwards) == 0 {
+		return nil, errors.New("no port forwardings configured")
+	}
+	n := &staticNAT{externalIP: externalIP.Unmap(), mappings: make(map[entry]int, len(forwards))}
+	for _, f := range forwards {
+		if f.Protocol != "tcp" && f.Protocol != "udp" {
+			return nil, fmt.Errorf("invalid port forwarding protocol: %q", f.Protocol)
+		}
+		if f.InternalPort <= 0 || f.InternalPort > 65535 {
+			return nil, fmt.Errorf("invalid internal port: %d", f.InternalPort)
+		}
+		ext := f.ExternalPort
+		if ext == 0 {
+			ext = f.InternalPort
+		}
+		if ext < 0 || ext > 65535 {
+			return nil, fmt.Errorf("invalid external port: %d", f.ExternalPort)
+		}
+		e := entry{protocol: f.Protocol, port: f.InternalPort}
+		if _, ok := n.mappings[e]; ok {
+			return nil, fmt.Errorf("duplicate port forwarding for %s port %d", f.Protocol, f.InternalPort)
+		}
+		n.mappings[e] = ext
+	}
+	return func(net network.Network) NATManager {
+		return newNATManager(net, func(context.Context) (nat, error) { return n, nil })
+	}, nil
+}
+
+// staticNAT is a nat that uses statically configured port forwardings.
+type staticNAT struct {
+	externalIP netip.Addr
+	mappings   map[entry]int // never modified after construction
+}
+
+var _ nat = &staticNAT{}
+
+// AddMapping is a no-op. Port forwardings are configured on the NAT device.
+func (n *staticNAT) AddMapping(_ context.Context, protocol string, port int) error {
+	if _, ok := n.mappings[entry{protocol: protocol, port: port}]; !ok {
+		log.Debugf("no static port forwarding configured for %s port %d", protocol, port)
+	}
+	return nil
+}
+
+// RemoveMapping is a no-op. Port forwardings are configured on the NAT device.
+func (n *staticNAT) RemoveMapping(context.Context, string, int) error { return nil }
+
+func (n *staticNAT) GetMapping(protocol string, port int) (netip.AddrPort, bool) {
+	ext, ok := n.mappings[entry{protocol: protocol, port: port}]
+	if !ok {
+		return netip.AddrPort{}, false
+	}
+	ip := n.externalIP
+	if !ip.IsValid() {
+		ip = netip.IPv4Unspecified()
+	}
+	return netip.AddrPortFrom(ip, uint16(ext)), true
+}
+
+func (n *staticNAT) Close() error { return nil }
@@ -33,7 +33,7 @@ func TestMapping(t *testing.T) {
 
 	sw := swarmt.GenSwarm(t)
 	defer sw.Close()
-	m := newNATManager(sw)
+	m := newNATManager(sw, discoverNAT)
 	require.Eventually(t, func() bool {
 		m.natMx.Lock()
 		defer m.natMx.Unlock()
@@ -67,7 +67,7 @@ func TestAddAndRemoveListeners(t *testing.T) {
 
 	sw := swarmt.GenSwarm(t)
 	defer sw.Close()
-	m := newNATManager(sw)
+	m := newNATManager(sw, discoverNAT)
 	require.Eventually(t, func() bool {
 		m.natMx.Lock()
 		defer m.natMx.Unlock()
@@ -106,3 +106,57 @@ func TestAddAndRemoveListeners(t *testing.T) {
 	mockNAT.EXPECT().RemoveMapping(gomock.Any(), "tcp", 1234).MaxTimes(1)
 	mockNAT.EXPECT().Close().MaxTimes(1)
 }
+
+func TestStaticNATManagerValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		externalIP netip.Addr
+		forwards   []StaticPortForward
+	}{
+		{name: "no forwards"},
+		{name: "loopback external IP", externalIP: netip.MustParseAddr("127.0.0.1"), forwards: []StaticPortForward{{Protocol: "tcp", InternalPort: 4001}}},
+		{name: "invalid protocol", forwards: []StaticPortForward{{Protocol: "sctp", InternalPort: 4001}}},
+		{name: "invalid internal port", forwards: []StaticPortForward{{Protocol: "tcp"}}},
+		{name: "invalid external port", forwards: []StaticPortForward{{Protocol: "tcp", InternalPort: 4001, ExternalPort: 1 << 16}}},
+		{name: "duplicate", forwards: []StaticPortForward{{Protocol: "tcp", InternalPort: 4001}, {Protocol: "tcp", InternalPort: 4001, ExternalPort: 4002}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewStaticNATManager(tc.externalIP, tc.forwards...)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestStaticNATManager(t *testing.T) {
+	sw := swarmt.GenSwarm(t, swarmt.OptDisableQUIC)
+	defer sw.Close()
+
+	newNATMgr, err := NewStaticNATManager(
+		netip.MustParseAddr("1.2.3.4"),
+		StaticPortForward{Protocol: "tcp", InternalPort: 4001},
+		StaticPortForward{Protocol: "udp", InternalPort: 4001, ExternalPort: 5001},
+	)
+	require.NoError(t, err)
+	m := newNATMgr(sw)
+	defer m.Close()
+	require.Eventually(t, m.HasDiscoveredNAT, time.Second, time.Millisecond)
+
+	require.Equal(t, ma.StringCast("/ip4/1.2.3.4/tcp/4001"), m.GetMapping(ma.StringCast("/ip4/0.0.0.0/tcp/4001")))
+	require.Equal(t, ma.StringCast("/ip4/1.2.3.4/udp/5001/quic-v1"), m.GetMapping(ma.StringCast("/ip4/0.0.0.0/udp/4001/quic-v1")))
+	require.Nil(t, m.GetMapping(ma.StringCast("/ip4/0.0.0.0/tcp/4002")))
+	require.Nil(t, m.GetMapping(ma.StringCast("/ip4/127.0.0.1/tcp/4001")))
+}
+
+func TestStaticNATManagerUnknownExternalIP(t *testing.T) {
+	sw := swarmt.GenSwarm(t, swarmt.OptDisableQUIC)
+	defer sw.Close()
+
+	newNATMgr, err := NewStaticNATManager(netip.Addr{}, StaticPortForward{Protocol: "tcp", InternalPort: 4001})
+	require.NoError(t, err)
+	m := newNATMgr(sw)
+	defer m.Close()
+	require.Eventually(t, m.HasDiscoveredNAT, time.Second, time.Millisecond)
+
+	// The IP is filled in from observed addresses by the host.
+	require.Equal(t, ma.StringCast("/ip4/0.0.0.0/tcp/4001"), m.GetMapping(ma.StringCast("/ip4/0.0.0.0/tcp/4001")))
+}
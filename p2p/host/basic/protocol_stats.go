@@ -0,0 +1,124 @@
+package basichost
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// protocolCounters are the usage counters of a protocol with a single peer.
+type protocolCounters struct {
+	streamsInbound, streamsOutbound atomic.Uint64
+	bytesIn, bytesOut               atomic.Uint64
+	errors                          atomic.Uint64
+}
+
+// protocolStats tracks per peer and protocol usage statistics.
+type protocolStats struct {
+	mx    sync.Mutex
+	peers map[peer.ID]map[protocol.ID]*protocolCounters
+}
+
+func newProtocolStats() *protocolStats {
+	return &protocolStats{peers: make(map[peer.ID]map[protocol.ID]*protocolCounters)}
+}
+
+func (ps *protocolStats) counters(p peer.ID, proto protocol.ID) *protocolCounters {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	protos, ok := ps.peers[p]
+	if !ok {
+		protos = make(map[protocol.ID]*protocolCounters)
+		ps.peers[p] = protos
+	}
+	c, ok := protos[proto]
+	if !ok {
+		c = &protocolCounters{}
+		protos[proto] = c
+	}
+	return c
+}
+
+// wrapStream counts the stream, and returns a stream that counts the bytes read and written.
+// The stream's protocol must be set.
+func (ps *protocolStats) wrapStream(s network.Stream, dir network.Direction) network.Stream {
+	c := ps.counters(s.Conn().RemotePeer(), s.Protocol())
+	if dir == network.DirInbound {
+		c.streamsInbound.Add(1)
+	} else {
+		c.streamsOutbound.Add(1)
+	}
+	return &statsStream{Stream: s, counters: c}
+}
+
+// removePeer removes the statistics of peer p.
+func (ps *protocolStats) removePeer(p peer.ID) {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+	delete(ps.peers, p)
+}
+
+func (ps *protocolStats) peerStats(p peer.ID) map[protocol.ID]host.ProtocolStats {
+	ps.mx.Lock()
+	defer ps.mx.Unlock()
+
+	protos, ok := ps.peers[p]
+	if !ok {
+		return nil
+	}
+	stats := make(map[protocol.ID]host.ProtocolStats, len(protos))
+	for proto, c := range protos {
+		stats[proto] = host.ProtocolStats{
+			StreamsInbound:  c.streamsInbound.Load(),
+			StreamsOutbound: c.streamsOutbound.Load(),
+			BytesIn:         c.bytesIn.Load(),
+			BytesOut:        c.bytesOut.Load(),
+			Errors:          c.errors.Load(),
+		}
+	}
+	return stats
+}
+
+// statsStream is a stream that updates the usage counters of its protocol.
+type statsStream struct {
+	network.Stream
+	counters *protocolCounters
+	// failed is set when the first error is counted, so every stream counts as at most one error.
+	failed atomic.Bool
+}
+
+func (s *statsStream) Read(b []byte) (int, error) {
+	n, err := s.Stream.Read(b)
+	s.counters.bytesIn.Add(uint64(n))
+	if err != nil && !errors.Is(err, io.EOF) {
+		s.fail()
+	}
+	return n, err
+}
+
+func (s *statsStream) Write(b []byte) (int, error) {
+	n, err := s.Stream.Write(b)
+	s.counters.bytesOut.Add(uint64(n))
+	if err != nil {
+		s.fail()
+	}
+	return n, err
+}
+
+func (s *statsStream) Reset() error {
+	s.fail()
+	return s.Stream.Reset()
+}
+
+func (s *statsStream) fail() {
+	if s.failed.CompareAndSwap(false, true) {
+		s.counters.errors.Add(1)
+	}
+}
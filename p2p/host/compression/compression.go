@@ -0,0 +1,177 @@
+// Package compression compresses the data sent on the streams of a protocol.
+//
+// Compression is negotiated using multistream-select: for every supported algorithm, the
+// handler of a protocol is also registered under the protocol ID with the name of the algorithm
+// appended (e.g. /my/proto/1.0.0+zstd). When opening a stream, the compressed variants are proposed
+// in order of preference, falling back to the uncompressed protocol if the remote peer doesn't
+// support compression. Protocol implementations don't need to be aware of compression: they read
+// and write uncompressed data, and Protocol() returns the uncompressed protocol ID.
+//
+// Every write is flushed, so request-response protocols work as expected. Small writes compress
+// badly, so compression is most useful for protocols sending large, verbose messages.
+//
+// Note that the streams are opened (and accounted for by the resource manager) using
+// the compressed protocol ID. The memory used by the encoder and decoder of a compressed stream
+// is reserved in the stream's resource scope. If the reservation fails, the stream is reset.
+package compression
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/klauspost/compress/zstd"
+)
+
+var log = logging.Logger("compression")
+
+// Algorithm is a compression algorithm.
+type Algorithm string
+
+const (
+	// Zstd compresses using Zstandard. It achieves good compression ratios at a moderate CPU cost.
+	Zstd Algorithm = "zstd"
+	// Snappy compresses using the Snappy framing format. It is faster than Zstd, but compresses less.
+	Snappy Algorithm = "snappy"
+)
+
+var allAlgorithms = []Algorithm{Zstd, Snappy}
+
+func (a Algorithm) valid() bool {
+	for _, alg := range allAlgorithms {
+		if a == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// protocolID returns the protocol ID used for streams of pid compressed with a.
+func (a Algorithm) protocolID(pid protocol.ID) protocol.ID {
+	return protocol.ID(fmt.Sprintf("%s+%s", pid, a))
+}
+
+type config struct {
+	algorithms    []Algorithm
+	maxWindowSize int
+}
+
+// Option is an option for SetStreamHandler and NewStream.
+type Option func(*config) error
+
+// WithAlgorithms sets the compression algorithms, in order of preference.
+// By default, Zstd and Snappy are used, preferring Zstd.
+func WithAlgorithms(algs ...Algorithm) Option {
+	return func(c *config) error {
+		if len(algs) == 0 {
+			return errors.New("no compression algorithm")
+		}
+		for _, a := range algs {
+			if !a.valid() {
+				return fmt.Errorf("unknown compression algorithm: %q", a)
+			}
+		}
+		c.algorithms = algs
+		return nil
+	}
+}
+
+// WithMaxWindowSize sets the maximum zstd window size accepted from the remote peer, in bytes.
+// The decoder of every zstd stream needs memory of the size of the window. By default, the
+// window size used by the encoder of this package (1 MiB) is accepted.
+func WithMaxWindowSize(size int) Option {
+	return func(c *config) error {
+		if size < zstd.MinWindowSize || size > zstd.MaxWindowSize {
+			return fmt.Errorf("invalid window size: %d", size)
+		}
+		c.maxWindowSize = size
+		return nil
+	}
+}
+
+func newConfig(opts []Option) (*config, error) {
+	cfg := &config{algorithms: allAlgorithms, maxWindowSize: defaultZstdMaxWindowSize}
+	for _, opt := range opts {
+		if err := opt(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// SetStreamHandler sets the stream handler for pid on h. The handler accepts uncompressed streams,
+// as well as streams compressed with any of the configured algorithms.
+func SetStreamHandler(h host.Host, pid protocol.ID, handler network.StreamHandler, opts ...Option) error {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return err
+	}
+	h.SetStreamHandler(pid, handler)
+	for _, a := range cfg.algorithms {
+		a := a
+		h.SetStreamHandler(a.protocolID(pid), func(s network.Stream) {
+			cs, err := newCompressedStream(s, pid, a, cfg)
+			if err != nil {
+				log.Debugw("failed to set up compressed stream", "protocol", pid, "algorithm", a, "error", err)
+				s.Reset()
+				return
+			}
+			handler(cs)
+		})
+	}
+	return nil
+}
+
+// RemoveStreamHandler removes the stream handlers for pid, for uncompressed streams and
+// for all compression algorithms.
+func RemoveStreamHandler(h host.Host, pid protocol.ID) {
+	h.RemoveStreamHandler(pid)
+	for _, a := range allAlgorithms {
+		h.RemoveStreamHandler(a.protocolID(pid))
+	}
+}
+
+// NewStream opens a new stream for pid to peer p. The configured compression algorithms are
+// proposed in order of preference. If the peer supports none of them, an uncompressed stream is opened.
+func NewStream(ctx context.Context, h host.Host, p peer.ID, pid protocol.ID, opts ...Option) (network.Stream, error) {
+	cfg, err := newConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	pids := make([]protocol.ID, 0, len(cfg.algorithms)+1)
+	for _, a := range cfg.algorithms {
+		pids = append(pids, a.protocolID(pid))
+	}
+	pids = append(pids, pid)
+	s, err := h.NewStream(ctx, p, pids...)
+	if err != nil {
+		return nil, err
+	}
+	alg, ok := algorithmFor(s.Protocol(), pid)
+	if !ok {
+		return s, nil
+	}
+	cs, err := newCompressedStream(s, pid, alg, cfg)
+	if err != nil {
+		s.Reset()
+		return nil, err
+	}
+	return cs, nil
+}
+
+// algorithmFor returns the compression algorithm of the negotiated protocol ID, which was
+// proposed for pid. It returns false if the stream is uncompressed.
+func algorithmFor(negotiated, pid protocol.ID) (Algorithm, bool) {
+	if negotiated == pid {
+		return "", false
+	}
+	a := Algorithm(strings.TrimPrefix(string(negotiated), string(pid)+"+"))
+	return a, a.valid()
+}
@@ -0,0 +1,258 @@
+package compression
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	blankhost "github.com/libp2p/go-libp2p/p2p/host/blank"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testProto = protocol.ID("/test/compression/1.0.0")
+
+func newHosts(t *testing.T) (host.Host, host.Host) {
+	t.Helper()
+	h1 := blankhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	t.Cleanup(func() { h1.Close() })
+	h2 := blankhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	t.Cleanup(func() { h2.Close() })
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	return h1, h2
+}
+
+// echoHandler echoes back all data it receives.
+func echoHandler(protos chan<- protocol.ID) network.StreamHandler {
+	return func(s network.Stream) {
+		defer s.Close()
+		protos <- s.Protocol()
+		buf := make([]byte, 1<<16)
+		for {
+			n, err := s.Read(buf)
+			if n > 0 {
+				if _, err := s.Write(buf[:n]); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func testEcho(t *testing.T, s network.Stream) {
+	t.Helper()
+	s.SetDeadline(time.Now().Add(5 * time.Second))
+	// request-response: every message is delivered without closing the stream
+	for i := 0; i < 5; i++ {
+		msg := []byte("hello world")
+		_, err := s.Write(msg)
+		require.NoError(t, err)
+		buf := make([]byte, len(msg))
+		_, err = io.ReadFull(s, buf)
+		require.NoError(t, err)
+		require.Equal(t, msg, buf)
+	}
+
+	data := bytes.Repeat([]byte("compressible data "), 10000)
+	go func() {
+		s.Write(data)
+		s.CloseWrite()
+	}()
+	received, err := io.ReadAll(s)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(data, received))
+	require.NoError(t, s.Close())
+}
+
+func TestCompressedStream(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		serverOpts []Option
+		clientOpts []Option
+		expected   protocol.ID
+	}{
+		{name: "default", expected: Zstd.protocolID(testProto)},
+		{name: "snappy", clientOpts: []Option{WithAlgorithms(Snappy)}, expected: Snappy.protocolID(testProto)},
+		{
+			name:       "client preference",
+			clientOpts: []Option{WithAlgorithms(Snappy, Zstd)},
+			expected:   Snappy.protocolID(testProto),
+		},
+		{
+			name:       "no common algorithm",
+			serverOpts: []Option{WithAlgorithms(Zstd)},
+			clientOpts: []Option{WithAlgorithms(Snappy)},
+			expected:   testProto,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h1, h2 := newHosts(t)
+			protos := make(chan protocol.ID, 1)
+			require.NoError(t, SetStreamHandler(h2, testProto, echoHandler(protos), tc.serverOpts...))
+
+			s, err := NewStream(context.Background(), h1, h2.ID(), testProto, tc.clientOpts...)
+			require.NoError(t, err)
+			require.Equal(t, testProto, s.Protocol())
+			if cs, ok := s.(*compressedStream); ok {
+				require.Equal(t, tc.expected, cs.Stream.Protocol())
+			} else {
+				require.Equal(t, tc.expected, s.Protocol())
+			}
+			testEcho(t, s)
+			require.Equal(t, testProto, <-protos)
+		})
+	}
+}
+
+func TestResetDuringRead(t *testing.T) {
+	for _, a := range allAlgorithms {
+		t.Run(string(a), func(t *testing.T) {
+			h1, h2 := newHosts(t)
+			done := make(chan struct{})
+			defer close(done)
+			// the handler never sends anything, so reads block
+			require.NoError(t, SetStreamHandler(h2, testProto, func(s network.Stream) {
+				<-done
+				s.Reset()
+			}, WithAlgorithms(a)))
+
+			s, err := NewStream(context.Background(), h1, h2.ID(), testProto, WithAlgorithms(a))
+			require.NoError(t, err)
+			_, ok := s.(*compressedStream)
+			require.True(t, ok)
+			_, err = s.Write([]byte("foobar"))
+			require.NoError(t, err)
+
+			readErr := make(chan error, 1)
+			go func() {
+				_, err := s.Read(make([]byte, 10))
+				readErr <- err
+			}()
+			time.Sleep(50 * time.Millisecond) // give the Read time to block
+			require.NoError(t, s.Reset())
+			select {
+			case err := <-readErr:
+				require.Error(t, err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("Read didn't return after Reset")
+			}
+			_, err = s.Read(make([]byte, 10))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestUncompressedPeer(t *testing.T) {
+	h1, h2 := newHosts(t)
+	protos := make(chan protocol.ID, 2)
+	h2.SetStreamHandler(testProto, echoHandler(protos))
+
+	s, err := NewStream(context.Background(), h1, h2.ID(), testProto)
+	require.NoError(t, err)
+	_, compressed := s.(*compressedStream)
+	require.False(t, compressed)
+	testEcho(t, s)
+
+	// an uncompressed stream is accepted by a compressing peer
+	RemoveStreamHandler(h2, testProto)
+	require.NoError(t, SetStreamHandler(h2, testProto, echoHandler(protos)))
+	s, err = h1.NewStream(context.Background(), h2.ID(), testProto)
+	require.NoError(t, err)
+	testEcho(t, s)
+}
+
+func TestOptions(t *testing.T) {
+	h1, h2 := newHosts(t)
+	require.Error(t, SetStreamHandler(h2, testProto, func(network.Stream) {}, WithAlgorithms()))
+	require.Error(t, SetStreamHandler(h2, testProto, func(network.Stream) {}, WithAlgorithms("gzip")))
+	_, err := NewStream(context.Background(), h1, h2.ID(), testProto, WithAlgorithms("gzip"))
+	require.Error(t, err)
+}
+
+// memScope is a stream scope that records the reserved memory, and refuses reservations
+// above its limit.
+type memScope struct {
+	network.NullScope
+	limit, reserved int
+}
+
+func (s *memScope) ReserveMemory(size int, _ uint8) error {
+	if s.reserved+size > s.limit {
+		return errors.New("memory limit exceeded")
+	}
+	s.reserved += size
+	return nil
+}
+
+func (s *memScope) ReleaseMemory(size int) { s.reserved -= size }
+
+type memStream struct {
+	network.Stream
+	c     net.Conn
+	scope *memScope
+}
+
+func (s *memStream) Read(b []byte) (int, error)  { return s.c.Read(b) }
+func (s *memStream) Write(b []byte) (int, error) { return s.c.Write(b) }
+func (s *memStream) Close() error                { return s.c.Close() }
+func (s *memStream) Reset() error                { return s.c.Close() }
+func (s *memStream) Scope() network.StreamScope  { return s.scope }
+
+func TestMemoryReservation(t *testing.T) {
+	cfg, err := newConfig(nil)
+	require.NoError(t, err)
+	for _, a := range allAlgorithms {
+		t.Run(string(a), func(t *testing.T) {
+			mem := memoryUsage(a, cfg.maxWindowSize)
+			require.NotZero(t, mem)
+
+			c, _ := net.Pipe()
+			defer c.Close()
+			_, err := newCompressedStream(&memStream{c: c, scope: &memScope{limit: mem - 1}}, testProto, a, cfg)
+			require.Error(t, err)
+
+			for _, closeStream := range []func(network.Stream) error{network.Stream.Close, network.Stream.Reset} {
+				c, _ := net.Pipe()
+				scope := &memScope{limit: mem}
+				cs, err := newCompressedStream(&memStream{c: c, scope: scope}, testProto, a, cfg)
+				require.NoError(t, err)
+				require.Equal(t, mem, scope.reserved)
+				closeStream(cs)
+				require.Zero(t, scope.reserved)
+				// releasing twice is a no-op
+				cs.Reset()
+				require.Zero(t, scope.reserved)
+			}
+		})
+	}
+}
+
+func TestMaxWindowSize(t *testing.T) {
+	cfg, err := newConfig([]Option{WithMaxWindowSize(8 << 20)})
+	require.NoError(t, err)
+	require.Greater(t, memoryUsage(Zstd, cfg.maxWindowSize), memoryUsage(Zstd, defaultZstdMaxWindowSize))
+	_, err = newConfig([]Option{WithMaxWindowSize(0)})
+	require.Error(t, err)
+}
+
+func TestAlgorithmFor(t *testing.T) {
+	_, ok := algorithmFor(testProto, testProto)
+	require.False(t, ok)
+	a, ok := algorithmFor(Snappy.protocolID(testProto), testProto)
+	require.True(t, ok)
+	require.Equal(t, Snappy, a)
+	_, ok = algorithmFor(testProto+"+gzip", testProto)
+	require.False(t, ok)
+}
@@ -0,0 +1,203 @@
+package compression
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// zstdWindowSize is the window size used by the zstd encoder.
+	// It limits the memory used per stream, at the cost of a slightly lower compression ratio.
+	zstdWindowSize = 1 << 20
+	// defaultZstdMaxWindowSize is the default maximum window size the zstd decoder accepts from
+	// the remote peer. It matches the window size used by our encoder.
+	defaultZstdMaxWindowSize = zstdWindowSize
+	// zstdMaxBlockSize is the maximum block size of the zstd format.
+	zstdMaxBlockSize = 128 << 10
+	// snappyMaxBlockSize is the maximum block size of the Snappy framing format.
+	snappyMaxBlockSize = 64 << 10
+)
+
+// memoryUsage estimates the memory used by the encoder and the decoder of a stream.
+func memoryUsage(a Algorithm, maxWindow int) int {
+	switch a {
+	case Zstd:
+		// The encoder keeps a history of twice the window size.
+		// The decoder keeps a window and a block.
+		return 2*zstdWindowSize + maxWindow + zstdMaxBlockSize
+	case Snappy:
+		// The reader and the writer each buffer a compressed and an uncompressed block.
+		return 4 * snappyMaxBlockSize
+	default:
+		return 0
+	}
+}
+
+type compressWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressedStream compresses the data written to, and decompresses the data read from the underlying stream.
+type compressedStream struct {
+	network.Stream
+	proto protocol.ID
+
+	// rmu is held while reading, so that the decoder isn't released during a Read.
+	rmu        sync.Mutex
+	r          io.Reader
+	release    func()
+	readClosed bool
+
+	wmu         sync.Mutex
+	w           compressWriter
+	writeClosed bool
+
+	// reserved is the memory reserved in the stream scope for the encoder and decoder
+	reserved int
+}
+
+var _ network.Stream = &compressedStream{}
+
+// newCompressedStream sets up compression on s. The memory used by the encoder and decoder is
+// reserved in the stream scope, and released when the stream is closed or reset.
+func newCompressedStream(s network.Stream, pid protocol.ID, a Algorithm, cfg *config) (*compressedStream, error) {
+	if !a.valid() {
+		return nil, fmt.Errorf("unknown compression algorithm: %q", a)
+	}
+	mem := memoryUsage(a, cfg.maxWindowSize)
+	if err := s.Scope().ReserveMemory(mem, network.ReservationPriorityMedium); err != nil {
+		return nil, fmt.Errorf("failed to reserve memory for compression: %w", err)
+	}
+	cs, err := newCompressor(s, pid, a, cfg)
+	if err != nil {
+		s.Scope().ReleaseMemory(mem)
+		return nil, err
+	}
+	cs.reserved = mem
+	return cs, nil
+}
+
+func newCompressor(s network.Stream, pid protocol.ID, a Algorithm, cfg *config) (*compressedStream, error) {
+	cs := &compressedStream{Stream: s, proto: pid}
+	switch a {
+	case Zstd:
+		w, err := zstd.NewWriter(s,
+			zstd.WithEncoderConcurrency(1),
+			zstd.WithWindowSize(zstdWindowSize),
+			zstd.WithEncoderLevel(zstd.SpeedFastest),
+		)
+		if err != nil {
+			return nil, err
+		}
+		r, err := zstd.NewReader(s,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderLowmem(true),
+			zstd.WithDecoderMaxWindow(uint64(cfg.maxWindowSize)),
+		)
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		cs.w = w
+		cs.r = r
+		cs.release = r.Close
+	case Snappy:
+		cs.w = s2.NewWriter(s, s2.WriterSnappyCompat(), s2.WriterConcurrency(1))
+		cs.r = s2.NewReader(s, s2.ReaderMaxBlockSize(snappyMaxBlockSize))
+	default:
+		return nil, fmt.Errorf("unknown compression algorithm: %q", a)
+	}
+	return cs, nil
+}
+
+// Protocol returns the uncompressed protocol ID.
+func (s *compressedStream) Protocol() protocol.ID {
+	return s.proto
+}
+
+func (s *compressedStream) Read(b []byte) (int, error) {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	if s.readClosed {
+		return 0, network.ErrReset
+	}
+	return s.r.Read(b)
+}
+
+// Write compresses and flushes b.
+func (s *compressedStream) Write(b []byte) (int, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	if s.writeClosed {
+		return 0, network.ErrReset
+	}
+	if _, err := s.w.Write(b); err != nil {
+		return 0, err
+	}
+	if err := s.w.Flush(); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// closeWriter ends the compressed stream. It doesn't close the underlying stream.
+func (s *compressedStream) closeWriter() error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	if s.writeClosed {
+		return nil
+	}
+	s.writeClosed = true
+	return s.w.Close()
+}
+
+// releaseReader releases the decoder and the reserved memory. It waits for a concurrent Read to
+// return, so the underlying stream must be closed or reset first, to unblock the Read.
+func (s *compressedStream) releaseReader() {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	if s.readClosed {
+		return
+	}
+	s.readClosed = true
+	if s.release != nil {
+		s.release()
+	}
+	s.Stream.Scope().ReleaseMemory(s.reserved)
+}
+
+func (s *compressedStream) CloseWrite() error {
+	if err := s.closeWriter(); err != nil {
+		s.Stream.Reset()
+		return err
+	}
+	return s.Stream.CloseWrite()
+}
+
+func (s *compressedStream) Close() error {
+	if err := s.closeWriter(); err != nil {
+		s.Stream.Reset()
+		s.releaseReader()
+		return err
+	}
+	err := s.Stream.Close()
+	s.releaseReader()
+	return err
+}
+
+func (s *compressedStream) Reset() error {
+	s.wmu.Lock()
+	s.writeClosed = true
+	s.wmu.Unlock()
+	err := s.Stream.Reset()
+	s.releaseReader()
+	return err
+}
@@ -0,0 +1,261 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+)
+
+// ExportedEvent is an event serialized by an Exporter.
+type ExportedEvent struct {
+	// Time is the time the event was received by the exporter.
+	Time time.Time `json:"time"`
+	// Type is the Go type of the event, e.g. event.EvtLocalReachabilityChanged.
+	Type string `json:"type"`
+	// Event is the event.
+	Event interface{} `json:"event"`
+}
+
+// ExportEncoder writes an exported event to w.
+type ExportEncoder func(w io.Writer, evt ExportedEvent) error
+
+// NDJSONEncoder writes every event as a single line of JSON (newline-delimited JSON).
+// It is the default encoder of an Exporter.
+func NDJSONEncoder(w io.Writer, evt ExportedEvent) error {
+	return json.NewEncoder(w).Encode(evt)
+}
+
+const defaultExportQueueSize = 256
+
+type exportConfig struct {
+	types     []interface{}
+	filter    func(interface{}) bool
+	encoder   ExportEncoder
+	rate      float64
+	burst     int
+	queueSize int
+}
+
+// ExportOption is an option for NewExporter.
+type ExportOption func(*exportConfig) error
+
+// ExportTypes restricts the exported events to the given event types, for example
+// new(event.EvtLocalReachabilityChanged). By default, all events are exported.
+func ExportTypes(types ...interface{}) ExportOption {
+	return func(cfg *exportConfig) error {
+		if len(types) == 0 {
+			return errors.New("no event types")
+		}
+		cfg.types = append(cfg.types, types...)
+		return nil
+	}
+}
+
+// ExportFilter only exports the events for which filter returns true.
+func ExportFilter(filter func(evt interface{}) bool) ExportOption {
+	return func(cfg *exportConfig) error {
+		cfg.filter = filter
+		return nil
+	}
+}
+
+// ExportEncoding sets the encoder used to serialize events, e.g. to convert them into
+// OpenTelemetry log records. Defaults to NDJSONEncoder.
+func ExportEncoding(enc ExportEncoder) ExportOption {
+	return func(cfg *exportConfig) error {
+		if enc == nil {
+			return errors.New("nil encoder")
+		}
+		cfg.encoder = enc
+		return nil
+	}
+}
+
+// ExportRateLimit limits the number of exported events to perSecond, allowing bursts of up
+// to burst events. Events exceeding the limit are dropped. By default, the rate is not limited.
+func ExportRateLimit(perSecond float64, burst int) ExportOption {
+	return func(cfg *exportConfig) error {
+		if perSecond <= 0 || burst <= 0 {
+			return errors.New("rate and burst must be positive")
+		}
+		cfg.rate = perSecond
+		cfg.burst = burst
+		return nil
+	}
+}
+
+// ExportQueueSize sets the number of events queued while the writer is busy.
+// Events are dropped when the queue is full, so that a slow writer never blocks the event bus.
+// Defaults to 256.
+func ExportQueueSize(n int) ExportOption {
+	return func(cfg *exportConfig) error {
+		if n <= 0 {
+			return errors.New("queue size must be positive")
+		}
+		cfg.queueSize = n
+		return nil
+	}
+}
+
+// Exporter serializes the events emitted on an event bus, so that they can be consumed by
+// external processes, e.g. by writing them to a file or a socket.
+type Exporter struct {
+	sub     event.Subscription
+	cfg     exportConfig
+	w       io.Writer
+	queue   chan ExportedEvent
+	dropped atomic.Uint64
+	errors  atomic.Uint64
+
+	// tokens and lastRefill implement the rate limit. Only accessed by the subscription loop.
+	tokens     float64
+	lastRefill time.Time
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewExporter exports the events emitted on bus to w.
+// Writes to w are serialized, and happen on a separate go-routine.
+func NewExporter(bus event.Bus, w io.Writer, opts ...ExportOption) (*Exporter, error) {
+	cfg := exportConfig{
+		encoder:   NDJSONEncoder,
+		queueSize: defaultExportQueueSize,
+	}
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return nil, err
+		}
+	}
+	var types interface{} = event.WildcardSubscription
+	if len(cfg.types) > 0 {
+		types = cfg.types
+	}
+	sub, err := bus.Subscribe(types, Name("exporter"))
+	if err != nil {
+		return nil, err
+	}
+	e := &Exporter{
+		sub:        sub,
+		cfg:        cfg,
+		w:          w,
+		queue:      make(chan ExportedEvent, cfg.queueSize),
+		tokens:     float64(cfg.burst),
+		lastRefill: time.Now(),
+		done:       make(chan struct{}),
+	}
+	e.wg.Add(2)
+	go e.subscriptionLoop()
+	go e.writeLoop()
+	return e, nil
+}
+
+func (e *Exporter) subscriptionLoop() {
+	defer e.wg.Done()
+	defer close(e.queue)
+	for {
+		select {
+		case evt, ok := <-e.sub.Out():
+			if !ok {
+				return
+			}
+			e.handle(evt)
+		case <-e.done:
+			// export the events that were emitted before the exporter was closed
+			for {
+				select {
+				case evt, ok := <-e.sub.Out():
+					if !ok {
+						return
+					}
+					e.handle(evt)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (e *Exporter) handle(evt interface{}) {
+	if e.cfg.filter != nil && !e.cfg.filter(evt) {
+		return
+	}
+	now := time.Now()
+	if !e.allow(now) {
+		e.dropped.Add(1)
+		return
+	}
+	select {
+	case e.queue <- ExportedEvent{Time: now, Type: reflect.TypeOf(evt).String(), Event: evt}:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+// allow applies the rate limit.
+func (e *Exporter) allow(now time.Time) bool {
+	if e.cfg.rate == 0 {
+		return true
+	}
+	e.tokens += now.Sub(e.lastRefill).Seconds() * e.cfg.rate
+	if e.tokens > float64(e.cfg.burst) {
+		e.tokens = float64(e.cfg.burst)
+	}
+	e.lastRefill = now
+	if e.tokens < 1 {
+		return false
+	}
+	e.tokens--
+	return true
+}
+
+func (e *Exporter) writeLoop() {
+	defer e.wg.Done()
+	for evt := range e.queue {
+		if err := e.cfg.encoder(e.w, evt); err != nil {
+			e.errors.Add(1)
+		}
+	}
+}
+
+// Dropped returns the number of events that were dropped, either because of the rate limit,
+// or because the writer couldn't keep up.
+func (e *Exporter) Dropped() uint64 {
+	return e.dropped.Load()
+}
+
+// Errors returns the number of events that couldn't be encoded or written.
+func (e *Exporter) Errors() uint64 {
+	return e.errors.Load()
+}
+
+// Close stops exporting events. It waits until all queued events have been written.
+func (e *Exporter) Close() error {
+	close(e.done)
+	e.wg.Wait()
+
+	// Keep consuming events while unsubscribing, so that emitters don't block.
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case _, ok := <-e.sub.Out():
+				if !ok {
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	err := e.sub.Close()
+	close(stop)
+	return err
+}
@@ -0,0 +1,136 @@
+package eventbus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+
+	"github.com/stretchr/testify/require"
+)
+
+// lockedBuffer is a bytes.Buffer that is safe for concurrent use.
+type lockedBuffer struct {
+	mx  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) lines(t *testing.T) []map[string]interface{} {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(b.buf.Bytes()))
+	for scanner.Scan() {
+		var m map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &m))
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestExportNDJSON(t *testing.T) {
+	bus := NewBus()
+	var buf lockedBuffer
+	exp, err := NewExporter(bus, &buf, ExportTypes(new(event.EvtLocalReachabilityChanged)))
+	require.NoError(t, err)
+
+	em, err := bus.Emitter(new(event.EvtLocalReachabilityChanged))
+	require.NoError(t, err)
+	defer em.Close()
+	other, err := bus.Emitter(new(EventB))
+	require.NoError(t, err)
+	defer other.Close()
+
+	require.NoError(t, other.Emit(EventB(1)))
+	require.NoError(t, em.Emit(event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityPublic}))
+	require.NoError(t, em.Emit(event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityPrivate}))
+	require.NoError(t, exp.Close())
+
+	lines := buf.lines(t)
+	require.Len(t, lines, 2)
+	for i, r := range []network.Reachability{network.ReachabilityPublic, network.ReachabilityPrivate} {
+		require.Equal(t, "event.EvtLocalReachabilityChanged", lines[i]["type"])
+		require.NotEmpty(t, lines[i]["time"])
+		require.Equal(t, map[string]interface{}{"Reachability": float64(r)}, lines[i]["event"])
+	}
+	require.Zero(t, exp.Dropped())
+	require.Zero(t, exp.Errors())
+}
+
+func TestExportFilter(t *testing.T) {
+	bus := NewBus()
+	var buf lockedBuffer
+	exp, err := NewExporter(bus, &buf, ExportFilter(func(evt interface{}) bool {
+		b, ok := evt.(EventB)
+		return ok && b%2 == 0
+	}))
+	require.NoError(t, err)
+
+	em, err := bus.Emitter(new(EventB))
+	require.NoError(t, err)
+	defer em.Close()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, em.Emit(EventB(i)))
+	}
+	require.NoError(t, exp.Close())
+
+	lines := buf.lines(t)
+	require.Len(t, lines, 5)
+	for i, l := range lines {
+		require.Equal(t, "eventbus.EventB", l["type"])
+		require.Equal(t, float64(2*i), l["event"])
+	}
+}
+
+func TestExportRateLimit(t *testing.T) {
+	bus := NewBus()
+	var buf lockedBuffer
+	// a rate this low won't refill a token during the test
+	exp, err := NewExporter(bus, &buf, ExportRateLimit(0.001, 3))
+	require.NoError(t, err)
+
+	em, err := bus.Emitter(new(EventB))
+	require.NoError(t, err)
+	defer em.Close()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, em.Emit(EventB(i)))
+	}
+	require.NoError(t, exp.Close())
+
+	require.Len(t, buf.lines(t), 3)
+	require.Equal(t, uint64(7), exp.Dropped())
+}
+
+func TestExportEncoding(t *testing.T) {
+	bus := NewBus()
+	var mx sync.Mutex
+	var types []string
+	exp, err := NewExporter(bus, io.Discard, ExportEncoding(func(w io.Writer, evt ExportedEvent) error {
+		mx.Lock()
+		defer mx.Unlock()
+		types = append(types, evt.Type)
+		return nil
+	}))
+	require.NoError(t, err)
+
+	em, err := bus.Emitter(new(EventA))
+	require.NoError(t, err)
+	defer em.Close()
+	require.NoError(t, em.Emit(EventA{}))
+	require.NoError(t, exp.Close())
+
+	mx.Lock()
+	defer mx.Unlock()
+	require.Equal(t, []string{"eventbus.EventA"}, types)
+}
@@ -0,0 +1,380 @@
+// Package health computes an aggregate health score for a libp2p node.
+//
+// The health score is a single value between 0 (unhealthy) and 1 (healthy), composed of
+// a number of factors (reachability, relay dependence, dial success rate, resource pressure and
+// connection churn). Every factor is scored between 0 and 1 as well, and the health score
+// is the weighted average of the factor scores.
+// The score and the factor scores are exported as Prometheus metrics, giving operators a single
+// alertable signal.
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+
+	logging "github.com/ipfs/go-log/v2"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var log = logging.Logger("health")
+
+// Factor is a factor contributing to the health score.
+type Factor string
+
+const (
+	// FactorReachability scores our reachability, as determined by AutoNAT.
+	// Public reachability scores 1, unknown reachability 0.5 and private reachability 0.
+	FactorReachability Factor = "reachability"
+	// FactorRelayDependence scores the fraction of our connections that are not relayed.
+	FactorRelayDependence Factor = "relay_dependence"
+	// FactorDialSuccess scores the success rate of the most recent dials.
+	FactorDialSuccess Factor = "dial_success"
+	// FactorResourcePressure scores the utilization of the resource manager's system scope.
+	// It is 1 minus the utilization of the most utilized resource.
+	FactorResourcePressure Factor = "resource_pressure"
+	// FactorChurn scores the connection churn, i.e. the number of connections opened and closed
+	// per minute, relative to the number of open connections.
+	FactorChurn Factor = "churn"
+)
+
+// Factors are all factors contributing to the health score.
+var Factors = []Factor{FactorReachability, FactorRelayDependence, FactorDialSuccess, FactorResourcePressure, FactorChurn}
+
+const (
+	defaultInterval   = 30 * time.Second
+	defaultDialWindow = 100
+)
+
+// Report is the result of a health score computation.
+type Report struct {
+	// Time is the time the report was computed.
+	Time time.Time
+	// Score is the health score, between 0 (unhealthy) and 1 (healthy).
+	Score float64
+	// Factors contains the scores of the factors contributing to the health score.
+	Factors map[Factor]float64
+}
+
+type Option func(*Monitor) error
+
+// WithInterval sets the interval at which the health score is computed.
+// Default: 30 seconds.
+func WithInterval(d time.Duration) Option {
+	return func(m *Monitor) error {
+		if d <= 0 {
+			return errors.New("health: interval must be positive")
+		}
+		m.interval = d
+		return nil
+	}
+}
+
+// WithWeight sets the weight of a factor in the health score.
+// By default, all factors have a weight of 1. A weight of 0 excludes the factor from the health score.
+func WithWeight(f Factor, weight float64) Option {
+	return func(m *Monitor) error {
+		if _, ok := m.weights[f]; !ok {
+			return errors.New("health: unknown factor")
+		}
+		if weight < 0 {
+			return errors.New("health: weight must not be negative")
+		}
+		m.weights[f] = weight
+		return nil
+	}
+}
+
+// WithDialWindow sets the number of most recent dials used to compute the dial success rate.
+// Default: 100.
+func WithDialWindow(n int) Option {
+	return func(m *Monitor) error {
+		if n <= 0 {
+			return errors.New("health: dial window must be positive")
+		}
+		m.dials = make([]bool, n)
+		return nil
+	}
+}
+
+// WithMetricsTracer configures the Monitor to use the given MetricsTracer.
+func WithMetricsTracer(mt MetricsTracer) Option {
+	return func(m *Monitor) error {
+		m.metricsTracer = mt
+		return nil
+	}
+}
+
+// Monitor periodically computes the health score of a node.
+type Monitor struct {
+	interval      time.Duration
+	weights       map[Factor]float64
+	metricsTracer MetricsTracer
+
+	host     host.Host
+	notifiee network.Notifiee
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	refCount  sync.WaitGroup
+
+	mx           sync.Mutex
+	reachability network.Reachability
+	// dials is a ring buffer of the outcomes of the most recent dials
+	dials      []bool
+	dialsNext  int
+	dialsCount int
+	// connEvents is the number of connections opened and closed since the last computation
+	connEvents int
+	lastUpdate time.Time
+	report     Report
+}
+
+// NewMonitor creates a new Monitor. It doesn't do anything until Start is called.
+// The Monitor is constructed separately from starting it, so that SwarmMetricsTracer
+// can be used when constructing the swarm.
+func NewMonitor(opts ...Option) (*Monitor, error) {
+	m := &Monitor{
+		interval: defaultInterval,
+		weights:  make(map[Factor]float64, len(Factors)),
+		dials:    make([]bool, defaultDialWindow),
+	}
+	for _, f := range Factors {
+		m.weights[f] = 1
+	}
+	for _, opt := range opts {
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+	m.ctx, m.ctxCancel = context.WithCancel(context.Background())
+	return m, nil
+}
+
+// Start starts monitoring the host.
+func (m *Monitor) Start(h host.Host) error {
+	sub, err := h.EventBus().Subscribe(new(event.EvtLocalReachabilityChanged), eventbus.Name("health"))
+	if err != nil {
+		return err
+	}
+	m.host = h
+	m.lastUpdate = time.Now()
+	m.notifiee = &network.NotifyBundle{
+		ConnectedF:    func(network.Network, network.Conn) { m.connEvent() },
+		DisconnectedF: func(network.Network, network.Conn) { m.connEvent() },
+	}
+	h.Network().Notify(m.notifiee)
+
+	m.refCount.Add(1)
+	go m.background(sub)
+	return nil
+}
+
+func (m *Monitor) background(sub event.Subscription) {
+	defer m.refCount.Done()
+	defer sub.Close()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	m.update(time.Now())
+	for {
+		select {
+		case e, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			m.mx.Lock()
+			m.reachability = e.(event.EvtLocalReachabilityChanged).Reachability
+			m.mx.Unlock()
+		case now := <-ticker.C:
+			m.update(now)
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// Close stops the Monitor.
+func (m *Monitor) Close() error {
+	m.ctxCancel()
+	m.refCount.Wait()
+	if m.host != nil {
+		m.host.Network().StopNotify(m.notifiee)
+	}
+	return nil
+}
+
+// Report returns the most recently computed health report.
+func (m *Monitor) Report() Report {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	r := m.report
+	r.Factors = make(map[Factor]float64, len(m.report.Factors))
+	for f, s := range m.report.Factors {
+		r.Factors[f] = s
+	}
+	return r
+}
+
+func (m *Monitor) connEvent() {
+	m.mx.Lock()
+	m.connEvents++
+	m.mx.Unlock()
+}
+
+func (m *Monitor) dialCompleted(success bool) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.dials[m.dialsNext] = success
+	m.dialsNext = (m.dialsNext + 1) % len(m.dials)
+	if m.dialsCount < len(m.dials) {
+		m.dialsCount++
+	}
+}
+
+func (m *Monitor) update(now time.Time) {
+	// Collect the information that doesn't require holding the lock first.
+	var numConns, numRelayed int
+	for _, c := range m.host.Network().Conns() {
+		numConns++
+		if isRelayed(c) {
+			numRelayed++
+		}
+	}
+	pressure := resourcePressure(m.host.Network().ResourceManager())
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	factors := make(map[Factor]float64, len(Factors))
+	switch m.reachability {
+	case network.ReachabilityPublic:
+		factors[FactorReachability] = 1
+	case network.ReachabilityPrivate:
+		factors[FactorReachability] = 0
+	default:
+		factors[FactorReachability] = 0.5
+	}
+
+	factors[FactorRelayDependence] = 1
+	if numConns > 0 {
+		factors[FactorRelayDependence] = 1 - float64(numRelayed)/float64(numConns)
+	}
+
+	factors[FactorDialSuccess] = 1
+	if m.dialsCount > 0 {
+		var successes int
+		for i := 0; i < m.dialsCount; i++ {
+			if m.dials[i] {
+				successes++
+			}
+		}
+		factors[FactorDialSuccess] = float64(successes) / float64(m.dialsCount)
+	}
+
+	factors[FactorResourcePressure] = 1 - pressure
+
+	// Churn is the number of connection events per minute, relative to the number of connections.
+	// A churn of 1 means that (on average) every connection is replaced once per minute.
+	var churn float64
+	if elapsed := now.Sub(m.lastUpdate); elapsed > 0 {
+		conns := numConns
+		if conns < 1 {
+			conns = 1
+		}
+		// every replaced connection results in two events: one close and one open
+		churn = float64(m.connEvents) / 2 / float64(conns) / elapsed.Minutes()
+	}
+	factors[FactorChurn] = 1 - clamp(churn)
+	m.connEvents = 0
+	m.lastUpdate = now
+
+	var total, totalWeight float64
+	for f, s := range factors {
+		total += s * m.weights[f]
+		totalWeight += m.weights[f]
+	}
+	m.report = Report{Time: now, Score: 1, Factors: factors}
+	if totalWeight > 0 {
+		m.report.Score = total / totalWeight
+	}
+	log.Debugw("updated health score", "score", m.report.Score, "factors", factors)
+
+	if m.metricsTracer != nil {
+		m.metricsTracer.UpdatedScore(m.report)
+	}
+}
+
+func isRelayed(c network.Conn) bool {
+	_, err := c.RemoteMultiaddr().ValueForProtocol(ma.P_CIRCUIT)
+	return err == nil
+}
+
+// resourcePressure returns the utilization of the most utilized resource of the system scope,
+// between 0 and 1. It returns 0 if the resource manager doesn't expose its limits.
+func resourcePressure(rm network.ResourceManager) float64 {
+	var pressure float64
+	_ = rm.ViewSystem(func(s network.ResourceScope) error {
+		limiter, ok := s.(rcmgr.ResourceScopeLimiter)
+		if !ok {
+			return nil
+		}
+		limit := limiter.Limit()
+		stat := s.Stat()
+		for _, u := range []struct {
+			used  int64
+			limit int64
+		}{
+			{stat.Memory, limit.GetMemoryLimit()},
+			{int64(stat.NumConnsInbound + stat.NumConnsOutbound), int64(limit.GetConnTotalLimit())},
+			{int64(stat.NumStreamsInbound + stat.NumStreamsOutbound), int64(limit.GetStreamTotalLimit())},
+			{int64(stat.NumFD), int64(limit.GetFDLimit())},
+		} {
+			if u.limit <= 0 {
+				continue
+			}
+			if p := float64(u.used) / float64(u.limit); p > pressure {
+				pressure = p
+			}
+		}
+		return nil
+	})
+	return clamp(pressure)
+}
+
+func clamp(v float64) float64 {
+	if v < 0 {
+		return 0
+	}
+	if v > 1 {
+		return 1
+	}
+	return v
+}
+
+// SwarmMetricsTracer wraps a swarm.MetricsTracer, feeding the outcome of dials into the Monitor.
+// next must not be nil.
+func (m *Monitor) SwarmMetricsTracer(next swarm.MetricsTracer) swarm.MetricsTracer {
+	return &swarmMetricsTracer{MetricsTracer: next, m: m}
+}
+
+type swarmMetricsTracer struct {
+	swarm.MetricsTracer
+	m *Monitor
+}
+
+func (t *swarmMetricsTracer) DialCompleted(success bool, totalDials int) {
+	t.m.dialCompleted(success)
+	t.MetricsTracer.DialCompleted(success, totalDials)
+}
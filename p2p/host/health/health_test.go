@@ -0,0 +1,108 @@
+package health
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	blankhost "github.com/libp2p/go-libp2p/p2p/host/blank"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mockMetricsTracer struct {
+	mx      sync.Mutex
+	reports []Report
+}
+
+func (t *mockMetricsTracer) UpdatedScore(r Report) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	t.reports = append(t.reports, r)
+}
+
+func (t *mockMetricsTracer) numReports() int {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return len(t.reports)
+}
+
+func TestOptions(t *testing.T) {
+	for _, opt := range []Option{
+		WithInterval(0),
+		WithWeight("foobar", 1),
+		WithWeight(FactorChurn, -1),
+		WithDialWindow(0),
+	} {
+		_, err := NewMonitor(opt)
+		require.Error(t, err)
+	}
+}
+
+func TestHealthScore(t *testing.T) {
+	h := blankhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h.Close()
+
+	mt := &mockMetricsTracer{}
+	m, err := NewMonitor(WithInterval(time.Hour), WithDialWindow(4), WithMetricsTracer(mt))
+	require.NoError(t, err)
+	require.NoError(t, m.Start(h))
+	defer m.Close()
+
+	// The first report is computed when the monitor is started.
+	require.Eventually(t, func() bool { return mt.numReports() > 0 }, time.Second, 10*time.Millisecond)
+	r := m.Report()
+	require.Equal(t, 0.5, r.Factors[FactorReachability])
+	require.Equal(t, 1.0, r.Factors[FactorRelayDependence])
+	require.Equal(t, 1.0, r.Factors[FactorDialSuccess])
+	require.Equal(t, 1.0, r.Factors[FactorChurn])
+	require.Len(t, r.Factors, len(Factors))
+
+	emitter, err := h.EventBus().Emitter(new(event.EvtLocalReachabilityChanged))
+	require.NoError(t, err)
+	require.NoError(t, emitter.Emit(event.EvtLocalReachabilityChanged{Reachability: network.ReachabilityPublic}))
+	require.Eventually(t, func() bool {
+		m.mx.Lock()
+		defer m.mx.Unlock()
+		return m.reachability == network.ReachabilityPublic
+	}, time.Second, 10*time.Millisecond)
+
+	// Only the most recent dials are taken into account.
+	tracer := m.SwarmMetricsTracer(swarm.NewMetricsTracer())
+	for _, success := range []bool{false, false, true, false, true, true} {
+		tracer.DialCompleted(success, 1)
+	}
+
+	m.update(time.Now())
+	r = m.Report()
+	require.Equal(t, 1.0, r.Factors[FactorReachability])
+	require.Equal(t, 0.75, r.Factors[FactorDialSuccess])
+	require.Greater(t, r.Score, 0.0)
+	require.LessOrEqual(t, r.Score, 1.0)
+	require.Equal(t, 2, mt.numReports())
+}
+
+func TestHealthScoreWeights(t *testing.T) {
+	h := blankhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h.Close()
+
+	opts := []Option{WithInterval(time.Hour), WithDialWindow(2)}
+	for _, f := range Factors {
+		if f != FactorDialSuccess {
+			opts = append(opts, WithWeight(f, 0))
+		}
+	}
+	m, err := NewMonitor(opts...)
+	require.NoError(t, err)
+	m.host = h
+	m.lastUpdate = time.Now()
+
+	m.dialCompleted(true)
+	m.dialCompleted(false)
+	m.update(time.Now())
+	require.Equal(t, 0.5, m.Report().Score)
+}
@@ -0,0 +1,74 @@
+package health
+
+import (
+	"github.com/libp2p/go-libp2p/p2p/metricshelper"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricNamespace = "libp2p_health"
+
+var (
+	score = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Name:      "score",
+			Help:      "Node health score, between 0 (unhealthy) and 1 (healthy)",
+		},
+	)
+	factorScore = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: metricNamespace,
+			Name:      "factor_score",
+			Help:      "Score of the factors contributing to the node health score, between 0 (unhealthy) and 1 (healthy)",
+		},
+		[]string{"factor"},
+	)
+	collectors = []prometheus.Collector{
+		score,
+		factorScore,
+	}
+)
+
+// MetricsTracer tracks metrics for the health monitor.
+type MetricsTracer interface {
+	// UpdatedScore is called every time the health score is computed.
+	UpdatedScore(Report)
+}
+
+type metricsTracer struct{}
+
+var _ MetricsTracer = &metricsTracer{}
+
+type metricsTracerSetting struct {
+	reg prometheus.Registerer
+}
+
+type MetricsTracerOption func(*metricsTracerSetting)
+
+func WithRegisterer(reg prometheus.Registerer) MetricsTracerOption {
+	return func(s *metricsTracerSetting) {
+		if reg != nil {
+			s.reg = reg
+		}
+	}
+}
+
+func NewMetricsTracer(opts ...MetricsTracerOption) MetricsTracer {
+	setting := &metricsTracerSetting{reg: prometheus.DefaultRegisterer}
+	for _, opt := range opts {
+		opt(setting)
+	}
+	metricshelper.RegisterCollectors(setting.reg, collectors...)
+	return &metricsTracer{}
+}
+
+func (mt *metricsTracer) UpdatedScore(r Report) {
+	score.Set(r.Score)
+	for f, s := range r.Factors {
+		tags := metricshelper.GetStringSlice()
+		*tags = append(*tags, string(f))
+		factorScore.WithLabelValues(*tags...).Set(s)
+		metricshelper.PutStringSlice(tags)
+	}
+}
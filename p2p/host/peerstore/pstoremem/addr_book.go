@@ -30,6 +30,25 @@ func (e *expiringAddr) ExpiredBy(t time.Time) bool {
 type peerRecordState struct {
 	Envelope *record.Envelope
 	Seq      uint64
+	// TTL and Expires are the TTL the record was consumed with, and its expiration time.
+	TTL     time.Duration
+	Expires time.Time
+}
+
+func (s *peerRecordState) ExpiredBy(t time.Time) bool {
+	return !t.Before(s.Expires)
+}
+
+// recordRenewalInterval is the interval at which we check for signed peer records that are about to expire.
+const recordRenewalInterval = time.Minute
+
+// recordRenewal is a callback registered using NotifyRecordRenewal.
+type recordRenewal struct {
+	before time.Duration
+	f      func(peer.ID)
+	// lastCheck is the time of the last check for expiring records.
+	// Records expiring up to lastCheck+before have already been reported.
+	lastCheck time.Time
 }
 
 type addrSegments [256]*addrSegment
@@ -70,11 +89,17 @@ type memoryAddrBook struct {
 	cancel   func()
 
 	subManager *AddrSubManager
+	changes    changeFeed[pstore.AddrChange]
 	clock      clock
+
+	renewalsMu sync.Mutex
+	renewals   map[*recordRenewal]struct{}
 }
 
 var _ pstore.AddrBook = (*memoryAddrBook)(nil)
 var _ pstore.CertifiedAddrBook = (*memoryAddrBook)(nil)
+var _ pstore.AddrBookNotifier = (*memoryAddrBook)(nil)
+var _ pstore.RecordRenewalNotifier = (*memoryAddrBook)(nil)
 
 func NewAddrBook() *memoryAddrBook {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -91,6 +116,7 @@ func NewAddrBook() *memoryAddrBook {
 		subManager: NewAddrSubManager(),
 		cancel:     cancel,
 		clock:      realclock{},
+		renewals:   make(map[*recordRenewal]struct{}),
 	}
 	ab.refCount.Add(1)
 	go ab.background(ctx)
@@ -111,11 +137,15 @@ func (mab *memoryAddrBook) background(ctx context.Context) {
 	defer mab.refCount.Done()
 	ticker := time.NewTicker(1 * time.Hour)
 	defer ticker.Stop()
+	renewalTicker := time.NewTicker(recordRenewalInterval)
+	defer renewalTicker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
 			mab.gc()
+		case <-renewalTicker.C:
+			mab.checkRenewals()
 		case <-ctx.Done():
 			return
 		}
@@ -131,19 +161,30 @@ func (mab *memoryAddrBook) Close() error {
 // gc garbage collects the in-memory address book.
 func (mab *memoryAddrBook) gc() {
 	now := mab.clock.Now()
+	notify := mab.changes.hasSubscribers()
 	for _, s := range mab.segments {
 		s.Lock()
 		for p, amap := range s.addrs {
+			var expired []ma.Multiaddr
 			for k, addr := range amap {
 				if addr.ExpiredBy(now) {
 					delete(amap, k)
+					if notify {
+						expired = append(expired, addr.Addr)
+					}
 				}
 			}
+			mab.publishChange(p, pstore.ChangeExpired, expired)
 			if len(amap) == 0 {
 				delete(s.addrs, p)
 				delete(s.signedPeerRecords, p)
 			}
 		}
+		for p, state := range s.signedPeerRecords {
+			if state.ExpiredBy(now) {
+				delete(s.signedPeerRecords, p)
+			}
+		}
 		s.Unlock()
 	}
 }
@@ -211,6 +252,8 @@ func (mab *memoryAddrBook) ConsumePeerRecord(recordEnvelope *record.Envelope, tt
 	s.signedPeerRecords[rec.PeerID] = &peerRecordState{
 		Envelope: recordEnvelope,
 		Seq:      rec.Seq,
+		TTL:      ttl,
+		Expires:  mab.clock.Now().Add(ttl),
 	}
 	mab.addAddrsUnlocked(s, rec.PeerID, rec.Addrs, ttl, true)
 	return true, nil
@@ -236,7 +279,11 @@ func (mab *memoryAddrBook) addAddrsUnlocked(s *addrSegment, p peer.ID, addrs []m
 		s.addrs[p] = amap
 	}
 
-	exp := mab.clock.Now().Add(ttl)
+	now := mab.clock.Now()
+	exp := now.Add(ttl)
+	notify := mab.changes.hasSubscribers()
+	var added []ma.Multiaddr
+	defer func() { mab.publishChange(p, pstore.ChangeAdded, added) }()
 	for _, addr := range addrs {
 		// Remove suffix of /p2p/peer-id from address
 		addr, addrPid := peer.SplitAddr(addr)
@@ -256,7 +303,19 @@ func (mab *memoryAddrBook) addAddrsUnlocked(s *addrSegment, p peer.ID, addrs []m
 			entry := &expiringAddr{Addr: addr, Expires: exp, TTL: ttl}
 			amap[string(addr.Bytes())] = entry
 			mab.subManager.BroadcastAddr(p, addr)
+			if notify {
+				added = append(added, addr)
+			}
 		} else {
+			if notify && a.ExpiredBy(now) {
+				added = append(added, addr)
+			}
+			// certified addresses expire exactly when the record they were certified by expires
+			if signed {
+				a.TTL = ttl
+				a.Expires = exp
+				continue
+			}
 			// update ttl & exp to whichever is greater between new and existing entry
 			if ttl > a.TTL {
 				a.TTL = ttl
@@ -286,7 +345,14 @@ func (mab *memoryAddrBook) SetAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Du
 		s.addrs[p] = amap
 	}
 
-	exp := mab.clock.Now().Add(ttl)
+	now := mab.clock.Now()
+	exp := now.Add(ttl)
+	notify := mab.changes.hasSubscribers()
+	var added, removed []ma.Multiaddr
+	defer func() {
+		mab.publishChange(p, pstore.ChangeAdded, added)
+		mab.publishChange(p, pstore.ChangeRemoved, removed)
+	}()
 	for _, addr := range addrs {
 		addr, addrPid := peer.SplitAddr(addr)
 		if addr == nil {
@@ -300,12 +366,20 @@ func (mab *memoryAddrBook) SetAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Du
 		aBytes := addr.Bytes()
 		key := string(aBytes)
 
+		a, found := amap[key]
+		valid := found && !a.ExpiredBy(now)
 		// re-set all of them for new ttl.
 		if ttl > 0 {
 			amap[key] = &expiringAddr{Addr: addr, Expires: exp, TTL: ttl}
 			mab.subManager.BroadcastAddr(p, addr)
+			if notify && !valid {
+				added = append(added, addr)
+			}
 		} else {
 			delete(amap, key)
+			if notify && valid {
+				removed = append(removed, addr)
+			}
 		}
 	}
 }
@@ -316,16 +390,22 @@ func (mab *memoryAddrBook) UpdateAddrs(p peer.ID, oldTTL time.Duration, newTTL t
 	s := mab.segments.get(p)
 	s.Lock()
 	defer s.Unlock()
-	exp := mab.clock.Now().Add(newTTL)
+	now := mab.clock.Now()
+	exp := now.Add(newTTL)
 	amap, found := s.addrs[p]
 	if !found {
 		return
 	}
 
+	notify := mab.changes.hasSubscribers()
+	var removed []ma.Multiaddr
 	for k, a := range amap {
 		if oldTTL == a.TTL {
 			if newTTL == 0 {
 				delete(amap, k)
+				if notify && !a.ExpiredBy(now) {
+					removed = append(removed, a.Addr)
+				}
 			} else {
 				a.TTL = newTTL
 				a.Expires = exp
@@ -333,6 +413,16 @@ func (mab *memoryAddrBook) UpdateAddrs(p peer.ID, oldTTL time.Duration, newTTL t
 			}
 		}
 	}
+	mab.publishChange(p, pstore.ChangeRemoved, removed)
+
+	if state, ok := s.signedPeerRecords[p]; ok && state.TTL == oldTTL {
+		if newTTL == 0 {
+			delete(s.signedPeerRecords, p)
+		} else {
+			state.TTL = newTTL
+			state.Expires = exp
+		}
+	}
 }
 
 // Addrs returns all known (and valid) addresses for a given peer
@@ -374,7 +464,7 @@ func (mab *memoryAddrBook) GetPeerRecord(p peer.ID) *record.Envelope {
 	}
 
 	state := s.signedPeerRecords[p]
-	if state == nil {
+	if state == nil || state.ExpiredBy(mab.clock.Now()) {
 		return nil
 	}
 	return state.Envelope
@@ -386,10 +476,77 @@ func (mab *memoryAddrBook) ClearAddrs(p peer.ID) {
 	s.Lock()
 	defer s.Unlock()
 
+	if mab.changes.hasSubscribers() {
+		mab.publishChange(p, pstore.ChangeRemoved, validAddrs(mab.clock.Now(), s.addrs[p]))
+	}
 	delete(s.addrs, p)
 	delete(s.signedPeerRecords, p)
 }
 
+// NotifyRecordRenewal registers f to be called when the signed peer record of a peer is about to expire.
+// See pstore.RecordRenewalNotifier for details.
+func (mab *memoryAddrBook) NotifyRecordRenewal(before time.Duration, f func(peer.ID)) (cancel func()) {
+	r := &recordRenewal{before: before, f: f}
+	mab.renewalsMu.Lock()
+	mab.renewals[r] = struct{}{}
+	mab.renewalsMu.Unlock()
+	return func() {
+		mab.renewalsMu.Lock()
+		delete(mab.renewals, r)
+		mab.renewalsMu.Unlock()
+	}
+}
+
+// checkRenewals calls the renewal callbacks for all signed peer records that expire soon.
+func (mab *memoryAddrBook) checkRenewals() {
+	type notification struct {
+		f     func(peer.ID)
+		peers []peer.ID
+	}
+	var notifications []notification
+
+	now := mab.clock.Now()
+	mab.renewalsMu.Lock()
+	for r := range mab.renewals {
+		from, to := r.lastCheck.Add(r.before), now.Add(r.before)
+		var expiring []peer.ID
+		for _, s := range mab.segments {
+			s.RLock()
+			for p, state := range s.signedPeerRecords {
+				if state.ExpiredBy(now) || !state.Expires.After(from) || state.Expires.After(to) {
+					continue
+				}
+				expiring = append(expiring, p)
+			}
+			s.RUnlock()
+		}
+		r.lastCheck = now
+		if len(expiring) > 0 {
+			notifications = append(notifications, notification{f: r.f, peers: expiring})
+		}
+	}
+	mab.renewalsMu.Unlock()
+
+	for _, n := range notifications {
+		for _, p := range n.peers {
+			n.f(p)
+		}
+	}
+}
+
+// SubscribeAddrChanges returns a channel on which changes to the stored addresses are published.
+// See pstore.AddrBookNotifier for details.
+func (mab *memoryAddrBook) SubscribeAddrChanges(ctx context.Context) <-chan pstore.AddrChange {
+	return mab.changes.subscribe(ctx)
+}
+
+func (mab *memoryAddrBook) publishChange(p peer.ID, typ pstore.ChangeType, addrs []ma.Multiaddr) {
+	if len(addrs) == 0 {
+		return
+	}
+	mab.changes.publish(pstore.AddrChange{Peer: p, Type: typ, Addrs: addrs})
+}
+
 // AddrStream returns a channel on which all new addresses discovered for a
 // given peer ID will be published.
 func (mab *memoryAddrBook) AddrStream(ctx context.Context, p peer.ID) <-chan ma.Multiaddr {
@@ -0,0 +1,55 @@
+package pstoremem
+
+import (
+	"context"
+	"sync"
+)
+
+// changeSubBufferSize is the number of changes buffered per subscriber.
+// Changes are dropped when the buffer of a subscriber is full.
+const changeSubBufferSize = 256
+
+// changeFeed distributes changes to subscribers.
+// publish never blocks, so it can be called while holding the locks of a book.
+type changeFeed[T any] struct {
+	mu   sync.RWMutex
+	subs map[chan T]struct{}
+}
+
+func (f *changeFeed[T]) subscribe(ctx context.Context) <-chan T {
+	ch := make(chan T, changeSubBufferSize)
+	f.mu.Lock()
+	if f.subs == nil {
+		f.subs = make(map[chan T]struct{})
+	}
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		f.mu.Lock()
+		delete(f.subs, ch)
+		f.mu.Unlock()
+		close(ch)
+	}()
+	return ch
+}
+
+// hasSubscribers allows callers to skip assembling changes nobody is interested in.
+func (f *changeFeed[T]) hasSubscribers() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.subs) > 0
+}
+
+func (f *changeFeed[T]) publish(c T) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for ch := range f.subs {
+		select {
+		case ch <- c:
+		default:
+			log.Debugw("dropping peerstore change, subscriber too slow", "change", c)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package pstoremem
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/test"
+
+	mockClock "github.com/benbjohnson/clock"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func nextChange[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case c := <-ch:
+		return c
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for change")
+	}
+	panic("unreachable")
+}
+
+func requireNoChange[T any](t *testing.T, ch <-chan T) {
+	t.Helper()
+	select {
+	case c := <-ch:
+		t.Fatalf("unexpected change: %v", c)
+	default:
+	}
+}
+
+func TestAddrChanges(t *testing.T) {
+	clk := mockClock.NewMock()
+	ps, err := NewPeerstore(WithClock(clk))
+	require.NoError(t, err)
+	defer ps.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := ps.SubscribeAddrChanges(ctx)
+
+	p := test.RandPeerIDFatal(t)
+	a1 := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+	a2 := ma.StringCast("/ip4/1.2.3.4/tcp/2")
+
+	ps.AddAddrs(p, []ma.Multiaddr{a1, a2}, time.Hour)
+	require.Equal(t, pstore.AddrChange{Peer: p, Type: pstore.ChangeAdded, Addrs: []ma.Multiaddr{a1, a2}}, nextChange(t, changes))
+	// re-adding known addresses is not a change
+	ps.AddAddrs(p, []ma.Multiaddr{a1}, 2*time.Hour)
+	ps.SetAddr(p, a1, time.Hour)
+	requireNoChange(t, changes)
+
+	ps.SetAddr(p, a1, 0)
+	require.Equal(t, pstore.AddrChange{Peer: p, Type: pstore.ChangeRemoved, Addrs: []ma.Multiaddr{a1}}, nextChange(t, changes))
+	ps.UpdateAddrs(p, time.Hour, 0)
+	require.Equal(t, pstore.AddrChange{Peer: p, Type: pstore.ChangeRemoved, Addrs: []ma.Multiaddr{a2}}, nextChange(t, changes))
+
+	ps.SetAddr(p, a1, time.Minute)
+	require.Equal(t, pstore.AddrChange{Peer: p, Type: pstore.ChangeAdded, Addrs: []ma.Multiaddr{a1}}, nextChange(t, changes))
+	clk.Add(2 * time.Minute)
+	ps.gc()
+	require.Equal(t, pstore.AddrChange{Peer: p, Type: pstore.ChangeExpired, Addrs: []ma.Multiaddr{a1}}, nextChange(t, changes))
+
+	ps.AddAddr(p, a2, time.Hour)
+	require.Equal(t, pstore.ChangeAdded, nextChange(t, changes).Type)
+	ps.ClearAddrs(p)
+	require.Equal(t, pstore.AddrChange{Peer: p, Type: pstore.ChangeRemoved, Addrs: []ma.Multiaddr{a2}}, nextChange(t, changes))
+
+	cancel()
+	require.Eventually(t, func() bool {
+		_, ok := <-changes
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestProtoChanges(t *testing.T) {
+	ps, err := NewPeerstore()
+	require.NoError(t, err)
+	defer ps.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := ps.SubscribeProtoChanges(ctx)
+
+	p := test.RandPeerIDFatal(t)
+	require.NoError(t, ps.AddProtocols(p, "/a", "/b"))
+	c := nextChange(t, changes)
+	require.Equal(t, pstore.ChangeAdded, c.Type)
+	require.ElementsMatch(t, []protocol.ID{"/a", "/b"}, c.Protocols)
+	require.NoError(t, ps.AddProtocols(p, "/a"))
+	requireNoChange(t, changes)
+
+	require.NoError(t, ps.SetProtocols(p, "/b", "/c"))
+	require.Equal(t, pstore.ProtoChange{Peer: p, Type: pstore.ChangeAdded, Protocols: []protocol.ID{"/c"}}, nextChange(t, changes))
+	require.Equal(t, pstore.ProtoChange{Peer: p, Type: pstore.ChangeRemoved, Protocols: []protocol.ID{"/a"}}, nextChange(t, changes))
+
+	require.NoError(t, ps.RemoveProtocols(p, "/b", "/d"))
+	require.Equal(t, pstore.ProtoChange{Peer: p, Type: pstore.ChangeRemoved, Protocols: []protocol.ID{"/b"}}, nextChange(t, changes))
+	ps.RemovePeer(p)
+	require.Equal(t, pstore.ProtoChange{Peer: p, Type: pstore.ChangeRemoved, Protocols: []protocol.ID{"/c"}}, nextChange(t, changes))
+}
+
+func TestKeyChanges(t *testing.T) {
+	ps, err := NewPeerstore()
+	require.NoError(t, err)
+	defer ps.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := ps.SubscribeKeyChanges(ctx)
+
+	priv, pub, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	p, err := peer.IDFromPublicKey(pub)
+	require.NoError(t, err)
+
+	require.NoError(t, ps.AddPubKey(p, pub))
+	require.Equal(t, pstore.KeyChange{Peer: p, Type: pstore.ChangeAdded}, nextChange(t, changes))
+	require.NoError(t, ps.AddPubKey(p, pub))
+	requireNoChange(t, changes)
+	require.NoError(t, ps.AddPrivKey(p, priv))
+	require.Equal(t, pstore.KeyChange{Peer: p, Type: pstore.ChangeAdded, Private: true}, nextChange(t, changes))
+	ps.RemovePeer(p)
+	require.Equal(t, pstore.KeyChange{Peer: p, Type: pstore.ChangeRemoved}, nextChange(t, changes))
+}
+
+func TestSlowChangeSubscriber(t *testing.T) {
+	ps, err := NewPeerstore()
+	require.NoError(t, err)
+	defer ps.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := ps.SubscribeProtoChanges(ctx)
+
+	// The peerstore doesn't block if the subscriber doesn't read.
+	p := test.RandPeerIDFatal(t)
+	for i := 0; i < 2*changeSubBufferSize; i++ {
+		require.NoError(t, ps.SetProtocols(p, protocol.ID("/proto")))
+		ps.RemovePeer(p)
+	}
+	require.Len(t, changes, changeSubBufferSize)
+}
@@ -1,6 +1,7 @@
 package pstoremem
 
 import (
+	"context"
 	"errors"
 	"sync"
 
@@ -13,9 +14,12 @@ type memoryKeyBook struct {
 	sync.RWMutex // same lock. wont happen a ton.
 	pks          map[peer.ID]ic.PubKey
 	sks          map[peer.ID]ic.PrivKey
+
+	changes changeFeed[pstore.KeyChange]
 }
 
 var _ pstore.KeyBook = (*memoryKeyBook)(nil)
+var _ pstore.KeyBookNotifier = (*memoryKeyBook)(nil)
 
 func NewKeyBook() *memoryKeyBook {
 	return &memoryKeyBook{
@@ -62,6 +66,9 @@ func (mkb *memoryKeyBook) AddPubKey(p peer.ID, pk ic.PubKey) error {
 	}
 
 	mkb.Lock()
+	if _, ok := mkb.pks[p]; !ok {
+		mkb.changes.publish(pstore.KeyChange{Peer: p, Type: pstore.ChangeAdded})
+	}
 	mkb.pks[p] = pk
 	mkb.Unlock()
 	return nil
@@ -84,6 +91,9 @@ func (mkb *memoryKeyBook) AddPrivKey(p peer.ID, sk ic.PrivKey) error {
 	}
 
 	mkb.Lock()
+	if _, ok := mkb.sks[p]; !ok {
+		mkb.changes.publish(pstore.KeyChange{Peer: p, Type: pstore.ChangeAdded, Private: true})
+	}
 	mkb.sks[p] = sk
 	mkb.Unlock()
 	return nil
@@ -91,7 +101,18 @@ func (mkb *memoryKeyBook) AddPrivKey(p peer.ID, sk ic.PrivKey) error {
 
 func (mkb *memoryKeyBook) RemovePeer(p peer.ID) {
 	mkb.Lock()
+	_, hasPub := mkb.pks[p]
+	_, hasPriv := mkb.sks[p]
+	if hasPub || hasPriv {
+		mkb.changes.publish(pstore.KeyChange{Peer: p, Type: pstore.ChangeRemoved})
+	}
 	delete(mkb.sks, p)
 	delete(mkb.pks, p)
 	mkb.Unlock()
 }
+
+// SubscribeKeyChanges returns a channel on which changes to the stored keys are published.
+// See pstore.KeyBookNotifier for details.
+func (mkb *memoryKeyBook) SubscribeKeyChanges(ctx context.Context) <-chan pstore.KeyChange {
+	return mkb.changes.subscribe(ctx)
+}
@@ -0,0 +1,139 @@
+package pstoremem
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+)
+
+var errEmptyLabelKey = errors.New("empty label key")
+
+type memoryLabelBook struct {
+	mx     sync.RWMutex
+	labels map[peer.ID]map[string]string
+	// index maps label keys to label values to the peers labeled with them
+	index map[string]map[string]map[peer.ID]struct{}
+}
+
+var _ pstore.LabelBook = (*memoryLabelBook)(nil)
+
+func NewLabelBook() *memoryLabelBook {
+	return &memoryLabelBook{
+		labels: make(map[peer.ID]map[string]string),
+		index:  make(map[string]map[string]map[peer.ID]struct{}),
+	}
+}
+
+func (lb *memoryLabelBook) Label(p peer.ID, key, value string) error {
+	if key == "" {
+		return errEmptyLabelKey
+	}
+	lb.mx.Lock()
+	defer lb.mx.Unlock()
+
+	labels, ok := lb.labels[p]
+	if !ok {
+		labels = make(map[string]string)
+		lb.labels[p] = labels
+	}
+	if old, ok := labels[key]; ok {
+		if old == value {
+			return nil
+		}
+		lb.unindex(p, key, old)
+	}
+	labels[key] = value
+
+	values, ok := lb.index[key]
+	if !ok {
+		values = make(map[string]map[peer.ID]struct{})
+		lb.index[key] = values
+	}
+	peers, ok := values[value]
+	if !ok {
+		peers = make(map[peer.ID]struct{})
+		values[value] = peers
+	}
+	peers[p] = struct{}{}
+	return nil
+}
+
+func (lb *memoryLabelBook) Unlabel(p peer.ID, key string) {
+	lb.mx.Lock()
+	defer lb.mx.Unlock()
+
+	labels := lb.labels[p]
+	value, ok := labels[key]
+	if !ok {
+		return
+	}
+	delete(labels, key)
+	if len(labels) == 0 {
+		delete(lb.labels, p)
+	}
+	lb.unindex(p, key, value)
+}
+
+// unindex removes p from the index of the label key=value. It must be called with the lock held.
+func (lb *memoryLabelBook) unindex(p peer.ID, key, value string) {
+	values := lb.index[key]
+	peers := values[value]
+	delete(peers, p)
+	if len(peers) == 0 {
+		delete(values, value)
+	}
+	if len(values) == 0 {
+		delete(lb.index, key)
+	}
+}
+
+func (lb *memoryLabelBook) GetLabel(p peer.ID, key string) (string, bool) {
+	lb.mx.RLock()
+	defer lb.mx.RUnlock()
+	value, ok := lb.labels[p][key]
+	return value, ok
+}
+
+func (lb *memoryLabelBook) Labels(p peer.ID) map[string]string {
+	lb.mx.RLock()
+	defer lb.mx.RUnlock()
+	labels := make(map[string]string, len(lb.labels[p]))
+	for k, v := range lb.labels[p] {
+		labels[k] = v
+	}
+	return labels
+}
+
+func (lb *memoryLabelBook) PeersWithLabel(key, value string) peer.IDSlice {
+	lb.mx.RLock()
+	defer lb.mx.RUnlock()
+	peers := lb.index[key][value]
+	res := make(peer.IDSlice, 0, len(peers))
+	for p := range peers {
+		res = append(res, p)
+	}
+	return res
+}
+
+func (lb *memoryLabelBook) PeersWithLabelKey(key string) peer.IDSlice {
+	lb.mx.RLock()
+	defer lb.mx.RUnlock()
+	var res peer.IDSlice
+	for _, peers := range lb.index[key] {
+		for p := range peers {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+func (lb *memoryLabelBook) RemovePeer(p peer.ID) {
+	lb.mx.Lock()
+	defer lb.mx.Unlock()
+	for key, value := range lb.labels[p] {
+		lb.unindex(p, key, value)
+	}
+	delete(lb.labels, p)
+}
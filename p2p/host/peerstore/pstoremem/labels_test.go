@@ -0,0 +1,53 @@
+package pstoremem
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	pstore "github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/test"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabels(t *testing.T) {
+	ps, err := NewPeerstore()
+	require.NoError(t, err)
+	defer ps.Close()
+	var lb pstore.LabelBook = ps
+
+	p1, p2, p3 := test.RandPeerIDFatal(t), test.RandPeerIDFatal(t), test.RandPeerIDFatal(t)
+	require.NoError(t, lb.Label(p1, "role", "relay"))
+	require.NoError(t, lb.Label(p2, "role", "relay"))
+	require.NoError(t, lb.Label(p3, "role", "validator"))
+	require.NoError(t, lb.Label(p1, "region", "eu"))
+	require.Error(t, lb.Label(p1, "", "foo"))
+
+	require.ElementsMatch(t, peer.IDSlice{p1, p2}, lb.PeersWithLabel("role", "relay"))
+	require.ElementsMatch(t, peer.IDSlice{p3}, lb.PeersWithLabel("role", "validator"))
+	require.ElementsMatch(t, peer.IDSlice{p1, p2, p3}, lb.PeersWithLabelKey("role"))
+	require.Empty(t, lb.PeersWithLabel("role", "bootstrapper"))
+	require.Empty(t, lb.PeersWithLabelKey("unknown"))
+	require.Equal(t, map[string]string{"role": "relay", "region": "eu"}, lb.Labels(p1))
+
+	// relabeling replaces the previous value
+	require.NoError(t, lb.Label(p2, "role", "validator"))
+	v, ok := lb.GetLabel(p2, "role")
+	require.True(t, ok)
+	require.Equal(t, "validator", v)
+	require.ElementsMatch(t, peer.IDSlice{p1}, lb.PeersWithLabel("role", "relay"))
+	require.ElementsMatch(t, peer.IDSlice{p2, p3}, lb.PeersWithLabel("role", "validator"))
+
+	lb.Unlabel(p3, "role")
+	_, ok = lb.GetLabel(p3, "role")
+	require.False(t, ok)
+	require.ElementsMatch(t, peer.IDSlice{p2}, lb.PeersWithLabel("role", "validator"))
+	require.Empty(t, lb.Labels(p3))
+
+	// removing the peer removes its labels
+	ps.RemovePeer(p1)
+	require.Empty(t, lb.Labels(p1))
+	require.Empty(t, lb.PeersWithLabel("role", "relay"))
+	require.Empty(t, lb.PeersWithLabelKey("region"))
+	require.Empty(t, ps.memoryLabelBook.index["region"])
+}
@@ -16,9 +16,11 @@ type pstoremem struct {
 	*memoryAddrBook
 	*memoryProtoBook
 	*memoryPeerMetadata
+	*memoryLabelBook
 }
 
 var _ peerstore.Peerstore = &pstoremem{}
+var _ peerstore.LabelBook = &pstoremem{}
 
 type Option interface{}
 
@@ -54,6 +56,7 @@ func NewPeerstore(opts ...Option) (ps *pstoremem, err error) {
 		memoryAddrBook:     ab,
 		memoryProtoBook:    pb,
 		memoryPeerMetadata: NewPeerMetadata(),
+		memoryLabelBook:    NewLabelBook(),
 	}, nil
 }
 
@@ -104,11 +107,13 @@ func (ps *pstoremem) PeerInfo(p peer.ID) peer.AddrInfo {
 // * the KeyBook
 // * the ProtoBook
 // * the PeerMetadata
+// * the LabelBook
 // * the Metrics
 // It DOES NOT remove the peer from the AddrBook.
 func (ps *pstoremem) RemovePeer(p peer.ID) {
 	ps.memoryKeyBook.RemovePeer(p)
 	ps.memoryProtoBook.RemovePeer(p)
 	ps.memoryPeerMetadata.RemovePeer(p)
+	ps.memoryLabelBook.RemovePeer(p)
 	ps.Metrics.RemovePeer(p)
 }
@@ -1,6 +1,7 @@
 package pstoremem
 
 import (
+	"context"
 	"errors"
 	"sync"
 
@@ -29,9 +30,12 @@ type memoryProtoBook struct {
 
 	lk       sync.RWMutex
 	interned map[protocol.ID]protocol.ID
+
+	changes changeFeed[pstore.ProtoChange]
 }
 
 var _ pstore.ProtoBook = (*memoryProtoBook)(nil)
+var _ pstore.ProtoBookNotifier = (*memoryProtoBook)(nil)
 
 type ProtoBookOption func(book *memoryProtoBook) error
 
@@ -100,7 +104,23 @@ func (pb *memoryProtoBook) SetProtocols(p peer.ID, protos ...protocol.ID) error
 
 	s := pb.segments.get(p)
 	s.Lock()
+	oldprotos := s.protocols[p]
 	s.protocols[p] = newprotos
+	if pb.changes.hasSubscribers() {
+		var added, removed []protocol.ID
+		for proto := range newprotos {
+			if _, ok := oldprotos[proto]; !ok {
+				added = append(added, proto)
+			}
+		}
+		for proto := range oldprotos {
+			if _, ok := newprotos[proto]; !ok {
+				removed = append(removed, proto)
+			}
+		}
+		pb.publishChange(p, pstore.ChangeAdded, added)
+		pb.publishChange(p, pstore.ChangeRemoved, removed)
+	}
 	s.Unlock()
 
 	return nil
@@ -120,9 +140,16 @@ func (pb *memoryProtoBook) AddProtocols(p peer.ID, protos ...protocol.ID) error
 		return errTooManyProtocols
 	}
 
+	notify := pb.changes.hasSubscribers()
+	var added []protocol.ID
 	for _, proto := range protos {
-		protomap[pb.internProtocol(proto)] = struct{}{}
+		proto = pb.internProtocol(proto)
+		if _, ok := protomap[proto]; !ok && notify {
+			added = append(added, proto)
+		}
+		protomap[proto] = struct{}{}
 	}
+	pb.publishChange(p, pstore.ChangeAdded, added)
 	return nil
 }
 
@@ -150,9 +177,16 @@ func (pb *memoryProtoBook) RemoveProtocols(p peer.ID, protos ...protocol.ID) err
 		return nil
 	}
 
+	notify := pb.changes.hasSubscribers()
+	var removed []protocol.ID
 	for _, proto := range protos {
-		delete(protomap, pb.internProtocol(proto))
+		proto = pb.internProtocol(proto)
+		if _, ok := protomap[proto]; ok && notify {
+			removed = append(removed, proto)
+		}
+		delete(protomap, proto)
 	}
+	pb.publishChange(p, pstore.ChangeRemoved, removed)
 	return nil
 }
 
@@ -187,6 +221,26 @@ func (pb *memoryProtoBook) FirstSupportedProtocol(p peer.ID, protos ...protocol.
 func (pb *memoryProtoBook) RemovePeer(p peer.ID) {
 	s := pb.segments.get(p)
 	s.Lock()
+	if pb.changes.hasSubscribers() {
+		removed := make([]protocol.ID, 0, len(s.protocols[p]))
+		for proto := range s.protocols[p] {
+			removed = append(removed, proto)
+		}
+		pb.publishChange(p, pstore.ChangeRemoved, removed)
+	}
 	delete(s.protocols, p)
 	s.Unlock()
 }
+
+// SubscribeProtoChanges returns a channel on which changes to the stored protocols are published.
+// See pstore.ProtoBookNotifier for details.
+func (pb *memoryProtoBook) SubscribeProtoChanges(ctx context.Context) <-chan pstore.ProtoChange {
+	return pb.changes.subscribe(ctx)
+}
+
+func (pb *memoryProtoBook) publishChange(p peer.ID, typ pstore.ChangeType, protos []protocol.ID) {
+	if len(protos) == 0 {
+		return
+	}
+	pb.changes.publish(pstore.ProtoChange{Peer: p, Type: typ, Protocols: protos})
+}
@@ -0,0 +1,116 @@
+package pstoremem
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/core/test"
+
+	mockClock "github.com/benbjohnson/clock"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func makeSignedRecord(t *testing.T, priv crypto.PrivKey, seq uint64, addrs ...ma.Multiaddr) *record.Envelope {
+	t.Helper()
+	id, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	rec := peer.NewPeerRecord()
+	rec.PeerID = id
+	rec.Seq = seq
+	rec.Addrs = addrs
+	env, err := record.Seal(rec, priv)
+	require.NoError(t, err)
+	return env
+}
+
+func TestCertifiedAddrExpiry(t *testing.T) {
+	clk := mockClock.NewMock()
+	ps, err := NewPeerstore(WithClock(clk))
+	require.NoError(t, err)
+	defer ps.Close()
+
+	priv, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	p, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	a1 := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+	a2 := ma.StringCast("/ip4/1.2.3.4/tcp/2")
+
+	// an uncertified address with a longer TTL is shortened to the TTL of the record
+	ps.AddAddr(p, a1, 2*time.Hour)
+	_, err = ps.ConsumePeerRecord(makeSignedRecord(t, priv, 1, a1, a2), time.Hour)
+	require.NoError(t, err)
+
+	clk.Add(time.Hour - time.Second)
+	require.NotNil(t, ps.GetPeerRecord(p))
+	require.Len(t, ps.Addrs(p), 2)
+	clk.Add(time.Second)
+	require.Nil(t, ps.GetPeerRecord(p))
+	require.Empty(t, ps.Addrs(p))
+	ps.gc()
+
+	// consuming the record again renews it
+	_, err = ps.ConsumePeerRecord(makeSignedRecord(t, priv, 2, a1), time.Hour)
+	require.NoError(t, err)
+	ps.UpdateAddrs(p, time.Hour, 2*time.Hour)
+	clk.Add(90 * time.Minute)
+	require.NotNil(t, ps.GetPeerRecord(p))
+	require.Equal(t, []ma.Multiaddr{a1}, ps.Addrs(p))
+
+	ps.UpdateAddrs(p, 2*time.Hour, 0)
+	require.Nil(t, ps.GetPeerRecord(p))
+	ps.gc()
+	_, ok := ps.memoryAddrBook.segments.get(p).signedPeerRecords[p]
+	require.False(t, ok)
+}
+
+func TestRecordRenewal(t *testing.T) {
+	clk := mockClock.NewMock()
+	ps, err := NewPeerstore(WithClock(clk))
+	require.NoError(t, err)
+	defer ps.Close()
+
+	priv, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	p, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+
+	var renewals []peer.ID
+	cancel := ps.NotifyRecordRenewal(10*time.Minute, func(p peer.ID) { renewals = append(renewals, p) })
+
+	_, err = ps.ConsumePeerRecord(makeSignedRecord(t, priv, 1, addr), time.Hour)
+	require.NoError(t, err)
+	ps.checkRenewals()
+	require.Empty(t, renewals)
+
+	clk.Add(49 * time.Minute)
+	ps.checkRenewals()
+	require.Empty(t, renewals)
+	clk.Add(2 * time.Minute)
+	ps.checkRenewals()
+	require.Equal(t, []peer.ID{p}, renewals)
+	// only notified once
+	clk.Add(time.Minute)
+	ps.checkRenewals()
+	require.Len(t, renewals, 1)
+
+	// a renewed record is reported again before it expires
+	_, err = ps.ConsumePeerRecord(makeSignedRecord(t, priv, 2, addr), time.Hour)
+	require.NoError(t, err)
+	clk.Add(55 * time.Minute)
+	ps.checkRenewals()
+	require.Len(t, renewals, 2)
+
+	// expired records are not reported
+	cancel()
+	renewals = nil
+	ps.NotifyRecordRenewal(10*time.Minute, func(p peer.ID) { renewals = append(renewals, p) })
+	clk.Add(time.Hour)
+	ps.checkRenewals()
+	require.Empty(t, renewals)
+}
@@ -0,0 +1,173 @@
+// Package protoversion negotiates the version of an application protocol.
+//
+// Every version of a protocol is registered under its own protocol ID, which is the version appended
+// to the base protocol ID (e.g. /my/proto/1.2.0). When opening a stream, the peerstore (which is
+// populated by identify) is consulted first; if it doesn't know which versions the peer supports,
+// all versions are proposed using multistream-select. Either way, the highest version supported by
+// both peers is selected, and passed to the stream handler.
+//
+// Versions consist of dot-separated components. Numeric components are compared numerically,
+// all other components are compared lexically, so 1.10.0 is higher than 1.9.0.
+package protoversion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// Handler handles a stream of a versioned protocol. version is the negotiated version.
+type Handler func(s network.Stream, version string)
+
+// Protocol is an application protocol with multiple versions.
+type Protocol struct {
+	base protocol.ID
+	// versions are the supported versions, highest first
+	versions []string
+}
+
+// New creates a protocol with base protocol ID base, supporting the given versions.
+func New(base protocol.ID, versions ...string) (*Protocol, error) {
+	if base == "" {
+		return nil, errors.New("empty base protocol ID")
+	}
+	if len(versions) == 0 {
+		return nil, errors.New("no versions")
+	}
+	seen := make(map[string]struct{}, len(versions))
+	for _, v := range versions {
+		if v == "" || strings.Contains(v, "/") {
+			return nil, fmt.Errorf("invalid version: %q", v)
+		}
+		if _, ok := seen[v]; ok {
+			return nil, fmt.Errorf("duplicate version: %q", v)
+		}
+		seen[v] = struct{}{}
+	}
+	vs := append([]string(nil), versions...)
+	sort.Slice(vs, func(i, j int) bool { return compareVersions(vs[i], vs[j]) > 0 })
+	return &Protocol{
+		base:     protocol.ID(strings.TrimSuffix(string(base), "/")),
+		versions: vs,
+	}, nil
+}
+
+// Versions returns the supported versions, highest first.
+func (p *Protocol) Versions() []string {
+	return append([]string(nil), p.versions...)
+}
+
+// ID returns the protocol ID of version v.
+func (p *Protocol) ID(v string) protocol.ID {
+	return protocol.ID(fmt.Sprintf("%s/%s", p.base, v))
+}
+
+// IDs returns the protocol IDs of all supported versions, highest version first.
+func (p *Protocol) IDs() []protocol.ID {
+	ids := make([]protocol.ID, 0, len(p.versions))
+	for _, v := range p.versions {
+		ids = append(ids, p.ID(v))
+	}
+	return ids
+}
+
+// Version returns the version of protocol ID pid.
+// It returns false if pid is not the ID of one of the supported versions.
+func (p *Protocol) Version(pid protocol.ID) (string, bool) {
+	v := strings.TrimPrefix(string(pid), string(p.base)+"/")
+	if v == string(pid) {
+		return "", false
+	}
+	for _, version := range p.versions {
+		if v == version {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// SetStreamHandler sets handler as the stream handler for all supported versions on h.
+func (p *Protocol) SetStreamHandler(h host.Host, handler Handler) {
+	for _, v := range p.versions {
+		v := v
+		h.SetStreamHandler(p.ID(v), func(s network.Stream) { handler(s, v) })
+	}
+}
+
+// RemoveStreamHandler removes the stream handlers for all supported versions from h.
+func (p *Protocol) RemoveStreamHandler(h host.Host) {
+	for _, pid := range p.IDs() {
+		h.RemoveStreamHandler(pid)
+	}
+}
+
+// BestVersion returns the highest version supported by both us and peer pr,
+// according to the protocols recorded in the peerstore.
+// It returns false if the peerstore doesn't know of any mutually supported version.
+func (p *Protocol) BestVersion(pb peerstore.ProtoBook, pr peer.ID) (string, bool) {
+	pid, err := pb.FirstSupportedProtocol(pr, p.IDs()...)
+	if err != nil || pid == "" {
+		return "", false
+	}
+	return p.Version(pid)
+}
+
+// NewStream opens a stream to peer pr using the highest version supported by both peers.
+// It returns the negotiated version.
+func (p *Protocol) NewStream(ctx context.Context, h host.Host, pr peer.ID) (network.Stream, string, error) {
+	// The host uses the peerstore, and falls back to proposing the IDs in order of preference.
+	s, err := h.NewStream(ctx, pr, p.IDs()...)
+	if err != nil {
+		return nil, "", err
+	}
+	v, ok := p.Version(s.Protocol())
+	if !ok {
+		s.Reset()
+		return nil, "", fmt.Errorf("negotiated unexpected protocol: %s", s.Protocol())
+	}
+	return s, v, nil
+}
+
+// compareVersions compares two versions. It returns a positive number if a is higher than b,
+// a negative number if a is lower than b, and 0 if they're equal.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if c := compareComponents(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	return len(as) - len(bs)
+}
+
+func compareComponents(a, b string) int {
+	an, aErr := strconv.ParseUint(a, 10, 64)
+	bn, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		switch {
+		case an > bn:
+			return 1
+		case an < bn:
+			return -1
+		default:
+			return 0
+		}
+	case aErr == nil:
+		// numeric components are higher than non-numeric ones
+		return 1
+	case bErr == nil:
+		return -1
+	default:
+		return strings.Compare(a, b)
+	}
+}
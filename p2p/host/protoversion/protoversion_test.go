@@ -0,0 +1,118 @@
+package protoversion
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/test"
+	blankhost "github.com/libp2p/go-libp2p/p2p/host/blank"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		cmp  int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.10.0", "1.9.0", 1},
+		{"2", "1.9.9", 1},
+		{"1.0", "1.0.1", -1},
+		{"1.0.0", "1.0.beta", 1},
+		{"alpha", "beta", -1},
+	} {
+		c := compareVersions(tc.a, tc.b)
+		switch {
+		case tc.cmp > 0:
+			require.Positive(t, c, "%s > %s", tc.a, tc.b)
+		case tc.cmp < 0:
+			require.Negative(t, c, "%s < %s", tc.a, tc.b)
+		default:
+			require.Zero(t, c, "%s == %s", tc.a, tc.b)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	p, err := New("/test/proto/", "1.9.0", "2.0.0", "1.10.0")
+	require.NoError(t, err)
+	require.Equal(t, []string{"2.0.0", "1.10.0", "1.9.0"}, p.Versions())
+	require.Equal(t, []protocol.ID{"/test/proto/2.0.0", "/test/proto/1.10.0", "/test/proto/1.9.0"}, p.IDs())
+
+	v, ok := p.Version("/test/proto/1.10.0")
+	require.True(t, ok)
+	require.Equal(t, "1.10.0", v)
+	_, ok = p.Version("/test/proto/3.0.0")
+	require.False(t, ok)
+	_, ok = p.Version("/other/1.10.0")
+	require.False(t, ok)
+
+	_, err = New("/test/proto")
+	require.Error(t, err)
+	_, err = New("/test/proto", "1.0.0", "1.0.0")
+	require.Error(t, err)
+	_, err = New("/test/proto", "1.0/0")
+	require.Error(t, err)
+}
+
+func TestBestVersion(t *testing.T) {
+	p, err := New("/test/proto", "1.0.0", "1.1.0", "2.0.0")
+	require.NoError(t, err)
+	ps, err := pstoremem.NewPeerstore()
+	require.NoError(t, err)
+	defer ps.Close()
+
+	pr := test.RandPeerIDFatal(t)
+	_, ok := p.BestVersion(ps, pr)
+	require.False(t, ok)
+
+	require.NoError(t, ps.AddProtocols(pr, "/test/proto/1.0.0", "/test/proto/1.1.0", "/test/proto/3.0.0"))
+	v, ok := p.BestVersion(ps, pr)
+	require.True(t, ok)
+	require.Equal(t, "1.1.0", v)
+}
+
+func TestNegotiation(t *testing.T) {
+	h1 := blankhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h1.Close()
+	h2 := blankhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h2.Close()
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+
+	client, err := New("/test/proto", "1.0.0", "1.1.0", "2.0.0")
+	require.NoError(t, err)
+	server, err := New("/test/proto", "1.0.0", "1.1.0")
+	require.NoError(t, err)
+
+	versions := make(chan string, 1)
+	server.SetStreamHandler(h2, func(s network.Stream, version string) {
+		defer s.Close()
+		versions <- version
+	})
+
+	s, v, err := client.NewStream(context.Background(), h1, h2.ID())
+	require.NoError(t, err)
+	defer s.Close()
+	require.Equal(t, "1.1.0", v)
+	require.Equal(t, protocol.ID("/test/proto/1.1.0"), s.Protocol())
+	// with lazy negotiation, the handler is only invoked once we write
+	_, err = s.Write([]byte("foo"))
+	require.NoError(t, err)
+	select {
+	case v := <-versions:
+		require.Equal(t, "1.1.0", v)
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler not called")
+	}
+
+	server.RemoveStreamHandler(h2)
+	_, _, err = client.NewStream(context.Background(), h1, h2.ID())
+	require.Error(t, err)
+}
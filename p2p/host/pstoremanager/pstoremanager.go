@@ -2,9 +2,11 @@ package pstoremanager
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/connmgr"
 	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -38,6 +40,40 @@ func WithCleanupInterval(t time.Duration) Option {
 	}
 }
 
+// WithConnManager makes the peerstore manager retain the data of peers protected by cm
+// (see connmgr.ConnManager.Protect), even after they disconnect.
+func WithConnManager(cm connmgr.ConnManager) Option {
+	return func(m *PeerstoreManager) error {
+		m.cmgr = cm
+		return nil
+	}
+}
+
+// WithUnconnectedPeerTTL enables pruning of peers that we're not connected to.
+// Without pruning, the addresses of such peers are only removed once their TTL expires, which
+// can take hours, e.g. for peers learned during a DHT query.
+//
+// The peerstore retains:
+//   - all data of connected and protected peers (see WithConnManager)
+//   - all data of disconnected peers, for the grace period (see WithGracePeriod)
+//   - the addresses of all other peers, for ttl
+//
+// A peer we never connected to is removed ttl after it was added to the peerstore,
+// a peer we disconnected from ttl after its grace period ended.
+// Peers with a private key in the peerstore (i.e. our own peer ID) are never removed.
+//
+// Peers are pruned during the clean up runs (see WithCleanupInterval), so they might be
+// retained for up to one clean up interval longer.
+func WithUnconnectedPeerTTL(ttl time.Duration) Option {
+	return func(m *PeerstoreManager) error {
+		if ttl <= 0 {
+			return errors.New("unconnected peer TTL must be positive")
+		}
+		m.unconnectedTTL = ttl
+		return nil
+	}
+}
+
 type PeerstoreManager struct {
 	pstore   peerstore.Peerstore
 	eventBus event.Bus
@@ -47,6 +83,10 @@ type PeerstoreManager struct {
 
 	gracePeriod     time.Duration
 	cleanupInterval time.Duration
+	// unconnectedTTL is the time the addresses of peers we're not connected to are retained.
+	// 0 disables pruning.
+	unconnectedTTL time.Duration
+	cmgr           connmgr.ConnManager
 }
 
 func NewPeerstoreManager(pstore peerstore.Peerstore, eventBus event.Bus, opts ...Option) (*PeerstoreManager, error) {
@@ -82,6 +122,10 @@ func (m *PeerstoreManager) background(ctx context.Context, sub event.Subscriptio
 	defer m.refCount.Done()
 	defer sub.Close()
 	disconnected := make(map[peer.ID]time.Time)
+	// connected and unconnected are only used for pruning.
+	// unconnected is the time we first saw a peer that we're not connected to during a clean up run.
+	connected := make(map[peer.ID]struct{})
+	unconnected := make(map[peer.ID]time.Time)
 
 	ticker := time.NewTicker(m.cleanupInterval)
 	defer ticker.Stop()
@@ -105,24 +149,68 @@ func (m *PeerstoreManager) background(ctx context.Context, sub event.Subscriptio
 				if _, ok := disconnected[p]; !ok {
 					disconnected[p] = time.Now()
 				}
+				delete(connected, p)
 			case network.Connected:
 				// If we reconnect to the peer before we've cleared the information, keep it.
 				delete(disconnected, p)
+				if m.unconnectedTTL > 0 {
+					connected[p] = struct{}{}
+				}
 			}
 		case <-ticker.C:
 			now := time.Now()
 			for p, disconnectTime := range disconnected {
 				if disconnectTime.Add(m.gracePeriod).Before(now) {
-					m.pstore.RemovePeer(p)
+					if !m.isProtected(p) {
+						m.pstore.RemovePeer(p)
+					}
 					delete(disconnected, p)
 				}
 			}
+			if m.unconnectedTTL > 0 {
+				unconnected = m.prune(now, connected, disconnected, unconnected)
+			}
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
+// prune removes all data of peers that we haven't been connected to for longer than the
+// unconnected TTL. It returns the updated unconnected map.
+func (m *PeerstoreManager) prune(now time.Time, connected map[peer.ID]struct{}, disconnected, unconnected map[peer.ID]time.Time) map[peer.ID]time.Time {
+	seen := make(map[peer.ID]time.Time, len(unconnected))
+	for _, p := range m.pstore.Peers() {
+		if _, ok := connected[p]; ok {
+			continue
+		}
+		// Peers that disconnected recently are retained for the grace period.
+		if _, ok := disconnected[p]; ok {
+			continue
+		}
+		if m.isProtected(p) || m.pstore.PrivKey(p) != nil {
+			continue
+		}
+		since, ok := unconnected[p]
+		if !ok {
+			seen[p] = now
+			continue
+		}
+		if now.Sub(since) < m.unconnectedTTL {
+			seen[p] = since
+			continue
+		}
+		log.Debugw("pruning peer", "peer", p)
+		m.pstore.ClearAddrs(p)
+		m.pstore.RemovePeer(p)
+	}
+	return seen
+}
+
+func (m *PeerstoreManager) isProtected(p peer.ID) bool {
+	return m.cmgr != nil && m.cmgr.IsProtected(p, "")
+}
+
 func (m *PeerstoreManager) Close() error {
 	if m.cancel != nil {
 		m.cancel()
@@ -4,13 +4,20 @@ import (
 	"testing"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/test"
 	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
 	"github.com/libp2p/go-libp2p/p2p/host/pstoremanager"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
 
 	"github.com/golang/mock/gomock"
+	ma "github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/require"
 )
 
@@ -109,3 +116,78 @@ func TestClose(t *testing.T) {
 		t.Fatalf("Hit timeout")
 	}
 }
+
+func TestPruning(t *testing.T) {
+	t.Parallel()
+	eventBus := eventbus.NewBus()
+	pstore, err := pstoremem.NewPeerstore()
+	require.NoError(t, err)
+	defer pstore.Close()
+	cm, err := connmgr.NewConnManager(10, 20)
+	require.NoError(t, err)
+	defer cm.Close()
+
+	const (
+		gracePeriod = 100 * time.Millisecond
+		ttl         = 200 * time.Millisecond
+	)
+	man, err := pstoremanager.NewPeerstoreManager(pstore, eventBus,
+		pstoremanager.WithGracePeriod(gracePeriod),
+		pstoremanager.WithCleanupInterval(20*time.Millisecond),
+		pstoremanager.WithUnconnectedPeerTTL(ttl),
+		pstoremanager.WithConnManager(cm),
+	)
+	require.NoError(t, err)
+	defer man.Close()
+	man.Start()
+
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+	priv, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	self, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	require.NoError(t, pstore.AddPrivKey(self, priv))
+	pstore.AddAddr(self, addr, peerstore.PermanentAddrTTL)
+
+	stranger := test.RandPeerIDFatal(t)
+	connected := test.RandPeerIDFatal(t)
+	protected := test.RandPeerIDFatal(t)
+	for _, p := range []peer.ID{stranger, connected, protected} {
+		pstore.AddAddr(p, addr, time.Hour)
+		require.NoError(t, pstore.AddProtocols(p, "/proto"))
+	}
+	cm.Protect(protected, "test")
+
+	emitter, err := eventBus.Emitter(new(event.EvtPeerConnectednessChanged))
+	require.NoError(t, err)
+	require.NoError(t, emitter.Emit(event.EvtPeerConnectednessChanged{Peer: connected, Connectedness: network.Connected}))
+	require.NoError(t, emitter.Emit(event.EvtPeerConnectednessChanged{Peer: protected, Connectedness: network.Connected}))
+
+	require.Eventually(t, func() bool { return len(pstore.Addrs(stranger)) == 0 }, 5*time.Second, 10*time.Millisecond)
+	protos, err := pstore.GetProtocols(stranger)
+	require.NoError(t, err)
+	require.Empty(t, protos)
+	require.NotContains(t, pstore.Peers(), stranger)
+
+	// disconnect both peers
+	require.NoError(t, emitter.Emit(event.EvtPeerConnectednessChanged{Peer: connected, Connectedness: network.NotConnected}))
+	require.NoError(t, emitter.Emit(event.EvtPeerConnectednessChanged{Peer: protected, Connectedness: network.NotConnected}))
+	start := time.Now()
+	// After the grace period, only the addresses are retained.
+	require.Eventually(t, func() bool {
+		protos, err := pstore.GetProtocols(connected)
+		return err == nil && len(protos) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.GreaterOrEqual(t, time.Since(start), gracePeriod)
+	require.NotEmpty(t, pstore.Addrs(connected))
+	// After the TTL, the addresses are removed as well.
+	require.Eventually(t, func() bool { return len(pstore.Addrs(connected)) == 0 }, 5*time.Second, 10*time.Millisecond)
+	require.GreaterOrEqual(t, time.Since(start), gracePeriod+ttl)
+
+	// protected peers and our own peer are retained
+	require.Equal(t, []ma.Multiaddr{addr}, pstore.Addrs(protected))
+	protos, err = pstore.GetProtocols(protected)
+	require.NoError(t, err)
+	require.Equal(t, []protocol.ID{"/proto"}, protos)
+	require.Equal(t, []ma.Multiaddr{addr}, pstore.Addrs(self))
+}
@@ -33,6 +33,9 @@ type ResourceManagerStat struct {
 	Services  map[string]network.ScopeStat
 	Protocols map[protocol.ID]network.ScopeStat
 	Peers     map[peer.ID]network.ScopeStat
+	// FDs is the number of file descriptors in use, by transport. It includes the file descriptors
+	// of connections, and those reserved using ReserveFD (e.g. for sockets shared by QUIC connections).
+	FDs map[string]int
 }
 
 var _ ResourceManagerState = (*resourceManager)(nil)
@@ -140,6 +143,7 @@ func (r *resourceManager) Stat() (result ResourceManagerStat) {
 	for _, svc := range svcs {
 		result.Services[svc.service] = svc.Stat()
 	}
+	result.FDs = r.fds.snapshot()
 	result.Transient = r.transient.Stat()
 	result.System = r.system.Stat()
 
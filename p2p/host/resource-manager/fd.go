@@ -0,0 +1,109 @@
+package rcmgr
+
+import (
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/network"
+
+	"github.com/multiformats/go-multiaddr"
+)
+
+var _ network.FDManager = (*resourceManager)(nil)
+
+// fdCounter counts the file descriptors in use, by transport.
+type fdCounter struct {
+	mx     sync.Mutex
+	counts map[string]int
+}
+
+func (c *fdCounter) add(transport string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[string]int)
+	}
+	c.counts[transport]++
+}
+
+func (c *fdCounter) remove(transport string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.counts[transport]--
+	if c.counts[transport] <= 0 {
+		delete(c.counts, transport)
+	}
+}
+
+func (c *fdCounter) snapshot() map[string]int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	counts := make(map[string]int, len(c.counts))
+	for t, n := range c.counts {
+		counts[t] = n
+	}
+	return counts
+}
+
+// fdTransportName returns the name of the transport used by a connection to endpoint,
+// e.g. "tcp" or "ws": the last protocol of the address, ignoring protocols that don't
+// describe a transport.
+func fdTransportName(endpoint multiaddr.Multiaddr) string {
+	name := "unknown"
+	if endpoint == nil {
+		return name
+	}
+	multiaddr.ForEach(endpoint, func(c multiaddr.Component) bool {
+		switch c.Protocol().Code {
+		case multiaddr.P_P2P, multiaddr.P_CERTHASH, multiaddr.P_SNI:
+		default:
+			name = c.Protocol().Name
+		}
+		return true
+	})
+	return name
+}
+
+// ReserveFD reserves a file descriptor that is not owned by a single connection in the system scope.
+func (r *resourceManager) ReserveFD(transport string) error {
+	if err := r.system.reserveFD(); err != nil {
+		log.Debugw("blocked file descriptor", "transport", transport, "error", err)
+		return err
+	}
+	r.fds.add(transport)
+	return nil
+}
+
+// ReleaseFD releases a file descriptor reserved using ReserveFD.
+func (r *resourceManager) ReleaseFD(transport string) {
+	r.system.releaseFD()
+	r.fds.remove(transport)
+}
+
+func (s *resourceScope) reserveFD() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.done {
+		return s.wrapError(network.ErrResourceScopeClosed)
+	}
+	return s.rc.addConns(0, 0, 1)
+}
+
+func (s *resourceScope) releaseFD() {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.done {
+		return
+	}
+	s.rc.removeConns(0, 0, 1)
+}
+
+// releaseFD stops counting the connection's file descriptor. The caller must hold the lock of the connection scope.
+func (s *connectionScope) releaseFD() {
+	if s.fdTransport == "" {
+		return
+	}
+	s.rcmgr.fds.remove(s.fdTransport)
+	s.fdTransport = ""
+}
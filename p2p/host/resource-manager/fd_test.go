@@ -0,0 +1,55 @@
+package rcmgr
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFDTransportName(t *testing.T) {
+	for addr, name := range map[string]string{
+		"/ip4/1.2.3.4/tcp/1":                               "tcp",
+		"/ip4/1.2.3.4/tcp/1/ws":                            "ws",
+		"/dns4/example.com/tcp/443/tls/sni/example.com/ws": "ws",
+		"/ip4/1.2.3.4/udp/1/quic-v1":                       "quic-v1",
+		"/ip4/1.2.3.4/tcp/1/p2p/QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC": "tcp",
+	} {
+		require.Equal(t, name, fdTransportName(multiaddr.StringCast(addr)), addr)
+	}
+	require.Equal(t, "unknown", fdTransportName(nil))
+}
+
+func TestFDAccounting(t *testing.T) {
+	limits := PartialLimitConfig{System: ResourceLimits{FD: 3}}.Build(InfiniteLimits)
+	mgr, err := NewResourceManager(NewFixedLimiter(limits), WithMetricsDisabled())
+	require.NoError(t, err)
+	defer mgr.Close()
+	rcmgr := mgr.(*resourceManager)
+
+	tcpConn, err := mgr.OpenConnection(network.DirInbound, true, multiaddr.StringCast("/ip4/1.2.3.4/tcp/1"))
+	require.NoError(t, err)
+	// connections that don't use a file descriptor are not counted
+	quicConn, err := mgr.OpenConnection(network.DirInbound, false, multiaddr.StringCast("/ip4/1.2.3.4/udp/1/quic-v1"))
+	require.NoError(t, err)
+	defer quicConn.Done()
+	require.NoError(t, rcmgr.ReserveFD("udp"))
+	require.Equal(t, map[string]int{"tcp": 1, "udp": 1}, rcmgr.Stat().FDs)
+	require.Equal(t, 2, rcmgr.Stat().System.NumFD)
+
+	require.NoError(t, rcmgr.ReserveFD("udp"))
+	// the limit applies to shared sockets and connections alike
+	require.ErrorIs(t, rcmgr.ReserveFD("udp"), network.ErrResourceLimitExceeded)
+	_, err = mgr.OpenConnection(network.DirOutbound, true, multiaddr.StringCast("/ip4/1.2.3.4/tcp/2"))
+	require.ErrorIs(t, err, network.ErrResourceLimitExceeded)
+
+	tcpConn.Done()
+	rcmgr.ReleaseFD("udp")
+	require.Equal(t, map[string]int{"udp": 1}, rcmgr.Stat().FDs)
+	require.Equal(t, 1, rcmgr.Stat().System.NumFD)
+	rcmgr.ReleaseFD("udp")
+	require.Empty(t, rcmgr.Stat().FDs)
+	require.Zero(t, rcmgr.Stat().System.NumFD)
+}
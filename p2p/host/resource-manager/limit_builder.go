@@ -0,0 +1,326 @@
+package rcmgr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// LimitConfigBuilder builds a limit configuration in code, starting from a set of default limits:
+//
+//	limits, err := rcmgr.NewLimitConfigBuilder(rcmgr.DefaultLimits.AutoScale()).
+//		System(rcmgr.ResourceLimits{Conns: 1000, Memory: 2 << 30}).
+//		PeerDefault(rcmgr.ResourceLimits{Streams: 256}).
+//		Protocol("/my/protocol/1.0.0", rcmgr.ResourceLimits{StreamsInbound: rcmgr.BlockAllLimit}).
+//		Build()
+//
+// Every method only overrides the limits that are set in the passed ResourceLimits, so the limits of a scope
+// can be set in multiple calls. Limits that are never set are taken from the defaults.
+type LimitConfigBuilder struct {
+	defaults ConcreteLimitConfig
+	cfg      PartialLimitConfig
+}
+
+// NewLimitConfigBuilder creates a new LimitConfigBuilder.
+func NewLimitConfigBuilder(defaults ConcreteLimitConfig) *LimitConfigBuilder {
+	return &LimitConfigBuilder{defaults: defaults}
+}
+
+func setLimits(dst *ResourceLimits, l ResourceLimits) {
+	l.Apply(*dst)
+	*dst = l
+}
+
+func setMapLimits[K comparable](m *map[K]ResourceLimits, k K, l ResourceLimits) {
+	if *m == nil {
+		*m = make(map[K]ResourceLimits)
+	}
+	cur := (*m)[k]
+	setLimits(&cur, l)
+	(*m)[k] = cur
+}
+
+// System sets the limits of the system scope.
+func (b *LimitConfigBuilder) System(l ResourceLimits) *LimitConfigBuilder {
+	setLimits(&b.cfg.System, l)
+	return b
+}
+
+// Transient sets the limits of the transient scope.
+func (b *LimitConfigBuilder) Transient(l ResourceLimits) *LimitConfigBuilder {
+	setLimits(&b.cfg.Transient, l)
+	return b
+}
+
+// AllowlistedSystem sets the limits of the system scope for allowlisted multiaddrs.
+func (b *LimitConfigBuilder) AllowlistedSystem(l ResourceLimits) *LimitConfigBuilder {
+	setLimits(&b.cfg.AllowlistedSystem, l)
+	return b
+}
+
+// AllowlistedTransient sets the limits of the transient scope for allowlisted multiaddrs.
+func (b *LimitConfigBuilder) AllowlistedTransient(l ResourceLimits) *LimitConfigBuilder {
+	setLimits(&b.cfg.AllowlistedTransient, l)
+	return b
+}
+
+// ServiceDefault sets the limits of services that don't have specific limits.
+func (b *LimitConfigBuilder) ServiceDefault(l ResourceLimits) *LimitConfigBuilder {
+	setLimits(&b.cfg.ServiceDefault, l)
+	return b
+}
+
+// Service sets the limits of a service.
+func (b *LimitConfigBuilder) Service(svc string, l ResourceLimits) *LimitConfigBuilder {
+	setMapLimits(&b.cfg.Service, svc, l)
+	return b
+}
+
+// ServicePeerDefault sets the per-peer limits of services that don't have specific per-peer limits.
+func (b *LimitConfigBuilder) ServicePeerDefault(l ResourceLimits) *LimitConfigBuilder {
+	setLimits(&b.cfg.ServicePeerDefault, l)
+	return b
+}
+
+// ServicePeer sets the per-peer limits of a service.
+func (b *LimitConfigBuilder) ServicePeer(svc string, l ResourceLimits) *LimitConfigBuilder {
+	setMapLimits(&b.cfg.ServicePeer, svc, l)
+	return b
+}
+
+// ProtocolDefault sets the limits of protocols that don't have specific limits.
+func (b *LimitConfigBuilder) ProtocolDefault(l ResourceLimits) *LimitConfigBuilder {
+	setLimits(&b.cfg.ProtocolDefault, l)
+	return b
+}
+
+// Protocol sets the limits of a protocol.
+func (b *LimitConfigBuilder) Protocol(proto protocol.ID, l ResourceLimits) *LimitConfigBuilder {
+	setMapLimits(&b.cfg.Protocol, proto, l)
+	return b
+}
+
+// ProtocolPeerDefault sets the per-peer limits of protocols that don't have specific per-peer limits.
+func (b *LimitConfigBuilder) ProtocolPeerDefault(l ResourceLimits) *LimitConfigBuilder {
+	setLimits(&b.cfg.ProtocolPeerDefault, l)
+	return b
+}
+
+// ProtocolPeer sets the per-peer limits of a protocol.
+func (b *LimitConfigBuilder) ProtocolPeer(proto protocol.ID, l ResourceLimits) *LimitConfigBuilder {
+	setMapLimits(&b.cfg.ProtocolPeer, proto, l)
+	return b
+}
+
+// PeerDefault sets the limits of peers that don't have specific limits.
+func (b *LimitConfigBuilder) PeerDefault(l ResourceLimits) *LimitConfigBuilder {
+	setLimits(&b.cfg.PeerDefault, l)
+	return b
+}
+
+// Peer sets the limits of a peer.
+func (b *LimitConfigBuilder) Peer(p peer.ID, l ResourceLimits) *LimitConfigBuilder {
+	setMapLimits(&b.cfg.Peer, p, l)
+	return b
+}
+
+// Conn sets the limits of a single connection.
+func (b *LimitConfigBuilder) Conn(l ResourceLimits) *LimitConfigBuilder {
+	setLimits(&b.cfg.Conn, l)
+	return b
+}
+
+// Stream sets the limits of a single stream.
+func (b *LimitConfigBuilder) Stream(l ResourceLimits) *LimitConfigBuilder {
+	setLimits(&b.cfg.Stream, l)
+	return b
+}
+
+// PartialLimitConfig returns the limits that were set so far.
+func (b *LimitConfigBuilder) PartialLimitConfig() PartialLimitConfig {
+	return b.cfg
+}
+
+// Build builds the limit configuration, and validates it.
+func (b *LimitConfigBuilder) Build() (ConcreteLimitConfig, error) {
+	cfg := b.cfg.Build(b.defaults)
+	if err := cfg.Validate(); err != nil {
+		return ConcreteLimitConfig{}, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the limit configuration for inconsistencies:
+//   - limits must not be negative
+//   - the inbound and outbound limits must not exceed the total limit of a scope
+//   - the transient limits must not exceed the system limits (and the same for the allowlisted scopes)
+func (cfg ConcreteLimitConfig) Validate() error {
+	var errs []string
+	check := func(name string, l BaseLimit) {
+		if l.Streams < 0 || l.StreamsInbound < 0 || l.StreamsOutbound < 0 ||
+			l.Conns < 0 || l.ConnsInbound < 0 || l.ConnsOutbound < 0 || l.FD < 0 || l.Memory < 0 {
+			errs = append(errs, fmt.Sprintf("%s: negative limit", name))
+		}
+		if l.StreamsInbound > l.Streams || l.StreamsOutbound > l.Streams {
+			errs = append(errs, fmt.Sprintf("%s: directional stream limit exceeds total stream limit %d", name, l.Streams))
+		}
+		if l.ConnsInbound > l.Conns || l.ConnsOutbound > l.Conns {
+			errs = append(errs, fmt.Sprintf("%s: directional connection limit exceeds total connection limit %d", name, l.Conns))
+		}
+	}
+	checkWithin := func(name string, l BaseLimit, parentName string, parent BaseLimit) {
+		if l.Streams > parent.Streams || l.Conns > parent.Conns || l.FD > parent.FD || l.Memory > parent.Memory {
+			errs = append(errs, fmt.Sprintf("%s limits exceed %s limits", name, parentName))
+		}
+	}
+	check("system", cfg.system)
+	check("allowlisted system", cfg.allowlistedSystem)
+	check("allowlisted transient", cfg.allowlistedTransient)
+	checkWithin("allowlisted transient", cfg.allowlistedTransient, "allowlisted system", cfg.allowlistedSystem)
+	check("transient", cfg.transient)
+	checkWithin("transient", cfg.transient, "system", cfg.system)
+	check("service default", cfg.serviceDefault)
+	check("service peer default", cfg.servicePeerDefault)
+	check("protocol default", cfg.protocolDefault)
+	check("protocol peer default", cfg.protocolPeerDefault)
+	check("peer default", cfg.peerDefault)
+	check("conn", cfg.conn)
+	check("stream", cfg.stream)
+	for svc, l := range cfg.service {
+		check(fmt.Sprintf("service %s", svc), l)
+	}
+	for svc, l := range cfg.servicePeer {
+		check(fmt.Sprintf("service peer %s", svc), l)
+	}
+	for proto, l := range cfg.protocol {
+		check(fmt.Sprintf("protocol %s", proto), l)
+	}
+	for proto, l := range cfg.protocolPeer {
+		check(fmt.Sprintf("protocol peer %s", proto), l)
+	}
+	for p, l := range cfg.peer {
+		check(fmt.Sprintf("peer %s", p), l)
+	}
+
+	if len(errs) > 0 {
+		return errors.New("invalid limit config: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// diffLimits returns the limits of l that differ from defaults. All other limits are left at their default values.
+func diffLimits(l, defaults BaseLimit) ResourceLimits {
+	var out ResourceLimits
+	if l.Streams != defaults.Streams {
+		out.Streams = valueOrBlockAll(l.Streams)
+	}
+	if l.StreamsInbound != defaults.StreamsInbound {
+		out.StreamsInbound = valueOrBlockAll(l.StreamsInbound)
+	}
+	if l.StreamsOutbound != defaults.StreamsOutbound {
+		out.StreamsOutbound = valueOrBlockAll(l.StreamsOutbound)
+	}
+	if l.Conns != defaults.Conns {
+		out.Conns = valueOrBlockAll(l.Conns)
+	}
+	if l.ConnsInbound != defaults.ConnsInbound {
+		out.ConnsInbound = valueOrBlockAll(l.ConnsInbound)
+	}
+	if l.ConnsOutbound != defaults.ConnsOutbound {
+		out.ConnsOutbound = valueOrBlockAll(l.ConnsOutbound)
+	}
+	if l.FD != defaults.FD {
+		out.FD = valueOrBlockAll(l.FD)
+	}
+	if l.Memory != defaults.Memory {
+		out.Memory = valueOrBlockAll64(l.Memory)
+	}
+	return out
+}
+
+func diffLimitsMap[K comparable](m, defaults map[K]BaseLimit, fallbackDefault BaseLimit) map[K]ResourceLimits {
+	var out map[K]ResourceLimits
+	for k, l := range m {
+		def, ok := defaults[k]
+		if !ok {
+			def = fallbackDefault
+		}
+		d := diffLimits(l, def)
+		if d.IsDefault() {
+			continue
+		}
+		if out == nil {
+			out = make(map[K]ResourceLimits)
+		}
+		out[k] = d
+	}
+	return out
+}
+
+// Diff returns the limits of cfg that differ from defaults.
+// Building the returned PartialLimitConfig with defaults results in cfg, unless cfg lacks specific limits
+// (of a service, protocol or peer) that are set in defaults. These are not included.
+func (cfg ConcreteLimitConfig) Diff(defaults ConcreteLimitConfig) PartialLimitConfig {
+	return PartialLimitConfig{
+		System:               diffLimits(cfg.system, defaults.system),
+		Transient:            diffLimits(cfg.transient, defaults.transient),
+		AllowlistedSystem:    diffLimits(cfg.allowlistedSystem, defaults.allowlistedSystem),
+		AllowlistedTransient: diffLimits(cfg.allowlistedTransient, defaults.allowlistedTransient),
+		ServiceDefault:       diffLimits(cfg.serviceDefault, defaults.serviceDefault),
+		Service:              diffLimitsMap(cfg.service, defaults.service, cfg.serviceDefault),
+		ServicePeerDefault:   diffLimits(cfg.servicePeerDefault, defaults.servicePeerDefault),
+		ServicePeer:          diffLimitsMap(cfg.servicePeer, defaults.servicePeer, cfg.servicePeerDefault),
+		ProtocolDefault:      diffLimits(cfg.protocolDefault, defaults.protocolDefault),
+		Protocol:             diffLimitsMap(cfg.protocol, defaults.protocol, cfg.protocolDefault),
+		ProtocolPeerDefault:  diffLimits(cfg.protocolPeerDefault, defaults.protocolPeerDefault),
+		ProtocolPeer:         diffLimitsMap(cfg.protocolPeer, defaults.protocolPeer, cfg.protocolPeerDefault),
+		PeerDefault:          diffLimits(cfg.peerDefault, defaults.peerDefault),
+		Peer:                 diffLimitsMap(cfg.peer, defaults.peer, cfg.peerDefault),
+		Conn:                 diffLimits(cfg.conn, defaults.conn),
+		Stream:               diffLimits(cfg.stream, defaults.stream),
+	}
+}
+
+// peerMemoryOvercommit is the factor by which the memory limit of a single peer may exceed its fair share
+// of the system memory limit, as not all peers use their share at the same time.
+const peerMemoryOvercommit = 8
+
+// ScaleForPeers scales the limit configuration to the given amount of memory and number of file descriptors
+// (see Scale), and then adjusts the connection limits to the number of peers the node is expected to be
+// connected to. The per-peer memory limit is reduced so that no single peer can use more than
+// peerMemoryOvercommit times its fair share of the memory.
+func (cfg *ScalingLimitConfig) ScaleForPeers(memory int64, numFD int, peers int) ConcreteLimitConfig {
+	lc := cfg.Scale(memory, numFD)
+	if peers <= 0 {
+		return lc
+	}
+
+	// Allow for some churn: connections to new peers are opened before old ones are closed.
+	conns := 2 * peers
+	lc.system.Conns = conns
+	lc.system.ConnsInbound = peers
+	lc.system.ConnsOutbound = conns
+	if lc.system.FD > numFD && numFD > 0 {
+		lc.system.FD = numFD
+	}
+	limitConns := func(l *BaseLimit) {
+		if l.Conns > conns {
+			l.Conns = conns
+		}
+		if l.ConnsInbound > l.Conns {
+			l.ConnsInbound = l.Conns
+		}
+		if l.ConnsOutbound > l.Conns {
+			l.ConnsOutbound = l.Conns
+		}
+	}
+	limitConns(&lc.transient)
+
+	if share := lc.system.Memory / int64(peers) * peerMemoryOvercommit; share < lc.peerDefault.Memory {
+		lc.peerDefault.Memory = share
+	}
+	return lc
+}
@@ -0,0 +1,76 @@
+package rcmgr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultLimitsValid(t *testing.T) {
+	require.NoError(t, DefaultLimits.AutoScale().Validate())
+	require.NoError(t, DefaultLimits.Scale(0, 0).Validate())
+	require.NoError(t, DefaultLimits.Scale(128<<20, 256).Validate())
+	require.NoError(t, DefaultLimits.Scale(64<<30, 1<<20).Validate())
+	require.NoError(t, DefaultLimits.ScaleForPeers(1<<30, 1024, 100).Validate())
+	require.NoError(t, DefaultLimits.ScaleForPeers(128<<20, 64, 10).Validate())
+}
+
+func TestLimitConfigBuilder(t *testing.T) {
+	defaults := DefaultLimits.AutoScale()
+	p := peer.ID("peer")
+	cfg, err := NewLimitConfigBuilder(defaults).
+		System(ResourceLimits{Conns: 1000}).
+		System(ResourceLimits{Memory: 1 << 30}).
+		PeerDefault(ResourceLimits{Streams: 100, StreamsInbound: 50, StreamsOutbound: 100}).
+		Peer(p, ResourceLimits{Conns: Unlimited}).
+		Protocol("/test", ResourceLimits{StreamsInbound: BlockAllLimit}).
+		Build()
+	require.NoError(t, err)
+
+	require.Equal(t, 1000, cfg.system.Conns)
+	require.Equal(t, int64(1<<30), cfg.system.Memory)
+	require.Equal(t, defaults.system.Streams, cfg.system.Streams)
+	require.Equal(t, 100, cfg.peerDefault.Streams)
+	require.Equal(t, 50, cfg.peerDefault.StreamsInbound)
+	require.Equal(t, math.MaxInt, cfg.peer[p].Conns)
+	require.Equal(t, 100, cfg.peer[p].Streams)
+	require.Equal(t, 0, cfg.protocol["/test"].StreamsInbound)
+
+	// the diff only contains what was changed
+	diff := cfg.Diff(defaults)
+	require.Equal(t, ResourceLimits{Conns: 1000, Memory: 1 << 30}, diff.System)
+	require.True(t, diff.Transient.IsDefault())
+	require.Equal(t, ResourceLimits{Conns: Unlimited}, diff.Peer[p])
+	require.Equal(t, ResourceLimits{StreamsInbound: BlockAllLimit}, diff.Protocol["/test"])
+	require.Equal(t, cfg, diff.Build(defaults))
+	require.Empty(t, defaults.Diff(defaults).Peer)
+}
+
+func TestLimitConfigBuilderValidation(t *testing.T) {
+	_, err := NewLimitConfigBuilder(DefaultLimits.AutoScale()).
+		PeerDefault(ResourceLimits{Streams: 10, StreamsOutbound: 20}).
+		Build()
+	require.ErrorContains(t, err, "peer default")
+
+	_, err = NewLimitConfigBuilder(DefaultLimits.AutoScale()).
+		Transient(ResourceLimits{Memory: Unlimited64}).
+		Build()
+	require.ErrorContains(t, err, "transient limits exceed system limits")
+}
+
+func TestScaleForPeers(t *testing.T) {
+	cfg := DefaultLimits.ScaleForPeers(1<<30, 1000, 200)
+	require.NoError(t, cfg.Validate())
+	require.Equal(t, 400, cfg.system.Conns)
+	require.Equal(t, 200, cfg.system.ConnsInbound)
+	require.LessOrEqual(t, cfg.system.FD, 1000)
+	require.LessOrEqual(t, cfg.transient.Conns, 400)
+	require.Equal(t, cfg.system.Memory/200*peerMemoryOvercommit, cfg.peerDefault.Memory)
+
+	// few peers don't raise the per-peer memory limit
+	scaled := DefaultLimits.Scale(1<<30, 1000)
+	require.Equal(t, scaled.peerDefault.Memory, DefaultLimits.ScaleForPeers(1<<30, 1000, 2).peerDefault.Memory)
+}
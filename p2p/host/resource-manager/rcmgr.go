@@ -3,6 +3,7 @@ package rcmgr
 import (
 	"context"
 	"fmt"
+	"net/netip"
 	"strings"
 	"sync"
 	"time"
@@ -25,6 +26,8 @@ type resourceManager struct {
 	disableMetrics bool
 
 	allowlist *Allowlist
+	// nil if there are no per-IP and per-subnet transient limits
+	transientIPs *transientIPLimiter
 
 	system    *systemScope
 	transient *transientScope
@@ -45,6 +48,9 @@ type resourceManager struct {
 	stickyPeer  map[peer.ID]struct{}
 
 	connId, streamId int64
+
+	// fds counts the file descriptors in use, by transport
+	fds fdCounter
 }
 
 var _ network.ResourceManager = (*resourceManager)(nil)
@@ -103,6 +109,12 @@ type connectionScope struct {
 	rcmgr         *resourceManager
 	peer          *peerScope
 	endpoint      multiaddr.Multiaddr
+	// transientIPs are the prefixes counted by the transient IP limiter,
+	// while the connection is in the transient scope.
+	transientIPs []netip.Prefix
+	// fdTransport is the transport the connection's file descriptor is counted for.
+	// Empty if the connection doesn't use a file descriptor.
+	fdTransport string
 }
 
 var _ network.ConnScope = (*connectionScope)(nil)
@@ -141,6 +153,9 @@ func NewResourceManager(limits Limiter, opts ...Option) (network.ResourceManager
 			return nil, err
 		}
 	}
+	if r.transientIPs != nil {
+		r.transientIPs.disableMetrics = r.disableMetrics
+	}
 
 	if !r.disableMetrics {
 		var sr TraceReporter
@@ -326,12 +341,20 @@ func (r *resourceManager) OpenConnection(dir network.Direction, usefd bool, endp
 		}
 	}
 
+	if err == nil && r.transientIPs != nil && endpoint != nil && !conn.isAllowlisted && !r.allowlist.Allowed(endpoint) {
+		conn.transientIPs, err = r.transientIPs.add(endpoint)
+	}
+
 	if err != nil {
 		conn.Done()
 		r.metrics.BlockConn(dir, usefd)
 		return nil, err
 	}
 
+	if usefd {
+		conn.fdTransport = fdTransportName(endpoint)
+		r.fds.add(conn.fdTransport)
+	}
 	r.metrics.AllowConn(dir, usefd)
 	return conn, nil
 }
@@ -467,13 +490,15 @@ func newProtocolScope(proto protocol.ID, limit Limit, rcmgr *resourceManager) *p
 }
 
 func newPeerScope(p peer.ID, limit Limit, rcmgr *resourceManager) *peerScope {
-	return &peerScope{
+	s := &peerScope{
 		resourceScope: newResourceScope(limit,
 			[]*resourceScope{rcmgr.system.resourceScope},
 			peerScopeName(p), rcmgr.trace, rcmgr.metrics),
 		peer:  p,
 		rcmgr: rcmgr,
 	}
+	s.isPeerScope = true
+	return s
 }
 
 func newConnectionScope(dir network.Direction, usefd bool, limit Limit, rcmgr *resourceManager, endpoint multiaddr.Multiaddr) *connectionScope {
@@ -734,6 +759,7 @@ func (s *connectionScope) SetPeer(p peer.ID) error {
 
 	transient.ReleaseForChild(stat)
 	transient.DecRef() // removed from edges
+	s.releaseTransientIPs()
 
 	// update edges
 	edges := []*resourceScope{
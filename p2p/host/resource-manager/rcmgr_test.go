@@ -9,6 +9,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/test"
 
 	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
 )
 
 var dummyMA = multiaddr.StringCast("/ip4/1.2.3.4/tcp/1234")
@@ -1051,3 +1052,28 @@ func TestResourceManagerWithAllowlist(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestResourceManagerPeerLimitError(t *testing.T) {
+	limits := DefaultLimits.AutoScale()
+	limits.system.StreamsInbound = 2
+	limits.transient.StreamsInbound = 10
+	limits.peerDefault.StreamsInbound = 1
+	mgr, err := NewResourceManager(NewFixedLimiter(limits))
+	require.NoError(t, err)
+	defer mgr.Close()
+
+	peerA, peerB, peerC := peer.ID("A"), peer.ID("B"), peer.ID("C")
+	_, err = mgr.OpenStream(peerA, network.DirInbound)
+	require.NoError(t, err)
+	// exceeds the limit of peer A
+	_, err = mgr.OpenStream(peerA, network.DirInbound)
+	require.ErrorIs(t, err, network.ErrResourceLimitExceeded)
+	require.ErrorIs(t, err, network.ErrPeerResourceLimitExceeded)
+
+	_, err = mgr.OpenStream(peerB, network.DirInbound)
+	require.NoError(t, err)
+	// exceeds the system limit
+	_, err = mgr.OpenStream(peerC, network.DirInbound)
+	require.ErrorIs(t, err, network.ErrResourceLimitExceeded)
+	require.NotErrorIs(t, err, network.ErrPeerResourceLimitExceeded)
+}
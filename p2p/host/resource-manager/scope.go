@@ -1,6 +1,7 @@
 package rcmgr
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"math/big"
@@ -44,6 +45,8 @@ type resourceScope struct {
 	name    string   // for debugging purposes
 	trace   *trace   // debug tracing
 	metrics *metrics // metrics collection
+
+	isPeerScope bool // set in peer scopes, to mark errors caused by the limits of a single peer
 }
 
 var _ network.ResourceScope = (*resourceScope)(nil)
@@ -335,9 +338,22 @@ func (rc *resources) stat() network.ScopeStat {
 
 // resourceScope implementation
 func (s *resourceScope) wrapError(err error) error {
+	if s.isPeerScope && errors.Is(err, network.ErrResourceLimitExceeded) {
+		err = peerLimitError{err}
+	}
 	return fmt.Errorf("%s: %w", s.name, err)
 }
 
+// peerLimitError wraps an error caused by exceeding a limit of a peer scope.
+// It matches network.ErrPeerResourceLimitExceeded.
+type peerLimitError struct{ err error }
+
+func (e peerLimitError) Error() string { return e.err.Error() }
+func (e peerLimitError) Unwrap() error { return e.err }
+func (e peerLimitError) Is(target error) bool {
+	return target == network.ErrPeerResourceLimitExceeded
+}
+
 func (s *resourceScope) ReserveMemory(size int, prio uint8) error {
 	s.Lock()
 	defer s.Unlock()
@@ -157,6 +157,7 @@ func MustRegisterWith(reg prometheus.Registerer) {
 		previousConnMemory,
 		fds,
 		blockedResources,
+		transientIPBlocked,
 	)
 }
 
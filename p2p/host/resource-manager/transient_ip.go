@@ -0,0 +1,168 @@
+package rcmgr
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/network"
+
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TransientIPLimit limits the number of connections in the transient scope, i.e. connections
+// that haven't been attached to a peer yet, from remote addresses sharing a prefix.
+type TransientIPLimit struct {
+	// PrefixLength is the number of leading bits of the remote address that are compared.
+	// Use 32 (IPv4) or 128 (IPv6) to limit the connections per IP address.
+	PrefixLength int
+	// ConnCount is the maximum number of transient connections per prefix.
+	ConnCount int
+}
+
+// DefaultTransientIPv4Limits are sensible per-IP and per-subnet limits for IPv4 addresses.
+var DefaultTransientIPv4Limits = []TransientIPLimit{
+	{PrefixLength: 32, ConnCount: 8},
+	{PrefixLength: 24, ConnCount: 32},
+}
+
+// DefaultTransientIPv6Limits are sensible per-IP and per-subnet limits for IPv6 addresses.
+// Since a single host usually controls an entire /64, there's no per-IP limit.
+var DefaultTransientIPv6Limits = []TransientIPLimit{
+	{PrefixLength: 64, ConnCount: 8},
+	{PrefixLength: 48, ConnCount: 32},
+}
+
+// WithTransientIPLimits limits the number of transient connections per remote IP address and subnet,
+// such that a single source can't consume the entire transient budget with half-open connections.
+// Allowlisted connections are not subject to these limits.
+func WithTransientIPLimits(ipv4, ipv6 []TransientIPLimit) Option {
+	return func(r *resourceManager) error {
+		for _, l := range ipv4 {
+			if l.PrefixLength <= 0 || l.PrefixLength > 32 {
+				return fmt.Errorf("invalid IPv4 prefix length: %d", l.PrefixLength)
+			}
+			if l.ConnCount <= 0 {
+				return errors.New("transient IP connection limit must be positive")
+			}
+		}
+		for _, l := range ipv6 {
+			if l.PrefixLength <= 0 || l.PrefixLength > 128 {
+				return fmt.Errorf("invalid IPv6 prefix length: %d", l.PrefixLength)
+			}
+			if l.ConnCount <= 0 {
+				return errors.New("transient IP connection limit must be positive")
+			}
+		}
+		r.transientIPs = &transientIPLimiter{
+			ipv4:   append([]TransientIPLimit(nil), ipv4...),
+			ipv6:   append([]TransientIPLimit(nil), ipv6...),
+			counts: make(map[netip.Prefix]int),
+		}
+		return nil
+	}
+}
+
+var transientIPBlocked = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metricNamespace,
+	Name:      "transient_ip_blocked_total",
+	Help:      "Number of transient connections blocked by the per-IP and per-subnet limits, by IP version and prefix length of the exceeded limit",
+}, []string{"ip_version", "prefix_length"})
+
+// transientIPLimiter counts the transient connections per prefix.
+type transientIPLimiter struct {
+	ipv4, ipv6     []TransientIPLimit
+	disableMetrics bool
+
+	mx     sync.Mutex
+	counts map[netip.Prefix]int
+}
+
+// add adds a transient connection from the given remote address.
+// It returns the prefixes that were counted, which need to be released using remove.
+func (l *transientIPLimiter) add(endpoint multiaddr.Multiaddr) ([]netip.Prefix, error) {
+	ip, err := manet.ToIP(endpoint)
+	if err != nil {
+		// not an IP address, e.g. a relayed connection
+		return nil, nil
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return nil, nil
+	}
+	addr = addr.Unmap()
+	limits := l.ipv6
+	if addr.Is4() {
+		limits = l.ipv4
+	}
+	if len(limits) == 0 {
+		return nil, nil
+	}
+
+	prefixes := make([]netip.Prefix, 0, len(limits))
+	for _, lim := range limits {
+		prefix, err := addr.Prefix(lim.PrefixLength)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	for i, prefix := range prefixes {
+		if current := l.counts[prefix]; current >= limits[i].ConnCount {
+			if !l.disableMetrics {
+				ipVersion := "ip6"
+				if addr.Is4() {
+					ipVersion = "ip4"
+				}
+				transientIPBlocked.WithLabelValues(ipVersion, strconv.Itoa(prefix.Bits())).Inc()
+			}
+			return nil, &ErrStreamOrConnLimitExceeded{
+				current:   current,
+				attempted: 1,
+				limit:     limits[i].ConnCount,
+				err:       fmt.Errorf("transient connection limit exceeded for %s: %w", prefix, network.ErrResourceLimitExceeded),
+			}
+		}
+	}
+	for _, prefix := range prefixes {
+		l.counts[prefix]++
+	}
+	return prefixes, nil
+}
+
+func (l *transientIPLimiter) remove(prefixes []netip.Prefix) {
+	if len(prefixes) == 0 {
+		return
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	for _, prefix := range prefixes {
+		l.counts[prefix]--
+		if l.counts[prefix] <= 0 {
+			delete(l.counts, prefix)
+		}
+	}
+}
+
+// releaseTransientIPs releases the connection's transient IP counts.
+// The caller must hold the lock of the connection scope.
+func (s *connectionScope) releaseTransientIPs() {
+	s.rcmgr.transientIPs.remove(s.transientIPs)
+	s.transientIPs = nil
+}
+
+// Done ends the connection scope.
+func (s *connectionScope) Done() {
+	s.Lock()
+	s.releaseTransientIPs()
+	s.releaseFD()
+	s.Unlock()
+	s.resourceScope.Done()
+}
@@ -0,0 +1,81 @@
+package rcmgr
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransientIPLimits(t *testing.T) {
+	rcmgr, err := NewResourceManager(NewFixedLimiter(InfiniteLimits),
+		WithTransientIPLimits(
+			[]TransientIPLimit{{PrefixLength: 32, ConnCount: 2}, {PrefixLength: 24, ConnCount: 3}},
+			[]TransientIPLimit{{PrefixLength: 64, ConnCount: 1}},
+		),
+		WithAllowlistedMultiaddrs([]multiaddr.Multiaddr{multiaddr.StringCast("/ip4/1.2.3.4")}),
+		WithMetricsDisabled(),
+	)
+	require.NoError(t, err)
+	defer rcmgr.Close()
+
+	open := func(addr string) (network.ConnManagementScope, error) {
+		return rcmgr.OpenConnection(network.DirInbound, true, multiaddr.StringCast(addr))
+	}
+
+	c1, err := open("/ip4/1.1.1.1/tcp/1")
+	require.NoError(t, err)
+	c2, err := open("/ip4/1.1.1.1/tcp/2")
+	require.NoError(t, err)
+	// per-IP limit
+	_, err = open("/ip4/1.1.1.1/tcp/3")
+	require.ErrorIs(t, err, network.ErrResourceLimitExceeded)
+	c3, err := open("/ip4/1.1.1.2/udp/1/quic-v1")
+	require.NoError(t, err)
+	// per-subnet limit
+	_, err = open("/ip4/1.1.1.3/tcp/1")
+	require.ErrorIs(t, err, network.ErrResourceLimitExceeded)
+	// other subnets are not affected
+	c4, err := open("/ip4/1.1.2.1/tcp/1")
+	require.NoError(t, err)
+	// IPv6 limits
+	c5, err := open("/ip6/2001:db8::1/tcp/1")
+	require.NoError(t, err)
+	_, err = open("/ip6/2001:db8::2/tcp/1")
+	require.ErrorIs(t, err, network.ErrResourceLimitExceeded)
+	// allowlisted connections are not limited
+	for i := 0; i < 5; i++ {
+		c, err := open("/ip4/1.2.3.4/tcp/1")
+		require.NoError(t, err)
+		defer c.Done()
+	}
+
+	// closing a connection frees up the slot
+	c1.Done()
+	c1, err = open("/ip4/1.1.1.1/tcp/3")
+	require.NoError(t, err)
+
+	// connections attached to a peer leave the transient scope
+	require.NoError(t, c2.SetPeer(peer.ID("A")))
+	c6, err := open("/ip4/1.1.1.1/tcp/4")
+	require.NoError(t, err)
+	_, err = open("/ip4/1.1.1.1/tcp/5")
+	require.ErrorIs(t, err, network.ErrResourceLimitExceeded)
+
+	for _, c := range []network.ConnManagementScope{c1, c2, c3, c4, c5, c6} {
+		c.Done()
+	}
+	require.Empty(t, rcmgr.(*resourceManager).transientIPs.counts)
+}
+
+func TestTransientIPLimitsValidation(t *testing.T) {
+	_, err := NewResourceManager(NewFixedLimiter(InfiniteLimits),
+		WithTransientIPLimits([]TransientIPLimit{{PrefixLength: 33, ConnCount: 1}}, nil))
+	require.Error(t, err)
+	_, err = NewResourceManager(NewFixedLimiter(InfiniteLimits),
+		WithTransientIPLimits(nil, []TransientIPLimit{{PrefixLength: 64}}))
+	require.Error(t, err)
+}
@@ -46,9 +46,11 @@ func Wrap(h host.Host, r Routing) *RoutedHost {
 // RoutedHost's Connect differs in that if the host has no addresses for a
 // given peer, it will use its routing system to try to find some.
 func (rh *RoutedHost) Connect(ctx context.Context, pi peer.AddrInfo) error {
-	// first, check if we're already connected unless force direct dial.
+	// first, check if we're already connected unless force direct dial,
+	// or an additional connection was requested.
 	forceDirect, _ := network.GetForceDirectDial(ctx)
-	if !forceDirect {
+	_, _, additionalConn := network.GetAdditionalConnection(ctx)
+	if !forceDirect && !additionalConn {
 		if rh.Network().Connectedness(pi.ID) == network.Connected {
 			return nil
 		}
@@ -219,4 +221,19 @@ func (rh *RoutedHost) ConnManager() connmgr.ConnManager {
 	return rh.host.ConnManager()
 }
 
+// PeerProtocolStats returns the protocol usage statistics of the underlying host,
+// if it tracks them.
+func (rh *RoutedHost) PeerProtocolStats(p peer.ID) map[protocol.ID]host.ProtocolStats {
+	if t, ok := rh.host.(host.ProtocolStatsTracker); ok {
+		return t.PeerProtocolStats(p)
+	}
+	return nil
+}
+
+// SetStreamHandlerWithLimit sets the protocol handler on the underlying host,
+// enforcing the message size limit. See host.MessageSizeLimiter.
+func (rh *RoutedHost) SetStreamHandlerWithLimit(pid protocol.ID, limit host.MessageSizeLimit, handler network.StreamHandler) {
+	host.SetStreamHandlerWithLimit(rh.host, pid, limit, handler)
+}
+
 var _ (host.Host) = (*RoutedHost)(nil)
@@ -0,0 +1,211 @@
+package scoped
+
+import (
+	"context"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// scopedNetwork is the view of the network of a scoped host.
+type scopedNetwork struct {
+	network.Network
+	h *Host
+
+	mx        sync.Mutex
+	notifiees map[network.Notifiee]*scopedNotifiee
+}
+
+var _ network.Network = &scopedNetwork{}
+
+func newScopedNetwork(h *Host, n network.Network) *scopedNetwork {
+	return &scopedNetwork{
+		Network:   n,
+		h:         h,
+		notifiees: make(map[network.Notifiee]*scopedNotifiee),
+	}
+}
+
+func (n *scopedNetwork) Peerstore() peerstore.Peerstore { return n.h.ps }
+
+func (n *scopedNetwork) DialPeer(ctx context.Context, p peer.ID) (network.Conn, error) {
+	if n.h.isClosed() {
+		return nil, ErrClosed
+	}
+	if !n.h.allowPeer(p) {
+		return nil, ErrPeerNotAllowed
+	}
+	c, err := n.Network.DialPeer(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return n.wrapConn(c), nil
+}
+
+func (n *scopedNetwork) ClosePeer(p peer.ID) error {
+	if !n.h.allowPeer(p) {
+		return ErrPeerNotAllowed
+	}
+	return n.Network.ClosePeer(p)
+}
+
+func (n *scopedNetwork) Connectedness(p peer.ID) network.Connectedness {
+	if !n.h.allowPeer(p) {
+		return network.NotConnected
+	}
+	return n.Network.Connectedness(p)
+}
+
+func (n *scopedNetwork) Peers() []peer.ID {
+	return n.h.filterPeers(n.Network.Peers())
+}
+
+func (n *scopedNetwork) Conns() []network.Conn {
+	return n.filterConns(n.Network.Conns())
+}
+
+func (n *scopedNetwork) ConnsToPeer(p peer.ID) []network.Conn {
+	if !n.h.allowPeer(p) {
+		return nil
+	}
+	return n.filterConns(n.Network.ConnsToPeer(p))
+}
+
+func (n *scopedNetwork) filterConns(conns []network.Conn) []network.Conn {
+	filtered := make([]network.Conn, 0, len(conns))
+	for _, c := range conns {
+		if n.h.allowPeer(c.RemotePeer()) {
+			filtered = append(filtered, n.wrapConn(c))
+		}
+	}
+	return filtered
+}
+
+// Notify registers f for notifications about connections to allowed peers.
+func (n *scopedNetwork) Notify(f network.Notifiee) {
+	sn := &scopedNotifiee{Notifiee: f, net: n}
+	n.mx.Lock()
+	if n.h.isClosed() {
+		n.mx.Unlock()
+		return
+	}
+	if _, ok := n.notifiees[f]; ok {
+		n.mx.Unlock()
+		return
+	}
+	n.notifiees[f] = sn
+	n.mx.Unlock()
+	n.Network.Notify(sn)
+}
+
+func (n *scopedNetwork) StopNotify(f network.Notifiee) {
+	n.mx.Lock()
+	sn, ok := n.notifiees[f]
+	delete(n.notifiees, f)
+	n.mx.Unlock()
+	if ok {
+		n.Network.StopNotify(sn)
+	}
+}
+
+func (n *scopedNetwork) stopNotifying() {
+	n.mx.Lock()
+	notifiees := n.notifiees
+	n.notifiees = make(map[network.Notifiee]*scopedNotifiee)
+	n.mx.Unlock()
+	for _, sn := range notifiees {
+		n.Network.StopNotify(sn)
+	}
+}
+
+// SetStreamHandler is not allowed. Use Host.SetStreamHandler instead.
+func (n *scopedNetwork) SetStreamHandler(network.StreamHandler) {
+	log.Warn("refusing to set the stream handler of the network")
+}
+
+// NewStream is not allowed, since it would allow using any protocol. Use Host.NewStream instead.
+func (n *scopedNetwork) NewStream(context.Context, peer.ID) (network.Stream, error) {
+	return nil, ErrNotAllowed
+}
+
+func (n *scopedNetwork) Listen(...ma.Multiaddr) error { return ErrNotAllowed }
+func (n *scopedNetwork) Close() error                 { return ErrNotAllowed }
+
+func (n *scopedNetwork) ResourceManager() network.ResourceManager {
+	return &scopedResourceManager{ResourceManager: n.Network.ResourceManager()}
+}
+
+func (n *scopedNetwork) wrapConn(c network.Conn) network.Conn {
+	return &scopedConn{Conn: c, net: n}
+}
+
+func (n *scopedNetwork) wrapStream(s network.Stream) network.Stream {
+	return &scopedStream{Stream: s, net: n}
+}
+
+// scopedConn is a connection that doesn't allow opening streams, since
+// the protocol of these streams wouldn't be restricted.
+type scopedConn struct {
+	network.Conn
+	net *scopedNetwork
+}
+
+func (c *scopedConn) NewStream(context.Context) (network.Stream, error) {
+	return nil, ErrNotAllowed
+}
+
+// GetStreams returns the streams using allowed protocols.
+func (c *scopedConn) GetStreams() []network.Stream {
+	streams := c.Conn.GetStreams()
+	filtered := make([]network.Stream, 0, len(streams))
+	for _, s := range streams {
+		if c.net.h.allowProtocol(s.Protocol()) {
+			filtered = append(filtered, c.net.wrapStream(s))
+		}
+	}
+	return filtered
+}
+
+type scopedStream struct {
+	network.Stream
+	net *scopedNetwork
+}
+
+func (s *scopedStream) Conn() network.Conn { return s.net.wrapConn(s.Stream.Conn()) }
+
+// scopedNotifiee forwards notifications about connections to allowed peers.
+type scopedNotifiee struct {
+	network.Notifiee
+	net *scopedNetwork
+}
+
+func (n *scopedNotifiee) Listen(_ network.Network, a ma.Multiaddr) {
+	n.Notifiee.Listen(n.net, a)
+}
+
+func (n *scopedNotifiee) ListenClose(_ network.Network, a ma.Multiaddr) {
+	n.Notifiee.ListenClose(n.net, a)
+}
+
+func (n *scopedNotifiee) Connected(_ network.Network, c network.Conn) {
+	if n.net.h.allowPeer(c.RemotePeer()) {
+		n.Notifiee.Connected(n.net, n.net.wrapConn(c))
+	}
+}
+
+func (n *scopedNotifiee) Disconnected(_ network.Network, c network.Conn) {
+	if n.net.h.allowPeer(c.RemotePeer()) {
+		n.Notifiee.Disconnected(n.net, n.net.wrapConn(c))
+	}
+}
+
+// scopedResourceManager is a resource manager that can't be closed.
+type scopedResourceManager struct {
+	network.ResourceManager
+}
+
+func (r *scopedResourceManager) Close() error { return ErrNotAllowed }
@@ -0,0 +1,279 @@
+package scoped
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	ic "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func (h *Host) filterPeers(peers []peer.ID) []peer.ID {
+	if h.peers == nil {
+		return peers
+	}
+	filtered := make([]peer.ID, 0, len(peers))
+	for _, p := range peers {
+		if h.allowPeer(p) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// scopedPeerstore is a peerstore that only gives access to allowed peers, and can't be closed.
+// Its key book is read-only, and never returns private keys.
+// It doesn't embed the underlying peerstore, so that every method has to be restricted explicitly.
+type scopedPeerstore struct {
+	ps peerstore.Peerstore
+	h  *Host
+}
+
+var _ peerstore.Peerstore = &scopedPeerstore{}
+
+func (ps *scopedPeerstore) Close() error { return nil }
+
+func (ps *scopedPeerstore) Peers() peer.IDSlice { return ps.h.filterPeers(ps.ps.Peers()) }
+
+func (ps *scopedPeerstore) PeerInfo(p peer.ID) peer.AddrInfo {
+	if !ps.h.allowPeer(p) {
+		return peer.AddrInfo{ID: p}
+	}
+	return ps.ps.PeerInfo(p)
+}
+
+func (ps *scopedPeerstore) RemovePeer(p peer.ID) {
+	if ps.h.allowPeer(p) {
+		ps.ps.RemovePeer(p)
+	}
+}
+
+// AddrBook
+
+func (ps *scopedPeerstore) AddAddr(p peer.ID, addr ma.Multiaddr, ttl time.Duration) {
+	if ps.h.allowPeer(p) {
+		ps.ps.AddAddr(p, addr, ttl)
+	}
+}
+
+func (ps *scopedPeerstore) AddAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) {
+	if ps.h.allowPeer(p) {
+		ps.ps.AddAddrs(p, addrs, ttl)
+	}
+}
+
+func (ps *scopedPeerstore) SetAddr(p peer.ID, addr ma.Multiaddr, ttl time.Duration) {
+	if ps.h.allowPeer(p) {
+		ps.ps.SetAddr(p, addr, ttl)
+	}
+}
+
+func (ps *scopedPeerstore) SetAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) {
+	if ps.h.allowPeer(p) {
+		ps.ps.SetAddrs(p, addrs, ttl)
+	}
+}
+
+func (ps *scopedPeerstore) UpdateAddrs(p peer.ID, oldTTL time.Duration, newTTL time.Duration) {
+	if ps.h.allowPeer(p) {
+		ps.ps.UpdateAddrs(p, oldTTL, newTTL)
+	}
+}
+
+func (ps *scopedPeerstore) Addrs(p peer.ID) []ma.Multiaddr {
+	if !ps.h.allowPeer(p) {
+		return nil
+	}
+	return ps.ps.Addrs(p)
+}
+
+func (ps *scopedPeerstore) AddrStream(ctx context.Context, p peer.ID) <-chan ma.Multiaddr {
+	if !ps.h.allowPeer(p) {
+		ch := make(chan ma.Multiaddr)
+		close(ch)
+		return ch
+	}
+	return ps.ps.AddrStream(ctx, p)
+}
+
+func (ps *scopedPeerstore) ClearAddrs(p peer.ID) {
+	if ps.h.allowPeer(p) {
+		ps.ps.ClearAddrs(p)
+	}
+}
+
+func (ps *scopedPeerstore) PeersWithAddrs() peer.IDSlice {
+	return ps.h.filterPeers(ps.ps.PeersWithAddrs())
+}
+
+// KeyBook
+
+func (ps *scopedPeerstore) PubKey(p peer.ID) ic.PubKey {
+	if !ps.h.allowPeer(p) {
+		return nil
+	}
+	return ps.ps.PubKey(p)
+}
+
+func (ps *scopedPeerstore) AddPubKey(peer.ID, ic.PubKey) error { return ErrNotAllowed }
+
+// PrivKey never returns a private key, not even the one of the host.
+func (ps *scopedPeerstore) PrivKey(peer.ID) ic.PrivKey { return nil }
+
+func (ps *scopedPeerstore) AddPrivKey(peer.ID, ic.PrivKey) error { return ErrNotAllowed }
+
+func (ps *scopedPeerstore) PeersWithKeys() peer.IDSlice {
+	return ps.h.filterPeers(ps.ps.PeersWithKeys())
+}
+
+// PeerMetadata
+
+func (ps *scopedPeerstore) Get(p peer.ID, key string) (interface{}, error) {
+	if !ps.h.allowPeer(p) {
+		return nil, ErrPeerNotAllowed
+	}
+	return ps.ps.Get(p, key)
+}
+
+func (ps *scopedPeerstore) Put(p peer.ID, key string, val interface{}) error {
+	if !ps.h.allowPeer(p) {
+		return ErrPeerNotAllowed
+	}
+	return ps.ps.Put(p, key, val)
+}
+
+// Metrics
+
+func (ps *scopedPeerstore) RecordLatency(p peer.ID, d time.Duration) {
+	if ps.h.allowPeer(p) {
+		ps.ps.RecordLatency(p, d)
+	}
+}
+
+func (ps *scopedPeerstore) LatencyEWMA(p peer.ID) time.Duration {
+	if !ps.h.allowPeer(p) {
+		return 0
+	}
+	return ps.ps.LatencyEWMA(p)
+}
+
+// ProtoBook
+
+func (ps *scopedPeerstore) GetProtocols(p peer.ID) ([]protocol.ID, error) {
+	if !ps.h.allowPeer(p) {
+		return nil, ErrPeerNotAllowed
+	}
+	return ps.ps.GetProtocols(p)
+}
+
+func (ps *scopedPeerstore) AddProtocols(p peer.ID, protos ...protocol.ID) error {
+	if !ps.h.allowPeer(p) {
+		return ErrPeerNotAllowed
+	}
+	return ps.ps.AddProtocols(p, protos...)
+}
+
+func (ps *scopedPeerstore) SetProtocols(p peer.ID, protos ...protocol.ID) error {
+	if !ps.h.allowPeer(p) {
+		return ErrPeerNotAllowed
+	}
+	return ps.ps.SetProtocols(p, protos...)
+}
+
+func (ps *scopedPeerstore) RemoveProtocols(p peer.ID, protos ...protocol.ID) error {
+	if !ps.h.allowPeer(p) {
+		return ErrPeerNotAllowed
+	}
+	return ps.ps.RemoveProtocols(p, protos...)
+}
+
+func (ps *scopedPeerstore) SupportsProtocols(p peer.ID, protos ...protocol.ID) ([]protocol.ID, error) {
+	if !ps.h.allowPeer(p) {
+		return nil, ErrPeerNotAllowed
+	}
+	return ps.ps.SupportsProtocols(p, protos...)
+}
+
+func (ps *scopedPeerstore) FirstSupportedProtocol(p peer.ID, protos ...protocol.ID) (protocol.ID, error) {
+	if !ps.h.allowPeer(p) {
+		return "", ErrPeerNotAllowed
+	}
+	return ps.ps.FirstSupportedProtocol(p, protos...)
+}
+
+// scopedSwitch is a protocol switch that only accepts handlers for allowed protocols.
+type scopedSwitch struct {
+	protocol.Switch
+	h *Host
+}
+
+func (s *scopedSwitch) AddHandler(pid protocol.ID, handler protocol.HandlerFunc) {
+	if !s.h.registerHandler(pid) {
+		return
+	}
+	s.Switch.AddHandler(pid, s.wrapHandler(handler))
+}
+
+func (s *scopedSwitch) AddHandlerWithFunc(pid protocol.ID, match func(protocol.ID) bool, handler protocol.HandlerFunc) {
+	if !s.h.registerHandler(pid) {
+		return
+	}
+	s.Switch.AddHandlerWithFunc(pid, s.h.wrapMatch(match), s.wrapHandler(handler))
+}
+
+func (s *scopedSwitch) RemoveHandler(pid protocol.ID) {
+	if !s.h.unregisterHandler(pid) {
+		return
+	}
+	s.Switch.RemoveHandler(pid)
+}
+
+func (s *scopedSwitch) Protocols() []protocol.ID {
+	protos := s.Switch.Protocols()
+	filtered := make([]protocol.ID, 0, len(protos))
+	for _, p := range protos {
+		if s.h.allowProtocol(p) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+func (s *scopedSwitch) wrapHandler(handler protocol.HandlerFunc) protocol.HandlerFunc {
+	return func(pid protocol.ID, rwc io.ReadWriteCloser) error {
+		str, ok := rwc.(network.Stream)
+		if !ok {
+			return handler(pid, rwc)
+		}
+		if err := s.h.acceptStream(str); err != nil {
+			str.Reset()
+			return err
+		}
+		return handler(pid, s.h.net.wrapStream(str))
+	}
+}
+
+// scopedConnManager is a connection manager that can't be closed or trimmed.
+type scopedConnManager struct {
+	connmgr.ConnManager
+}
+
+func (cm *scopedConnManager) TrimOpenConns(context.Context) {}
+func (cm *scopedConnManager) Close() error                  { return nil }
+
+// scopedBus is an event bus that doesn't allow emitting events.
+type scopedBus struct {
+	event.Bus
+}
+
+func (b *scopedBus) Emitter(interface{}, ...event.EmitterOpt) (event.Emitter, error) {
+	return nil, ErrNotAllowed
+}
@@ -0,0 +1,310 @@
+// Package scoped provides restricted views of a host, which can be handed to semi-trusted
+// components (e.g. plugins) without giving them control of the entire node.
+//
+// A scoped host can only handle and open streams for an allowed set of protocols, and only
+// sees and talks to an allowed set of peers. It can't close the underlying host, its network,
+// peerstore or connection manager, it can't access private keys, and it can't emit events.
+//
+// Note that a scoped host restricts the use of the host API. It is not a sandbox: code running
+// in the same process can always circumvent it.
+package scoped
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	logging "github.com/ipfs/go-log/v2"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var log = logging.Logger("scopedhost")
+
+var (
+	// ErrProtocolNotAllowed is returned when using a protocol that is not allowed by the scope.
+	ErrProtocolNotAllowed = errors.New("scoped host: protocol not allowed")
+	// ErrPeerNotAllowed is returned when interacting with a peer that is not allowed by the scope.
+	ErrPeerNotAllowed = errors.New("scoped host: peer not allowed")
+	// ErrNotAllowed is returned when calling a method that affects the entire node.
+	ErrNotAllowed = errors.New("scoped host: operation not allowed")
+	// ErrClosed is returned when using a scoped host that was closed.
+	ErrClosed = errors.New("scoped host: closed")
+)
+
+// Policy restricts a scoped host.
+type Policy func(*Host) error
+
+// AllowProtocols allows handling and opening streams for the given protocols.
+// Protocols not allowed by any policy can't be used by the scoped host.
+func AllowProtocols(protos ...protocol.ID) Policy {
+	return func(h *Host) error {
+		for _, p := range protos {
+			h.protocols[p] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// AllowPeers restricts the scoped host to the given peers: it only sees connections to
+// these peers, and rejects streams from other peers. By default, all peers are allowed.
+func AllowPeers(peers ...peer.ID) Policy {
+	return func(h *Host) error {
+		if h.peers == nil {
+			h.peers = make(map[peer.ID]struct{}, len(peers))
+		}
+		for _, p := range peers {
+			h.peers[p] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithService attaches all streams of the scoped host to the given service in the resource
+// manager. Use this to cap the resources used by the scoped host, by setting limits for the service.
+func WithService(name string) Policy {
+	return func(h *Host) error {
+		if name == "" {
+			return errors.New("empty service name")
+		}
+		h.service = name
+		return nil
+	}
+}
+
+// Host is a restricted view of a host. It is created using New.
+type Host struct {
+	h host.Host
+
+	protocols map[protocol.ID]struct{}
+	// peers are the allowed peers. nil means that all peers are allowed.
+	peers   map[peer.ID]struct{}
+	service string
+
+	net *scopedNetwork
+	ps  *scopedPeerstore
+	mux *scopedSwitch
+	cm  *scopedConnManager
+	bus *scopedBus
+
+	mx     sync.Mutex
+	closed bool
+	// handlers are the protocols handlers were registered for by the scoped host
+	handlers map[protocol.ID]struct{}
+}
+
+var _ host.Host = &Host{}
+
+// New creates a restricted view of h. At least one protocol needs to be allowed using AllowProtocols.
+func New(h host.Host, policies ...Policy) (*Host, error) {
+	sh := &Host{
+		h:         h,
+		protocols: make(map[protocol.ID]struct{}),
+		handlers:  make(map[protocol.ID]struct{}),
+	}
+	for _, p := range policies {
+		if err := p(sh); err != nil {
+			return nil, err
+		}
+	}
+	if len(sh.protocols) == 0 {
+		return nil, errors.New("no protocols allowed")
+	}
+	sh.ps = &scopedPeerstore{ps: h.Peerstore(), h: sh}
+	sh.net = newScopedNetwork(sh, h.Network())
+	sh.mux = &scopedSwitch{Switch: h.Mux(), h: sh}
+	sh.cm = &scopedConnManager{ConnManager: h.ConnManager()}
+	sh.bus = &scopedBus{Bus: h.EventBus()}
+	return sh, nil
+}
+
+func (h *Host) allowProtocol(p protocol.ID) bool {
+	_, ok := h.protocols[p]
+	return ok
+}
+
+func (h *Host) allowPeer(p peer.ID) bool {
+	if h.peers == nil {
+		return true
+	}
+	_, ok := h.peers[p]
+	return ok
+}
+
+func (h *Host) isClosed() bool {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	return h.closed
+}
+
+// ID returns the peer ID of the underlying host.
+func (h *Host) ID() peer.ID { return h.h.ID() }
+
+// Addrs returns the addresses of the underlying host.
+func (h *Host) Addrs() []ma.Multiaddr { return h.h.Addrs() }
+
+// Peerstore returns a view of the peerstore that only gives access to allowed peers, and can't be closed.
+// Its key book is read-only, and it never returns private keys.
+func (h *Host) Peerstore() peerstore.Peerstore { return h.ps }
+
+// Network returns a view of the network that only sees connections to allowed peers.
+// Streams can't be opened using the network, use NewStream instead.
+func (h *Host) Network() network.Network { return h.net }
+
+// Mux returns a view of the protocol switch that only accepts handlers for allowed protocols.
+func (h *Host) Mux() protocol.Switch { return h.mux }
+
+// ConnManager returns a view of the connection manager that can't be closed or trimmed.
+func (h *Host) ConnManager() connmgr.ConnManager { return h.cm }
+
+// EventBus returns a view of the event bus that can be subscribed to, but doesn't allow emitting events.
+func (h *Host) EventBus() event.Bus { return h.bus }
+
+// Connect connects to an allowed peer.
+func (h *Host) Connect(ctx context.Context, pi peer.AddrInfo) error {
+	if h.isClosed() {
+		return ErrClosed
+	}
+	if !h.allowPeer(pi.ID) {
+		return ErrPeerNotAllowed
+	}
+	return h.h.Connect(ctx, pi)
+}
+
+// SetStreamHandler sets the handler for an allowed protocol.
+// Streams from peers that are not allowed are reset.
+func (h *Host) SetStreamHandler(pid protocol.ID, handler network.StreamHandler) {
+	if !h.registerHandler(pid) {
+		return
+	}
+	h.h.SetStreamHandler(pid, h.wrapHandler(handler))
+}
+
+// SetStreamHandlerMatch sets the handler for an allowed protocol, using a match function.
+// The match function only matches allowed protocols.
+func (h *Host) SetStreamHandlerMatch(pid protocol.ID, match func(protocol.ID) bool, handler network.StreamHandler) {
+	if !h.registerHandler(pid) {
+		return
+	}
+	h.h.SetStreamHandlerMatch(pid, h.wrapMatch(match), h.wrapHandler(handler))
+}
+
+// RemoveStreamHandler removes a handler that was set using this scoped host.
+func (h *Host) RemoveStreamHandler(pid protocol.ID) {
+	if !h.unregisterHandler(pid) {
+		return
+	}
+	h.h.RemoveStreamHandler(pid)
+}
+
+// registerHandler records that a handler is registered for pid. It returns false if the handler must not be registered.
+func (h *Host) registerHandler(pid protocol.ID) bool {
+	if !h.allowProtocol(pid) {
+		log.Warnw("refusing to set handler for protocol that is not allowed", "protocol", pid)
+		return false
+	}
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	if h.closed {
+		return false
+	}
+	h.handlers[pid] = struct{}{}
+	return true
+}
+
+func (h *Host) unregisterHandler(pid protocol.ID) bool {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	if _, ok := h.handlers[pid]; !ok {
+		return false
+	}
+	delete(h.handlers, pid)
+	return true
+}
+
+func (h *Host) wrapMatch(match func(protocol.ID) bool) func(protocol.ID) bool {
+	return func(p protocol.ID) bool { return h.allowProtocol(p) && match(p) }
+}
+
+// acceptStream checks that a stream is allowed by the scope, and attaches it to the service.
+func (h *Host) acceptStream(s network.Stream) error {
+	if h.isClosed() {
+		return ErrClosed
+	}
+	if !h.allowPeer(s.Conn().RemotePeer()) {
+		return ErrPeerNotAllowed
+	}
+	if h.service != "" {
+		if err := s.Scope().SetService(h.service); err != nil {
+			return fmt.Errorf("failed to attach stream to service %s: %w", h.service, err)
+		}
+	}
+	return nil
+}
+
+func (h *Host) wrapHandler(handler network.StreamHandler) network.StreamHandler {
+	return func(s network.Stream) {
+		if err := h.acceptStream(s); err != nil {
+			log.Debugw("rejecting stream", "peer", s.Conn().RemotePeer(), "protocol", s.Protocol(), "error", err)
+			s.Reset()
+			return
+		}
+		handler(h.net.wrapStream(s))
+	}
+}
+
+// NewStream opens a new stream to an allowed peer. Protocols that are not allowed are skipped.
+func (h *Host) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (network.Stream, error) {
+	if h.isClosed() {
+		return nil, ErrClosed
+	}
+	if !h.allowPeer(p) {
+		return nil, ErrPeerNotAllowed
+	}
+	allowed := make([]protocol.ID, 0, len(pids))
+	for _, pid := range pids {
+		if h.allowProtocol(pid) {
+			allowed = append(allowed, pid)
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, ErrProtocolNotAllowed
+	}
+	s, err := h.h.NewStream(ctx, p, allowed...)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.acceptStream(s); err != nil {
+		s.Reset()
+		return nil, err
+	}
+	return h.net.wrapStream(s), nil
+}
+
+// Close closes the scoped host: it removes all stream handlers and notifiees registered
+// using this scoped host. It doesn't close the underlying host.
+func (h *Host) Close() error {
+	h.mx.Lock()
+	if h.closed {
+		h.mx.Unlock()
+		return nil
+	}
+	h.closed = true
+	handlers := h.handlers
+	h.handlers = nil
+	h.mx.Unlock()
+
+	for pid := range handlers {
+		h.h.RemoveStreamHandler(pid)
+	}
+	h.net.stopNotifying()
+	return nil
+}
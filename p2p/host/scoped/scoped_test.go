@@ -0,0 +1,218 @@
+package scoped_test
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"testing"
+	"time"
+
+	ic "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	"github.com/libp2p/go-libp2p/p2p/host/scoped"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	allowedProto    = protocol.ID("/allowed")
+	disallowedProto = protocol.ID("/disallowed")
+)
+
+func newHost(t *testing.T) *bhost.BasicHost {
+	t.Helper()
+	h, err := bhost.NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), nil)
+	require.NoError(t, err)
+	h.Start()
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func connect(t *testing.T, a, b host.Host) {
+	t.Helper()
+	require.NoError(t, a.Connect(context.Background(), peer.AddrInfo{ID: b.ID(), Addrs: b.Addrs()}))
+}
+
+func echo(s network.Stream) {
+	defer s.Close()
+	io.Copy(s, s)
+}
+
+func TestNewRequiresProtocols(t *testing.T) {
+	_, err := scoped.New(newHost(t))
+	require.Error(t, err)
+}
+
+func TestScopedProtocols(t *testing.T) {
+	h1, h2 := newHost(t), newHost(t)
+	sh, err := h1.Scoped(scoped.AllowProtocols(allowedProto))
+	require.NoError(t, err)
+	defer sh.Close()
+
+	sh.SetStreamHandler(disallowedProto, echo)
+	require.NotContains(t, h1.Mux().Protocols(), disallowedProto)
+	h2.SetStreamHandler(allowedProto, echo)
+	h2.SetStreamHandler(disallowedProto, echo)
+	connect(t, h1, h2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = sh.NewStream(ctx, h2.ID(), disallowedProto)
+	require.ErrorIs(t, err, scoped.ErrProtocolNotAllowed)
+	_, err = sh.Network().NewStream(ctx, h2.ID())
+	require.ErrorIs(t, err, scoped.ErrNotAllowed)
+	for _, c := range sh.Network().ConnsToPeer(h2.ID()) {
+		_, err := c.NewStream(ctx)
+		require.ErrorIs(t, err, scoped.ErrNotAllowed)
+	}
+
+	s, err := sh.NewStream(ctx, h2.ID(), disallowedProto, allowedProto)
+	require.NoError(t, err)
+	require.Equal(t, allowedProto, s.Protocol())
+	_, err = s.Write([]byte("foobar"))
+	require.NoError(t, err)
+	require.NoError(t, s.CloseWrite())
+	b, err := io.ReadAll(s)
+	require.NoError(t, err)
+	require.Equal(t, "foobar", string(b))
+	_, err = s.Conn().NewStream(ctx)
+	require.ErrorIs(t, err, scoped.ErrNotAllowed)
+
+	require.ErrorIs(t, sh.Network().Close(), scoped.ErrNotAllowed)
+	require.ErrorIs(t, sh.Network().ResourceManager().Close(), scoped.ErrNotAllowed)
+	_, err = sh.EventBus().Emitter(new(struct{}))
+	require.ErrorIs(t, err, scoped.ErrNotAllowed)
+	require.NoError(t, sh.Peerstore().Close())
+	require.Contains(t, h1.Peerstore().Peers(), h2.ID())
+}
+
+func TestScopedPeers(t *testing.T) {
+	h1, h2, h3 := newHost(t), newHost(t), newHost(t)
+	sh, err := scoped.New(h1, scoped.AllowProtocols(allowedProto), scoped.AllowPeers(h2.ID()))
+	require.NoError(t, err)
+	defer sh.Close()
+
+	sh.SetStreamHandler(allowedProto, echo)
+	connect(t, h2, h1)
+	connect(t, h3, h1)
+
+	require.Equal(t, []peer.ID{h2.ID()}, sh.Network().Peers())
+	require.Len(t, sh.Network().Conns(), 1)
+	require.Empty(t, sh.Network().ConnsToPeer(h3.ID()))
+	require.Equal(t, network.NotConnected, sh.Network().Connectedness(h3.ID()))
+	require.NotContains(t, sh.Peerstore().Peers(), h3.ID())
+	require.ErrorIs(t, sh.Connect(context.Background(), peer.AddrInfo{ID: h3.ID(), Addrs: h3.Addrs()}), scoped.ErrPeerNotAllowed)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = sh.NewStream(ctx, h3.ID(), allowedProto)
+	require.ErrorIs(t, err, scoped.ErrPeerNotAllowed)
+
+	for _, tc := range []struct {
+		h       host.Host
+		allowed bool
+	}{{h2, true}, {h3, false}} {
+		s, err := tc.h.NewStream(ctx, h1.ID(), allowedProto)
+		require.NoError(t, err)
+		_, err = s.Write([]byte("foobar"))
+		require.NoError(t, err)
+		require.NoError(t, s.CloseWrite())
+		b, err := io.ReadAll(s)
+		if tc.allowed {
+			require.NoError(t, err)
+			require.Equal(t, "foobar", string(b))
+		} else {
+			require.Error(t, err)
+		}
+	}
+}
+
+func TestScopedClose(t *testing.T) {
+	h := newHost(t)
+	sh, err := scoped.New(h, scoped.AllowProtocols(allowedProto, disallowedProto))
+	require.NoError(t, err)
+
+	h.SetStreamHandler(disallowedProto, echo)
+	sh.SetStreamHandler(allowedProto, echo)
+	// handlers registered on the underlying host can't be removed by the scoped host
+	sh.RemoveStreamHandler(disallowedProto)
+	require.ElementsMatch(t, []protocol.ID{allowedProto, disallowedProto}, sh.Mux().Protocols())
+
+	require.NoError(t, sh.Close())
+	require.NotContains(t, h.Mux().Protocols(), allowedProto)
+	require.Contains(t, h.Mux().Protocols(), disallowedProto)
+	_, err = sh.NewStream(context.Background(), h.ID(), allowedProto)
+	require.ErrorIs(t, err, scoped.ErrClosed)
+	sh.SetStreamHandler(allowedProto, echo)
+	require.NotContains(t, h.Mux().Protocols(), allowedProto)
+}
+
+func TestScopedPeerstoreKeys(t *testing.T) {
+	h1, h2 := newHost(t), newHost(t)
+	sh, err := scoped.New(h1, scoped.AllowProtocols(allowedProto))
+	require.NoError(t, err)
+	defer sh.Close()
+	connect(t, h1, h2)
+
+	ps := sh.Peerstore()
+	require.Nil(t, ps.PrivKey(h1.ID()))
+	require.NotNil(t, h1.Peerstore().PrivKey(h1.ID()))
+	require.NotNil(t, ps.PubKey(h2.ID()))
+
+	priv, pub, err := ic.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	id, err := peer.IDFromPublicKey(pub)
+	require.NoError(t, err)
+	require.ErrorIs(t, ps.AddPrivKey(id, priv), scoped.ErrNotAllowed)
+	require.ErrorIs(t, ps.AddPubKey(id, pub), scoped.ErrNotAllowed)
+	require.Nil(t, h1.Peerstore().PrivKey(id))
+	require.NotContains(t, h1.Peerstore().PeersWithKeys(), id)
+}
+
+func TestScopedPeerstorePeers(t *testing.T) {
+	h1, h2, h3 := newHost(t), newHost(t), newHost(t)
+	sh, err := scoped.New(h1, scoped.AllowProtocols(allowedProto), scoped.AllowPeers(h2.ID()))
+	require.NoError(t, err)
+	defer sh.Close()
+	connect(t, h1, h2)
+	connect(t, h1, h3)
+
+	ps := sh.Peerstore()
+	require.NotEmpty(t, ps.Addrs(h2.ID()))
+	require.Empty(t, ps.Addrs(h3.ID()))
+	require.Empty(t, ps.PeerInfo(h3.ID()).Addrs)
+	require.Nil(t, ps.PubKey(h3.ID()))
+	require.NotContains(t, ps.PeersWithAddrs(), h3.ID())
+	require.NotContains(t, ps.PeersWithKeys(), h3.ID())
+
+	// writes for peers that are not allowed don't reach the underlying peerstore
+	addrs := h1.Peerstore().Addrs(h3.ID())
+	ps.ClearAddrs(h3.ID())
+	ps.SetAddrs(h3.ID(), nil, 0)
+	ps.AddAddrs(h3.ID(), h2.Addrs(), time.Hour)
+	require.ElementsMatch(t, addrs, h1.Peerstore().Addrs(h3.ID()))
+	require.ErrorIs(t, ps.SetProtocols(h3.ID(), allowedProto), scoped.ErrPeerNotAllowed)
+	require.ErrorIs(t, ps.AddProtocols(h3.ID(), allowedProto), scoped.ErrPeerNotAllowed)
+	_, err = ps.GetProtocols(h3.ID())
+	require.ErrorIs(t, err, scoped.ErrPeerNotAllowed)
+	require.ErrorIs(t, ps.Put(h3.ID(), "foo", "bar"), scoped.ErrPeerNotAllowed)
+	_, err = h1.Peerstore().Get(h3.ID(), "foo")
+	require.Error(t, err)
+	ps.RemovePeer(h3.ID())
+	require.NotEmpty(t, h1.Peerstore().Addrs(h3.ID()))
+
+	// allowed peers can be written
+	require.NoError(t, ps.AddProtocols(h2.ID(), allowedProto))
+	protos, err := h1.Peerstore().GetProtocols(h2.ID())
+	require.NoError(t, err)
+	require.Contains(t, protos, allowedProto)
+	require.NoError(t, ps.Put(h2.ID(), "foo", "bar"))
+	v, err := ps.Get(h2.ID(), "foo")
+	require.NoError(t, err)
+	require.Equal(t, "bar", v)
+}
@@ -0,0 +1,282 @@
+// Package stats records aggregate dial and connection statistics, and persists them
+// to a datastore, such that long-term trends survive restarts.
+// This is useful for nodes that don't have any external monitoring set up.
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/metricshelper"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+
+	ds "github.com/ipfs/go-datastore"
+	logging "github.com/ipfs/go-log/v2"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var log = logging.Logger("stats")
+
+const defaultInterval = 5 * time.Minute
+
+// DefaultKey is the datastore key the statistics are stored under.
+var DefaultKey = ds.NewKey("/libp2p/stats")
+
+// Stats are the aggregate statistics.
+type Stats struct {
+	// Since is the time the statistics were first recorded.
+	Since time.Time
+	// Dials is the number of times we dialed a peer, and DialsSucceeded the number of
+	// these dials that resulted in a connection. A single dial may try multiple addresses.
+	Dials, DialsSucceeded uint64
+	// ConnsOpened and ConnsClosed are the number of connections opened and closed.
+	ConnsOpened, ConnsClosed uint64
+	// ConnDuration is the total duration of all closed connections.
+	ConnDuration time.Duration
+	// Transports are the statistics per transport, keyed by transport name (e.g. "tcp" or "quic-v1").
+	Transports map[string]TransportStats
+}
+
+// TransportStats are the statistics for a single transport.
+type TransportStats struct {
+	// Inbound and Outbound are the number of connections established.
+	Inbound, Outbound uint64
+	// DialFailures is the number of failed dials.
+	DialFailures uint64
+}
+
+// DialSuccessRate is the fraction of dials that succeeded.
+// It is 0 if no dials were made.
+func (s Stats) DialSuccessRate() float64 {
+	if s.Dials == 0 {
+		return 0
+	}
+	return float64(s.DialsSucceeded) / float64(s.Dials)
+}
+
+// AverageConnDuration is the average duration of closed connections.
+func (s Stats) AverageConnDuration() time.Duration {
+	if s.ConnsClosed == 0 {
+		return 0
+	}
+	return s.ConnDuration / time.Duration(s.ConnsClosed)
+}
+
+// DialSuccessRate is the fraction of dials on this transport that succeeded.
+// It is 0 if no dials were made.
+func (s TransportStats) DialSuccessRate() float64 {
+	if s.Outbound+s.DialFailures == 0 {
+		return 0
+	}
+	return float64(s.Outbound) / float64(s.Outbound+s.DialFailures)
+}
+
+func (s Stats) clone() Stats {
+	c := s
+	c.Transports = make(map[string]TransportStats, len(s.Transports))
+	for k, v := range s.Transports {
+		c.Transports[k] = v
+	}
+	return c
+}
+
+// Option is an option for the Recorder.
+type Option func(*Recorder) error
+
+// WithInterval sets the interval at which the statistics are persisted.
+// Defaults to 5 minutes.
+func WithInterval(d time.Duration) Option {
+	return func(r *Recorder) error {
+		if d <= 0 {
+			return errors.New("interval must be positive")
+		}
+		r.interval = d
+		return nil
+	}
+}
+
+// WithKey sets the datastore key that the statistics are stored under.
+// Defaults to DefaultKey.
+func WithKey(k ds.Key) Option {
+	return func(r *Recorder) error {
+		r.key = k
+		return nil
+	}
+}
+
+// Recorder records dial and connection statistics, and periodically persists them to a datastore.
+// The statistics are collected by the swarm.MetricsTracer returned from SwarmMetricsTracer.
+// Use the libp2p.StatsRecorder option to record the statistics of a host.
+type Recorder struct {
+	ds       ds.Datastore
+	key      ds.Key
+	interval time.Duration
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	refCount  sync.WaitGroup
+
+	mx    sync.Mutex
+	stats Stats
+}
+
+// NewRecorder creates a new Recorder, loading the statistics persisted by a previous run.
+func NewRecorder(d ds.Datastore, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		ds:       d,
+		key:      DefaultKey,
+		interval: defaultInterval,
+	}
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.ctx, r.ctxCancel = context.WithCancel(context.Background())
+	r.refCount.Add(1)
+	go r.background()
+	return r, nil
+}
+
+func (r *Recorder) load() error {
+	b, err := r.ds.Get(context.Background(), r.key)
+	if err == ds.ErrNotFound {
+		r.stats = Stats{Since: time.Now(), Transports: make(map[string]TransportStats)}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, &r.stats); err != nil {
+		return err
+	}
+	if r.stats.Transports == nil {
+		r.stats.Transports = make(map[string]TransportStats)
+	}
+	return nil
+}
+
+func (r *Recorder) background() {
+	defer r.refCount.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.Persist(); err != nil {
+				log.Warnw("failed to persist statistics", "error", err)
+			}
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// Persist stores the statistics in the datastore.
+// This happens automatically at the configured interval, and when the Recorder is closed.
+func (r *Recorder) Persist() error {
+	r.mx.Lock()
+	b, err := json.Marshal(r.stats)
+	r.mx.Unlock()
+	if err != nil {
+		return err
+	}
+	return r.ds.Put(context.Background(), r.key, b)
+}
+
+// Stats returns the statistics.
+func (r *Recorder) Stats() Stats {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.stats.clone()
+}
+
+// Reset resets the statistics.
+func (r *Recorder) Reset() {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.stats = Stats{Since: time.Now(), Transports: make(map[string]TransportStats)}
+}
+
+// Close stops the Recorder, and persists the statistics one last time.
+func (r *Recorder) Close() error {
+	r.ctxCancel()
+	r.refCount.Wait()
+	return r.Persist()
+}
+
+// SwarmMetricsTracer wraps a swarm.MetricsTracer, feeding dials and connections into the Recorder.
+// If next is nil, the statistics are recorded without forwarding to another tracer.
+func (r *Recorder) SwarmMetricsTracer(next swarm.MetricsTracer) swarm.MetricsTracer {
+	if next == nil {
+		next = swarm.NopMetricsTracer()
+	}
+	return &swarmMetricsTracer{MetricsTracer: next, r: r}
+}
+
+type swarmMetricsTracer struct {
+	swarm.MetricsTracer
+	r *Recorder
+}
+
+func (t *swarmMetricsTracer) OpenedConnection(dir network.Direction, p crypto.PubKey, cs network.ConnectionState, laddr ma.Multiaddr) {
+	t.r.mx.Lock()
+	t.r.stats.ConnsOpened++
+	transport := metricshelper.GetTransport(laddr)
+	ts := t.r.stats.Transports[transport]
+	if dir == network.DirInbound {
+		ts.Inbound++
+	} else {
+		ts.Outbound++
+	}
+	t.r.stats.Transports[transport] = ts
+	t.r.mx.Unlock()
+
+	t.MetricsTracer.OpenedConnection(dir, p, cs, laddr)
+}
+
+func (t *swarmMetricsTracer) ClosedConnection(dir network.Direction, d time.Duration, cs network.ConnectionState, laddr ma.Multiaddr) {
+	t.r.mx.Lock()
+	t.r.stats.ConnsClosed++
+	t.r.stats.ConnDuration += d
+	t.r.mx.Unlock()
+
+	t.MetricsTracer.ClosedConnection(dir, d, cs, laddr)
+}
+
+func (t *swarmMetricsTracer) FailedDialing(addr ma.Multiaddr, err error) {
+	// Dials are canceled when a dial to a different address of the peer succeeded.
+	if errors.Is(err, context.Canceled) {
+		t.MetricsTracer.FailedDialing(addr, err)
+		return
+	}
+
+	t.r.mx.Lock()
+	transport := metricshelper.GetTransport(addr)
+	ts := t.r.stats.Transports[transport]
+	ts.DialFailures++
+	t.r.stats.Transports[transport] = ts
+	t.r.mx.Unlock()
+
+	t.MetricsTracer.FailedDialing(addr, err)
+}
+
+func (t *swarmMetricsTracer) DialCompleted(success bool, totalDials int) {
+	t.r.mx.Lock()
+	t.r.stats.Dials++
+	if success {
+		t.r.stats.DialsSucceeded++
+	}
+	t.r.mx.Unlock()
+
+	t.MetricsTracer.DialCompleted(success, totalDials)
+}
@@ -0,0 +1,100 @@
+package stats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptions(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	_, err := NewRecorder(d, WithInterval(0))
+	require.Error(t, err)
+}
+
+func TestStatsPersisted(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	r, err := NewRecorder(d, WithInterval(time.Hour))
+	require.NoError(t, err)
+	since := r.Stats().Since
+	require.False(t, since.IsZero())
+
+	s1 := swarmt.GenSwarm(t, swarmt.OptDisableQUIC, swarmt.WithSwarmOpts(swarm.WithMetricsTracer(r.SwarmMetricsTracer(swarm.NewMetricsTracer()))))
+	defer s1.Close()
+	s2 := swarmt.GenSwarm(t, swarmt.OptDisableQUIC)
+	defer s2.Close()
+
+	s1.Peerstore().AddAddrs(s2.LocalPeer(), s2.ListenAddresses(), time.Hour)
+	c, err := s1.DialPeer(context.Background(), s2.LocalPeer())
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+
+	// dialing a peer that isn't listening fails
+	s3 := swarmt.GenSwarm(t, swarmt.OptDisableQUIC)
+	addrs := s3.ListenAddresses()
+	require.NoError(t, s3.Close())
+	s1.Peerstore().AddAddrs(s3.LocalPeer(), addrs, time.Hour)
+	_, err = s1.DialPeer(context.Background(), s3.LocalPeer())
+	require.Error(t, err)
+
+	check := func(st Stats) {
+		t.Helper()
+		require.Equal(t, uint64(2), st.Dials)
+		require.Equal(t, uint64(1), st.DialsSucceeded)
+		require.Equal(t, 0.5, st.DialSuccessRate())
+		require.Equal(t, uint64(1), st.ConnsOpened)
+		require.Equal(t, uint64(1), st.ConnsClosed)
+		require.Equal(t, TransportStats{Outbound: 1, DialFailures: 1}, st.Transports["tcp"])
+		require.Equal(t, 0.5, st.Transports["tcp"].DialSuccessRate())
+		require.True(t, since.Equal(st.Since))
+	}
+	require.Eventually(t, func() bool { return r.Stats().ConnsClosed == 1 }, time.Second, 10*time.Millisecond)
+	check(r.Stats())
+	require.NoError(t, r.Close())
+
+	// the statistics are loaded after a restart
+	r, err = NewRecorder(d)
+	require.NoError(t, err)
+	defer r.Close()
+	check(r.Stats())
+
+	r.Reset()
+	require.Zero(t, r.Stats().Dials)
+	require.Empty(t, r.Stats().Transports)
+}
+
+func TestStatsCustomKey(t *testing.T) {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	r, err := NewRecorder(d, WithKey(ds.NewKey("/foo")))
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+
+	_, err = d.Get(context.Background(), ds.NewKey("/foo"))
+	require.NoError(t, err)
+	_, err = d.Get(context.Background(), DefaultKey)
+	require.ErrorIs(t, err, ds.ErrNotFound)
+}
+
+func TestStatsWithoutNextTracer(t *testing.T) {
+	r, err := NewRecorder(dssync.MutexWrap(ds.NewMapDatastore()))
+	require.NoError(t, err)
+	defer r.Close()
+
+	s1 := swarmt.GenSwarm(t, swarmt.OptDisableQUIC, swarmt.WithSwarmOpts(swarm.WithMetricsTracer(r.SwarmMetricsTracer(nil))))
+	defer s1.Close()
+	s2 := swarmt.GenSwarm(t, swarmt.OptDisableQUIC)
+	defer s2.Close()
+
+	s1.Peerstore().AddAddrs(s2.LocalPeer(), s2.ListenAddresses(), time.Hour)
+	_, err = s1.DialPeer(context.Background(), s2.LocalPeer())
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return r.Stats().DialsSucceeded == 1 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, uint64(1), r.Stats().ConnsOpened)
+}
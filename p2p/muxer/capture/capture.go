@@ -0,0 +1,170 @@
+// Package capture implements an opt-in, per-connection capture of stream muxer frame headers,
+// to diagnose muxer and flow control issues in the field.
+//
+// Wrap a muxer using NewMultiplexer, and pass it to libp2p:
+//
+//	mux, err := capture.NewMultiplexer(yamux.DefaultTransport, capture.Yamux, capture.NewFileSink(dir), capture.WithSampleRate(0.01))
+//	libp2p.New(libp2p.Muxer(yamux.ID, mux))
+//
+// Only frame headers are captured, payloads never are. Headers are recorded with the time they
+// were read or written, either in memory (see RingBuffer) or in the following binary format
+// (see Writer and Reader). All integers are big endian.
+//
+//	file    = magic version format record*
+//	magic   = "LPCP"
+//	version = uint8          ; currently 1
+//	format  = uvarint bytes  ; name of the frame format, e.g. "yamux"
+//	record  = time dir len header
+//	time    = int64          ; nanoseconds since the Unix epoch
+//	dir     = uint8          ; 0: inbound, 1: outbound
+//	len     = uint8          ; length of the header
+//	header  = bytes          ; the frame header, as sent on the wire
+package capture
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	logging "github.com/ipfs/go-log/v2"
+)
+
+var log = logging.Logger("muxer-capture")
+
+// ConnInfo describes a captured connection.
+type ConnInfo struct {
+	// Peer is the remote peer. It is empty if the muxer is used without a resource manager scope.
+	Peer       peer.ID
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+	// IsServer is true if we're the server side of the muxer.
+	IsServer bool
+	// Format is the name of the frame format.
+	Format string
+}
+
+type Option func(*Multiplexer) error
+
+// WithSampleRate captures only a fraction of the connections, between 0 and 1.
+// By default, all connections are captured.
+func WithSampleRate(rate float64) Option {
+	return func(m *Multiplexer) error {
+		if rate < 0 || rate > 1 {
+			return errors.New("sample rate must be between 0 and 1")
+		}
+		m.sampleRate = rate
+		return nil
+	}
+}
+
+// Multiplexer wraps a network.Multiplexer, capturing the frame headers of its connections.
+type Multiplexer struct {
+	network.Multiplexer
+
+	format     *FrameFormat
+	newSink    func(ConnInfo) (Sink, error)
+	sampleRate float64
+}
+
+var _ network.Multiplexer = &Multiplexer{}
+
+// NewMultiplexer wraps m, which uses the given frame format. newSink is called for every
+// sampled connection, and returns the Sink the connection's frame headers are recorded to.
+func NewMultiplexer(m network.Multiplexer, format *FrameFormat, newSink func(ConnInfo) (Sink, error), opts ...Option) (*Multiplexer, error) {
+	if format.MaxHeaderSize <= 0 || format.MaxHeaderSize > maxHeaderSize {
+		return nil, errors.New("invalid maximum frame header size")
+	}
+	mux := &Multiplexer{
+		Multiplexer: m,
+		format:      format,
+		newSink:     newSink,
+		sampleRate:  1,
+	}
+	for _, opt := range opts {
+		if err := opt(mux); err != nil {
+			return nil, err
+		}
+	}
+	return mux, nil
+}
+
+func (m *Multiplexer) NewConn(c net.Conn, isServer bool, scope network.PeerScope) (network.MuxedConn, error) {
+	if m.sampleRate < 1 && rand.Float64() >= m.sampleRate {
+		return m.Multiplexer.NewConn(c, isServer, scope)
+	}
+	info := ConnInfo{
+		LocalAddr:  c.LocalAddr(),
+		RemoteAddr: c.RemoteAddr(),
+		IsServer:   isServer,
+		Format:     m.format.Name,
+	}
+	if scope != nil {
+		info.Peer = scope.Peer()
+	}
+	sink, err := m.newSink(info)
+	if err != nil {
+		log.Warnw("failed to create capture sink", "peer", info.Peer, "error", err)
+		return m.Multiplexer.NewConn(c, isServer, scope)
+	}
+	cc := &conn{
+		Conn: c,
+		sink: sink,
+		in:   newFramer(m.format, DirInbound, sink),
+		out:  newFramer(m.format, DirOutbound, sink),
+	}
+	mc, err := m.Multiplexer.NewConn(cc, isServer, scope)
+	if err != nil {
+		sink.Close()
+		return nil, err
+	}
+	return mc, nil
+}
+
+// conn is a net.Conn that records the frame headers read from and written to it.
+type conn struct {
+	net.Conn
+	sink Sink
+
+	readMx sync.Mutex
+	in     *framer
+
+	writeMx sync.Mutex
+	out     *framer
+
+	closeOnce sync.Once
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.readMx.Lock()
+		c.in.feed(b[:n], time.Now())
+		c.readMx.Unlock()
+	}
+	return n, err
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.writeMx.Lock()
+		c.out.feed(b[:n], time.Now())
+		c.writeMx.Unlock()
+	}
+	return n, err
+}
+
+func (c *conn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		if err := c.sink.Close(); err != nil {
+			log.Debugw("failed to close capture sink", "error", err)
+		}
+	})
+	return err
+}
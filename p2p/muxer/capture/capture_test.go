@@ -0,0 +1,213 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/muxer/yamux"
+
+	"github.com/stretchr/testify/require"
+)
+
+func yamuxHeader(typ byte, streamID, length uint32) []byte {
+	hdr := make([]byte, 12)
+	hdr[1] = typ
+	binary.BigEndian.PutUint32(hdr[4:8], streamID)
+	binary.BigEndian.PutUint32(hdr[8:12], length)
+	return hdr
+}
+
+func TestFramerSplitsFrames(t *testing.T) {
+	var stream []byte
+	data := yamuxHeader(0, 1, 5)
+	stream = append(stream, data...)
+	stream = append(stream, "hello"...)
+	windowUpdate := yamuxHeader(1, 1, 1<<20)
+	stream = append(stream, windowUpdate...)
+	empty := yamuxHeader(0, 3, 0)
+	stream = append(stream, empty...)
+
+	// feeding the stream in chunks of any size results in the same frames
+	for _, chunk := range []int{1, 5, 12, 13, len(stream)} {
+		rb := NewRingBuffer(10)
+		f := newFramer(Yamux, DirOutbound, rb)
+		for b := stream; len(b) > 0; {
+			n := chunk
+			if n > len(b) {
+				n = len(b)
+			}
+			f.feed(b[:n], time.Now())
+			b = b[n:]
+		}
+		require.False(t, f.failed)
+		records := rb.Records()
+		require.Len(t, records, 3, "chunk size %d", chunk)
+		for i, hdr := range [][]byte{data, windowUpdate, empty} {
+			require.Equal(t, hdr, records[i].Header, "chunk size %d", chunk)
+			require.Equal(t, DirOutbound, records[i].Direction)
+		}
+	}
+}
+
+func TestMplexFormat(t *testing.T) {
+	hdr := binary.AppendUvarint(nil, 42<<3|2)
+	hdr = binary.AppendUvarint(hdr, 300)
+	n, payload, err := Mplex.ParseHeader(hdr)
+	require.NoError(t, err)
+	require.Equal(t, len(hdr), n)
+	require.Equal(t, 300, payload)
+
+	n, _, err = Mplex.ParseHeader(hdr[:len(hdr)-1])
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
+
+func TestRingBuffer(t *testing.T) {
+	rb := NewRingBuffer(3)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, rb.WriteRecord(Record{Header: []byte{byte(i)}}))
+	}
+	records := rb.Records()
+	require.Len(t, records, 3)
+	for i, r := range records {
+		require.Equal(t, []byte{byte(i + 2)}, r.Header)
+	}
+}
+
+func TestFileFormat(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "yamux")
+	require.NoError(t, err)
+	now := time.Unix(0, time.Now().UnixNano())
+	records := []Record{
+		{Time: now, Direction: DirInbound, Header: yamuxHeader(0, 1, 5)},
+		{Time: now.Add(time.Millisecond), Direction: DirOutbound, Header: yamuxHeader(2, 0, 1)},
+	}
+	for _, r := range records {
+		require.NoError(t, w.WriteRecord(r))
+	}
+	require.NoError(t, w.Close())
+
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	require.Equal(t, "yamux", r.Format())
+	for _, rec := range records {
+		read, err := r.Next()
+		require.NoError(t, err)
+		require.True(t, rec.Time.Equal(read.Time))
+		require.Equal(t, rec.Direction, read.Direction)
+		require.Equal(t, rec.Header, read.Header)
+	}
+	_, err = r.Next()
+	require.ErrorIs(t, err, io.EOF)
+
+	_, err = NewReader(bytes.NewReader([]byte("not a capture file")))
+	require.Error(t, err)
+}
+
+func TestCaptureYamux(t *testing.T) {
+	dir := t.TempDir()
+	rb := NewRingBuffer(100)
+	client, err := NewMultiplexer(yamux.DefaultTransport, Yamux, func(ConnInfo) (Sink, error) { return rb, nil })
+	require.NoError(t, err)
+	server, err := NewMultiplexer(yamux.DefaultTransport, Yamux, NewFileSink(dir))
+	require.NoError(t, err)
+
+	c1, c2 := net.Pipe()
+	type result struct {
+		conn network.MuxedConn
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		sc, err := server.NewConn(c2, true, nil)
+		done <- result{sc, err}
+	}()
+	cc, err := client.NewConn(c1, false, nil)
+	require.NoError(t, err)
+	res := <-done
+	require.NoError(t, res.err)
+	sc := res.conn
+
+	go func() {
+		s, err := sc.AcceptStream()
+		if err != nil {
+			return
+		}
+		io.Copy(s, s)
+		s.Close()
+	}()
+	s, err := cc.OpenStream(context.Background())
+	require.NoError(t, err)
+	_, err = s.Write([]byte("foobar"))
+	require.NoError(t, err)
+	require.NoError(t, s.CloseWrite())
+	b, err := io.ReadAll(s)
+	require.NoError(t, err)
+	require.Equal(t, "foobar", string(b))
+	require.NoError(t, cc.Close())
+	require.NoError(t, sc.Close())
+
+	var sent, received int
+	for _, r := range rb.Records() {
+		require.Len(t, r.Header, 12)
+		if r.Header[1] != yamuxTypeData {
+			continue
+		}
+		length := int(binary.BigEndian.Uint32(r.Header[8:12]))
+		switch r.Direction {
+		case DirOutbound:
+			sent += length
+		case DirInbound:
+			received += length
+		}
+	}
+	require.Equal(t, 6, sent)
+	require.Equal(t, 6, received)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	f, err := os.Open(filepath.Join(dir, files[0].Name()))
+	require.NoError(t, err)
+	defer f.Close()
+	r, err := NewReader(f)
+	require.NoError(t, err)
+	require.Equal(t, "yamux", r.Format())
+	var n int
+	for {
+		_, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		n++
+	}
+	require.NotZero(t, n)
+}
+
+func TestSampleRate(t *testing.T) {
+	_, err := NewMultiplexer(yamux.DefaultTransport, Yamux, nil, WithSampleRate(2))
+	require.Error(t, err)
+
+	var sampled int
+	m, err := NewMultiplexer(yamux.DefaultTransport, Yamux, func(ConnInfo) (Sink, error) {
+		sampled++
+		return NewRingBuffer(1), nil
+	}, WithSampleRate(0))
+	require.NoError(t, err)
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	mc, err := m.NewConn(c1, false, nil)
+	require.NoError(t, err)
+	defer mc.Close()
+	require.Zero(t, sampled)
+}
@@ -0,0 +1,172 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Version is the version of the capture file format written by Writer.
+const Version = 1
+
+var magic = [4]byte{'L', 'P', 'C', 'P'}
+
+// maxHeaderSize is the maximum size of a recorded frame header.
+const maxHeaderSize = 255
+
+// Direction is the direction of a captured frame.
+type Direction uint8
+
+const (
+	// DirInbound is a frame read from the connection.
+	DirInbound Direction = iota
+	// DirOutbound is a frame written to the connection.
+	DirOutbound
+)
+
+func (d Direction) String() string {
+	switch d {
+	case DirInbound:
+		return "inbound"
+	case DirOutbound:
+		return "outbound"
+	default:
+		return fmt.Sprintf("unknown direction (%d)", d)
+	}
+}
+
+// Record is a captured frame header.
+type Record struct {
+	// Time is the time at which the frame header was read or written.
+	Time time.Time
+	// Direction is the direction of the frame.
+	Direction Direction
+	// Header is the frame header, as sent on the wire. Payloads are never captured.
+	Header []byte
+}
+
+// Writer writes records in the capture file format to an io.Writer. It is safe for concurrent use.
+type Writer struct {
+	mx     sync.Mutex
+	w      *bufio.Writer
+	closer io.Closer
+	buf    [8 + 1 + 1 + maxHeaderSize]byte
+}
+
+var _ Sink = &Writer{}
+
+// NewWriter writes the file header for the given frame format to w, and returns a Writer
+// that appends records to it. If w is an io.Closer, it is closed when the Writer is closed.
+func NewWriter(w io.Writer, format string) (*Writer, error) {
+	if len(format) > maxHeaderSize {
+		return nil, errors.New("format name too long")
+	}
+	cw := &Writer{w: bufio.NewWriter(w)}
+	if c, ok := w.(io.Closer); ok {
+		cw.closer = c
+	}
+	hdr := make([]byte, 0, len(magic)+1+binary.MaxVarintLen64+len(format))
+	hdr = append(hdr, magic[:]...)
+	hdr = append(hdr, Version)
+	hdr = binary.AppendUvarint(hdr, uint64(len(format)))
+	hdr = append(hdr, format...)
+	if _, err := cw.w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// WriteRecord appends a record. Records are buffered, and only guaranteed to be written
+// to the underlying writer when Flush or Close is called.
+func (w *Writer) WriteRecord(r Record) error {
+	if len(r.Header) > maxHeaderSize {
+		return errors.New("frame header too long")
+	}
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	binary.BigEndian.PutUint64(w.buf[:8], uint64(r.Time.UnixNano()))
+	w.buf[8] = byte(r.Direction)
+	w.buf[9] = byte(len(r.Header))
+	n := copy(w.buf[10:], r.Header)
+	_, err := w.w.Write(w.buf[:10+n])
+	return err
+}
+
+// Flush writes buffered records to the underlying writer.
+func (w *Writer) Flush() error {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	return w.w.Flush()
+}
+
+// Close flushes buffered records, and closes the underlying writer if it is an io.Closer.
+func (w *Writer) Close() error {
+	err := w.Flush()
+	if w.closer != nil {
+		if cerr := w.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Reader reads records in the capture file format.
+type Reader struct {
+	r      *bufio.Reader
+	format string
+}
+
+// NewReader reads the file header from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	var hdr [len(magic) + 1]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return nil, fmt.Errorf("failed to read file header: %w", err)
+	}
+	if !bytes.Equal(hdr[:len(magic)], magic[:]) {
+		return nil, errors.New("not a capture file")
+	}
+	if v := hdr[len(magic)]; v != Version {
+		return nil, fmt.Errorf("unsupported capture file version: %d", v)
+	}
+	l, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read format: %w", err)
+	}
+	if l > maxHeaderSize {
+		return nil, errors.New("format name too long")
+	}
+	format := make([]byte, l)
+	if _, err := io.ReadFull(br, format); err != nil {
+		return nil, fmt.Errorf("failed to read format: %w", err)
+	}
+	return &Reader{r: br, format: string(format)}, nil
+}
+
+// Format returns the name of the frame format of the captured connection.
+func (r *Reader) Format() string { return r.format }
+
+// Next reads the next record. It returns io.EOF when there are no more records.
+func (r *Reader) Next() (Record, error) {
+	var hdr [10]byte
+	if _, err := io.ReadFull(r.r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return Record{}, fmt.Errorf("truncated record: %w", err)
+		}
+		return Record{}, err
+	}
+	rec := Record{
+		Time:      time.Unix(0, int64(binary.BigEndian.Uint64(hdr[:8]))),
+		Direction: Direction(hdr[8]),
+		Header:    make([]byte, hdr[9]),
+	}
+	if _, err := io.ReadFull(r.r, rec.Header); err != nil {
+		return Record{}, fmt.Errorf("truncated record: %w", err)
+	}
+	return rec, nil
+}
@@ -0,0 +1,134 @@
+package capture
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// FrameFormat describes the framing used by a stream muxer.
+type FrameFormat struct {
+	// Name identifies the format in capture files.
+	Name string
+	// MaxHeaderSize is the maximum size of a frame header. It must not exceed 255 bytes.
+	MaxHeaderSize int
+	// ParseHeader parses the frame header at the beginning of b. It returns the size of the
+	// header and the size of the payload following it. If b doesn't contain the complete
+	// header yet, it returns a header size of 0.
+	ParseHeader func(b []byte) (headerSize, payloadSize int, err error)
+}
+
+const yamuxTypeData = 0
+
+// Yamux is the frame format of yamux. Headers are 12 bytes long: version (1 byte), type
+// (1 byte), flags (2 bytes), stream ID (4 bytes) and length (4 bytes). Only data frames
+// carry a payload. For other frame types, the length field carries a value instead.
+var Yamux = &FrameFormat{
+	Name:          "yamux",
+	MaxHeaderSize: 12,
+	ParseHeader: func(b []byte) (int, int, error) {
+		if len(b) < 12 {
+			return 0, 0, nil
+		}
+		if b[1] != yamuxTypeData {
+			return 12, 0, nil
+		}
+		return 12, int(binary.BigEndian.Uint32(b[8:12])), nil
+	},
+}
+
+// Mplex is the frame format of mplex. Headers consist of two varints: the stream ID and
+// flag, and the length of the payload.
+var Mplex = &FrameFormat{
+	Name:          "mplex",
+	MaxHeaderSize: 2 * binary.MaxVarintLen64,
+	ParseHeader: func(b []byte) (int, int, error) {
+		_, n := binary.Uvarint(b)
+		if n < 0 {
+			return 0, 0, errors.New("invalid mplex header")
+		}
+		if n == 0 {
+			return 0, 0, nil
+		}
+		length, m := binary.Uvarint(b[n:])
+		if m < 0 || length > 1<<31 {
+			return 0, 0, errors.New("invalid mplex length")
+		}
+		if m == 0 {
+			return 0, 0, nil
+		}
+		return n + m, int(length), nil
+	},
+}
+
+// framer splits one direction of a connection into frames, and records their headers.
+// It is not safe for concurrent use.
+type framer struct {
+	format *FrameFormat
+	dir    Direction
+	sink   Sink
+
+	// buf holds a partially received header
+	buf []byte
+	// skip is the number of payload bytes remaining in the current frame
+	skip int
+	// failed is set when the stream can't be parsed, or the sink failed. We stop capturing then.
+	failed bool
+}
+
+func newFramer(format *FrameFormat, dir Direction, sink Sink) *framer {
+	return &framer{
+		format: format,
+		dir:    dir,
+		sink:   sink,
+		buf:    make([]byte, 0, format.MaxHeaderSize),
+	}
+}
+
+// feed processes bytes read from or written to the connection.
+func (f *framer) feed(b []byte, now time.Time) {
+	for len(b) > 0 && !f.failed {
+		if f.skip > 0 {
+			n := f.skip
+			if n > len(b) {
+				n = len(b)
+			}
+			f.skip -= n
+			b = b[n:]
+			continue
+		}
+
+		buffered := len(f.buf)
+		n := f.format.MaxHeaderSize - buffered
+		if n > len(b) {
+			n = len(b)
+		}
+		f.buf = append(f.buf, b[:n]...)
+		hdrSize, payloadSize, err := f.format.ParseHeader(f.buf)
+		if err != nil {
+			f.fail(err)
+			return
+		}
+		if hdrSize == 0 {
+			if len(f.buf) == f.format.MaxHeaderSize {
+				f.fail(errors.New("frame header too long"))
+				return
+			}
+			// wait for the rest of the header
+			b = b[n:]
+			continue
+		}
+		if err := f.sink.WriteRecord(Record{Time: now, Direction: f.dir, Header: f.buf[:hdrSize]}); err != nil {
+			f.fail(err)
+			return
+		}
+		b = b[hdrSize-buffered:]
+		f.buf = f.buf[:0]
+		f.skip = payloadSize
+	}
+}
+
+func (f *framer) fail(err error) {
+	log.Debugw("stopping frame capture", "direction", f.dir, "error", err)
+	f.failed = true
+}
@@ -0,0 +1,102 @@
+package capture
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Sink receives the frame headers of a captured connection.
+// Implementations must be safe for concurrent use, since frames are captured in both directions.
+type Sink interface {
+	// WriteRecord records a frame header. The header is only valid until WriteRecord returns.
+	// If WriteRecord returns an error, capturing stops for the direction of the frame.
+	WriteRecord(Record) error
+	// Close is called when the connection is closed.
+	Close() error
+}
+
+// RingBuffer is a Sink that keeps the most recent records in memory.
+type RingBuffer struct {
+	mx      sync.Mutex
+	records []Record
+	next    int
+	full    bool
+}
+
+var _ Sink = &RingBuffer{}
+
+// NewRingBuffer creates a RingBuffer holding up to size records.
+func NewRingBuffer(size int) *RingBuffer {
+	return &RingBuffer{records: make([]Record, size)}
+}
+
+func (b *RingBuffer) WriteRecord(r Record) error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	if len(b.records) == 0 {
+		return nil
+	}
+	rec := &b.records[b.next]
+	rec.Time = r.Time
+	rec.Direction = r.Direction
+	rec.Header = append(rec.Header[:0], r.Header...)
+	b.next++
+	if b.next == len(b.records) {
+		b.next = 0
+		b.full = true
+	}
+	return nil
+}
+
+// Records returns a copy of the buffered records, from oldest to newest.
+func (b *RingBuffer) Records() []Record {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	var records []Record
+	if b.full {
+		records = append(records, b.records[b.next:]...)
+	}
+	records = append(records, b.records[:b.next]...)
+	for i, r := range records {
+		records[i].Header = append([]byte(nil), r.Header...)
+	}
+	return records
+}
+
+// WriteTo writes the buffered records to w.
+func (b *RingBuffer) WriteTo(w *Writer) error {
+	for _, r := range b.Records() {
+		if err := w.WriteRecord(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *RingBuffer) Close() error { return nil }
+
+// NewFileSink returns a function creating one capture file per connection in dir,
+// for use with NewMultiplexer. Files are named after the remote peer and the time the
+// connection was established.
+func NewFileSink(dir string) func(ConnInfo) (Sink, error) {
+	return func(info ConnInfo) (Sink, error) {
+		p := "unknown"
+		if info.Peer != "" {
+			p = info.Peer.String()
+		}
+		name := fmt.Sprintf("%s-%d.lpcap", p, time.Now().UnixNano())
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		w, err := NewWriter(f, info.Format)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return w, nil
+	}
+}
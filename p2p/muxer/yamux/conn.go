@@ -41,9 +41,31 @@ func (c *conn) OpenStream(ctx context.Context) (network.MuxedStream, error) {
 // AcceptStream accepts a stream opened by the other side.
 func (c *conn) AcceptStream() (network.MuxedStream, error) {
 	s, err := c.yamux().AcceptStream()
+	if err != nil && isProtocolViolation(err) {
+		return nil, protocolViolationError{err}
+	}
 	return (*stream)(s), err
 }
 
+func isProtocolViolation(err error) bool {
+	switch err {
+	case yamux.ErrInvalidVersion, yamux.ErrInvalidMsgType, yamux.ErrUnexpectedFlag, yamux.ErrDuplicateStream, yamux.ErrRecvWindowExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+// protocolViolationError wraps a yamux error caused by the remote peer violating the protocol.
+// It matches network.ErrMuxerProtocolViolation.
+type protocolViolationError struct{ err error }
+
+func (e protocolViolationError) Error() string { return e.err.Error() }
+func (e protocolViolationError) Unwrap() error { return e.err }
+func (e protocolViolationError) Is(target error) bool {
+	return target == network.ErrMuxerProtocolViolation
+}
+
 func (c *conn) yamux() *yamux.Session {
 	return (*yamux.Session)(c)
 }
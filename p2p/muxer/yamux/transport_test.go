@@ -1,9 +1,13 @@
 package yamux
 
 import (
+	"net"
 	"testing"
 
+	"github.com/libp2p/go-libp2p/core/network"
 	tmux "github.com/libp2p/go-libp2p/p2p/muxer/testsuite"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestDefaultTransport(t *testing.T) {
@@ -13,3 +17,17 @@ func TestDefaultTransport(t *testing.T) {
 
 	tmux.SubtestAll(t, DefaultTransport)
 }
+
+func TestProtocolViolation(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	c, err := DefaultTransport.NewConn(server, true, nil)
+	require.NoError(t, err)
+	defer c.Close()
+
+	// a frame header with an invalid version
+	go client.Write([]byte{42, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0})
+	_, err = c.AcceptStream()
+	require.ErrorIs(t, err, network.ErrMuxerProtocolViolation)
+}
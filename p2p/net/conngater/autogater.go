@@ -0,0 +1,358 @@
+package conngater
+
+import (
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/benbjohnson/clock"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+const (
+	defaultErrorBudget   = 10
+	defaultHalfLife      = 10 * time.Minute
+	defaultBlockDuration = time.Hour
+)
+
+var defaultOffenseCosts = map[connmgr.Offense]float64{
+	connmgr.OffenseHandshakeFailure:  1,
+	connmgr.OffenseProtocolViolation: 5,
+	connmgr.OffenseResourceLimit:     0.5,
+}
+
+type AutoGaterOption func(*AutoGater) error
+
+// WithErrorBudget sets the error budget. A peer (or IP address) is blocked once the cost of the offenses it
+// committed reaches the budget. Defaults to 10.
+func WithErrorBudget(budget float64) AutoGaterOption {
+	return func(g *AutoGater) error {
+		if budget <= 0 {
+			return errors.New("conngater: error budget must be positive")
+		}
+		g.budget = budget
+		return nil
+	}
+}
+
+// WithOffenseCost sets the cost of an offense. A cost of 0 disables tracking the offense.
+// By default, handshake failures cost 1, protocol violations 5, and resource limit violations 0.5.
+func WithOffenseCost(o connmgr.Offense, cost float64) AutoGaterOption {
+	return func(g *AutoGater) error {
+		if _, ok := g.costs[o]; !ok {
+			return errors.New("conngater: unknown offense")
+		}
+		if cost < 0 {
+			return errors.New("conngater: offense cost must not be negative")
+		}
+		g.costs[o] = cost
+		return nil
+	}
+}
+
+// WithHalfLife sets the half-life of the cost of offenses. Defaults to 10 minutes.
+func WithHalfLife(d time.Duration) AutoGaterOption {
+	return func(g *AutoGater) error {
+		if d <= 0 {
+			return errors.New("conngater: half-life must be positive")
+		}
+		g.halfLife = d
+		return nil
+	}
+}
+
+// WithBlockDuration sets how long peers (and IP addresses) are blocked once they exceed their error budget.
+// Defaults to 1 hour.
+func WithBlockDuration(d time.Duration) AutoGaterOption {
+	return func(g *AutoGater) error {
+		if d <= 0 {
+			return errors.New("conngater: block duration must be positive")
+		}
+		g.blockDuration = d
+		return nil
+	}
+}
+
+// WithClock sets the clock used by the AutoGater. Used for testing.
+func WithClock(c clock.Clock) AutoGaterOption {
+	return func(g *AutoGater) error {
+		g.clock = c
+		return nil
+	}
+}
+
+// AutoBlocked is a peer or an IP address blocked by the AutoGater.
+type AutoBlocked struct {
+	// Peer is the blocked peer. It is empty if an IP address is blocked.
+	Peer peer.ID
+	// IP is the blocked IP address. It is nil if a peer is blocked.
+	IP net.IP
+	// Until is the time the block expires.
+	Until time.Time
+}
+
+// offenseRecord tracks the (decaying) cost of the offenses of a peer or an IP address.
+type offenseRecord struct {
+	score        float64
+	updated      time.Time
+	blockedUntil time.Time
+}
+
+// AutoGater is a connection gater that automatically blocks peers that repeatedly misbehave.
+//
+// Every offense has a cost, which is charged against the error budget of the offending peer.
+// For offenses committed before the peer is authenticated, the budget of the remote IP address is charged instead.
+// The cost of offenses decays exponentially over time. A peer exceeding its budget is blocked for a while,
+// after which it starts over with a full budget.
+//
+// To be notified of offenses, the AutoGater needs to be used as the connection gater of the host.
+// It wraps another (optional) connection gater, which is consulted for all connections the AutoGater allows.
+type AutoGater struct {
+	next connmgr.ConnectionGater
+
+	budget        float64
+	costs         map[connmgr.Offense]float64
+	halfLife      time.Duration
+	blockDuration time.Duration
+	clock         clock.Clock
+
+	mx     sync.Mutex
+	peers  map[peer.ID]*offenseRecord
+	addrs  map[string]*offenseRecord // keyed by the IP address
+	lastGC time.Time
+}
+
+var (
+	_ connmgr.ConnectionGater = &AutoGater{}
+	_ connmgr.OffenseRecorder = &AutoGater{}
+)
+
+// NewAutoGater creates a new AutoGater. next may be nil.
+func NewAutoGater(next connmgr.ConnectionGater, opts ...AutoGaterOption) (*AutoGater, error) {
+	g := &AutoGater{
+		next:          next,
+		budget:        defaultErrorBudget,
+		costs:         make(map[connmgr.Offense]float64, len(defaultOffenseCosts)),
+		halfLife:      defaultHalfLife,
+		blockDuration: defaultBlockDuration,
+		clock:         clock.New(),
+		peers:         make(map[peer.ID]*offenseRecord),
+		addrs:         make(map[string]*offenseRecord),
+	}
+	for o, c := range defaultOffenseCosts {
+		g.costs[o] = c
+	}
+	for _, opt := range opts {
+		if err := opt(g); err != nil {
+			return nil, err
+		}
+	}
+	g.lastGC = g.clock.Now()
+	return g, nil
+}
+
+// RecordOffense charges the cost of an offense against the error budget of peer p.
+// If p is empty, the IP address of addr is charged instead. Relayed addresses are ignored,
+// since they'd charge the relay.
+func (g *AutoGater) RecordOffense(p peer.ID, addr ma.Multiaddr, o connmgr.Offense) {
+	cost := g.costs[o]
+	if cost == 0 {
+		return
+	}
+
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	now := g.clock.Now()
+	g.gc(now)
+	if p != "" {
+		rec, ok := g.peers[p]
+		if !ok {
+			rec = &offenseRecord{updated: now}
+			g.peers[p] = rec
+		}
+		if g.charge(rec, cost, now) {
+			log.Infow("blocking peer that exceeded its error budget", "peer", p, "offense", o, "until", rec.blockedUntil)
+		}
+		return
+	}
+	ip := remoteIP(addr)
+	if ip == nil {
+		return
+	}
+	key := ip.String()
+	rec, ok := g.addrs[key]
+	if !ok {
+		rec = &offenseRecord{updated: now}
+		g.addrs[key] = rec
+	}
+	if g.charge(rec, cost, now) {
+		log.Infow("blocking IP address that exceeded its error budget", "ip", key, "offense", o, "until", rec.blockedUntil)
+	}
+}
+
+// charge charges cost against the budget of rec. It returns true if this results in rec being blocked.
+func (g *AutoGater) charge(rec *offenseRecord, cost float64, now time.Time) bool {
+	if now.Before(rec.blockedUntil) {
+		return false
+	}
+	g.decay(rec, now)
+	rec.score += cost
+	if rec.score < g.budget {
+		return false
+	}
+	rec.score = 0
+	rec.blockedUntil = now.Add(g.blockDuration)
+	return true
+}
+
+func (g *AutoGater) decay(rec *offenseRecord, now time.Time) {
+	if elapsed := now.Sub(rec.updated); elapsed > 0 {
+		rec.score *= math.Pow(0.5, float64(elapsed)/float64(g.halfLife))
+		rec.updated = now
+	}
+}
+
+// gc removes records that are neither blocked nor have a significant score.
+// It runs at most once per half-life.
+func (g *AutoGater) gc(now time.Time) {
+	if now.Sub(g.lastGC) < g.halfLife {
+		return
+	}
+	g.lastGC = now
+	isStale := func(rec *offenseRecord) bool {
+		if now.Before(rec.blockedUntil) {
+			return false
+		}
+		g.decay(rec, now)
+		return rec.score < 0.01
+	}
+	for p, rec := range g.peers {
+		if isStale(rec) {
+			delete(g.peers, p)
+		}
+	}
+	for ip, rec := range g.addrs {
+		if isStale(rec) {
+			delete(g.addrs, ip)
+		}
+	}
+}
+
+func (g *AutoGater) isPeerBlocked(p peer.ID) bool {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	rec, ok := g.peers[p]
+	return ok && g.clock.Now().Before(rec.blockedUntil)
+}
+
+func (g *AutoGater) isAddrBlocked(addr ma.Multiaddr) bool {
+	ip := remoteIP(addr)
+	if ip == nil {
+		return false
+	}
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	rec, ok := g.addrs[ip.String()]
+	return ok && g.clock.Now().Before(rec.blockedUntil)
+}
+
+// ListBlocked returns the peers and IP addresses that are currently blocked.
+func (g *AutoGater) ListBlocked() []AutoBlocked {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	now := g.clock.Now()
+	var blocked []AutoBlocked
+	for p, rec := range g.peers {
+		if now.Before(rec.blockedUntil) {
+			blocked = append(blocked, AutoBlocked{Peer: p, Until: rec.blockedUntil})
+		}
+	}
+	for ip, rec := range g.addrs {
+		if now.Before(rec.blockedUntil) {
+			blocked = append(blocked, AutoBlocked{IP: net.ParseIP(ip), Until: rec.blockedUntil})
+		}
+	}
+	return blocked
+}
+
+// UnblockPeer unblocks a peer, and resets its error budget.
+func (g *AutoGater) UnblockPeer(p peer.ID) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	delete(g.peers, p)
+}
+
+// UnblockAddr unblocks an IP address, and resets its error budget.
+func (g *AutoGater) UnblockAddr(ip net.IP) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	delete(g.addrs, ip.String())
+}
+
+// Clear unblocks all peers and IP addresses, and resets all error budgets.
+func (g *AutoGater) Clear() {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	g.peers = make(map[peer.ID]*offenseRecord)
+	g.addrs = make(map[string]*offenseRecord)
+}
+
+func (g *AutoGater) InterceptPeerDial(p peer.ID) (allow bool) {
+	if g.isPeerBlocked(p) {
+		return false
+	}
+	return g.next == nil || g.next.InterceptPeerDial(p)
+}
+
+func (g *AutoGater) InterceptAddrDial(p peer.ID, a ma.Multiaddr) (allow bool) {
+	if g.isAddrBlocked(a) {
+		return false
+	}
+	return g.next == nil || g.next.InterceptAddrDial(p, a)
+}
+
+func (g *AutoGater) InterceptAccept(cma network.ConnMultiaddrs) (allow bool) {
+	if g.isAddrBlocked(cma.RemoteMultiaddr()) {
+		return false
+	}
+	return g.next == nil || g.next.InterceptAccept(cma)
+}
+
+func (g *AutoGater) InterceptSecured(dir network.Direction, p peer.ID, cma network.ConnMultiaddrs) (allow bool) {
+	if g.isPeerBlocked(p) {
+		return false
+	}
+	return g.next == nil || g.next.InterceptSecured(dir, p, cma)
+}
+
+func (g *AutoGater) InterceptUpgraded(c network.Conn) (allow bool, reason control.DisconnectReason) {
+	if g.next == nil {
+		return true, 0
+	}
+	return g.next.InterceptUpgraded(c)
+}
+
+// remoteIP returns the IP address of addr. It returns nil for relayed addresses.
+func remoteIP(addr ma.Multiaddr) net.IP {
+	if addr == nil {
+		return nil
+	}
+	if _, err := addr.ValueForProtocol(ma.P_CIRCUIT); err == nil {
+		return nil
+	}
+	ip, err := manet.ToIP(addr)
+	if err != nil {
+		return nil
+	}
+	return ip
+}
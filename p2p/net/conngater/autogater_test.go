@@ -0,0 +1,140 @@
+package conngater
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/benbjohnson/clock"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoGaterOptions(t *testing.T) {
+	for _, opt := range []AutoGaterOption{
+		WithErrorBudget(0),
+		WithOffenseCost(connmgr.Offense(42), 1),
+		WithOffenseCost(connmgr.OffenseHandshakeFailure, -1),
+		WithHalfLife(0),
+		WithBlockDuration(0),
+	} {
+		_, err := NewAutoGater(nil, opt)
+		require.Error(t, err)
+	}
+}
+
+func TestAutoGaterBlocksPeer(t *testing.T) {
+	cl := clock.NewMock()
+	g, err := NewAutoGater(nil, WithClock(cl), WithErrorBudget(10), WithHalfLife(time.Hour), WithBlockDuration(time.Hour))
+	require.NoError(t, err)
+
+	p := peer.ID("peer")
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	cma := &mockConnMultiaddrs{local: ma.StringCast("/ip4/127.0.0.1/tcp/4001"), remote: addr}
+
+	g.RecordOffense(p, addr, connmgr.OffenseProtocolViolation)
+	require.True(t, g.InterceptPeerDial(p))
+	g.RecordOffense(p, addr, connmgr.OffenseProtocolViolation)
+	require.False(t, g.InterceptPeerDial(p))
+	require.False(t, g.InterceptSecured(0, p, cma))
+	// Offenses of authenticated peers are not charged against the IP address.
+	require.True(t, g.InterceptAccept(cma))
+	require.True(t, g.InterceptAddrDial(p, addr))
+	require.Equal(t, []AutoBlocked{{Peer: p, Until: cl.Now().Add(time.Hour)}}, g.ListBlocked())
+
+	// the block expires
+	cl.Add(time.Hour)
+	require.True(t, g.InterceptPeerDial(p))
+	require.Empty(t, g.ListBlocked())
+
+	// and the peer starts over with a full budget
+	g.RecordOffense(p, addr, connmgr.OffenseProtocolViolation)
+	require.True(t, g.InterceptPeerDial(p))
+	g.RecordOffense(p, addr, connmgr.OffenseProtocolViolation)
+	require.False(t, g.InterceptPeerDial(p))
+	g.UnblockPeer(p)
+	require.True(t, g.InterceptPeerDial(p))
+}
+
+func TestAutoGaterBlocksIP(t *testing.T) {
+	cl := clock.NewMock()
+	g, err := NewAutoGater(nil, WithClock(cl), WithErrorBudget(3))
+	require.NoError(t, err)
+
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	cma := &mockConnMultiaddrs{local: ma.StringCast("/ip4/127.0.0.1/tcp/4001"), remote: addr}
+	for i := 0; i < 3; i++ {
+		require.True(t, g.InterceptAccept(cma))
+		g.RecordOffense("", addr, connmgr.OffenseHandshakeFailure)
+	}
+	require.False(t, g.InterceptAccept(cma))
+	// other ports of the same IP are blocked as well
+	require.False(t, g.InterceptAddrDial("peer", ma.StringCast("/ip4/1.2.3.4/udp/1234/quic-v1")))
+	require.True(t, g.InterceptAddrDial("peer", ma.StringCast("/ip4/1.2.3.5/tcp/1234")))
+	blocked := g.ListBlocked()
+	require.Len(t, blocked, 1)
+	require.True(t, blocked[0].IP.Equal(net.ParseIP("1.2.3.4")))
+
+	g.UnblockAddr(net.ParseIP("1.2.3.4"))
+	require.True(t, g.InterceptAccept(cma))
+
+	// relayed addresses would charge the relay
+	relayed := ma.StringCast("/ip4/1.2.3.4/tcp/1234/p2p/QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupGN9/p2p-circuit")
+	for i := 0; i < 3; i++ {
+		g.RecordOffense("", relayed, connmgr.OffenseHandshakeFailure)
+	}
+	require.True(t, g.InterceptAccept(cma))
+}
+
+func TestAutoGaterDecay(t *testing.T) {
+	cl := clock.NewMock()
+	g, err := NewAutoGater(nil,
+		WithClock(cl),
+		WithErrorBudget(2),
+		WithHalfLife(time.Minute),
+		WithOffenseCost(connmgr.OffenseResourceLimit, 1),
+	)
+	require.NoError(t, err)
+
+	p := peer.ID("peer")
+	g.RecordOffense(p, nil, connmgr.OffenseResourceLimit)
+	// After two half-lives, only a quarter of the cost remains.
+	cl.Add(2 * time.Minute)
+	g.RecordOffense(p, nil, connmgr.OffenseResourceLimit)
+	require.True(t, g.InterceptPeerDial(p))
+	g.RecordOffense(p, nil, connmgr.OffenseResourceLimit)
+	require.False(t, g.InterceptPeerDial(p))
+
+	g.Clear()
+	require.True(t, g.InterceptPeerDial(p))
+	require.Empty(t, g.ListBlocked())
+
+	// stale records are garbage collected
+	g.RecordOffense(p, nil, connmgr.OffenseResourceLimit)
+	cl.Add(time.Hour)
+	g.RecordOffense("other", nil, connmgr.OffenseResourceLimit)
+	g.mx.Lock()
+	require.NotContains(t, g.peers, p)
+	g.mx.Unlock()
+}
+
+func TestAutoGaterDelegates(t *testing.T) {
+	next, err := NewBasicConnectionGater(nil)
+	require.NoError(t, err)
+	g, err := NewAutoGater(next)
+	require.NoError(t, err)
+
+	p := peer.ID("peer")
+	require.True(t, g.InterceptPeerDial(p))
+	require.NoError(t, next.BlockPeer(p))
+	require.False(t, g.InterceptPeerDial(p))
+
+	// a cost of 0 disables tracking the offense
+	g, err = NewAutoGater(nil, WithOffenseCost(connmgr.OffenseProtocolViolation, 0), WithErrorBudget(1))
+	require.NoError(t, err)
+	g.RecordOffense(p, nil, connmgr.OffenseProtocolViolation)
+	require.True(t, g.InterceptPeerDial(p))
+}
@@ -0,0 +1,324 @@
+package conngater
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/connmgr"
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// GeoIPRecord is the location of an IP address.
+type GeoIPRecord struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country, e.g. "DE". It is empty if the country is unknown.
+	Country string
+	// ASN is the number of the autonomous system. It is 0 if the autonomous system is unknown.
+	ASN uint32
+}
+
+// GeoIPDatabase looks up the location of IP addresses.
+type GeoIPDatabase interface {
+	// Lookup returns the location of ip. It returns an empty record if ip is not in the database.
+	Lookup(ip net.IP) (GeoIPRecord, error)
+}
+
+const defaultGeoIPReloadInterval = time.Minute
+
+type GeoGaterOption func(*GeoGater) error
+
+// WithGeoIPDatabase adds a geo-IP database. If multiple databases are configured, the country and the ASN
+// are taken from the first database that knows them, e.g. to combine a country and an ASN database.
+func WithGeoIPDatabase(db GeoIPDatabase) GeoGaterOption {
+	return func(g *GeoGater) error {
+		g.dbs = append(g.dbs, db)
+		return nil
+	}
+}
+
+// WithMaxMindDBFile adds a geo-IP database in the MaxMind DB format, read from a file.
+// The file is reloaded when it changes, so it should be replaced atomically (e.g. by renaming a new file).
+// If reloading fails, the previous version of the database is used.
+func WithMaxMindDBFile(path string) GeoGaterOption {
+	return func(g *GeoGater) error {
+		f := &maxMindDBFile{path: path}
+		if err := f.load(); err != nil {
+			return err
+		}
+		g.dbs = append(g.dbs, f)
+		g.files = append(g.files, f)
+		return nil
+	}
+}
+
+// WithReloadInterval sets how often database files are checked for changes. Defaults to 1 minute.
+func WithReloadInterval(d time.Duration) GeoGaterOption {
+	return func(g *GeoGater) error {
+		if d <= 0 {
+			return errors.New("conngater: reload interval must be positive")
+		}
+		g.reloadInterval = d
+		return nil
+	}
+}
+
+// WithAllowedCountries only allows connections to and from the given countries (ISO 3166-1 alpha-2 codes).
+func WithAllowedCountries(countries ...string) GeoGaterOption {
+	return func(g *GeoGater) error {
+		return addCountries(g.allowedCountries, countries)
+	}
+}
+
+// WithDeniedCountries denies connections to and from the given countries (ISO 3166-1 alpha-2 codes).
+func WithDeniedCountries(countries ...string) GeoGaterOption {
+	return func(g *GeoGater) error {
+		return addCountries(g.deniedCountries, countries)
+	}
+}
+
+// WithAllowedASNs only allows connections to and from the given autonomous systems.
+func WithAllowedASNs(asns ...uint32) GeoGaterOption {
+	return func(g *GeoGater) error {
+		return addASNs(g.allowedASNs, asns)
+	}
+}
+
+// WithDeniedASNs denies connections to and from the given autonomous systems.
+func WithDeniedASNs(asns ...uint32) GeoGaterOption {
+	return func(g *GeoGater) error {
+		return addASNs(g.deniedASNs, asns)
+	}
+}
+
+func addCountries(m map[string]struct{}, countries []string) error {
+	for _, c := range countries {
+		if len(c) != 2 {
+			return errors.New("conngater: invalid country code: " + c)
+		}
+		m[strings.ToUpper(c)] = struct{}{}
+	}
+	return nil
+}
+
+func addASNs(m map[uint32]struct{}, asns []uint32) error {
+	for _, asn := range asns {
+		if asn == 0 {
+			return errors.New("conngater: invalid ASN")
+		}
+		m[asn] = struct{}{}
+	}
+	return nil
+}
+
+// GeoGater is a connection gater that allows or denies connections based on the location of the remote
+// IP address: its country and its autonomous system, as looked up in a geo-IP database.
+//
+// Connections are denied if the country or the autonomous system is denied. If any allowed countries
+// (autonomous systems) are configured, connections are also denied unless the country (autonomous system)
+// is allowed, including connections to addresses with an unknown location.
+// Connections to and from non-public addresses and relayed connections are always allowed.
+//
+// The GeoGater gates dials (InterceptAddrDial) and inbound connections (InterceptAccept).
+// It wraps another (optional) connection gater, which is consulted for all connections the GeoGater allows.
+type GeoGater struct {
+	next connmgr.ConnectionGater
+
+	dbs   []GeoIPDatabase
+	files []*maxMindDBFile
+
+	allowedCountries map[string]struct{}
+	deniedCountries  map[string]struct{}
+	allowedASNs      map[uint32]struct{}
+	deniedASNs       map[uint32]struct{}
+
+	reloadInterval time.Duration
+	ctx            context.Context
+	ctxCancel      context.CancelFunc
+	refCount       sync.WaitGroup
+}
+
+var _ connmgr.ConnectionGater = &GeoGater{}
+
+// NewGeoGater creates a new GeoGater. next may be nil.
+// At least one geo-IP database and one rule need to be configured.
+func NewGeoGater(next connmgr.ConnectionGater, opts ...GeoGaterOption) (*GeoGater, error) {
+	g := &GeoGater{
+		next:             next,
+		allowedCountries: make(map[string]struct{}),
+		deniedCountries:  make(map[string]struct{}),
+		allowedASNs:      make(map[uint32]struct{}),
+		deniedASNs:       make(map[uint32]struct{}),
+		reloadInterval:   defaultGeoIPReloadInterval,
+	}
+	for _, opt := range opts {
+		if err := opt(g); err != nil {
+			return nil, err
+		}
+	}
+	if len(g.dbs) == 0 {
+		return nil, errors.New("conngater: no geo-IP database configured")
+	}
+	if len(g.allowedCountries)+len(g.deniedCountries)+len(g.allowedASNs)+len(g.deniedASNs) == 0 {
+		return nil, errors.New("conngater: no geo-IP rules configured")
+	}
+
+	g.ctx, g.ctxCancel = context.WithCancel(context.Background())
+	if len(g.files) > 0 {
+		g.refCount.Add(1)
+		go g.reloadLoop()
+	}
+	return g, nil
+}
+
+// Close stops reloading the database files.
+func (g *GeoGater) Close() error {
+	g.ctxCancel()
+	g.refCount.Wait()
+	return nil
+}
+
+func (g *GeoGater) reloadLoop() {
+	defer g.refCount.Done()
+
+	ticker := time.NewTicker(g.reloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, f := range g.files {
+				if err := f.load(); err != nil {
+					log.Warnw("failed to reload geo-IP database", "path", f.path, "error", err)
+				}
+			}
+		case <-g.ctx.Done():
+			return
+		}
+	}
+}
+
+func (g *GeoGater) lookup(ip net.IP) GeoIPRecord {
+	var rec GeoIPRecord
+	for _, db := range g.dbs {
+		r, err := db.Lookup(ip)
+		if err != nil {
+			log.Debugw("geo-IP lookup failed", "ip", ip, "error", err)
+			continue
+		}
+		if rec.Country == "" {
+			rec.Country = strings.ToUpper(r.Country)
+		}
+		if rec.ASN == 0 {
+			rec.ASN = r.ASN
+		}
+		if rec.Country != "" && rec.ASN != 0 {
+			break
+		}
+	}
+	return rec
+}
+
+func (g *GeoGater) isAllowed(addr ma.Multiaddr) bool {
+	ip := remoteIP(addr)
+	if ip == nil || !manet.IsPublicAddr(addr) {
+		return true
+	}
+	rec := g.lookup(ip)
+	if _, ok := g.deniedCountries[rec.Country]; ok {
+		return false
+	}
+	if _, ok := g.deniedASNs[rec.ASN]; ok {
+		return false
+	}
+	if len(g.allowedCountries) > 0 {
+		if _, ok := g.allowedCountries[rec.Country]; !ok {
+			return false
+		}
+	}
+	if len(g.allowedASNs) > 0 {
+		if _, ok := g.allowedASNs[rec.ASN]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *GeoGater) InterceptPeerDial(p peer.ID) (allow bool) {
+	return g.next == nil || g.next.InterceptPeerDial(p)
+}
+
+func (g *GeoGater) InterceptAddrDial(p peer.ID, a ma.Multiaddr) (allow bool) {
+	if !g.isAllowed(a) {
+		return false
+	}
+	return g.next == nil || g.next.InterceptAddrDial(p, a)
+}
+
+func (g *GeoGater) InterceptAccept(cma network.ConnMultiaddrs) (allow bool) {
+	if !g.isAllowed(cma.RemoteMultiaddr()) {
+		return false
+	}
+	return g.next == nil || g.next.InterceptAccept(cma)
+}
+
+func (g *GeoGater) InterceptSecured(dir network.Direction, p peer.ID, cma network.ConnMultiaddrs) (allow bool) {
+	return g.next == nil || g.next.InterceptSecured(dir, p, cma)
+}
+
+func (g *GeoGater) InterceptUpgraded(c network.Conn) (allow bool, reason control.DisconnectReason) {
+	if g.next == nil {
+		return true, 0
+	}
+	return g.next.InterceptUpgraded(c)
+}
+
+// maxMindDBFile is a MaxMind DB read from a file, which is reloaded when the file changes.
+type maxMindDBFile struct {
+	path string
+
+	mx      sync.RWMutex
+	db      *MaxMindDB
+	modTime time.Time
+	size    int64
+}
+
+// load (re)loads the database, if the file changed since it was last loaded.
+func (f *maxMindDBFile) load() error {
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	f.mx.RLock()
+	unchanged := f.db != nil && fi.ModTime().Equal(f.modTime) && fi.Size() == f.size
+	f.mx.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	db, err := OpenMaxMindDB(f.path)
+	if err != nil {
+		return err
+	}
+	f.mx.Lock()
+	f.db = db
+	f.modTime = fi.ModTime()
+	f.size = fi.Size()
+	f.mx.Unlock()
+	log.Debugw("loaded geo-IP database", "path", f.path)
+	return nil
+}
+
+func (f *maxMindDBFile) Lookup(ip net.IP) (GeoIPRecord, error) {
+	f.mx.RLock()
+	db := f.db
+	f.mx.RUnlock()
+	return db.Lookup(ip)
+}
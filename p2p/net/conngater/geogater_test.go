@@ -0,0 +1,262 @@
+package conngater
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+// encodeMMDBValue encodes a value for the data section of a MaxMind DB.
+// It supports the subset of types used by the tests.
+func encodeMMDBValue(b []byte, v any) []byte {
+	ctrl := func(typ byte, size int) []byte {
+		if typ >= 8 {
+			return append(b, byte(size), typ-7)
+		}
+		return append(b, typ<<5|byte(size))
+	}
+	switch v := v.(type) {
+	case string:
+		b = ctrl(mmdbTypeString, len(v))
+		return append(b, v...)
+	case int:
+		b = ctrl(mmdbTypeUint32, 4)
+		return binary.BigEndian.AppendUint32(b, uint32(v))
+	case map[string]any:
+		b = ctrl(mmdbTypeMap, len(v))
+		for k, val := range v {
+			b = encodeMMDBValue(b, k)
+			b = encodeMMDBValue(b, val)
+		}
+		return b
+	default:
+		panic(fmt.Sprintf("unsupported type %T", v))
+	}
+}
+
+type mmdbEntry struct {
+	prefix string
+	data   map[string]any
+}
+
+// writeMMDB creates a MaxMind DB containing the entries.
+func writeMMDB(t *testing.T, ipVersion, recordSize int, entries []mmdbEntry) []byte {
+	t.Helper()
+
+	type rec struct {
+		kind int // 0: empty, 1: node, 2: data
+		v    int
+	}
+	nodes := [][2]rec{{}}
+	var data []byte
+	var dataOffsets []int
+	for i, e := range entries {
+		_, ipnet, err := net.ParseCIDR(e.prefix)
+		require.NoError(t, err)
+		ip := ipnet.IP
+		ones, _ := ipnet.Mask.Size()
+		if ip4 := ip.To4(); ip4 != nil && ipVersion == 6 {
+			ip = append(make(net.IP, 12), ip4...)
+			ones += 96
+		}
+		dataOffsets = append(dataOffsets, len(data))
+		data = encodeMMDBValue(data, e.data)
+
+		node := 0
+		for j := 0; j < ones; j++ {
+			bit := ip[j/8] >> (7 - j%8) & 1
+			if j == ones-1 {
+				nodes[node][bit] = rec{kind: 2, v: i}
+				break
+			}
+			if nodes[node][bit].kind != 1 {
+				nodes = append(nodes, [2]rec{})
+				nodes[node][bit] = rec{kind: 1, v: len(nodes) - 1}
+			}
+			node = nodes[node][bit].v
+		}
+	}
+
+	nodeCount := len(nodes)
+	var b []byte
+	for _, n := range nodes {
+		var vals [2]uint32
+		for i, r := range n {
+			switch r.kind {
+			case 0:
+				vals[i] = uint32(nodeCount)
+			case 1:
+				vals[i] = uint32(r.v)
+			case 2:
+				vals[i] = uint32(nodeCount + mmdbSeparatorSize + dataOffsets[r.v])
+			}
+		}
+		switch recordSize {
+		case 24:
+			b = append(b, byte(vals[0]>>16), byte(vals[0]>>8), byte(vals[0]))
+			b = append(b, byte(vals[1]>>16), byte(vals[1]>>8), byte(vals[1]))
+		case 28:
+			b = append(b, byte(vals[0]>>16), byte(vals[0]>>8), byte(vals[0]))
+			b = append(b, byte(vals[0]>>20)&0xf0|byte(vals[1]>>24)&0x0f)
+			b = append(b, byte(vals[1]>>16), byte(vals[1]>>8), byte(vals[1]))
+		case 32:
+			b = binary.BigEndian.AppendUint32(b, vals[0])
+			b = binary.BigEndian.AppendUint32(b, vals[1])
+		}
+	}
+	b = append(b, make([]byte, mmdbSeparatorSize)...)
+	b = append(b, data...)
+	b = append(b, mmdbMetadataMarker...)
+	return encodeMMDBValue(b, map[string]any{
+		"node_count":                  nodeCount,
+		"record_size":                 recordSize,
+		"ip_version":                  ipVersion,
+		"binary_format_major_version": 2,
+		"database_type":               "test",
+	})
+}
+
+var testMMDBEntries = []mmdbEntry{
+	{"1.2.3.0/24", map[string]any{"country": map[string]any{"iso_code": "DE"}}},
+	{"5.6.0.0/16", map[string]any{"registered_country": map[string]any{"iso_code": "US"}, "autonomous_system_number": 64500}},
+	{"2001:db8::/32", map[string]any{"country": map[string]any{"iso_code": "FR"}}},
+}
+
+func TestMaxMindDB(t *testing.T) {
+	for _, recordSize := range []int{24, 28, 32} {
+		t.Run(fmt.Sprintf("record size %d", recordSize), func(t *testing.T) {
+			db, err := NewMaxMindDB(writeMMDB(t, 6, recordSize, testMMDBEntries))
+			require.NoError(t, err)
+			for ip, expected := range map[string]GeoIPRecord{
+				"1.2.3.4":     {Country: "DE"},
+				"1.2.4.4":     {},
+				"5.6.7.8":     {Country: "US", ASN: 64500},
+				"2001:db8::1": {Country: "FR"},
+				"2001:db9::1": {},
+				"::1:2:3:4":   {},
+			} {
+				rec, err := db.Lookup(net.ParseIP(ip))
+				require.NoError(t, err)
+				require.Equal(t, expected, rec, ip)
+			}
+		})
+	}
+
+	t.Run("IPv4 database", func(t *testing.T) {
+		db, err := NewMaxMindDB(writeMMDB(t, 4, 24, testMMDBEntries[:2]))
+		require.NoError(t, err)
+		rec, err := db.Lookup(net.ParseIP("1.2.3.4"))
+		require.NoError(t, err)
+		require.Equal(t, "DE", rec.Country)
+		rec, err = db.Lookup(net.ParseIP("2001:db8::1"))
+		require.NoError(t, err)
+		require.Equal(t, GeoIPRecord{}, rec)
+	})
+
+	t.Run("invalid databases", func(t *testing.T) {
+		valid := writeMMDB(t, 6, 24, testMMDBEntries)
+		_, err := NewMaxMindDB(valid[:100])
+		require.Error(t, err)
+		_, err = NewMaxMindDB(encodeMMDBValue(append([]byte("foo"), mmdbMetadataMarker...), "bar"))
+		require.Error(t, err)
+		_, err = NewMaxMindDB(encodeMMDBValue(append([]byte("foo"), mmdbMetadataMarker...), map[string]any{
+			"node_count":  1000,
+			"record_size": 24,
+			"ip_version":  6,
+		}))
+		require.Error(t, err)
+	})
+}
+
+type mockGeoIPDatabase map[string]GeoIPRecord
+
+func (db mockGeoIPDatabase) Lookup(ip net.IP) (GeoIPRecord, error) {
+	return db[ip.String()], nil
+}
+
+func TestGeoGaterRules(t *testing.T) {
+	db := mockGeoIPDatabase{
+		"1.1.1.1": {Country: "DE", ASN: 1},
+		"2.2.2.2": {Country: "US", ASN: 2},
+		"3.3.3.3": {Country: "US", ASN: 3},
+	}
+	addr := func(ip string) ma.Multiaddr { return ma.StringCast("/ip4/" + ip + "/tcp/1234") }
+
+	for _, tc := range []struct {
+		name    string
+		opts    []GeoGaterOption
+		allowed []string
+	}{
+		{"deny country", []GeoGaterOption{WithDeniedCountries("us")}, []string{"1.1.1.1", "4.4.4.4"}},
+		{"deny ASN", []GeoGaterOption{WithDeniedASNs(3)}, []string{"1.1.1.1", "2.2.2.2", "4.4.4.4"}},
+		{"allow country", []GeoGaterOption{WithAllowedCountries("US")}, []string{"2.2.2.2", "3.3.3.3"}},
+		{"allow country, deny ASN", []GeoGaterOption{WithAllowedCountries("US"), WithDeniedASNs(2)}, []string{"3.3.3.3"}},
+		{"allow country and ASN", []GeoGaterOption{WithAllowedCountries("US"), WithAllowedASNs(1, 2)}, []string{"2.2.2.2"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g, err := NewGeoGater(nil, append(tc.opts, WithGeoIPDatabase(db))...)
+			require.NoError(t, err)
+			defer g.Close()
+
+			for _, ip := range []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4"} {
+				expected := false
+				for _, a := range tc.allowed {
+					if a == ip {
+						expected = true
+					}
+				}
+				require.Equal(t, expected, g.InterceptAddrDial("peer", addr(ip)), ip)
+				cma := &mockConnMultiaddrs{local: ma.StringCast("/ip4/127.0.0.1/tcp/4001"), remote: addr(ip)}
+				require.Equal(t, expected, g.InterceptAccept(cma), ip)
+			}
+			// private and relayed addresses are always allowed
+			require.True(t, g.InterceptAddrDial("peer", ma.StringCast("/ip4/192.168.1.1/tcp/1234")))
+			require.True(t, g.InterceptAddrDial("peer", ma.StringCast("/ip4/4.4.4.4/tcp/1234/p2p/QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC/p2p-circuit")))
+		})
+	}
+}
+
+func TestGeoGaterOptions(t *testing.T) {
+	db := mockGeoIPDatabase{}
+	for _, opts := range [][]GeoGaterOption{
+		{WithDeniedCountries("DE")},
+		{WithGeoIPDatabase(db)},
+		{WithGeoIPDatabase(db), WithDeniedCountries("DEU")},
+		{WithGeoIPDatabase(db), WithAllowedASNs(0)},
+		{WithGeoIPDatabase(db), WithDeniedCountries("DE"), WithReloadInterval(0)},
+		{WithMaxMindDBFile(filepath.Join(t.TempDir(), "missing.mmdb")), WithDeniedCountries("DE")},
+	} {
+		_, err := NewGeoGater(nil, opts...)
+		require.Error(t, err)
+	}
+}
+
+func TestGeoGaterReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geoip.mmdb")
+	require.NoError(t, os.WriteFile(path, writeMMDB(t, 6, 24, testMMDBEntries), 0o644))
+
+	g, err := NewGeoGater(nil, WithMaxMindDBFile(path), WithDeniedCountries("DE"), WithReloadInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	defer g.Close()
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	require.False(t, g.InterceptAddrDial("peer", addr))
+
+	// a corrupted database is ignored
+	require.NoError(t, os.WriteFile(path, []byte("foobar"), 0o644))
+	time.Sleep(50 * time.Millisecond)
+	require.False(t, g.InterceptAddrDial("peer", addr))
+
+	tmp := path + ".tmp"
+	require.NoError(t, os.WriteFile(tmp, writeMMDB(t, 6, 24, []mmdbEntry{
+		{"1.2.3.0/24", map[string]any{"country": map[string]any{"iso_code": "AT"}}},
+	}), 0o644))
+	require.NoError(t, os.Rename(tmp, path))
+	require.Eventually(t, func() bool { return g.InterceptAddrDial("peer", addr) }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,358 @@
+package conngater
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// This file contains a minimal reader for databases in the MaxMind DB format,
+// see https://maxmind.github.io/MaxMind-DB/.
+
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// mmdbSeparatorSize is the size of the zero bytes between the search tree and the data section.
+const mmdbSeparatorSize = 16
+
+// mmdbMaxDepth limits the nesting of maps and arrays in the data section.
+const mmdbMaxDepth = 32
+
+// MaxMindDB is a geo-IP database in the MaxMind DB format, e.g. a GeoLite2 / GeoIP2 Country,
+// City or ASN database. The database is read into memory completely.
+type MaxMindDB struct {
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// ipv4Start is the node where the IPv4 subtree (::/96) starts in an IPv6 database.
+	ipv4Start uint
+}
+
+var _ GeoIPDatabase = &MaxMindDB{}
+
+// OpenMaxMindDB reads a database in the MaxMind DB format from a file.
+func OpenMaxMindDB(path string) (*MaxMindDB, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewMaxMindDB(b)
+}
+
+// NewMaxMindDB parses a database in the MaxMind DB format.
+func NewMaxMindDB(b []byte) (*MaxMindDB, error) {
+	i := bytes.LastIndex(b, mmdbMetadataMarker)
+	if i < 0 {
+		return nil, errors.New("mmdb: metadata not found")
+	}
+	metaSection := b[i+len(mmdbMetadataMarker):]
+	v, _, err := (&mmdbDecoder{buf: metaSection}).decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("mmdb: failed to decode metadata: %w", err)
+	}
+	meta, ok := v.(map[string]any)
+	if !ok {
+		return nil, errors.New("mmdb: metadata is not a map")
+	}
+	nodeCount, ok1 := meta["node_count"].(uint64)
+	recordSize, ok2 := meta["record_size"].(uint64)
+	ipVersion, ok3 := meta["ip_version"].(uint64)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, errors.New("mmdb: incomplete metadata")
+	}
+	if recordSize != 24 && recordSize != 28 && recordSize != 32 {
+		return nil, fmt.Errorf("mmdb: unsupported record size: %d", recordSize)
+	}
+	if ipVersion != 4 && ipVersion != 6 {
+		return nil, fmt.Errorf("mmdb: unsupported IP version: %d", ipVersion)
+	}
+	if nodeCount > math.MaxUint32 {
+		return nil, errors.New("mmdb: invalid node count")
+	}
+	treeSize := nodeCount * recordSize / 4
+	if treeSize+mmdbSeparatorSize > uint64(i) {
+		return nil, errors.New("mmdb: search tree exceeds the file size")
+	}
+
+	db := &MaxMindDB{
+		tree:       b[:treeSize],
+		data:       b[treeSize+mmdbSeparatorSize : i],
+		nodeCount:  uint(nodeCount),
+		recordSize: uint(recordSize),
+		ipVersion:  uint(ipVersion),
+	}
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// record reads the left (bit == 0) or right (bit == 1) record of a node in the search tree.
+func (db *MaxMindDB) record(node uint, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		b := db.tree[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.tree[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(db.tree[node*8+bit*4:]))
+	}
+}
+
+// lookup returns the data record for ip. It returns nil if the database doesn't contain ip.
+func (db *MaxMindDB) lookup(ip net.IP) (any, error) {
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+	} else if len(ip) != net.IPv6len || db.ipVersion == 4 {
+		return nil, nil
+	}
+
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-i%8)) & 1
+		node = db.record(node, bit)
+	}
+	switch {
+	case node == db.nodeCount:
+		return nil, nil
+	case node < db.nodeCount:
+		return nil, errors.New("mmdb: invalid search tree")
+	}
+	offset := node - db.nodeCount - mmdbSeparatorSize
+	if offset >= uint(len(db.data)) {
+		return nil, errors.New("mmdb: invalid data pointer")
+	}
+	v, _, err := (&mmdbDecoder{buf: db.data}).decode(offset, 0)
+	return v, err
+}
+
+// Lookup returns the country and the autonomous system of ip.
+// The country is taken from the "country" field, falling back to "registered_country",
+// and the ASN from the "autonomous_system_number" field.
+func (db *MaxMindDB) Lookup(ip net.IP) (GeoIPRecord, error) {
+	v, err := db.lookup(ip)
+	if err != nil || v == nil {
+		return GeoIPRecord{}, err
+	}
+	m, _ := v.(map[string]any)
+	var rec GeoIPRecord
+	for _, key := range []string{"country", "registered_country"} {
+		if c, ok := m[key].(map[string]any); ok {
+			if iso, ok := c["iso_code"].(string); ok {
+				rec.Country = iso
+				break
+			}
+		}
+	}
+	if asn, ok := m["autonomous_system_number"].(uint64); ok {
+		rec.ASN = uint32(asn)
+	}
+	return rec, nil
+}
+
+// mmdbDecoder decodes values from the data section (or the metadata section).
+// Strings are decoded as string, all unsigned and signed integers as uint64 and int64,
+// doubles and floats as float64, maps as map[string]any and arrays as []any.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+const (
+	mmdbTypeExtended = iota
+	mmdbTypePointer
+	mmdbTypeString
+	mmdbTypeDouble
+	mmdbTypeBytes
+	mmdbTypeUint16
+	mmdbTypeUint32
+	mmdbTypeMap
+	mmdbTypeInt32
+	mmdbTypeUint64
+	mmdbTypeUint128
+	mmdbTypeArray
+	mmdbTypeContainer
+	mmdbTypeEndMarker
+	mmdbTypeBool
+	mmdbTypeFloat
+)
+
+var errMMDBTruncated = errors.New("mmdb: unexpected end of data")
+
+func (d *mmdbDecoder) bytes(offset, n uint) ([]byte, error) {
+	if offset+n > uint(len(d.buf)) || offset+n < offset {
+		return nil, errMMDBTruncated
+	}
+	return d.buf[offset : offset+n], nil
+}
+
+// decode decodes the value at offset, and returns the offset after the value.
+func (d *mmdbDecoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > mmdbMaxDepth {
+		return nil, 0, errors.New("mmdb: data nested too deeply")
+	}
+	b, err := d.bytes(offset, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrl := b[0]
+	offset++
+	typ := uint(ctrl >> 5)
+
+	if typ == mmdbTypePointer {
+		ptr, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		// pointers to pointers are invalid, but are still bounded by the depth limit
+		v, _, err := d.decode(ptr, depth+1)
+		return v, next, err
+	}
+
+	if typ == mmdbTypeExtended {
+		b, err := d.bytes(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + uint(b[0])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		b, err := d.bytes(offset, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += n
+		var v uint
+		for _, c := range b {
+			v = v<<8 | uint(c)
+		}
+		switch n {
+		case 1:
+			size = 29 + v
+		case 2:
+			size = 285 + v
+		default:
+			size = 65821 + v
+		}
+	}
+
+	switch typ {
+	case mmdbTypeMap:
+		m := make(map[string]any)
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errors.New("mmdb: map key is not a string")
+			}
+			v, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case mmdbTypeArray:
+		var a []any
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case mmdbTypeBool:
+		return size != 0, offset, nil
+	}
+
+	b, err = d.bytes(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset += size
+	switch typ {
+	case mmdbTypeString:
+		return string(b), offset, nil
+	case mmdbTypeBytes, mmdbTypeUint128:
+		return append([]byte(nil), b...), offset, nil
+	case mmdbTypeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("mmdb: invalid double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case mmdbTypeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("mmdb: invalid float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case mmdbTypeUint16, mmdbTypeUint32, mmdbTypeUint64:
+		if size > 8 {
+			return nil, 0, errors.New("mmdb: invalid integer size")
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, offset, nil
+	case mmdbTypeInt32:
+		if size > 4 {
+			return nil, 0, errors.New("mmdb: invalid integer size")
+		}
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), offset, nil
+	default:
+		return nil, 0, fmt.Errorf("mmdb: unsupported data type %d", typ)
+	}
+}
+
+// pointer decodes a pointer, and returns the offset it points to and the offset after the pointer.
+func (d *mmdbDecoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint(ctrl>>3)&0x3 + 1
+	b, err := d.bytes(offset, n)
+	if err != nil {
+		return 0, 0, err
+	}
+	var ptr uint
+	if n < 4 {
+		ptr = uint(ctrl & 0x7)
+	}
+	for _, c := range b {
+		ptr = ptr<<8 | uint(c)
+	}
+	switch n {
+	case 2:
+		ptr += 2048
+	case 3:
+		ptr += 526336
+	}
+	return ptr, offset + n, nil
+}
@@ -46,6 +46,16 @@ type BasicConnMgr struct {
 	lastTrimMu sync.RWMutex
 	lastTrim   time.Time
 
+	// watermarks are the watermarks in effect.
+	// They differ from the configured watermarks while the resource manager is under pressure.
+	watermarks atomic.Pointer[watermarks]
+	pressure   pressureState
+
+	// nil if the trim decision log is disabled
+	trimDecisions *trimDecisionLog
+
+	retention retention
+
 	refCount                sync.WaitGroup
 	ctx                     context.Context
 	cancel                  func()
@@ -138,6 +148,14 @@ func NewConnManager(low, hi int, opts ...Option) (*BasicConnMgr, error) {
 		}
 	}
 
+	cm.watermarks.Store(&watermarks{low: cfg.lowWater, high: cfg.highWater})
+	for p, n := range cfg.protocolRetention {
+		cm.SetProtocolRetention(p, n)
+	}
+	if cfg.trimDecisionLogSize > 0 {
+		cm.trimDecisions = newTrimDecisionLog(cfg.trimDecisionLogSize)
+	}
+
 	cm.ctx, cm.cancel = context.WithCancel(context.Background())
 
 	if cfg.emergencyTrim {
@@ -150,6 +168,10 @@ func NewConnManager(low, hi int, opts ...Option) (*BasicConnMgr, error) {
 
 	cm.refCount.Add(1)
 	go cm.background()
+	if cfg.resourcePressure != nil {
+		cm.refCount.Add(1)
+		go cm.resourcePressureLoop(cm.clock.Ticker(resourcePressureCheckInterval))
+	}
 	return cm, nil
 }
 
@@ -159,9 +181,10 @@ func NewConnManager(low, hi int, opts ...Option) (*BasicConnMgr, error) {
 // We try to not kill protected connections, but if that turns out to be necessary, not connection is safe!
 func (cm *BasicConnMgr) memoryEmergency() {
 	connCount := int(cm.connCount.Load())
-	target := connCount - cm.cfg.lowWater
+	lowWater := cm.watermarks.Load().low
+	target := connCount - lowWater
 	if target < 0 {
-		log.Warnw("Low on memory, but we only have a few connections", "num", connCount, "low watermark", cm.cfg.lowWater)
+		log.Warnw("Low on memory, but we only have a few connections", "num", connCount, "low watermark", lowWater)
 		return
 	} else {
 		log.Warnf("Low on memory. Closing %d connections.", target)
@@ -192,6 +215,11 @@ func (cm *BasicConnMgr) Close() error {
 		return err
 	}
 	cm.refCount.Wait()
+	cm.pressure.mx.Lock()
+	if cm.pressure.emitter != nil {
+		cm.pressure.emitter.Close()
+	}
+	cm.pressure.mx.Unlock()
 	return nil
 }
 
@@ -346,7 +374,7 @@ func (cm *BasicConnMgr) background() {
 	for {
 		select {
 		case <-ticker.C:
-			if cm.connCount.Load() < int32(cm.cfg.highWater) {
+			if cm.connCount.Load() < int32(cm.watermarks.Load().high) {
 				// Below high water, skip.
 				continue
 			}
@@ -381,6 +409,9 @@ func (cm *BasicConnMgr) trim() {
 }
 
 func (cm *BasicConnMgr) getConnsToCloseEmergency(target int) []network.Conn {
+	d := cm.newTrimDecision(true)
+	defer cm.trimDecisions.record(d)
+
 	candidates := make(peerInfos, 0, cm.segments.countPeers())
 
 	cm.plk.RLock()
@@ -392,6 +423,9 @@ func (cm *BasicConnMgr) getConnsToCloseEmergency(target int) []network.Conn {
 				continue
 			}
 			candidates = append(candidates, inf)
+			if d != nil {
+				d.Candidates += len(inf.conns)
+			}
 		}
 		s.Unlock()
 	}
@@ -400,13 +434,21 @@ func (cm *BasicConnMgr) getConnsToCloseEmergency(target int) []network.Conn {
 	// Sort peers according to their value.
 	candidates.SortByValueAndStreams(&cm.segments, true)
 
+	rt := cm.newRetentionTracker()
 	selected := make([]network.Conn, 0, target+10)
 	for _, inf := range candidates {
 		if target <= 0 {
 			break
 		}
+		if rt.retain(inf.id) {
+			d.retain()
+			continue
+		}
 		s := cm.segments.get(inf.id)
 		s.Lock()
+		if len(inf.conns) > 0 {
+			d.addPeer(inf, false)
+		}
 		for c := range inf.conns {
 			selected = append(selected, c)
 		}
@@ -436,9 +478,16 @@ func (cm *BasicConnMgr) getConnsToCloseEmergency(target int) []network.Conn {
 		if target <= 0 {
 			break
 		}
+		var protected bool
+		if d != nil {
+			protected = cm.IsProtected(inf.id, "")
+		}
 		// lock this to protect from concurrent modifications from connect/disconnect events
 		s := cm.segments.get(inf.id)
 		s.Lock()
+		if len(inf.conns) > 0 {
+			d.addPeer(inf, protected)
+		}
 		for c := range inf.conns {
 			selected = append(selected, c)
 		}
@@ -455,9 +504,14 @@ func (cm *BasicConnMgr) getConnsToClose() []network.Conn {
 		// disabled
 		return nil
 	}
+	lowWater := cm.watermarks.Load().low
 
-	if int(cm.connCount.Load()) <= cm.cfg.lowWater {
+	d := cm.newTrimDecision(false)
+	defer cm.trimDecisions.record(d)
+
+	if int(cm.connCount.Load()) <= lowWater {
 		log.Info("open connection count below limit")
+		d.skip("open connection count below low watermark")
 		return nil
 	}
 
@@ -486,8 +540,12 @@ func (cm *BasicConnMgr) getConnsToClose() []network.Conn {
 	}
 	cm.plk.RUnlock()
 
-	if ncandidates < cm.cfg.lowWater {
+	if d != nil {
+		d.Candidates = ncandidates
+	}
+	if ncandidates < lowWater {
 		log.Info("open connection count above limit but too many are in the grace period")
+		d.skip("too many connections are in the grace period")
 		// We have too many connections but fewer than lowWater
 		// connections out of the grace period.
 		//
@@ -498,11 +556,12 @@ func (cm *BasicConnMgr) getConnsToClose() []network.Conn {
 	// Sort peers according to their value.
 	candidates.SortByValueAndStreams(&cm.segments, false)
 
-	target := ncandidates - cm.cfg.lowWater
+	target := ncandidates - lowWater
 
 	// slightly overallocate because we may have more than one conns per peer
 	selected := make([]network.Conn, 0, target+10)
 
+	rt := cm.newRetentionTracker()
 	for _, inf := range candidates {
 		if target <= 0 {
 			break
@@ -515,7 +574,11 @@ func (cm *BasicConnMgr) getConnsToClose() []network.Conn {
 			// handle temporary entries for early tags -- this entry has gone past the grace period
 			// and still holds no connections, so prune it.
 			delete(s.peers, inf.id)
+		} else if rt.retain(inf.id) {
+			// keep the peer to satisfy the retention of a protocol it supports
+			d.retain()
 		} else {
+			d.addPeer(inf, false)
 			for c := range inf.conns {
 				selected = append(selected, c)
 			}
@@ -606,9 +669,11 @@ func (cm *BasicConnMgr) UpsertTag(p peer.ID, tag string, upsert func(int) int) {
 // CMInfo holds the configuration for BasicConnMgr, as well as status data.
 type CMInfo struct {
 	// The low watermark, as described in NewConnManager.
+	// This is lower than the configured value while the resource manager is under pressure.
 	LowWater int
 
 	// The high watermark, as described in NewConnManager.
+	// This is lower than the configured value while the resource manager is under pressure.
 	HighWater int
 
 	// The timestamp when the last trim was triggered.
@@ -627,9 +692,10 @@ func (cm *BasicConnMgr) GetInfo() CMInfo {
 	lastTrim := cm.lastTrim
 	cm.lastTrimMu.RUnlock()
 
+	wm := cm.watermarks.Load()
 	return CMInfo{
-		HighWater:   cm.cfg.highWater,
-		LowWater:    cm.cfg.lowWater,
+		HighWater:   wm.high,
+		LowWater:    wm.low,
 		LastTrim:    lastTrim,
 		GracePeriod: cm.cfg.gracePeriod,
 		ConnCount:   int(cm.connCount.Load()),
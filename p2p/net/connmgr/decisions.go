@@ -0,0 +1,190 @@
+package connmgr
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// TrimDecision records a trim of the connection manager: the thresholds in effect,
+// and the peers whose connections were closed, with their scores at the time of the decision.
+type TrimDecision struct {
+	// Time is the time of the trim.
+	Time time.Time
+	// Emergency is set if the trim was triggered because the process was running low on memory.
+	// Emergency trims ignore the grace period, and may close connections to protected peers.
+	Emergency bool
+	// LowWater and HighWater are the watermarks in effect.
+	LowWater, HighWater int
+	// GracePeriod is the configured grace period.
+	GracePeriod time.Duration
+	// ConnCount is the number of connections when the trim started.
+	ConnCount int
+	// Candidates is the number of connections that were eligible for trimming,
+	// i.e. connections to peers that are neither protected nor in their grace period.
+	Candidates int
+	// Retained is the number of candidate peers whose connections were kept to satisfy
+	// the retention of a protocol they support (see WithProtocolRetention).
+	Retained int
+	// Skipped explains why the trim didn't close any connections. Empty if the trim wasn't skipped.
+	Skipped string
+	// Closed are the peers whose connections were closed, in the order they were selected.
+	Closed []TrimmedPeer
+}
+
+// TrimmedPeer describes a peer whose connections were closed by a trim.
+type TrimmedPeer struct {
+	ID peer.ID
+	// Value is the score of the peer, i.e. the sum of its tag values.
+	Value int
+	// Tags are the tags of the peer, including decaying tags.
+	Tags map[string]int
+	// Conns is the number of connections that were closed.
+	Conns int
+	// Streams is the number of streams that were open on these connections.
+	Streams int
+	// Protected is set if the peer was protected. This only happens in emergency trims.
+	Protected bool
+	// FirstSeen is the time we began tracking the peer.
+	FirstSeen time.Time
+}
+
+// WithTrimDecisionLog keeps a log of the last size trim decisions,
+// which can be queried using TrimDecisions and TrimDecisionsFor.
+func WithTrimDecisionLog(size int) Option {
+	return func(cfg *config) error {
+		if size <= 0 {
+			return errors.New("trim decision log size must be positive")
+		}
+		cfg.trimDecisionLogSize = size
+		return nil
+	}
+}
+
+// trimDecisionLog is a ring buffer of trim decisions.
+type trimDecisionLog struct {
+	mx        sync.Mutex
+	decisions []*TrimDecision
+	next      int
+	full      bool
+}
+
+func newTrimDecisionLog(size int) *trimDecisionLog {
+	return &trimDecisionLog{decisions: make([]*TrimDecision, size)}
+}
+
+func (l *trimDecisionLog) record(d *TrimDecision) {
+	if l == nil || d == nil {
+		return
+	}
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	l.decisions[l.next] = d
+	l.next++
+	if l.next == len(l.decisions) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// all returns the decisions, oldest first
+func (l *trimDecisionLog) all() []*TrimDecision {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if !l.full {
+		return append([]*TrimDecision(nil), l.decisions[:l.next]...)
+	}
+	res := make([]*TrimDecision, 0, len(l.decisions))
+	res = append(res, l.decisions[l.next:]...)
+	return append(res, l.decisions[:l.next]...)
+}
+
+// newTrimDecision returns a new trim decision, or nil if the trim decision log is disabled.
+func (cm *BasicConnMgr) newTrimDecision(emergency bool) *TrimDecision {
+	if cm.trimDecisions == nil {
+		return nil
+	}
+	wm := cm.watermarks.Load()
+	return &TrimDecision{
+		Time:        cm.clock.Now(),
+		Emergency:   emergency,
+		LowWater:    wm.low,
+		HighWater:   wm.high,
+		GracePeriod: cm.cfg.gracePeriod,
+		ConnCount:   int(cm.connCount.Load()),
+	}
+}
+
+func (d *TrimDecision) skip(reason string) {
+	if d != nil {
+		d.Skipped = reason
+	}
+}
+
+// retain records that the connections of a peer are kept to satisfy a protocol retention.
+func (d *TrimDecision) retain() {
+	if d != nil {
+		d.Retained++
+	}
+}
+
+// addPeer records that the connections of a peer are closed.
+// The caller must hold the lock of the peer's segment.
+func (d *TrimDecision) addPeer(inf *peerInfo, protected bool) {
+	if d == nil {
+		return
+	}
+	tp := TrimmedPeer{
+		ID:        inf.id,
+		Value:     inf.value,
+		Tags:      make(map[string]int, len(inf.tags)+len(inf.decaying)),
+		Conns:     len(inf.conns),
+		Protected: protected,
+		FirstSeen: inf.firstSeen,
+	}
+	for t, v := range inf.tags {
+		tp.Tags[t] = v
+	}
+	for t, v := range inf.decaying {
+		tp.Tags[t.name] = v.Value
+	}
+	for c := range inf.conns {
+		tp.Streams += c.Stat().NumStreams
+	}
+	d.Closed = append(d.Closed, tp)
+}
+
+// TrimDecisions returns the logged trim decisions, oldest first.
+// It returns nil unless the trim decision log is enabled using WithTrimDecisionLog.
+func (cm *BasicConnMgr) TrimDecisions() []TrimDecision {
+	if cm.trimDecisions == nil {
+		return nil
+	}
+	decisions := cm.trimDecisions.all()
+	res := make([]TrimDecision, 0, len(decisions))
+	for _, d := range decisions {
+		res = append(res, *d)
+	}
+	return res
+}
+
+// TrimDecisionsFor returns the logged trim decisions that closed the connections of peer p, oldest first.
+// This answers the question why the connection manager dropped the connection to a peer.
+// It returns nil unless the trim decision log is enabled using WithTrimDecisionLog.
+func (cm *BasicConnMgr) TrimDecisionsFor(p peer.ID) []TrimDecision {
+	if cm.trimDecisions == nil {
+		return nil
+	}
+	var res []TrimDecision
+	for _, d := range cm.trimDecisions.all() {
+		for _, tp := range d.Closed {
+			if tp.ID == p {
+				res = append(res, *d)
+				break
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,77 @@
+package connmgr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrimDecisionLogDisabled(t *testing.T) {
+	cm, err := NewConnManager(1, 2, WithGracePeriod(0))
+	require.NoError(t, err)
+	defer cm.Close()
+	for i := 0; i < 3; i++ {
+		cm.Notifee().Connected(nil, randConn(t, nil))
+	}
+	cm.TrimOpenConns(context.Background())
+	require.Nil(t, cm.TrimDecisions())
+
+	_, err = NewConnManager(1, 2, WithTrimDecisionLog(0))
+	require.Error(t, err)
+}
+
+func TestTrimDecisionLog(t *testing.T) {
+	cm, err := NewConnManager(2, 4, WithGracePeriod(0), WithSilencePeriod(time.Hour), WithTrimDecisionLog(2))
+	require.NoError(t, err)
+	defer cm.Close()
+	not := cm.Notifee()
+
+	var conns []network.Conn
+	for i := 0; i < 5; i++ {
+		c := randConn(t, not.Disconnected)
+		conns = append(conns, c)
+		not.Connected(nil, c)
+		cm.TagPeer(c.RemotePeer(), "value", i)
+	}
+	cm.TagPeer(conns[0].RemotePeer(), "other", -1)
+
+	cm.TrimOpenConns(context.Background())
+	decisions := cm.TrimDecisions()
+	require.Len(t, decisions, 1)
+	d := decisions[0]
+	require.False(t, d.Emergency)
+	require.Empty(t, d.Skipped)
+	require.Equal(t, 2, d.LowWater)
+	require.Equal(t, 4, d.HighWater)
+	require.Equal(t, 5, d.ConnCount)
+	require.Equal(t, 5, d.Candidates)
+	// the peers with the lowest values are closed first
+	require.Len(t, d.Closed, 3)
+	for i, tp := range d.Closed {
+		require.Equal(t, conns[i].RemotePeer(), tp.ID)
+		require.Equal(t, 1, tp.Conns)
+		require.Equal(t, 1, tp.Streams)
+	}
+	require.Equal(t, -1, d.Closed[0].Value)
+	require.Equal(t, map[string]int{"value": 0, "other": -1}, d.Closed[0].Tags)
+	require.Equal(t, map[string]int{"value": 2}, d.Closed[2].Tags)
+
+	require.Len(t, cm.TrimDecisionsFor(conns[1].RemotePeer()), 1)
+	require.Empty(t, cm.TrimDecisionsFor(conns[4].RemotePeer()))
+
+	// we're below the low watermark now
+	cm.TrimOpenConns(context.Background())
+	cm.TrimOpenConns(context.Background())
+	decisions = cm.TrimDecisions()
+	// only the last two decisions are kept
+	require.Len(t, decisions, 2)
+	for _, d := range decisions {
+		require.Empty(t, d.Closed)
+		require.Equal(t, "open connection count below low watermark", d.Skipped)
+	}
+	require.Empty(t, cm.TrimDecisionsFor(conns[1].RemotePeer()))
+}
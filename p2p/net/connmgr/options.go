@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/benbjohnson/clock"
+	"github.com/libp2p/go-libp2p/core/protocol"
 )
 
 // config is the configuration struct for the basic connection manager.
@@ -16,6 +17,12 @@ type config struct {
 	decayer       *DecayerCfg
 	emergencyTrim bool
 	clock         clock.Clock
+
+	resourcePressure *resourcePressureConfig
+
+	trimDecisionLogSize int
+
+	protocolRetention map[protocol.ID]int
 }
 
 // Option represents an option for the basic connection manager.
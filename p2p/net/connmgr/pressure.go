@@ -0,0 +1,163 @@
+package connmgr
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+)
+
+// resourcePressureCheckInterval is the interval at which the utilization of the resource manager is checked.
+const resourcePressureCheckInterval = time.Second
+
+// resourcePressureRecoveryMargin is the margin below the pressure threshold the utilization needs to drop
+// below to consider the pressure subsided. This prevents flapping around the threshold.
+const resourcePressureRecoveryMargin = 0.1
+
+type resourcePressureConfig struct {
+	rm network.ResourceManager
+	// threshold is the utilization of the system memory limit above which we're under pressure
+	threshold float64
+	// factor is the factor the watermarks are scaled with while under pressure
+	factor float64
+}
+
+// WithResourcePressure makes the connection manager react to pressure on the resource manager.
+// When the memory utilization of the resource manager's system scope exceeds threshold (e.g. 0.8),
+// the watermarks are scaled by factor (e.g. 0.5), and connections are trimmed immediately.
+// The configured watermarks are restored once the utilization drops below threshold-0.1, which
+// prevents flapping around the threshold. threshold must therefore be larger than 0.1.
+//
+// Transitions are announced using the event.EvtResourcePressureChanged event, if the connection
+// manager is used by a host.
+func WithResourcePressure(rm network.ResourceManager, threshold, factor float64) Option {
+	return func(cfg *config) error {
+		if rm == nil {
+			return errors.New("resource manager must not be nil")
+		}
+		if threshold <= resourcePressureRecoveryMargin || threshold > 1 {
+			return errors.New("resource pressure threshold must be between 0.1 and 1")
+		}
+		if factor <= 0 || factor >= 1 {
+			return errors.New("resource pressure factor must be between 0 and 1")
+		}
+		cfg.resourcePressure = &resourcePressureConfig{rm: rm, threshold: threshold, factor: factor}
+		return nil
+	}
+}
+
+// watermarks are the watermarks in effect.
+type watermarks struct {
+	low, high int
+}
+
+// pressureState tracks the resource pressure state of the connection manager.
+type pressureState struct {
+	mx            sync.Mutex
+	underPressure bool
+	emitter       event.Emitter
+}
+
+// SetEventBus configures the connection manager to emit events on the event bus.
+// This is called by the host when it is constructed.
+func (cm *BasicConnMgr) SetEventBus(bus event.Bus) error {
+	if cm.cfg.resourcePressure == nil {
+		return nil
+	}
+	em, err := bus.Emitter(new(event.EvtResourcePressureChanged), eventbus.Stateful)
+	if err != nil {
+		return err
+	}
+	cm.pressure.mx.Lock()
+	defer cm.pressure.mx.Unlock()
+	if cm.pressure.emitter != nil {
+		cm.pressure.emitter.Close()
+	}
+	cm.pressure.emitter = em
+	return nil
+}
+
+func (cm *BasicConnMgr) resourcePressureLoop(ticker *clock.Ticker) {
+	defer cm.refCount.Done()
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cm.checkResourcePressure()
+		case <-cm.ctx.Done():
+			return
+		}
+	}
+}
+
+func (cm *BasicConnMgr) checkResourcePressure() {
+	cfg := cm.cfg.resourcePressure
+	utilization := memoryUtilization(cfg.rm)
+
+	cm.pressure.mx.Lock()
+	defer cm.pressure.mx.Unlock()
+
+	var underPressure bool
+	if cm.pressure.underPressure {
+		underPressure = utilization >= cfg.threshold-resourcePressureRecoveryMargin
+	} else {
+		underPressure = utilization >= cfg.threshold
+	}
+	if underPressure == cm.pressure.underPressure {
+		return
+	}
+	cm.pressure.underPressure = underPressure
+
+	wm := watermarks{low: cm.cfg.lowWater, high: cm.cfg.highWater}
+	if underPressure {
+		wm.low = int(float64(wm.low) * cfg.factor)
+		wm.high = int(float64(wm.high) * cfg.factor)
+		log.Warnw("resource manager under pressure, reducing watermarks", "memory utilization", utilization, "low watermark", wm.low, "high watermark", wm.high)
+	} else {
+		log.Infow("resource pressure subsided, restoring watermarks", "memory utilization", utilization, "low watermark", wm.low, "high watermark", wm.high)
+	}
+	cm.watermarks.Store(&wm)
+
+	if cm.pressure.emitter != nil {
+		if err := cm.pressure.emitter.Emit(event.EvtResourcePressureChanged{
+			UnderPressure:     underPressure,
+			MemoryUtilization: utilization,
+			LowWater:          wm.low,
+			HighWater:         wm.high,
+		}); err != nil {
+			log.Warnf("failed to emit resource pressure event: %s", err)
+		}
+	}
+
+	if underPressure && int(cm.connCount.Load()) >= wm.high {
+		// Don't wait for the background loop, trim right away.
+		cm.refCount.Add(1)
+		go func() {
+			defer cm.refCount.Done()
+			cm.doTrim()
+		}()
+	}
+}
+
+// memoryUtilization returns the utilization of the memory limit of the system scope.
+// It returns 0 if the resource manager doesn't expose its limits.
+func memoryUtilization(rm network.ResourceManager) float64 {
+	var utilization float64
+	_ = rm.ViewSystem(func(s network.ResourceScope) error {
+		limiter, ok := s.(rcmgr.ResourceScopeLimiter)
+		if !ok {
+			return nil
+		}
+		if limit := limiter.Limit().GetMemoryLimit(); limit > 0 {
+			utilization = float64(s.Stat().Memory) / float64(limit)
+		}
+		return nil
+	})
+	return utilization
+}
@@ -0,0 +1,126 @@
+package connmgr
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mockSystemScope struct {
+	network.ResourceScope
+	memory atomic.Int64
+}
+
+func (s *mockSystemScope) Stat() network.ScopeStat { return network.ScopeStat{Memory: s.memory.Load()} }
+func (s *mockSystemScope) Limit() rcmgr.Limit      { return &rcmgr.BaseLimit{Memory: 100} }
+func (s *mockSystemScope) SetLimit(rcmgr.Limit)    {}
+
+type mockResourceManager struct {
+	network.NullResourceManager
+	system *mockSystemScope
+}
+
+func (rm *mockResourceManager) ViewSystem(f func(network.ResourceScope) error) error {
+	return f(rm.system)
+}
+
+func TestResourcePressureOptions(t *testing.T) {
+	rm := &mockResourceManager{system: &mockSystemScope{}}
+	for _, opt := range []Option{
+		WithResourcePressure(nil, 0.8, 0.5),
+		WithResourcePressure(rm, 0, 0.5),
+		WithResourcePressure(rm, 1.1, 0.5),
+		WithResourcePressure(rm, 0.8, 0),
+		WithResourcePressure(rm, 0.8, 1),
+	} {
+		_, err := NewConnManager(10, 20, opt)
+		require.Error(t, err)
+	}
+}
+
+func TestResourcePressure(t *testing.T) {
+	mockClock := clock.NewMock()
+	rm := &mockResourceManager{system: &mockSystemScope{}}
+	cm, err := NewConnManager(10, 20,
+		WithGracePeriod(0),
+		WithSilencePeriod(time.Hour),
+		WithClock(mockClock),
+		WithResourcePressure(rm, 0.8, 0.5),
+	)
+	require.NoError(t, err)
+	defer cm.Close()
+
+	bus := eventbus.NewBus()
+	require.NoError(t, cm.SetEventBus(bus))
+	sub, err := bus.Subscribe(new(event.EvtResourcePressureChanged))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	not := cm.Notifee()
+	var conns []network.Conn
+	for i := 0; i < 15; i++ {
+		rc := randConn(t, not.Disconnected)
+		conns = append(conns, rc)
+		not.Connected(nil, rc)
+	}
+	numClosed := func() int {
+		var closed int
+		for _, c := range conns {
+			if c.(*tconn).isClosed() {
+				closed++
+			}
+		}
+		return closed
+	}
+
+	// no pressure yet
+	rm.system.memory.Store(70)
+	mockClock.Add(resourcePressureCheckInterval)
+	require.Equal(t, 20, cm.GetInfo().HighWater)
+
+	// under pressure: the watermarks are halved, and we trim down to the reduced low watermark right away
+	rm.system.memory.Store(85)
+	mockClock.Add(resourcePressureCheckInterval)
+	select {
+	case e := <-sub.Out():
+		evt := e.(event.EvtResourcePressureChanged)
+		require.True(t, evt.UnderPressure)
+		require.Equal(t, 0.85, evt.MemoryUtilization)
+		require.Equal(t, 5, evt.LowWater)
+		require.Equal(t, 10, evt.HighWater)
+	case <-time.After(time.Second):
+		t.Fatal("expected a resource pressure event")
+	}
+	info := cm.GetInfo()
+	require.Equal(t, 5, info.LowWater)
+	require.Equal(t, 10, info.HighWater)
+	require.Eventually(t, func() bool { return numClosed() == 10 }, time.Second, 10*time.Millisecond)
+
+	// The pressure only subsides once the utilization drops sufficiently below the threshold.
+	rm.system.memory.Store(75)
+	mockClock.Add(resourcePressureCheckInterval)
+	require.Equal(t, 10, cm.GetInfo().HighWater)
+
+	rm.system.memory.Store(60)
+	mockClock.Add(resourcePressureCheckInterval)
+	select {
+	case e := <-sub.Out():
+		evt := e.(event.EvtResourcePressureChanged)
+		require.False(t, evt.UnderPressure)
+		require.Equal(t, 10, evt.LowWater)
+		require.Equal(t, 20, evt.HighWater)
+	case <-time.After(time.Second):
+		t.Fatal("expected a resource pressure event")
+	}
+	info = cm.GetInfo()
+	require.Equal(t, 10, info.LowWater)
+	require.Equal(t, 20, info.HighWater)
+}
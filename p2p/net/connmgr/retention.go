@@ -0,0 +1,140 @@
+package connmgr
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// WithProtocolRetention makes the connection manager retain connections to at least n peers
+// supporting protocol p: trims skip peers supporting p as long as there are n or fewer of them left.
+// This only applies once the connection manager knows which protocols peers support, see SetProtoBook.
+// The retention can be changed at runtime using SetProtocolRetention.
+func WithProtocolRetention(p protocol.ID, n int) Option {
+	return func(cfg *config) error {
+		if n <= 0 {
+			return errors.New("protocol retention must be positive")
+		}
+		if cfg.protocolRetention == nil {
+			cfg.protocolRetention = make(map[protocol.ID]int)
+		}
+		cfg.protocolRetention[p] = n
+		return nil
+	}
+}
+
+// retention holds the per-protocol retention floors.
+type retention struct {
+	mx     sync.RWMutex
+	floors map[protocol.ID]int
+	pb     peerstore.ProtoBook
+}
+
+// SetProtoBook sets the protocol book used to determine which protocols peers support.
+// This is called by the host when it is constructed.
+func (cm *BasicConnMgr) SetProtoBook(pb peerstore.ProtoBook) {
+	cm.retention.mx.Lock()
+	defer cm.retention.mx.Unlock()
+	cm.retention.pb = pb
+}
+
+// SetProtocolRetention makes the connection manager retain connections to at least n peers
+// supporting protocol p. Setting n to 0 removes the retention for p.
+func (cm *BasicConnMgr) SetProtocolRetention(p protocol.ID, n int) {
+	cm.retention.mx.Lock()
+	defer cm.retention.mx.Unlock()
+	if n <= 0 {
+		delete(cm.retention.floors, p)
+		return
+	}
+	if cm.retention.floors == nil {
+		cm.retention.floors = make(map[protocol.ID]int)
+	}
+	cm.retention.floors[p] = n
+}
+
+// ProtocolRetention returns the per-protocol retention currently in effect.
+func (cm *BasicConnMgr) ProtocolRetention() map[protocol.ID]int {
+	cm.retention.mx.RLock()
+	defer cm.retention.mx.RUnlock()
+	res := make(map[protocol.ID]int, len(cm.retention.floors))
+	for p, n := range cm.retention.floors {
+		res[p] = n
+	}
+	return res
+}
+
+// retentionTracker keeps track of the number of connected peers supporting the protocols
+// that have a retention floor during a trim.
+type retentionTracker struct {
+	floors map[protocol.ID]int
+	// remaining is the number of connected peers supporting each protocol that we haven't decided to close yet
+	remaining map[protocol.ID]int
+	// supported caches the floor protocols supported by each peer
+	supported map[peer.ID][]protocol.ID
+}
+
+// newRetentionTracker returns a tracker for the current retention floors, or nil if there are none.
+// The caller must not hold any segment locks.
+func (cm *BasicConnMgr) newRetentionTracker() *retentionTracker {
+	cm.retention.mx.RLock()
+	defer cm.retention.mx.RUnlock()
+	if cm.retention.pb == nil || len(cm.retention.floors) == 0 {
+		return nil
+	}
+
+	protos := make([]protocol.ID, 0, len(cm.retention.floors))
+	floors := make(map[protocol.ID]int, len(cm.retention.floors))
+	for p, n := range cm.retention.floors {
+		protos = append(protos, p)
+		floors[p] = n
+	}
+	t := &retentionTracker{
+		floors:    floors,
+		remaining: make(map[protocol.ID]int, len(floors)),
+		supported: make(map[peer.ID][]protocol.ID),
+	}
+
+	var peers []peer.ID
+	for _, s := range cm.segments.buckets {
+		s.Lock()
+		for id, inf := range s.peers {
+			if len(inf.conns) > 0 {
+				peers = append(peers, id)
+			}
+		}
+		s.Unlock()
+	}
+	for _, p := range peers {
+		supported, err := cm.retention.pb.SupportsProtocols(p, protos...)
+		if err != nil || len(supported) == 0 {
+			continue
+		}
+		t.supported[p] = supported
+		for _, proto := range supported {
+			t.remaining[proto]++
+		}
+	}
+	return t
+}
+
+// retain reports whether the connections to peer p need to be kept to satisfy a retention floor.
+// If not, the peer is counted as closed.
+func (t *retentionTracker) retain(p peer.ID) bool {
+	if t == nil {
+		return false
+	}
+	supported := t.supported[p]
+	for _, proto := range supported {
+		if t.remaining[proto] <= t.floors[proto] {
+			return true
+		}
+	}
+	for _, proto := range supported {
+		t.remaining[proto]--
+	}
+	return false
+}
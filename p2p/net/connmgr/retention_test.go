@@ -0,0 +1,83 @@
+package connmgr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtocolRetention(t *testing.T) {
+	const proto = protocol.ID("/relay")
+	ps, err := pstoremem.NewPeerstore()
+	require.NoError(t, err)
+	defer ps.Close()
+
+	cm, err := NewConnManager(2, 4, WithGracePeriod(0), WithSilencePeriod(time.Hour), WithTrimDecisionLog(1), WithProtocolRetention(proto, 2))
+	require.NoError(t, err)
+	defer cm.Close()
+	cm.SetProtoBook(ps)
+	require.Equal(t, map[protocol.ID]int{proto: 2}, cm.ProtocolRetention())
+
+	not := cm.Notifee()
+	var conns []network.Conn
+	for i := 0; i < 6; i++ {
+		c := randConn(t, not.Disconnected)
+		conns = append(conns, c)
+		not.Connected(nil, c)
+		cm.TagPeer(c.RemotePeer(), "value", i)
+		// the three least valuable peers support the protocol
+		if i < 3 {
+			require.NoError(t, ps.AddProtocols(c.RemotePeer(), proto))
+		}
+	}
+
+	cm.TrimOpenConns(context.Background())
+	// The least valuable peer supporting the protocol is closed,
+	// the other two are kept to satisfy the retention.
+	for i, c := range conns {
+		closed := c.(*tconn).isClosed()
+		if i == 1 || i == 2 {
+			require.False(t, closed, "connection %d should have been retained", i)
+		} else {
+			require.True(t, closed, "connection %d should have been closed", i)
+		}
+	}
+	decisions := cm.TrimDecisions()
+	require.Len(t, decisions, 1)
+	require.Equal(t, 2, decisions[0].Retained)
+	require.Len(t, decisions[0].Closed, 4)
+
+	cm.SetProtocolRetention(proto, 0)
+	require.Empty(t, cm.ProtocolRetention())
+
+	_, err = NewConnManager(2, 4, WithProtocolRetention(proto, 0))
+	require.Error(t, err)
+}
+
+func TestProtocolRetentionWithoutProtoBook(t *testing.T) {
+	cm, err := NewConnManager(1, 2, WithGracePeriod(0), WithProtocolRetention("/relay", 10))
+	require.NoError(t, err)
+	defer cm.Close()
+
+	not := cm.Notifee()
+	var conns []network.Conn
+	for i := 0; i < 3; i++ {
+		c := randConn(t, not.Disconnected)
+		conns = append(conns, c)
+		not.Connected(nil, c)
+	}
+	cm.TrimOpenConns(context.Background())
+	var closed int
+	for _, c := range conns {
+		if c.(*tconn).isClosed() {
+			closed++
+		}
+	}
+	require.Equal(t, 2, closed)
+}
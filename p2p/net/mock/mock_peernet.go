@@ -369,6 +369,17 @@ func (pn *peernet) ListenAddresses() []ma.Multiaddr {
 	return pn.Peerstore().Addrs(pn.LocalPeer())
 }
 
+// ListenStatus returns the status of the listeners.
+// Listeners of the mock network never fail.
+func (pn *peernet) ListenStatus() []network.ListenerStatus {
+	addrs := pn.ListenAddresses()
+	statuses := make([]network.ListenerStatus, 0, len(addrs))
+	for _, a := range addrs {
+		statuses = append(statuses, network.ListenerStatus{Addr: a, ListenAddr: a, State: network.ListenerActive})
+	}
+	return statuses
+}
+
 // InterfaceListenAddresses returns a list of addresses at which this network
 // listens. It expands "any interface" addresses (/ip4/0.0.0.0, /ip6/::) to
 // use the known local interfaces.
@@ -16,3 +16,20 @@ func NewProtectedConn(psk ipnet.PSK, conn net.Conn) (net.Conn, error) {
 	copy(p[:], psk)
 	return newPSKConn(&p, conn)
 }
+
+// NewProtectedPacketConn creates a new protected packet connection.
+// It is used by transports that don't operate on a stream-based net.Conn, like QUIC and WebTransport.
+//
+// Every packet is encrypted using the PSK. This adds an overhead of 24 bytes to every packet,
+// so callers must make sure that the packets they send still fit into the MTU.
+func NewProtectedPacketConn(psk ipnet.PSK, conn net.PacketConn) (net.PacketConn, error) {
+	if len(psk) != 32 {
+		return nil, errors.New("expected 32 byte PSK")
+	}
+	if conn == nil {
+		return nil, errInsecureNil
+	}
+	var p [32]byte
+	copy(p[:], psk)
+	return &pskPacketConn{PacketConn: conn, psk: &p}, nil
+}
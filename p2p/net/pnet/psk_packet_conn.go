@@ -0,0 +1,57 @@
+package pnet
+
+import (
+	"crypto/rand"
+	"net"
+
+	pool "github.com/libp2p/go-buffer-pool"
+	"golang.org/x/crypto/salsa20"
+)
+
+// packetNonceSize is the size of the random nonce prepended to every packet.
+const packetNonceSize = 24
+
+// pskPacketConn protects every packet using XSalsa20, keyed with the PSK.
+// Every packet is prefixed with a random nonce.
+//
+// Packets that were not protected using the same PSK decrypt to garbage,
+// and are dropped by the protocol running on top (e.g. QUIC).
+type pskPacketConn struct {
+	net.PacketConn
+	psk *[32]byte
+}
+
+var _ net.PacketConn = (*pskPacketConn)(nil)
+
+func (c *pskPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	buf := pool.Get(packetNonceSize + len(p))
+	defer pool.Put(buf)
+
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(buf)
+		if err != nil {
+			return 0, addr, err
+		}
+		if n < packetNonceSize {
+			// This packet can't have been sent by a member of the private network.
+			continue
+		}
+		n = copy(p, buf[packetNonceSize:n])
+		salsa20.XORKeyStream(p[:n], p[:n], buf[:packetNonceSize], c.psk)
+		return n, addr, nil
+	}
+}
+
+func (c *pskPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	buf := pool.Get(packetNonceSize + len(p))
+	defer pool.Put(buf)
+
+	if _, err := rand.Read(buf[:packetNonceSize]); err != nil {
+		return 0, err
+	}
+	salsa20.XORKeyStream(buf[packetNonceSize:], p, buf[:packetNonceSize], c.psk)
+	if _, err := c.PacketConn.WriteTo(buf, addr); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
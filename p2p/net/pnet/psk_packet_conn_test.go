@@ -0,0 +1,83 @@
+package pnet
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func newProtectedUDPConn(t *testing.T, psk []byte) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	pconn, err := NewProtectedPacketConn(psk, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pconn
+}
+
+func TestPSKPacketConn(t *testing.T) {
+	psk := make([]byte, 32)
+	c1 := newProtectedUDPConn(t, psk)
+	c2 := newProtectedUDPConn(t, psk)
+
+	msg := []byte("hello world")
+	n, err := c1.WriteTo(msg, c2.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(msg) {
+		t.Fatalf("expected to write %d bytes, wrote %d", len(msg), n)
+	}
+
+	buf := make([]byte, 1500)
+	c2.SetReadDeadline(time.Now().Add(time.Second))
+	n, addr, err := c2.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.String() != c1.LocalAddr().String() {
+		t.Fatalf("unexpected sender: %s", addr)
+	}
+	if !bytes.Equal(buf[:n], msg) {
+		t.Fatalf("input and output are not the same")
+	}
+}
+
+func TestPSKPacketConnWrongKey(t *testing.T) {
+	psk1 := make([]byte, 32)
+	psk2 := make([]byte, 32)
+	psk2[0] = 1
+	c1 := newProtectedUDPConn(t, psk1)
+	c2 := newProtectedUDPConn(t, psk2)
+
+	msg := []byte("hello world")
+	if _, err := c1.WriteTo(msg, c2.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 1500)
+	c2.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := c2.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(buf[:n], msg) {
+		t.Fatalf("expected packet to be garbled")
+	}
+}
+
+func TestPSKPacketConnInvalidKey(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := NewProtectedPacketConn(make([]byte, 16), conn); err == nil {
+		t.Fatal("expected an error")
+	}
+}
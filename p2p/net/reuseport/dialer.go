@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
+	"syscall"
 
 	"github.com/libp2p/go-netroute"
 )
@@ -16,6 +17,8 @@ type dialer struct {
 	loopback []*net.TCPAddr
 	// Unspecified addresses (0.0.0.0, ::)
 	unspecified []*net.TCPAddr
+	// control is called on the socket before it is connected. May be nil.
+	control func(ctx context.Context, network, address string, c syscall.RawConn) error
 }
 
 func (d *dialer) Dial(network, addr string) (net.Conn, error) {
@@ -66,7 +69,7 @@ func (d *dialer) DialContext(ctx context.Context, network, addr string) (net.Con
 				if _, _, preferredSrc, err := router.Route(ip); err == nil {
 					for _, optAddr := range d.specific {
 						if optAddr.IP.Equal(preferredSrc) {
-							return reuseDial(ctx, optAddr, network, addr)
+							return reuseDial(ctx, d.control, optAddr, network, addr)
 						}
 					}
 				}
@@ -76,22 +79,22 @@ func (d *dialer) DialContext(ctx context.Context, network, addr string) (net.Con
 		// Otherwise, if we are listening on a loopback address and the destination is also
 		// a loopback address, use the port from our loopback listener.
 		if len(d.loopback) > 0 && ip.IsLoopback() {
-			return reuseDial(ctx, randAddr(d.loopback), network, addr)
+			return reuseDial(ctx, d.control, randAddr(d.loopback), network, addr)
 		}
 	}
 
 	// If we're listening on any uspecified addresses, use a randomly chosen port from one of
 	// these listeners.
 	if len(d.unspecified) > 0 {
-		return reuseDial(ctx, randAddr(d.unspecified), network, addr)
+		return reuseDial(ctx, d.control, randAddr(d.unspecified), network, addr)
 	}
 
 	// Finally, just pick a random port.
-	var dialer net.Dialer
+	dialer := net.Dialer{Control: bindControl(ctx, d.control)}
 	return dialer.DialContext(ctx, network, addr)
 }
 
-func newDialer(listeners map[*listener]struct{}) *dialer {
+func newDialer(listeners map[*listener]struct{}, control func(ctx context.Context, network, address string, c syscall.RawConn) error) *dialer {
 	specific := make([]*net.TCPAddr, 0)
 	loopback := make([]*net.TCPAddr, 0)
 	unspecified := make([]*net.TCPAddr, 0)
@@ -110,5 +113,6 @@ func newDialer(listeners map[*listener]struct{}) *dialer {
 		specific:    specific,
 		loopback:    loopback,
 		unspecified: unspecified,
+		control:     control,
 	}
 }
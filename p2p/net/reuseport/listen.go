@@ -1,7 +1,9 @@
 package reuseport
 
 import (
+	"context"
 	"net"
+	"syscall"
 
 	"github.com/libp2p/go-reuseport"
 	ma "github.com/multiformats/go-multiaddr"
@@ -44,11 +46,11 @@ func (t *Transport) Listen(laddr ma.Multiaddr) (manet.Listener, error) {
 	}
 
 	if !reuseport.Available() {
-		return manet.Listen(laddr)
+		return listen(nw, naddr, t.ListenControl)
 	}
-	nl, err := reuseport.Listen(nw, naddr)
+	nl, err := listenNet(nw, naddr, withReuseport(t.ListenControl))
 	if err != nil {
-		return manet.Listen(laddr)
+		return listen(nw, naddr, t.ListenControl)
 	}
 
 	if _, ok := nl.Addr().(*net.TCPAddr); !ok {
@@ -78,3 +80,30 @@ func (t *Transport) Listen(laddr ma.Multiaddr) (manet.Listener, error) {
 
 	return list, nil
 }
+
+// withReuseport returns a control function enabling reuseport, followed by control (if not nil).
+func withReuseport(control func(network, address string, c syscall.RawConn) error) func(network, address string, c syscall.RawConn) error {
+	if control == nil {
+		return reuseport.Control
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		if err := reuseport.Control(network, address, c); err != nil {
+			return err
+		}
+		return control(network, address, c)
+	}
+}
+
+func listenNet(network, address string, control func(network, address string, c syscall.RawConn) error) (net.Listener, error) {
+	lc := net.ListenConfig{Control: control}
+	return lc.Listen(context.Background(), network, address)
+}
+
+// listen listens without reuseport.
+func listen(network, address string, control func(network, address string, c syscall.RawConn) error) (manet.Listener, error) {
+	nl, err := listenNet(network, address, control)
+	if err != nil {
+		return nil, err
+	}
+	return manet.WrapNetListener(nl)
+}
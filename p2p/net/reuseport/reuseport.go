@@ -3,21 +3,20 @@ package reuseport
 import (
 	"context"
 	"net"
-
-	"github.com/libp2p/go-reuseport"
+	"syscall"
 )
 
-var fallbackDialer net.Dialer
-
 // Dials using reuseport and then redials normally if that fails.
-func reuseDial(ctx context.Context, laddr *net.TCPAddr, network, raddr string) (con net.Conn, err error) {
+// control, if not nil, is called on the socket before it is connected.
+func reuseDial(ctx context.Context, control func(ctx context.Context, network, address string, c syscall.RawConn) error, laddr *net.TCPAddr, network, raddr string) (con net.Conn, err error) {
+	fallbackDialer := net.Dialer{Control: bindControl(ctx, control)}
 	if laddr == nil {
 		return fallbackDialer.DialContext(ctx, network, raddr)
 	}
 
 	d := net.Dialer{
 		LocalAddr: laddr,
-		Control:   reuseport.Control,
+		Control:   withReuseport(bindControl(ctx, control)),
 	}
 
 	con, err = d.DialContext(ctx, network, raddr)
@@ -33,3 +32,13 @@ func reuseDial(ctx context.Context, laddr *net.TCPAddr, network, raddr string) (
 	}
 	return con, err
 }
+
+// bindControl binds a context-aware control function to ctx. It returns nil if control is nil.
+func bindControl(ctx context.Context, control func(ctx context.Context, network, address string, c syscall.RawConn) error) func(network, address string, c syscall.RawConn) error {
+	if control == nil {
+		return nil
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		return control(ctx, network, address, c)
+	}
+}
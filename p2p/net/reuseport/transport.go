@@ -10,8 +10,10 @@
 package reuseport
 
 import (
+	"context"
 	"errors"
 	"sync"
+	"syscall"
 
 	logging "github.com/ipfs/go-log/v2"
 )
@@ -24,6 +26,14 @@ var ErrWrongProto = errors.New("can only dial TCP over IPv4 or IPv6")
 // Transport is a TCP reuse transport that reuses listener ports.
 // The zero value is safe to use.
 type Transport struct {
+	// DialControl, if set, is called on the socket of outgoing connections before it is connected,
+	// e.g. to set socket options. ctx is the context passed to DialContext.
+	// It must be set before the Transport is used.
+	DialControl func(ctx context.Context, network, address string, c syscall.RawConn) error
+	// ListenControl, if set, is called on the socket of listeners before it is bound.
+	// It must be set before the Transport is used.
+	ListenControl func(network, address string, c syscall.RawConn) error
+
 	v4 network
 	v6 network
 }
@@ -0,0 +1,154 @@
+package simnet
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	ic "github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var connCounter atomic.Uint64
+
+// conn is one end of a simulated connection.
+type conn struct {
+	id     uint64
+	net    *peerNetwork
+	remote *conn
+
+	remotePeer   peer.ID
+	remotePubKey ic.PubKey
+	stat         network.ConnStats
+
+	mx      sync.Mutex
+	closed  bool
+	streams map[*stream]struct{}
+}
+
+var _ network.Conn = &conn{}
+
+func newConnPair(dialer, listener *peerNetwork) (*conn, *conn) {
+	now := dialer.sim.clock.Now()
+	out := &conn{
+		id:           connCounter.Add(1),
+		net:          dialer,
+		remotePeer:   listener.peer,
+		remotePubKey: listener.ps.PubKey(listener.peer),
+		stat:         network.ConnStats{Stats: network.Stats{Direction: network.DirOutbound, Opened: now}},
+		streams:      make(map[*stream]struct{}),
+	}
+	in := &conn{
+		id:           connCounter.Add(1),
+		net:          listener,
+		remotePeer:   dialer.peer,
+		remotePubKey: dialer.ps.PubKey(dialer.peer),
+		stat:         network.ConnStats{Stats: network.Stats{Direction: network.DirInbound, Opened: now}},
+		streams:      make(map[*stream]struct{}),
+	}
+	out.remote = in
+	in.remote = out
+	return out, in
+}
+
+func (c *conn) ID() string                    { return strconv.FormatUint(c.id, 10) }
+func (c *conn) LocalPeer() peer.ID            { return c.net.peer }
+func (c *conn) RemotePeer() peer.ID           { return c.remotePeer }
+func (c *conn) RemotePublicKey() ic.PubKey    { return c.remotePubKey }
+func (c *conn) LocalMultiaddr() ma.Multiaddr  { return c.net.addr }
+func (c *conn) RemoteMultiaddr() ma.Multiaddr { return c.remote.net.addr }
+func (c *conn) Scope() network.ConnScope      { return &network.NullScope{} }
+func (c *conn) ConnState() network.ConnectionState {
+	return network.ConnectionState{Transport: "simnet"}
+}
+
+func (c *conn) Stat() network.ConnStats {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	stat := c.stat
+	stat.NumStreams = len(c.streams)
+	return stat
+}
+
+func (c *conn) IsClosed() bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.closed
+}
+
+func (c *conn) NewStream(ctx context.Context) (network.Stream, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	out, in := newStreamPair(c, c.remote)
+	if !c.addStream(out) {
+		return nil, network.ErrReset
+	}
+	if !c.remote.addStream(in) {
+		c.removeStream(out)
+		return nil, network.ErrReset
+	}
+	handler := c.remote.net.streamHandler()
+	if handler == nil {
+		out.Reset()
+		return nil, network.ErrReset
+	}
+	go handler(in)
+	return out, nil
+}
+
+func (c *conn) addStream(s *stream) bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if c.closed {
+		return false
+	}
+	c.streams[s] = struct{}{}
+	return true
+}
+
+func (c *conn) removeStream(s *stream) {
+	c.mx.Lock()
+	delete(c.streams, s)
+	c.mx.Unlock()
+}
+
+func (c *conn) GetStreams() []network.Stream {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	streams := make([]network.Stream, 0, len(c.streams))
+	for s := range c.streams {
+		streams = append(streams, s)
+	}
+	return streams
+}
+
+// Close closes both ends of the connection, resetting all streams.
+func (c *conn) Close() error {
+	c.close()
+	c.remote.close()
+	return nil
+}
+
+func (c *conn) close() {
+	c.mx.Lock()
+	if c.closed {
+		c.mx.Unlock()
+		return
+	}
+	c.closed = true
+	streams := c.streams
+	c.streams = nil
+	c.mx.Unlock()
+
+	for s := range streams {
+		s.reset()
+	}
+	if c.net.removeConn(c) {
+		c.net.notifyAll(func(f network.Notifiee) { f.Disconnected(c.net, c) })
+	}
+}
@@ -0,0 +1,238 @@
+package simnet
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var errClosed = errors.New("simnet: network closed")
+
+// peerNetwork is the network.Network of a simulated host.
+type peerNetwork struct {
+	sim  *SimNet
+	peer peer.ID
+	addr ma.Multiaddr
+	ps   peerstore.Peerstore
+
+	mx        sync.RWMutex
+	closed    bool
+	conns     map[peer.ID][]*conn
+	handler   network.StreamHandler
+	notifiees map[network.Notifiee]struct{}
+}
+
+var _ network.Network = &peerNetwork{}
+
+func newPeerNetwork(sim *SimNet, p peer.ID, addr ma.Multiaddr, ps peerstore.Peerstore) *peerNetwork {
+	return &peerNetwork{
+		sim:       sim,
+		peer:      p,
+		addr:      addr,
+		ps:        ps,
+		conns:     make(map[peer.ID][]*conn),
+		notifiees: make(map[network.Notifiee]struct{}),
+	}
+}
+
+func (n *peerNetwork) Peerstore() peerstore.Peerstore { return n.ps }
+func (n *peerNetwork) LocalPeer() peer.ID             { return n.peer }
+
+func (n *peerNetwork) DialPeer(ctx context.Context, p peer.ID) (network.Conn, error) {
+	if c := n.bestConn(p); c != nil {
+		return c, nil
+	}
+	if p == n.peer {
+		return nil, errors.New("simnet: dial to self attempted")
+	}
+	remote := n.sim.network(p)
+	if remote == nil {
+		return nil, ErrUnknownPeer
+	}
+	// establishing the connection takes one round trip
+	if err := n.sim.sleep(ctx, 2*n.sim.latency); err != nil {
+		return nil, err
+	}
+
+	local, rem := newConnPair(n, remote)
+	if !n.addConn(local) {
+		return nil, errClosed
+	}
+	if !remote.addConn(rem) {
+		n.removeConn(local)
+		return nil, ErrUnknownPeer
+	}
+	remote.notifyAll(func(f network.Notifiee) { f.Connected(remote, rem) })
+	n.notifyAll(func(f network.Notifiee) { f.Connected(n, local) })
+	return local, nil
+}
+
+func (n *peerNetwork) bestConn(p peer.ID) *conn {
+	n.mx.RLock()
+	defer n.mx.RUnlock()
+	if cs := n.conns[p]; len(cs) > 0 {
+		return cs[0]
+	}
+	return nil
+}
+
+func (n *peerNetwork) addConn(c *conn) bool {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	if n.closed {
+		return false
+	}
+	n.conns[c.remotePeer] = append(n.conns[c.remotePeer], c)
+	return true
+}
+
+// removeConn removes c, and returns if it was present.
+func (n *peerNetwork) removeConn(c *conn) bool {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+	cs := n.conns[c.remotePeer]
+	for i, other := range cs {
+		if other == c {
+			cs[i] = cs[len(cs)-1]
+			cs = cs[:len(cs)-1]
+			if len(cs) == 0 {
+				delete(n.conns, c.remotePeer)
+			} else {
+				n.conns[c.remotePeer] = cs
+			}
+			return true
+		}
+	}
+	return false
+}
+
+func (n *peerNetwork) ClosePeer(p peer.ID) error {
+	for _, c := range n.ConnsToPeer(p) {
+		c.Close()
+	}
+	return nil
+}
+
+func (n *peerNetwork) Connectedness(p peer.ID) network.Connectedness {
+	n.mx.RLock()
+	defer n.mx.RUnlock()
+	if len(n.conns[p]) > 0 {
+		return network.Connected
+	}
+	return network.NotConnected
+}
+
+func (n *peerNetwork) Peers() []peer.ID {
+	n.mx.RLock()
+	defer n.mx.RUnlock()
+	peers := make([]peer.ID, 0, len(n.conns))
+	for p := range n.conns {
+		peers = append(peers, p)
+	}
+	return peers
+}
+
+func (n *peerNetwork) Conns() []network.Conn {
+	n.mx.RLock()
+	defer n.mx.RUnlock()
+	conns := make([]network.Conn, 0, len(n.conns))
+	for _, cs := range n.conns {
+		for _, c := range cs {
+			conns = append(conns, c)
+		}
+	}
+	return conns
+}
+
+func (n *peerNetwork) ConnsToPeer(p peer.ID) []network.Conn {
+	n.mx.RLock()
+	defer n.mx.RUnlock()
+	conns := make([]network.Conn, 0, len(n.conns[p]))
+	for _, c := range n.conns[p] {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+func (n *peerNetwork) Notify(f network.Notifiee) {
+	n.mx.Lock()
+	n.notifiees[f] = struct{}{}
+	n.mx.Unlock()
+}
+
+func (n *peerNetwork) StopNotify(f network.Notifiee) {
+	n.mx.Lock()
+	delete(n.notifiees, f)
+	n.mx.Unlock()
+}
+
+func (n *peerNetwork) notifyAll(notify func(network.Notifiee)) {
+	n.mx.RLock()
+	notifiees := make([]network.Notifiee, 0, len(n.notifiees))
+	for f := range n.notifiees {
+		notifiees = append(notifiees, f)
+	}
+	n.mx.RUnlock()
+	for _, f := range notifiees {
+		notify(f)
+	}
+}
+
+func (n *peerNetwork) SetStreamHandler(h network.StreamHandler) {
+	n.mx.Lock()
+	n.handler = h
+	n.mx.Unlock()
+}
+
+func (n *peerNetwork) streamHandler() network.StreamHandler {
+	n.mx.RLock()
+	defer n.mx.RUnlock()
+	return n.handler
+}
+
+func (n *peerNetwork) NewStream(ctx context.Context, p peer.ID) (network.Stream, error) {
+	c, err := n.DialPeer(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewStream(ctx)
+}
+
+// Listen is a no-op. Every host is reachable on its simulated address.
+func (n *peerNetwork) Listen(...ma.Multiaddr) error { return nil }
+
+func (n *peerNetwork) ListenAddresses() []ma.Multiaddr { return []ma.Multiaddr{n.addr} }
+
+func (n *peerNetwork) InterfaceListenAddresses() ([]ma.Multiaddr, error) {
+	return []ma.Multiaddr{n.addr}, nil
+}
+
+func (n *peerNetwork) ListenStatus() []network.ListenerStatus {
+	return []network.ListenerStatus{{Addr: n.addr, ListenAddr: n.addr, State: network.ListenerActive}}
+}
+
+func (n *peerNetwork) ResourceManager() network.ResourceManager {
+	return &network.NullResourceManager{}
+}
+
+func (n *peerNetwork) Close() error {
+	n.mx.Lock()
+	if n.closed {
+		n.mx.Unlock()
+		return nil
+	}
+	n.closed = true
+	n.mx.Unlock()
+
+	n.sim.removeNetwork(n)
+	for _, c := range n.Conns() {
+		c.Close()
+	}
+	return n.ps.Close()
+}
@@ -0,0 +1,285 @@
+// Package simnet simulates networks of thousands of lightweight hosts in a single process.
+//
+// Compared to mocknet, simnet is optimized for scale:
+//   - Hosts are blank hosts (see the blankhost package): they don't run identify or any other service.
+//   - Connections and streams are in-memory pipes. They don't spawn any goroutines, and buffer written
+//     data in pooled buffers shared by all hosts.
+//   - Latency is simulated using a clock, which can be a mock clock to run simulations in virtual time.
+//   - Hosts are created, and operations on all hosts are run, in batches using a bounded number of goroutines.
+//
+// Every host is reachable from every other host: there are no links to set up.
+package simnet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	blankhost "github.com/libp2p/go-libp2p/p2p/host/blank"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
+
+	"github.com/benbjohnson/clock"
+	logging "github.com/ipfs/go-log/v2"
+	ma "github.com/multiformats/go-multiaddr"
+	"golang.org/x/sync/errgroup"
+)
+
+var log = logging.Logger("simnet")
+
+// ErrUnknownPeer is returned when dialing a peer that isn't part of the simulation, or was closed.
+var ErrUnknownPeer = errors.New("simnet: unknown peer")
+
+// Option is an option for New.
+type Option func(*SimNet) error
+
+// WithClock sets the clock used to simulate latency and to evaluate deadlines.
+// Use a mock clock to run the simulation in virtual time. Note that when using a mock clock,
+// data written to streams only arrives once the clock was advanced by the latency.
+func WithClock(cl clock.Clock) Option {
+	return func(s *SimNet) error {
+		s.clock = cl
+		return nil
+	}
+}
+
+// WithLatency sets the one-way latency between any two hosts.
+// Dialing a connection takes one round trip, data written to a stream arrives after the latency.
+func WithLatency(latency time.Duration) Option {
+	return func(s *SimNet) error {
+		if latency < 0 {
+			return errors.New("latency must not be negative")
+		}
+		s.latency = latency
+		return nil
+	}
+}
+
+// WithConcurrency sets the number of goroutines used by AddHosts and ForEach.
+// The default is 64.
+func WithConcurrency(n int) Option {
+	return func(s *SimNet) error {
+		if n <= 0 {
+			return errors.New("concurrency must be positive")
+		}
+		s.concurrency = n
+		return nil
+	}
+}
+
+// WithStreamWindow sets the number of bytes that can be written to a stream before
+// the writer blocks until the data is read. The default is 256 KiB.
+func WithStreamWindow(n int) Option {
+	return func(s *SimNet) error {
+		if n <= 0 {
+			return errors.New("stream window must be positive")
+		}
+		s.streamWindow = n
+		return nil
+	}
+}
+
+// WithSeed makes the peer IDs of the hosts deterministic.
+func WithSeed(seed int64) Option {
+	return func(s *SimNet) error {
+		s.rand = rand.New(rand.NewSource(seed))
+		return nil
+	}
+}
+
+// SimNet is a simulated network.
+type SimNet struct {
+	clock        clock.Clock
+	latency      time.Duration
+	concurrency  int
+	streamWindow int
+
+	randMx sync.Mutex
+	rand   io.Reader // nil means crypto/rand
+
+	mx       sync.RWMutex
+	nets     map[peer.ID]*peerNetwork
+	hosts    []host.Host
+	nextAddr uint32
+}
+
+// New creates a new simulated network.
+func New(opts ...Option) (*SimNet, error) {
+	s := &SimNet{
+		clock:        clock.New(),
+		concurrency:  64,
+		streamWindow: 256 << 10,
+		nets:         make(map[peer.ID]*peerNetwork),
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// AddHosts adds n hosts to the simulation, and returns them.
+func (s *SimNet) AddHosts(n int) ([]host.Host, error) {
+	keys := make([]crypto.PrivKey, n)
+	// Keys are generated sequentially, so that the peer IDs are deterministic if a seed was set.
+	for i := range keys {
+		k, err := s.generateKey()
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = k
+	}
+
+	hosts := make([]host.Host, n)
+	var g errgroup.Group
+	g.SetLimit(s.concurrency)
+	for i := range keys {
+		i := i
+		g.Go(func() error {
+			h, err := s.newHost(keys[i])
+			if err != nil {
+				return err
+			}
+			hosts[i] = h
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		for _, h := range hosts {
+			if h != nil {
+				h.Close()
+			}
+		}
+		return nil, err
+	}
+
+	s.mx.Lock()
+	s.hosts = append(s.hosts, hosts...)
+	s.mx.Unlock()
+	return hosts, nil
+}
+
+func (s *SimNet) generateKey() (crypto.PrivKey, error) {
+	if s.rand == nil {
+		k, _, err := crypto.GenerateEd25519Key(nil)
+		return k, err
+	}
+	s.randMx.Lock()
+	defer s.randMx.Unlock()
+	k, _, err := crypto.GenerateEd25519Key(s.rand)
+	return k, err
+}
+
+func (s *SimNet) newHost(k crypto.PrivKey) (host.Host, error) {
+	id, err := peer.IDFromPrivateKey(k)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := pstoremem.NewPeerstore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ps.AddPrivKey(id, k); err != nil {
+		ps.Close()
+		return nil, err
+	}
+	if err := ps.AddPubKey(id, k.GetPublic()); err != nil {
+		ps.Close()
+		return nil, err
+	}
+
+	s.mx.Lock()
+	addr := s.allocAddr()
+	n := newPeerNetwork(s, id, addr, ps)
+	s.nets[id] = n
+	s.mx.Unlock()
+
+	h := blankhost.NewBlankHost(n)
+	if h == nil {
+		n.Close()
+		return nil, fmt.Errorf("failed to create host %s", id)
+	}
+	return h, nil
+}
+
+// allocAddr allocates an IPv4 address in 10.0.0.0/8. It must be called with mx held.
+func (s *SimNet) allocAddr() ma.Multiaddr {
+	s.nextAddr++
+	i := s.nextAddr
+	return ma.StringCast(fmt.Sprintf("/ip4/10.%d.%d.%d/tcp/4001", byte(i>>16), byte(i>>8), byte(i)))
+}
+
+// Hosts returns all hosts of the simulation, in the order they were added.
+func (s *SimNet) Hosts() []host.Host {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	return append([]host.Host(nil), s.hosts...)
+}
+
+// ForEach runs f for all hosts, using a bounded number of goroutines.
+// It returns the first error returned by f, and cancels the context passed to f.
+func (s *SimNet) ForEach(ctx context.Context, f func(context.Context, host.Host) error) error {
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(s.concurrency)
+	for _, h := range s.Hosts() {
+		h := h
+		g.Go(func() error { return f(ctx, h) })
+	}
+	return g.Wait()
+}
+
+// AddrInfo returns the AddrInfo of the host with the given peer ID.
+func (s *SimNet) AddrInfo(p peer.ID) (peer.AddrInfo, bool) {
+	n := s.network(p)
+	if n == nil {
+		return peer.AddrInfo{}, false
+	}
+	return peer.AddrInfo{ID: p, Addrs: []ma.Multiaddr{n.addr}}, true
+}
+
+// network returns the network of the host with the given peer ID, or nil if there is no such host.
+func (s *SimNet) network(p peer.ID) *peerNetwork {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	return s.nets[p]
+}
+
+func (s *SimNet) removeNetwork(n *peerNetwork) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.nets[n.peer] == n {
+		delete(s.nets, n.peer)
+	}
+}
+
+// sleep waits for d on the simulation's clock, or until the context is canceled.
+func (s *SimNet) sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := s.clock.Timer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close closes all hosts.
+func (s *SimNet) Close() error {
+	return s.ForEach(context.Background(), func(_ context.Context, h host.Host) error {
+		if err := h.Close(); err != nil {
+			log.Debugw("failed to close host", "peer", h.ID(), "error", err)
+		}
+		return nil
+	})
+}
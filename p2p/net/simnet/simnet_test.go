@@ -0,0 +1,167 @@
+package simnet
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/require"
+)
+
+const echoProto = "/test/echo"
+
+func echo(s network.Stream) {
+	defer s.Close()
+	io.Copy(s, s)
+}
+
+func TestThousandHosts(t *testing.T) {
+	sim, err := New()
+	require.NoError(t, err)
+	defer sim.Close()
+
+	hosts, err := sim.AddHosts(1000)
+	require.NoError(t, err)
+	require.Len(t, hosts, 1000)
+	for _, h := range hosts {
+		h.SetStreamHandler(echoProto, echo)
+	}
+
+	next := make(map[host.Host]host.Host, len(hosts))
+	for i, h := range hosts {
+		next[h] = hosts[(i+1)%len(hosts)]
+	}
+	require.NoError(t, sim.ForEach(context.Background(), func(ctx context.Context, h host.Host) error {
+		other := next[h]
+		ai, ok := sim.AddrInfo(other.ID())
+		if !ok {
+			return fmt.Errorf("missing addr info for %s", other.ID())
+		}
+		if err := h.Connect(ctx, ai); err != nil {
+			return err
+		}
+		str, err := h.NewStream(ctx, other.ID(), echoProto)
+		if err != nil {
+			return err
+		}
+		msg := []byte("hello from " + h.ID().String())
+		if _, err := str.Write(msg); err != nil {
+			return err
+		}
+		if err := str.CloseWrite(); err != nil {
+			return err
+		}
+		resp, err := io.ReadAll(str)
+		if err != nil {
+			return err
+		}
+		if string(resp) != string(msg) {
+			return fmt.Errorf("unexpected response: %q", resp)
+		}
+		return str.Close()
+	}))
+
+	for _, h := range hosts {
+		require.Equal(t, network.Connected, h.Network().Connectedness(next[h].ID()))
+	}
+}
+
+func TestLatency(t *testing.T) {
+	cl := clock.NewMock()
+	sim, err := New(WithClock(cl), WithLatency(50*time.Millisecond))
+	require.NoError(t, err)
+	defer sim.Close()
+
+	hosts, err := sim.AddHosts(2)
+	require.NoError(t, err)
+	received := make(chan []byte, 1)
+	// Set the handler on the network, since protocol negotiation would require advancing the clock.
+	hosts[1].Network().SetStreamHandler(func(s network.Stream) {
+		defer s.Close()
+		b, _ := io.ReadAll(s)
+		received <- b
+	})
+
+	ai, ok := sim.AddrInfo(hosts[1].ID())
+	require.True(t, ok)
+	connected := make(chan error, 1)
+	go func() { connected <- hosts[0].Connect(context.Background(), ai) }()
+	// dialing takes a full round trip
+	time.Sleep(50 * time.Millisecond) // give the dial a chance to start waiting on the clock
+	cl.Add(99 * time.Millisecond)
+	select {
+	case <-connected:
+		t.Fatal("connected too early")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cl.Add(time.Millisecond)
+	require.NoError(t, <-connected)
+
+	str, err := hosts[0].Network().NewStream(context.Background(), hosts[1].ID())
+	require.NoError(t, err)
+	_, err = str.Write([]byte("foobar"))
+	require.NoError(t, err)
+	require.NoError(t, str.CloseWrite())
+
+	select {
+	case <-received:
+		t.Fatal("data arrived before the latency passed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	cl.Add(50 * time.Millisecond)
+	select {
+	case b := <-received:
+		require.Equal(t, "foobar", string(b))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestDialUnknownPeer(t *testing.T) {
+	sim, err := New()
+	require.NoError(t, err)
+	defer sim.Close()
+
+	hosts, err := sim.AddHosts(2)
+	require.NoError(t, err)
+	require.NoError(t, hosts[1].Close())
+
+	_, err = hosts[0].Network().DialPeer(context.Background(), hosts[1].ID())
+	require.ErrorIs(t, err, ErrUnknownPeer)
+	_, ok := sim.AddrInfo(hosts[1].ID())
+	require.False(t, ok)
+}
+
+func TestCloseResetsStreams(t *testing.T) {
+	sim, err := New(WithStreamWindow(4))
+	require.NoError(t, err)
+	defer sim.Close()
+
+	hosts, err := sim.AddHosts(2)
+	require.NoError(t, err)
+	// never read, so that the writer blocks once the window is full
+	hosts[1].SetStreamHandler(echoProto, func(network.Stream) {})
+
+	str, err := hosts[0].NewStream(context.Background(), hosts[1].ID(), echoProto)
+	require.NoError(t, err)
+	writeErr := make(chan error, 1)
+	go func() {
+		_, err := str.Write([]byte("more than four bytes"))
+		writeErr <- err
+	}()
+	select {
+	case <-writeErr:
+		t.Fatal("write should have blocked")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, hosts[1].Close())
+	require.ErrorIs(t, <-writeErr, network.ErrReset)
+	require.Empty(t, hosts[0].Network().Conns())
+}
@@ -0,0 +1,335 @@
+package simnet
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/protocol"
+
+	"github.com/benbjohnson/clock"
+	pool "github.com/libp2p/go-buffer-pool"
+)
+
+var (
+	errWriteClosed = errors.New("simnet: stream closed for writing")
+	errReadClosed  = errors.New("simnet: stream closed for reading")
+)
+
+var streamCounter atomic.Uint64
+
+// chunk is a write that was not yet read completely.
+type chunk struct {
+	buf     []byte // the pooled buffer
+	data    []byte // the unread part of buf
+	arrival time.Time
+}
+
+// pipe is a unidirectional in-memory byte stream. Written data is copied into pooled buffers,
+// and becomes readable once the latency has passed. pipes don't spawn any goroutines.
+type pipe struct {
+	clock   clock.Clock
+	latency time.Duration
+	window  int
+
+	mx            sync.Mutex
+	chunks        []chunk
+	buffered      int
+	writeClosed   bool
+	readClosed    bool
+	err           error
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	readSignal  chan struct{}
+	writeSignal chan struct{}
+}
+
+func newPipe(s *SimNet) *pipe {
+	return &pipe{
+		clock:       s.clock,
+		latency:     s.latency,
+		window:      s.streamWindow,
+		readSignal:  make(chan struct{}, 1),
+		writeSignal: make(chan struct{}, 1),
+	}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// wait waits until signal fires, wait has passed (if non-zero), or the deadline expires.
+func (p *pipe) wait(signal chan struct{}, deadline time.Time, wait time.Duration) error {
+	if !deadline.IsZero() {
+		d := deadline.Sub(p.clock.Now())
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		if wait == 0 || d < wait {
+			wait = d
+		}
+	}
+	if wait == 0 {
+		<-signal
+		return nil
+	}
+	t := p.clock.Timer(wait)
+	defer t.Stop()
+	select {
+	case <-signal:
+	case <-t.C:
+	}
+	return nil
+}
+
+func (p *pipe) read(b []byte) (int, error) {
+	for {
+		p.mx.Lock()
+		if p.err != nil {
+			p.mx.Unlock()
+			return 0, p.err
+		}
+		if p.readClosed {
+			p.mx.Unlock()
+			return 0, errReadClosed
+		}
+		var wait time.Duration
+		if len(p.chunks) > 0 {
+			c := &p.chunks[0]
+			if wait = c.arrival.Sub(p.clock.Now()); wait <= 0 {
+				n := copy(b, c.data)
+				c.data = c.data[n:]
+				p.buffered -= n
+				if len(c.data) == 0 {
+					pool.Put(c.buf)
+					p.chunks[0] = chunk{}
+					p.chunks = p.chunks[1:]
+				}
+				p.mx.Unlock()
+				signal(p.writeSignal)
+				return n, nil
+			}
+		} else if p.writeClosed {
+			p.mx.Unlock()
+			return 0, io.EOF
+		}
+		deadline := p.readDeadline
+		p.mx.Unlock()
+
+		if err := p.wait(p.readSignal, deadline, wait); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (p *pipe) write(b []byte) (int, error) {
+	var written int
+	for written < len(b) {
+		p.mx.Lock()
+		switch {
+		case p.err != nil:
+			p.mx.Unlock()
+			return written, p.err
+		case p.writeClosed:
+			p.mx.Unlock()
+			return written, errWriteClosed
+		case p.readClosed:
+			p.mx.Unlock()
+			return written, network.ErrReset
+		}
+		if space := p.window - p.buffered; space > 0 {
+			n := len(b) - written
+			if n > space {
+				n = space
+			}
+			buf := pool.Get(n)
+			copy(buf, b[written:written+n])
+			p.chunks = append(p.chunks, chunk{buf: buf, data: buf, arrival: p.clock.Now().Add(p.latency)})
+			p.buffered += n
+			written += n
+			p.mx.Unlock()
+			signal(p.readSignal)
+			continue
+		}
+		deadline := p.writeDeadline
+		p.mx.Unlock()
+
+		if err := p.wait(p.writeSignal, deadline, 0); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// release returns all buffered data to the pool. It must be called with mx held.
+func (p *pipe) release() {
+	for _, c := range p.chunks {
+		pool.Put(c.buf)
+	}
+	p.chunks = nil
+	p.buffered = 0
+}
+
+func (p *pipe) closeWrite() {
+	p.mx.Lock()
+	p.writeClosed = true
+	p.mx.Unlock()
+	signal(p.readSignal)
+}
+
+func (p *pipe) closeRead() {
+	p.mx.Lock()
+	p.readClosed = true
+	p.release()
+	p.mx.Unlock()
+	signal(p.writeSignal)
+}
+
+func (p *pipe) reset() {
+	p.mx.Lock()
+	if p.err == nil {
+		p.err = network.ErrReset
+	}
+	p.release()
+	p.mx.Unlock()
+	signal(p.readSignal)
+	signal(p.writeSignal)
+}
+
+func (p *pipe) setReadDeadline(t time.Time) {
+	p.mx.Lock()
+	p.readDeadline = t
+	p.mx.Unlock()
+	signal(p.readSignal)
+}
+
+func (p *pipe) setWriteDeadline(t time.Time) {
+	p.mx.Lock()
+	p.writeDeadline = t
+	p.mx.Unlock()
+	signal(p.writeSignal)
+}
+
+// stream is one end of a simulated stream. It reads from in, and writes to out.
+type stream struct {
+	id   uint64
+	conn *conn
+	in   *pipe
+	out  *pipe
+	stat network.Stats
+
+	protocol atomic.Pointer[protocol.ID]
+
+	mx          sync.Mutex
+	readClosed  bool
+	writeClosed bool
+}
+
+var _ network.Stream = &stream{}
+
+func newStreamPair(out, in *conn) (*stream, *stream) {
+	a, b := newPipe(out.net.sim), newPipe(out.net.sim)
+	now := out.net.sim.clock.Now()
+	return &stream{
+		id:   streamCounter.Add(1),
+		conn: out,
+		in:   a,
+		out:  b,
+		stat: network.Stats{Direction: network.DirOutbound, Opened: now},
+	}, &stream{
+		id:   streamCounter.Add(1),
+		conn: in,
+		in:   b,
+		out:  a,
+		stat: network.Stats{Direction: network.DirInbound, Opened: now},
+	}
+}
+
+func (s *stream) ID() string                  { return strconv.FormatUint(s.id, 10) }
+func (s *stream) Conn() network.Conn          { return s.conn }
+func (s *stream) Stat() network.Stats         { return s.stat }
+func (s *stream) Scope() network.StreamScope  { return &network.NullScope{} }
+func (s *stream) Read(b []byte) (int, error)  { return s.in.read(b) }
+func (s *stream) Write(b []byte) (int, error) { return s.out.write(b) }
+
+func (s *stream) Protocol() protocol.ID {
+	p := s.protocol.Load()
+	if p == nil {
+		return ""
+	}
+	return *p
+}
+
+func (s *stream) SetProtocol(p protocol.ID) error {
+	s.protocol.Store(&p)
+	return nil
+}
+
+func (s *stream) CloseWrite() error {
+	s.out.closeWrite()
+	s.closed(false, true)
+	return nil
+}
+
+func (s *stream) CloseRead() error {
+	s.in.closeRead()
+	s.closed(true, false)
+	return nil
+}
+
+func (s *stream) Close() error {
+	s.out.closeWrite()
+	s.in.closeRead()
+	s.closed(true, true)
+	return nil
+}
+
+// closed records that the stream was closed for reading and / or writing, and
+// removes it from the connection once it is closed in both directions.
+func (s *stream) closed(read, write bool) {
+	s.mx.Lock()
+	s.readClosed = s.readClosed || read
+	s.writeClosed = s.writeClosed || write
+	done := s.readClosed && s.writeClosed
+	s.mx.Unlock()
+	if done {
+		s.conn.removeStream(s)
+	}
+}
+
+func (s *stream) Reset() error {
+	s.reset()
+	s.conn.removeStream(s)
+	return nil
+}
+
+// reset resets both directions of the stream, on both ends.
+func (s *stream) reset() {
+	s.in.reset()
+	s.out.reset()
+}
+
+func (s *stream) SetDeadline(t time.Time) error {
+	s.in.setReadDeadline(t)
+	s.out.setWriteDeadline(t)
+	return nil
+}
+
+func (s *stream) SetReadDeadline(t time.Time) error {
+	s.in.setReadDeadline(t)
+	return nil
+}
+
+func (s *stream) SetWriteDeadline(t time.Time) error {
+	s.out.setWriteDeadline(t)
+	return nil
+}
@@ -0,0 +1,177 @@
+package swarm
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// defaultConnDrainGracePeriod is the maximum time a connection selected for rotation
+// is kept open to let its streams finish.
+const defaultConnDrainGracePeriod = time.Minute
+
+// maxConnRotationInterval is the maximum interval between two checks for connections
+// that need to be rotated.
+const maxConnRotationInterval = time.Minute
+
+type connRotationConfig struct {
+	// maxAge is the maximum age of a connection. 0 disables connection rotation.
+	maxAge time.Duration
+	// jitter is the maximum random duration subtracted from maxAge for every connection,
+	// so that connections established at the same time aren't all rotated at once.
+	jitter time.Duration
+	// drainGracePeriod is the maximum time we wait for the streams on a rotated
+	// connection to finish before closing it.
+	drainGracePeriod time.Duration
+}
+
+func (c connRotationConfig) enabled() bool {
+	return c.maxAge > 0
+}
+
+func (c connRotationConfig) checkInterval() time.Duration {
+	interval := c.maxAge / 20
+	if interval > maxConnRotationInterval {
+		interval = maxConnRotationInterval
+	}
+	return interval
+}
+
+// rotationTime returns the time at which a connection opened at opened should be rotated.
+func (c connRotationConfig) rotationTime(opened time.Time) time.Time {
+	age := c.maxAge
+	if c.jitter > 0 {
+		age -= time.Duration(rand.Int63n(int64(c.jitter)))
+	}
+	return opened.Add(age)
+}
+
+// WithMaxConnectionAge configures the swarm to gracefully rotate connections older than maxAge.
+// This is useful when the swarm is deployed behind load balancers, and to force a rekey on
+// transports that don't support rekeying.
+//
+// To avoid rotating many connections at the same time, the maximum age of every connection
+// is reduced by a random duration of up to jitter.
+// A connection selected for rotation isn't used for new streams anymore, unless it's the only
+// connection to the peer. If we initiated the connection, a replacement connection is dialed.
+// The old connection is closed once all its streams are done and another connection to the
+// peer exists, or after the drain grace period (see WithConnectionDrainGracePeriod).
+// Inbound connections can't be replaced by us: unless the peer opens a new connection, they
+// are closed after the drain grace period, disconnecting the peer.
+// Transient (relayed) connections are never rotated.
+func WithMaxConnectionAge(maxAge, jitter time.Duration) Option {
+	return func(s *Swarm) error {
+		if maxAge <= 0 {
+			return errors.New("swarm: max connection age must be positive")
+		}
+		if jitter < 0 || jitter >= maxAge {
+			return errors.New("swarm: max connection age jitter must be non-negative and smaller than the max age")
+		}
+		s.connRotation.maxAge = maxAge
+		s.connRotation.jitter = jitter
+		return nil
+	}
+}
+
+// WithConnectionDrainGracePeriod sets the maximum time a connection selected for rotation
+// is kept open to allow its streams to finish. Defaults to 1 minute.
+func WithConnectionDrainGracePeriod(d time.Duration) Option {
+	return func(s *Swarm) error {
+		if d <= 0 {
+			return errors.New("swarm: connection drain grace period must be positive")
+		}
+		s.connRotation.drainGracePeriod = d
+		return nil
+	}
+}
+
+// connRotationLoop periodically rotates connections that exceeded their maximum age.
+//
+// The caller must take a swarm ref before calling. This function decrements the
+// swarm ref count.
+func (s *Swarm) connRotationLoop() {
+	defer s.refs.Done()
+
+	ticker := time.NewTicker(s.connRotation.checkInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.rotateConns(now)
+		}
+	}
+}
+
+func (s *Swarm) rotateConns(now time.Time) {
+	var toRotate, toClose []*Conn
+
+	s.conns.RLock()
+	for _, cs := range s.conns.m {
+		hasFresh := false
+		for _, c := range cs {
+			if !c.draining.Load() && !c.conn.IsClosed() {
+				hasFresh = true
+				break
+			}
+		}
+		for _, c := range cs {
+			if c.draining.Load() {
+				// Close the connection once it's drained, if the peer is reachable over
+				// another connection. We can't redial inbound connections, so for these
+				// we wait for the peer to open a new connection, or for the grace period.
+				drained := c.numStreams() == 0 && hasFresh
+				if drained || now.Sub(c.drainStart) >= s.connRotation.drainGracePeriod {
+					toClose = append(toClose, c)
+				}
+				continue
+			}
+			if !c.rotateAt.IsZero() && !now.Before(c.rotateAt) {
+				toRotate = append(toRotate, c)
+			}
+		}
+	}
+	s.conns.RUnlock()
+
+	for _, c := range toClose {
+		log.Debugw("closing rotated connection", "peer", c.RemotePeer(), "conn", c.ID())
+		c.Close()
+	}
+	for _, c := range toRotate {
+		s.rotateConn(c, now)
+	}
+}
+
+type connReplacementDialKey struct{}
+
+// withConnReplacementDial marks the dial as dialing a replacement for a rotated connection.
+// Rotated connections are not used to satisfy such dials.
+func withConnReplacementDial(ctx context.Context) context.Context {
+	return context.WithValue(ctx, connReplacementDialKey{}, struct{}{})
+}
+
+func isConnReplacementDial(ctx context.Context) bool {
+	return ctx.Value(connReplacementDialKey{}) != nil
+}
+
+// rotateConn marks c as draining and, if we initiated the connection, dials a replacement.
+func (s *Swarm) rotateConn(c *Conn, now time.Time) {
+	log.Debugw("rotating connection", "peer", c.RemotePeer(), "conn", c.ID(), "age", now.Sub(c.Stat().Opened))
+	c.drainStart = now
+	c.draining.Store(true)
+
+	if c.Stat().Direction != network.DirOutbound {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(withConnReplacementDial(s.ctx), s.dialTimeout)
+		defer cancel()
+		if _, err := s.dialPeer(ctx, c.RemotePeer()); err != nil {
+			log.Debugw("failed to dial replacement for rotated connection", "peer", c.RemotePeer(), "error", err)
+		}
+	}()
+}
@@ -0,0 +1,121 @@
+package swarm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	. "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxConnectionAgeOptions(t *testing.T) {
+	for _, opt := range []swarm.Option{
+		swarm.WithMaxConnectionAge(0, 0),
+		swarm.WithMaxConnectionAge(time.Hour, -time.Second),
+		swarm.WithMaxConnectionAge(time.Hour, time.Hour),
+		swarm.WithConnectionDrainGracePeriod(0),
+	} {
+		_, err := swarm.NewSwarm("", nil, eventbus.NewBus(), opt)
+		require.Error(t, err)
+	}
+}
+
+func TestConnectionRotation(t *testing.T) {
+	s1 := GenSwarm(t, OptDisableQUIC, WithSwarmOpts(
+		swarm.WithMaxConnectionAge(200*time.Millisecond, 50*time.Millisecond),
+		swarm.WithConnectionDrainGracePeriod(10*time.Second),
+	))
+	s2 := GenSwarm(t, OptDisableQUIC)
+	defer s1.Close()
+	defer s2.Close()
+	s2.SetStreamHandler(func(str network.Stream) { str.Close() })
+
+	s1.Peerstore().AddAddrs(s2.LocalPeer(), s2.ListenAddresses(), peerstore.PermanentAddrTTL)
+	c, err := s1.DialPeer(context.Background(), s2.LocalPeer())
+	require.NoError(t, err)
+
+	// Keep a stream open on the connection. The connection must not be closed before the
+	// replacement connection is established.
+	str, err := c.NewStream(context.Background())
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		for _, conn := range s1.ConnsToPeer(s2.LocalPeer()) {
+			if conn.ID() != c.ID() {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond, "expected a replacement connection")
+	require.False(t, c.IsClosed())
+	require.Equal(t, network.Connected, s1.Connectedness(s2.LocalPeer()))
+
+	// New streams use the replacement connection.
+	str2, err := s1.NewStream(context.Background(), s2.LocalPeer())
+	require.NoError(t, err)
+	require.NotEqual(t, c.ID(), str2.Conn().ID())
+	str2.Reset()
+
+	// Once the stream is done, the old connection is closed.
+	str.Reset()
+	require.Eventually(t, c.IsClosed, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, network.Connected, s1.Connectedness(s2.LocalPeer()))
+}
+
+func TestInboundConnectionRotation(t *testing.T) {
+	s1 := GenSwarm(t, OptDisableQUIC, WithSwarmOpts(
+		swarm.WithMaxConnectionAge(100*time.Millisecond, 0),
+		swarm.WithConnectionDrainGracePeriod(time.Second),
+	))
+	s2 := GenSwarm(t, OptDisableQUIC)
+	defer s1.Close()
+	defer s2.Close()
+
+	s2.Peerstore().AddAddrs(s1.LocalPeer(), s1.ListenAddresses(), peerstore.PermanentAddrTTL)
+	_, err := s2.DialPeer(context.Background(), s1.LocalPeer())
+	require.NoError(t, err)
+	conns := s1.ConnsToPeer(s2.LocalPeer())
+	require.Len(t, conns, 1)
+	c := conns[0]
+	require.Equal(t, network.DirInbound, c.Stat().Direction)
+
+	// We can't dial a replacement for an inbound connection, so it's kept open
+	// until the drain grace period expires, even without any streams.
+	start := time.Now()
+	require.Eventually(t, c.IsClosed, 5*time.Second, 10*time.Millisecond)
+	require.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestRotatedInboundConnectionFallback(t *testing.T) {
+	s1 := GenSwarm(t, OptDisableQUIC, WithSwarmOpts(
+		swarm.WithMaxConnectionAge(100*time.Millisecond, 0),
+		swarm.WithConnectionDrainGracePeriod(time.Minute),
+	))
+	s2 := GenSwarm(t, OptDisableQUIC)
+	defer s1.Close()
+	defer s2.Close()
+	s2.SetStreamHandler(func(str network.Stream) { str.Close() })
+
+	// s1 doesn't know any addresses of s2, so it can only reach s2 over the inbound connection.
+	s2.Peerstore().AddAddrs(s1.LocalPeer(), s1.ListenAddresses(), peerstore.PermanentAddrTTL)
+	_, err := s2.DialPeer(context.Background(), s1.LocalPeer())
+	require.NoError(t, err)
+	conns := s1.ConnsToPeer(s2.LocalPeer())
+	require.Len(t, conns, 1)
+	c := conns[0]
+
+	// Wait for the connection to be rotated. It's kept open during the drain grace period,
+	// and is still used for new streams, since there's no other connection to the peer.
+	time.Sleep(300 * time.Millisecond)
+	require.False(t, c.IsClosed())
+	str, err := s1.NewStream(context.Background(), s2.LocalPeer())
+	require.NoError(t, err)
+	require.Equal(t, c.ID(), str.Conn().ID())
+	str.Reset()
+}
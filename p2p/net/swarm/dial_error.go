@@ -19,6 +19,9 @@ type DialError struct {
 	DialErrors []TransportError
 	Cause      error
 	Skipped    int
+	// SkippedAddrs are the addresses that weren't dialed because the peer
+	// has more addresses than the maximum number of addresses per dial.
+	SkippedAddrs []ma.Multiaddr
 }
 
 func (e *DialError) Timeout() bool {
@@ -48,6 +51,9 @@ func (e *DialError) Error() string {
 	if e.Skipped > 0 {
 		fmt.Fprintf(&builder, "\n    ... skipping %d errors ...", e.Skipped)
 	}
+	if len(e.SkippedAddrs) > 0 {
+		fmt.Fprintf(&builder, "\n    ... didn't dial %d addresses ...", len(e.SkippedAddrs))
+	}
 	return builder.String()
 }
 
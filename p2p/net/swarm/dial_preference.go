@@ -0,0 +1,118 @@
+package swarm
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// defaultDialPreferenceDelay is the default delay between dialing successive preferences.
+const defaultDialPreferenceDelay = time.Second
+
+// DialPreference pins the addresses used when dialing a peer, overriding the ranking of
+// the peer's addresses by the dial ranker. This is useful when the operator knows the best
+// path to a peer, for example a private backbone address of a cluster peer.
+type DialPreference struct {
+	// Addrs are the preferred addresses. They're dialed first, in the given order.
+	// They're dialed even if they're not in the peerstore.
+	Addrs []ma.Multiaddr
+	// Transports are the preferred transports, identified by a multiaddr protocol code
+	// (e.g. ma.P_QUIC_V1 or ma.P_WS). Addresses containing these protocols are dialed
+	// after the preferred addresses, in the order of the transports.
+	Transports []int
+	// Delay is the delay between dialing successive preferences, and between the last
+	// preference and the remaining addresses. Defaults to 1 second.
+	Delay time.Duration
+	// Exclusive prevents dialing any addresses other than the preferred ones.
+	Exclusive bool
+}
+
+// SetDialPreference pins the preferred addresses and transports for dialing a peer.
+// It replaces any preference previously set for the peer.
+func (s *Swarm) SetDialPreference(p peer.ID, pref DialPreference) {
+	pref.Addrs = append([]ma.Multiaddr(nil), pref.Addrs...)
+	pref.Transports = append([]int(nil), pref.Transports...)
+	if pref.Delay <= 0 {
+		pref.Delay = defaultDialPreferenceDelay
+	}
+
+	s.dialPrefs.Lock()
+	defer s.dialPrefs.Unlock()
+	s.dialPrefs.m[p] = pref
+}
+
+// ClearDialPreference removes the dial preference for a peer.
+func (s *Swarm) ClearDialPreference(p peer.ID) {
+	s.dialPrefs.Lock()
+	defer s.dialPrefs.Unlock()
+	delete(s.dialPrefs.m, p)
+}
+
+// GetDialPreference returns the dial preference for a peer.
+func (s *Swarm) GetDialPreference(p peer.ID) (DialPreference, bool) {
+	s.dialPrefs.RLock()
+	defer s.dialPrefs.RUnlock()
+	pref, ok := s.dialPrefs.m[p]
+	return pref, ok
+}
+
+// rank returns the index of the preference matching addr.
+// Preferred addresses come before preferred transports.
+func (pref *DialPreference) rank(addr ma.Multiaddr) (int, bool) {
+	for i, a := range pref.Addrs {
+		if a.Equal(addr) {
+			return i, true
+		}
+	}
+	for i, t := range pref.Transports {
+		if _, err := addr.ValueForProtocol(t); err == nil {
+			return len(pref.Addrs) + i, true
+		}
+	}
+	return 0, false
+}
+
+// filter removes all addresses that don't match the preference, if the preference is exclusive.
+func (pref *DialPreference) filter(addrs []ma.Multiaddr) []ma.Multiaddr {
+	if !pref.Exclusive {
+		return addrs
+	}
+	return ma.FilterAddrs(addrs, func(a ma.Multiaddr) bool {
+		_, ok := pref.rank(a)
+		return ok
+	})
+}
+
+// rankAddrs ranks the addresses according to the preference. Preferred addresses are dialed
+// in order of preference, the remaining addresses are ranked using the ranker, and dialed
+// after all preferred addresses.
+func (pref *DialPreference) rankAddrs(addrs []ma.Multiaddr, ranker network.DialRanker) []network.AddrDelay {
+	res := make([]network.AddrDelay, 0, len(addrs))
+	var rest []ma.Multiaddr
+	var maxRank int
+	for _, a := range addrs {
+		r, ok := pref.rank(a)
+		if !ok {
+			rest = append(rest, a)
+			continue
+		}
+		if r > maxRank {
+			maxRank = r
+		}
+		res = append(res, network.AddrDelay{Addr: a, Delay: time.Duration(r) * pref.Delay})
+	}
+	if len(rest) == 0 {
+		return res
+	}
+	offset := time.Duration(maxRank) * pref.Delay
+	if len(res) > 0 {
+		offset += pref.Delay
+	}
+	for _, ad := range ranker(rest) {
+		res = append(res, network.AddrDelay{Addr: ad.Addr, Delay: offset + ad.Delay})
+	}
+	return res
+}
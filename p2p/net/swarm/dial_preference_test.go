@@ -0,0 +1,81 @@
+package swarm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peerstore"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialPreferenceRanking(t *testing.T) {
+	tcp := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+	quic := ma.StringCast("/ip4/1.2.3.4/udp/1/quic-v1")
+	backbone := ma.StringCast("/ip4/10.0.0.1/tcp/1")
+	ws := ma.StringCast("/ip4/1.2.3.4/tcp/2/ws")
+
+	pref := DialPreference{
+		Addrs:      []ma.Multiaddr{backbone},
+		Transports: []int{ma.P_WS},
+		Delay:      time.Second,
+	}
+	res := pref.rankAddrs([]ma.Multiaddr{tcp, quic, ws, backbone}, DefaultDialRanker)
+	delays := make(map[string]time.Duration, len(res))
+	for _, ad := range res {
+		delays[ad.Addr.String()] = ad.Delay
+	}
+	require.Len(t, delays, 4)
+	require.Equal(t, time.Duration(0), delays[backbone.String()])
+	require.Equal(t, time.Second, delays[ws.String()])
+	// the remaining addresses are ranked by the dial ranker, after the preferred addresses
+	require.Equal(t, 2*time.Second, delays[quic.String()])
+	require.Greater(t, delays[tcp.String()], 2*time.Second)
+
+	pref.Exclusive = true
+	require.Equal(t, []ma.Multiaddr{ws, backbone}, pref.filter([]ma.Multiaddr{tcp, quic, ws, backbone}))
+}
+
+func TestDialPreferenceExclusive(t *testing.T) {
+	s1 := makeSwarmWithNoListenAddrs(t)
+	s2 := makeSwarmWithNoListenAddrs(t)
+	defer s1.Close()
+	defer s2.Close()
+	require.NoError(t, s2.Listen(
+		ma.StringCast("/ip4/127.0.0.1/tcp/0"),
+		ma.StringCast("/ip4/127.0.0.1/tcp/0"),
+	))
+	addrs := s2.ListenAddresses()
+	require.Len(t, addrs, 2)
+	s1.Peerstore().AddAddr(s2.LocalPeer(), addrs[0], peerstore.PermanentAddrTTL)
+
+	// the pinned address isn't in the peerstore, but is dialed anyway
+	s1.SetDialPreference(s2.LocalPeer(), DialPreference{Addrs: addrs[1:], Exclusive: true})
+	pref, ok := s1.GetDialPreference(s2.LocalPeer())
+	require.True(t, ok)
+	require.Equal(t, time.Second, pref.Delay)
+
+	c, err := s1.DialPeer(context.Background(), s2.LocalPeer())
+	require.NoError(t, err)
+	require.True(t, c.RemoteMultiaddr().Equal(addrs[1]))
+	require.NoError(t, c.Close())
+
+	s1.ClearDialPreference(s2.LocalPeer())
+	_, ok = s1.GetDialPreference(s2.LocalPeer())
+	require.False(t, ok)
+}
+
+func TestDialPreferenceNoGoodAddresses(t *testing.T) {
+	s1 := makeSwarmWithNoListenAddrs(t)
+	s2 := makeSwarmWithNoListenAddrs(t)
+	defer s1.Close()
+	defer s2.Close()
+	require.NoError(t, s2.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0")))
+	s1.Peerstore().AddAddrs(s2.LocalPeer(), s2.ListenAddresses(), peerstore.PermanentAddrTTL)
+
+	s1.SetDialPreference(s2.LocalPeer(), DialPreference{Transports: []int{ma.P_WS}, Exclusive: true})
+	_, err := s1.DialPeer(context.Background(), s2.LocalPeer())
+	require.ErrorIs(t, err, ErrNoGoodAddresses)
+}
@@ -1,6 +1,7 @@
 package swarm
 
 import (
+	"math/rand"
 	"sort"
 	"strconv"
 	"time"
@@ -61,6 +62,116 @@ func NoDelayDialRanker(addrs []ma.Multiaddr) []network.AddrDelay {
 //
 // We dial lowest ports first for QUIC addresses as they are more likely to be the listen port.
 func DefaultDialRanker(addrs []ma.Multiaddr) []network.AddrDelay {
+	return rankAddrsWithDelays(addrs, DefaultDialRankerDelays)
+}
+
+// DialRankerDelays are the delays used to stagger dial attempts, see DefaultDialRanker.
+type DialRankerDelays struct {
+	// PublicTCP and PrivateTCP are the durations by which TCP dials are delayed relative to the last QUIC dial,
+	// for public and private addresses respectively.
+	PublicTCP, PrivateTCP time.Duration
+	// PublicQUIC and PrivateQUIC are the durations by which QUIC dials are delayed relative to the previous QUIC dial,
+	// for public and private addresses respectively.
+	PublicQUIC, PrivateQUIC time.Duration
+	// Relay is the duration by which relay dials are delayed relative to direct addresses.
+	Relay time.Duration
+}
+
+// DefaultDialRankerDelays are the delays used by DefaultDialRanker.
+var DefaultDialRankerDelays = DialRankerDelays{
+	PublicTCP:   PublicTCPDelay,
+	PrivateTCP:  PrivateTCPDelay,
+	PublicQUIC:  PublicQUICDelay,
+	PrivateQUIC: PrivateQUICDelay,
+	Relay:       RelayDelay,
+}
+
+// NewDialRanker returns a dial ranker that ranks addresses like DefaultDialRanker, using custom delays.
+// This is useful for networks with round trip times that differ significantly from the 250ms assumed by DefaultDialRanker.
+func NewDialRanker(d DialRankerDelays) network.DialRanker {
+	return func(addrs []ma.Multiaddr) []network.AddrDelay {
+		return rankAddrsWithDelays(addrs, d)
+	}
+}
+
+// SpreadQUICPorts wraps ranker to spread our connections across the QUIC ports of peers that listen
+// on a range of consecutive UDP ports of the same IP address (see libp2pquic.ListenAddrsWithPortSpread).
+// This works around per-port conntrack and bandwidth limits some hosting providers apply.
+//
+// If the address ranker dials first among a set of QUIC addresses that only differ in their port is
+// the start of a run of consecutive ports, the returned ranker dials a random port of that run in
+// its place instead, leaving the delays of all addresses unchanged.
+func SpreadQUICPorts(ranker network.DialRanker) network.DialRanker {
+	return func(addrs []ma.Multiaddr) []network.AddrDelay {
+		return spreadQUICPorts(ranker(addrs))
+	}
+}
+
+func spreadQUICPorts(res []network.AddrDelay) []network.AddrDelay {
+	// group the QUIC addresses that only differ in their UDP port
+	sets := make(map[string][]int)
+	for i, a := range res {
+		if !isQUICAddr(a.Addr) {
+			continue
+		}
+		key := quicPortSetKey(a.Addr)
+		sets[key] = append(sets[key], i)
+	}
+	for _, idxs := range sets {
+		if len(idxs) < 2 {
+			continue
+		}
+		first := idxs[0]
+		byPort := make(map[int]int, len(idxs))
+		for _, i := range idxs {
+			if res[i].Delay < res[first].Delay {
+				first = i
+			}
+			byPort[udpPort(res[i].Addr)] = i
+		}
+		// Only spread across consecutive ports. Other ports of the same IP address are usually
+		// ports mapped by a NAT, and are less likely to be reachable.
+		run := []int{first}
+		for p := udpPort(res[first].Addr) + 1; ; p++ {
+			i, ok := byPort[p]
+			if !ok {
+				break
+			}
+			run = append(run, i)
+		}
+		if len(run) < 2 {
+			continue
+		}
+		j := run[rand.Intn(len(run))]
+		res[first].Addr, res[j].Addr = res[j].Addr, res[first].Addr
+	}
+	return res
+}
+
+func udpPort(a ma.Multiaddr) int {
+	p, err := a.ValueForProtocol(ma.P_UDP)
+	if err != nil {
+		return 0
+	}
+	port, _ := strconv.Atoi(p)
+	return port
+}
+
+// quicPortSetKey returns the string representation of a with the value of the UDP port removed.
+func quicPortSetKey(a ma.Multiaddr) string {
+	var key string
+	ma.ForEach(a, func(c ma.Component) bool {
+		if c.Protocol().Code == ma.P_UDP {
+			key += "/udp"
+		} else {
+			key += c.String()
+		}
+		return true
+	})
+	return key
+}
+
+func rankAddrsWithDelays(addrs []ma.Multiaddr, d DialRankerDelays) []network.AddrDelay {
 	relay, addrs := filterAddrs(addrs, isRelayAddr)
 	pvt, addrs := filterAddrs(addrs, manet.IsPrivateAddr)
 	public, addrs := filterAddrs(addrs, func(a ma.Multiaddr) bool { return isProtocolAddr(a, ma.P_IP4) || isProtocolAddr(a, ma.P_IP6) })
@@ -68,7 +179,7 @@ func DefaultDialRanker(addrs []ma.Multiaddr) []network.AddrDelay {
 	var relayOffset time.Duration
 	if len(public) > 0 {
 		// if there is a public direct address available delay relay dials
-		relayOffset = RelayDelay
+		relayOffset = d.Relay
 	}
 
 	res := make([]network.AddrDelay, 0, len(addrs))
@@ -76,9 +187,9 @@ func DefaultDialRanker(addrs []ma.Multiaddr) []network.AddrDelay {
 		res = append(res, network.AddrDelay{Addr: addrs[i], Delay: 0})
 	}
 
-	res = append(res, getAddrDelay(pvt, PrivateTCPDelay, PrivateQUICDelay, 0)...)
-	res = append(res, getAddrDelay(public, PublicTCPDelay, PublicQUICDelay, 0)...)
-	res = append(res, getAddrDelay(relay, PublicTCPDelay, PublicQUICDelay, relayOffset)...)
+	res = append(res, getAddrDelay(pvt, d.PrivateTCP, d.PrivateQUIC, 0)...)
+	res = append(res, getAddrDelay(public, d.PublicTCP, d.PublicQUIC, 0)...)
+	res = append(res, getAddrDelay(relay, d.PublicTCP, d.PublicQUIC, relayOffset)...)
 	return res
 }
 
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/test"
@@ -259,3 +260,82 @@ func TestDelayRankerRelay(t *testing.T) {
 		})
 	}
 }
+
+func TestCustomDelayRanker(t *testing.T) {
+	q1v1 := ma.StringCast("/ip4/1.2.3.4/udp/1/quic-v1")
+	q1v16 := ma.StringCast("/ip6/1::2/udp/1/quic-v1")
+	t1 := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+	pid := test.RandPeerIDFatal(t)
+	r1 := ma.StringCast(fmt.Sprintf("/ip4/1.2.3.4/tcp/1/p2p-circuit/p2p/%s", pid))
+
+	ranker := NewDialRanker(DialRankerDelays{
+		PublicTCP:  100 * time.Millisecond,
+		PublicQUIC: 50 * time.Millisecond,
+		Relay:      time.Second,
+	})
+	res := ranker([]ma.Multiaddr{t1, q1v1, q1v16, r1})
+	expected := []network.AddrDelay{
+		{Addr: q1v16, Delay: 0},
+		{Addr: q1v1, Delay: 50 * time.Millisecond},
+		{Addr: t1, Delay: 150 * time.Millisecond},
+		{Addr: r1, Delay: time.Second},
+	}
+	sortAddrDelays(res)
+	sortAddrDelays(expected)
+	if len(res) != len(expected) {
+		t.Fatalf("expected %+v got %+v", expected, res)
+	}
+	for i := range expected {
+		if !expected[i].Addr.Equal(res[i].Addr) || expected[i].Delay != res[i].Delay {
+			t.Fatalf("expected %+v got %+v", expected, res)
+		}
+	}
+}
+
+func TestSpreadQUICPorts(t *testing.T) {
+	q1 := ma.StringCast("/ip4/1.2.3.4/udp/1/quic-v1")
+	q2 := ma.StringCast("/ip4/1.2.3.4/udp/2/quic-v1")
+	q3 := ma.StringCast("/ip4/1.2.3.4/udp/3/quic-v1")
+	// not part of the run of consecutive ports, e.g. a port mapped by a NAT
+	qNAT := ma.StringCast("/ip4/1.2.3.4/udp/40000/quic-v1")
+	q16 := ma.StringCast("/ip6/1::2/udp/1/quic-v1")
+	t1 := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+
+	ranker := SpreadQUICPorts(DefaultDialRanker)
+	firstPorts := make(map[string]int)
+	for i := 0; i < 200; i++ {
+		res := ranker([]ma.Multiaddr{t1, q1, q2, q3, qNAT, q16})
+		sortAddrDelays(res)
+		if len(res) != 6 {
+			t.Fatalf("expected 6 addresses, got %+v", res)
+		}
+		// the ranking of the port set relative to the other addresses doesn't change
+		if !res[0].Addr.Equal(q16) || res[0].Delay != 0 {
+			t.Fatalf("expected %s to be dialed first, got %+v", q16, res)
+		}
+		if res[1].Delay != PublicQUICDelay {
+			t.Fatalf("expected second dial after %s, got %+v", PublicQUICDelay, res)
+		}
+		if !res[5].Addr.Equal(t1) || res[5].Delay != 2*PublicQUICDelay+PublicTCPDelay {
+			t.Fatalf("expected %s to be dialed last, got %+v", t1, res)
+		}
+		firstPorts[res[1].Addr.String()]++
+	}
+	for _, a := range []ma.Multiaddr{q1, q2, q3} {
+		if firstPorts[a.String()] == 0 {
+			t.Errorf("expected %s to be dialed first at least once, got %v", a, firstPorts)
+		}
+	}
+	if firstPorts[qNAT.String()] != 0 {
+		t.Errorf("didn't expect %s to be dialed first, got %v", qNAT, firstPorts)
+	}
+
+	// the default ranker doesn't spread connections
+	for i := 0; i < 20; i++ {
+		res := DefaultDialRanker([]ma.Multiaddr{t1, q1, q2, q3, qNAT, q16})
+		sortAddrDelays(res)
+		if !res[1].Addr.Equal(q1) {
+			t.Fatalf("expected %s to be dialed second, got %+v", q1, res)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package swarm
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// AddrDialState is the state of the dial to a single address of a peer.
+type AddrDialState int
+
+const (
+	// AddrDialQueued means that the address will be dialed once its ranking delay has passed.
+	AddrDialQueued AddrDialState = iota
+	// AddrDialInFlight means that the address is being dialed.
+	AddrDialInFlight
+	// AddrDialFailed means that the dial to the address failed.
+	AddrDialFailed
+	// AddrDialSucceeded means that the dial to the address succeeded.
+	AddrDialSucceeded
+)
+
+func (s AddrDialState) String() string {
+	switch s {
+	case AddrDialQueued:
+		return "queued"
+	case AddrDialInFlight:
+		return "in flight"
+	case AddrDialFailed:
+		return "failed"
+	case AddrDialSucceeded:
+		return "succeeded"
+	default:
+		return "unknown"
+	}
+}
+
+// AddrDialStatus is the status of the dial to a single address of a peer.
+type AddrDialStatus struct {
+	Addr  ma.Multiaddr
+	State AddrDialState
+	// Err is the error of a failed dial.
+	Err error
+}
+
+// DialStatus is the status of an in-flight dial to a peer.
+//
+// Concurrent calls to DialPeer for the same peer share a single dial: every address is dialed
+// at most once, and the result is delivered to all callers. Routing layers can use the status
+// to avoid looking up a peer that is already being dialed.
+type DialStatus struct {
+	Peer peer.ID
+	// Started is the time the dial started.
+	Started time.Time
+	// Waiting is the number of DialPeer calls waiting for the dial to complete.
+	Waiting int
+	// Addrs are the addresses tracked by the dial, in the order they were added.
+	Addrs []AddrDialStatus
+}
+
+// DialStatus returns the status of the in-flight dial to p,
+// and false if we're not dialing p.
+func (s *Swarm) DialStatus(p peer.ID) (DialStatus, bool) {
+	s.dialStatus.RLock()
+	defer s.dialStatus.RUnlock()
+	st, ok := s.dialStatus.m[p]
+	return st, ok
+}
+
+// ActiveDials returns the status of all in-flight dials.
+func (s *Swarm) ActiveDials() []DialStatus {
+	s.dialStatus.RLock()
+	defer s.dialStatus.RUnlock()
+	res := make([]DialStatus, 0, len(s.dialStatus.m))
+	for _, st := range s.dialStatus.m {
+		res = append(res, st)
+	}
+	return res
+}
+
+// publishStatus updates the status of the worker's dial, as returned by Swarm.DialStatus.
+// It must be called from the worker loop.
+func (w *dialWorker) publishStatus() {
+	ads := make([]*addrDial, 0, len(w.trackedDials))
+	for _, ad := range w.trackedDials {
+		ads = append(ads, ad)
+	}
+	sort.Slice(ads, func(i, j int) bool {
+		if !ads[i].createdAt.Equal(ads[j].createdAt) {
+			return ads[i].createdAt.Before(ads[j].createdAt)
+		}
+		return bytes.Compare(ads[i].addr.Bytes(), ads[j].addr.Bytes()) < 0
+	})
+
+	st := DialStatus{
+		Peer:    w.peer,
+		Started: w.started,
+		Waiting: len(w.pendingRequests),
+		Addrs:   make([]AddrDialStatus, 0, len(ads)),
+	}
+	for _, ad := range ads {
+		as := AddrDialStatus{Addr: ad.addr, Err: ad.err}
+		switch {
+		case ad.conn != nil:
+			as.State = AddrDialSucceeded
+		case ad.err != nil:
+			as.State = AddrDialFailed
+		case ad.dialed:
+			as.State = AddrDialInFlight
+		default:
+			as.State = AddrDialQueued
+		}
+		st.Addrs = append(st.Addrs, as)
+	}
+
+	w.s.dialStatus.Lock()
+	defer w.s.dialStatus.Unlock()
+	if w.s.dialStatus.m == nil {
+		w.s.dialStatus.m = make(map[peer.ID]DialStatus)
+	}
+	w.s.dialStatus.m[w.peer] = st
+}
+
+// clearStatus removes the status of the worker's dial, once the worker exits.
+func (w *dialWorker) clearStatus() {
+	w.s.dialStatus.Lock()
+	defer w.s.dialStatus.Unlock()
+	delete(w.s.dialStatus.m, w.peer)
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // dialWorkerFunc is used by dialSync to spawn a new dial worker
@@ -50,6 +52,16 @@ func (ad *activeDial) dial(ctx context.Context) (*Conn, error) {
 	if simConnect, isClient, reason := network.GetSimultaneousConnect(ctx); simConnect {
 		dialCtx = network.WithSimultaneousConnect(dialCtx, isClient, reason)
 	}
+	if filter, reason, ok := network.GetAdditionalConnection(ctx); ok {
+		dialCtx = network.WithAdditionalConnection(dialCtx, reason, filter)
+	}
+	if isConnReplacementDial(ctx) {
+		dialCtx = withConnReplacementDial(dialCtx)
+	}
+	// make the address dials children of the span of the dial, if any
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		dialCtx = trace.ContextWithSpanContext(dialCtx, sc)
+	}
 
 	resch := make(chan dialResponse, 1)
 	select {
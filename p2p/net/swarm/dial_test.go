@@ -520,6 +520,42 @@ func TestDialExistingConnection(t *testing.T) {
 	}
 }
 
+func TestDialAdditionalConnection(t *testing.T) {
+	swarms := makeSwarms(t, 2, swarmt.OptDisableQUIC)
+	defer closeSwarms(swarms)
+	s1 := swarms[0]
+	s2 := swarms[1]
+	require.NoError(t, s2.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0")))
+	addrs := s2.ListenAddresses()
+	require.Len(t, addrs, 2)
+	first, second := addrs[0], addrs[1]
+	s1.Peerstore().AddAddrs(s2.LocalPeer(), addrs, peerstore.PermanentAddrTTL)
+
+	c1, err := s1.DialPeer(context.Background(), s2.LocalPeer())
+	require.NoError(t, err)
+	if !c1.RemoteMultiaddr().Equal(first) {
+		first, second = second, first
+	}
+	isSecond := func(a ma.Multiaddr) bool { return a.Equal(second) }
+
+	ctx := network.WithAdditionalConnection(context.Background(), "test", isSecond)
+	c2, err := s1.DialPeer(ctx, s2.LocalPeer())
+	require.NoError(t, err)
+	require.NotEqual(t, c1, c2)
+	require.True(t, c2.RemoteMultiaddr().Equal(second))
+	require.Len(t, s1.ConnsToPeer(s2.LocalPeer()), 2)
+
+	// the additional connection is reused
+	c3, err := s1.DialPeer(ctx, s2.LocalPeer())
+	require.NoError(t, err)
+	require.Equal(t, c2, c3)
+
+	// no address matches
+	ctx = network.WithAdditionalConnection(context.Background(), "test", func(ma.Multiaddr) bool { return false })
+	_, err = s1.DialPeer(ctx, s2.LocalPeer())
+	require.ErrorIs(t, err, swarm.ErrNoGoodAddresses)
+}
+
 func newSilentListener(t *testing.T) ([]ma.Multiaddr, net.Listener) {
 	lst, err := net.Listen("tcp4", "localhost:0")
 	if err != nil {
@@ -642,3 +678,29 @@ func TestDialSelf(t *testing.T) {
 	_, err := s1.DialPeer(context.Background(), s1.LocalPeer())
 	require.ErrorIs(t, err, swarm.ErrDialToSelf, "expected error from self dial")
 }
+
+func TestDialBudget(t *testing.T) {
+	// A listener that accepts connections, but never completes the security handshake.
+	l, err := manet.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	s := swarmt.GenSwarm(t, swarmt.OptDisableQUIC, swarmt.WithSwarmOpts(swarm.WithDialBudget(network.DialBudget{Total: 300 * time.Millisecond})))
+	defer s.Close()
+	p := testutil.RandPeerIDFatal(t)
+	s.Peerstore().AddAddr(p, l.Multiaddr(), peerstore.PermanentAddrTTL)
+
+	start := time.Now()
+	_, err = s.DialPeer(context.Background(), p)
+	require.Error(t, err)
+	require.Less(t, time.Since(start), 2*time.Second)
+}
@@ -1,11 +1,14 @@
 package swarm
 
 import (
+	"bytes"
 	"context"
 	"math"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 
@@ -80,6 +83,7 @@ type dialWorker struct {
 	resch chan dialResult
 
 	connected bool // true when a connection has been successfully established
+	started   time.Time
 
 	// for testing
 	wg sync.WaitGroup
@@ -108,6 +112,9 @@ func (w *dialWorker) loop() {
 	defer w.wg.Done()
 	defer w.s.limiter.clearAllPeerDials(w.peer)
 
+	w.started = w.cl.Now()
+	defer w.clearStatus()
+
 	// dq is used to pace dials to different addresses of the peer
 	dq := newDialQueue()
 	// dialsInFlight is the number of dials in flight.
@@ -138,6 +145,10 @@ func (w *dialWorker) loop() {
 	totalDials := 0
 loop:
 	for {
+		// Publish the status of the previous iteration. The status is published before
+		// waiting, so it's up to date whenever the worker is idle.
+		w.publishStatus()
+
 		// The loop has three parts
 		//  1. Input requests are received on w.reqch. If a suitable connection is not available we create
 		//     a pendRequest object to track the dialRequest and add the addresses to dq.
@@ -173,13 +184,17 @@ loop:
 
 			// get the delays to dial these addrs from the swarms dialRanker
 			simConnect, _, _ := network.GetSimultaneousConnect(req.ctx)
-			addrRanking := w.rankAddrs(addrs, simConnect)
+			addrRanking, skipped := w.s.limitAddrsForDial(w.rankAddrs(addrs, simConnect))
+			if len(skipped) > 0 {
+				log.Debugw("peer has too many addresses, skipping some", "peer", w.peer, "addrs", len(addrs), "skipped", len(skipped))
+				w.s.dialAddrsSkippedEmitter.Emit(event.EvtDialAddrsSkipped{Peer: w.peer, Skipped: skipped})
+			}
 			addrDelay := make(map[string]time.Duration, len(addrRanking))
 
 			// create the pending request object
 			pr := &pendRequest{
 				req:   req,
-				err:   &DialError{Peer: w.peer},
+				err:   &DialError{Peer: w.peer, SkippedAddrs: skipped},
 				addrs: make(map[string]struct{}, len(addrRanking)),
 			}
 			for _, adelay := range addrRanking {
@@ -393,9 +408,33 @@ func (w *dialWorker) rankAddrs(addrs []ma.Multiaddr, isSimConnect bool) []networ
 	if isSimConnect {
 		return NoDelayDialRanker(addrs)
 	}
+	if pref, ok := w.s.GetDialPreference(w.peer); ok {
+		return pref.rankAddrs(addrs, w.s.dialRanker)
+	}
 	return w.s.dialRanker(addrs)
 }
 
+// limitAddrsForDial truncates the ranked addresses to the configured maximum number of
+// addresses per dial, returning the addresses to dial and the skipped addresses.
+// Addresses are truncated deterministically: lower delays are preferred, and ties are
+// broken by the byte representation of the address.
+func (s *Swarm) limitAddrsForDial(ranking []network.AddrDelay) ([]network.AddrDelay, []ma.Multiaddr) {
+	if len(ranking) <= s.maxAddrsPerDial {
+		return ranking, nil
+	}
+	sort.SliceStable(ranking, func(i, j int) bool {
+		if ranking[i].Delay != ranking[j].Delay {
+			return ranking[i].Delay < ranking[j].Delay
+		}
+		return bytes.Compare(ranking[i].Addr.Bytes(), ranking[j].Addr.Bytes()) < 0
+	})
+	skipped := make([]ma.Multiaddr, 0, len(ranking)-s.maxAddrsPerDial)
+	for _, a := range ranking[s.maxAddrsPerDial:] {
+		skipped = append(skipped, a.Addr)
+	}
+	return ranking[:s.maxAddrsPerDial], skipped
+}
+
 // dialQueue is a priority queue used to schedule dials
 type dialQueue struct {
 	// q contains dials ordered by delay
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"math"
 	mrand "math/rand"
+	"net"
 	"reflect"
 	"sort"
 	"sync"
@@ -1081,3 +1082,110 @@ func TestDialWorkerLoopAddrDedup(t *testing.T) {
 		t.Errorf("expected a fail response")
 	}
 }
+
+func TestLimitAddrsForDial(t *testing.T) {
+	s := makeSwarmWithNoListenAddrs(t, WithMaxAddrsPerDial(3))
+	defer s.Close()
+
+	var ranking []network.AddrDelay
+	for i := 0; i < 10; i++ {
+		ranking = append(ranking, network.AddrDelay{
+			Addr:  ma.StringCast(fmt.Sprintf("/ip4/1.2.3.4/tcp/%d", 1000+i)),
+			Delay: time.Duration(i%2) * time.Second,
+		})
+	}
+
+	var expected []network.AddrDelay
+	for i := 0; i < 10; i++ {
+		mrand.Shuffle(len(ranking), func(i, j int) { ranking[i], ranking[j] = ranking[j], ranking[i] })
+		in := make([]network.AddrDelay, len(ranking))
+		copy(in, ranking)
+		out, skipped := s.limitAddrsForDial(in)
+		require.Len(t, out, 3)
+		require.Len(t, skipped, 7)
+		for _, a := range out {
+			require.Zero(t, a.Delay)
+		}
+		if expected == nil {
+			expected = out
+		}
+		require.Equal(t, expected, out)
+	}
+
+	out, skipped := s.limitAddrsForDial(ranking[:3])
+	require.Equal(t, ranking[:3], out)
+	require.Empty(t, skipped)
+}
+
+func TestDialWorkerLoopMaxAddrsPerDial(t *testing.T) {
+	s1 := makeSwarmWithNoListenAddrs(t, WithMaxAddrsPerDial(2), WithDialTimeout(time.Second))
+	defer s1.Close()
+	_, p2 := newPeer(t)
+
+	// Nobody is listening on these addresses.
+	var addrs []ma.Multiaddr
+	for i := 0; i < 5; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addrs = append(addrs, ma.StringCast(fmt.Sprintf("/ip4/127.0.0.1/tcp/%d", l.Addr().(*net.TCPAddr).Port)))
+		l.Close()
+	}
+	s1.Peerstore().AddAddrs(p2, addrs, peerstore.PermanentAddrTTL)
+
+	_, err := s1.DialPeer(context.Background(), p2)
+	var dialErr *DialError
+	require.ErrorAs(t, err, &dialErr)
+	require.Len(t, dialErr.DialErrors, 2)
+	require.Len(t, dialErr.SkippedAddrs, 3)
+	require.ElementsMatch(t, addrs, append(dialErr.SkippedAddrs, dialErr.DialErrors[0].Address, dialErr.DialErrors[1].Address))
+}
+
+func TestDialWorkerLoopStatus(t *testing.T) {
+	s1 := makeSwarmWithNoListenAddrs(t)
+	defer s1.Close()
+	_, p2 := newPeer(t)
+
+	// the listener accepts the connection, but never completes the handshake
+	recvCh := make(chan struct{}, 1)
+	list, closeCh := makeTCPListener(t, ma.StringCast("/ip4/127.0.0.1/tcp/0"), recvCh)
+	defer list.Close()
+	s1.Peerstore().AddAddr(p2, list.Multiaddr(), peerstore.PermanentAddrTTL)
+
+	_, ok := s1.DialStatus(p2)
+	require.False(t, ok)
+
+	reqch := make(chan dialRequest)
+	worker := newDialWorker(s1, p2, reqch, nil)
+	go worker.loop()
+
+	resch := make(chan dialResponse, 2)
+	for i := 0; i < 2; i++ {
+		reqch <- dialRequest{ctx: context.Background(), resch: resch}
+	}
+	<-recvCh
+
+	require.Eventually(t, func() bool {
+		st, ok := s1.DialStatus(p2)
+		return ok && st.Waiting == 2 && len(st.Addrs) == 1 && st.Addrs[0].State == AddrDialInFlight
+	}, 5*time.Second, 10*time.Millisecond)
+	st, _ := s1.DialStatus(p2)
+	require.Equal(t, p2, st.Peer)
+	require.True(t, st.Addrs[0].Addr.Equal(list.Multiaddr()))
+	require.Len(t, s1.ActiveDials(), 1)
+
+	// fail the dial
+	close(closeCh)
+	for i := 0; i < 2; i++ {
+		require.Error(t, (<-resch).err)
+	}
+	require.Eventually(t, func() bool {
+		st, ok := s1.DialStatus(p2)
+		return ok && st.Waiting == 0 && st.Addrs[0].State == AddrDialFailed && st.Addrs[0].Err != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(reqch)
+	worker.wg.Wait()
+	_, ok = s1.DialStatus(p2)
+	require.False(t, ok)
+	require.Empty(t, s1.ActiveDials())
+}
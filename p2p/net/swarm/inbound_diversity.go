@@ -0,0 +1,126 @@
+package swarm
+
+import (
+	"errors"
+	"net"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// ErrInboundPrefixLimit is returned when an inbound connection is rejected because too many
+// inbound connections come from the same IP prefix. See WithInboundPrefixLimit.
+var ErrInboundPrefixLimit = errors.New("too many inbound connections from the same IP prefix")
+
+const (
+	defaultInboundPrefixLenIPv4 = 16
+	defaultInboundPrefixLenIPv6 = 32
+)
+
+// inboundDiversity limits the fraction of inbound connections from a single IP prefix.
+// It only counts connections from public IP addresses. It must only be accessed while
+// holding the conns lock.
+type inboundDiversity struct {
+	// maxFraction is the maximum fraction of inbound connections from a single prefix.
+	// 0 disables the limit.
+	maxFraction float64
+	// minConns is the number of inbound connections from a single prefix that are
+	// always accepted, regardless of maxFraction.
+	minConns int
+	// prefixLenIPv4 and prefixLenIPv6 are the lengths of the prefixes, in bits.
+	prefixLenIPv4, prefixLenIPv6 int
+
+	// total is the number of counted inbound connections
+	total int
+	// prefixes is the number of counted inbound connections per prefix
+	prefixes map[string]int
+}
+
+func (d *inboundDiversity) enabled() bool {
+	return d.maxFraction > 0
+}
+
+// prefix returns the prefix of addr. It returns false if connections from addr are not limited.
+func (d *inboundDiversity) prefix(addr ma.Multiaddr) (string, bool) {
+	if !manet.IsPublicAddr(addr) {
+		return "", false
+	}
+	ip, err := manet.ToIP(addr)
+	if err != nil {
+		return "", false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(d.prefixLenIPv4, 32)).String(), true
+	}
+	return ip.Mask(net.CIDRMask(d.prefixLenIPv6, 128)).String(), true
+}
+
+// add counts an inbound connection from addr, if it is within the limit.
+// It returns the prefix that needs to be passed to remove once the connection is closed,
+// which is empty if the connection isn't limited.
+func (d *inboundDiversity) add(addr ma.Multiaddr) (prefix string, ok bool) {
+	prefix, limited := d.prefix(addr)
+	if !limited {
+		return "", true
+	}
+	n := d.prefixes[prefix] + 1
+	if n > d.minConns && float64(n) > d.maxFraction*float64(d.total+1) {
+		return prefix, false
+	}
+	if d.prefixes == nil {
+		d.prefixes = make(map[string]int)
+	}
+	d.prefixes[prefix] = n
+	d.total++
+	return prefix, true
+}
+
+// remove stops counting a connection from prefix.
+func (d *inboundDiversity) remove(prefix string) {
+	if prefix == "" {
+		return
+	}
+	d.total--
+	if d.prefixes[prefix] <= 1 {
+		delete(d.prefixes, prefix)
+		return
+	}
+	d.prefixes[prefix]--
+}
+
+// WithInboundPrefixLimit limits the fraction of inbound connections from a single IP prefix
+// (a /16 for IPv4 and a /32 for IPv6, see WithInboundPrefixLengths) to maxFraction.
+// This preserves peer diversity on public nodes, making eclipse attacks from a single network
+// more expensive. The first minConns inbound connections from every prefix are always accepted,
+// so that the limit doesn't prevent connections while there are only a few inbound connections.
+//
+// Only connections from public IP addresses are counted. Relayed connections are never limited.
+func WithInboundPrefixLimit(maxFraction float64, minConns int) Option {
+	return func(s *Swarm) error {
+		if maxFraction <= 0 || maxFraction > 1 {
+			return errors.New("swarm: inbound prefix limit must be in (0, 1]")
+		}
+		if minConns < 0 {
+			return errors.New("swarm: minimum number of inbound connections per prefix must not be negative")
+		}
+		s.inboundDiversity.maxFraction = maxFraction
+		s.inboundDiversity.minConns = minConns
+		return nil
+	}
+}
+
+// WithInboundPrefixLengths sets the lengths of the IP prefixes used by WithInboundPrefixLimit,
+// in bits. Defaults to 16 for IPv4 and 32 for IPv6.
+func WithInboundPrefixLengths(ipv4, ipv6 int) Option {
+	return func(s *Swarm) error {
+		if ipv4 <= 0 || ipv4 > 32 {
+			return errors.New("swarm: invalid IPv4 prefix length")
+		}
+		if ipv6 <= 0 || ipv6 > 128 {
+			return errors.New("swarm: invalid IPv6 prefix length")
+		}
+		s.inboundDiversity.prefixLenIPv4 = ipv4
+		s.inboundDiversity.prefixLenIPv6 = ipv6
+		return nil
+	}
+}
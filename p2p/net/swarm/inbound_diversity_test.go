@@ -0,0 +1,85 @@
+package swarm
+
+import (
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestInboundDiversity(maxFraction float64, minConns int) *inboundDiversity {
+	return &inboundDiversity{
+		maxFraction:   maxFraction,
+		minConns:      minConns,
+		prefixLenIPv4: defaultInboundPrefixLenIPv4,
+		prefixLenIPv6: defaultInboundPrefixLenIPv6,
+	}
+}
+
+func TestInboundDiversityPrefix(t *testing.T) {
+	d := newTestInboundDiversity(0.5, 0)
+	for _, tc := range []struct {
+		addr    string
+		prefix  string
+		limited bool
+	}{
+		{addr: "/ip4/1.2.3.4/tcp/1", prefix: "1.2.0.0", limited: true},
+		{addr: "/ip4/1.2.200.1/udp/1/quic-v1", prefix: "1.2.0.0", limited: true},
+		{addr: "/ip6/2001:db8:1234::1/tcp/1", prefix: "2001:db8::", limited: true},
+		{addr: "/ip4/127.0.0.1/tcp/1"},
+		{addr: "/ip4/192.168.1.1/tcp/1"},
+		{addr: "/ip6/::1/tcp/1"},
+	} {
+		prefix, limited := d.prefix(ma.StringCast(tc.addr))
+		require.Equal(t, tc.limited, limited, tc.addr)
+		require.Equal(t, tc.prefix, prefix, tc.addr)
+	}
+
+	d.prefixLenIPv4 = 24
+	prefix, _ := d.prefix(ma.StringCast("/ip4/1.2.3.4/tcp/1"))
+	require.Equal(t, "1.2.3.0", prefix)
+}
+
+func TestInboundDiversityLimit(t *testing.T) {
+	d := newTestInboundDiversity(0.5, 2)
+	a := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+	b := ma.StringCast("/ip4/5.6.7.8/tcp/1")
+
+	// the first minConns connections from a prefix are always accepted
+	for i := 0; i < 2; i++ {
+		_, ok := d.add(a)
+		require.True(t, ok)
+	}
+	_, ok := d.add(a)
+	require.False(t, ok, "3 out of 3 connections from the same prefix")
+
+	var prefixes []string
+	for i := 0; i < 2; i++ {
+		prefix, ok := d.add(b)
+		require.True(t, ok)
+		prefixes = append(prefixes, prefix)
+	}
+	// 3 out of 5 connections
+	_, ok = d.add(a)
+	require.False(t, ok)
+
+	// private addresses are never limited, and not counted
+	for i := 0; i < 10; i++ {
+		prefix, ok := d.add(ma.StringCast("/ip4/127.0.0.1/tcp/1"))
+		require.True(t, ok)
+		require.Empty(t, prefix)
+	}
+	require.Equal(t, 4, d.total)
+
+	d.add(ma.StringCast("/ip4/9.9.9.9/tcp/1"))
+	// 3 out of 6 connections
+	_, ok = d.add(a)
+	require.True(t, ok)
+
+	for _, prefix := range prefixes {
+		d.remove(prefix)
+	}
+	require.Equal(t, 4, d.total)
+	require.Equal(t, 3, d.prefixes["1.2.0.0"])
+	require.NotContains(t, d.prefixes, "5.6.0.0")
+}
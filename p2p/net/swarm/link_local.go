@@ -0,0 +1,104 @@
+package swarm
+
+import (
+	"net"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// WithIP6LinkLocal enables dialing IPv6 link-local addresses (fe80::/10).
+//
+// Link-local addresses are only unique per network link, so they need to be scoped to one of our
+// network interfaces using a zone ID (e.g. /ip6zone/eth0/ip6/fe80::1/tcp/4001). Zones are local
+// to the host that uses them, so zones of addresses learned from other peers are meaningless.
+// Unless an address is scoped to one of our interfaces, it is dialed on every interface that has
+// an IPv6 link-local address.
+//
+// This is useful for LAN-only deployments, e.g. of embedded devices or mesh networks, that don't
+// have any other IP connectivity.
+func WithIP6LinkLocal() Option {
+	return func(s *Swarm) error {
+		s.ip6LinkLocal = true
+		return nil
+	}
+}
+
+// linkLocalZones returns the names of the interfaces that can be used to dial link-local addresses.
+// It is a variable, so it can be overridden in tests.
+var linkLocalZones = func() []string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		log.Debugw("failed to get network interfaces", "error", err)
+		return nil
+	}
+	var zones []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.To4() == nil && ipnet.IP.IsLinkLocalUnicast() {
+				zones = append(zones, iface.Name)
+				break
+			}
+		}
+	}
+	return zones
+}
+
+// splitIP6Zone splits the leading /ip6zone component off addr.
+// zone is empty if addr doesn't start with an /ip6zone component.
+func splitIP6Zone(addr ma.Multiaddr) (zone string, rest ma.Multiaddr) {
+	first, rest := ma.SplitFirst(addr)
+	if first == nil || first.Protocol().Code != ma.P_IP6ZONE || rest == nil {
+		return "", addr
+	}
+	return first.Value(), rest
+}
+
+// hasIP6Zone returns true if addr is scoped to a zone.
+func hasIP6Zone(addr ma.Multiaddr) bool {
+	zone, _ := splitIP6Zone(addr)
+	return zone != ""
+}
+
+// scopeLinkLocalAddrs scopes the IPv6 link-local addresses among addrs to our interfaces.
+// Addresses that are already scoped to one of our interfaces are kept as they are. Other link-local
+// addresses (unscoped ones, or ones scoped to an interface of the remote peer) are replaced by one
+// address per interface that has an IPv6 link-local address.
+func scopeLinkLocalAddrs(addrs []ma.Multiaddr, zones []string) []ma.Multiaddr {
+	res := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		zone, rest := splitIP6Zone(a)
+		if !manet.IsIP6LinkLocal(rest) {
+			res = append(res, a)
+			continue
+		}
+		if zone != "" && containsString(zones, zone) {
+			res = append(res, a)
+			continue
+		}
+		for _, z := range zones {
+			zc, err := ma.NewComponent("ip6zone", z)
+			if err != nil {
+				continue
+			}
+			res = append(res, zc.Encapsulate(rest))
+		}
+	}
+	return res
+}
+
+func containsString(s []string, e string) bool {
+	for _, v := range s {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package swarm
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peerstore"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScopeLinkLocalAddrs(t *testing.T) {
+	addrs := []ma.Multiaddr{
+		ma.StringCast("/ip4/1.2.3.4/tcp/1"),
+		ma.StringCast("/ip6/fe80::1/tcp/1"),
+		ma.StringCast("/ip6zone/eth0/ip6/fe80::2/tcp/1"),
+		ma.StringCast("/ip6zone/remote0/ip6/fe80::3/udp/1/quic-v1"),
+	}
+	require.Equal(t,
+		[]ma.Multiaddr{
+			ma.StringCast("/ip4/1.2.3.4/tcp/1"),
+			ma.StringCast("/ip6zone/eth0/ip6/fe80::1/tcp/1"),
+			ma.StringCast("/ip6zone/wlan0/ip6/fe80::1/tcp/1"),
+			ma.StringCast("/ip6zone/eth0/ip6/fe80::2/tcp/1"),
+			ma.StringCast("/ip6zone/eth0/ip6/fe80::3/udp/1/quic-v1"),
+			ma.StringCast("/ip6zone/wlan0/ip6/fe80::3/udp/1/quic-v1"),
+		},
+		scopeLinkLocalAddrs(addrs, []string{"eth0", "wlan0"}),
+	)
+	// without any link-local interfaces, link-local addresses are dropped
+	require.Equal(t, addrs[:1], scopeLinkLocalAddrs(addrs, nil))
+}
+
+func TestFilterLinkLocalAddrs(t *testing.T) {
+	addrs := []ma.Multiaddr{
+		ma.StringCast("/ip6/fe80::1/tcp/1"),
+		ma.StringCast("/ip6zone/eth0/ip6/fe80::1/tcp/1"),
+	}
+
+	s := makeSwarmWithNoListenAddrs(t)
+	defer s.Close()
+	require.Empty(t, s.filterKnownUndialables("", addrs))
+
+	s = makeSwarmWithNoListenAddrs(t, WithIP6LinkLocal())
+	defer s.Close()
+	require.Equal(t, addrs[1:], s.filterKnownUndialables("", addrs))
+}
+
+// linkLocalIP returns an IPv6 link-local address of one of our interfaces.
+func linkLocalIP(t *testing.T) net.IP {
+	t.Helper()
+	addrs, err := manet.InterfaceMultiaddrs()
+	require.NoError(t, err)
+	for _, a := range addrs {
+		if manet.IsIP6LinkLocal(a) {
+			ip, err := manet.ToIP(a)
+			require.NoError(t, err)
+			return ip
+		}
+	}
+	t.Skip("no interface with an IPv6 link-local address")
+	return nil
+}
+
+func TestDialLinkLocal(t *testing.T) {
+	ip := linkLocalIP(t)
+
+	s1 := makeSwarmWithNoListenAddrs(t, WithIP6LinkLocal())
+	defer s1.Close()
+	s2 := makeSwarmWithNoListenAddrs(t)
+	defer s2.Close()
+	require.NoError(t, s2.Listen(ma.StringCast("/ip6/::/tcp/0")))
+	_, port := ma.SplitFirst(s2.ListenAddresses()[0])
+	llAddr := ma.Join(ma.StringCast("/ip6/"+ip.String()), port)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// without link-local support, the address is filtered
+	s3 := makeSwarmWithNoListenAddrs(t)
+	defer s3.Close()
+	s3.Peerstore().AddAddr(s2.LocalPeer(), llAddr, peerstore.PermanentAddrTTL)
+	_, err := s3.DialPeer(ctx, s2.LocalPeer())
+	require.ErrorIs(t, err, ErrNoGoodAddresses)
+
+	s1.Peerstore().AddAddr(s2.LocalPeer(), llAddr, peerstore.PermanentAddrTTL)
+	c, err := s1.DialPeer(ctx, s2.LocalPeer())
+	require.NoError(t, err)
+	zone, rest := splitIP6Zone(c.RemoteMultiaddr())
+	require.NotEmpty(t, zone)
+	require.True(t, rest.Equal(llAddr))
+}
@@ -0,0 +1,50 @@
+package swarm
+
+import (
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/event"
+)
+
+// SetMaintenanceMode enables or disables maintenance mode. While in maintenance mode,
+// the swarm doesn't dial any new connections: dials fail with ErrMaintenanceMode.
+// Existing connections are kept, and inbound connections are still accepted.
+// This can be used to quiesce a node before maintenance, or during incident response.
+// The reason is included in the dial errors and in the emitted EvtMaintenanceModeChanged.
+func (s *Swarm) SetMaintenanceMode(enabled bool, reason string) {
+	if !enabled {
+		reason = ""
+	}
+	s.maintenance.Lock()
+	defer s.maintenance.Unlock()
+	if s.maintenance.enabled == enabled && s.maintenance.reason == reason {
+		return
+	}
+	s.maintenance.enabled = enabled
+	s.maintenance.reason = reason
+	if enabled {
+		log.Infow("entering maintenance mode, not dialing any new connections", "reason", reason)
+	} else {
+		log.Info("leaving maintenance mode")
+	}
+	// emit while holding the lock, so that events are emitted in the same order as the state changes
+	s.maintenanceEmitter.Emit(event.EvtMaintenanceModeChanged{Enabled: enabled, Reason: reason})
+}
+
+// MaintenanceMode returns whether the swarm is in maintenance mode, and the reason given for entering it.
+func (s *Swarm) MaintenanceMode() (enabled bool, reason string) {
+	s.maintenance.RLock()
+	defer s.maintenance.RUnlock()
+	return s.maintenance.enabled, s.maintenance.reason
+}
+
+func (s *Swarm) checkMaintenanceMode() error {
+	enabled, reason := s.MaintenanceMode()
+	if !enabled {
+		return nil
+	}
+	if reason == "" {
+		return ErrMaintenanceMode
+	}
+	return fmt.Errorf("%w: %s", ErrMaintenanceMode, reason)
+}
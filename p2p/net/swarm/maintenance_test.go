@@ -0,0 +1,73 @@
+package swarm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	bus := eventbus.NewBus()
+	s := swarmt.GenSwarm(t, swarmt.OptDisableQUIC, swarmt.EventBus(bus))
+	defer s.Close()
+	connected := swarmt.GenSwarm(t, swarmt.OptDisableQUIC)
+	defer connected.Close()
+	other := swarmt.GenSwarm(t, swarmt.OptDisableQUIC)
+	defer other.Close()
+	for _, sw := range []*swarm.Swarm{connected, other} {
+		s.Peerstore().AddAddrs(sw.LocalPeer(), sw.ListenAddresses(), peerstore.PermanentAddrTTL)
+		sw.Peerstore().AddAddrs(s.LocalPeer(), s.ListenAddresses(), peerstore.PermanentAddrTTL)
+	}
+
+	sub, err := bus.Subscribe(new(event.EvtMaintenanceModeChanged))
+	require.NoError(t, err)
+	defer sub.Close()
+	nextEvent := func() event.EvtMaintenanceModeChanged {
+		t.Helper()
+		select {
+		case e := <-sub.Out():
+			return e.(event.EvtMaintenanceModeChanged)
+		case <-time.After(time.Second):
+			t.Fatal("expected an EvtMaintenanceModeChanged")
+		}
+		return event.EvtMaintenanceModeChanged{}
+	}
+
+	_, err = s.DialPeer(context.Background(), connected.LocalPeer())
+	require.NoError(t, err)
+
+	s.SetMaintenanceMode(true, "upgrading")
+	require.Equal(t, event.EvtMaintenanceModeChanged{Enabled: true, Reason: "upgrading"}, nextEvent())
+	enabled, reason := s.MaintenanceMode()
+	require.True(t, enabled)
+	require.Equal(t, "upgrading", reason)
+
+	// existing connections are kept
+	_, err = s.DialPeer(context.Background(), connected.LocalPeer())
+	require.NoError(t, err)
+	// no new dials
+	_, err = s.DialPeer(context.Background(), other.LocalPeer())
+	require.ErrorIs(t, err, swarm.ErrMaintenanceMode)
+	require.Contains(t, err.Error(), "upgrading")
+	var dialErr *swarm.DialError
+	require.True(t, errors.As(err, &dialErr))
+	// inbound connections are accepted
+	_, err = other.DialPeer(context.Background(), s.LocalPeer())
+	require.NoError(t, err)
+	require.NoError(t, other.ClosePeer(s.LocalPeer()))
+
+	s.SetMaintenanceMode(false, "")
+	require.Equal(t, event.EvtMaintenanceModeChanged{}, nextEvent())
+	require.Eventually(t, func() bool { return len(s.ConnsToPeer(other.LocalPeer())) == 0 }, time.Second, 10*time.Millisecond)
+	_, err = s.DialPeer(context.Background(), other.LocalPeer())
+	require.NoError(t, err)
+}
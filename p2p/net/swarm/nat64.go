@@ -0,0 +1,235 @@
+package swarm
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// nat64DiscoveryName is the well-known name used to discover NAT64 prefixes (RFC 7050).
+// It only has A records. A DNS64 resolver synthesizes AAAA records for it using the NAT64 prefix.
+const nat64DiscoveryName = "ipv4only.arpa"
+
+// nat64DiscoveryAddrs are the IPv4 addresses of ipv4only.arpa.
+var nat64DiscoveryAddrs = []net.IP{net.IPv4(192, 0, 0, 170).To4(), net.IPv4(192, 0, 0, 171).To4()}
+
+// nat64PrefixLens are the prefix lengths allowed for NAT64 prefixes (RFC 6052, section 2.2).
+var nat64PrefixLens = []int{96, 64, 56, 48, 40, 32}
+
+const (
+	// nat64RefreshInterval is the interval at which the NAT64 prefix is rediscovered, to
+	// detect changes of the network we're on.
+	nat64RefreshInterval = 10 * time.Minute
+	// nat64DiscoveryTimeout is the timeout of the DNS query used to discover the NAT64 prefix.
+	nat64DiscoveryTimeout = 10 * time.Second
+)
+
+type nat64Config struct {
+	// detect enables discovery of the NAT64 prefix via DNS64
+	detect bool
+	// prefixes are the statically configured NAT64 prefixes
+	prefixes []*net.IPNet
+}
+
+func (c nat64Config) enabled() bool {
+	return c.detect || len(c.prefixes) > 0
+}
+
+// WithNAT64Detection enables the discovery of NAT64 prefixes using DNS64 (RFC 7050).
+// When a NAT64 prefix is discovered and the host doesn't have any IPv4 address (i.e. it is on an
+// IPv6-only network), IPv6 addresses are synthesized from the public IPv4 addresses of peers,
+// allowing us to reach IPv4-only peers through the NAT64 gateway.
+func WithNAT64Detection() Option {
+	return func(s *Swarm) error {
+		s.nat64Config.detect = true
+		return nil
+	}
+}
+
+// WithNAT64Prefix configures a NAT64 prefix, e.g. one learned from router advertisements
+// (RFC 8781). IPv6 addresses are always synthesized from the public IPv4 addresses of peers
+// using this prefix, in addition to the IPv4 addresses.
+func WithNAT64Prefix(prefix *net.IPNet) Option {
+	return func(s *Swarm) error {
+		ones, bits := prefix.Mask.Size()
+		if bits != 8*net.IPv6len || !validNAT64PrefixLen(ones) || prefix.IP.To4() != nil {
+			return errors.New("swarm: invalid NAT64 prefix")
+		}
+		s.nat64Config.prefixes = append(s.nat64Config.prefixes, prefix)
+		return nil
+	}
+}
+
+func validNAT64PrefixLen(l int) bool {
+	for _, pl := range nat64PrefixLens {
+		if l == pl {
+			return true
+		}
+	}
+	return false
+}
+
+// embedIPv4 embeds ip4 into the NAT64 prefix, as described in RFC 6052, section 2.2.
+// The bits 64 to 71 of the address are reserved, and set to zero.
+func embedIPv4(prefix *net.IPNet, ip4 net.IP) net.IP {
+	ones, _ := prefix.Mask.Size()
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, prefix.IP.Mask(prefix.Mask))
+	pos := ones / 8
+	for _, b := range ip4.To4() {
+		if pos == 8 {
+			pos++
+		}
+		ip[pos] = b
+		pos++
+	}
+	return ip
+}
+
+// extractNAT64Prefixes returns the NAT64 prefixes used to synthesize ip from one of the
+// addresses of ipv4only.arpa (RFC 7050, section 3).
+func extractNAT64Prefixes(ip net.IP) []*net.IPNet {
+	if ip.To4() != nil || len(ip) != net.IPv6len {
+		return nil
+	}
+	var prefixes []*net.IPNet
+	for _, l := range nat64PrefixLens {
+		prefix := &net.IPNet{IP: ip.Mask(net.CIDRMask(l, 8*net.IPv6len)), Mask: net.CIDRMask(l, 8*net.IPv6len)}
+		for _, a := range nat64DiscoveryAddrs {
+			if embedIPv4(prefix, a).Equal(ip) {
+				prefixes = append(prefixes, prefix)
+				break
+			}
+		}
+		if len(prefixes) > 0 {
+			break
+		}
+	}
+	return prefixes
+}
+
+// nat64 synthesizes IPv6 addresses for IPv4 addresses when we're on a NAT64 network.
+type nat64 struct {
+	config nat64Config
+	lookup func(ctx context.Context, name string) ([]net.IPAddr, error)
+	// hasIPv4 returns true if the host has IPv4 connectivity
+	hasIPv4 func() bool
+
+	mx sync.RWMutex
+	// prefixes are the NAT64 prefixes used to synthesize addresses. nil if we're not on a NAT64 network.
+	prefixes []*net.IPNet
+}
+
+func newNAT64(config nat64Config, lookup func(context.Context, string) ([]net.IPAddr, error)) *nat64 {
+	return &nat64{
+		config:   config,
+		lookup:   lookup,
+		hasIPv4:  hostHasIPv4,
+		prefixes: config.prefixes,
+	}
+}
+
+// hostHasIPv4 returns true if any interface has an IPv4 address that is neither a loopback,
+// nor a link-local address.
+func hostHasIPv4() bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return true
+	}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.To4() == nil {
+			continue
+		}
+		if !ipnet.IP.IsLoopback() && !ipnet.IP.IsLinkLocalUnicast() {
+			return true
+		}
+	}
+	return false
+}
+
+// discover discovers the NAT64 prefixes of the network using DNS64.
+func (n *nat64) discover(ctx context.Context) {
+	prefixes := n.config.prefixes
+	if !n.hasIPv4() {
+		ctx, cancel := context.WithTimeout(ctx, nat64DiscoveryTimeout)
+		addrs, err := n.lookup(ctx, nat64DiscoveryName)
+		cancel()
+		if err != nil {
+			log.Debugw("NAT64 prefix discovery failed", "error", err)
+		}
+		for _, a := range addrs {
+			for _, p := range extractNAT64Prefixes(a.IP) {
+				if !containsIPNet(prefixes, p) {
+					prefixes = append(prefixes, p)
+				}
+			}
+		}
+	}
+	log.Debugw("discovered NAT64 prefixes", "prefixes", prefixes)
+
+	n.mx.Lock()
+	n.prefixes = prefixes
+	n.mx.Unlock()
+}
+
+func containsIPNet(nets []*net.IPNet, n *net.IPNet) bool {
+	for _, o := range nets {
+		if o.IP.Equal(n.IP) && o.Mask.String() == n.Mask.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// synthesize returns addrs, with IPv6 addresses synthesized from the public IPv4 addresses appended.
+func (n *nat64) synthesize(addrs []ma.Multiaddr) []ma.Multiaddr {
+	n.mx.RLock()
+	prefixes := n.prefixes
+	n.mx.RUnlock()
+	if len(prefixes) == 0 {
+		return addrs
+	}
+
+	res := addrs
+	for _, a := range addrs {
+		first, rest := ma.SplitFirst(a)
+		if first == nil || first.Protocol().Code != ma.P_IP4 || !manet.IsPublicAddr(a) {
+			continue
+		}
+		ip4 := net.IP(first.RawValue())
+		for _, p := range prefixes {
+			ip6, err := ma.NewComponent("ip6", embedIPv4(p, ip4).String())
+			if err != nil {
+				continue
+			}
+			var synthesized ma.Multiaddr = ip6
+			if rest != nil {
+				synthesized = synthesized.Encapsulate(rest)
+			}
+			res = append(res, synthesized)
+		}
+	}
+	return res
+}
+
+func (s *Swarm) nat64Loop() {
+	defer s.refs.Done()
+
+	s.nat64.discover(s.ctx)
+	t := time.NewTicker(nat64RefreshInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.nat64.discover(s.ctx)
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
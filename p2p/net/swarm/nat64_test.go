@@ -0,0 +1,92 @@
+package swarm
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+
+	ma "github.com/multiformats/go-multiaddr"
+	madns "github.com/multiformats/go-multiaddr-dns"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseCIDR(t *testing.T, s string) *net.IPNet {
+	t.Helper()
+	_, n, err := net.ParseCIDR(s)
+	require.NoError(t, err)
+	return n
+}
+
+func TestEmbedIPv4(t *testing.T) {
+	// examples from RFC 6052, section 2.4
+	ip4 := net.ParseIP("192.0.2.33")
+	for prefix, expected := range map[string]string{
+		"2001:db8::/32":           "2001:db8:c000:221::",
+		"2001:db8:100::/40":       "2001:db8:1c0:2:21::",
+		"2001:db8:122::/48":       "2001:db8:122:c000:2:2100::",
+		"2001:db8:122:300::/56":   "2001:db8:122:3c0:0:221::",
+		"2001:db8:122:344::/64":   "2001:db8:122:344:c0:2:2100:0",
+		"2001:db8:122:344::/96":   "2001:db8:122:344::192.0.2.33",
+		"64:ff9b::/96":            "64:ff9b::192.0.2.33",
+		"2001:db8:122:344:1::/96": "2001:db8:122:344:1::192.0.2.33",
+	} {
+		ip := embedIPv4(mustParseCIDR(t, prefix), ip4)
+		require.True(t, net.ParseIP(expected).Equal(ip), "prefix %s: expected %s, got %s", prefix, expected, ip)
+
+		prefixes := extractNAT64Prefixes(embedIPv4(mustParseCIDR(t, prefix), nat64DiscoveryAddrs[0]))
+		require.Len(t, prefixes, 1)
+		require.Equal(t, mustParseCIDR(t, prefix).String(), prefixes[0].String())
+	}
+	require.Empty(t, extractNAT64Prefixes(net.ParseIP("2001:db8::1")))
+	require.Empty(t, extractNAT64Prefixes(net.ParseIP("1.2.3.4")))
+}
+
+func TestNAT64Discovery(t *testing.T) {
+	resolver, err := madns.NewResolver(madns.WithDefaultResolver(&madns.MockResolver{
+		IP: map[string][]net.IPAddr{
+			nat64DiscoveryName: {{IP: net.ParseIP("64:ff9b::192.0.0.170")}, {IP: net.ParseIP("64:ff9b::192.0.0.171")}},
+		},
+	}))
+	require.NoError(t, err)
+
+	n := newNAT64(nat64Config{detect: true}, resolver.LookupIPAddr)
+	addrs := []ma.Multiaddr{
+		ma.StringCast("/ip4/1.2.3.4/tcp/1"),
+		ma.StringCast("/ip4/1.2.3.4/udp/1/quic-v1"),
+		ma.StringCast("/ip4/192.168.1.1/tcp/1"),
+		ma.StringCast("/ip6/2001:db8::1/tcp/1"),
+		ma.StringCast("/dns4/example.com/tcp/1"),
+	}
+
+	// we have IPv4 connectivity, no need to synthesize addresses
+	n.hasIPv4 = func() bool { return true }
+	n.discover(context.Background())
+	require.Equal(t, addrs, n.synthesize(addrs))
+
+	n.hasIPv4 = func() bool { return false }
+	n.discover(context.Background())
+	require.Equal(t, append(addrs,
+		ma.StringCast("/ip6/64:ff9b::102:304/tcp/1"),
+		ma.StringCast("/ip6/64:ff9b::102:304/udp/1/quic-v1"),
+	), n.synthesize(addrs))
+
+	// we moved to a network without NAT64
+	n.lookup = (&madns.MockResolver{}).LookupIPAddr
+	n.discover(context.Background())
+	require.Equal(t, addrs, n.synthesize(addrs))
+}
+
+func TestNAT64StaticPrefix(t *testing.T) {
+	_, err := NewSwarm("", nil, eventbus.NewBus(), WithNAT64Prefix(mustParseCIDR(t, "10.0.0.0/8")))
+	require.Error(t, err)
+	_, err = NewSwarm("", nil, eventbus.NewBus(), WithNAT64Prefix(mustParseCIDR(t, "2001:db8::/33")))
+	require.Error(t, err)
+
+	n := newNAT64(nat64Config{prefixes: []*net.IPNet{mustParseCIDR(t, "2001:db8:122::/48")}}, nil)
+	require.Equal(t,
+		[]ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/1"), ma.StringCast("/ip6/2001:db8:122:102:3:400::/tcp/1")},
+		n.synthesize([]ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/1")}),
+	)
+}
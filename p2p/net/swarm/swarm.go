@@ -17,13 +17,18 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
 	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/tracinghelper"
 
 	logging "github.com/ipfs/go-log/v2"
 	ma "github.com/multiformats/go-multiaddr"
 	madns "github.com/multiformats/go-multiaddr-dns"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
+	// tracerName is the name of the OpenTelemetry tracer of the swarm.
+	tracerName = "github.com/libp2p/go-libp2p/p2p/net/swarm"
+
 	defaultDialTimeout = 15 * time.Second
 
 	// defaultDialTimeoutLocal is the maximum duration a Dial to local network address
@@ -31,6 +36,15 @@ const (
 	// This includes the time between dialing the raw network connection,
 	// protocol selection as well the handshake, if applicable.
 	defaultDialTimeoutLocal = 5 * time.Second
+
+	// defaultListenerRestartBackoff and defaultListenerRestartMaxBackoff are the initial
+	// and the maximum backoff for restarting a listener that failed.
+	defaultListenerRestartBackoff    = time.Second
+	defaultListenerRestartMaxBackoff = time.Minute
+
+	// defaultMaxAddrsPerDial is the maximum number of addresses of a peer we attempt to dial
+	// when dialing that peer.
+	defaultMaxAddrsPerDial = 64
 )
 
 var log = logging.Logger("swarm2")
@@ -93,6 +107,27 @@ func WithDialTimeoutLocal(t time.Duration) Option {
 	}
 }
 
+// WithDialBudget limits the total time it takes to establish a connection to a peer, including the
+// resolution of its addresses, the transport dial, the security handshake and the muxer negotiation.
+// The budget is apportioned across these stages, see network.DialBudget for details.
+//
+// Unlike the dial timeout, which applies to each address separately, the budget applies to the
+// DialPeer call as a whole. A budget applied to the context using network.WithDialBudget takes precedence.
+func WithDialBudget(b network.DialBudget) Option {
+	return func(s *Swarm) error {
+		if b.Total <= 0 {
+			return errors.New("swarm: dial budget must be positive")
+		}
+		for _, w := range b.Weights {
+			if w < 0 {
+				return errors.New("swarm: dial budget weights must not be negative")
+			}
+		}
+		s.dialBudget = b
+		return nil
+	}
+}
+
 func WithResourceManager(m network.ResourceManager) Option {
 	return func(s *Swarm) error {
 		s.rcmgr = m
@@ -100,6 +135,15 @@ func WithResourceManager(m network.ResourceManager) Option {
 	}
 }
 
+// WithTracerProvider records OpenTelemetry spans for dials using tp.
+// The spans are the parents of the spans recorded by the transports, if any.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(s *Swarm) error {
+		s.tracer = tracinghelper.Tracer(tp, tracerName)
+		return nil
+	}
+}
+
 // WithDialRanker configures swarm to use d as the DialRanker
 func WithDialRanker(d network.DialRanker) Option {
 	return func(s *Swarm) error {
@@ -111,6 +155,44 @@ func WithDialRanker(d network.DialRanker) Option {
 	}
 }
 
+// WithMaxAddrsPerDial limits the number of addresses attempted when dialing a peer.
+// This prevents peers advertising a large number of addresses from consuming the dial budget.
+// If a peer has more addresses, the addresses are ranked, and only the n best ranked addresses are
+// dialed. The skipped addresses are reported in an EvtDialAddrsSkipped, and, if the dial fails,
+// in the DialError.
+// Defaults to 64.
+func WithMaxAddrsPerDial(n int) Option {
+	return func(s *Swarm) error {
+		if n <= 0 {
+			return errors.New("swarm: max addrs per dial must be positive")
+		}
+		s.maxAddrsPerDial = n
+		return nil
+	}
+}
+
+// WithListenerRestartBackoff sets the backoff for restarting listeners that failed unexpectedly.
+// The backoff starts at initial, and doubles with every failed attempt, up to max.
+// Defaults to 1 second and 1 minute.
+func WithListenerRestartBackoff(initial, max time.Duration) Option {
+	return func(s *Swarm) error {
+		if initial <= 0 || max < initial {
+			return errors.New("swarm: invalid listener restart backoff")
+		}
+		s.listenerRestartBackoff.initial = initial
+		s.listenerRestartBackoff.max = max
+		return nil
+	}
+}
+
+// WithDialBackoff configures an exponential dial backoff for addresses of the given class.
+// By default, all addresses use the quadratic backoff described at DialBackoff.AddBackoff.
+func WithDialBackoff(class AddrClass, params BackoffParams) Option {
+	return func(s *Swarm) error {
+		return s.backf.SetBackoffParams(class, params)
+	}
+}
+
 // WithUDPBlackHoleConfig configures swarm to use c as the config for UDP black hole detection
 // n is the size of the sliding window used to evaluate black hole state
 // min is the minimum number of successes out of n required to not block requests
@@ -143,7 +225,11 @@ type Swarm struct {
 	// down before continuing.
 	refs sync.WaitGroup
 
-	emitter event.Emitter
+	emitter                                         event.Emitter
+	listenerFailedEmitter, listenerRestartedEmitter event.Emitter
+	listenerClosedEmitter                           event.Emitter
+	maintenanceEmitter                              event.Emitter
+	dialAddrsSkippedEmitter                         event.Emitter
 
 	rcmgr network.ResourceManager
 
@@ -152,6 +238,8 @@ type Swarm struct {
 
 	dialTimeout      time.Duration
 	dialTimeoutLocal time.Duration
+	// dialBudget is the total time allowed for DialPeer. Disabled if zero.
+	dialBudget network.DialBudget
 
 	conns struct {
 		sync.RWMutex
@@ -165,6 +253,20 @@ type Swarm struct {
 		cacheEOL          time.Time
 
 		m map[transport.Listener]struct{}
+		// status tracks the listen addresses, including the ones whose listener failed
+		status map[*listenerStatus]struct{}
+	}
+	listenerRestartBackoff struct{ initial, max time.Duration }
+
+	dialPrefs struct {
+		sync.RWMutex
+		m map[peer.ID]DialPreference
+	}
+
+	// dialStatus is the status of the in-flight dials, see DialStatus
+	dialStatus struct {
+		sync.RWMutex
+		m map[peer.ID]DialStatus
 	}
 
 	notifs struct {
@@ -194,12 +296,31 @@ type Swarm struct {
 
 	bwc           metrics.Reporter
 	metricsTracer MetricsTracer
+	tracer        trace.Tracer
 
-	dialRanker network.DialRanker
+	dialRanker      network.DialRanker
+	maxAddrsPerDial int
 
 	udpBlackHoleConfig  blackHoleConfig
 	ipv6BlackHoleConfig blackHoleConfig
 	bhd                 *blackHoleDetector
+
+	connRotation connRotationConfig
+
+	// inboundDiversity is protected by the conns lock
+	inboundDiversity inboundDiversity
+
+	nat64Config nat64Config
+	nat64       *nat64
+
+	// ip6LinkLocal enables dialing IPv6 link-local addresses
+	ip6LinkLocal bool
+
+	maintenance struct {
+		sync.RWMutex
+		enabled bool
+		reason  string
+	}
 }
 
 // NewSwarm constructs a Swarm.
@@ -208,27 +329,65 @@ func NewSwarm(local peer.ID, peers peerstore.Peerstore, eventBus event.Bus, opts
 	if err != nil {
 		return nil, err
 	}
+	listenerFailedEmitter, err := eventBus.Emitter(new(event.EvtListenerFailed))
+	if err != nil {
+		return nil, err
+	}
+	listenerRestartedEmitter, err := eventBus.Emitter(new(event.EvtListenerRestarted))
+	if err != nil {
+		return nil, err
+	}
+	listenerClosedEmitter, err := eventBus.Emitter(new(event.EvtListenerClosed))
+	if err != nil {
+		return nil, err
+	}
+	maintenanceEmitter, err := eventBus.Emitter(new(event.EvtMaintenanceModeChanged))
+	if err != nil {
+		return nil, err
+	}
+	dialAddrsSkippedEmitter, err := eventBus.Emitter(new(event.EvtDialAddrsSkipped))
+	if err != nil {
+		return nil, err
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	s := &Swarm{
-		local:            local,
-		peers:            peers,
-		emitter:          emitter,
-		ctx:              ctx,
-		ctxCancel:        cancel,
-		dialTimeout:      defaultDialTimeout,
-		dialTimeoutLocal: defaultDialTimeoutLocal,
-		maResolver:       madns.DefaultResolver,
-		dialRanker:       DefaultDialRanker,
+		local:                    local,
+		peers:                    peers,
+		emitter:                  emitter,
+		listenerFailedEmitter:    listenerFailedEmitter,
+		listenerRestartedEmitter: listenerRestartedEmitter,
+		listenerClosedEmitter:    listenerClosedEmitter,
+		maintenanceEmitter:       maintenanceEmitter,
+		dialAddrsSkippedEmitter:  dialAddrsSkippedEmitter,
+		ctx:                      ctx,
+		ctxCancel:                cancel,
+		dialTimeout:              defaultDialTimeout,
+		dialTimeoutLocal:         defaultDialTimeoutLocal,
+		maResolver:               madns.DefaultResolver,
+		dialRanker:               DefaultDialRanker,
+		maxAddrsPerDial:          defaultMaxAddrsPerDial,
+		tracer:                   tracinghelper.Tracer(nil, tracerName),
 
 		// A black hole is a binary property. On a network if UDP dials are blocked or there is
 		// no IPv6 connectivity, all dials will fail. So a low success rate of 5 out 100 dials
 		// is good enough.
 		udpBlackHoleConfig:  blackHoleConfig{Enabled: true, N: 100, MinSuccesses: 5},
 		ipv6BlackHoleConfig: blackHoleConfig{Enabled: true, N: 100, MinSuccesses: 5},
+
+		connRotation: connRotationConfig{drainGracePeriod: defaultConnDrainGracePeriod},
+		inboundDiversity: inboundDiversity{
+			prefixLenIPv4: defaultInboundPrefixLenIPv4,
+			prefixLenIPv6: defaultInboundPrefixLenIPv6,
+		},
 	}
+	s.listenerRestartBackoff.initial = defaultListenerRestartBackoff
+	s.listenerRestartBackoff.max = defaultListenerRestartMaxBackoff
 
 	s.conns.m = make(map[peer.ID][]*Conn)
 	s.listeners.m = make(map[transport.Listener]struct{})
+	s.listeners.status = make(map[*listenerStatus]struct{})
+	s.dialPrefs.m = make(map[peer.ID]DialPreference)
+	s.dialStatus.m = make(map[peer.ID]DialStatus)
 	s.transports.m = make(map[int]transport.Transport)
 	s.notifs.m = make(map[network.Notifiee]struct{})
 
@@ -248,6 +407,19 @@ func NewSwarm(local peer.ID, peers peerstore.Peerstore, eventBus event.Bus, opts
 
 	s.bhd = newBlackHoleDetector(s.udpBlackHoleConfig, s.ipv6BlackHoleConfig, s.metricsTracer)
 
+	if s.connRotation.enabled() {
+		s.refs.Add(1)
+		go s.connRotationLoop()
+	}
+
+	if s.nat64Config.enabled() {
+		s.nat64 = newNAT64(s.nat64Config, s.maResolver.LookupIPAddr)
+		if s.nat64Config.detect {
+			s.refs.Add(1)
+			go s.nat64Loop()
+		}
+	}
+
 	return s, nil
 }
 
@@ -260,6 +432,11 @@ func (s *Swarm) close() {
 	s.ctxCancel()
 
 	s.emitter.Close()
+	s.listenerFailedEmitter.Close()
+	s.listenerRestartedEmitter.Close()
+	s.listenerClosedEmitter.Close()
+	s.maintenanceEmitter.Close()
+	s.dialAddrsSkippedEmitter.Close()
 
 	// Prevents new connections and/or listeners from being added to the swarm.
 	s.listeners.Lock()
@@ -345,6 +522,9 @@ func (s *Swarm) addConn(tc transport.CapableConn, dir network.Direction) (*Conn,
 		stat:  stat,
 		id:    atomic.AddUint64(&s.nextConnID, 1),
 	}
+	if s.connRotation.enabled() && !stat.Transient {
+		c.rotateAt = s.connRotation.rotationTime(stat.Opened)
+	}
 
 	// we ONLY check upgraded connections here so we can send them a Disconnect message.
 	// If we do this in the Upgrader, we will not be able to do this.
@@ -375,6 +555,16 @@ func (s *Swarm) addConn(tc transport.CapableConn, dir network.Direction) (*Conn,
 		tc.Close()
 		return nil, ErrSwarmClosed
 	}
+	if dir == network.DirInbound && !stat.Transient && s.inboundDiversity.enabled() {
+		prefix, ok := s.inboundDiversity.add(addr)
+		if !ok {
+			s.conns.Unlock()
+			log.Debugf("rejecting inbound connection from %s: too many connections from %s", addr, prefix)
+			tc.Close()
+			return nil, ErrInboundPrefixLimit
+		}
+		c.inboundPrefix = prefix
+	}
 
 	c.streams.m = make(map[*Stream]struct{})
 	isFirstConnection := len(s.conns.m[p]) == 0
@@ -495,6 +685,13 @@ func (s *Swarm) ConnsToPeer(p peer.ID) []network.Conn {
 }
 
 func isBetterConn(a, b *Conn) bool {
+	// If one is being rotated and not the other, prefer the connection that is not.
+	aDraining := a.draining.Load()
+	bDraining := b.draining.Load()
+	if aDraining != bDraining {
+		return !aDraining
+	}
+
 	// If one is transient and not the other, prefer the non-transient connection.
 	aTransient := a.Stat().Transient
 	bTransient := b.Stat().Transient
@@ -552,11 +749,22 @@ func (s *Swarm) bestConnToPeer(p peer.ID) *Conn {
 // - Returns nothing if no such connection exists, but if we should try dialing anyways.
 // - Returns an error if no such connection exists, but we should not try dialing.
 func (s *Swarm) bestAcceptableConnToPeer(ctx context.Context, p peer.ID) (*Conn, error) {
+	if filter, _, ok := network.GetAdditionalConnection(ctx); ok {
+		return s.connMatchingFilter(p, filter), nil
+	}
+
 	conn := s.bestConnToPeer(p)
 	if conn == nil {
 		return nil, nil
 	}
 
+	// Connections being rotated are only kept around to let their streams finish, and as a fallback
+	// until the peer is reachable over a different connection. bestConnToPeer prefers any other
+	// connection, so this is the only connection to the peer. The replacement dial must not use it.
+	if conn.draining.Load() && isConnReplacementDial(ctx) {
+		return nil, nil
+	}
+
 	forceDirect, _ := network.GetForceDirectDial(ctx)
 	if forceDirect && !isDirectConn(conn) {
 		return nil, nil
@@ -570,6 +778,24 @@ func (s *Swarm) bestAcceptableConnToPeer(ctx context.Context, p peer.ID) (*Conn,
 	return nil, network.ErrTransientConn
 }
 
+// connMatchingFilter returns the best usable connection to peer whose remote address
+// is accepted by filter.
+func (s *Swarm) connMatchingFilter(p peer.ID, filter func(ma.Multiaddr) bool) *Conn {
+	s.conns.RLock()
+	defer s.conns.RUnlock()
+
+	var best *Conn
+	for _, c := range s.conns.m[p] {
+		if c.conn.IsClosed() || c.draining.Load() || !filter(c.RemoteMultiaddr()) {
+			continue
+		}
+		if best == nil || isBetterConn(c, best) {
+			best = c
+		}
+	}
+	return best
+}
+
 func isDirectConn(c *Conn) bool {
 	return c != nil && !c.conn.Transport().Proxy()
 }
@@ -679,6 +905,7 @@ func (s *Swarm) removeConn(c *Conn) {
 
 	s.conns.Lock()
 
+	s.inboundDiversity.remove(c.inboundPrefix)
 	cs := s.conns.m[p]
 
 	if len(cs) == 1 {
@@ -718,6 +945,13 @@ func (s *Swarm) ResourceManager() network.ResourceManager {
 	return s.rcmgr
 }
 
+// recordOffense reports an offense to the connection gater, if the gater keeps track of offenses.
+func (s *Swarm) recordOffense(p peer.ID, addr ma.Multiaddr, o connmgr.Offense) {
+	if r, ok := s.gater.(connmgr.OffenseRecorder); ok {
+		r.RecordOffense(p, addr, o)
+	}
+}
+
 // Swarm is a Network.
 var _ network.Network = (*Swarm)(nil)
 var _ transport.TransportNetwork = (*Swarm)(nil)
@@ -8,6 +8,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/connmgr"
 	ic "github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -39,9 +40,26 @@ type Conn struct {
 	}
 
 	stat network.ConnStats
+
+	// inboundPrefix is the IP prefix this connection is counted for by the inbound
+	// prefix limit. Empty if the connection isn't counted.
+	inboundPrefix string
+
+	// rotateAt is the time at which this connection is rotated.
+	// Zero if connection rotation is disabled.
+	rotateAt time.Time
+	// draining is set once the connection was selected for rotation.
+	// A draining connection is only used for new streams if there's no other connection to the peer.
+	draining atomic.Bool
+	// drainStart is the time the connection was selected for rotation.
+	// Only accessed by the connection rotation loop.
+	drainStart time.Time
 }
 
-var _ network.Conn = &Conn{}
+var (
+	_ network.Conn        = &Conn{}
+	_ network.MessageConn = &Conn{}
+)
 
 func (c *Conn) IsClosed() bool {
 	return c.conn.IsClosed()
@@ -93,6 +111,12 @@ func (c *Conn) doClose() {
 	}()
 }
 
+func (c *Conn) numStreams() int {
+	c.streams.Lock()
+	defer c.streams.Unlock()
+	return len(c.streams.m)
+}
+
 func (c *Conn) removeStream(s *Stream) {
 	c.streams.Lock()
 	c.stat.NumStreams--
@@ -113,10 +137,17 @@ func (c *Conn) start() {
 		for {
 			ts, err := c.conn.AcceptStream()
 			if err != nil {
+				if errors.Is(err, network.ErrMuxerProtocolViolation) {
+					c.swarm.recordOffense(c.RemotePeer(), c.RemoteMultiaddr(), connmgr.OffenseProtocolViolation)
+				}
 				return
 			}
 			scope, err := c.swarm.ResourceManager().OpenStream(c.RemotePeer(), network.DirInbound)
 			if err != nil {
+				// Only charge the peer for exceeding its own limits, not for limits shared by all peers.
+				if errors.Is(err, network.ErrPeerResourceLimitExceeded) {
+					c.swarm.recordOffense(c.RemotePeer(), c.RemoteMultiaddr(), connmgr.OffenseResourceLimit)
+				}
 				ts.Reset()
 				continue
 			}
@@ -184,6 +215,41 @@ func (c *Conn) ConnState() network.ConnectionState {
 	return c.conn.ConnState()
 }
 
+func (c *Conn) messageConn() (network.MessageConn, bool) {
+	tc := c.conn
+	if cm, ok := tc.(connWithMetrics); ok {
+		tc = cm.CapableConn
+	}
+	mc, ok := tc.(network.MessageConn)
+	return mc, ok
+}
+
+// SupportsMessages says if the underlying transport connection supports messages.
+func (c *Conn) SupportsMessages() bool {
+	mc, ok := c.messageConn()
+	return ok && mc.SupportsMessages()
+}
+
+// SendMessage sends a message to the peer.
+// It returns network.ErrMessagesNotSupported if the transport doesn't support messages.
+func (c *Conn) SendMessage(msg []byte) error {
+	mc, ok := c.messageConn()
+	if !ok {
+		return network.ErrMessagesNotSupported
+	}
+	return mc.SendMessage(msg)
+}
+
+// ReceiveMessage receives a message sent by the peer.
+// It returns network.ErrMessagesNotSupported if the transport doesn't support messages.
+func (c *Conn) ReceiveMessage(ctx context.Context) ([]byte, error) {
+	mc, ok := c.messageConn()
+	if !ok {
+		return nil, network.ErrMessagesNotSupported
+	}
+	return mc.ReceiveMessage(ctx)
+}
+
 // Stat returns metadata pertaining to this connection
 func (c *Conn) Stat() network.ConnStats {
 	c.streams.Lock()
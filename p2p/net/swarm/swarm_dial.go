@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"net/netip"
 	"strconv"
 	"sync"
@@ -14,9 +15,13 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
 	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/tracinghelper"
+
 	ma "github.com/multiformats/go-multiaddr"
 	madns "github.com/multiformats/go-multiaddr-dns"
 	manet "github.com/multiformats/go-multiaddr/net"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // The maximum number of address resolution steps we'll perform for a single
@@ -63,6 +68,9 @@ var (
 	// ErrGaterDisallowedConnection is returned when the gater prevents us from
 	// forming a connection with a peer.
 	ErrGaterDisallowedConnection = errors.New("gater disallows connection to peer")
+
+	// ErrMaintenanceMode is returned when we don't dial because the swarm is in maintenance mode.
+	ErrMaintenanceMode = errors.New("swarm is in maintenance mode")
 )
 
 // DialAttempts governs how many times a goroutine will try to dial a given peer.
@@ -91,11 +99,103 @@ var DefaultPerPeerRateLimit = 8
 type DialBackoff struct {
 	entries map[peer.ID]map[string]*backoffAddr
 	lock    sync.RWMutex
+
+	// params are the exponential backoff parameters per address class.
+	// Address classes without parameters use the quadratic backoff described at AddBackoff.
+	params map[AddrClass]BackoffParams
 }
 
 type backoffAddr struct {
 	tries int
 	until time.Time
+	class AddrClass
+}
+
+// AddrClass is the class of an address, used to configure the dial backoff.
+type AddrClass int
+
+const (
+	// AddrClassPublic are public addresses.
+	AddrClassPublic AddrClass = iota
+	// AddrClassPrivate are private, loopback and link-local addresses.
+	AddrClassPrivate
+	// AddrClassRelay are relay (circuit) addresses.
+	AddrClassRelay
+)
+
+func (c AddrClass) String() string {
+	switch c {
+	case AddrClassPublic:
+		return "public"
+	case AddrClassPrivate:
+		return "private"
+	case AddrClassRelay:
+		return "relay"
+	default:
+		return "unknown"
+	}
+}
+
+// GetAddrClass returns the class of addr.
+func GetAddrClass(addr ma.Multiaddr) AddrClass {
+	if isRelayAddr(addr) {
+		return AddrClassRelay
+	}
+	if manet.IsPublicAddr(addr) {
+		return AddrClassPublic
+	}
+	return AddrClassPrivate
+}
+
+// BackoffParams are the parameters of an exponential dial backoff.
+// After the n-th consecutive failed dial, an address is backed off for
+// Base * Multiplier^(n-1), up to Max.
+type BackoffParams struct {
+	Base       time.Duration
+	Multiplier float64
+	Max        time.Duration
+}
+
+func (p BackoffParams) validate() error {
+	if p.Base <= 0 || p.Max < p.Base || p.Multiplier < 1 {
+		return fmt.Errorf("invalid backoff parameters: %+v", p)
+	}
+	return nil
+}
+
+// SetBackoffParams configures an exponential backoff for addresses of the given class.
+// This only applies to backoffs added after the call.
+func (db *DialBackoff) SetBackoffParams(class AddrClass, params BackoffParams) error {
+	if err := params.validate(); err != nil {
+		return err
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	if db.params == nil {
+		db.params = make(map[AddrClass]BackoffParams)
+	}
+	db.params[class] = params
+	return nil
+}
+
+// backoffTime returns the backoff for an address of class c that failed tries times before.
+// db.lock must be held.
+func (db *DialBackoff) backoffTime(c AddrClass, tries int) time.Duration {
+	if params, ok := db.params[c]; ok {
+		backoffTime := float64(params.Base) * math.Pow(params.Multiplier, float64(tries))
+		if backoffTime > float64(params.Max) {
+			return params.Max
+		}
+		return time.Duration(backoffTime)
+	}
+	if tries == 0 {
+		return BackoffBase
+	}
+	backoffTime := BackoffBase + BackoffCoef*time.Duration(tries*tries)
+	if backoffTime > BackoffMax {
+		backoffTime = BackoffMax
+	}
+	return backoffTime
 }
 
 func (db *DialBackoff) init(ctx context.Context) {
@@ -128,6 +228,36 @@ func (db *DialBackoff) Backoff(p peer.ID, addr ma.Multiaddr) (backoff bool) {
 	return found && time.Now().Before(ap.until)
 }
 
+// BackoffUntil returns the time at which the first of the backed off addresses of peer p
+// can be dialed again. Dials to p that only use backed off addresses fail with ErrDialBackoff
+// until then. It returns the zero time if none of p's addresses are backed off.
+func (db *DialBackoff) BackoffUntil(p peer.ID) time.Time {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	now := time.Now()
+	var until time.Time
+	for _, ap := range db.entries[p] {
+		if now.Before(ap.until) && (until.IsZero() || ap.until.Before(until)) {
+			until = ap.until
+		}
+	}
+	return until
+}
+
+// AddrBackoffUntil returns the time until which address addr of peer p is backed off,
+// or the zero time if it isn't backed off.
+func (db *DialBackoff) AddrBackoffUntil(p peer.ID, addr ma.Multiaddr) time.Time {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	ap, found := db.entries[p][string(addr.Bytes())]
+	if !found || !time.Now().Before(ap.until) {
+		return time.Time{}
+	}
+	return ap.until
+}
+
 // BackoffBase is the base amount of time to backoff (default: 5s).
 var BackoffBase = time.Second * 5
 
@@ -139,8 +269,8 @@ var BackoffMax = time.Minute * 5
 
 // AddBackoff adds peer's address to backoff.
 //
-// Backoff is not exponential, it's quadratic and computed according to the
-// following formula:
+// Unless configured otherwise using SetBackoffParams, backoff is not exponential,
+// it's quadratic and computed according to the following formula:
 //
 //	BackoffBase + BakoffCoef * PriorBackoffs^2
 //
@@ -156,18 +286,16 @@ func (db *DialBackoff) AddBackoff(p peer.ID, addr ma.Multiaddr) {
 	}
 	ba, ok := bp[saddr]
 	if !ok {
+		class := GetAddrClass(addr)
 		bp[saddr] = &backoffAddr{
 			tries: 1,
-			until: time.Now().Add(BackoffBase),
+			until: time.Now().Add(db.backoffTime(class, 0)),
+			class: class,
 		}
 		return
 	}
 
-	backoffTime := BackoffBase + BackoffCoef*time.Duration(ba.tries*ba.tries)
-	if backoffTime > BackoffMax {
-		backoffTime = BackoffMax
-	}
-	ba.until = time.Now().Add(backoffTime)
+	ba.until = time.Now().Add(db.backoffTime(ba.class, ba.tries))
 	ba.tries++
 }
 
@@ -179,6 +307,20 @@ func (db *DialBackoff) Clear(p peer.ID) {
 	delete(db.entries, p)
 }
 
+// ClearAddr removes the backoff record of address addr of peer p.
+func (db *DialBackoff) ClearAddr(p peer.ID, addr ma.Multiaddr) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	bp, ok := db.entries[p]
+	if !ok {
+		return
+	}
+	delete(bp, string(addr.Bytes()))
+	if len(bp) == 0 {
+		delete(db.entries, p)
+	}
+}
+
 func (db *DialBackoff) cleanup() {
 	db.lock.Lock()
 	defer db.lock.Unlock()
@@ -186,11 +328,7 @@ func (db *DialBackoff) cleanup() {
 	for p, e := range db.entries {
 		good := false
 		for _, backoff := range e {
-			backoffTime := BackoffBase + BackoffCoef*time.Duration(backoff.tries*backoff.tries)
-			if backoffTime > BackoffMax {
-				backoffTime = BackoffMax
-			}
-			if now.Before(backoff.until.Add(backoffTime)) {
+			if now.Before(backoff.until.Add(db.backoffTime(backoff.class, backoff.tries))) {
 				good = true
 				break
 			}
@@ -238,16 +376,29 @@ func (s *Swarm) dialPeer(ctx context.Context, p peer.ID) (*Conn, error) {
 		return conn, err
 	}
 
+	if err := s.checkMaintenanceMode(); err != nil {
+		return nil, &DialError{Peer: p, Cause: err}
+	}
+
 	if s.gater != nil && !s.gater.InterceptPeerDial(p) {
 		log.Debugf("gater disallowed outbound connection to peer %s", p.Pretty())
 		return nil, &DialError{Peer: p, Cause: ErrGaterDisallowedConnection}
 	}
 
 	// apply the DialPeer timeout
-	ctx, cancel := context.WithTimeout(ctx, network.GetDialPeerTimeout(ctx))
+	timeout := network.GetDialPeerTimeout(ctx)
+	if s.dialBudget.Total > 0 && !network.HasDialBudget(ctx) {
+		ctx = network.WithDialBudget(ctx, s.dialBudget)
+		if s.dialBudget.Total < timeout {
+			timeout = s.dialBudget.Total
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
+	ctx, span := s.tracer.Start(ctx, "swarm.DialPeer", trace.WithAttributes(attribute.Stringer("peer.id", p)))
 	conn, err = s.dsync.Dial(ctx, p)
+	tracinghelper.EndSpan(span, err)
 	if err == nil {
 		// Ensure we connected to the correct peer.
 		// This was most likely already checked by the security protocol, but it doesn't hurt do it again here.
@@ -281,7 +432,14 @@ func (s *Swarm) dialWorkerLoop(p peer.ID, reqch <-chan dialRequest) {
 }
 
 func (s *Swarm) addrsForDial(ctx context.Context, p peer.ID) ([]ma.Multiaddr, error) {
+	ctx, cancel := network.WithDialStage(ctx, network.DialStageResolve)
+	defer cancel()
+
 	peerAddrs := s.peers.Addrs(p)
+	pref, hasPref := s.GetDialPreference(p)
+	if hasPref {
+		peerAddrs = append(peerAddrs, pref.Addrs...)
+	}
 	if len(peerAddrs) == 0 {
 		return nil, ErrNoAddresses
 	}
@@ -310,12 +468,24 @@ func (s *Swarm) addrsForDial(ctx context.Context, p peer.ID) ([]ma.Multiaddr, er
 	if err != nil {
 		return nil, err
 	}
+	if s.nat64 != nil {
+		resolved = s.nat64.synthesize(resolved)
+	}
+	if s.ip6LinkLocal {
+		resolved = scopeLinkLocalAddrs(resolved, linkLocalZones())
+	}
 
 	goodAddrs := s.filterKnownUndialables(p, resolved)
 	if forceDirect, _ := network.GetForceDirectDial(ctx); forceDirect {
 		goodAddrs = ma.FilterAddrs(goodAddrs, s.nonProxyAddr)
 	}
+	if filter, _, ok := network.GetAdditionalConnection(ctx); ok {
+		goodAddrs = ma.FilterAddrs(goodAddrs, filter)
+	}
 	goodAddrs = ma.Unique(goodAddrs)
+	if hasPref {
+		goodAddrs = pref.filter(goodAddrs)
+	}
 
 	if len(goodAddrs) == 0 {
 		return nil, ErrNoGoodAddresses
@@ -446,8 +616,10 @@ func (s *Swarm) filterKnownUndialables(p peer.ID, addrs []ma.Multiaddr) []ma.Mul
 
 	return ma.FilterAddrs(addrs,
 		func(addr ma.Multiaddr) bool { return !ma.Contains(ourAddrs, addr) },
-		// TODO: Consider allowing link-local addresses
-		func(addr ma.Multiaddr) bool { return !manet.IsIP6LinkLocal(addr) },
+		// link-local addresses can only be dialed if they're scoped to one of our interfaces
+		func(addr ma.Multiaddr) bool {
+			return !manet.IsIP6LinkLocal(addr) || (s.ip6LinkLocal && hasIP6Zone(addr))
+		},
 		func(addr ma.Multiaddr) bool {
 			return s.gater == nil || s.gater.InterceptAddrDial(p, addr)
 		},
@@ -482,6 +654,10 @@ func (s *Swarm) dialAddr(ctx context.Context, p peer.ID, addr ma.Multiaddr) (tra
 		log.Debugf("%s swarm not dialing. Context cancelled: %v. %s %s", s.local, err, p, addr)
 		return nil, err
 	}
+	// Dials that were queued before entering maintenance mode
+	if err := s.checkMaintenanceMode(); err != nil {
+		return nil, err
+	}
 	log.Debugf("%s swarm dialing %s %s", s.local, p, addr)
 
 	tpt := s.TransportForDialing(addr)
@@ -490,7 +666,9 @@ func (s *Swarm) dialAddr(ctx context.Context, p peer.ID, addr ma.Multiaddr) (tra
 	}
 
 	start := time.Now()
+	ctx, span := s.tracer.Start(ctx, "swarm.dialAddr", trace.WithAttributes(attribute.Stringer("peer.id", p), attribute.Stringer("addr", addr)))
 	connC, err := tpt.Dial(ctx, addr, p)
+	tracinghelper.EndSpan(span, err)
 
 	// We're recording any error as a failure here.
 	// Notably, this also applies to cancelations (i.e. if another dial attempt was faster).
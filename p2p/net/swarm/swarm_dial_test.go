@@ -373,3 +373,44 @@ func TestBlackHoledAddrBlocked(t *testing.T) {
 		t.Fatalf("expected to receive an error of type *DialError, got %s of type %T", err, err)
 	}
 }
+
+func TestDialBackoffState(t *testing.T) {
+	var db DialBackoff
+	db.init(context.Background())
+	require.NoError(t, db.SetBackoffParams(AddrClassRelay, BackoffParams{Base: time.Minute, Multiplier: 2, Max: 3 * time.Minute}))
+	require.Error(t, db.SetBackoffParams(AddrClassPublic, BackoffParams{Base: time.Minute, Multiplier: 0.5, Max: time.Hour}))
+
+	p := test.RandPeerIDFatal(t)
+	public := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
+	private := ma.StringCast("/ip4/192.168.1.1/tcp/1234")
+	relay := ma.StringCast("/ip4/1.2.3.4/tcp/1234/p2p/QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC/p2p-circuit")
+	require.Equal(t, AddrClassPublic, GetAddrClass(public))
+	require.Equal(t, AddrClassPrivate, GetAddrClass(private))
+	require.Equal(t, AddrClassRelay, GetAddrClass(relay))
+
+	require.True(t, db.BackoffUntil(p).IsZero())
+
+	start := time.Now()
+	db.AddBackoff(p, public)
+	db.AddBackoff(p, relay)
+	require.True(t, db.Backoff(p, public))
+	require.False(t, db.Backoff(p, private))
+	// the public address uses the default quadratic backoff, and becomes dialable first
+	require.WithinDuration(t, start.Add(BackoffBase), db.BackoffUntil(p), time.Second)
+	require.WithinDuration(t, start.Add(time.Minute), db.AddrBackoffUntil(p, relay), time.Second)
+	require.True(t, db.AddrBackoffUntil(p, private).IsZero())
+
+	// the relay address uses exponential backoff
+	db.AddBackoff(p, relay)
+	require.WithinDuration(t, time.Now().Add(2*time.Minute), db.AddrBackoffUntil(p, relay), time.Second)
+	db.AddBackoff(p, relay)
+	require.WithinDuration(t, time.Now().Add(3*time.Minute), db.AddrBackoffUntil(p, relay), time.Second)
+
+	db.ClearAddr(p, public)
+	require.False(t, db.Backoff(p, public))
+	require.WithinDuration(t, time.Now().Add(3*time.Minute), db.BackoffUntil(p), time.Second)
+
+	db.Clear(p)
+	require.False(t, db.Backoff(p, relay))
+	require.True(t, db.BackoffUntil(p).IsZero())
+}
@@ -2,11 +2,13 @@ package swarm_test
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peerstore"
 	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
 	. "github.com/libp2p/go-libp2p/p2p/net/swarm"
 	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
@@ -113,3 +115,50 @@ func TestNoDeadlockWhenConsumingConnectednessEvents(t *testing.T) {
 
 	// The test should finish without deadlocking
 }
+
+func TestDialAddrsSkippedEventOnSuccess(t *testing.T) {
+	bus := eventbus.NewBus()
+	// Dial the real address first, and the (unreachable) other addresses after a long delay.
+	var realAddr ma.Multiaddr
+	ranker := func(addrs []ma.Multiaddr) []network.AddrDelay {
+		res := make([]network.AddrDelay, 0, len(addrs))
+		for _, a := range addrs {
+			delay := time.Hour
+			if a.Equal(realAddr) {
+				delay = 0
+			}
+			res = append(res, network.AddrDelay{Addr: a, Delay: delay})
+		}
+		return res
+	}
+	s1 := swarmt.GenSwarm(t, swarmt.EventBus(bus), swarmt.OptDisableQUIC, swarmt.OptDialOnly,
+		swarmt.WithSwarmOpts(WithMaxAddrsPerDial(2), WithDialRanker(ranker)))
+	defer s1.Close()
+	s2 := swarmt.GenSwarm(t, swarmt.OptDisableQUIC)
+	defer s2.Close()
+	realAddr = s2.ListenAddresses()[0]
+
+	sub, err := bus.Subscribe(new(event.EvtDialAddrsSkipped))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	addrs := []ma.Multiaddr{realAddr}
+	for i := 1; i <= 3; i++ {
+		addrs = append(addrs, ma.StringCast(fmt.Sprintf("/ip4/1.2.3.4/tcp/%d", i)))
+	}
+	s1.Peerstore().AddAddrs(s2.LocalPeer(), addrs, peerstore.PermanentAddrTTL)
+	_, err = s1.DialPeer(context.Background(), s2.LocalPeer())
+	require.NoError(t, err)
+
+	select {
+	case e := <-sub.Out():
+		evt := e.(event.EvtDialAddrsSkipped)
+		require.Equal(t, s2.LocalPeer(), evt.Peer)
+		require.Len(t, evt.Skipped, 2)
+		for _, a := range evt.Skipped {
+			require.False(t, a.Equal(realAddr))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected an EvtDialAddrsSkipped")
+	}
+}
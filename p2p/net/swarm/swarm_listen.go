@@ -3,9 +3,11 @@ package swarm
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/canonicallog"
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/transport"
 
@@ -43,8 +45,11 @@ func (s *Swarm) Listen(addrs ...ma.Multiaddr) error {
 // Listener will close for *all* addresses it provides. For example if you close
 // and address with `/quic`, then the QUIC listener will close and also close
 // any `/quic-v1` address.
+//
+// An EvtListenerClosed is emitted for every listener that is closed.
 func (s *Swarm) ListenClose(addrs ...ma.Multiaddr) {
-	listenersToClose := make(map[transport.Listener]struct{}, len(addrs))
+	// listener -> address passed to Listen
+	listenersToClose := make(map[transport.Listener]ma.Multiaddr, len(addrs))
 
 	s.listeners.Lock()
 	for l := range s.listeners.m {
@@ -53,14 +58,57 @@ func (s *Swarm) ListenClose(addrs ...ma.Multiaddr) {
 		}
 
 		delete(s.listeners.m, l)
-		listenersToClose[l] = struct{}{}
+		listenersToClose[l] = l.Multiaddr()
+	}
+	for st := range s.listeners.status {
+		if _, ok := listenersToClose[st.listener]; ok || containsMultiaddr(addrs, st.addr) {
+			if ok {
+				listenersToClose[st.listener] = st.addr
+			}
+			// This also stops restarting the listener, if it failed.
+			delete(s.listeners.status, st)
+		}
 	}
 	s.listeners.cacheEOL = time.Time{}
 	s.listeners.Unlock()
 
-	for l := range listenersToClose {
+	for l, addr := range listenersToClose {
 		l.Close()
+		s.listenerClosedEmitter.Emit(event.EvtListenerClosed{Addr: addr, ListenAddr: l.Multiaddr()})
+	}
+}
+
+// listenerStatus is the status of a listen address.
+// All fields are protected by the listeners lock.
+type listenerStatus struct {
+	addr ma.Multiaddr
+	// listener is nil while the listener is failed
+	listener transport.Listener
+	err      error
+	restarts int
+}
+
+// ListenStatus returns the status of the listeners.
+func (s *Swarm) ListenStatus() []network.ListenerStatus {
+	s.listeners.RLock()
+	defer s.listeners.RUnlock()
+
+	statuses := make([]network.ListenerStatus, 0, len(s.listeners.status))
+	for st := range s.listeners.status {
+		status := network.ListenerStatus{
+			Addr:     st.addr,
+			State:    network.ListenerFailed,
+			Err:      st.err,
+			Restarts: st.restarts,
+		}
+		if st.listener != nil {
+			status.State = network.ListenerActive
+			status.ListenAddr = st.listener.Multiaddr()
+		}
+		statuses = append(statuses, status)
 	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Addr.String() < statuses[j].Addr.String() })
+	return statuses
 }
 
 // AddListenAddr tells the swarm to listen on a single address. Unlike Listen,
@@ -85,15 +133,30 @@ func (s *Swarm) AddListenAddr(a ma.Multiaddr) error {
 	if err != nil {
 		return err
 	}
+	return s.addListener(&listenerStatus{addr: a}, list, false)
+}
+
+// errListenerRemoved is returned when restarting a listener that was closed in the meantime.
+var errListenerRemoved = errors.New("listener removed")
 
+// addListener starts accepting connections on list.
+// If restart is true, st is a failed listener that is being restarted.
+func (s *Swarm) addListener(st *listenerStatus, list transport.Listener, restart bool) error {
 	s.listeners.Lock()
 	if s.listeners.m == nil {
 		s.listeners.Unlock()
 		list.Close()
 		return ErrSwarmClosed
 	}
+	if _, ok := s.listeners.status[st]; restart && !ok {
+		s.listeners.Unlock()
+		list.Close()
+		return errListenerRemoved
+	}
 	s.refs.Add(1)
 	s.listeners.m[list] = struct{}{}
+	s.listeners.status[st] = struct{}{}
+	st.listener = list
 	s.listeners.cacheEOL = time.Time{}
 	s.listeners.Unlock()
 
@@ -105,18 +168,24 @@ func (s *Swarm) AddListenAddr(a ma.Multiaddr) error {
 	})
 
 	go func() {
+		var acceptErr error
 		defer func() {
 			s.listeners.Lock()
 			_, ok := s.listeners.m[list]
 			if ok {
 				delete(s.listeners.m, list)
 				s.listeners.cacheEOL = time.Time{}
+				st.listener = nil
+				st.err = acceptErr
 			}
 			s.listeners.Unlock()
 
 			if ok {
 				list.Close()
-				log.Errorf("swarm listener unintentionally closed")
+				log.Errorw("swarm listener unintentionally closed", "addr", maddr, "error", acceptErr)
+				s.listenerFailedEmitter.Emit(event.EvtListenerFailed{Addr: st.addr, ListenAddr: maddr, Err: acceptErr})
+				s.refs.Add(1)
+				go s.restartListener(st)
 			}
 
 			// signal to our notifiees on listen close.
@@ -129,8 +198,9 @@ func (s *Swarm) AddListenAddr(a ma.Multiaddr) error {
 			c, err := list.Accept()
 			if err != nil {
 				if !errors.Is(err, transport.ErrListenerClosed) {
-					log.Errorf("swarm listener for %s accept error: %s", a, err)
+					log.Errorf("swarm listener for %s accept error: %s", maddr, err)
 				}
+				acceptErr = err
 				return
 			}
 			canonicallog.LogPeerStatus(100, c.RemotePeer(), c.RemoteMultiaddr(), "connection_status", "established", "dir", "inbound")
@@ -149,7 +219,7 @@ func (s *Swarm) AddListenAddr(a ma.Multiaddr) error {
 					// ignore.
 					return
 				default:
-					log.Warnw("adding connection failed", "to", a, "error", err)
+					log.Warnw("adding connection failed", "to", maddr, "error", err)
 					return
 				}
 			}()
@@ -158,6 +228,58 @@ func (s *Swarm) AddListenAddr(a ma.Multiaddr) error {
 	return nil
 }
 
+// restartListener restarts a failed listener, with an exponential backoff.
+// It gives up once the swarm is closed, or ListenClose is called for the address.
+func (s *Swarm) restartListener(st *listenerStatus) {
+	defer s.refs.Done()
+
+	backoff := s.listenerRestartBackoff.initial
+	for attempt := 1; ; attempt++ {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		}
+		backoff *= 2
+		if backoff > s.listenerRestartBackoff.max {
+			backoff = s.listenerRestartBackoff.max
+		}
+
+		s.listeners.RLock()
+		_, ok := s.listeners.status[st]
+		s.listeners.RUnlock()
+		if !ok {
+			return
+		}
+
+		var list transport.Listener
+		tpt := s.TransportForListening(st.addr)
+		err := ErrNoTransport
+		if tpt != nil {
+			list, err = tpt.Listen(st.addr)
+		}
+		if err != nil {
+			log.Debugw("failed to restart listener", "addr", st.addr, "attempt", attempt, "error", err)
+			s.listeners.Lock()
+			st.err = err
+			s.listeners.Unlock()
+			continue
+		}
+
+		s.listeners.Lock()
+		st.restarts++
+		s.listeners.Unlock()
+		if err := s.addListener(st, list, true); err != nil {
+			return
+		}
+		log.Infow("restarted listener", "addr", st.addr, "listen_addr", list.Multiaddr(), "attempts", attempt)
+		s.listenerRestartedEmitter.Emit(event.EvtListenerRestarted{Addr: st.addr, ListenAddr: list.Multiaddr(), Attempts: attempt})
+		return
+	}
+}
+
 func containsMultiaddr(addrs []ma.Multiaddr, addr ma.Multiaddr) bool {
 	for _, a := range addrs {
 		if addr.Equal(a) {
@@ -0,0 +1,181 @@
+package swarm_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+// failingListener is a listener whose Accept fails once fail is called.
+type failingListener struct {
+	addr      ma.Multiaddr
+	closeOnce sync.Once
+	closed    chan struct{}
+	failCh    chan error
+}
+
+func (l *failingListener) Accept() (transport.CapableConn, error) {
+	select {
+	case err := <-l.failCh:
+		return nil, err
+	case <-l.closed:
+		return nil, transport.ErrListenerClosed
+	}
+}
+
+func (l *failingListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *failingListener) Addr() net.Addr          { return nil }
+func (l *failingListener) Multiaddr() ma.Multiaddr { return l.addr }
+
+type failingListenTransport struct {
+	mx sync.Mutex
+	// listenErrs is the number of Listen calls that fail
+	listenErrs int
+	listeners  []*failingListener
+}
+
+var _ transport.Transport = &failingListenTransport{}
+
+func (t *failingListenTransport) Dial(context.Context, ma.Multiaddr, peer.ID) (transport.CapableConn, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (t *failingListenTransport) CanDial(ma.Multiaddr) bool { return false }
+
+func (t *failingListenTransport) Listen(laddr ma.Multiaddr) (transport.Listener, error) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	if t.listenErrs > 0 {
+		t.listenErrs--
+		return nil, errors.New("address in use")
+	}
+	l := &failingListener{addr: laddr, closed: make(chan struct{}), failCh: make(chan error, 1)}
+	t.listeners = append(t.listeners, l)
+	return l, nil
+}
+
+func (t *failingListenTransport) lastListener() *failingListener {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return t.listeners[len(t.listeners)-1]
+}
+
+func (t *failingListenTransport) numListeners() int {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	return len(t.listeners)
+}
+
+func (t *failingListenTransport) Protocols() []int { return []int{ma.P_TCP} }
+func (t *failingListenTransport) Proxy() bool      { return false }
+func (t *failingListenTransport) Close() error     { return nil }
+
+func TestListenerRestart(t *testing.T) {
+	bus := eventbus.NewBus()
+	s := swarmt.GenSwarm(t,
+		swarmt.OptDisableTCP,
+		swarmt.OptDisableQUIC,
+		swarmt.EventBus(bus),
+		swarmt.WithSwarmOpts(swarm.WithListenerRestartBackoff(10*time.Millisecond, 20*time.Millisecond)),
+	)
+	defer s.Close()
+	sub, err := bus.Subscribe([]interface{}{new(event.EvtListenerFailed), new(event.EvtListenerRestarted)})
+	require.NoError(t, err)
+	defer sub.Close()
+
+	tpt := &failingListenTransport{}
+	require.NoError(t, s.AddTransport(tpt))
+	addr := ma.StringCast("/ip4/127.0.0.1/tcp/1234")
+	require.NoError(t, s.Listen(addr))
+	require.Equal(t, []network.ListenerStatus{{Addr: addr, ListenAddr: addr, State: network.ListenerActive}}, s.ListenStatus())
+
+	// The first two attempts to restart the listener fail.
+	tpt.mx.Lock()
+	tpt.listenErrs = 2
+	tpt.mx.Unlock()
+	acceptErr := errors.New("accept failed")
+	tpt.lastListener().failCh <- acceptErr
+
+	select {
+	case e := <-sub.Out():
+		evt, ok := e.(event.EvtListenerFailed)
+		require.True(t, ok, "expected an EvtListenerFailed, got %T", e)
+		require.Equal(t, addr, evt.Addr)
+		require.Equal(t, addr, evt.ListenAddr)
+		require.ErrorIs(t, evt.Err, acceptErr)
+	case <-time.After(time.Second):
+		t.Fatal("expected an EvtListenerFailed")
+	}
+
+	select {
+	case e := <-sub.Out():
+		evt, ok := e.(event.EvtListenerRestarted)
+		require.True(t, ok, "expected an EvtListenerRestarted, got %T", e)
+		require.Equal(t, addr, evt.Addr)
+		require.Equal(t, 3, evt.Attempts)
+	case <-time.After(time.Second):
+		t.Fatal("expected an EvtListenerRestarted")
+	}
+	require.Equal(t, 2, tpt.numListeners())
+	st := s.ListenStatus()
+	require.Len(t, st, 1)
+	require.Equal(t, network.ListenerActive, st[0].State)
+	require.Equal(t, 1, st[0].Restarts)
+	require.Equal(t, []ma.Multiaddr{addr}, s.ListenAddresses())
+
+	// Closing the address while the listener is failed stops the restarts.
+	tpt.mx.Lock()
+	tpt.listenErrs = 1000
+	tpt.mx.Unlock()
+	tpt.lastListener().failCh <- acceptErr
+	require.Eventually(t, func() bool {
+		st := s.ListenStatus()
+		return len(st) == 1 && st[0].State == network.ListenerFailed && st[0].Err != nil && st[0].Err.Error() == "address in use"
+	}, time.Second, 5*time.Millisecond)
+	require.Empty(t, s.ListenAddresses())
+	s.ListenClose(addr)
+	require.Empty(t, s.ListenStatus())
+}
+
+func TestListenCloseEvent(t *testing.T) {
+	bus := eventbus.NewBus()
+	s := swarmt.GenSwarm(t, swarmt.OptDialOnly, swarmt.OptDisableQUIC, swarmt.EventBus(bus))
+	defer s.Close()
+	sub, err := bus.Subscribe(new(event.EvtListenerClosed))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	addr := ma.StringCast("/ip4/127.0.0.1/tcp/0")
+	require.NoError(t, s.Listen(addr))
+	listenAddrs := s.ListenAddresses()
+	require.Len(t, listenAddrs, 1)
+
+	s.ListenClose(listenAddrs[0])
+	select {
+	case e := <-sub.Out():
+		evt := e.(event.EvtListenerClosed)
+		require.Equal(t, addr, evt.Addr)
+		require.Equal(t, listenAddrs[0], evt.ListenAddr)
+	case <-time.After(time.Second):
+		t.Fatal("expected an EvtListenerClosed")
+	}
+	require.Empty(t, s.ListenAddresses())
+}
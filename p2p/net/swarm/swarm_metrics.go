@@ -35,6 +35,14 @@ var (
 		},
 		[]string{"dir", "key_type"},
 	)
+	cipherSuites = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "cipher_suites_total",
+			Help:      "Cipher suites negotiated by the security handshake",
+		},
+		[]string{"dir", "transport", "security", "cipher_suite"},
+	)
 	connsClosed = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: metricNamespace,
@@ -112,6 +120,7 @@ var (
 	collectors = []prometheus.Collector{
 		connsOpened,
 		keyTypes,
+		cipherSuites,
 		connsClosed,
 		dialError,
 		connDuration,
@@ -138,6 +147,24 @@ type metricsTracer struct{}
 
 var _ MetricsTracer = &metricsTracer{}
 
+type nopMetricsTracer struct{}
+
+var _ MetricsTracer = nopMetricsTracer{}
+
+// NopMetricsTracer returns a MetricsTracer that doesn't record anything.
+// It can be wrapped by MetricsTracers that don't need to forward to a Prometheus MetricsTracer.
+func NopMetricsTracer() MetricsTracer { return nopMetricsTracer{} }
+
+func (nopMetricsTracer) OpenedConnection(network.Direction, crypto.PubKey, network.ConnectionState, ma.Multiaddr) {
+}
+func (nopMetricsTracer) ClosedConnection(network.Direction, time.Duration, network.ConnectionState, ma.Multiaddr) {
+}
+func (nopMetricsTracer) CompletedHandshake(time.Duration, network.ConnectionState, ma.Multiaddr) {}
+func (nopMetricsTracer) FailedDialing(ma.Multiaddr, error)                                       {}
+func (nopMetricsTracer) DialCompleted(bool, int)                                                 {}
+func (nopMetricsTracer) DialRankingDelay(time.Duration)                                          {}
+func (nopMetricsTracer) UpdatedBlackHoleFilterState(string, blackHoleState, int, float64)        {}
+
 type metricsTracerSetting struct {
 	reg prometheus.Registerer
 }
@@ -190,6 +217,16 @@ func (m *metricsTracer) OpenedConnection(dir network.Direction, p crypto.PubKey,
 	*tags = append(*tags, metricshelper.GetIPVersion(laddr))
 	connsOpened.WithLabelValues(*tags...).Inc()
 
+	// The transport is tags[1] and the security protocol tags[2], see appendConnectionState.
+	transport, security := (*tags)[1], (*tags)[2]
+	cipherSuite := cs.CipherSuite
+	if cipherSuite == "" {
+		cipherSuite = "unknown"
+	}
+	*tags = (*tags)[:0]
+	*tags = append(*tags, metricshelper.GetDirection(dir), transport, security, cipherSuite)
+	cipherSuites.WithLabelValues(*tags...).Inc()
+
 	*tags = (*tags)[:0]
 	*tags = append(*tags, metricshelper.GetDirection(dir))
 	*tags = append(*tags, p.Type().String())
@@ -50,9 +50,9 @@ func TestMetricsNoAllocNoCover(t *testing.T) {
 	mt := NewMetricsTracer()
 
 	connections := []network.ConnectionState{
-		{StreamMultiplexer: "yamux", Security: "tls", Transport: "tcp", UsedEarlyMuxerNegotiation: true},
-		{StreamMultiplexer: "yamux", Security: "noise", Transport: "tcp", UsedEarlyMuxerNegotiation: false},
-		{StreamMultiplexer: "", Security: "", Transport: "quic"},
+		{StreamMultiplexer: "yamux", Security: "tls", Transport: "tcp", UsedEarlyMuxerNegotiation: true, CipherSuite: "TLS_AES_128_GCM_SHA256"},
+		{StreamMultiplexer: "yamux", Security: "noise", Transport: "tcp", UsedEarlyMuxerNegotiation: false, CipherSuite: "Noise_XX_25519_ChaChaPoly_SHA256"},
+		{StreamMultiplexer: "", Security: "", Transport: "quic", CipherSuite: "TLS_CHACHA20_POLY1305_SHA256"},
 		{StreamMultiplexer: "mplex", Security: "noise", Transport: "tcp"},
 	}
 
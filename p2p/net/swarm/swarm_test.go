@@ -377,6 +377,21 @@ func TestCloseWithOpenStreams(t *testing.T) {
 	require.NoError(t, swarms[0].Close())
 }
 
+func TestMessagesNotSupported(t *testing.T) {
+	ctx := context.Background()
+	swarms := makeSwarms(t, 2, OptDisableQUIC)
+	connectSwarms(t, ctx, swarms)
+
+	conns := swarms[0].ConnsToPeer(swarms[1].LocalPeer())
+	require.NotEmpty(t, conns)
+	mc, ok := conns[0].(network.MessageConn)
+	require.True(t, ok)
+	require.False(t, mc.SupportsMessages())
+	require.ErrorIs(t, mc.SendMessage([]byte("foobar")), network.ErrMessagesNotSupported)
+	_, err := mc.ReceiveMessage(ctx)
+	require.ErrorIs(t, err, network.ErrMessagesNotSupported)
+}
+
 func TestTypedNilConn(t *testing.T) {
 	s := GenSwarm(t)
 	defer s.Close()
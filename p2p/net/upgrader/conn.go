@@ -19,6 +19,7 @@ type transportConn struct {
 	muxer                     protocol.ID
 	security                  protocol.ID
 	usedEarlyMuxerNegotiation bool
+	cipherSuite               string
 }
 
 var _ transport.CapableConn = &transportConn{}
@@ -61,5 +62,6 @@ func (t *transportConn) ConnState() network.ConnectionState {
 		Security:                  t.security,
 		Transport:                 "tcp",
 		UsedEarlyMuxerNegotiation: t.usedEarlyMuxerNegotiation,
+		CipherSuite:               t.cipherSuite,
 	}
 }
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/libp2p/go-libp2p/core/connmgr"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/transport"
 
@@ -127,6 +128,10 @@ func (l *listener) handleIncoming() {
 					err,
 					maconn.LocalMultiaddr(),
 					maconn.RemoteMultiaddr())
+				// Failures caused by closing the listener are not the remote's fault.
+				if r, ok := l.upgrader.connGater.(connmgr.OffenseRecorder); ok && l.ctx.Err() == nil && isHandshakeOffense(err) {
+					r.RecordOffense("", maconn.RemoteMultiaddr(), connmgr.OffenseHandshakeFailure)
+				}
 				connScope.Done()
 				return
 			}
@@ -16,6 +16,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/sec"
 	"github.com/libp2p/go-libp2p/core/sec/insecure"
 	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/net/conngater"
 	"github.com/libp2p/go-libp2p/p2p/net/upgrader"
 
 	"github.com/golang/mock/gomock"
@@ -334,6 +335,46 @@ func TestListenerConnectionGater(t *testing.T) {
 	_ = conn.Close()
 }
 
+func TestListenerAutoGating(t *testing.T) {
+	gater, err := conngater.NewAutoGater(nil, conngater.WithErrorBudget(1.5))
+	require.NoError(t, err)
+	id, u := createUpgraderWithMuxers(t, []upgrader.StreamMuxer{{ID: "negotiate", Muxer: &negotiatingMuxer{}}}, nil, gater,
+		upgrader.WithAcceptTimeout(200*time.Millisecond))
+	ln := createListener(t, u)
+	defer ln.Close()
+
+	// Connections that are closed by the remote, or time out, are not offenses.
+	for i := 0; i < 2; i++ {
+		c, err := manet.Dial(ln.Multiaddr())
+		require.NoError(t, err)
+		c.Close()
+	}
+	for i := 0; i < 2; i++ {
+		c, err := manet.Dial(ln.Multiaddr())
+		require.NoError(t, err)
+		// wait for the listener to give up on the connection
+		_, err = io.Copy(io.Discard, c)
+		require.NoError(t, err)
+		c.Close()
+	}
+	require.Empty(t, gater.ListBlocked())
+
+	// connections that fail the handshake are charged against the IP address
+	for i := 0; i < 2; i++ {
+		c, err := manet.Dial(ln.Multiaddr())
+		require.NoError(t, err)
+		// a multistream message with an unexpected protocol
+		_, err = c.Write(append([]byte{8}, "garbage\n"...))
+		require.NoError(t, err)
+		io.Copy(io.Discard, c)
+		c.Close()
+	}
+	require.Eventually(t, func() bool { return len(gater.ListBlocked()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	_, err = dial(t, u, ln.Multiaddr(), id, &network.NullScope{})
+	require.Error(t, err)
+}
+
 func TestListenerResourceManagement(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
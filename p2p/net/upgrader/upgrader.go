@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"syscall"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/connmgr"
@@ -15,9 +17,12 @@ import (
 	"github.com/libp2p/go-libp2p/core/sec"
 	"github.com/libp2p/go-libp2p/core/transport"
 	"github.com/libp2p/go-libp2p/p2p/net/pnet"
+	"github.com/libp2p/go-libp2p/p2p/tracinghelper"
 
 	manet "github.com/multiformats/go-multiaddr/net"
 	mss "github.com/multiformats/go-multistream"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ErrNilPeer is returned when attempting to upgrade an outbound connection
@@ -28,6 +33,9 @@ var ErrNilPeer = errors.New("nil peer")
 var AcceptQueueLength = 16
 
 const (
+	// tracerName is the name of the OpenTelemetry tracer of the upgrader.
+	tracerName = "github.com/libp2p/go-libp2p/p2p/net/upgrader"
+
 	defaultAcceptTimeout    = 15 * time.Second
 	defaultNegotiateTimeout = 60 * time.Second
 )
@@ -41,6 +49,16 @@ func WithAcceptTimeout(t time.Duration) Option {
 	}
 }
 
+// WithTracerProvider records OpenTelemetry spans for connection upgrades using tp.
+// The security handshake and the stream multiplexer negotiation are recorded as child spans.
+// For outbound connections, the spans are children of the span of the context passed to Upgrade, if any.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(u *upgrader) error {
+		u.tracer = tracinghelper.Tracer(tp, tracerName)
+		return nil
+	}
+}
+
 type StreamMuxer struct {
 	ID    protocol.ID
 	Muxer network.Multiplexer
@@ -67,6 +85,8 @@ type upgrader struct {
 	//
 	// If unset, the default value (15s) is used.
 	acceptTimeout time.Duration
+
+	tracer trace.Tracer
 }
 
 var _ transport.Upgrader = &upgrader{}
@@ -81,6 +101,7 @@ func New(security []sec.SecureTransport, muxers []StreamMuxer, psk ipnet.PSK, rc
 		muxers:        muxers,
 		security:      security,
 		securityMuxer: mss.NewMultistreamMuxer[protocol.ID](),
+		tracer:        tracinghelper.Tracer(nil, tracerName),
 	}
 	for _, opt := range opts {
 		if err := opt(u); err != nil {
@@ -122,7 +143,12 @@ func (u *upgrader) UpgradeListener(t transport.Transport, list manet.Listener) t
 
 // Upgrade upgrades the multiaddr/net connection into a full libp2p-transport connection.
 func (u *upgrader) Upgrade(ctx context.Context, t transport.Transport, maconn manet.Conn, dir network.Direction, p peer.ID, connScope network.ConnManagementScope) (transport.CapableConn, error) {
+	ctx, span := u.tracer.Start(ctx, "upgrader.Upgrade", trace.WithAttributes(
+		attribute.Stringer("direction", dir),
+		attribute.Stringer("addr", maconn.RemoteMultiaddr()),
+	))
 	c, err := u.upgrade(ctx, t, maconn, dir, p, connScope)
+	tracinghelper.EndSpan(span, err)
 	if err != nil {
 		connScope.Done()
 		return nil, err
@@ -134,6 +160,11 @@ func (u *upgrader) upgrade(ctx context.Context, t transport.Transport, maconn ma
 	if dir == network.DirOutbound && p == "" {
 		return nil, ErrNilPeer
 	}
+	if dir == network.DirInbound && p == "" {
+		if hc, ok := maconn.(transport.PeerHintConn); ok {
+			p = hc.RemotePeerHint()
+		}
+	}
 	var stat network.ConnStats
 	if cs, ok := maconn.(network.ConnStat); ok {
 		stat = cs.Stat()
@@ -152,14 +183,36 @@ func (u *upgrader) upgrade(ctx context.Context, t transport.Transport, maconn ma
 		return nil, ipnet.ErrNotInPrivateNetwork
 	}
 
-	sconn, security, server, err := u.setupSecurity(ctx, conn, p, dir)
+	// If we know the peer of an inbound connection before the handshake, reject unwanted peers
+	// early. p is not authenticated yet, so it is only used to reject connections: resources are
+	// only assigned to the peer once the security handshake proved that the remote peer is p.
+	var gated bool
+	if dir == network.DirInbound && p != "" && u.connGater != nil {
+		if !u.connGater.InterceptSecured(dir, p, maconn) {
+			conn.Close()
+			return nil, fmt.Errorf("gater rejected connection with peer %s and addr %s with direction %d",
+				p, maconn.RemoteMultiaddr(), dir)
+		}
+		gated = true
+	}
+
+	// Make the connection scope available to the security transport, so that it can account for
+	// memory allocated before the peer is authenticated.
+	sctx, cancel := network.WithDialStage(network.WithConnScope(ctx, connScope), network.DialStageSecurity)
+	sctx, span := u.tracer.Start(sctx, "upgrader.setupSecurity")
+	sconn, security, server, err := u.setupSecurity(sctx, conn, p, dir)
+	if err == nil {
+		span.SetAttributes(attribute.String("security", string(security)), attribute.Stringer("peer.id", sconn.RemotePeer()))
+	}
+	tracinghelper.EndSpan(span, err)
+	cancel()
 	if err != nil {
 		conn.Close()
-		return nil, fmt.Errorf("failed to negotiate security protocol: %w", err)
+		return nil, handshakeError{fmt.Errorf("failed to negotiate security protocol: %w", err)}
 	}
 
 	// call the connection gater, if one is registered.
-	if u.connGater != nil && !u.connGater.InterceptSecured(dir, sconn.RemotePeer(), maconn) {
+	if u.connGater != nil && !gated && !u.connGater.InterceptSecured(dir, sconn.RemotePeer(), maconn) {
 		if err := maconn.Close(); err != nil {
 			log.Errorw("failed to close connection", "peer", p, "addr", maconn.RemoteMultiaddr(), "error", err)
 		}
@@ -179,10 +232,17 @@ func (u *upgrader) upgrade(ctx context.Context, t transport.Transport, maconn ma
 		}
 	}
 
-	muxer, smconn, err := u.setupMuxer(ctx, sconn, server, connScope.PeerScope())
+	mctx, cancel := network.WithDialStage(ctx, network.DialStageMuxer)
+	mctx, span = u.tracer.Start(mctx, "upgrader.setupMuxer")
+	muxer, smconn, err := u.setupMuxer(mctx, sconn, server, connScope.PeerScope())
+	if err == nil {
+		span.SetAttributes(attribute.String("muxer", string(muxer)))
+	}
+	tracinghelper.EndSpan(span, err)
+	cancel()
 	if err != nil {
 		sconn.Close()
-		return nil, fmt.Errorf("failed to negotiate stream multiplexer: %w", err)
+		return nil, handshakeError{fmt.Errorf("failed to negotiate stream multiplexer: %w", err)}
 	}
 
 	tc := &transportConn{
@@ -195,10 +255,35 @@ func (u *upgrader) upgrade(ctx context.Context, t transport.Transport, maconn ma
 		muxer:                     muxer,
 		security:                  security,
 		usedEarlyMuxerNegotiation: sconn.ConnState().UsedEarlyMuxerNegotiation,
+		cipherSuite:               sconn.ConnState().CipherSuite,
 	}
 	return tc, nil
 }
 
+// handshakeError is returned when the security handshake or the stream multiplexer negotiation failed.
+type handshakeError struct{ err error }
+
+func (e handshakeError) Error() string { return e.err.Error() }
+func (e handshakeError) Unwrap() error { return e.err }
+
+// isHandshakeOffense returns true if err is a handshake failure that is the remote peer's fault.
+// Timeouts, connections closed by the remote, and rejections by the local node's resource manager
+// are not offenses.
+func isHandshakeOffense(err error) bool {
+	var herr handshakeError
+	if !errors.As(err, &herr) {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, network.ErrResourceLimitExceeded) {
+		return false
+	}
+	var nerr net.Error
+	return !errors.As(err, &nerr) || !nerr.Timeout()
+}
+
 func (u *upgrader) setupSecurity(ctx context.Context, conn net.Conn, p peer.ID, dir network.Direction) (sec.SecureConn, protocol.ID, bool, error) {
 	isServer := dir == network.DirInbound
 	var st sec.SecureTransport
@@ -207,6 +292,7 @@ func (u *upgrader) setupSecurity(ctx context.Context, conn net.Conn, p peer.ID,
 	if err != nil {
 		return nil, "", false, err
 	}
+	ctx = sec.WithNegotiation(ctx, sec.Negotiation{Protocol: st.ID(), Supported: u.securityIDs})
 	if isServer {
 		sconn, err := st.SecureInbound(ctx, conn, p)
 		return sconn, st.ID(), true, err
@@ -202,3 +202,100 @@ func TestOutboundResourceManagement(t *testing.T) {
 		require.Error(t, err)
 	})
 }
+
+type peerHintConn struct {
+	manet.Conn
+	hint peer.ID
+}
+
+func (c *peerHintConn) RemotePeerHint() peer.ID { return c.hint }
+
+// upgradeWithPeerHint dials the peer id of the upgrader u from a new peer, and upgrades the accepted
+// connection using u. The hint for the remote peer is returned by hint, which is passed the ID of the
+// dialing peer.
+func upgradeWithPeerHint(t *testing.T, id peer.ID, u transport.Upgrader, hint func(dialer peer.ID) peer.ID, scope network.ConnManagementScope) (serverErr, clientErr error) {
+	t.Helper()
+	ln, err := manet.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	defer ln.Close()
+
+	dialerID, dialUpgrader := createUpgrader(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := dial(t, dialUpgrader, ln.Multiaddr(), id, &network.NullScope{})
+		if err == nil {
+			conn.Close()
+		}
+		clientErr = err
+	}()
+	c, err := ln.Accept()
+	require.NoError(t, err)
+	conn, serverErr := u.Upgrade(context.Background(), nil, &peerHintConn{Conn: c, hint: hint(dialerID)}, network.DirInbound, "", scope)
+	if serverErr == nil {
+		require.Equal(t, dialerID, conn.RemotePeer())
+		conn.Close()
+	}
+	<-done
+	return serverErr, clientErr
+}
+
+func TestInboundPeerHint(t *testing.T) {
+	matching := func(dialer peer.ID) peer.ID { return dialer }
+
+	t.Run("matching hint", func(t *testing.T) {
+		id, u := createUpgrader(t)
+		serverErr, clientErr := upgradeWithPeerHint(t, id, u, matching, &network.NullScope{})
+		require.NoError(t, serverErr)
+		require.NoError(t, clientErr)
+	})
+
+	t.Run("mismatching hint", func(t *testing.T) {
+		id, u := createUpgrader(t)
+		other, _ := newPeer(t)
+		serverErr, _ := upgradeWithPeerHint(t, id, u, func(peer.ID) peer.ID { return other }, &network.NullScope{})
+		require.Error(t, serverErr)
+		require.Contains(t, serverErr.Error(), "failed to negotiate security protocol")
+	})
+
+	t.Run("gated before the handshake", func(t *testing.T) {
+		gater := &testGater{}
+		gater.BlockSecured(true)
+		id, u := createUpgraderWithConnGater(t, gater)
+		serverErr, clientErr := upgradeWithPeerHint(t, id, u, matching, &network.NullScope{})
+		require.Error(t, serverErr)
+		require.Contains(t, serverErr.Error(), "gater rejected connection")
+		// the connection is closed before the handshake
+		require.Error(t, clientErr)
+		require.Contains(t, clientErr.Error(), "failed to negotiate security protocol")
+	})
+
+	t.Run("no resources assigned to unauthenticated peers", func(t *testing.T) {
+		id, u := createUpgrader(t)
+		other, _ := newPeer(t)
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		// SetPeer must not be called: the hint is wrong, and the handshake fails
+		connScope := mocknetwork.NewMockConnManagementScope(ctrl)
+		connScope.EXPECT().PeerScope().AnyTimes()
+		connScope.EXPECT().Done()
+		serverErr, _ := upgradeWithPeerHint(t, id, u, func(peer.ID) peer.ID { return other }, connScope)
+		require.Error(t, serverErr)
+		require.Contains(t, serverErr.Error(), "failed to negotiate security protocol")
+	})
+
+	t.Run("resource manager after the handshake", func(t *testing.T) {
+		id, u := createUpgrader(t)
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		connScope := mocknetwork.NewMockConnManagementScope(ctrl)
+		gomock.InOrder(
+			connScope.EXPECT().PeerScope(),
+			connScope.EXPECT().SetPeer(gomock.Any()).Return(errors.New("blocked")),
+			connScope.EXPECT().Done(),
+		)
+		serverErr, _ := upgradeWithPeerHint(t, id, u, matching, connScope)
+		require.Error(t, serverErr)
+		require.Contains(t, serverErr.Error(), "resource manager")
+	})
+}
@@ -0,0 +1,210 @@
+// Package autonatv2 implements the AutoNAT v2 protocol, which determines the reachability
+// of individual addresses.
+//
+// The client asks a server to dial one of its addresses. The server dials the address using a
+// separate host, and sends a random nonce, received from the client in the request, on a
+// dial-back stream. The client accepts the result only if the nonce it receives on the dial-back
+// stream matches. If the IP address to dial differs from the client's observed IP address, the
+// server requires the client to send some data before dialing, to prevent the protocol from being
+// used for amplification attacks.
+//
+// The AutoNAT keeps track of the reachability of the host's addresses by periodically probing
+// them, and emits an event.EvtHostReachableAddrsChanged whenever the set of reachable or
+// unreachable addresses changes.
+package autonatv2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2/pb"
+
+	logging "github.com/ipfs/go-log/v2"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+//go:generate protoc --proto_path=$PWD:$PWD/../../.. --go_out=. --go_opt=Mpb/autonatv2.proto=./pb pb/autonatv2.proto
+
+const (
+	ServiceName = "libp2p.autonatv2"
+
+	// DialProtocol is the protocol used by clients to request a dial.
+	DialProtocol = "/libp2p/autonat/2/dial-request"
+	// DialBackProtocol is the protocol used by servers to send the nonce to the client.
+	DialBackProtocol = "/libp2p/autonat/2/dial-back"
+)
+
+var log = logging.Logger("autonatv2")
+
+var (
+	// ErrNoValidPeers is returned if there are no connected peers that support the AutoNAT v2 protocol.
+	ErrNoValidPeers = errors.New("no valid peers for autonat v2")
+	// ErrDialRefused is returned if the server refused to dial any of the requested addresses.
+	ErrDialRefused = errors.New("dial refused")
+)
+
+// Request is a request to verify the reachability of an address.
+type Request struct {
+	// Addr is the address to verify.
+	Addr ma.Multiaddr
+	// SendDialData indicates whether the client is willing to send dial data
+	// if the server requires it to dial Addr.
+	SendDialData bool
+}
+
+// Result is the result of a reachability check.
+type Result struct {
+	// Addr is the address that was dialed.
+	Addr ma.Multiaddr
+	// Reachability is the reachability of Addr.
+	Reachability network.Reachability
+	// Status is the status of the dial reported by the server.
+	Status pb.DialStatus
+}
+
+// AutoNAT implements both the client and the server of the AutoNAT v2 protocol.
+type AutoNAT struct {
+	host       host.Host
+	dialerHost host.Host
+	config     *config
+
+	cli     *client
+	srv     *server
+	tracker *addrTracker
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// New creates a new AutoNAT v2 service for host h.
+//
+// dialerHost is used by the server to dial back clients. It must not be h, it must not share
+// a peerstore with h, and it's closed when the AutoNAT is closed. It may be nil if the server
+// is disabled using WithoutServer.
+func New(h host.Host, dialerHost host.Host, opts ...Option) (*AutoNAT, error) {
+	cfg := new(config)
+	if err := defaults(cfg); err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		if err := opt(cfg); err != nil {
+			return nil, fmt.Errorf("failed to apply option: %w", err)
+		}
+	}
+	if !cfg.serverDisabled {
+		if dialerHost == nil {
+			return nil, errors.New("a dialer host is required to run the server")
+		}
+		if dialerHost == h || dialerHost.Peerstore() == h.Peerstore() {
+			return nil, errors.New("dialer host should not be the host")
+		}
+	}
+	if cfg.addressFunc == nil {
+		cfg.addressFunc = h.Addrs
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	an := &AutoNAT{
+		host:       h,
+		dialerHost: dialerHost,
+		config:     cfg,
+		ctx:        ctx,
+		ctxCancel:  cancel,
+	}
+	if !cfg.clientDisabled {
+		an.cli = newClient(h, cfg)
+		tracker, err := newAddrTracker(h, an.cli, cfg)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		an.tracker = tracker
+	}
+	if !cfg.serverDisabled {
+		an.srv = newServer(h, dialerHost, cfg)
+	}
+	return an, nil
+}
+
+// Start starts the client and the server.
+func (an *AutoNAT) Start() error {
+	if an.srv != nil {
+		an.srv.Start()
+	}
+	if an.cli != nil {
+		an.cli.Start()
+		sub, err := an.host.EventBus().Subscribe([]interface{}{
+			new(event.EvtLocalAddressesUpdated),
+			new(event.EvtPeerIdentificationCompleted),
+		}, eventbus.Name("autonatv2"))
+		if err != nil {
+			an.Close()
+			return err
+		}
+		an.wg.Add(1)
+		go func() {
+			defer an.wg.Done()
+			an.tracker.background(an.ctx, sub)
+		}()
+	}
+	return nil
+}
+
+// Close stops the client and the server, and closes the dialer host.
+func (an *AutoNAT) Close() error {
+	an.ctxCancel()
+	an.wg.Wait()
+	if an.tracker != nil {
+		an.tracker.Close()
+	}
+	if an.cli != nil {
+		an.cli.Close()
+	}
+	if an.srv != nil {
+		an.srv.Close()
+	}
+	if an.dialerHost != nil {
+		return an.dialerHost.Close()
+	}
+	return nil
+}
+
+// GetReachability asks a random connected peer to verify the reachability of the first address
+// in reqs that it's willing to dial. The addresses should be sorted in order of preference.
+func (an *AutoNAT) GetReachability(ctx context.Context, reqs []Request) (Result, error) {
+	if an.cli == nil {
+		return Result{}, errors.New("autonat v2 client is disabled")
+	}
+	if !an.config.allowPrivateAddrs {
+		for _, r := range reqs {
+			if !isPublicAddr(r.Addr) {
+				return Result{}, fmt.Errorf("private address cannot be verified by autonat v2: %s", r.Addr)
+			}
+		}
+	}
+	return an.cli.GetReachability(ctx, reqs)
+}
+
+// Reachability returns the reachability of address a, as determined by the previous probes.
+// It returns network.ReachabilityUnknown if a isn't tracked, or there isn't enough confidence yet.
+func (an *AutoNAT) Reachability(a ma.Multiaddr) network.Reachability {
+	if an.tracker == nil {
+		return network.ReachabilityUnknown
+	}
+	return an.tracker.Reachability(a)
+}
+
+// ReachableAddrs returns the tracked addresses, grouped by reachability.
+func (an *AutoNAT) ReachableAddrs() (reachable, unreachable, unknown []ma.Multiaddr) {
+	if an.tracker == nil {
+		return nil, nil, nil
+	}
+	return an.tracker.Addrs()
+}
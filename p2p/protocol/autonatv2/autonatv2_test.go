@@ -0,0 +1,305 @@
+package autonatv2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	bhost "github.com/libp2p/go-libp2p/p2p/host/blank"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2/pb"
+
+	"github.com/libp2p/go-msgio/pbio"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func newHost(t *testing.T) host.Host {
+	h := bhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func newTestServer(t *testing.T, opts ...Option) *AutoNAT {
+	opts = append([]Option{allowPrivateAddrs, WithoutClient()}, opts...)
+	an, err := New(newHost(t), newHost(t), opts...)
+	require.NoError(t, err)
+	require.NoError(t, an.Start())
+	t.Cleanup(func() { an.Close() })
+	return an
+}
+
+func newTestClient(t *testing.T, opts ...Option) *AutoNAT {
+	opts = append([]Option{allowPrivateAddrs, WithoutServer()}, opts...)
+	an, err := New(newHost(t), nil, opts...)
+	require.NoError(t, err)
+	require.NoError(t, an.Start())
+	t.Cleanup(func() { an.Close() })
+	return an
+}
+
+// connect connects the client to the server. Since blank hosts don't run identify,
+// the server's protocols are added to the client's peerstore manually.
+func connect(t *testing.T, cli, srv *AutoNAT) {
+	cli.host.Peerstore().AddAddrs(srv.host.ID(), srv.host.Addrs(), peerstore.PermanentAddrTTL)
+	require.NoError(t, cli.host.Connect(context.Background(), peer.AddrInfo{ID: srv.host.ID()}))
+	require.NoError(t, cli.host.Peerstore().AddProtocols(srv.host.ID(), DialProtocol))
+}
+
+func unreachableAddr() ma.Multiaddr {
+	return ma.StringCast("/ip4/127.0.0.1/tcp/1")
+}
+
+func TestGetReachability(t *testing.T) {
+	srv := newTestServer(t)
+	cli := newTestClient(t)
+
+	_, err := cli.GetReachability(context.Background(), []Request{{Addr: cli.host.Addrs()[0]}})
+	require.ErrorIs(t, err, ErrNoValidPeers)
+
+	connect(t, cli, srv)
+
+	t.Run("reachable", func(t *testing.T) {
+		addr := cli.host.Addrs()[0]
+		res, err := cli.GetReachability(context.Background(), []Request{{Addr: addr}})
+		require.NoError(t, err)
+		require.Equal(t, network.ReachabilityPublic, res.Reachability)
+		require.Equal(t, pb.DialStatus_OK, res.Status)
+		require.True(t, addr.Equal(res.Addr))
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		res, err := cli.GetReachability(context.Background(), []Request{{Addr: unreachableAddr()}})
+		require.NoError(t, err)
+		require.Equal(t, network.ReachabilityPrivate, res.Reachability)
+		require.Equal(t, pb.DialStatus_E_DIAL_ERROR, res.Status)
+	})
+
+	t.Run("first dialable address", func(t *testing.T) {
+		// the server can't dial circuit addresses, and picks the next one
+		circuit := ma.StringCast("/ip4/1.2.3.4/tcp/1/p2p/QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC/p2p-circuit")
+		addr := cli.host.Addrs()[0]
+		res, err := cli.GetReachability(context.Background(), []Request{{Addr: circuit}, {Addr: addr}})
+		require.NoError(t, err)
+		require.True(t, addr.Equal(res.Addr))
+		require.Equal(t, network.ReachabilityPublic, res.Reachability)
+	})
+}
+
+func TestGetReachabilityDialRefused(t *testing.T) {
+	// the server doesn't dial private addresses
+	srv := newTestServer(t)
+	srv.config.allowPrivateAddrs = false
+	cli := newTestClient(t)
+	connect(t, cli, srv)
+
+	_, err := cli.GetReachability(context.Background(), []Request{{Addr: cli.host.Addrs()[0]}})
+	require.ErrorIs(t, err, ErrDialRefused)
+}
+
+func TestGetReachabilityDialData(t *testing.T) {
+	srv := newTestServer(t)
+	srv.config.dataRequestPolicy = func(_, _ ma.Multiaddr) bool { return true }
+	cli := newTestClient(t)
+	connect(t, cli, srv)
+
+	addr := cli.host.Addrs()[0]
+	res, err := cli.GetReachability(context.Background(), []Request{{Addr: addr, SendDialData: true}})
+	require.NoError(t, err)
+	require.Equal(t, network.ReachabilityPublic, res.Reachability)
+
+	// the client refuses to send dial data
+	_, err = cli.GetReachability(context.Background(), []Request{{Addr: addr}})
+	require.Error(t, err)
+}
+
+func TestGetReachabilityRateLimited(t *testing.T) {
+	srv := newTestServer(t, WithServerRateLimit(10, 1, 1))
+	cli := newTestClient(t)
+	connect(t, cli, srv)
+
+	addr := cli.host.Addrs()[0]
+	_, err := cli.GetReachability(context.Background(), []Request{{Addr: addr}})
+	require.NoError(t, err)
+	_, err = cli.GetReachability(context.Background(), []Request{{Addr: addr}})
+	require.ErrorContains(t, err, pb.DialResponse_E_REQUEST_REJECTED.String())
+}
+
+// newMaliciousServer returns a host that handles dial requests by sending the dial-back using
+// dialBack, and reporting that the first address was dialed successfully.
+func newMaliciousServer(t *testing.T, dialBack func(p peer.ID, nonce uint64)) host.Host {
+	h := newHost(t)
+	h.SetStreamHandler(DialProtocol, func(s network.Stream) {
+		defer s.Close()
+		r := pbio.NewDelimitedReader(s, maxMsgSize)
+		var msg pb.Message
+		if err := r.ReadMsg(&msg); err != nil {
+			s.Reset()
+			return
+		}
+		dialBack(s.Conn().RemotePeer(), msg.GetDialRequest().GetNonce())
+		pbio.NewDelimitedWriter(s).WriteMsg(&pb.Message{
+			Msg: &pb.Message_DialResponse{
+				DialResponse: &pb.DialResponse{Status: pb.DialResponse_OK, DialStatus: pb.DialStatus_OK},
+			},
+		})
+	})
+	return h
+}
+
+// sendDialBack sends the dial-back from h, and waits for the client to process it.
+func sendDialBack(h host.Host, p peer.ID, nonce uint64) {
+	s, err := h.NewStream(context.Background(), p, DialBackProtocol)
+	if err != nil {
+		return
+	}
+	defer s.Close()
+	pbio.NewDelimitedWriter(s).WriteMsg(&pb.DialBack{Nonce: nonce})
+	pbio.NewDelimitedReader(s, maxMsgSize).ReadMsg(&pb.DialBackResponse{})
+}
+
+func connectHost(t *testing.T, cli *AutoNAT, h host.Host) {
+	cli.host.Peerstore().AddAddrs(h.ID(), h.Addrs(), peerstore.PermanentAddrTTL)
+	require.NoError(t, cli.host.Connect(context.Background(), peer.AddrInfo{ID: h.ID()}))
+	require.NoError(t, cli.host.Peerstore().AddProtocols(h.ID(), DialProtocol))
+}
+
+func TestGetReachabilityDialBackOnRequestConn(t *testing.T) {
+	var srv host.Host
+	srv = newMaliciousServer(t, func(p peer.ID, nonce uint64) {
+		// The server dials back over the connection the request was sent on.
+		sendDialBack(srv, p, nonce)
+	})
+	cli := newTestClient(t)
+	connectHost(t, cli, srv)
+
+	_, err := cli.GetReachability(context.Background(), []Request{{Addr: cli.host.Addrs()[0]}})
+	require.ErrorContains(t, err, "no dial-back was received")
+}
+
+func TestGetReachabilityDialBackOnOtherAddr(t *testing.T) {
+	cli := newTestClient(t)
+	dialer := newHost(t)
+	srv := newMaliciousServer(t, func(p peer.ID, nonce uint64) {
+		// The server dials back a different address than the one it reports.
+		dialer.Peerstore().AddAddrs(p, cli.host.Addrs(), peerstore.TempAddrTTL)
+		sendDialBack(dialer, p, nonce)
+	})
+	connectHost(t, cli, srv)
+
+	_, err := cli.GetReachability(context.Background(), []Request{{Addr: unreachableAddr()}})
+	require.ErrorContains(t, err, "dial-back was received on")
+}
+
+func TestIsDialBackAddr(t *testing.T) {
+	for _, tc := range []struct {
+		tested, local string
+		want          bool
+	}{
+		{"/ip4/1.2.3.4/tcp/4001", "/ip4/1.2.3.4/tcp/4001", true},
+		// the NAT rewrites the IP address
+		{"/ip4/1.2.3.4/tcp/4001", "/ip4/192.168.1.2/tcp/4001", true},
+		{"/ip4/1.2.3.4/tcp/4001/p2p/QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC", "/ip4/1.2.3.4/tcp/4001", true},
+		{"/dns4/example.com/tcp/4001", "/ip4/1.2.3.4/tcp/4001", true},
+		{"/dns/example.com/tcp/4001", "/ip6/::1/tcp/4001", true},
+		{"/ip4/1.2.3.4/udp/4001/quic-v1/webtransport/certhash/uEiDDq4_xNyDorZBH3TlGazyJdOWSwvo4PUo5YHFMrvDE8g",
+			"/ip4/1.2.3.4/udp/4001/quic-v1/webtransport", true},
+		{"/ip4/1.2.3.4/tcp/4001", "/ip4/1.2.3.4/tcp/4002", false},
+		{"/ip4/1.2.3.4/tcp/4001", "/ip6/::1/tcp/4001", false},
+		{"/dns6/example.com/tcp/4001", "/ip4/1.2.3.4/tcp/4001", false},
+		{"/ip4/1.2.3.4/tcp/4001", "/ip4/1.2.3.4/udp/4001/quic-v1", false},
+		{"/ip4/1.2.3.4/udp/4001/quic-v1", "/ip4/1.2.3.4/udp/4001/quic-v1/webtransport", false},
+		{"/ip4/1.2.3.4/tcp/4001/ws", "/ip4/1.2.3.4/tcp/4001", false},
+	} {
+		require.Equal(t, tc.want, isDialBackAddr(ma.StringCast(tc.tested), ma.StringCast(tc.local)), "%s, %s", tc.tested, tc.local)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Now()
+	r := &rateLimiter{RPM: 3, PerPeerRPM: 2, DialDataRPM: 1, now: func() time.Time { return now }}
+	p1, p2, p3 := peer.ID("p1"), peer.ID("p2"), peer.ID("p3")
+
+	require.True(t, r.Accept(p1))
+	// only a single concurrent request per peer
+	require.False(t, r.Accept(p1))
+	r.CompleteRequest(p1)
+	require.True(t, r.Accept(p1))
+	r.CompleteRequest(p1)
+	// per peer limit
+	require.False(t, r.Accept(p1))
+	// global limit
+	require.True(t, r.Accept(p2))
+	r.CompleteRequest(p2)
+	require.False(t, r.Accept(p3))
+
+	require.True(t, r.AcceptDialDataRequest(p2))
+	require.False(t, r.AcceptDialDataRequest(p2))
+
+	now = now.Add(time.Minute + time.Second)
+	require.True(t, r.Accept(p1))
+	require.True(t, r.Accept(p3))
+	require.True(t, r.AcceptDialDataRequest(p3))
+}
+
+func TestAddrStatusReachability(t *testing.T) {
+	pub, priv := network.ReachabilityPublic, network.ReachabilityPrivate
+	for _, tc := range []struct {
+		results []network.Reachability
+		want    network.Reachability
+	}{
+		{nil, network.ReachabilityUnknown},
+		{[]network.Reachability{pub}, network.ReachabilityUnknown},
+		{[]network.Reachability{pub, pub}, network.ReachabilityPublic},
+		{[]network.Reachability{priv, priv}, network.ReachabilityPrivate},
+		{[]network.Reachability{pub, priv, pub}, network.ReachabilityUnknown},
+		{[]network.Reachability{pub, pub, priv, priv, priv}, network.ReachabilityUnknown},
+		{[]network.Reachability{pub, priv, priv, priv}, network.ReachabilityPrivate},
+	} {
+		s := &addrStatus{results: tc.results}
+		require.Equal(t, tc.want, s.reachability(), "%v", tc.results)
+	}
+}
+
+func TestAddrTracker(t *testing.T) {
+	srv := newTestServer(t)
+	h := newHost(t)
+	reachable := h.Addrs()[0]
+	unreachable := unreachableAddr()
+	cli, err := New(h, nil, allowPrivateAddrs, WithoutServer(),
+		WithSchedule(10*time.Millisecond, time.Hour),
+		UsingAddresses(func() []ma.Multiaddr { return []ma.Multiaddr{reachable, unreachable} }),
+	)
+	require.NoError(t, err)
+	defer cli.Close()
+	sub, err := h.EventBus().Subscribe(new(event.EvtHostReachableAddrsChanged))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	connect(t, cli, srv)
+	require.NoError(t, cli.Start())
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case e := <-sub.Out():
+			evt := e.(event.EvtHostReachableAddrsChanged)
+			if len(evt.Reachable) == 1 && len(evt.Unreachable) == 1 {
+				require.True(t, reachable.Equal(evt.Reachable[0]))
+				require.True(t, unreachable.Equal(evt.Unreachable[0]))
+				require.Empty(t, evt.Unknown)
+
+				require.Equal(t, network.ReachabilityPublic, cli.Reachability(reachable))
+				require.Equal(t, network.ReachabilityPrivate, cli.Reachability(unreachable))
+				return
+			}
+		case <-timeout:
+			t.Fatal("timeout waiting for the reachability of the addresses")
+		}
+	}
+}
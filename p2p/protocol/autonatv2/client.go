@@ -0,0 +1,329 @@
+package autonatv2
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2/pb"
+
+	"github.com/libp2p/go-msgio/pbio"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const (
+	// maxMsgSize is the maximum size of a message on the dial and dial-back streams.
+	maxMsgSize = 8192
+	// maxDialDataChunk is the size of the DialDataResponse messages sent by the client.
+	maxDialDataChunk = 4096
+	// maxHandshakeSizeBytes is the maximum amount of dial data the client is willing to send.
+	maxHandshakeSizeBytes = 100_000
+	// dialBackStreamTimeout is the timeout for reading and writing the dial-back stream.
+	dialBackStreamTimeout = 5 * time.Second
+)
+
+// client requests dials from servers, and handles the dial-back streams.
+type client struct {
+	host   host.Host
+	config *config
+
+	mx sync.Mutex
+	// dialBacks maps the nonces of ongoing requests to their dial-back state
+	dialBacks map[uint64]*dialBack
+}
+
+// dialBack is the dial-back state of a request.
+type dialBack struct {
+	// reqConn is the connection the request is sent on. Dial-backs received on it are rejected,
+	// since they don't show that the server could dial us.
+	reqConn network.Conn
+	// addr is the local address of the connection the dial-back was received on.
+	// It is nil until the dial-back is received.
+	addr ma.Multiaddr
+}
+
+func newClient(h host.Host, cfg *config) *client {
+	return &client{
+		host:      h,
+		config:    cfg,
+		dialBacks: make(map[uint64]*dialBack),
+	}
+}
+
+func (c *client) Start() {
+	c.host.SetStreamHandler(DialBackProtocol, c.handleDialBack)
+}
+
+func (c *client) Close() {
+	c.host.RemoveStreamHandler(DialBackProtocol)
+}
+
+// GetReachability asks a random connected server to verify the reachability of one of the requested addresses.
+func (c *client) GetReachability(ctx context.Context, reqs []Request) (Result, error) {
+	if len(reqs) == 0 {
+		return Result{}, fmt.Errorf("no addresses to verify")
+	}
+	p := c.getPeerToProbe()
+	if p == "" {
+		return Result{}, ErrNoValidPeers
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.probeTimeout)
+	defer cancel()
+	s, err := c.host.NewStream(ctx, p, DialProtocol)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to open dial stream to %s: %w", p, err)
+	}
+
+	nonce := rand.Uint64()
+	c.mx.Lock()
+	c.dialBacks[nonce] = &dialBack{reqConn: s.Conn()}
+	c.mx.Unlock()
+	defer func() {
+		c.mx.Lock()
+		delete(c.dialBacks, nonce)
+		c.mx.Unlock()
+	}()
+	res, err := c.request(s, reqs, nonce)
+	if err != nil {
+		s.Reset()
+		return Result{}, fmt.Errorf("dial request to %s failed: %w", p, err)
+	}
+	s.Close()
+	return res, nil
+}
+
+func (c *client) request(s network.Stream, reqs []Request, nonce uint64) (Result, error) {
+	if err := s.Scope().SetService(ServiceName); err != nil {
+		return Result{}, fmt.Errorf("error attaching stream to autonat v2 service: %w", err)
+	}
+	if err := s.Scope().ReserveMemory(maxMsgSize, network.ReservationPriorityAlways); err != nil {
+		return Result{}, fmt.Errorf("error reserving memory for autonat v2 stream: %w", err)
+	}
+	defer s.Scope().ReleaseMemory(maxMsgSize)
+	s.SetDeadline(time.Now().Add(c.config.probeTimeout))
+
+	r := pbio.NewDelimitedReader(s, maxMsgSize)
+	w := pbio.NewDelimitedWriter(s)
+
+	addrs := make([][]byte, 0, len(reqs))
+	for _, req := range reqs {
+		addrs = append(addrs, req.Addr.Bytes())
+	}
+	msg := &pb.Message{
+		Msg: &pb.Message_DialRequest{
+			DialRequest: &pb.DialRequest{Addrs: addrs, Nonce: nonce},
+		},
+	}
+	if err := w.WriteMsg(msg); err != nil {
+		return Result{}, err
+	}
+
+	msg.Reset()
+	if err := r.ReadMsg(msg); err != nil {
+		return Result{}, err
+	}
+	if ddr := msg.GetDialDataRequest(); ddr != nil {
+		idx := int(ddr.GetAddrIdx())
+		if idx >= len(reqs) {
+			return Result{}, fmt.Errorf("dial data requested for invalid address index: %d", idx)
+		}
+		if !reqs[idx].SendDialData {
+			return Result{}, fmt.Errorf("dial data requested for %s", reqs[idx].Addr)
+		}
+		if ddr.GetNumBytes() > maxHandshakeSizeBytes {
+			return Result{}, fmt.Errorf("requested too much dial data: %d bytes", ddr.GetNumBytes())
+		}
+		if err := sendDialData(w, int(ddr.GetNumBytes())); err != nil {
+			return Result{}, fmt.Errorf("failed to send dial data: %w", err)
+		}
+		msg.Reset()
+		if err := r.ReadMsg(msg); err != nil {
+			return Result{}, err
+		}
+	}
+
+	resp := msg.GetDialResponse()
+	if resp == nil {
+		return Result{}, fmt.Errorf("invalid response: expected a dial response")
+	}
+	switch resp.GetStatus() {
+	case pb.DialResponse_OK:
+	case pb.DialResponse_E_DIAL_REFUSED:
+		return Result{}, ErrDialRefused
+	default:
+		return Result{}, fmt.Errorf("request failed: %s", resp.GetStatus())
+	}
+	idx := int(resp.GetAddrIdx())
+	if idx >= len(reqs) {
+		return Result{}, fmt.Errorf("invalid address index in response: %d", idx)
+	}
+
+	res := Result{Addr: reqs[idx].Addr, Status: resp.GetDialStatus()}
+	switch resp.GetDialStatus() {
+	case pb.DialStatus_OK:
+		// Only trust the result if the server proved that it dialed the requested address.
+		c.mx.Lock()
+		dialBackAddr := c.dialBacks[nonce].addr
+		c.mx.Unlock()
+		if dialBackAddr == nil {
+			return Result{}, fmt.Errorf("server reported a successful dial, but no dial-back was received")
+		}
+		if !isDialBackAddr(res.Addr, dialBackAddr) {
+			return Result{}, fmt.Errorf("server reported a successful dial of %s, but the dial-back was received on %s", res.Addr, dialBackAddr)
+		}
+		res.Reachability = network.ReachabilityPublic
+	case pb.DialStatus_E_DIAL_ERROR:
+		res.Reachability = network.ReachabilityPrivate
+	case pb.DialStatus_E_DIAL_BACK_ERROR:
+		// The server connected to us, but failed to open the dial-back stream.
+		// We can't tell if the address is reachable.
+		res.Reachability = network.ReachabilityUnknown
+	default:
+		return Result{}, fmt.Errorf("invalid dial status: %s", resp.GetDialStatus())
+	}
+	return res, nil
+}
+
+func sendDialData(w pbio.Writer, numBytes int) error {
+	data := make([]byte, maxDialDataChunk)
+	msg := &pb.Message{
+		Msg: &pb.Message_DialDataResponse{
+			DialDataResponse: &pb.DialDataResponse{},
+		},
+	}
+	for numBytes > 0 {
+		n := numBytes
+		if n > maxDialDataChunk {
+			n = maxDialDataChunk
+		}
+		msg.GetDialDataResponse().Data = data[:n]
+		if err := w.WriteMsg(msg); err != nil {
+			return err
+		}
+		numBytes -= n
+	}
+	return nil
+}
+
+// handleDialBack records the nonce sent by the server, and the address it dialed.
+func (c *client) handleDialBack(s network.Stream) {
+	if err := s.Scope().SetService(ServiceName); err != nil {
+		log.Debugf("error attaching stream to autonat v2 service: %s", err)
+		s.Reset()
+		return
+	}
+	if err := s.Scope().ReserveMemory(maxMsgSize, network.ReservationPriorityAlways); err != nil {
+		log.Debugf("error reserving memory for autonat v2 dial-back stream: %s", err)
+		s.Reset()
+		return
+	}
+	defer s.Scope().ReleaseMemory(maxMsgSize)
+	s.SetDeadline(time.Now().Add(dialBackStreamTimeout))
+
+	r := pbio.NewDelimitedReader(s, maxMsgSize)
+	var msg pb.DialBack
+	if err := r.ReadMsg(&msg); err != nil {
+		log.Debugf("failed to read dial-back message from %s: %s", s.Conn().RemotePeer(), err)
+		s.Reset()
+		return
+	}
+	nonce := msg.GetNonce()
+
+	c.mx.Lock()
+	db, ok := c.dialBacks[nonce]
+	if !ok {
+		c.mx.Unlock()
+		log.Debugf("received dial-back with unexpected nonce from %s", s.Conn().RemotePeer())
+		s.Reset()
+		return
+	}
+	if db.reqConn == s.Conn() {
+		c.mx.Unlock()
+		log.Debugf("received dial-back from %s on the connection used for the request", s.Conn().RemotePeer())
+		s.Reset()
+		return
+	}
+	db.addr = s.Conn().LocalMultiaddr()
+	c.mx.Unlock()
+
+	w := pbio.NewDelimitedWriter(s)
+	if err := w.WriteMsg(&pb.DialBackResponse{Status: pb.DialBackResponse_OK}); err != nil {
+		log.Debugf("failed to write dial-back response to %s: %s", s.Conn().RemotePeer(), err)
+		s.Reset()
+		return
+	}
+	s.Close()
+}
+
+// isDialBackAddr reports whether local, the local address of a dial-back connection, is the tested
+// address: the transport, the IP family and the port must match. The IP address itself may differ,
+// since NATs rewrite it.
+func isDialBackAddr(tested, local ma.Multiaddr) bool {
+	var testedComps []ma.Component
+	ma.ForEach(tested, func(c ma.Component) bool {
+		// the local address of a connection doesn't include certificate hashes or the peer ID
+		if code := c.Protocol().Code; code != ma.P_CERTHASH && code != ma.P_P2P {
+			testedComps = append(testedComps, c)
+		}
+		return true
+	})
+	localComps := make([]ma.Component, 0, len(testedComps))
+	ma.ForEach(local, func(c ma.Component) bool {
+		localComps = append(localComps, c)
+		return true
+	})
+	if len(testedComps) == 0 || len(testedComps) != len(localComps) {
+		return false
+	}
+	switch testedComps[0].Protocol().Code {
+	case ma.P_IP4, ma.P_DNS4:
+		if localComps[0].Protocol().Code != ma.P_IP4 {
+			return false
+		}
+	case ma.P_IP6, ma.P_DNS6:
+		if localComps[0].Protocol().Code != ma.P_IP6 {
+			return false
+		}
+	case ma.P_DNS:
+		if code := localComps[0].Protocol().Code; code != ma.P_IP4 && code != ma.P_IP6 {
+			return false
+		}
+	default:
+		return false
+	}
+	for i := 1; i < len(testedComps); i++ {
+		t, l := testedComps[i], localComps[i]
+		if t.Protocol().Code != l.Protocol().Code {
+			return false
+		}
+		switch t.Protocol().Code {
+		case ma.P_TCP, ma.P_UDP:
+			if t.Value() != l.Value() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// getPeerToProbe returns a random connected peer that supports the dial protocol.
+func (c *client) getPeerToProbe() peer.ID {
+	var candidates []peer.ID
+	for _, p := range c.host.Network().Peers() {
+		if protos, err := c.host.Peerstore().SupportsProtocols(p, DialProtocol); err != nil || len(protos) == 0 {
+			continue
+		}
+		candidates = append(candidates, p)
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
@@ -0,0 +1,117 @@
+package autonatv2
+
+import (
+	"errors"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// AddrFunc returns the addresses whose reachability should be tracked.
+type AddrFunc func() []ma.Multiaddr
+
+// config holds configurable options for the autonatv2 subsystem.
+type config struct {
+	addressFunc       AddrFunc
+	allowPrivateAddrs bool
+
+	// client
+	probeTimeout    time.Duration
+	retryInterval   time.Duration
+	refreshInterval time.Duration
+
+	// server
+	dialTimeout       time.Duration
+	globalRPM         int
+	peerRPM           int
+	dialDataRPM       int
+	maxPeerAddresses  int
+	now               func() time.Time
+	serverDisabled    bool
+	clientDisabled    bool
+	dataRequestPolicy func(observed, dial ma.Multiaddr) bool
+}
+
+var defaults = func(c *config) error {
+	c.probeTimeout = 30 * time.Second
+	c.retryInterval = 90 * time.Second
+	c.refreshInterval = 15 * time.Minute
+
+	c.dialTimeout = 10 * time.Second
+	c.globalRPM = 60
+	c.peerRPM = 12
+	c.dialDataRPM = 12
+	c.maxPeerAddresses = 50
+	c.now = time.Now
+	c.dataRequestPolicy = amplificationAttackPrevention
+	return nil
+}
+
+// Option configures the autonatv2 subsystem.
+type Option func(*config) error
+
+// UsingAddresses sets the function returning the addresses whose reachability is tracked.
+// By default, the host's addresses (as returned by Addrs) are used. If the host stops announcing
+// unreachable addresses, addrFunc must return all addresses, including the unreachable ones,
+// so that they keep being probed.
+func UsingAddresses(addrFunc AddrFunc) Option {
+	return func(c *config) error {
+		if addrFunc == nil {
+			return errors.New("invalid address function supplied")
+		}
+		c.addressFunc = addrFunc
+		return nil
+	}
+}
+
+// WithSchedule configures how often addresses are probed. retryInterval is the interval
+// between probes of an address whose reachability isn't known with confidence yet,
+// refreshInterval is the interval between probes of an address whose reachability is known.
+func WithSchedule(retryInterval, refreshInterval time.Duration) Option {
+	return func(c *config) error {
+		if retryInterval <= 0 || refreshInterval <= 0 {
+			return errors.New("probe intervals must be positive")
+		}
+		c.retryInterval = retryInterval
+		c.refreshInterval = refreshInterval
+		return nil
+	}
+}
+
+// WithServerRateLimit sets the number of requests the server handles per minute.
+// rpm is the total number of requests, perPeerRPM the number of requests per peer,
+// and dialDataRPM the number of requests that require the client to send dial data.
+func WithServerRateLimit(rpm, perPeerRPM, dialDataRPM int) Option {
+	return func(c *config) error {
+		if rpm <= 0 || perPeerRPM <= 0 || dialDataRPM < 0 {
+			return errors.New("invalid rate limit")
+		}
+		c.globalRPM = rpm
+		c.peerRPM = perPeerRPM
+		c.dialDataRPM = dialDataRPM
+		return nil
+	}
+}
+
+// WithoutServer disables the server. The host won't dial back other peers.
+func WithoutServer() Option {
+	return func(c *config) error {
+		c.serverDisabled = true
+		return nil
+	}
+}
+
+// WithoutClient disables the client. The host won't probe the reachability of its own addresses.
+func WithoutClient() Option {
+	return func(c *config) error {
+		c.clientDisabled = true
+		return nil
+	}
+}
+
+// allowPrivateAddrs makes the server dial back private addresses, and the client probe them.
+// Only used in tests.
+func allowPrivateAddrs(c *config) error {
+	c.allowPrivateAddrs = true
+	return nil
+}
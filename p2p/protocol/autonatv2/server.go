@@ -0,0 +1,359 @@
+package autonatv2
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/protocol/autonatv2/pb"
+
+	"github.com/libp2p/go-msgio/pbio"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+const (
+	// streamTimeout is the timeout for handling a dial request, including the dial-back.
+	streamTimeout = 30 * time.Second
+	// minHandshakeSizeBytes is the minimum amount of dial data requested by the server.
+	minHandshakeSizeBytes = 30_000
+)
+
+var errDialDataLimited = errors.New("dial data rate limit exceeded")
+
+// server handles dial requests, dialing back clients using the dialer host.
+type server struct {
+	host       host.Host
+	dialerHost host.Host
+	config     *config
+	limiter    *rateLimiter
+}
+
+func newServer(h, dialer host.Host, cfg *config) *server {
+	return &server{
+		host:       h,
+		dialerHost: dialer,
+		config:     cfg,
+		limiter: &rateLimiter{
+			RPM:         cfg.globalRPM,
+			PerPeerRPM:  cfg.peerRPM,
+			DialDataRPM: cfg.dialDataRPM,
+			now:         cfg.now,
+		},
+	}
+}
+
+func (as *server) Start() {
+	as.host.SetStreamHandler(DialProtocol, as.handleDialRequest)
+}
+
+func (as *server) Close() {
+	as.host.RemoveStreamHandler(DialProtocol)
+}
+
+func (as *server) handleDialRequest(s network.Stream) {
+	if err := s.Scope().SetService(ServiceName); err != nil {
+		log.Debugf("error attaching stream to autonat v2 service: %s", err)
+		s.Reset()
+		return
+	}
+	if err := s.Scope().ReserveMemory(maxMsgSize, network.ReservationPriorityAlways); err != nil {
+		log.Debugf("error reserving memory for autonat v2 stream: %s", err)
+		s.Reset()
+		return
+	}
+	defer s.Scope().ReleaseMemory(maxMsgSize)
+	s.SetDeadline(as.config.now().Add(streamTimeout))
+
+	p := s.Conn().RemotePeer()
+	r := pbio.NewDelimitedReader(s, maxMsgSize)
+	w := pbio.NewDelimitedWriter(s)
+
+	if !as.limiter.Accept(p) {
+		log.Debugf("rejecting dial request from %s: rate limit exceeded", p)
+		if err := w.WriteMsg(newDialResponse(pb.DialResponse_E_REQUEST_REJECTED, 0, pb.DialStatus_UNUSED)); err != nil {
+			s.Reset()
+			return
+		}
+		s.Close()
+		return
+	}
+	defer as.limiter.CompleteRequest(p)
+
+	var msg pb.Message
+	if err := r.ReadMsg(&msg); err != nil {
+		log.Debugf("failed to read dial request from %s: %s", p, err)
+		s.Reset()
+		return
+	}
+	req := msg.GetDialRequest()
+	if req == nil {
+		log.Debugf("invalid message from %s: expected a dial request", p)
+		s.Reset()
+		return
+	}
+
+	idx, addr := as.selectAddr(req.GetAddrs())
+	if addr == nil {
+		if err := w.WriteMsg(newDialResponse(pb.DialResponse_E_DIAL_REFUSED, 0, pb.DialStatus_UNUSED)); err != nil {
+			s.Reset()
+			return
+		}
+		s.Close()
+		return
+	}
+
+	if as.config.dataRequestPolicy(s.Conn().RemoteMultiaddr(), addr) {
+		if err := as.receiveDialData(r, w, p, idx); err != nil {
+			log.Debugf("failed to receive dial data from %s: %s", p, err)
+			if errors.Is(err, errDialDataLimited) {
+				if err := w.WriteMsg(newDialResponse(pb.DialResponse_E_REQUEST_REJECTED, 0, pb.DialStatus_UNUSED)); err == nil {
+					s.Close()
+					return
+				}
+			}
+			s.Reset()
+			return
+		}
+	}
+
+	status := as.dialBack(p, addr, req.GetNonce())
+	if err := w.WriteMsg(newDialResponse(pb.DialResponse_OK, idx, status)); err != nil {
+		log.Debugf("failed to write dial response to %s: %s", p, err)
+		s.Reset()
+		return
+	}
+	s.Close()
+}
+
+// selectAddr returns the first address the server is willing to dial.
+func (as *server) selectAddr(addrs [][]byte) (uint32, ma.Multiaddr) {
+	for i, b := range addrs {
+		if i >= as.config.maxPeerAddresses {
+			break
+		}
+		a, err := ma.NewMultiaddrBytes(b)
+		if err != nil {
+			continue
+		}
+		if !as.config.allowPrivateAddrs && !isPublicAddr(a) {
+			continue
+		}
+		if _, err := a.ValueForProtocol(ma.P_CIRCUIT); err == nil {
+			continue
+		}
+		if !as.canDial(a) {
+			continue
+		}
+		return uint32(i), a
+	}
+	return 0, nil
+}
+
+func (as *server) canDial(a ma.Multiaddr) bool {
+	type transportForDialinger interface {
+		TransportForDialing(a ma.Multiaddr) transport.Transport
+	}
+	if s, ok := as.dialerHost.Network().(transportForDialinger); ok {
+		return s.TransportForDialing(a) != nil
+	}
+	return true
+}
+
+// receiveDialData requests dial data from the client, and reads it.
+func (as *server) receiveDialData(r pbio.Reader, w pbio.Writer, p peer.ID, idx uint32) error {
+	if !as.limiter.AcceptDialDataRequest(p) {
+		return errDialDataLimited
+	}
+	numBytes := minHandshakeSizeBytes + rand.Intn(maxHandshakeSizeBytes-minHandshakeSizeBytes)
+	msg := &pb.Message{
+		Msg: &pb.Message_DialDataRequest{
+			DialDataRequest: &pb.DialDataRequest{AddrIdx: idx, NumBytes: uint64(numBytes)},
+		},
+	}
+	if err := w.WriteMsg(msg); err != nil {
+		return err
+	}
+	for remaining := numBytes; remaining > 0; {
+		msg.Reset()
+		if err := r.ReadMsg(msg); err != nil {
+			return err
+		}
+		resp := msg.GetDialDataResponse()
+		if resp == nil {
+			return errors.New("invalid message: expected a dial data response")
+		}
+		if len(resp.GetData()) > maxDialDataChunk {
+			return errors.New("dial data chunk too large")
+		}
+		remaining -= len(resp.GetData())
+	}
+	return nil
+}
+
+// dialBack dials addr using the dialer host, and sends the nonce on a dial-back stream.
+func (as *server) dialBack(p peer.ID, addr ma.Multiaddr, nonce uint64) pb.DialStatus {
+	ctx, cancel := context.WithTimeout(context.Background(), as.config.dialTimeout)
+	defer cancel()
+
+	as.dialerHost.Peerstore().AddAddr(p, addr, peerstore.TempAddrTTL)
+	defer func() {
+		as.dialerHost.Network().ClosePeer(p)
+		as.dialerHost.Peerstore().ClearAddrs(p)
+		as.dialerHost.Peerstore().RemovePeer(p)
+	}()
+
+	if err := as.dialerHost.Connect(ctx, peer.AddrInfo{ID: p}); err != nil {
+		log.Debugf("failed to dial %s at %s: %s", p, addr, err)
+		return pb.DialStatus_E_DIAL_ERROR
+	}
+	s, err := as.dialerHost.NewStream(ctx, p, DialBackProtocol)
+	if err != nil {
+		log.Debugf("failed to open dial-back stream to %s: %s", p, err)
+		return pb.DialStatus_E_DIAL_BACK_ERROR
+	}
+	defer s.Close()
+	s.SetDeadline(as.config.now().Add(dialBackStreamTimeout))
+
+	w := pbio.NewDelimitedWriter(s)
+	if err := w.WriteMsg(&pb.DialBack{Nonce: nonce}); err != nil {
+		s.Reset()
+		return pb.DialStatus_E_DIAL_BACK_ERROR
+	}
+	// Wait for the client to process the nonce, so the dial-back is recorded
+	// before the client receives the dial response.
+	r := pbio.NewDelimitedReader(s, maxMsgSize)
+	var resp pb.DialBackResponse
+	if err := r.ReadMsg(&resp); err != nil {
+		log.Debugf("failed to read dial-back response from %s: %s", p, err)
+		s.Reset()
+		return pb.DialStatus_E_DIAL_BACK_ERROR
+	}
+	return pb.DialStatus_OK
+}
+
+func newDialResponse(status pb.DialResponse_ResponseStatus, idx uint32, dialStatus pb.DialStatus) *pb.Message {
+	return &pb.Message{
+		Msg: &pb.Message_DialResponse{
+			DialResponse: &pb.DialResponse{
+				Status:     status,
+				AddrIdx:    idx,
+				DialStatus: dialStatus,
+			},
+		},
+	}
+}
+
+// amplificationAttackPrevention returns true if the client has to send dial data before
+// the server dials addr, i.e. if the IP address of addr differs from the observed IP address.
+func amplificationAttackPrevention(observed, addr ma.Multiaddr) bool {
+	observedIP, err := manet.ToIP(observed)
+	if err != nil {
+		return true
+	}
+	dialIP, err := manet.ToIP(addr)
+	if err != nil {
+		return true
+	}
+	return !observedIP.Equal(dialIP)
+}
+
+func isPublicAddr(a ma.Multiaddr) bool {
+	return manet.IsPublicAddr(a)
+}
+
+// rateLimiter limits the number of dial requests handled per minute.
+// Every peer can only have a single request in flight.
+type rateLimiter struct {
+	// RPM is the total number of requests per minute.
+	RPM int
+	// PerPeerRPM is the number of requests per minute per peer.
+	PerPeerRPM int
+	// DialDataRPM is the number of requests per minute requiring dial data.
+	DialDataRPM int
+
+	now func() time.Time
+
+	mx           sync.Mutex
+	reqs         []entry
+	peerReqs     map[peer.ID][]time.Time
+	dialDataReqs []time.Time
+	ongoing      map[peer.ID]struct{}
+}
+
+type entry struct {
+	peer peer.ID
+	at   time.Time
+}
+
+// Accept reports whether a request from p is accepted. If it is,
+// CompleteRequest must be called when the request is done.
+func (r *rateLimiter) Accept(p peer.ID) bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	if r.peerReqs == nil {
+		r.peerReqs = make(map[peer.ID][]time.Time)
+		r.ongoing = make(map[peer.ID]struct{})
+	}
+	now := r.now()
+	r.cleanup(now)
+	if _, ok := r.ongoing[p]; ok {
+		return false
+	}
+	if len(r.reqs) >= r.RPM || len(r.peerReqs[p]) >= r.PerPeerRPM {
+		return false
+	}
+	r.ongoing[p] = struct{}{}
+	r.reqs = append(r.reqs, entry{peer: p, at: now})
+	r.peerReqs[p] = append(r.peerReqs[p], now)
+	return true
+}
+
+// AcceptDialDataRequest reports whether the server may request dial data from p.
+func (r *rateLimiter) AcceptDialDataRequest(p peer.ID) bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	now := r.now()
+	r.cleanup(now)
+	if len(r.dialDataReqs) >= r.DialDataRPM {
+		return false
+	}
+	r.dialDataReqs = append(r.dialDataReqs, now)
+	return true
+}
+
+// CompleteRequest marks the request from p as done.
+func (r *rateLimiter) CompleteRequest(p peer.ID) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	delete(r.ongoing, p)
+}
+
+// cleanup removes the requests older than a minute.
+func (r *rateLimiter) cleanup(now time.Time) {
+	minute := now.Add(-time.Minute)
+	i := 0
+	for ; i < len(r.reqs) && !r.reqs[i].at.After(minute); i++ {
+		p := r.reqs[i].peer
+		ts := r.peerReqs[p][1:]
+		if len(ts) == 0 {
+			delete(r.peerReqs, p)
+		} else {
+			r.peerReqs[p] = ts
+		}
+	}
+	r.reqs = r.reqs[i:]
+
+	i = 0
+	for ; i < len(r.dialDataReqs) && !r.dialDataReqs[i].After(minute); i++ {
+	}
+	r.dialDataReqs = r.dialDataReqs[i:]
+}
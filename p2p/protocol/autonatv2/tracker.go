@@ -0,0 +1,272 @@
+package autonatv2
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const (
+	// maxRecentResults is the number of probe results kept per address.
+	maxRecentResults = 5
+	// minConfidence is the difference between the number of successful and failed probes
+	// required to consider an address reachable (or unreachable).
+	minConfidence = 2
+)
+
+// addrStatus is the reachability state of a single address.
+type addrStatus struct {
+	addr ma.Multiaddr
+	// results are the results of the most recent probes, oldest first.
+	// Only definite results (public or private) are recorded.
+	results   []network.Reachability
+	nextProbe time.Time
+}
+
+func (s *addrStatus) reachability() network.Reachability {
+	var confidence int
+	for _, r := range s.results {
+		if r == network.ReachabilityPublic {
+			confidence++
+		} else {
+			confidence--
+		}
+	}
+	switch {
+	case confidence >= minConfidence:
+		return network.ReachabilityPublic
+	case confidence <= -minConfidence:
+		return network.ReachabilityPrivate
+	default:
+		return network.ReachabilityUnknown
+	}
+}
+
+// addrTracker periodically probes the host's addresses, and tracks their reachability.
+type addrTracker struct {
+	cli     *client
+	config  *config
+	emitter event.Emitter
+
+	mx    sync.RWMutex
+	addrs map[string]*addrStatus
+
+	// the last emitted event, only accessed from the background goroutine
+	last event.EvtHostReachableAddrsChanged
+}
+
+func newAddrTracker(h host.Host, cli *client, cfg *config) (*addrTracker, error) {
+	emitter, err := h.EventBus().Emitter(new(event.EvtHostReachableAddrsChanged), eventbus.Stateful)
+	if err != nil {
+		return nil, err
+	}
+	return &addrTracker{
+		cli:     cli,
+		config:  cfg,
+		emitter: emitter,
+		addrs:   make(map[string]*addrStatus),
+	}, nil
+}
+
+func (t *addrTracker) Close() error {
+	return t.emitter.Close()
+}
+
+// background probes the addresses that are due. It also runs when the host's addresses change,
+// or when a new peer is identified, since it might support the dial protocol.
+func (t *addrTracker) background(ctx context.Context, sub event.Subscription) {
+	defer sub.Close()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-sub.Out():
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+		next := t.probeDueAddrs(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		t.emitIfChanged()
+		timer.Reset(time.Until(next))
+	}
+}
+
+// probeDueAddrs updates the set of tracked addresses, and probes the ones that are due.
+// It returns the time of the next probe.
+func (t *addrTracker) probeDueAddrs(ctx context.Context) time.Time {
+	t.updateAddrs(t.config.addressFunc())
+	for {
+		a := t.nextDueAddr()
+		if a == nil {
+			break
+		}
+		res, err := t.cli.GetReachability(ctx, []Request{{Addr: a, SendDialData: true}})
+		if ctx.Err() != nil {
+			return time.Time{}
+		}
+		if err != nil {
+			log.Debugf("failed to verify reachability of %s: %s", a, err)
+		}
+		t.recordResult(a, res.Reachability)
+	}
+	return t.nextProbeTime()
+}
+
+// updateAddrs starts tracking new addresses in addrs, and stops tracking the ones that are gone.
+func (t *addrTracker) updateAddrs(addrs []ma.Multiaddr) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	now := t.config.now()
+	current := make(map[string]struct{}, len(addrs))
+	for _, a := range addrs {
+		if !t.config.allowPrivateAddrs && !isPublicAddr(a) {
+			continue
+		}
+		if _, err := a.ValueForProtocol(ma.P_CIRCUIT); err == nil {
+			continue
+		}
+		k := string(a.Bytes())
+		current[k] = struct{}{}
+		if _, ok := t.addrs[k]; !ok {
+			t.addrs[k] = &addrStatus{addr: a, nextProbe: now}
+		}
+	}
+	for k := range t.addrs {
+		if _, ok := current[k]; !ok {
+			delete(t.addrs, k)
+		}
+	}
+}
+
+func (t *addrTracker) nextDueAddr() ma.Multiaddr {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+
+	now := t.config.now()
+	for _, s := range t.addrs {
+		if !s.nextProbe.After(now) {
+			return s.addr
+		}
+	}
+	return nil
+}
+
+func (t *addrTracker) nextProbeTime() time.Time {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+
+	next := t.config.now().Add(t.config.refreshInterval)
+	for _, s := range t.addrs {
+		if s.nextProbe.Before(next) {
+			next = s.nextProbe
+		}
+	}
+	return next
+}
+
+// recordResult records the result of a probe of a. Unknown results (e.g. because the probe failed)
+// don't affect the reachability of the address, but it is only retried after the retry interval.
+func (t *addrTracker) recordResult(a ma.Multiaddr, r network.Reachability) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	s, ok := t.addrs[string(a.Bytes())]
+	if !ok {
+		return
+	}
+	now := t.config.now()
+	if r == network.ReachabilityUnknown {
+		s.nextProbe = now.Add(t.config.retryInterval)
+		return
+	}
+	s.results = append(s.results, r)
+	if len(s.results) > maxRecentResults {
+		s.results = s.results[len(s.results)-maxRecentResults:]
+	}
+	if s.reachability() == network.ReachabilityUnknown {
+		s.nextProbe = now.Add(t.config.retryInterval)
+	} else {
+		s.nextProbe = now.Add(t.config.refreshInterval)
+	}
+}
+
+// Reachability returns the reachability of a.
+func (t *addrTracker) Reachability(a ma.Multiaddr) network.Reachability {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+
+	s, ok := t.addrs[string(a.Bytes())]
+	if !ok {
+		return network.ReachabilityUnknown
+	}
+	return s.reachability()
+}
+
+// Addrs returns the tracked addresses, grouped by reachability, and sorted.
+func (t *addrTracker) Addrs() (reachable, unreachable, unknown []ma.Multiaddr) {
+	t.mx.RLock()
+	defer t.mx.RUnlock()
+
+	for _, s := range t.addrs {
+		switch s.reachability() {
+		case network.ReachabilityPublic:
+			reachable = append(reachable, s.addr)
+		case network.ReachabilityPrivate:
+			unreachable = append(unreachable, s.addr)
+		default:
+			unknown = append(unknown, s.addr)
+		}
+	}
+	for _, addrs := range [][]ma.Multiaddr{reachable, unreachable, unknown} {
+		sort.Slice(addrs, func(i, j int) bool { return addrs[i].String() < addrs[j].String() })
+	}
+	return reachable, unreachable, unknown
+}
+
+func (t *addrTracker) emitIfChanged() {
+	reachable, unreachable, unknown := t.Addrs()
+	if addrsEqual(reachable, t.last.Reachable) &&
+		addrsEqual(unreachable, t.last.Unreachable) &&
+		addrsEqual(unknown, t.last.Unknown) {
+		return
+	}
+	t.last = event.EvtHostReachableAddrsChanged{
+		Reachable:   reachable,
+		Unreachable: unreachable,
+		Unknown:     unknown,
+	}
+	if err := t.emitter.Emit(t.last); err != nil {
+		log.Debugf("failed to emit reachable addresses changed event: %s", err)
+	}
+}
+
+func addrsEqual(a, b []ma.Multiaddr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
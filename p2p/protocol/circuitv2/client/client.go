@@ -5,7 +5,9 @@ import (
 	"io"
 	"sync"
 
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/transport"
 	"github.com/libp2p/go-libp2p/p2p/protocol/circuitv2/proto"
@@ -15,6 +17,16 @@ import (
 
 var log = logging.Logger("p2p-circuit")
 
+// Resource manager service names of the streams carrying relayed connections, by our role on the circuit.
+// Together with the relay's service name (relay.ServiceName), used for transit traffic, they allow
+// limiting and monitoring relayed traffic by role.
+const (
+	// ClientServiceName is the service of the hop streams we open to dial peers through relays.
+	ClientServiceName = "libp2p.relay/v2/client"
+	// DestinationServiceName is the service of the stop streams relays open when peers dial us through them.
+	DestinationServiceName = "libp2p.relay/v2/destination"
+)
+
 // Client implements the client-side of the p2p-circuit/v2 protocol:
 // - it implements dialing through v2 relays
 // - it listens for incoming connections through v2 relays.
@@ -31,9 +43,18 @@ type Client struct {
 
 	incoming chan accept
 
+	refCount sync.WaitGroup
+
+	// preconnectMinPeers is the number of peers that need to be reachable through a relay
+	// for us to pre-connect to it. 0 disables pre-connecting.
+	preconnectMinPeers int
+	learner            *relayLearner
+
+	latencyEmitter event.Emitter
+
 	mx          sync.Mutex
 	activeDials map[peer.ID]*completion
-	hopCount    map[peer.ID]int
+	hopCount    map[hopKey]int
 }
 
 var _ io.Closer = &Client{}
@@ -44,6 +65,12 @@ type accept struct {
 	writeResponse func() error
 }
 
+// hopKey identifies the relay connections carrying circuits of a role
+type hopKey struct {
+	peer peer.ID
+	role network.RelayRole
+}
+
 type completion struct {
 	ch    chan struct{}
 	relay peer.ID
@@ -52,25 +79,42 @@ type completion struct {
 
 // New constructs a new p2p-circuit/v2 client, attached to the given host and using the given
 // upgrader to perform connection upgrades.
-func New(h host.Host, upgrader transport.Upgrader) (*Client, error) {
+func New(h host.Host, upgrader transport.Upgrader, opts ...Option) (*Client, error) {
 	cl := &Client{
 		host:        h,
 		upgrader:    upgrader,
 		incoming:    make(chan accept),
 		activeDials: make(map[peer.ID]*completion),
-		hopCount:    make(map[peer.ID]int),
+		hopCount:    make(map[hopKey]int),
+	}
+	for _, opt := range opts {
+		if err := opt(cl); err != nil {
+			return nil, err
+		}
 	}
+	emitter, err := h.EventBus().Emitter(new(event.EvtCircuitLatencyMeasured))
+	if err != nil {
+		return nil, err
+	}
+	cl.latencyEmitter = emitter
+	cl.learner = newRelayLearner(cl)
 	cl.ctx, cl.ctxCancel = context.WithCancel(context.Background())
 	return cl, nil
 }
 
-// Start registers the circuit (client) protocol stream handlers
+// Start registers the circuit (client) protocol stream handlers,
+// and starts learning the addresses of the relays our peers use.
 func (c *Client) Start() {
 	c.host.SetStreamHandler(proto.ProtoIDv2Stop, c.handleStreamV2)
+	if err := c.learner.start(); err != nil {
+		log.Errorw("failed to start learning relay addresses", "error", err)
+	}
 }
 
 func (c *Client) Close() error {
 	c.ctxCancel()
 	c.host.RemoveStreamHandler(proto.ProtoIDv2Stop)
+	c.refCount.Wait()
+	c.latencyEmitter.Close()
 	return nil
 }
@@ -13,9 +13,27 @@ import (
 	manet "github.com/multiformats/go-multiaddr/net"
 )
 
-// HopTagWeight is the connection manager weight for connections carrying relay hop streams
+// HopTagWeight is the connection manager weight for connections carrying relay hop streams,
+// i.e. connections to relays we dialed other peers through.
 var HopTagWeight = 5
 
+// StopTagWeight is the connection manager weight for connections carrying relay stop streams,
+// i.e. connections to relays other peers dialed us through.
+var StopTagWeight = 5
+
+const (
+	hopTag  = "relay-hop-stream"
+	stopTag = "relay-stop-stream"
+)
+
+// relayTag is the connection manager tag for a relay connection carrying circuits of role r.
+func relayTag(r network.RelayRole) (tag string, weight int) {
+	if r == network.RelayRoleDestination {
+		return stopTag, StopTagWeight
+	}
+	return hopTag, HopTagWeight
+}
+
 type statLimitDuration struct{}
 type statLimitData struct{}
 
@@ -49,6 +67,7 @@ func (n *NetAddr) String() string {
 
 // Conn interface
 var _ manet.Conn = (*Conn)(nil)
+var _ tpt.PeerHintConn = (*Conn)(nil)
 
 func (c *Conn) Close() error {
 	c.untagHop()
@@ -111,6 +130,12 @@ func (c *Conn) RemoteAddr() net.Addr {
 // ConnStat interface
 var _ network.ConnStat = (*Conn)(nil)
 
+// RemotePeerHint returns the ID of the remote peer, as announced by the relay.
+// For inbound connections, this allows the connection gater to reject the peer before the handshake.
+func (c *Conn) RemotePeerHint() peer.ID {
+	return c.remote.ID
+}
+
 func (c *Conn) Stat() network.ConnStats {
 	return c.stat
 }
@@ -120,28 +145,31 @@ func (c *Conn) Stat() network.ConnStats {
 // This is handled here so that the user code doesnt need to bother with this and avoid
 // clown shoes situations where a high value peer connection is behind a relayed connection and it is
 // implicitly because the connection manager closed the underlying relay connection.
+// The tag depends on our role: relay-hop-stream if we're the client, relay-stop-stream if we're the destination.
 func (c *Conn) tagHop() {
 	c.client.mx.Lock()
 	defer c.client.mx.Unlock()
 
-	p := c.stream.Conn().RemotePeer()
-	c.client.hopCount[p]++
-	if c.client.hopCount[p] == 1 {
-		c.client.host.ConnManager().TagPeer(p, "relay-hop-stream", HopTagWeight)
+	key := hopKey{peer: c.stream.Conn().RemotePeer(), role: c.stat.RelayRole}
+	c.client.hopCount[key]++
+	if c.client.hopCount[key] == 1 {
+		tag, weight := relayTag(key.role)
+		c.client.host.ConnManager().TagPeer(key.peer, tag, weight)
 	}
 }
 
-// untagHop removes the relay-hop-stream tag if necessary; it is invoked when a relayed connection
-// is closed.
+// untagHop removes the relay-hop-stream or relay-stop-stream tag if necessary; it is invoked when
+// a relayed connection is closed.
 func (c *Conn) untagHop() {
 	c.client.mx.Lock()
 	defer c.client.mx.Unlock()
 
-	p := c.stream.Conn().RemotePeer()
-	c.client.hopCount[p]--
-	if c.client.hopCount[p] == 0 {
-		c.client.host.ConnManager().UntagPeer(p, "relay-hop-stream")
-		delete(c.client.hopCount, p)
+	key := hopKey{peer: c.stream.Conn().RemotePeer(), role: c.stat.RelayRole}
+	c.client.hopCount[key]--
+	if c.client.hopCount[key] == 0 {
+		tag, _ := relayTag(key.role)
+		c.client.host.ConnManager().UntagPeer(key.peer, tag)
+		delete(c.client.hopCount, key)
 	}
 }
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
@@ -131,6 +132,10 @@ func (c *Client) dialPeer(ctx context.Context, relay, dest peer.AddrInfo) (*Conn
 }
 
 func (c *Client) connect(s network.Stream, dest peer.AddrInfo) (*Conn, error) {
+	if err := s.Scope().SetService(ClientServiceName); err != nil {
+		s.Reset()
+		return nil, err
+	}
 	if err := s.Scope().ReserveMemory(maxMessageSize, network.ReservationPriorityAlways); err != nil {
 		s.Reset()
 		return nil, err
@@ -148,6 +153,7 @@ func (c *Client) connect(s network.Stream, dest peer.AddrInfo) (*Conn, error) {
 
 	s.SetDeadline(time.Now().Add(DialTimeout))
 
+	start := time.Now()
 	err := wr.WriteMsg(&msg)
 	if err != nil {
 		s.Reset()
@@ -174,10 +180,11 @@ func (c *Client) connect(s network.Stream, dest peer.AddrInfo) (*Conn, error) {
 		s.Reset()
 		return nil, newRelayError("error opening relay circuit: %s (%d)", pbv2.Status_name[int32(status)], status)
 	}
+	c.emitCircuitLatency(s.Conn().RemotePeer(), dest.ID, time.Since(start))
 
 	// check for a limit provided by the relay; if the limit is not nil, then this is a limited
 	// relay connection and we mark the connection as transient.
-	var stat network.ConnStats
+	stat := network.ConnStats{RelayRole: network.RelayRoleClient}
 	if limit := msg.GetLimit(); limit != nil {
 		stat.Transient = true
 		stat.Extra = make(map[interface{}]interface{})
@@ -187,3 +194,19 @@ func (c *Client) connect(s network.Stream, dest peer.AddrInfo) (*Conn, error) {
 
 	return &Conn{stream: s, remote: dest, stat: stat, client: c}, nil
 }
+
+// emitCircuitLatency reports the latency of a circuit we opened. The round trip time to the relay
+// is known if we measured it before (e.g. using ping), which allows us to derive the latency of the
+// leg from the relay to the destination.
+func (c *Client) emitCircuitLatency(relay, dest peer.ID, circuitRTT time.Duration) {
+	evt := event.EvtCircuitLatencyMeasured{
+		Relay:      relay,
+		Peer:       dest,
+		CircuitRTT: circuitRTT,
+		RelayRTT:   c.host.Peerstore().LatencyEWMA(relay),
+	}
+	if evt.RelayRTT > 0 && evt.RelayRTT < circuitRTT {
+		evt.DestinationRTT = circuitRTT - evt.RelayRTT
+	}
+	c.latencyEmitter.Emit(evt)
+}
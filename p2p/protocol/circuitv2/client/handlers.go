@@ -16,6 +16,12 @@ var (
 func (c *Client) handleStreamV2(s network.Stream) {
 	log.Debugf("new relay/v2 stream from: %s", s.Conn().RemotePeer())
 
+	if err := s.Scope().SetService(DestinationServiceName); err != nil {
+		log.Debugf("error attaching stream to relay destination service: %s", err)
+		s.Reset()
+		return
+	}
+
 	s.SetReadDeadline(time.Now().Add(StreamTimeout))
 
 	rd := util.NewDelimitedReader(s, maxMessageSize)
@@ -65,7 +71,7 @@ func (c *Client) handleStreamV2(s network.Stream) {
 
 	// check for a limit provided by the relay; if the limit is not nil, then this is a limited
 	// relay connection and we mark the connection as transient.
-	var stat network.ConnStats
+	stat := network.ConnStats{RelayRole: network.RelayRoleDestination}
 	if limit := msg.GetLimit(); limit != nil {
 		stat.Transient = true
 		stat.Extra = make(map[interface{}]interface{})
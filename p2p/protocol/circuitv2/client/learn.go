@@ -0,0 +1,239 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/host/eventbus"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// LearnedRelayAddrTTL is the TTL of the relay addresses learned from the signed peer records
+// of peers that are only reachable through relays.
+var LearnedRelayAddrTTL = time.Hour
+
+const (
+	// maxLearnedRelaysPerPeer is the maximum number of relays learned from a single peer.
+	maxLearnedRelaysPerPeer = 4
+	// maxLearnedAddrsPerRelay is the maximum number of addresses learned for a single relay.
+	maxLearnedAddrsPerRelay = 8
+	// maxLearnedRelays is the maximum number of relays tracked in total.
+	maxLearnedRelays = 256
+)
+
+// relayLearner learns the direct addresses of the relays our peers are reachable through.
+// When a peer only advertises relay addresses in its signed peer record, the relay's addresses
+// contained in these relay addresses are added to the peerstore, so that later dials through
+// that relay don't need to discover them first.
+// If preconnecting is enabled, we connect to relays that are used by many of our peers.
+type relayLearner struct {
+	c *Client
+
+	mx sync.Mutex
+	// relays maps relays to the peers that are only reachable through them
+	relays map[peer.ID]map[peer.ID]struct{}
+	// peers maps peers to the relays they are reachable through
+	peers map[peer.ID][]peer.ID
+	// connecting are the relays we're currently pre-connecting to
+	connecting map[peer.ID]struct{}
+}
+
+func newRelayLearner(c *Client) *relayLearner {
+	return &relayLearner{
+		c:          c,
+		relays:     make(map[peer.ID]map[peer.ID]struct{}),
+		peers:      make(map[peer.ID][]peer.ID),
+		connecting: make(map[peer.ID]struct{}),
+	}
+}
+
+func (l *relayLearner) start() error {
+	sub, err := l.c.host.EventBus().Subscribe(
+		[]interface{}{new(event.EvtPeerIdentificationCompleted), new(event.EvtPeerConnectednessChanged)},
+		eventbus.Name("circuit-v2-client"),
+	)
+	if err != nil {
+		return err
+	}
+	l.c.refCount.Add(1)
+	go func() {
+		defer l.c.refCount.Done()
+		defer sub.Close()
+		for {
+			select {
+			case e := <-sub.Out():
+				switch evt := e.(type) {
+				case event.EvtPeerIdentificationCompleted:
+					l.identified(evt)
+				case event.EvtPeerConnectednessChanged:
+					if evt.Connectedness == network.NotConnected {
+						l.removePeer(evt.Peer)
+					}
+				}
+			case <-l.c.ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (l *relayLearner) identified(evt event.EvtPeerIdentificationCompleted) {
+	if evt.SignedPeerRecord == nil {
+		return
+	}
+	r, err := evt.SignedPeerRecord.Record()
+	if err != nil {
+		return
+	}
+	rec, ok := r.(*peer.PeerRecord)
+	if !ok {
+		return
+	}
+	relays := relaysOf(rec.Addrs)
+	if len(relays) == 0 {
+		return
+	}
+
+	self := l.c.host.ID()
+	learned := make([]peer.AddrInfo, 0, maxLearnedRelaysPerPeer)
+	for _, relay := range relays {
+		if relay.ID == self || relay.ID == evt.Peer {
+			continue
+		}
+		// The record is signed by the peer, not by the relay, so we only learn public addresses.
+		addrs := ma.FilterAddrs(relay.Addrs, manet.IsPublicAddr)
+		if len(addrs) > maxLearnedAddrsPerRelay {
+			addrs = addrs[:maxLearnedAddrsPerRelay]
+		}
+		learned = append(learned, peer.AddrInfo{ID: relay.ID, Addrs: addrs})
+		if len(learned) == maxLearnedRelaysPerPeer {
+			break
+		}
+	}
+
+	l.mx.Lock()
+	l.removePeerLocked(evt.Peer)
+	ids := make([]peer.ID, 0, len(learned))
+	accepted := learned[:0]
+	var preconnect []peer.ID
+	for _, info := range learned {
+		relay := info.ID
+		ps, ok := l.relays[relay]
+		if !ok {
+			if len(l.relays) >= maxLearnedRelays {
+				continue
+			}
+			ps = make(map[peer.ID]struct{})
+			l.relays[relay] = ps
+		}
+		ps[evt.Peer] = struct{}{}
+		ids = append(ids, relay)
+		accepted = append(accepted, info)
+		if l.shouldPreconnectLocked(relay) {
+			l.connecting[relay] = struct{}{}
+			preconnect = append(preconnect, relay)
+		}
+	}
+	if len(ids) > 0 {
+		l.peers[evt.Peer] = ids
+	}
+	l.mx.Unlock()
+	log.Debugw("learned relays of peer", "peer", evt.Peer, "relays", ids)
+
+	for _, relay := range accepted {
+		if len(relay.Addrs) > 0 {
+			l.c.host.Peerstore().AddAddrs(relay.ID, relay.Addrs, LearnedRelayAddrTTL)
+		}
+	}
+	for _, relay := range preconnect {
+		l.c.refCount.Add(1)
+		go l.preconnect(relay)
+	}
+}
+
+func (l *relayLearner) shouldPreconnectLocked(relay peer.ID) bool {
+	if l.c.preconnectMinPeers == 0 || len(l.relays[relay]) < l.c.preconnectMinPeers {
+		return false
+	}
+	if _, ok := l.connecting[relay]; ok {
+		return false
+	}
+	return l.c.host.Network().Connectedness(relay) != network.Connected
+}
+
+func (l *relayLearner) preconnect(relay peer.ID) {
+	defer l.c.refCount.Done()
+	defer func() {
+		l.mx.Lock()
+		delete(l.connecting, relay)
+		l.mx.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(l.c.ctx, DialRelayTimeout)
+	defer cancel()
+	log.Debugw("pre-connecting to relay", "relay", relay)
+	if err := l.c.host.Connect(ctx, peer.AddrInfo{ID: relay}); err != nil {
+		log.Debugw("failed to pre-connect to relay", "relay", relay, "error", err)
+	}
+}
+
+func (l *relayLearner) removePeer(p peer.ID) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	l.removePeerLocked(p)
+}
+
+func (l *relayLearner) removePeerLocked(p peer.ID) {
+	for _, relay := range l.peers[p] {
+		ps := l.relays[relay]
+		delete(ps, p)
+		if len(ps) == 0 {
+			delete(l.relays, relay)
+		}
+	}
+	delete(l.peers, p)
+}
+
+// numPeers returns the number of peers that are only reachable through relay.
+func (l *relayLearner) numPeers(relay peer.ID) int {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	return len(l.relays[relay])
+}
+
+// relaysOf returns the relays contained in addrs, if all addresses are relay addresses.
+// It returns nil if addrs contains a direct address.
+func relaysOf(addrs []ma.Multiaddr) []peer.AddrInfo {
+	relays := make(map[peer.ID][]ma.Multiaddr)
+	for _, a := range addrs {
+		relayAddr, circuit := ma.SplitFunc(a, func(c ma.Component) bool {
+			return c.Protocol().Code == ma.P_CIRCUIT
+		})
+		if circuit == nil {
+			return nil
+		}
+		transport, id := peer.SplitAddr(relayAddr)
+		if id == "" {
+			continue
+		}
+		if transport == nil {
+			if _, ok := relays[id]; !ok {
+				relays[id] = nil
+			}
+			continue
+		}
+		relays[id] = append(relays[id], transport)
+	}
+	infos := make([]peer.AddrInfo, 0, len(relays))
+	for id, addrs := range relays {
+		infos = append(infos, peer.AddrInfo{ID: id, Addrs: addrs})
+	}
+	return infos
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/record"
+	"github.com/libp2p/go-libp2p/core/test"
+	bhost "github.com/libp2p/go-libp2p/p2p/host/blank"
+	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelaysOf(t *testing.T) {
+	const relay = "QmcgpsyWgH8Y8ajJz1Cu72KnS5uo2Aa2LpzU7kinSupNKC"
+	relayID, err := peer.Decode(relay)
+	require.NoError(t, err)
+
+	relays := relaysOf([]ma.Multiaddr{
+		ma.StringCast("/ip4/1.2.3.4/tcp/1/p2p/" + relay + "/p2p-circuit"),
+		ma.StringCast("/ip4/1.2.3.4/udp/1/quic-v1/p2p/" + relay + "/p2p-circuit"),
+	})
+	require.Len(t, relays, 1)
+	require.Equal(t, relayID, relays[0].ID)
+	require.Len(t, relays[0].Addrs, 2)
+
+	relays = relaysOf([]ma.Multiaddr{ma.StringCast("/p2p/" + relay + "/p2p-circuit")})
+	require.Equal(t, []peer.AddrInfo{{ID: relayID}}, relays)
+
+	// peers with a direct address are not only reachable through the relay
+	require.Empty(t, relaysOf([]ma.Multiaddr{
+		ma.StringCast("/ip4/1.2.3.4/tcp/1/p2p/" + relay + "/p2p-circuit"),
+		ma.StringCast("/ip4/5.6.7.8/tcp/1"),
+	}))
+}
+
+func relayedPeerRecord(t *testing.T, relay ma.Multiaddr) (peer.ID, *record.Envelope) {
+	t.Helper()
+	priv, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	rec := peer.PeerRecordFromAddrInfo(peer.AddrInfo{
+		ID:    id,
+		Addrs: []ma.Multiaddr{relay.Encapsulate(ma.StringCast("/p2p-circuit"))},
+	})
+	env, err := record.Seal(rec, priv)
+	require.NoError(t, err)
+	return id, env
+}
+
+func TestLearnedRelayLimits(t *testing.T) {
+	h := bhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h.Close()
+	c, err := New(h, nil)
+	require.NoError(t, err)
+	defer c.Close()
+
+	relayAddr := func() (peer.ID, ma.Multiaddr) {
+		id := test.RandPeerIDFatal(t)
+		return id, ma.StringCast("/ip4/1.2.3.4/tcp/1/p2p/" + id.String())
+	}
+	// a record listing more relays than we learn from a single peer
+	priv, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	p, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	var addrs []ma.Multiaddr
+	for i := 0; i < 2*maxLearnedRelaysPerPeer; i++ {
+		_, a := relayAddr()
+		addrs = append(addrs, a.Encapsulate(ma.StringCast("/p2p-circuit")))
+	}
+	env, err := record.Seal(peer.PeerRecordFromAddrInfo(peer.AddrInfo{ID: p, Addrs: addrs}), priv)
+	require.NoError(t, err)
+	c.learner.identified(event.EvtPeerIdentificationCompleted{Peer: p, SignedPeerRecord: env})
+	require.Len(t, c.learner.peers[p], maxLearnedRelaysPerPeer)
+	for _, relay := range c.learner.peers[p] {
+		require.Len(t, h.Peerstore().Addrs(relay), 1)
+	}
+
+	// fill up the relays tracked in total
+	for len(c.learner.relays) < maxLearnedRelays {
+		_, a := relayAddr()
+		id, env := relayedPeerRecord(t, a)
+		c.learner.identified(event.EvtPeerIdentificationCompleted{Peer: id, SignedPeerRecord: env})
+	}
+	relay, a := relayAddr()
+	id, env := relayedPeerRecord(t, a)
+	c.learner.identified(event.EvtPeerIdentificationCompleted{Peer: id, SignedPeerRecord: env})
+	require.Len(t, c.learner.relays, maxLearnedRelays)
+	require.Zero(t, c.learner.numPeers(relay))
+	require.Empty(t, h.Peerstore().Addrs(relay))
+	require.NotContains(t, c.learner.peers, id)
+}
+
+func TestRelayPreconnect(t *testing.T) {
+	h := bhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h.Close()
+	relay := bhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer relay.Close()
+
+	c, err := New(h, nil, WithRelayPreconnect(2))
+	require.NoError(t, err)
+	defer c.Close()
+
+	relayAddr := relay.Addrs()[0].Encapsulate(ma.StringCast("/p2p/" + relay.ID().String()))
+	p1, rec1 := relayedPeerRecord(t, relayAddr)
+	p2, rec2 := relayedPeerRecord(t, relayAddr)
+
+	c.learner.identified(event.EvtPeerIdentificationCompleted{Peer: p1, SignedPeerRecord: rec1})
+	require.Equal(t, 1, c.learner.numPeers(relay.ID()))
+	// only public addresses are learned
+	require.Empty(t, h.Peerstore().Addrs(relay.ID()))
+	require.Equal(t, network.NotConnected, h.Network().Connectedness(relay.ID()))
+	h.Peerstore().AddAddrs(relay.ID(), relay.Addrs(), time.Hour)
+
+	// the relay is used by enough peers now
+	c.learner.identified(event.EvtPeerIdentificationCompleted{Peer: p2, SignedPeerRecord: rec2})
+	require.Equal(t, 2, c.learner.numPeers(relay.ID()))
+	require.Eventually(t, func() bool {
+		return h.Network().Connectedness(relay.ID()) == network.Connected
+	}, 5*time.Second, 10*time.Millisecond)
+
+	c.learner.removePeer(p1)
+	c.learner.removePeer(p2)
+	require.Zero(t, c.learner.numPeers(relay.ID()))
+}
@@ -0,0 +1,19 @@
+package client
+
+import "errors"
+
+type Option func(*Client) error
+
+// WithRelayPreconnect is a Client option that pre-connects to relays that at least minPeers
+// of our peers are only reachable through, reducing the latency of the first relayed
+// connection to these peers.
+// The relays' addresses are learned from the signed peer records of our peers.
+func WithRelayPreconnect(minPeers int) Option {
+	return func(c *Client) error {
+		if minPeers < 1 {
+			return errors.New("minPeers must be at least 1")
+		}
+		c.preconnectMinPeers = minPeers
+		return nil
+	}
+}
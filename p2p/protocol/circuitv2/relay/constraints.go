@@ -2,6 +2,7 @@ package relay
 
 import (
 	"errors"
+	"net"
 	"sync"
 	"time"
 
@@ -67,7 +68,7 @@ func (c *constraints) AddReservation(p peer.ID, a ma.Multiaddr) error {
 		return errTooManyReservationsForPeer
 	}
 
-	ipReservations := c.ips[ip.String()]
+	ipReservations := c.ips[ipKey(ip)]
 	if len(ipReservations) >= c.rc.MaxReservationsPerIP {
 		return errTooManyReservationsForIP
 	}
@@ -91,7 +92,7 @@ func (c *constraints) AddReservation(p peer.ID, a ma.Multiaddr) error {
 	c.peers[p] = peerReservations
 
 	ipReservations = append(ipReservations, expiry)
-	c.ips[ip.String()] = ipReservations
+	c.ips[ipKey(ip)] = ipReservations
 
 	if asn != "" {
 		asnReservations = append(asnReservations, expiry)
@@ -100,6 +101,19 @@ func (c *constraints) AddReservation(p peer.ID, a ma.Multiaddr) error {
 	return nil
 }
 
+// ipv6PrefixLength is the length of the prefix IPv6 addresses are grouped by when applying
+// the per-IP reservation limit. A single host usually controls (at least) an entire /64,
+// and can trivially use a different address for every reservation.
+const ipv6PrefixLength = 64
+
+// ipKey returns the key used to apply the per-IP reservation limit for ip.
+func ipKey(ip net.IP) string {
+	if ip.To4() != nil {
+		return ip.String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(ipv6PrefixLength, 128)), Mask: net.CIDRMask(ipv6PrefixLength, 128)}).String()
+}
+
 func (c *constraints) cleanupList(l []time.Time, now time.Time) []time.Time {
 	var index int
 	for i, t := range l {
@@ -85,6 +85,24 @@ func TestConstraints(t *testing.T) {
 		}
 	})
 
+	t.Run("reservations per IPv6 prefix", func(t *testing.T) {
+		res := infResources()
+		res.MaxReservationsPerIP = limit
+		c := newConstraints(res)
+		// all these addresses are in the same /64
+		for i := 0; i < limit; i++ {
+			if err := c.AddReservation(test.RandPeerIDFatal(t), ma.StringCast(fmt.Sprintf("/ip6/2001:db8:1:2::%x/tcp/1234", i+1))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := c.AddReservation(test.RandPeerIDFatal(t), ma.StringCast("/ip6/2001:db8:1:2:ffff::1/udp/1234/quic-v1")); err != errTooManyReservationsForIP {
+			t.Fatalf("expected to run into IP reservation limit, got %v", err)
+		}
+		if err := c.AddReservation(test.RandPeerIDFatal(t), ma.StringCast("/ip6/2001:db8:1:3::1/tcp/1234")); err != nil {
+			t.Fatalf("expected reservation for different IPv6 prefix to be possible, got %v", err)
+		}
+	})
+
 	t.Run("reservations per ASN", func(t *testing.T) {
 		getAddr := func(t *testing.T, ip net.IP) ma.Multiaddr {
 			t.Helper()
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/metrics"
 	"github.com/libp2p/go-libp2p/core/network"
@@ -157,6 +158,16 @@ func TestBasicRelay(t *testing.T) {
 	if !conns[0].Stat().Transient {
 		t.Fatal("expected transient connection")
 	}
+	if role := conns[0].Stat().RelayRole; role != network.RelayRoleClient {
+		t.Fatalf("expected relay role %s on the dialing side, got %s", network.RelayRoleClient, role)
+	}
+	conns = hosts[0].Network().ConnsToPeer(hosts[2].ID())
+	if len(conns) != 1 {
+		t.Fatalf("expected 1 connection, but got %d", len(conns))
+	}
+	if role := conns[0].Stat().RelayRole; role != network.RelayRoleDestination {
+		t.Fatalf("expected relay role %s on the destination, got %s", network.RelayRoleDestination, role)
+	}
 
 	s, err := hosts[2].NewStream(network.WithUseTransient(ctx, "test"), hosts[0].ID(), "test")
 	if err != nil {
@@ -179,6 +190,55 @@ func TestBasicRelay(t *testing.T) {
 	}
 }
 
+func TestCircuitLatencyEvent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hosts, upgraders := getNetHosts(t, ctx, 3)
+	addTransport(t, hosts[0], upgraders[0])
+	addTransport(t, hosts[2], upgraders[2])
+
+	r, err := relay.New(hosts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	connect(t, hosts[0], hosts[1])
+	connect(t, hosts[1], hosts[2])
+
+	rinfo := hosts[1].Peerstore().PeerInfo(hosts[1].ID())
+	if _, err := client.Reserve(ctx, hosts[0], rinfo); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := hosts[2].EventBus().Subscribe(new(event.EvtCircuitLatencyMeasured))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	// pretend we measured a tiny RTT to the relay, so that the destination leg can be told apart
+	hosts[2].Peerstore().RecordLatency(hosts[1].ID(), time.Nanosecond)
+
+	raddr := ma.StringCast(fmt.Sprintf("/p2p/%s/p2p-circuit/p2p/%s", hosts[1].ID(), hosts[0].ID()))
+	if err := hosts[2].Connect(ctx, peer.AddrInfo{ID: hosts[0].ID(), Addrs: []ma.Multiaddr{raddr}}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case e := <-sub.Out():
+		evt := e.(event.EvtCircuitLatencyMeasured)
+		if evt.Relay != hosts[1].ID() || evt.Peer != hosts[0].ID() {
+			t.Fatalf("unexpected event: %+v", evt)
+		}
+		if evt.CircuitRTT <= 0 || evt.RelayRTT != time.Nanosecond || evt.DestinationRTT != evt.CircuitRTT-evt.RelayRTT {
+			t.Fatalf("unexpected latencies: %+v", evt)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the circuit latency event")
+	}
+}
+
 func TestRelayLimitTime(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -24,7 +24,7 @@ type Resources struct {
 	// peer; default is 4.
 	MaxReservationsPerPeer int
 	// MaxReservationsPerIP is the maximum number of reservations originating from the same
-	// IP address; default is 8.
+	// IP address; default is 8. IPv6 addresses are grouped by their /64 prefix.
 	MaxReservationsPerIP int
 	// MaxReservationsPerASN is the maximum number of reservations origination from the same
 	// ASN; default is 32
@@ -2,6 +2,8 @@ package holepunch_test
 
 import (
 	"context"
+	"errors"
+	"io"
 	"net"
 	"sync"
 	"testing"
@@ -9,6 +11,7 @@ import (
 
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p-testing/race"
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
@@ -168,6 +171,122 @@ func TestEndToEndSimConnect(t *testing.T) {
 	}
 }
 
+func TestDirectConnectionUpgraded(t *testing.T) {
+	const testProto = "/test/migrate"
+	migrated := make(chan network.Stream, 1)
+	migrator := holepunch.WithStreamMigration(testProto, func(_ context.Context, old network.Stream, direct network.Conn) error {
+		if isRelayed(direct.RemoteMultiaddr()) {
+			return errors.New("expected a direct connection")
+		}
+		migrated <- old
+		return nil
+	})
+	h1, h2, relay, _ := makeRelayedHosts(t, nil, nil, false)
+	defer h1.Close()
+	defer h2.Close()
+	defer relay.Close()
+
+	// open a stream on the relayed connection
+	h2.SetStreamHandler(testProto, func(s network.Stream) { io.Copy(io.Discard, s) })
+	str, err := h1.NewStream(network.WithUseTransient(context.Background(), "test"), h2.ID(), testProto)
+	require.NoError(t, err)
+	defer str.Close()
+	_, err = str.Write([]byte("foobar"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		for _, c := range h2.Network().ConnsToPeer(h1.ID()) {
+			for _, s := range c.GetStreams() {
+				if s.Protocol() == testProto {
+					return true
+				}
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+
+	sub, err := h2.EventBus().Subscribe(new(event.EvtDirectConnectionUpgraded))
+	require.NoError(t, err)
+	defer sub.Close()
+	hps := addHolePunchService(t, h2, migrator)
+	require.NoError(t, hps.DirectConnect(h1.ID()))
+
+	var evt event.EvtDirectConnectionUpgraded
+	select {
+	case e := <-sub.Out():
+		evt = e.(event.EvtDirectConnectionUpgraded)
+	case <-time.After(5 * time.Second):
+		t.Fatal("didn't receive a direct connection upgrade event")
+	}
+	require.Equal(t, h1.ID(), evt.Peer)
+	require.NotEqual(t, evt.RelayedConnID, evt.DirectConnID)
+	var old network.Stream
+	select {
+	case old = <-migrated:
+	default:
+		t.Fatal("stream wasn't migrated")
+	}
+	require.Equal(t, []string{old.ID()}, evt.Migrated)
+	for _, c := range h2.Network().ConnsToPeer(h1.ID()) {
+		switch c.ID() {
+		case evt.RelayedConnID:
+			require.True(t, isRelayed(c.RemoteMultiaddr()))
+		case evt.DirectConnID:
+			require.False(t, isRelayed(c.RemoteMultiaddr()))
+		}
+	}
+}
+
+func TestUpgradeConnection(t *testing.T) {
+	// Exchange the listen addresses instead of the observed addresses,
+	// so that the hole punch can succeed on localhost.
+	listenAddrs := func(h *host.Host) holepunch.AddrFilter {
+		return mockMaddrFilter{
+			filterLocal:  func(peer.ID, []ma.Multiaddr) []ma.Multiaddr { return (*h).Addrs() },
+			filterRemote: func(_ peer.ID, addrs []ma.Multiaddr) []ma.Multiaddr { return addrs },
+		}
+	}
+	var h1, h2 host.Host
+	h1, hps := mkHostWithHolePunchSvc(t, holepunch.WithAddrFilter(listenAddrs(&h1)))
+	defer h1.Close()
+	h2, _ = mkHostWithHolePunchSvc(t, holepunch.WithAddrFilter(listenAddrs(&h2)))
+	defer h2.Close()
+
+	isIP6 := func(a ma.Multiaddr) bool {
+		_, err := a.ValueForProtocol(ma.P_IP6)
+		return err == nil
+	}
+	var ip4Addrs []ma.Multiaddr
+	for _, a := range h2.Addrs() {
+		if !isIP6(a) {
+			ip4Addrs = append(ip4Addrs, a)
+		}
+	}
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: ip4Addrs}))
+	require.Len(t, h1.Network().ConnsToPeer(h2.ID()), 1)
+
+	require.NoError(t, hps.UpgradeConnection(h2.ID(), isIP6))
+	var hasIP4, hasIP6 bool
+	for _, c := range h1.Network().ConnsToPeer(h2.ID()) {
+		if isIP6(c.RemoteMultiaddr()) {
+			hasIP6 = true
+		} else {
+			hasIP4 = true
+		}
+	}
+	require.True(t, hasIP4, "expected the original connection to be kept")
+	require.True(t, hasIP6, "expected an additional connection")
+
+	// the additional connection already exists
+	nc := len(h1.Network().ConnsToPeer(h2.ID()))
+	require.NoError(t, hps.UpgradeConnection(h2.ID(), isIP6))
+	require.Len(t, h1.Network().ConnsToPeer(h2.ID()), nc)
+}
+
+func isRelayed(a ma.Multiaddr) bool {
+	_, err := a.ValueForProtocol(ma.P_CIRCUIT)
+	return err == nil
+}
+
 func TestFailuresOnInitiator(t *testing.T) {
 	tcs := map[string]struct {
 		rhandler         func(s network.Stream)
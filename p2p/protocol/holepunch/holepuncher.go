@@ -50,15 +50,18 @@ type holePuncher struct {
 
 	tracer *tracer
 	filter AddrFilter
+	// upgraded is called when a direct connection was established
+	upgraded func(peer.ID)
 }
 
-func newHolePuncher(h host.Host, ids identify.IDService, tracer *tracer, filter AddrFilter) *holePuncher {
+func newHolePuncher(h host.Host, ids identify.IDService, tracer *tracer, filter AddrFilter, upgraded func(peer.ID)) *holePuncher {
 	hp := &holePuncher{
-		host:   h,
-		ids:    ids,
-		active: make(map[peer.ID]struct{}),
-		tracer: tracer,
-		filter: filter,
+		host:     h,
+		ids:      ids,
+		active:   make(map[peer.ID]struct{}),
+		tracer:   tracer,
+		filter:   filter,
+		upgraded: upgraded,
 	}
 	hp.ctx, hp.ctxCancel = context.WithCancel(context.Background())
 	h.Network().Notify((*netNotifiee)(hp))
@@ -96,20 +99,46 @@ func (hp *holePuncher) DirectConnect(p peer.ID) error {
 		hp.activeMx.Unlock()
 	}()
 
-	return hp.directConnect(p)
+	return hp.directConnect(p, nil)
 }
 
-func (hp *holePuncher) directConnect(rp peer.ID) error {
+// UpgradeConnection establishes an additional direct connection to a remote peer, using only
+// addresses accepted by match. This is used to establish a second path to a peer we're
+// already connected to, e.g. a QUIC connection to a peer we're connected to via TCP.
+// It first attempts a direct dial, and then coordinates a hole punch over the existing connection.
+func (hp *holePuncher) UpgradeConnection(p peer.ID, match func(ma.Multiaddr) bool) error {
+	if err := hp.beginDirectConnect(p); err != nil {
+		return err
+	}
+
+	defer func() {
+		hp.activeMx.Lock()
+		delete(hp.active, p)
+		hp.activeMx.Unlock()
+	}()
+
+	if hp.host.Network().Connectedness(p) != network.Connected {
+		return fmt.Errorf("not connected to peer %s", p)
+	}
+	return hp.directConnect(p, match)
+}
+
+// directConnect establishes a direct connection to rp.
+// If match is not nil, only connections to addresses accepted by match are considered.
+func (hp *holePuncher) directConnect(rp peer.ID, match func(ma.Multiaddr) bool) error {
 	// short-circuit check to see if we already have a direct connection
-	if getDirectConnection(hp.host, rp) != nil {
+	if getMatchingDirectConnection(hp.host, rp, match) != nil {
 		return nil
 	}
 
 	// short-circuit hole punching if a direct dial works.
 	// attempt a direct connection ONLY if we have a public address for the remote peer
 	for _, a := range hp.host.Peerstore().Addrs(rp) {
-		if manet.IsPublicAddr(a) && !isRelayAddress(a) {
+		if manet.IsPublicAddr(a) && !isRelayAddress(a) && (match == nil || match(a)) {
 			forceDirectConnCtx := network.WithForceDirectDial(hp.ctx, "hole-punching")
+			if match != nil {
+				forceDirectConnCtx = network.WithAdditionalConnection(forceDirectConnCtx, "hole-punching", match)
+			}
 			dialCtx, cancel := context.WithTimeout(forceDirectConnCtx, dialTimeout)
 
 			tstart := time.Now()
@@ -124,15 +153,16 @@ func (hp *holePuncher) directConnect(rp peer.ID) error {
 			}
 			hp.tracer.DirectDialSuccessful(rp, dt)
 			log.Debugw("direct connection to peer successful, no need for a hole punch", "peer", rp)
+			if match == nil {
+				hp.upgraded(rp)
+			}
 			return nil
 		}
 	}
 
-	log.Debugw("got inbound proxy conn", "peer", rp)
-
 	// hole punch
 	for i := 1; i <= maxRetries; i++ {
-		addrs, obsAddrs, rtt, err := hp.initiateHolePunch(rp)
+		addrs, obsAddrs, rtt, err := hp.initiateHolePunch(rp, match)
 		if err != nil {
 			log.Debugw("hole punching failed", "peer", rp, "error", err)
 			hp.tracer.ProtocolError(rp, err)
@@ -152,12 +182,15 @@ func (hp *holePuncher) directConnect(rp peer.ID) error {
 			}
 			hp.tracer.StartHolePunch(rp, addrs, rtt)
 			hp.tracer.HolePunchAttempt(pi.ID)
-			err := holePunchConnect(hp.ctx, hp.host, pi, true)
+			err := holePunchConnect(hp.ctx, hp.host, pi, true, match)
 			dt := time.Since(start)
 			hp.tracer.EndHolePunch(rp, dt, err)
 			if err == nil {
 				log.Debugw("hole punching with successful", "peer", rp, "time", dt)
-				hp.tracer.HolePunchFinished("initiator", i, addrs, obsAddrs, getDirectConnection(hp.host, rp))
+				hp.tracer.HolePunchFinished("initiator", i, addrs, obsAddrs, getMatchingDirectConnection(hp.host, rp, match))
+				if match == nil {
+					hp.upgraded(rp)
+				}
 				return nil
 			}
 		case <-hp.ctx.Done():
@@ -173,7 +206,9 @@ func (hp *holePuncher) directConnect(rp peer.ID) error {
 
 // initiateHolePunch opens a new hole punching coordination stream,
 // exchanges the addresses and measures the RTT.
-func (hp *holePuncher) initiateHolePunch(rp peer.ID) ([]ma.Multiaddr, []ma.Multiaddr, time.Duration, error) {
+// The stream is opened on the best existing connection, preferring direct connections.
+// If match is not nil, only addresses accepted by match are exchanged.
+func (hp *holePuncher) initiateHolePunch(rp peer.ID, match func(ma.Multiaddr) bool) ([]ma.Multiaddr, []ma.Multiaddr, time.Duration, error) {
 	hpCtx := network.WithUseTransient(hp.ctx, "hole-punch")
 	sCtx := network.WithNoDial(hpCtx, "hole-punch")
 
@@ -183,7 +218,7 @@ func (hp *holePuncher) initiateHolePunch(rp peer.ID) ([]ma.Multiaddr, []ma.Multi
 	}
 	defer str.Close()
 
-	addr, obsAddr, rtt, err := hp.initiateHolePunchImpl(str)
+	addr, obsAddr, rtt, err := hp.initiateHolePunchImpl(str, match)
 	if err != nil {
 		log.Debugf("%s", err)
 		str.Reset()
@@ -192,7 +227,7 @@ func (hp *holePuncher) initiateHolePunch(rp peer.ID) ([]ma.Multiaddr, []ma.Multi
 	return addr, obsAddr, rtt, err
 }
 
-func (hp *holePuncher) initiateHolePunchImpl(str network.Stream) ([]ma.Multiaddr, []ma.Multiaddr, time.Duration, error) {
+func (hp *holePuncher) initiateHolePunchImpl(str network.Stream, match func(ma.Multiaddr) bool) ([]ma.Multiaddr, []ma.Multiaddr, time.Duration, error) {
 	if err := str.Scope().SetService(ServiceName); err != nil {
 		return nil, nil, 0, fmt.Errorf("error attaching stream to holepunch service: %s", err)
 	}
@@ -208,10 +243,13 @@ func (hp *holePuncher) initiateHolePunchImpl(str network.Stream) ([]ma.Multiaddr
 	str.SetDeadline(time.Now().Add(StreamTimeout))
 
 	// send a CONNECT and start RTT measurement.
-	obsAddrs := removeRelayAddrs(hp.ids.OwnObservedAddrs())
+	obsAddrs := removeUnpunchableAddrs(hp.ids, removeRelayAddrs(hp.ids.OwnObservedAddrs()))
 	if hp.filter != nil {
 		obsAddrs = hp.filter.FilterLocal(str.Conn().RemotePeer(), obsAddrs)
 	}
+	if match != nil {
+		obsAddrs = ma.FilterAddrs(obsAddrs, match)
+	}
 	if len(obsAddrs) == 0 {
 		return nil, nil, 0, errors.New("aborting hole punch initiation as we have no public address")
 	}
@@ -239,6 +277,9 @@ func (hp *holePuncher) initiateHolePunchImpl(str network.Stream) ([]ma.Multiaddr
 	if hp.filter != nil {
 		addrs = hp.filter.FilterRemote(str.Conn().RemotePeer(), addrs)
 	}
+	if match != nil {
+		addrs = ma.FilterAddrs(addrs, match)
+	}
 
 	if len(addrs) == 0 {
 		return nil, nil, 0, errors.New("didn't receive any public addresses in CONNECT")
@@ -0,0 +1,116 @@
+package holepunch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+)
+
+// migrationTimeout is the time a StreamMigrator may take to migrate a stream.
+const migrationTimeout = 10 * time.Second
+
+// A StreamMigrator moves a stream from a relayed connection to a direct connection, once the
+// direct connection was established. Usually, it opens a new stream on the direct connection,
+// hands over the state of the protocol to the new stream, and closes the old stream.
+//
+// The old stream is reset if the StreamMigrator returns an error.
+type StreamMigrator func(ctx context.Context, old network.Stream, direct network.Conn) error
+
+// WithStreamMigration opts in the protocol to stream migration: when a direct connection replaces
+// a relayed connection, migrate is called for every stream of this protocol on the relayed connection.
+func WithStreamMigration(p protocol.ID, migrate StreamMigrator) Option {
+	return func(s *Service) error {
+		if migrate == nil {
+			return errors.New("holepunch: stream migrator can't be nil")
+		}
+		if s.migrators == nil {
+			s.migrators = make(map[protocol.ID]StreamMigrator)
+		}
+		s.migrators[p] = migrate
+		return nil
+	}
+}
+
+// onDirectConnectionUpgraded is called when a direct connection to p was established.
+// It runs directConnectionUpgraded in the background, since migrating the streams can take up to
+// migrationTimeout. Close waits for it to return.
+func (s *Service) onDirectConnectionUpgraded(p peer.ID) {
+	s.closeMx.RLock()
+	defer s.closeMx.RUnlock()
+	if s.ctx.Err() != nil {
+		return
+	}
+	s.refCount.Add(1)
+	go func() {
+		defer s.refCount.Done()
+		s.directConnectionUpgraded(p)
+	}()
+}
+
+// directConnectionUpgraded migrates the streams on the relayed connections to p that opted in to
+// migration to the direct connection, and emits an EvtDirectConnectionUpgraded for every relayed connection.
+func (s *Service) directConnectionUpgraded(p peer.ID) {
+	direct := getDirectConnection(s.host, p)
+	if direct == nil {
+		return
+	}
+	for _, c := range s.host.Network().ConnsToPeer(p) {
+		if !isRelayAddress(c.RemoteMultiaddr()) {
+			continue
+		}
+		migrated := s.migrateStreams(c, direct)
+		if s.emitter == nil {
+			continue
+		}
+		if err := s.emitter.Emit(event.EvtDirectConnectionUpgraded{
+			Peer:          p,
+			RelayedConnID: c.ID(),
+			DirectConnID:  direct.ID(),
+			Migrated:      migrated,
+		}); err != nil {
+			log.Debugw("failed to emit direct connection upgrade event", "error", err)
+		}
+	}
+}
+
+// migrateStreams migrates the streams on the relayed connection that opted in to migration,
+// and returns the IDs of the migrated streams.
+func (s *Service) migrateStreams(relayed, direct network.Conn) []string {
+	if len(s.migrators) == 0 {
+		return nil
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mx       sync.Mutex
+		migrated []string
+	)
+	for _, str := range relayed.GetStreams() {
+		migrate, ok := s.migrators[str.Protocol()]
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(str network.Stream) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(s.ctx, migrationTimeout)
+			defer cancel()
+			if err := migrate(ctx, str, direct); err != nil {
+				log.Debugw("failed to migrate stream", "peer", relayed.RemotePeer(), "protocol", str.Protocol(), "error", err)
+				str.Reset()
+				return
+			}
+			mx.Lock()
+			migrated = append(migrated, str.ID())
+			mx.Unlock()
+		}(str)
+	}
+	wg.Wait()
+	return migrated
+}
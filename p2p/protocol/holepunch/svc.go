@@ -56,6 +56,12 @@ type Service struct {
 	tracer *tracer
 	filter AddrFilter
 
+	// migrators are the stream migrators of the protocols that opted in to stream migration
+	migrators map[protocol.ID]StreamMigrator
+	emitter   event.Emitter
+
+	// closeMx prevents go-routines from being added to refCount once the service was closed
+	closeMx  sync.RWMutex
 	refCount sync.WaitGroup
 }
 
@@ -86,6 +92,13 @@ func NewService(h host.Host, ids identify.IDService, opts ...Option) (*Service,
 	}
 	s.tracer.Start()
 
+	emitter, err := h.EventBus().Emitter(new(event.EvtDirectConnectionUpgraded))
+	if err != nil {
+		log.Warnw("holepunch service not emitting direct connection upgrade events", "error", err)
+	} else {
+		s.emitter = emitter
+	}
+
 	s.refCount.Add(1)
 	go s.watchForPublicAddr()
 
@@ -143,7 +156,7 @@ func (s *Service) watchForPublicAddr() {
 				continue
 			}
 			s.holePuncherMx.Lock()
-			s.holePuncher = newHolePuncher(s.host, s.ids, s.tracer, s.filter)
+			s.holePuncher = newHolePuncher(s.host, s.ids, s.tracer, s.filter, s.onDirectConnectionUpgraded)
 			s.holePuncherMx.Unlock()
 			close(s.hasPublicAddrsChan)
 			return
@@ -161,17 +174,18 @@ func (s *Service) Close() error {
 	s.holePuncherMx.Unlock()
 	s.tracer.Close()
 	s.host.RemoveStreamHandler(Protocol)
+	s.closeMx.Lock()
 	s.ctxCancel()
+	s.closeMx.Unlock()
 	s.refCount.Wait()
+	if s.emitter != nil {
+		s.emitter.Close()
+	}
 	return err
 }
 
 func (s *Service) incomingHolePunch(str network.Stream) (rtt time.Duration, remoteAddrs []ma.Multiaddr, ownAddrs []ma.Multiaddr, err error) {
-	// sanity check: a hole punch request should only come from peers behind a relay
-	if !isRelayAddress(str.Conn().RemoteMultiaddr()) {
-		return 0, nil, nil, fmt.Errorf("received hole punch stream: %s", str.Conn().RemoteMultiaddr())
-	}
-	ownAddrs = removeRelayAddrs(s.ids.OwnObservedAddrs())
+	ownAddrs = removeUnpunchableAddrs(s.ids, removeRelayAddrs(s.ids.OwnObservedAddrs()))
 	if s.filter != nil {
 		ownAddrs = s.filter.FilterLocal(str.Conn().RemotePeer(), ownAddrs)
 	}
@@ -233,12 +247,16 @@ func (s *Service) incomingHolePunch(str network.Stream) (rtt time.Duration, remo
 }
 
 func (s *Service) handleNewStream(str network.Stream) {
+	// A hole punch is either coordinated over a relayed connection, or over an existing direct
+	// connection, to establish an additional direct connection (see UpgradeConnection).
+	relayed := isRelayAddress(str.Conn().RemoteMultiaddr())
+
 	// Check directionality of the underlying connection.
 	// Peer A receives an inbound connection from peer B.
 	// Peer A opens a new hole punch stream to peer B.
 	// Peer B receives this stream, calling this function.
 	// Peer B sees the underlying connection as an outbound connection.
-	if str.Conn().Stat().Direction == network.DirInbound {
+	if relayed && str.Conn().Stat().Direction == network.DirInbound {
 		str.Reset()
 		return
 	}
@@ -268,10 +286,19 @@ func (s *Service) handleNewStream(str network.Stream) {
 	log.Debugw("starting hole punch", "peer", rp)
 	start := time.Now()
 	s.tracer.HolePunchAttempt(pi.ID)
-	err = holePunchConnect(s.ctx, s.host, pi, false)
+	// When coordinating over a direct connection, the initiator already selected the addresses
+	// for the additional connection. Don't reuse the existing connection.
+	var match func(ma.Multiaddr) bool
+	if !relayed {
+		match = matchAddrs(addrs)
+	}
+	err = holePunchConnect(s.ctx, s.host, pi, false, match)
 	dt := time.Since(start)
 	s.tracer.EndHolePunch(rp, dt, err)
-	s.tracer.HolePunchFinished("receiver", 1, addrs, ownAddrs, getDirectConnection(s.host, rp))
+	s.tracer.HolePunchFinished("receiver", 1, addrs, ownAddrs, getMatchingDirectConnection(s.host, rp, match))
+	if err == nil && relayed {
+		s.onDirectConnectionUpgraded(rp)
+	}
 }
 
 // DirectConnect is only exposed for testing purposes.
@@ -283,3 +310,23 @@ func (s *Service) DirectConnect(p peer.ID) error {
 	s.holePuncherMx.Unlock()
 	return holePuncher.DirectConnect(p)
 }
+
+// UpgradeConnection establishes an additional direct connection to peer p, which we're already
+// connected to, using only addresses accepted by match. For example, this can be used to establish
+// a QUIC connection to a peer that we're connected to via TCP.
+// If a direct dial fails, the hole punch is coordinated over the existing connection.
+// It returns nil if a direct connection to an address accepted by match already exists.
+func (s *Service) UpgradeConnection(p peer.ID, match func(ma.Multiaddr) bool) error {
+	if match == nil {
+		return errors.New("holepunch: address matcher can't be nil")
+	}
+	select {
+	case <-s.hasPublicAddrsChan:
+	case <-s.ctx.Done():
+		return ErrClosed
+	}
+	s.holePuncherMx.Lock()
+	holePuncher := s.holePuncher
+	s.holePuncherMx.Unlock()
+	return holePuncher.UpgradeConnection(p, match)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
 
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
@@ -36,6 +37,45 @@ func isRelayAddress(a ma.Multiaddr) bool {
 	return err == nil
 }
 
+const (
+	// minNATMappingComparisons is the number of mapping comparisons needed before the NAT
+	// fingerprint is used to decide whether to hole punch.
+	minNATMappingComparisons = 8
+	// minNATMappingConsistency is the fraction of consistent mappings below which we assume that
+	// the NAT uses endpoint-dependent mapping. Hole punching through these NATs almost never works.
+	minNATMappingConsistency = 0.2
+)
+
+// removeUnpunchableAddrs removes the addresses of transport protocols for which the NAT
+// fingerprint collected by identify indicates an endpoint-dependent mapping.
+// addrs is returned unchanged if NAT fingerprinting is disabled.
+func removeUnpunchableAddrs(ids identify.IDService, addrs []ma.Multiaddr) []ma.Multiaddr {
+	fp, ok := ids.NATFingerprint()
+	if !ok {
+		return addrs
+	}
+	tcp, udp := isPunchable(fp.TCP), isPunchable(fp.UDP)
+	if tcp && udp {
+		return addrs
+	}
+	return ma.FilterAddrs(addrs, func(a ma.Multiaddr) bool {
+		if _, err := a.ValueForProtocol(ma.P_TCP); err == nil {
+			return tcp
+		}
+		if _, err := a.ValueForProtocol(ma.P_UDP); err == nil {
+			return udp
+		}
+		return true
+	})
+}
+
+func isPunchable(o identify.NATObservations) bool {
+	if o.ConsistentMappings+o.InconsistentMappings < minNATMappingComparisons {
+		return true
+	}
+	return o.MappingConsistency() >= minNATMappingConsistency
+}
+
 func addrsToBytes(as []ma.Multiaddr) [][]byte {
 	bzs := make([][]byte, 0, len(as))
 	for _, a := range as {
@@ -56,17 +96,41 @@ func addrsFromBytes(bzs [][]byte) []ma.Multiaddr {
 }
 
 func getDirectConnection(h host.Host, p peer.ID) network.Conn {
+	return getMatchingDirectConnection(h, p, nil)
+}
+
+// getMatchingDirectConnection returns a direct connection to p whose remote address is accepted
+// by match. If match is nil, any direct connection is returned.
+func getMatchingDirectConnection(h host.Host, p peer.ID, match func(ma.Multiaddr) bool) network.Conn {
 	for _, c := range h.Network().ConnsToPeer(p) {
-		if !isRelayAddress(c.RemoteMultiaddr()) {
+		if !isRelayAddress(c.RemoteMultiaddr()) && (match == nil || match(c.RemoteMultiaddr())) {
 			return c
 		}
 	}
 	return nil
 }
 
-func holePunchConnect(ctx context.Context, host host.Host, pi peer.AddrInfo, isClient bool) error {
+// matchAddrs returns a function that only accepts the given addresses.
+func matchAddrs(addrs []ma.Multiaddr) func(ma.Multiaddr) bool {
+	set := make(map[string]struct{}, len(addrs))
+	for _, a := range addrs {
+		set[string(a.Bytes())] = struct{}{}
+	}
+	return func(a ma.Multiaddr) bool {
+		_, ok := set[string(a.Bytes())]
+		return ok
+	}
+}
+
+// holePunchConnect dials pi as part of a hole punch.
+// If match is not nil, a new connection is established even if we're already connected to the peer,
+// and only addresses accepted by match are dialed.
+func holePunchConnect(ctx context.Context, host host.Host, pi peer.AddrInfo, isClient bool, match func(ma.Multiaddr) bool) error {
 	holePunchCtx := network.WithSimultaneousConnect(ctx, isClient, "hole-punching")
 	forceDirectConnCtx := network.WithForceDirectDial(holePunchCtx, "hole-punching")
+	if match != nil {
+		forceDirectConnCtx = network.WithAdditionalConnection(forceDirectConnCtx, "hole-punching", match)
+	}
 	dialCtx, cancel := context.WithTimeout(forceDirectConnCtx, dialTimeout)
 	defer cancel()
 
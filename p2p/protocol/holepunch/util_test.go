@@ -0,0 +1,45 @@
+package holepunch
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+type natFingerprintIDService struct {
+	identify.IDService
+	fp *identify.NATFingerprint
+}
+
+func (s *natFingerprintIDService) NATFingerprint() (identify.NATFingerprint, bool) {
+	if s.fp == nil {
+		return identify.NATFingerprint{}, false
+	}
+	return *s.fp, true
+}
+
+func TestRemoveUnpunchableAddrs(t *testing.T) {
+	addrs := []ma.Multiaddr{
+		ma.StringCast("/ip4/1.2.3.4/tcp/1234"),
+		ma.StringCast("/ip4/1.2.3.4/udp/1234/quic-v1"),
+	}
+
+	// NAT fingerprinting disabled
+	require.Equal(t, addrs, removeUnpunchableAddrs(&natFingerprintIDService{}, addrs))
+
+	// not enough observations yet
+	fp := identify.NATFingerprint{UDP: identify.NATObservations{InconsistentMappings: minNATMappingComparisons - 1}}
+	require.Equal(t, addrs, removeUnpunchableAddrs(&natFingerprintIDService{fp: &fp}, addrs))
+
+	// endpoint-dependent mapping for UDP
+	fp.UDP = identify.NATObservations{ConsistentMappings: 1, InconsistentMappings: 9}
+	fp.TCP = identify.NATObservations{ConsistentMappings: 9, InconsistentMappings: 1}
+	require.Equal(t, addrs[:1], removeUnpunchableAddrs(&natFingerprintIDService{fp: &fp}, addrs))
+
+	// endpoint-dependent mapping for both
+	fp.TCP = fp.UDP
+	require.Empty(t, removeUnpunchableAddrs(&natFingerprintIDService{fp: &fp}, addrs))
+}
@@ -0,0 +1,110 @@
+package identify
+
+import (
+	"encoding/gob"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/transport"
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify/pb"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"google.golang.org/protobuf/proto"
+)
+
+// addrCapabilitiesKey is the peerstore metadata key under which the capabilities of the
+// peer's addresses are stored, as a map[string]transport.Capabilities keyed by the address.
+const addrCapabilitiesKey = "AddrCapabilities"
+
+func init() {
+	// needed to store the capabilities in a datastore-backed peerstore
+	gob.Register(make(map[string]transport.Capabilities))
+}
+
+// AddrCapabilities returns the transport capabilities of the addresses of p, as advertised by p
+// in its last Identify message. Addresses that are not included don't support any optional capabilities.
+func AddrCapabilities(ps peerstore.PeerMetadata, p peer.ID) map[string]transport.Capabilities {
+	v, err := ps.Get(p, addrCapabilitiesKey)
+	if err != nil {
+		return nil
+	}
+	caps, _ := v.(map[string]transport.Capabilities)
+	return caps
+}
+
+// AddrsWithCapabilities returns the known addresses of p that support all of the given capabilities.
+func AddrsWithCapabilities(ps peerstore.Peerstore, p peer.ID, c transport.Capabilities) []ma.Multiaddr {
+	caps := AddrCapabilities(ps, p)
+	var addrs []ma.Multiaddr
+	for _, a := range ps.Addrs(p) {
+		if caps[a.String()].Has(c) {
+			addrs = append(addrs, a)
+		}
+	}
+	return addrs
+}
+
+// getAddrCapabilities returns the capabilities of the transports of our listen addresses.
+// addrs must be the addresses sent in the listenAddrs field, in the same order, since the
+// capabilities refer to the addresses by their index.
+func (ids *idService) getAddrCapabilities(addrs []ma.Multiaddr) []*pb.AddrCapabilities {
+	type transportForListeninger interface {
+		TransportForListening(a ma.Multiaddr) transport.Transport
+	}
+	n, ok := ids.Host.Network().(transportForListeninger)
+	if !ok {
+		return nil
+	}
+
+	var res []*pb.AddrCapabilities
+	for i, addr := range addrs {
+		r, ok := n.TransportForListening(addr).(transport.CapabilityReporter)
+		if !ok {
+			continue
+		}
+		caps := r.Capabilities(addr)
+		if caps == 0 {
+			continue
+		}
+		ac := &pb.AddrCapabilities{ListenAddrIndex: proto.Uint32(uint32(i))}
+		if caps.Has(transport.CapabilityDatagram) {
+			ac.SupportsDatagram = proto.Bool(true)
+		}
+		if caps.Has(transport.CapabilityEarlyData) {
+			ac.SupportsEarlyData = proto.Bool(true)
+		}
+		res = append(res, ac)
+	}
+	return res
+}
+
+// consumeAddrCapabilities stores the capabilities advertised by p in the peerstore,
+// replacing the ones from previous Identify messages.
+func (ids *idService) consumeAddrCapabilities(p peer.ID, mes *pb.Identify) {
+	caps := make(map[string]transport.Capabilities, len(mes.AddrCapabilities))
+	for _, ac := range mes.AddrCapabilities {
+		idx := ac.GetListenAddrIndex()
+		if ac.ListenAddrIndex == nil || int(idx) >= len(mes.ListenAddrs) {
+			log.Debugf("invalid listen address index in address capabilities from %s: %d", p, idx)
+			continue
+		}
+		addr, err := ma.NewMultiaddrBytes(mes.ListenAddrs[idx])
+		if err != nil {
+			log.Debugf("failed to parse multiaddr of address capabilities from %s: %s", p, err)
+			continue
+		}
+		var c transport.Capabilities
+		if ac.GetSupportsDatagram() {
+			c |= transport.CapabilityDatagram
+		}
+		if ac.GetSupportsEarlyData() {
+			c |= transport.CapabilityEarlyData
+		}
+		if c != 0 {
+			caps[addr.String()] = c
+		}
+	}
+	if err := ids.Host.Peerstore().Put(p, addrCapabilitiesKey, caps); err != nil {
+		log.Debugf("failed to store address capabilities of %s: %s", p, err)
+	}
+}
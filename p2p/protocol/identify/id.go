@@ -40,6 +40,9 @@ const (
 	// IDPush is the protocol.ID of the Identify push protocol.
 	// It sends full identify messages containing the current state of the peer.
 	IDPush = "/ipfs/id/push/1.0.0"
+	// IDDelta is the protocol.ID of the Identify delta protocol.
+	// It only sends the changes to the protocols supported by the peer.
+	IDDelta = "/p2p/id/delta/1.0.0"
 )
 
 const ServiceName = "libp2p.identify"
@@ -63,6 +66,14 @@ type identifySnapshot struct {
 	record    *record.Envelope
 }
 
+// onlyProtocolsDiffer says if two snapshots only differ in their protocols.
+// It does NOT compare the sequence number.
+func (s identifySnapshot) onlyProtocolsDiffer(other *identifySnapshot) bool {
+	withOtherProtocols := s
+	withOtherProtocols.protocols = other.protocols
+	return !slices.Equal(s.protocols, other.protocols) && withOtherProtocols.Equal(other)
+}
+
 // Equal says if two snapshots are identical.
 // It does NOT compare the sequence number.
 func (s identifySnapshot) Equal(other *identifySnapshot) bool {
@@ -103,6 +114,12 @@ type IDService interface {
 	// ObservedAddrsFor returns the addresses peers have reported we've dialed from,
 	// for a specific local address.
 	ObservedAddrsFor(local ma.Multiaddr) []ma.Multiaddr
+	// ObservedAddrs returns the state of all addresses peers have reported we've dialed from,
+	// including the ones that aren't advertised.
+	ObservedAddrs() []ObservedAddr
+	// NATFingerprint returns the anonymized NAT behavior observations collected so far.
+	// It returns false if NAT fingerprinting is disabled.
+	NATFingerprint() (NATFingerprint, bool)
 	Start()
 	io.Closer
 }
@@ -125,6 +142,8 @@ type entry struct {
 	PushSupport identifyPushSupport
 	// Sequence is the sequence number of the last snapshot we sent to this peer.
 	Sequence uint64
+	// LastIdentified is the time we last received an Identify message (request or push) from the peer.
+	LastIdentified time.Time
 }
 
 // idService is a structure that implements ProtocolIdentify.
@@ -149,6 +168,10 @@ type idService struct {
 	refCount sync.WaitGroup
 
 	disableSignedPeerRecord bool
+	// storePeerRecords is set if received signed peer records are stored in the peerstore
+	storePeerRecords bool
+
+	refreshInterval time.Duration
 
 	connsMu sync.RWMutex
 	// The conns map contains all connections we're currently handling.
@@ -170,6 +193,9 @@ type idService struct {
 	currentSnapshot struct {
 		sync.Mutex
 		snapshot identifySnapshot
+		// previous is the snapshot that was replaced by snapshot.
+		// Peers that received it are sent a delta, if possible.
+		previous identifySnapshot
 	}
 }
 
@@ -195,11 +221,17 @@ func NewIDService(h host.Host, opts ...Option) (*idService, error) {
 		ctxCancel:               cancel,
 		conns:                   make(map[network.Conn]entry),
 		disableSignedPeerRecord: cfg.disableSignedPeerRecord,
+		storePeerRecords:        cfg.storePeerRecords,
 		setupCompleted:          make(chan struct{}),
 		metricsTracer:           cfg.metricsTracer,
+		refreshInterval:         cfg.refreshInterval,
 	}
 
-	observedAddrs, err := NewObservedAddrManager(h)
+	var fp *natFingerprinter
+	if cfg.natFingerprinting {
+		fp = newNATFingerprinter(cfg.metricsTracer)
+	}
+	observedAddrs, err := newObservedAddrManager(h, fp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create observed address manager: %s", err)
 	}
@@ -224,11 +256,14 @@ func (ids *idService) Start() {
 	ids.Host.Network().Notify((*netNotifiee)(ids))
 	ids.Host.SetStreamHandler(ID, ids.handleIdentifyRequest)
 	ids.Host.SetStreamHandler(IDPush, ids.handlePush)
+	ids.Host.SetStreamHandler(IDDelta, ids.handleDelta)
 	ids.updateSnapshot()
 	close(ids.setupCompleted)
 
 	ids.refCount.Add(1)
 	go ids.loop(ids.ctx)
+	ids.startRecordRenewal()
+	ids.startRefresh()
 }
 
 func (ids *idService) loop(ctx context.Context) {
@@ -311,11 +346,16 @@ func (ids *idService) sendPushes(ctx context.Context) {
 		// check if we already sent the current snapshot to this peer
 		ids.currentSnapshot.Lock()
 		snapshot := ids.currentSnapshot.snapshot
+		previous := ids.currentSnapshot.previous
 		ids.currentSnapshot.Unlock()
 		if e.Sequence >= snapshot.seq {
 			log.Debugw("already sent this snapshot to peer", "peer", c.RemotePeer(), "seq", snapshot.seq)
 			continue
 		}
+		// If the peer has the previous snapshot, and only our protocols changed since then,
+		// it's sufficient to send the changes.
+		sendDelta := previous.seq > 0 && e.Sequence == previous.seq &&
+			snapshot.onlyProtocolsDiffer(&previous) && ids.supportsDelta(c.RemotePeer())
 		// we haven't, send it now
 		sem <- struct{}{}
 		wg.Add(1)
@@ -324,6 +364,16 @@ func (ids *idService) sendPushes(ctx context.Context) {
 			defer func() { <-sem }()
 			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 			defer cancel()
+			if sendDelta {
+				str, err := ids.Host.NewStream(ctx, c.RemotePeer(), IDDelta)
+				if err == nil {
+					if err := ids.sendDelta(str, &previous, &snapshot); err == nil {
+						return
+					}
+					log.Debugw("failed to send identify delta", "peer", c.RemotePeer(), "error", err)
+				}
+				// fall back to sending the full snapshot
+			}
 			str, err := ids.Host.NewStream(ctx, c.RemotePeer(), IDPush)
 			if err != nil { // connection might have been closed recently
 				return
@@ -354,6 +404,14 @@ func (ids *idService) ObservedAddrsFor(local ma.Multiaddr) []ma.Multiaddr {
 	return ids.observedAddrs.AddrsFor(local)
 }
 
+func (ids *idService) ObservedAddrs() []ObservedAddr {
+	return ids.observedAddrs.ObservedAddrs()
+}
+
+func (ids *idService) NATFingerprint() (NATFingerprint, bool) {
+	return ids.observedAddrs.NATFingerprint()
+}
+
 // IdentifyConn runs the Identify protocol on a connection.
 // It returns when we've received the peer's Identify message (or the request fails).
 // If successful, the peer store will contain the peer's addresses and supported protocols.
@@ -395,25 +453,30 @@ func (ids *idService) IdentifyWait(c network.Conn) <-chan struct{} {
 	// stream then forget the connection.
 	go func() {
 		defer close(e.IdentifyWaitChan)
-		if err := ids.identifyConn(c); err != nil {
+		signedPeerRecord, err := ids.identifyConn(c)
+		if err != nil {
 			log.Warnf("failed to identify %s: %s", c.RemotePeer(), err)
 			ids.emitters.evtPeerIdentificationFailed.Emit(event.EvtPeerIdentificationFailed{Peer: c.RemotePeer(), Reason: err})
 			return
 		}
 
-		ids.emitters.evtPeerIdentificationCompleted.Emit(event.EvtPeerIdentificationCompleted{Peer: c.RemotePeer()})
+		ids.emitters.evtPeerIdentificationCompleted.Emit(event.EvtPeerIdentificationCompleted{
+			Peer:             c.RemotePeer(),
+			SignedPeerRecord: signedPeerRecord,
+		})
 	}()
 
 	return e.IdentifyWaitChan
 }
 
-func (ids *idService) identifyConn(c network.Conn) error {
+// identifyConn runs identify on the connection. It returns the signed peer record of the peer, if it sent a valid one.
+func (ids *idService) identifyConn(c network.Conn) (*record.Envelope, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
 	defer cancel()
 	s, err := c.NewStream(network.WithUseTransient(ctx, "identify"))
 	if err != nil {
 		log.Debugw("error opening identify stream", "peer", c.RemotePeer(), "error", err)
-		return err
+		return nil, err
 	}
 	s.SetDeadline(time.Now().Add(Timeout))
 
@@ -426,7 +489,7 @@ func (ids *idService) identifyConn(c network.Conn) error {
 	if err := msmux.SelectProtoOrFail(ID, s); err != nil {
 		log.Infow("failed negotiate identify protocol with peer", "peer", c.RemotePeer(), "error", err)
 		s.Reset()
-		return err
+		return nil, err
 	}
 
 	return ids.handleIdentifyResponse(s, false)
@@ -467,32 +530,121 @@ func (ids *idService) sendIdentifyResp(s network.Stream, isPush bool) error {
 		ids.metricsTracer.IdentifySent(isPush, len(mes.Protocols), len(mes.ListenAddrs))
 	}
 
+	ids.setSequence(s.Conn(), snapshot.seq)
+	return nil
+}
+
+// setSequence records that we sent the snapshot with sequence number seq on c.
+func (ids *idService) setSequence(c network.Conn, seq uint64) {
 	ids.connsMu.Lock()
 	defer ids.connsMu.Unlock()
-	e, ok := ids.conns[s.Conn()]
+	e, ok := ids.conns[c]
 	// The connection might already have been closed.
 	// We *should* receive the Connected notification from the swarm before we're able to accept the peer's
 	// Identify stream, but if that for some reason doesn't work, we also wouldn't have a map entry here.
 	// The only consequence would be that we send a spurious Push to that peer later.
 	if !ok {
-		return nil
+		return
 	}
-	e.Sequence = snapshot.seq
-	ids.conns[s.Conn()] = e
+	e.Sequence = seq
+	ids.conns[c] = e
+}
+
+func (ids *idService) supportsDelta(p peer.ID) bool {
+	sup, err := ids.Host.Peerstore().SupportsProtocols(p, IDDelta)
+	return err == nil && len(sup) > 0
+}
+
+// sendDelta sends the changes of our protocols between the previous and the current snapshot.
+func (ids *idService) sendDelta(s network.Stream, previous, snapshot *identifySnapshot) error {
+	if err := s.Scope().SetService(ServiceName); err != nil {
+		s.Reset()
+		return fmt.Errorf("failed to attaching stream to identify service: %w", err)
+	}
+	defer s.Close()
+
+	added, removed := diff(previous.protocols, snapshot.protocols)
+	log.Debugw("sending delta", "seq", snapshot.seq, "added", added, "removed", removed)
+	mes := &pb.Identify{
+		Delta: &pb.Delta{
+			AddedProtocols: protocol.ConvertToStrings(added),
+			RmProtocols:    protocol.ConvertToStrings(removed),
+		},
+	}
+	if err := pbio.NewDelimitedWriter(s).WriteMsg(mes); err != nil {
+		s.Reset()
+		return err
+	}
+	ids.setSequence(s.Conn(), snapshot.seq)
 	return nil
 }
 
-func (ids *idService) handleIdentifyResponse(s network.Stream, isPush bool) error {
+func (ids *idService) handleDelta(s network.Stream) {
+	s.SetDeadline(time.Now().Add(Timeout))
 	if err := s.Scope().SetService(ServiceName); err != nil {
 		log.Warnf("error attaching stream to identify service: %s", err)
 		s.Reset()
-		return err
+		return
+	}
+	if err := s.Scope().ReserveMemory(signedIDSize, network.ReservationPriorityAlways); err != nil {
+		log.Warnf("error reserving memory for identify stream: %s", err)
+		s.Reset()
+		return
+	}
+	defer s.Scope().ReleaseMemory(signedIDSize)
+
+	mes := &pb.Identify{}
+	if err := pbio.NewDelimitedReader(s, signedIDSize).ReadMsg(mes); err != nil {
+		log.Warn("error reading identify delta message: ", err)
+		s.Reset()
+		return
+	}
+	defer s.Close()
+
+	c := s.Conn()
+	p := c.RemotePeer()
+	delta := mes.GetDelta()
+	if delta == nil {
+		log.Debugw("received identify delta without delta", "peer", p)
+		return
+	}
+	added := protocol.ConvertFromStrings(delta.GetAddedProtocols())
+	removed := protocol.ConvertFromStrings(delta.GetRmProtocols())
+	if len(removed) > 0 {
+		if err := ids.Host.Peerstore().RemoveProtocols(p, removed...); err != nil {
+			log.Debugw("failed to remove protocols", "peer", p, "error", err)
+		}
+	}
+	if len(added) > 0 {
+		if err := ids.Host.Peerstore().AddProtocols(p, added...); err != nil {
+			log.Debugw("failed to add protocols", "peer", p, "error", err)
+		}
+	}
+	ids.emitters.evtPeerProtocolsUpdated.Emit(event.EvtPeerProtocolsUpdated{
+		Peer:    p,
+		Added:   added,
+		Removed: removed,
+	})
+
+	ids.connsMu.Lock()
+	defer ids.connsMu.Unlock()
+	if e, ok := ids.conns[c]; ok {
+		e.LastIdentified = time.Now()
+		ids.conns[c] = e
+	}
+}
+
+func (ids *idService) handleIdentifyResponse(s network.Stream, isPush bool) (*record.Envelope, error) {
+	if err := s.Scope().SetService(ServiceName); err != nil {
+		log.Warnf("error attaching stream to identify service: %s", err)
+		s.Reset()
+		return nil, err
 	}
 
 	if err := s.Scope().ReserveMemory(signedIDSize, network.ReservationPriorityAlways); err != nil {
 		log.Warnf("error reserving memory for identify stream: %s", err)
 		s.Reset()
-		return err
+		return nil, err
 	}
 	defer s.Scope().ReleaseMemory(signedIDSize)
 
@@ -504,14 +656,14 @@ func (ids *idService) handleIdentifyResponse(s network.Stream, isPush bool) erro
 	if err := readAllIDMessages(r, mes); err != nil {
 		log.Warn("error reading identify message: ", err)
 		s.Reset()
-		return err
+		return nil, err
 	}
 
 	defer s.Close()
 
 	log.Debugf("%s received message from %s %s", s.Protocol(), c.RemotePeer(), c.RemoteMultiaddr())
 
-	ids.consumeMessage(mes, c, isPush)
+	signedPeerRecord := ids.consumeMessage(mes, c, isPush)
 
 	if ids.metricsTracer != nil {
 		ids.metricsTracer.IdentifyReceived(isPush, len(mes.Protocols), len(mes.ListenAddrs))
@@ -521,8 +673,9 @@ func (ids *idService) handleIdentifyResponse(s network.Stream, isPush bool) erro
 	defer ids.connsMu.Unlock()
 	e, ok := ids.conns[c]
 	if !ok { // might already have disconnected
-		return nil
+		return signedPeerRecord, nil
 	}
+	e.LastIdentified = time.Now()
 	sup, err := ids.Host.Peerstore().SupportsProtocols(c.RemotePeer(), IDPush)
 	if supportsIdentifyPush := err == nil && len(sup) > 0; supportsIdentifyPush {
 		e.PushSupport = identifyPushSupported
@@ -535,7 +688,7 @@ func (ids *idService) handleIdentifyResponse(s network.Stream, isPush bool) erro
 	}
 
 	ids.conns[c] = e
-	return nil
+	return signedPeerRecord, nil
 }
 
 func readAllIDMessages(r pbio.Reader, finalMsg proto.Message) error {
@@ -578,6 +731,7 @@ func (ids *idService) updateSnapshot() (updated bool) {
 	}
 
 	snapshot.seq = ids.currentSnapshot.snapshot.seq + 1
+	ids.currentSnapshot.previous = ids.currentSnapshot.snapshot
 	ids.currentSnapshot.snapshot = snapshot
 
 	log.Debugw("updating snapshot", "seq", snapshot.seq, "addrs", snapshot.addrs)
@@ -618,12 +772,15 @@ func (ids *idService) createBaseIdentifyResponse(conn network.Conn, snapshot *id
 	// Note: LocalMultiaddr is sometimes 0.0.0.0
 	viaLoopback := manet.IsIPLoopback(localAddr) || manet.IsIPLoopback(remoteAddr)
 	mes.ListenAddrs = make([][]byte, 0, len(snapshot.addrs))
+	addrs := make([]ma.Multiaddr, 0, len(snapshot.addrs))
 	for _, addr := range snapshot.addrs {
 		if !viaLoopback && manet.IsIPLoopback(addr) {
 			continue
 		}
 		mes.ListenAddrs = append(mes.ListenAddrs, addr.Bytes())
+		addrs = append(addrs, addr)
 	}
+	mes.AddrCapabilities = ids.getAddrCapabilities(addrs)
 	// set our public key
 	ownKey := ids.Host.Peerstore().PubKey(ids.Host.ID())
 
@@ -696,7 +853,9 @@ func diff(a, b []protocol.ID) (added, removed []protocol.ID) {
 	return
 }
 
-func (ids *idService) consumeMessage(mes *pb.Identify, c network.Conn, isPush bool) {
+// consumeMessage processes an identify message. It returns the signed peer record contained in
+// the message, if it is valid.
+func (ids *idService) consumeMessage(mes *pb.Identify, c network.Conn, isPush bool) *record.Envelope {
 	p := c.RemotePeer()
 
 	supported, _ := ids.Host.Peerstore().GetProtocols(p)
@@ -763,13 +922,25 @@ func (ids *idService) consumeMessage(mes *pb.Identify, c network.Conn, isPush bo
 		signedAddrs, err := ids.consumeSignedPeerRecord(c.RemotePeer(), signedPeerRecord)
 		if err != nil {
 			log.Debugf("failed to consume signed peer record: %s", err)
+			signedPeerRecord = nil
 		} else {
 			addrs = signedAddrs
 		}
 	} else {
 		addrs = lmaddrs
 	}
-	ids.Host.Peerstore().AddAddrs(p, filterAddrs(addrs, c.RemoteMultiaddr()), ttl)
+	filtered := filterAddrs(addrs, c.RemoteMultiaddr())
+	ids.Host.Peerstore().AddAddrs(p, filtered, ttl)
+
+	// Store the signed peer record, so that it can be renewed before it expires.
+	// The record contains all of the peer's addresses, so only store it if we didn't filter any of them.
+	if ids.storePeerRecords && signedPeerRecord != nil && len(filtered) == len(addrs) {
+		if cab, ok := peerstore.GetCertifiedAddrBook(ids.Host.Peerstore()); ok {
+			if _, err := cab.ConsumePeerRecord(signedPeerRecord, ttl); err != nil {
+				log.Debugf("failed to store signed peer record: %s", err)
+			}
+		}
+	}
 
 	// Finally, expire all temporary addrs.
 	ids.Host.Peerstore().UpdateAddrs(p, peerstore.TempAddrTTL, 0)
@@ -783,9 +954,11 @@ func (ids *idService) consumeMessage(mes *pb.Identify, c network.Conn, isPush bo
 
 	ids.Host.Peerstore().Put(p, "ProtocolVersion", pv)
 	ids.Host.Peerstore().Put(p, "AgentVersion", av)
+	ids.consumeAddrCapabilities(p, mes)
 
 	// get the key from the other side. we may not have it (no-auth transport)
 	ids.consumeReceivedPubKey(c, mes.PublicKey)
+	return signedPeerRecord
 }
 
 func (ids *idService) consumeSignedPeerRecord(p peer.ID, signedPeerRecord *record.Envelope) ([]ma.Multiaddr, error) {
@@ -810,9 +983,6 @@ func (ids *idService) consumeSignedPeerRecord(p peer.ID, signedPeerRecord *recor
 	if rec.PeerID != p {
 		return nil, fmt.Errorf("received signed peer record for unexpected peer ID. expected %s, got %s", p, rec.PeerID)
 	}
-	// Don't put the signed peer record into the peer store.
-	// They're not used anywhere.
-	// All we care about are the addresses.
 	return rec.Addrs, nil
 }
 
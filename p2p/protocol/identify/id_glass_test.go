@@ -3,17 +3,25 @@ package identify
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/core/protocol"
 	recordPb "github.com/libp2p/go-libp2p/core/record/pb"
+	"github.com/libp2p/go-libp2p/core/transport"
 	blhost "github.com/libp2p/go-libp2p/p2p/host/blank"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
 	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
+	"github.com/libp2p/go-libp2p/p2p/protocol/identify/pb"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
 	"google.golang.org/protobuf/proto"
 
+	ma "github.com/multiformats/go-multiaddr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -173,3 +181,269 @@ func TestInvalidSignedPeerRecord(t *testing.T) {
 	require.True(t, ok)
 	require.Nil(t, cab.GetPeerRecord(h2.ID()))
 }
+
+func TestRecordRenewal(t *testing.T) {
+	cm, err := connmgr.NewConnManager(10, 20)
+	require.NoError(t, err)
+	defer cm.Close()
+	h1 := blhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), blhost.WithConnectionManager(cm))
+	defer h1.Close()
+	h2 := blhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h2.Close()
+
+	ids1, err := NewIDService(h1, StorePeerRecords())
+	require.NoError(t, err)
+	defer ids1.Close()
+	ids1.Start()
+	ids2, err := NewIDService(h2)
+	require.NoError(t, err)
+	defer ids2.Close()
+	ids2.Start()
+
+	sub, err := h1.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted))
+	require.NoError(t, err)
+	defer sub.Close()
+	nextIdentification := func() event.EvtPeerIdentificationCompleted {
+		t.Helper()
+		select {
+		case e := <-sub.Out():
+			return e.(event.EvtPeerIdentificationCompleted)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for identification")
+		}
+		panic("unreachable")
+	}
+
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	require.Equal(t, h2.ID(), nextIdentification().Peer)
+	cab, ok := peerstore.GetCertifiedAddrBook(h1.Peerstore())
+	require.True(t, ok)
+	require.NotNil(t, cab.GetPeerRecord(h2.ID()))
+
+	// connected peers are identified again, without emitting an event if nothing changed
+	ids1.renewRecord(h2.ID())
+	require.NotNil(t, cab.GetPeerRecord(h2.ID()))
+	require.Empty(t, sub.Out())
+
+	require.NoError(t, h1.Network().ClosePeer(h2.ID()))
+	require.Eventually(t, func() bool { return h1.Network().Connectedness(h2.ID()) != network.Connected }, time.Second, 10*time.Millisecond)
+	require.NotNil(t, cab.GetPeerRecord(h2.ID()))
+
+	// we don't reconnect to peers we don't care about
+	ids1.renewRecord(h2.ID())
+	require.NotEqual(t, network.Connected, h1.Network().Connectedness(h2.ID()))
+
+	// but we do reconnect to protected peers
+	cm.Protect(h2.ID(), "test")
+	ids1.renewRecord(h2.ID())
+	require.Equal(t, network.Connected, h1.Network().Connectedness(h2.ID()))
+	require.Equal(t, h2.ID(), nextIdentification().Peer)
+}
+
+func TestIdentifyRefresh(t *testing.T) {
+	h1 := blhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h1.Close()
+	h2 := blhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h2.Close()
+
+	ids1, err := NewIDService(h1, WithRefreshInterval(100*time.Millisecond))
+	require.NoError(t, err)
+	defer ids1.Close()
+	ids1.Start()
+	// make sure that h1 only learns about protocol changes by refreshing
+	h1.RemoveStreamHandler(IDPush)
+	ids2, err := NewIDService(h2)
+	require.NoError(t, err)
+	defer ids2.Close()
+	ids2.Start()
+
+	sub, err := h1.EventBus().Subscribe(new(event.EvtPeerProtocolsUpdated))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	ids1.IdentifyConn(h1.Network().ConnsToPeer(h2.ID())[0])
+
+	h2.SetStreamHandler("/foo", func(network.Stream) {})
+	select {
+	case e := <-sub.Out():
+		evt := e.(event.EvtPeerProtocolsUpdated)
+		require.Equal(t, h2.ID(), evt.Peer)
+		require.Equal(t, []protocol.ID{"/foo"}, evt.Added)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the protocols to be refreshed")
+	}
+	protos, err := h1.Peerstore().SupportsProtocols(h2.ID(), "/foo")
+	require.NoError(t, err)
+	require.Equal(t, []protocol.ID{"/foo"}, protos)
+}
+
+func TestReidentifyEvents(t *testing.T) {
+	h1 := blhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h1.Close()
+	h2 := blhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h2.Close()
+
+	ids1, err := NewIDService(h1)
+	require.NoError(t, err)
+	defer ids1.Close()
+	ids1.Start()
+	h1.RemoveStreamHandler(IDPush)
+	ids2, err := NewIDService(h2)
+	require.NoError(t, err)
+	defer ids2.Close()
+	ids2.Start()
+
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	c := h1.Network().ConnsToPeer(h2.ID())[0]
+	<-ids1.IdentifyWait(c)
+	// signed peer records are only stored with StorePeerRecords
+	cab, ok := peerstore.GetCertifiedAddrBook(h1.Peerstore())
+	require.True(t, ok)
+	require.Nil(t, cab.GetPeerRecord(h2.ID()))
+
+	sub, err := h1.EventBus().Subscribe(new(event.EvtPeerIdentificationCompleted))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	// nothing changed
+	require.NoError(t, ids1.reidentify(c))
+	select {
+	case e := <-sub.Out():
+		t.Fatalf("didn't expect an event: %v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	h2.SetStreamHandler("/foo", func(network.Stream) {})
+	require.NoError(t, ids1.reidentify(c))
+	select {
+	case e := <-sub.Out():
+		require.Equal(t, h2.ID(), e.(event.EvtPeerIdentificationCompleted).Peer)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the identification event")
+	}
+}
+
+func TestIdentifyDelta(t *testing.T) {
+	h1 := blhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h1.Close()
+	h2 := blhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h2.Close()
+
+	ids1, err := NewIDService(h1)
+	require.NoError(t, err)
+	defer ids1.Close()
+	ids1.Start()
+	ids2, err := NewIDService(h2)
+	require.NoError(t, err)
+	defer ids2.Close()
+	ids2.Start()
+
+	var deltas, pushes atomic.Int32
+	h2.SetStreamHandler(IDDelta, func(s network.Stream) {
+		deltas.Add(1)
+		ids2.handleDelta(s)
+	})
+	h2.SetStreamHandler(IDPush, func(s network.Stream) {
+		pushes.Add(1)
+		ids2.handlePush(s)
+	})
+
+	sub, err := h2.EventBus().Subscribe(new(event.EvtPeerProtocolsUpdated))
+	require.NoError(t, err)
+	defer sub.Close()
+
+	require.NoError(t, h2.Connect(context.Background(), peer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()}))
+	ids1.IdentifyConn(h1.Network().ConnsToPeer(h2.ID())[0])
+	ids2.IdentifyConn(h2.Network().ConnsToPeer(h1.ID())[0])
+	numPushes := pushes.Load()
+
+	nextEvent := func() event.EvtPeerProtocolsUpdated {
+		t.Helper()
+		select {
+		case e := <-sub.Out():
+			evt := e.(event.EvtPeerProtocolsUpdated)
+			require.Equal(t, h1.ID(), evt.Peer)
+			return evt
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for the protocols to be updated")
+			return event.EvtPeerProtocolsUpdated{}
+		}
+	}
+
+	h1.SetStreamHandler("/foo", func(network.Stream) {})
+	evt := nextEvent()
+	require.Equal(t, []protocol.ID{"/foo"}, evt.Added)
+	require.Empty(t, evt.Removed)
+	protos, err := h2.Peerstore().SupportsProtocols(h1.ID(), "/foo")
+	require.NoError(t, err)
+	require.Equal(t, []protocol.ID{"/foo"}, protos)
+
+	h1.RemoveStreamHandler("/foo")
+	evt = nextEvent()
+	require.Empty(t, evt.Added)
+	require.Equal(t, []protocol.ID{"/foo"}, evt.Removed)
+	protos, err = h2.Peerstore().SupportsProtocols(h1.ID(), "/foo")
+	require.NoError(t, err)
+	require.Empty(t, protos)
+
+	require.Equal(t, int32(2), deltas.Load())
+	require.Equal(t, numPushes, pushes.Load())
+}
+
+type capabilityTransport struct {
+	transport.Transport
+	caps transport.Capabilities
+}
+
+func (t *capabilityTransport) Capabilities(ma.Multiaddr) transport.Capabilities { return t.caps }
+
+func TestAddrCapabilities(t *testing.T) {
+	h1 := blhost.NewBlankHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC))
+	defer h1.Close()
+	sw := swarmt.GenSwarm(t, swarmt.OptDisableQUIC, swarmt.OptDisableTCP)
+	tcpTransport, err := tcp.NewTCPTransport(swarmt.GenUpgrader(t, sw, nil), nil)
+	require.NoError(t, err)
+	require.NoError(t, sw.AddTransport(&capabilityTransport{
+		Transport: tcpTransport,
+		caps:      transport.CapabilityDatagram | transport.CapabilityEarlyData,
+	}))
+	require.NoError(t, sw.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0")))
+	h2 := blhost.NewBlankHost(sw)
+	defer h2.Close()
+
+	ids1, err := NewIDService(h1)
+	require.NoError(t, err)
+	defer ids1.Close()
+	ids1.Start()
+	ids2, err := NewIDService(h2)
+	require.NoError(t, err)
+	defer ids2.Close()
+	ids2.Start()
+
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	require.Eventually(t, func() bool {
+		return len(AddrCapabilities(h1.Peerstore(), h2.ID())) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	for _, a := range h2.Addrs() {
+		require.Equal(t, transport.CapabilityDatagram|transport.CapabilityEarlyData, AddrCapabilities(h1.Peerstore(), h2.ID())[a.String()])
+	}
+	require.ElementsMatch(t, h2.Addrs(), AddrsWithCapabilities(h1.Peerstore(), h2.ID(), transport.CapabilityDatagram))
+
+	// h1's TCP transport doesn't report any capabilities
+	<-ids2.IdentifyWait(h2.Network().ConnsToPeer(h1.ID())[0])
+	require.Empty(t, AddrCapabilities(h2.Peerstore(), h1.ID()))
+	require.Empty(t, AddrsWithCapabilities(h2.Peerstore(), h1.ID(), transport.CapabilityDatagram))
+
+	// capabilities refer to the listen addresses by their index
+	addr := ma.StringCast("/ip4/1.2.3.4/udp/1/quic-v1")
+	ids2.consumeAddrCapabilities(h1.ID(), &pb.Identify{
+		ListenAddrs: [][]byte{addr.Bytes()},
+		AddrCapabilities: []*pb.AddrCapabilities{
+			{ListenAddrIndex: proto.Uint32(0), SupportsDatagram: proto.Bool(true)},
+			{ListenAddrIndex: proto.Uint32(1), SupportsEarlyData: proto.Bool(true)},
+			{SupportsEarlyData: proto.Bool(true)},
+		},
+	})
+	require.Equal(t, map[string]transport.Capabilities{addr.String(): transport.CapabilityDatagram}, AddrCapabilities(h2.Peerstore(), h1.ID()))
+}
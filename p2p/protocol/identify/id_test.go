@@ -198,7 +198,10 @@ func TestIDService(t *testing.T) {
 
 	// test that we received the "identify completed" event.
 	select {
-	case <-sub.Out():
+	case e := <-sub.Out():
+		evt := e.(event.EvtPeerIdentificationCompleted)
+		require.Equal(t, h2p, evt.Peer)
+		require.NotNil(t, evt.SignedPeerRecord)
 	case <-time.After(3 * time.Second):
 		t.Fatalf("expected EvtPeerIdentificationCompleted event within 10 seconds; none received")
 	}
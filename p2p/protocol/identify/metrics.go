@@ -73,6 +73,22 @@ var (
 			Buckets:   buckets,
 		},
 	)
+	natMappings = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "nat_mappings_total",
+			Help:      "NAT mappings compared to the previous observation, by consistency",
+		},
+		[]string{"transport", "consistent"},
+	)
+	natPortPredictions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricNamespace,
+			Name:      "nat_port_predictions_total",
+			Help:      "NAT external port predictions, by outcome",
+		},
+		[]string{"transport", "outcome"},
+	)
 	collectors = []prometheus.Collector{
 		pushesTriggered,
 		identify,
@@ -82,6 +98,8 @@ var (
 		addrsCount,
 		numProtocolsReceived,
 		numAddrsReceived,
+		natMappings,
+		natPortPredictions,
 	}
 	// 1 to 20 and then up to 100 in steps of 5
 	buckets = append(
@@ -102,6 +120,14 @@ type MetricsTracer interface {
 
 	// IdentifySent tracks metrics on sending an identify response
 	IdentifySent(isPush bool, numProtocols int, numAddrs int)
+
+	// NATMappingObserved tracks whether an observed NAT mapping was consistent with the previous one.
+	// Only called if NAT fingerprinting is enabled.
+	NATMappingObserved(proto network.NATTransportProtocol, consistent bool)
+
+	// NATPortPredicted tracks the outcome of a NAT external port prediction.
+	// Only called if NAT fingerprinting is enabled.
+	NATPortPredicted(proto network.NATTransportProtocol, success bool)
 }
 
 type metricsTracer struct{}
@@ -194,6 +220,43 @@ func (t *metricsTracer) ConnPushSupport(support identifyPushSupport) {
 	connPushSupportTotal.WithLabelValues(*tags...).Inc()
 }
 
+func (t *metricsTracer) NATMappingObserved(proto network.NATTransportProtocol, consistent bool) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+
+	*tags = append(*tags, getNATTransport(proto))
+	if consistent {
+		*tags = append(*tags, "true")
+	} else {
+		*tags = append(*tags, "false")
+	}
+	natMappings.WithLabelValues(*tags...).Inc()
+}
+
+func (t *metricsTracer) NATPortPredicted(proto network.NATTransportProtocol, success bool) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+
+	*tags = append(*tags, getNATTransport(proto))
+	if success {
+		*tags = append(*tags, "success")
+	} else {
+		*tags = append(*tags, "failure")
+	}
+	natPortPredictions.WithLabelValues(*tags...).Inc()
+}
+
+func getNATTransport(proto network.NATTransportProtocol) string {
+	switch proto {
+	case network.NATTransportTCP:
+		return "tcp"
+	case network.NATTransportUDP:
+		return "udp"
+	default:
+		return "unknown"
+	}
+}
+
 func getPushSupport(s identifyPushSupport) string {
 	switch s {
 	case identifyPushSupported:
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
 )
 
 func TestMetricsNoAllocNoCover(t *testing.T) {
@@ -28,6 +29,12 @@ func TestMetricsNoAllocNoCover(t *testing.T) {
 		"ConnPushSupport":  func() { tr.ConnPushSupport(pushSupport[rand.Intn(len(pushSupport))]) },
 		"IdentifyReceived": func() { tr.IdentifyReceived(rand.Intn(2) == 0, rand.Intn(20), rand.Intn(20)) },
 		"IdentifySent":     func() { tr.IdentifySent(rand.Intn(2) == 0, rand.Intn(20), rand.Intn(20)) },
+		"NATMappingObserved": func() {
+			tr.NATMappingObserved(network.NATTransportProtocol(rand.Intn(2)), rand.Intn(2) == 0)
+		},
+		"NATPortPredicted": func() {
+			tr.NATPortPredicted(network.NATTransportProtocol(rand.Intn(2)), rand.Intn(2) == 0)
+		},
 	}
 	for method, f := range tests {
 		allocs := testing.AllocsPerRun(1000, f)
@@ -0,0 +1,189 @@
+package identify
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/network"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// maxNATFingerprintMappings is the maximum number of local addresses for which we remember
+// the most recently observed mapping. When this is exceeded, the remembered mappings are dropped.
+const maxNATFingerprintMappings = 128
+
+// NATObservations are anonymized observations of the behavior of the NAT device, for one
+// transport protocol. They only consist of counters, no addresses or peer IDs are retained.
+//
+// Only observations made on outbound connections are taken into account.
+type NATObservations struct {
+	// Observations is the number of observed addresses reported by peers.
+	Observations int
+	// ConsistentMappings is the number of times a peer observed the same external address as the
+	// previous peer, for the same local address. This is the behavior of an endpoint-independent
+	// mapping, which makes hole punching likely to succeed.
+	ConsistentMappings int
+	// InconsistentMappings is the number of times a peer observed a different external address than
+	// the previous peer, for the same local address.
+	InconsistentMappings int
+	// PortPreserved is the number of times the external port was the same as the local port.
+	PortPreserved int
+	// PortPredictions is the number of times we tried to predict the external port of a new mapping,
+	// based on the difference between the ports of the previous two mappings.
+	PortPredictions int
+	// PortPredictionSuccesses is the number of port predictions that were correct.
+	PortPredictionSuccesses int
+}
+
+// MappingConsistency returns the fraction of mappings that were consistent.
+// It returns 0 if there were no mappings to compare yet.
+func (o NATObservations) MappingConsistency() float64 {
+	total := o.ConsistentMappings + o.InconsistentMappings
+	if total == 0 {
+		return 0
+	}
+	return float64(o.ConsistentMappings) / float64(total)
+}
+
+// PortPredictionRate returns the fraction of port predictions that were correct.
+// It returns 0 if no predictions were made yet.
+func (o NATObservations) PortPredictionRate() float64 {
+	if o.PortPredictions == 0 {
+		return 0
+	}
+	return float64(o.PortPredictionSuccesses) / float64(o.PortPredictions)
+}
+
+// NATFingerprint contains the NAT behavior observations collected by identify.
+// Collection is disabled by default, and is enabled using the EnableNATFingerprinting option.
+type NATFingerprint struct {
+	TCP NATObservations
+	UDP NATObservations
+}
+
+type natMapping struct {
+	observed string
+	observer string
+}
+
+type natTransportFingerprinter struct {
+	obs NATObservations
+	// local address -> most recently observed mapping
+	mappings map[string]natMapping
+
+	// lastPort is the external port of the most recent new mapping,
+	// lastDelta the difference to the port of the mapping before that.
+	lastPort, lastDelta int
+	hasLastPort         bool
+	hasLastDelta        bool
+}
+
+type natFingerprinter struct {
+	metricsTracer MetricsTracer
+
+	mu       sync.Mutex
+	tcp, udp natTransportFingerprinter
+}
+
+func newNATFingerprinter(tr MetricsTracer) *natFingerprinter {
+	return &natFingerprinter{
+		metricsTracer: tr,
+		tcp:           natTransportFingerprinter{mappings: make(map[string]natMapping)},
+		udp:           natTransportFingerprinter{mappings: make(map[string]natMapping)},
+	}
+}
+
+// record records an address observed by observer, for a connection using the local address.
+func (f *natFingerprinter) record(local ma.Multiaddr, observer string, observed ma.Multiaddr) {
+	var proto network.NATTransportProtocol
+	var code int
+	if _, err := observed.ValueForProtocol(ma.P_TCP); err == nil {
+		proto, code = network.NATTransportTCP, ma.P_TCP
+	} else if _, err := observed.ValueForProtocol(ma.P_UDP); err == nil {
+		proto, code = network.NATTransportUDP, ma.P_UDP
+	} else {
+		return
+	}
+	localPort, err := portForProtocol(local, code)
+	if err != nil {
+		return
+	}
+	observedPort, err := portForProtocol(observed, code)
+	if err != nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tf := &f.udp
+	if proto == network.NATTransportTCP {
+		tf = &f.tcp
+	}
+
+	localKey := string(local.Bytes())
+	observedKey := string(observed.Bytes())
+	prev, ok := tf.mappings[localKey]
+	if ok && prev.observer == observer {
+		// same observer, e.g. due to an identify push. This doesn't tell us anything new.
+		return
+	}
+
+	tf.obs.Observations++
+	if localPort == observedPort {
+		tf.obs.PortPreserved++
+	}
+
+	newMapping := true
+	if ok {
+		consistent := prev.observed == observedKey
+		newMapping = !consistent
+		if consistent {
+			tf.obs.ConsistentMappings++
+		} else {
+			tf.obs.InconsistentMappings++
+		}
+		if f.metricsTracer != nil {
+			f.metricsTracer.NATMappingObserved(proto, consistent)
+		}
+	}
+
+	if newMapping {
+		if tf.hasLastDelta {
+			success := tf.lastPort+tf.lastDelta == observedPort
+			tf.obs.PortPredictions++
+			if success {
+				tf.obs.PortPredictionSuccesses++
+			}
+			if f.metricsTracer != nil {
+				f.metricsTracer.NATPortPredicted(proto, success)
+			}
+		}
+		if tf.hasLastPort {
+			tf.lastDelta = observedPort - tf.lastPort
+			tf.hasLastDelta = true
+		}
+		tf.lastPort = observedPort
+		tf.hasLastPort = true
+	}
+
+	if !ok && len(tf.mappings) >= maxNATFingerprintMappings {
+		tf.mappings = make(map[string]natMapping)
+	}
+	tf.mappings[localKey] = natMapping{observed: observedKey, observer: observer}
+}
+
+func (f *natFingerprinter) fingerprint() NATFingerprint {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return NATFingerprint{TCP: f.tcp.obs, UDP: f.udp.obs}
+}
+
+func portForProtocol(addr ma.Multiaddr, code int) (int, error) {
+	v, err := addr.ValueForProtocol(code)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(v)
+}
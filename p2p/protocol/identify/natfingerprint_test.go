@@ -0,0 +1,48 @@
+package identify
+
+import (
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNATFingerprintConsistentMapping(t *testing.T) {
+	f := newNATFingerprinter(nil)
+	local := ma.StringCast("/ip4/192.168.0.1/udp/4001/quic-v1")
+	observed := ma.StringCast("/ip4/1.2.3.4/udp/4001/quic-v1")
+	f.record(local, "/ip4/5.5.5.1/udp", observed)
+	// an identify push from the same observer doesn't count
+	f.record(local, "/ip4/5.5.5.1/udp", observed)
+	f.record(local, "/ip4/5.5.5.2/udp", observed)
+	f.record(local, "/ip4/5.5.5.3/udp", observed)
+
+	fp := f.fingerprint()
+	require.Zero(t, fp.TCP)
+	require.Equal(t, 3, fp.UDP.Observations)
+	require.Equal(t, 3, fp.UDP.PortPreserved)
+	require.Equal(t, 2, fp.UDP.ConsistentMappings)
+	require.Zero(t, fp.UDP.InconsistentMappings)
+	require.Equal(t, 1.0, fp.UDP.MappingConsistency())
+	require.Zero(t, fp.UDP.PortPredictions)
+}
+
+func TestNATFingerprintPortPrediction(t *testing.T) {
+	f := newNATFingerprinter(nil)
+	local := ma.StringCast("/ip4/192.168.0.1/tcp/4001")
+	// a symmetric NAT, allocating ports sequentially
+	for i, port := range []string{"1000", "1002", "1004", "1006", "1100"} {
+		observer := "/ip4/5.5.5." + string(rune('1'+i)) + "/tcp"
+		f.record(local, observer, ma.StringCast("/ip4/1.2.3.4/tcp/"+port))
+	}
+
+	fp := f.fingerprint()
+	require.Zero(t, fp.UDP)
+	require.Equal(t, 5, fp.TCP.Observations)
+	require.Zero(t, fp.TCP.PortPreserved)
+	require.Zero(t, fp.TCP.ConsistentMappings)
+	require.Equal(t, 4, fp.TCP.InconsistentMappings)
+	require.Equal(t, 3, fp.TCP.PortPredictions)
+	require.Equal(t, 2, fp.TCP.PortPredictionSuccesses)
+	require.InDelta(t, 2.0/3, fp.TCP.PortPredictionRate(), 0.001)
+}
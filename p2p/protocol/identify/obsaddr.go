@@ -3,6 +3,8 @@ package identify
 import (
 	"context"
 	"fmt"
+	"net"
+	"strings"
 	"sync"
 	"time"
 
@@ -126,11 +128,18 @@ type ObservedAddrManager struct {
 	currentUDPNATDeviceType  network.NATDeviceType
 	currentTCPNATDeviceType  network.NATDeviceType
 	emitNATDeviceTypeChanged event.Emitter
+
+	// nil if NAT fingerprinting is disabled
+	natFingerprinter *natFingerprinter
 }
 
 // NewObservedAddrManager returns a new address manager using
 // peerstore.OwnObservedAddressTTL as the TTL.
 func NewObservedAddrManager(host host.Host) (*ObservedAddrManager, error) {
+	return newObservedAddrManager(host, nil)
+}
+
+func newObservedAddrManager(host host.Host, fp *natFingerprinter) (*ObservedAddrManager, error) {
 	oas := &ObservedAddrManager{
 		addrs:       make(map[string][]*observedAddr),
 		ttl:         peerstore.OwnObservedAddrTTL,
@@ -138,7 +147,8 @@ func NewObservedAddrManager(host host.Host) (*ObservedAddrManager, error) {
 		host:        host,
 		activeConns: make(map[network.Conn]ma.Multiaddr),
 		// refresh every ttl/2 so we don't forget observations from connected peers
-		refreshTimer: time.NewTimer(peerstore.OwnObservedAddrTTL / 2),
+		refreshTimer:     time.NewTimer(peerstore.OwnObservedAddrTTL / 2),
+		natFingerprinter: fp,
 	}
 	oas.ctx, oas.ctxCancel = context.WithCancel(context.Background())
 
@@ -194,6 +204,73 @@ func (oas *ObservedAddrManager) Addrs() []ma.Multiaddr {
 	return oas.filter(allObserved)
 }
 
+// ObservedAddr is a snapshot of the state of an address observed by our peers.
+type ObservedAddr struct {
+	// Local is the local address of the connections the address was observed on.
+	Local ma.Multiaddr
+	// Addr is the observed address.
+	Addr ma.Multiaddr
+	// Observers is the number of distinct observers that reported Addr.
+	// Observers are grouped by IP address (or /64 subnet for IPv6).
+	Observers int
+	// InboundObservers is the number of observers that reported Addr on an inbound connection.
+	InboundObservers int
+	// LastSeen is the time Addr was last reported.
+	LastSeen time.Time
+	// Activated is true if Addr was reported by at least ActivationThresh observers.
+	Activated bool
+	// Advertised is true if Addr is one of the addresses returned by Addrs,
+	// i.e. it's activated, recent, and one of the best addresses of its group.
+	Advertised bool
+}
+
+// ObservedAddrs returns all observed addresses, including the ones that aren't activated yet,
+// sorted by local address, and then by the number of observers (highest first).
+// Applications can use it to implement their own advertisement logic, or for debugging.
+func (oas *ObservedAddrManager) ObservedAddrs() []ObservedAddr {
+	oas.mu.RLock()
+	defer oas.mu.RUnlock()
+
+	var all []*observedAddr
+	for _, addrs := range oas.addrs {
+		all = append(all, addrs...)
+	}
+	advertised := make(map[string]struct{})
+	for _, a := range oas.filter(all) {
+		advertised[string(a.Bytes())] = struct{}{}
+	}
+
+	out := make([]ObservedAddr, 0, len(all))
+	for local, addrs := range oas.addrs {
+		localAddr, err := ma.NewMultiaddrBytes([]byte(local))
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			_, ok := advertised[string(a.addr.Bytes())]
+			out = append(out, ObservedAddr{
+				Local:            localAddr,
+				Addr:             a.addr,
+				Observers:        len(a.seenBy),
+				InboundObservers: a.numInbound,
+				LastSeen:         a.lastSeen,
+				Activated:        a.activated(),
+				Advertised:       ok,
+			})
+		}
+	}
+	slices.SortFunc(out, func(a, b ObservedAddr) int {
+		if c := strings.Compare(a.Local.String(), b.Local.String()); c != 0 {
+			return c
+		}
+		if a.Observers != b.Observers {
+			return b.Observers - a.Observers
+		}
+		return strings.Compare(a.Addr.String(), b.Addr.String())
+	})
+	return out
+}
+
 func (oas *ObservedAddrManager) filter(observedAddrs []*observedAddr) []ma.Multiaddr {
 	pmap := make(map[string][]*observedAddr)
 	now := time.Now()
@@ -356,10 +433,61 @@ func (oas *ObservedAddrManager) removeConn(conn network.Conn) {
 	oas.activeConnsMu.Unlock()
 }
 
+// removeListenAddr forgets the observations made on connections accepted by a listener,
+// after the listener was closed. The observed addresses are not reachable any more,
+// even if some of these connections remain open.
+func (oas *ObservedAddrManager) removeListenAddr(listen ma.Multiaddr) {
+	oas.activeConnsMu.Lock()
+	for conn := range oas.activeConns {
+		if isListenerLocalAddr(listen, conn.LocalMultiaddr()) {
+			delete(oas.activeConns, conn)
+		}
+	}
+	oas.activeConnsMu.Unlock()
+
+	oas.mu.Lock()
+	var removed bool
+	for local := range oas.addrs {
+		localAddr, err := ma.NewMultiaddrBytes([]byte(local))
+		if err != nil || !isListenerLocalAddr(listen, localAddr) {
+			continue
+		}
+		delete(oas.addrs, local)
+		removed = true
+	}
+	oas.mu.Unlock()
+
+	// The host might have updated its addresses before we removed the observations.
+	if s, ok := oas.host.(addrChangeSignaler); removed && ok {
+		s.SignalAddressChange()
+	}
+}
+
+// isListenerLocalAddr returns true if local is the local address of a connection accepted
+// by a listener listening on listen.
+func isListenerLocalAddr(listen, local ma.Multiaddr) bool {
+	if listen.Equal(local) {
+		return true
+	}
+	listenIP, listenRest := ma.SplitFirst(listen)
+	localIP, localRest := ma.SplitFirst(local)
+	if listenIP == nil || localIP == nil || listenRest == nil || localRest == nil {
+		return false
+	}
+	if listenIP.Protocol().Code != localIP.Protocol().Code || !manet.IsIPUnspecified(listenIP) {
+		return false
+	}
+	return listenRest.Equal(localRest)
+}
+
 type normalizeMultiaddrer interface {
 	NormalizeMultiaddr(addr ma.Multiaddr) ma.Multiaddr
 }
 
+type addrChangeSignaler interface {
+	SignalAddressChange()
+}
+
 type addrsProvider interface {
 	Addrs() []ma.Multiaddr
 }
@@ -454,7 +582,20 @@ func (oas *ObservedAddrManager) maybeRecordObservation(conn network.Conn, observ
 		if oas.reachability == network.ReachabilityPrivate {
 			oas.emitAllNATTypes()
 		}
+
+		if oas.natFingerprinter != nil && conn.Stat().Direction == network.DirOutbound {
+			oas.natFingerprinter.record(conn.LocalMultiaddr(), observerGroup(conn.RemoteMultiaddr()), observed)
+		}
+	}
+}
+
+// NATFingerprint returns the NAT behavior observations collected so far.
+// It returns false if NAT fingerprinting is disabled.
+func (oas *ObservedAddrManager) NATFingerprint() (NATFingerprint, bool) {
+	if oas.natFingerprinter == nil {
+		return NATFingerprint{}, false
 	}
+	return oas.natFingerprinter.fingerprint(), true
 }
 
 func (oas *ObservedAddrManager) recordObservationUnlocked(conn network.Conn, observed ma.Multiaddr) {
@@ -595,6 +736,11 @@ func (oas *ObservedAddrManager) Close() error {
 	return nil
 }
 
+// observerGroupIPv6PrefixLen is the length of the IPv6 prefix that counts as a single observer.
+// ISPs commonly assign a /56 to a single subscriber, so all addresses in a /56 are likely
+// controlled by the same party.
+const observerGroupIPv6PrefixLen = 56
+
 // observerGroup is a function that determines what part of
 // a multiaddr counts as a different observer. for example,
 // two ipfs nodes at the same IP/TCP transport would get
@@ -605,9 +751,19 @@ func (oas *ObservedAddrManager) Close() error {
 //
 // Here, we use the root multiaddr address. This is mostly
 // IP addresses. In practice, this is what we want.
+// IPv6 addresses are grouped by their /56 prefix, as a single party
+// can easily obtain a lot of IPv6 addresses.
 func observerGroup(m ma.Multiaddr) string {
-	// TODO: If IPv6 rolls out we should mark /64 routing zones as one group
 	first, _ := ma.SplitFirst(m)
+	if first == nil {
+		return ""
+	}
+	if first.Protocol().Code == ma.P_IP6 {
+		ip := net.IP(first.RawValue()).Mask(net.CIDRMask(observerGroupIPv6PrefixLen, 128))
+		if c, err := ma.NewComponent("ip6", ip.String()); err == nil {
+			return string(c.Bytes())
+		}
+	}
 	return string(first.Bytes())
 }
 
@@ -632,9 +788,11 @@ func (oas *ObservedAddrManager) TTL() time.Duration {
 
 type obsAddrNotifiee ObservedAddrManager
 
-func (on *obsAddrNotifiee) Listen(n network.Network, a ma.Multiaddr)      {}
-func (on *obsAddrNotifiee) ListenClose(n network.Network, a ma.Multiaddr) {}
-func (on *obsAddrNotifiee) Connected(n network.Network, v network.Conn)   {}
+func (on *obsAddrNotifiee) Listen(n network.Network, a ma.Multiaddr) {}
+func (on *obsAddrNotifiee) ListenClose(n network.Network, a ma.Multiaddr) {
+	(*ObservedAddrManager)(on).removeListenAddr(a)
+}
+func (on *obsAddrNotifiee) Connected(n network.Network, v network.Conn) {}
 func (on *obsAddrNotifiee) Disconnected(n network.Network, v network.Conn) {
 	(*ObservedAddrManager)(on).removeConn(v)
 }
@@ -151,3 +151,30 @@ func TestShouldRecordObservationWithNAT64Addr(t *testing.T) {
 		})
 	}
 }
+
+func TestIsListenerLocalAddr(t *testing.T) {
+	for _, tc := range []struct {
+		listen, local string
+		expected      bool
+	}{
+		{"/ip4/192.168.0.1/tcp/4001", "/ip4/192.168.0.1/tcp/4001", true},
+		{"/ip4/192.168.0.1/tcp/4001", "/ip4/192.168.0.2/tcp/4001", false},
+		{"/ip4/0.0.0.0/tcp/4001", "/ip4/192.168.0.2/tcp/4001", true},
+		{"/ip4/0.0.0.0/tcp/4001", "/ip4/192.168.0.2/tcp/4002", false},
+		{"/ip4/0.0.0.0/tcp/4001", "/ip6/::1/tcp/4001", false},
+		{"/ip6/::/udp/4001/quic-v1", "/ip6/::1/udp/4001/quic-v1", true},
+		{"/ip4/0.0.0.0/udp/4001/quic-v1", "/ip4/192.168.0.2/udp/4001/quic-v1/webtransport", false},
+	} {
+		require.Equal(t, tc.expected, isListenerLocalAddr(ma.StringCast(tc.listen), ma.StringCast(tc.local)), "%s, %s", tc.listen, tc.local)
+	}
+}
+
+func TestObserverGroup(t *testing.T) {
+	group := func(s string) string { return observerGroup(ma.StringCast(s)) }
+	require.Equal(t, group("/ip4/1.2.3.4/tcp/1"), group("/ip4/1.2.3.4/udp/2/quic-v1"))
+	require.NotEqual(t, group("/ip4/1.2.3.4/tcp/1"), group("/ip4/1.2.3.5/tcp/1"))
+	// IPv6 addresses in the same /56 count as a single observer
+	require.Equal(t, group("/ip6/2001:db8:0:ff::1/tcp/1"), group("/ip6/2001:db8:0:1::2/tcp/1"))
+	require.NotEqual(t, group("/ip6/2001:db8:0:ff::1/tcp/1"), group("/ip6/2001:db8:0:100::1/tcp/1"))
+	require.NotEqual(t, group("/ip4/0.0.0.0/tcp/1"), group("/ip6/::/tcp/1"))
+}
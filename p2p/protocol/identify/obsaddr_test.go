@@ -2,6 +2,7 @@ package identify_test
 
 import (
 	"crypto/rand"
+	"fmt"
 	"testing"
 	"time"
 
@@ -328,6 +329,42 @@ func TestObservedAddrFiltering(t *testing.T) {
 	require.Contains(t, addrs, it3)
 }
 
+func TestObservedAddrsSnapshot(t *testing.T) {
+	harness := newHarness(t)
+	require.Empty(t, harness.oas.ObservedAddrs())
+
+	a1 := ma.StringCast("/ip4/1.2.3.4/tcp/1231")
+	a2 := ma.StringCast("/ip4/1.2.3.4/tcp/1232")
+
+	var peers []peer.ID
+	for i := 0; i < 5; i++ {
+		peers = append(peers, harness.add(ma.StringCast(fmt.Sprintf("/ip4/1.2.3.%d/tcp/1236", 10+i))))
+	}
+	harness.observeInbound(a1, peers[0])
+	for _, p := range peers[1:4] {
+		harness.observe(a1, p)
+	}
+	harness.observe(a2, peers[4])
+
+	obs := harness.oas.ObservedAddrs()
+	require.Len(t, obs, 2)
+	local := harness.host.Network().ListenAddresses()[0]
+
+	require.True(t, a1.Equal(obs[0].Addr))
+	require.True(t, local.Equal(obs[0].Local))
+	require.Equal(t, 4, obs[0].Observers)
+	require.Equal(t, 1, obs[0].InboundObservers)
+	require.True(t, obs[0].Activated)
+	require.True(t, obs[0].Advertised)
+	require.WithinDuration(t, time.Now(), obs[0].LastSeen, 10*time.Second)
+
+	require.True(t, a2.Equal(obs[1].Addr))
+	require.Equal(t, 1, obs[1].Observers)
+	require.Zero(t, obs[1].InboundObservers)
+	require.False(t, obs[1].Activated)
+	require.False(t, obs[1].Advertised)
+}
+
 func TestEmitNATDeviceTypeSymmetric(t *testing.T) {
 	harness := newHarness(t)
 	require.Empty(t, harness.oas.Addrs())
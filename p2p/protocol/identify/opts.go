@@ -1,10 +1,15 @@
 package identify
 
+import "time"
+
 type config struct {
 	protocolVersion         string
 	userAgent               string
 	disableSignedPeerRecord bool
+	storePeerRecords        bool
 	metricsTracer           MetricsTracer
+	natFingerprinting       bool
+	refreshInterval         time.Duration
 }
 
 // Option is an option function for identify.
@@ -33,8 +38,37 @@ func DisableSignedPeerRecord() Option {
 	}
 }
 
+// StorePeerRecords stores the signed peer records received from peers in the certified address book
+// of the peerstore, if the peerstore has one. The records can then be passed on to other peers, and
+// are renewed before they expire (see peerstore.RecordRenewalNotifier).
+// By default, only the addresses contained in the records are added to the peerstore.
+func StorePeerRecords() Option {
+	return func(cfg *config) {
+		cfg.storePeerRecords = true
+	}
+}
+
 func WithMetricsTracer(tr MetricsTracer) Option {
 	return func(cfg *config) {
 		cfg.metricsTracer = tr
 	}
 }
+
+// EnableNATFingerprinting enables the collection of anonymized observations of the behavior of
+// the NAT device, such as the consistency of mappings and the predictability of external ports.
+// The observations are only kept locally, and are exposed via IDService.NATFingerprint and metrics.
+func EnableNATFingerprinting() Option {
+	return func(cfg *config) {
+		cfg.natFingerprinting = true
+	}
+}
+
+// WithRefreshInterval makes identify run again on connections that haven't been identified for the
+// given interval. This keeps the protocols and addresses of peers up to date on long-lived
+// connections, even if the peer doesn't support Identify Push.
+// Refreshing is disabled by default.
+func WithRefreshInterval(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.refreshInterval = d
+	}
+}
@@ -0,0 +1,139 @@
+package identify
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/network"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// maxRefreshConcurrency is the number of connections that are identified again concurrently.
+const maxRefreshConcurrency = 8
+
+// startRefresh periodically identifies long-lived connections again, so that the protocols and
+// addresses of peers don't go stale on connections that live for a long time, even if the peer
+// doesn't support Identify Push. Pushes received from the peer reset the timer.
+// It's a no-op if no refresh interval is configured.
+func (ids *idService) startRefresh() {
+	if ids.refreshInterval <= 0 {
+		return
+	}
+
+	ids.refCount.Add(1)
+	go func() {
+		defer ids.refCount.Done()
+
+		// check more frequently than the refresh interval, so that connections are refreshed
+		// shortly after they become due
+		t := time.NewTicker(ids.refreshInterval / 4)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				ids.refreshConns()
+			case <-ids.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// refreshConns identifies all connections again that haven't been identified within the refresh interval.
+func (ids *idService) refreshConns() {
+	now := time.Now()
+	ids.connsMu.RLock()
+	var conns []network.Conn
+	for c, e := range ids.conns {
+		// Only refresh connections that have been identified before.
+		// Connections that are still being identified, or that failed identification, are skipped.
+		if e.LastIdentified.IsZero() || now.Sub(e.LastIdentified) < ids.refreshInterval {
+			continue
+		}
+		conns = append(conns, c)
+	}
+	ids.connsMu.RUnlock()
+
+	sem := make(chan struct{}, maxRefreshConcurrency)
+	var wg sync.WaitGroup
+	for _, c := range conns {
+		select {
+		case sem <- struct{}{}:
+		case <-ids.ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(c network.Conn) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			ids.refreshConn(c)
+		}(c)
+	}
+	wg.Wait()
+}
+
+// refreshConn identifies the connection again.
+func (ids *idService) refreshConn(c network.Conn) {
+	if c.IsClosed() {
+		return
+	}
+	if err := ids.reidentify(c); err != nil {
+		log.Debugw("failed to refresh identify", "peer", c.RemotePeer(), "error", err)
+	}
+}
+
+// reidentify identifies a connection again that was identified before. Instead of the events of
+// a new identification, it emits an EvtPeerProtocolsUpdated if the peer's protocols changed, and an
+// EvtPeerIdentificationCompleted only if the peer's protocols or addresses changed.
+func (ids *idService) reidentify(c network.Conn) error {
+	p := c.RemotePeer()
+	ps := ids.Host.Peerstore()
+	protosBefore, _ := ps.GetProtocols(p)
+	addrsBefore := ps.Addrs(p)
+	signedPeerRecord, err := ids.identifyConn(c)
+	if err != nil {
+		return err
+	}
+
+	var changed bool
+	if protosAfter, err := ps.GetProtocols(p); err == nil {
+		if added, removed := diff(protosBefore, protosAfter); len(added) > 0 || len(removed) > 0 {
+			changed = true
+			ids.emitters.evtPeerProtocolsUpdated.Emit(event.EvtPeerProtocolsUpdated{
+				Peer:    p,
+				Added:   added,
+				Removed: removed,
+			})
+		}
+	}
+	if !changed && !sameAddrs(addrsBefore, ps.Addrs(p)) {
+		changed = true
+	}
+	if changed {
+		ids.emitters.evtPeerIdentificationCompleted.Emit(event.EvtPeerIdentificationCompleted{
+			Peer:             p,
+			SignedPeerRecord: signedPeerRecord,
+		})
+	}
+	return nil
+}
+
+// sameAddrs returns true if a and b contain the same addresses, in any order.
+func sameAddrs(a, b []ma.Multiaddr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]struct{}, len(a))
+	for _, addr := range a {
+		set[string(addr.Bytes())] = struct{}{}
+	}
+	for _, addr := range b {
+		if _, ok := set[string(addr.Bytes())]; !ok {
+			return false
+		}
+	}
+	return true
+}
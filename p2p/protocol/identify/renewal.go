@@ -0,0 +1,79 @@
+package identify
+
+import (
+	"context"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+)
+
+// recordRenewalWindow is how long before the signed peer record of a peer expires we ask the
+// peer for a fresh one.
+const recordRenewalWindow = 5 * time.Minute
+
+// renewalQueueSize is the number of peers that can be queued for renewal.
+// Renewals are dropped if the queue is full.
+const renewalQueueSize = 64
+
+// startRecordRenewal renews the signed peer records of the peers we care about before they expire,
+// so that we don't silently lose the certified addresses of idle peers.
+// It's a no-op if records aren't stored, or if the peerstore doesn't notify about expiring records.
+func (ids *idService) startRecordRenewal() {
+	if !ids.storePeerRecords {
+		return
+	}
+	n, ok := ids.Host.Peerstore().(peerstore.RecordRenewalNotifier)
+	if !ok {
+		return
+	}
+
+	queue := make(chan peer.ID, renewalQueueSize)
+	cancel := n.NotifyRecordRenewal(recordRenewalWindow, func(p peer.ID) {
+		select {
+		case queue <- p:
+		default:
+			log.Debugw("dropping record renewal, queue full", "peer", p)
+		}
+	})
+
+	ids.refCount.Add(1)
+	go func() {
+		defer ids.refCount.Done()
+		defer cancel()
+
+		for {
+			select {
+			case p := <-queue:
+				ids.renewRecord(p)
+			case <-ids.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// renewRecord requests a fresh signed peer record from p, if we're connected to p or if it is protected.
+func (ids *idService) renewRecord(p peer.ID) {
+	if ids.Host.Network().Connectedness(p) != network.Connected {
+		if !ids.Host.ConnManager().IsProtected(p, "") {
+			return
+		}
+		// Identify runs on the new connection.
+		ctx, cancel := context.WithTimeout(ids.ctx, Timeout)
+		defer cancel()
+		if err := ids.Host.Connect(ctx, peer.AddrInfo{ID: p}); err != nil {
+			log.Debugw("failed to connect to renew signed peer record", "peer", p, "error", err)
+		}
+		return
+	}
+
+	conns := ids.Host.Network().ConnsToPeer(p)
+	if len(conns) == 0 {
+		return
+	}
+	if err := ids.reidentify(conns[0]); err != nil {
+		log.Debugw("failed to renew signed peer record", "peer", p, "error", err)
+	}
+}
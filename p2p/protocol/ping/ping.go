@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	mrand "math/rand"
 	"time"
@@ -28,6 +29,59 @@ const (
 	ServiceName = "libp2p.ping"
 )
 
+// Option is an option for pinging a peer.
+type Option func(*config) error
+
+type config struct {
+	payloadSize int
+	interval    time.Duration
+
+	// only used by the Watchdog
+	timeout          time.Duration
+	failureThreshold int
+}
+
+func newConfig(opts ...Option) (*config, error) {
+	cfg := &config{
+		payloadSize:      PingSize,
+		interval:         defaultWatchdogInterval,
+		timeout:          defaultWatchdogTimeout,
+		failureThreshold: defaultFailureThreshold,
+	}
+	for _, opt := range opts {
+		if err := opt(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// WithPayloadSize sets the number of bytes sent with every ping.
+// The ping protocol echoes the payload in chunks of PingSize bytes,
+// so the size must be a multiple of PingSize. Defaults to PingSize.
+func WithPayloadSize(n int) Option {
+	return func(cfg *config) error {
+		if n <= 0 || n%PingSize != 0 {
+			return fmt.Errorf("ping: payload size must be a positive multiple of %d, got %d", PingSize, n)
+		}
+		cfg.payloadSize = n
+		return nil
+	}
+}
+
+// WithInterval sets the interval between two pings.
+// When pinging using Ping, it defaults to 0, i.e. the next ping is sent as soon as
+// the previous one completed. For the Watchdog, it defaults to 15 seconds.
+func WithInterval(d time.Duration) Option {
+	return func(cfg *config) error {
+		if d < 0 {
+			return errors.New("ping: negative interval")
+		}
+		cfg.interval = d
+		return nil
+	}
+}
+
 type PingService struct {
 	Host host.Host
 }
@@ -97,8 +151,8 @@ type Result struct {
 	Error error
 }
 
-func (ps *PingService) Ping(ctx context.Context, p peer.ID) <-chan Result {
-	return Ping(ctx, ps.Host, p)
+func (ps *PingService) Ping(ctx context.Context, p peer.ID, opts ...Option) <-chan Result {
+	return Ping(ctx, ps.Host, p, opts...)
 }
 
 func pingError(err error) chan Result {
@@ -110,7 +164,12 @@ func pingError(err error) chan Result {
 
 // Ping pings the remote peer until the context is canceled, returning a stream
 // of RTTs or errors.
-func Ping(ctx context.Context, h host.Host, p peer.ID) <-chan Result {
+func Ping(ctx context.Context, h host.Host, p peer.ID, opts ...Option) <-chan Result {
+	cfg, err := newConfig(append([]Option{WithInterval(0)}, opts...)...)
+	if err != nil {
+		return pingError(err)
+	}
+
 	s, err := h.NewStream(network.WithUseTransient(ctx, "ping"), p, ID)
 	if err != nil {
 		return pingError(err)
@@ -139,7 +198,7 @@ func Ping(ctx context.Context, h host.Host, p peer.ID) <-chan Result {
 
 		for ctx.Err() == nil {
 			var res Result
-			res.RTT, res.Error = ping(s, ra)
+			res.RTT, res.Error = ping(s, ra, cfg.payloadSize)
 
 			// canceled, ignore everything.
 			if ctx.Err() != nil {
@@ -156,6 +215,16 @@ func Ping(ctx context.Context, h host.Host, p peer.ID) <-chan Result {
 			case <-ctx.Done():
 				return
 			}
+
+			if cfg.interval > 0 {
+				timer := time.NewTimer(cfg.interval)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				}
+			}
 		}
 	}()
 	go func() {
@@ -167,15 +236,15 @@ func Ping(ctx context.Context, h host.Host, p peer.ID) <-chan Result {
 	return out
 }
 
-func ping(s network.Stream, randReader io.Reader) (time.Duration, error) {
-	if err := s.Scope().ReserveMemory(2*PingSize, network.ReservationPriorityAlways); err != nil {
+func ping(s network.Stream, randReader io.Reader, size int) (time.Duration, error) {
+	if err := s.Scope().ReserveMemory(2*size, network.ReservationPriorityAlways); err != nil {
 		log.Debugf("error reserving memory for ping stream: %s", err)
 		s.Reset()
 		return 0, err
 	}
-	defer s.Scope().ReleaseMemory(2 * PingSize)
+	defer s.Scope().ReleaseMemory(2 * size)
 
-	buf := pool.Get(PingSize)
+	buf := pool.Get(size)
 	defer pool.Put(buf)
 
 	if _, err := io.ReadFull(randReader, buf); err != nil {
@@ -187,7 +256,7 @@ func ping(s network.Stream, randReader io.Reader) (time.Duration, error) {
 		return 0, err
 	}
 
-	rbuf := pool.Get(PingSize)
+	rbuf := pool.Get(size)
 	defer pool.Put(rbuf)
 
 	if _, err := io.ReadFull(s, rbuf); err != nil {
@@ -5,7 +5,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/event"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
 	bhost "github.com/libp2p/go-libp2p/p2p/host/basic"
 	swarmt "github.com/libp2p/go-libp2p/p2p/net/swarm/testing"
 	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
@@ -55,3 +57,108 @@ func testPing(t *testing.T, ps *ping.PingService, p peer.ID) {
 	}
 
 }
+
+func TestPingOptions(t *testing.T) {
+	h1, err := bhost.NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), nil)
+	require.NoError(t, err)
+	defer h1.Close()
+	h1.Start()
+	h2, err := bhost.NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), nil)
+	require.NoError(t, err)
+	defer h2.Close()
+	h2.Start()
+	require.NoError(t, h1.Connect(context.Background(), peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}))
+	ping.NewPingService(h2)
+
+	res := <-ping.Ping(context.Background(), h1, h2.ID(), ping.WithPayloadSize(33))
+	require.Error(t, res.Error)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	const interval = 50 * time.Millisecond
+	ts := ping.Ping(ctx, h1, h2.ID(), ping.WithPayloadSize(4*ping.PingSize), ping.WithInterval(interval))
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		select {
+		case res := <-ts:
+			require.NoError(t, res.Error)
+		case <-time.After(time.Second * 4):
+			t.Fatal("failed to receive ping")
+		}
+	}
+	require.GreaterOrEqual(t, time.Since(start), 2*interval)
+}
+
+func TestWatchdogOptions(t *testing.T) {
+	h, err := bhost.NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), nil)
+	require.NoError(t, err)
+	defer h.Close()
+
+	for _, opt := range []ping.Option{
+		ping.WithInterval(0),
+		ping.WithTimeout(0),
+		ping.WithFailureThreshold(0),
+		ping.WithPayloadSize(0),
+	} {
+		_, err := ping.NewWatchdog(h, opt)
+		require.Error(t, err)
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	h1, err := bhost.NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), nil)
+	require.NoError(t, err)
+	defer h1.Close()
+	h1.Start()
+	h2, err := bhost.NewHost(swarmt.GenSwarm(t, swarmt.OptDisableQUIC), nil)
+	require.NoError(t, err)
+	defer h2.Close()
+	h2.Start()
+	h1.Peerstore().AddAddrs(h2.ID(), h2.Addrs(), peerstore.PermanentAddrTTL)
+	ping.NewPingService(h2)
+
+	sub, err := h1.EventBus().Subscribe([]interface{}{new(event.EvtPeerSuspected), new(event.EvtPeerRecovered)})
+	require.NoError(t, err)
+	defer sub.Close()
+
+	w, err := ping.NewWatchdog(h1,
+		ping.WithInterval(20*time.Millisecond),
+		ping.WithTimeout(time.Second),
+		ping.WithFailureThreshold(3),
+	)
+	require.NoError(t, err)
+	defer w.Close()
+	w.Watch(h2.ID())
+	require.Eventually(t, func() bool { return h1.Peerstore().LatencyEWMA(h2.ID()) > 0 }, 2*time.Second, 10*time.Millisecond)
+	require.False(t, w.Suspected(h2.ID()))
+
+	// make pings fail
+	h2.RemoveStreamHandler(ping.ID)
+	h2.Network().ClosePeer(h1.ID())
+
+	select {
+	case e := <-sub.Out():
+		evt, ok := e.(event.EvtPeerSuspected)
+		require.True(t, ok, "expected an EvtPeerSuspected, got %T", e)
+		require.Equal(t, h2.ID(), evt.Peer)
+		require.Equal(t, 3, evt.Failures)
+		require.Error(t, evt.Err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected the peer to be suspected")
+	}
+	require.True(t, w.Suspected(h2.ID()))
+
+	ping.NewPingService(h2)
+	select {
+	case e := <-sub.Out():
+		evt, ok := e.(event.EvtPeerRecovered)
+		require.True(t, ok, "expected an EvtPeerRecovered, got %T", e)
+		require.Equal(t, h2.ID(), evt.Peer)
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected the peer to recover")
+	}
+	require.False(t, w.Suspected(h2.ID()))
+
+	w.Unwatch(h2.ID())
+	require.False(t, w.Suspected(h2.ID()))
+}
@@ -0,0 +1,239 @@
+package ping
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/event"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	defaultWatchdogInterval = 15 * time.Second
+	defaultWatchdogTimeout  = 10 * time.Second
+	defaultFailureThreshold = 3
+)
+
+// WithTimeout sets the time the Watchdog waits for a ping response,
+// before counting the ping as failed. Defaults to 10 seconds.
+func WithTimeout(d time.Duration) Option {
+	return func(cfg *config) error {
+		if d <= 0 {
+			return errors.New("ping: timeout must be positive")
+		}
+		cfg.timeout = d
+		return nil
+	}
+}
+
+// WithFailureThreshold sets the number of consecutive failed pings after which
+// the Watchdog suspects a peer to be unreachable. Defaults to 3.
+func WithFailureThreshold(n int) Option {
+	return func(cfg *config) error {
+		if n <= 0 {
+			return errors.New("ping: failure threshold must be positive")
+		}
+		cfg.failureThreshold = n
+		return nil
+	}
+}
+
+// Watchdog periodically pings a set of peers to monitor their connectivity.
+// A peer is suspected to be unreachable after a number of consecutive failed pings,
+// in which case an event.EvtPeerSuspected is emitted. Once the peer responds again,
+// an event.EvtPeerRecovered is emitted.
+//
+// Since the pings also keep the connection busy, the Watchdog can be used as a keepalive,
+// for example for connections via a relay.
+type Watchdog struct {
+	host host.Host
+	cfg  *config
+
+	ctx       context.Context
+	ctxCancel context.CancelFunc
+	refCount  sync.WaitGroup
+
+	suspectedEmitter, recoveredEmitter event.Emitter
+
+	mx    sync.Mutex
+	peers map[peer.ID]*watchedPeer
+}
+
+type watchedPeer struct {
+	cancel    context.CancelFunc
+	suspected bool
+}
+
+// NewWatchdog creates a new Watchdog.
+// The Watchdog accepts the WithPayloadSize, WithInterval, WithTimeout and WithFailureThreshold options.
+func NewWatchdog(h host.Host, opts ...Option) (*Watchdog, error) {
+	cfg, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.interval == 0 {
+		return nil, errors.New("ping: watchdog interval must be positive")
+	}
+	suspectedEmitter, err := h.EventBus().Emitter(new(event.EvtPeerSuspected))
+	if err != nil {
+		return nil, err
+	}
+	recoveredEmitter, err := h.EventBus().Emitter(new(event.EvtPeerRecovered))
+	if err != nil {
+		suspectedEmitter.Close()
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Watchdog{
+		host:             h,
+		cfg:              cfg,
+		ctx:              ctx,
+		ctxCancel:        cancel,
+		suspectedEmitter: suspectedEmitter,
+		recoveredEmitter: recoveredEmitter,
+		peers:            make(map[peer.ID]*watchedPeer),
+	}, nil
+}
+
+// Watch starts watching a peer. Watching a peer that is already watched is a no-op.
+func (w *Watchdog) Watch(p peer.ID) {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	if w.ctx.Err() != nil {
+		return
+	}
+	if _, ok := w.peers[p]; ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(w.ctx)
+	wp := &watchedPeer{cancel: cancel}
+	w.peers[p] = wp
+	w.refCount.Add(1)
+	go w.watch(ctx, p, wp)
+}
+
+// Unwatch stops watching a peer.
+func (w *Watchdog) Unwatch(p peer.ID) {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	if wp, ok := w.peers[p]; ok {
+		wp.cancel()
+		delete(w.peers, p)
+	}
+}
+
+// Suspected says if a watched peer is currently suspected to be unreachable.
+func (w *Watchdog) Suspected(p peer.ID) bool {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	wp, ok := w.peers[p]
+	return ok && wp.suspected
+}
+
+// Close stops watching all peers.
+func (w *Watchdog) Close() error {
+	w.mx.Lock()
+	w.ctxCancel()
+	w.peers = make(map[peer.ID]*watchedPeer)
+	w.mx.Unlock()
+
+	w.refCount.Wait()
+	w.suspectedEmitter.Close()
+	w.recoveredEmitter.Close()
+	return nil
+}
+
+func (w *Watchdog) watch(ctx context.Context, p peer.ID, wp *watchedPeer) {
+	defer w.refCount.Done()
+
+	var s network.Stream
+	defer func() {
+		if s != nil {
+			s.Reset()
+		}
+	}()
+
+	var failures int
+	ticker := time.NewTicker(w.cfg.interval)
+	defer ticker.Stop()
+	for {
+		var rtt time.Duration
+		var err error
+		if s == nil {
+			s, err = w.newStream(ctx, p)
+		}
+		if err == nil {
+			rtt, err = w.ping(s)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			log.Debugw("watchdog ping failed", "peer", p, "error", err)
+			if s != nil {
+				s.Reset()
+				s = nil
+			}
+			failures++
+		} else {
+			w.host.Peerstore().RecordLatency(p, rtt)
+			failures = 0
+		}
+		w.updateStatus(p, wp, failures, err)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *Watchdog) newStream(ctx context.Context, p peer.ID) (network.Stream, error) {
+	ctx, cancel := context.WithTimeout(ctx, w.cfg.timeout)
+	defer cancel()
+	s, err := w.host.NewStream(network.WithUseTransient(ctx, "ping"), p, ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Scope().SetService(ServiceName); err != nil {
+		log.Debugf("error attaching stream to ping service: %s", err)
+		s.Reset()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (w *Watchdog) ping(s network.Stream) (time.Duration, error) {
+	if err := s.SetDeadline(time.Now().Add(w.cfg.timeout)); err != nil {
+		return 0, err
+	}
+	return ping(s, rand.Reader, w.cfg.payloadSize)
+}
+
+func (w *Watchdog) updateStatus(p peer.ID, wp *watchedPeer, failures int, err error) {
+	w.mx.Lock()
+	var suspected, recovered bool
+	if failures >= w.cfg.failureThreshold && !wp.suspected {
+		wp.suspected = true
+		suspected = true
+	} else if failures == 0 && wp.suspected {
+		wp.suspected = false
+		recovered = true
+	}
+	w.mx.Unlock()
+
+	if suspected {
+		log.Debugw("peer suspected to be unreachable", "peer", p, "failures", failures)
+		w.suspectedEmitter.Emit(event.EvtPeerSuspected{Peer: p, Failures: failures, Err: err})
+	}
+	if recovered {
+		w.recoveredEmitter.Emit(event.EvtPeerRecovered{Peer: p})
+	}
+}
@@ -2,6 +2,7 @@ package noise
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"math/rand"
 	"net"
@@ -249,3 +250,50 @@ func BenchmarkHandshakeXX(b *testing.B) {
 	env := setupEnv(b)
 	env.benchHandshake()
 }
+
+// benchMessages measures sending and receiving a single transport message of the given size,
+// reading it using a buffer of readBufSize bytes.
+func benchMessages(b *testing.B, size, readBufSize int) {
+	env := setupEnv(b)
+	initSession, respSession := env.connect(true)
+	defer initSession.Close()
+	defer respSession.Close()
+
+	msg := make([]byte, size)
+	rbuf := make([]byte, readBufSize)
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < b.N; i++ {
+			if _, err := initSession.Write(msg); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for read := 0; read < size*b.N; {
+		n, err := respSession.Read(rbuf)
+		if err != nil {
+			b.Fatal(err)
+		}
+		read += n
+	}
+	if err := <-done; err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkMessages(b *testing.B) {
+	for _, size := range []int{64, 1024, 16 << 10, MaxPlaintextLength} {
+		b.Run(fmt.Sprintf("%dB/large read buffer", size), func(b *testing.B) {
+			benchMessages(b, size, MaxTransportMsgLength)
+		})
+		b.Run(fmt.Sprintf("%dB/small read buffer", size), func(b *testing.B) {
+			benchMessages(b, size, 32)
+		})
+	}
+}
@@ -1,9 +1,141 @@
 package noise
 
 import (
+	"crypto/cipher"
+	"encoding/binary"
 	"errors"
+
+	"github.com/flynn/noise"
+	"golang.org/x/crypto/chacha20poly1305"
 )
 
+// chachaPolyFn is the ChaChaPoly cipher function. It is interoperable with noise.CipherChaChaPoly,
+// but the ciphers it creates don't allocate when encrypting and decrypting.
+type chachaPolyFn struct{}
+
+func (chachaPolyFn) Cipher(k [32]byte) noise.Cipher {
+	aead, err := chacha20poly1305.New(k[:])
+	if err != nil {
+		panic(err)
+	}
+	return &aeadCipher{aead: aead}
+}
+
+func (chachaPolyFn) CipherName() string { return "ChaChaPoly" }
+
+// aeadCipher is not safe for concurrent use.
+// Every cipher is only used for one direction of a session, under the respective lock.
+type aeadCipher struct {
+	aead  cipher.AEAD
+	nonce nonceBuffer
+}
+
+var _ noise.Cipher = &aeadCipher{}
+
+func (c *aeadCipher) Encrypt(out []byte, n uint64, ad, plaintext []byte) []byte {
+	return c.aead.Seal(out, c.nonce.set(n), plaintext, ad)
+}
+
+func (c *aeadCipher) Decrypt(out []byte, n uint64, ad, ciphertext []byte) ([]byte, error) {
+	return c.aead.Open(out, c.nonce.set(n), ciphertext, ad)
+}
+
+// nonceBuffer is reused for every message of a cipher. A nonce passed to the AEAD escapes to the heap,
+// so a local array would be allocated for every message.
+type nonceBuffer [chacha20poly1305.NonceSize]byte
+
+// set sets the nonce to the ChaChaPoly encoding of n.
+func (b *nonceBuffer) set(n uint64) []byte {
+	binary.LittleEndian.PutUint64(b[4:], n)
+	return b[:]
+}
+
+// cipherState is the state of one direction of an established session.
+// It works like noise.CipherState, but can keep the key, such that the session can be exported.
+type cipherState struct {
+	c noise.Cipher
+	// k is only set if session export is enabled
+	k *[32]byte
+	n uint64
+}
+
+func newCipherState(c noise.Cipher, n uint64) *cipherState {
+	return &cipherState{c: c, n: n}
+}
+
+// keepKey keeps a copy of the key k, allocated by allocKey.
+func (c *cipherState) keepKey(k [32]byte, locked bool) {
+	c.k = allocKey(locked)
+	*c.k = k
+}
+
+func (c *cipherState) Encrypt(out, ad, plaintext []byte) ([]byte, error) {
+	if c.c == nil {
+		return nil, errKeysWiped
+	}
+	if c.n > noise.MaxNonce {
+		return nil, noise.ErrMaxNonce
+	}
+	out = c.c.Encrypt(out, c.n, ad, plaintext)
+	c.n++
+	return out, nil
+}
+
+func (c *cipherState) Decrypt(out, ad, ciphertext []byte) ([]byte, error) {
+	if c.c == nil {
+		return nil, errKeysWiped
+	}
+	if c.n > noise.MaxNonce {
+		return nil, noise.ErrMaxNonce
+	}
+	out, err := c.c.Decrypt(out, c.n, ad, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	c.n++
+	return out, nil
+}
+
+// wipe releases the cipher and wipes the keys we own. Encrypt and Decrypt fail afterwards.
+func (c *cipherState) wipe() {
+	if wc, ok := c.c.(*wipingCipher); ok {
+		wc.wipe()
+	}
+	c.c = nil
+	if c.k != nil {
+		freeKey(c.k)
+		c.k = nil
+	}
+}
+
+// keyRecordingCipherSuite records the keys used to initialize ciphers.
+// Every cipher it creates is a keyedCipher, so the keys of the cipher states returned at the end
+// of the handshake can be taken from their ciphers.
+type keyRecordingCipherSuite struct {
+	noise.CipherSuite
+	ciphers []*keyedCipher
+}
+
+func (cs *keyRecordingCipherSuite) Cipher(k [32]byte) noise.Cipher {
+	c := &keyedCipher{Cipher: cs.CipherSuite.Cipher(k), key: k}
+	cs.ciphers = append(cs.ciphers, c)
+	return c
+}
+
+// wipe wipes the keys of all ciphers created during the handshake.
+func (cs *keyRecordingCipherSuite) wipe() {
+	for _, c := range cs.ciphers {
+		c.key = [32]byte{}
+	}
+	cs.ciphers = nil
+}
+
+// keyedCipher is a cipher created by the keyRecordingCipherSuite, together with its key.
+type keyedCipher struct {
+	noise.Cipher
+	key [32]byte
+}
+
 // encrypt calls the cipher's encryption. It encrypts the provided plaintext,
 // slice-appending the ciphertext on out.
 //
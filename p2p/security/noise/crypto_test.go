@@ -103,3 +103,32 @@ func TestCryptoFailsIfHandshakeIncomplete(t *testing.T) {
 		t.Error("expected decryption error when handshake incomplete")
 	}
 }
+
+func TestEncryptAndDecryptDontAllocate(t *testing.T) {
+	for _, keyWiping := range []bool{false, true} {
+		initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		initTransport.keyWiping = keyWiping
+		respTransport.keyWiping = keyWiping
+
+		initConn, respConn := connect(t, initTransport, respTransport)
+		defer initConn.Close()
+		defer respConn.Close()
+
+		plaintext := []byte("helloworld")
+		cbuf := make([]byte, 0, 128)
+		pbuf := make([]byte, 0, 128)
+		allocs := testing.AllocsPerRun(100, func() {
+			ciphertext, err := initConn.encrypt(cbuf, plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := respConn.decrypt(pbuf, ciphertext); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs != 0 {
+			t.Fatalf("expected no allocations (key wiping: %t), got %f", keyWiping, allocs)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package noise
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/p2p/security/noise/pb"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Downgrade protection
+//
+// The security protocol is negotiated using multistream-select before the connection is secured.
+// A man-in-the-middle can therefore make the peers pick a protocol other than the one they prefer,
+// e.g. by removing a protocol from the list proposed by the initiator.
+//
+// If the upgrader passes the negotiation to the handshake (see sec.WithNegotiation), both peers
+// send the negotiated security protocol and the security protocols they support, in order of
+// preference, in the NoiseExtensions. These are authenticated by the handshake. Every peer then checks:
+//  1. that the remote negotiated the same protocol, and
+//  2. that this protocol is the first of the initiator's protocols that the responder supports.
+//     This is the protocol an unmodified multistream-select negotiation results in.
+//
+// Peers that don't send the negotiation (e.g. peers that predate downgrade protection) are accepted.
+
+var errSecurityDowngrade = errors.New("noise: security protocol downgrade detected")
+
+// addNegotiationExtension adds the security protocol negotiation to ext, if the upgrader passed it to us.
+func (s *secureSession) addNegotiationExtension(ext *pb.NoiseExtensions) *pb.NoiseExtensions {
+	if s.negotiation == nil {
+		return ext
+	}
+	if ext == nil {
+		ext = &pb.NoiseExtensions{}
+	} else {
+		ext = proto.Clone(ext).(*pb.NoiseExtensions)
+	}
+	ext.SecurityProtocol = proto.String(string(s.negotiation.Protocol))
+	ext.SecurityProtocols = protocol.ConvertToStrings(s.negotiation.Supported)
+	return ext
+}
+
+// verifyNegotiation checks that the security protocol negotiation wasn't tampered with,
+// based on the negotiation sent by the remote peer.
+func (s *secureSession) verifyNegotiation(ext *pb.NoiseExtensions) error {
+	if s.negotiation == nil || ext.GetSecurityProtocol() == "" {
+		return nil
+	}
+	if remote := protocol.ID(ext.GetSecurityProtocol()); remote != s.negotiation.Protocol {
+		return fmt.Errorf("%w: negotiated %s, remote negotiated %s", errSecurityDowngrade, s.negotiation.Protocol, remote)
+	}
+	remoteSupported := ext.GetSecurityProtocols()
+	if len(remoteSupported) == 0 {
+		return nil
+	}
+	if len(remoteSupported) > maxProtoNum {
+		return fmt.Errorf("noise: remote sent too many security protocols: %d", len(remoteSupported))
+	}
+	// the initiator of the Noise handshake is the multistream-select client
+	initiatorProtos, responderProtos := s.negotiation.Supported, protocol.ConvertFromStrings(remoteSupported)
+	if !s.initiator {
+		initiatorProtos, responderProtos = responderProtos, initiatorProtos
+	}
+	if expected := matchMuxers(initiatorProtos, responderProtos); expected != s.negotiation.Protocol {
+		return fmt.Errorf("%w: negotiated %s, expected %s", errSecurityDowngrade, s.negotiation.Protocol, expected)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package noise
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/sec"
+
+	"github.com/stretchr/testify/require"
+)
+
+func handshakeWithNegotiation(t *testing.T, initNeg, respNeg *sec.Negotiation) (initErr, respErr error) {
+	t.Helper()
+	initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	init, resp := newConnPair(t)
+	defer init.Close()
+	defer resp.Close()
+
+	withNeg := func(n *sec.Negotiation) context.Context {
+		if n == nil {
+			return context.Background()
+		}
+		return sec.WithNegotiation(context.Background(), *n)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, initErr = initTransport.SecureOutbound(withNeg(initNeg), init, respTransport.localID)
+		if initErr != nil {
+			init.Close()
+		}
+	}()
+	_, respErr = respTransport.SecureInbound(withNeg(respNeg), resp, "")
+	if respErr != nil {
+		resp.Close()
+	}
+	<-done
+	return initErr, respErr
+}
+
+func TestNegotiationVerified(t *testing.T) {
+	initNeg := &sec.Negotiation{Protocol: ID, Supported: []protocol.ID{ID, "/tls/1.0.0"}}
+	respNeg := &sec.Negotiation{Protocol: ID, Supported: []protocol.ID{"/tls/1.0.0", ID}}
+	initErr, respErr := handshakeWithNegotiation(t, initNeg, respNeg)
+	require.NoError(t, initErr)
+	require.NoError(t, respErr)
+}
+
+func TestNegotiationDowngradeDetected(t *testing.T) {
+	// Both peers prefer TLS, but a MITM removed it from the initiator's proposals.
+	initNeg := &sec.Negotiation{Protocol: ID, Supported: []protocol.ID{"/tls/1.0.0", ID}}
+	respNeg := &sec.Negotiation{Protocol: ID, Supported: []protocol.ID{"/tls/1.0.0", ID}}
+	initErr, respErr := handshakeWithNegotiation(t, initNeg, respNeg)
+	require.ErrorIs(t, initErr, errSecurityDowngrade)
+	require.Error(t, respErr)
+}
+
+func TestNegotiationMismatchDetected(t *testing.T) {
+	initNeg := &sec.Negotiation{Protocol: ID, Supported: []protocol.ID{ID}}
+	respNeg := &sec.Negotiation{Protocol: "/noise-custom", Supported: []protocol.ID{"/noise-custom"}}
+	initErr, respErr := handshakeWithNegotiation(t, initNeg, respNeg)
+	require.ErrorIs(t, initErr, errSecurityDowngrade)
+	require.Error(t, respErr)
+}
+
+func TestNegotiationBackwardsCompatible(t *testing.T) {
+	neg := &sec.Negotiation{Protocol: ID, Supported: []protocol.ID{"/tls/1.0.0", ID}}
+	t.Run("initiator without negotiation", func(t *testing.T) {
+		initErr, respErr := handshakeWithNegotiation(t, nil, neg)
+		require.NoError(t, initErr)
+		require.NoError(t, respErr)
+	})
+	t.Run("responder without negotiation", func(t *testing.T) {
+		initErr, respErr := handshakeWithNegotiation(t, neg, nil)
+		require.NoError(t, initErr)
+		require.NoError(t, respErr)
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash"
 	"os"
@@ -11,21 +12,88 @@ import (
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/sec"
 	"github.com/libp2p/go-libp2p/p2p/security/noise/pb"
+	"github.com/libp2p/go-libp2p/p2p/tracinghelper"
 
 	"github.com/flynn/noise"
 	pool "github.com/libp2p/go-buffer-pool"
 	"github.com/minio/sha256-simd"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 )
 
+// tracerName is the name of the OpenTelemetry tracer of the Noise handshake.
+const tracerName = "github.com/libp2p/go-libp2p/p2p/security/noise"
+
 //go:generate protoc --go_out=. --go_opt=Mpb/payload.proto=./pb pb/payload.proto
 
 // payloadSigPrefix is prepended to our Noise static key before signing with
 // our libp2p identity key.
 const payloadSigPrefix = "noise-libp2p-static-key:"
 
+// Limits on the fields of the handshake payload sent by the remote peer.
+// They are enforced before the payload is unmarshaled, bounding the memory an
+// unauthenticated peer can make us allocate.
+const (
+	// maxIdentityKeySize is large enough for serialized RSA keys of up to 8192 bits.
+	maxIdentityKeySize = 2 << 10
+	// maxIdentitySigSize is large enough for signatures made with RSA keys of up to 8192 bits.
+	maxIdentitySigSize = 2 << 10
+	// maxExtensionsSize is the maximum size of the serialized NoiseExtensions.
+	maxExtensionsSize = 8 << 10
+	// maxUnknownFieldsSize is the maximum combined size of fields we don't know about.
+	maxUnknownFieldsSize = 1 << 10
+	// maxPaddingSize is the maximum size of the padding.
+	maxPaddingSize = 1 << 10
+	// maxEarlyDataSize is the maximum size of the application data we send in the NoiseExtensions.
+	// It is smaller than maxExtensionsSize, leaving room for the other extensions.
+	maxEarlyDataSize = 4 << 10
+
+	// maxHandshakeMsgLength is the maximum length of a handshake message:
+	// the ephemeral key, the encrypted static key, and the encrypted payload,
+	// with some slack for the protobuf field tags.
+	maxHandshakeMsgLength = 32 + 32 + 16 + maxIdentityKeySize + maxIdentitySigSize + maxExtensionsSize + maxUnknownFieldsSize + maxPaddingSize + 16 + 32
+)
+
+// field numbers of the NoiseHandshakePayload message
+const (
+	identityKeyField protowire.Number = 1
+	identitySigField protowire.Number = 2
+	extensionsField  protowire.Number = 4
+	versionField     protowire.Number = 5
+	paddingField     protowire.Number = 6
+)
+
+// Versions of the handshake payload format.
+//
+// Every peer sends the highest payload version it supports, and a session uses the lower
+// of the two versions. Payloads without a version field are version 0. This is what peers
+// that predate payload versioning send.
+//
+// The responder sends its payload before it learns the initiator's version. New payload
+// versions therefore have to follow these rules:
+//  1. Changes are additive. New information (e.g. a signature using a new prefix) is carried
+//     in new fields, which older peers ignore. Existing fields keep their meaning.
+//  2. The responder may send the fields of its version unconditionally, but must not require
+//     the initiator to send fields that are newer than the initiator's version.
+//  3. The initiator learns the responder's version before sending its payload. It only sends
+//     (and expects) fields of version N if the negotiated version is at least N.
+//  4. Payloads with a version higher than our own are accepted.
+const (
+	// payloadVersionLegacy is the version of payloads without a version field.
+	payloadVersionLegacy uint32 = 0
+	// payloadVersion1 adds the version field.
+	payloadVersion1 uint32 = 1
+
+	// currentPayloadVersion is the highest payload version we support.
+	currentPayloadVersion = payloadVersion1
+)
+
 type minioSHAFn struct{}
 
 func (h minioSHAFn) Hash() hash.Hash  { return sha256.New() }
@@ -33,12 +101,36 @@ func (h minioSHAFn) HashName() string { return "SHA256" }
 
 var shaHashFn noise.HashFunc = minioSHAFn{}
 
-// All noise session share a fixed cipher suite
-var cipherSuite = noise.NewCipherSuite(noise.DH25519, noise.CipherChaChaPoly, shaHashFn)
+// All noise session share a fixed cipher suite.
+var cipherSuite = noise.NewCipherSuite(noise.DH25519, chachaPolyFn{}, shaHashFn)
+
+// protocolName is the name of the Noise protocol, i.e. the handshake pattern and the cipher suite.
+var protocolName = "Noise_" + noise.HandshakeXX.Name + "_" + string(cipherSuite.Name())
 
 // runHandshake exchanges handshake messages with the remote peer to establish
 // a noise-libp2p session. It blocks until the handshake completes or fails.
 func (s *secureSession) runHandshake(ctx context.Context) (err error) {
+	if s.metricsTracer != nil {
+		start := time.Now()
+		// registered first, so that it runs after a panic has been converted into an error
+		defer func() {
+			s.metricsTracer.CompletedHandshake(s.initiator, s.connectionState.CipherSuite, time.Since(start), err)
+		}()
+	}
+	// The handshake is traced if the context carries a span that is being recorded, for example
+	// the span of the upgrader. Every handshake message is recorded as a stage of the handshake.
+	if parent := trace.SpanFromContext(ctx); parent.IsRecording() {
+		var span trace.Span
+		ctx, span = parent.TracerProvider().Tracer(tracerName).Start(ctx, "noise.handshake",
+			trace.WithAttributes(attribute.Bool("initiator", s.initiator)))
+		s.handshakeSpanCtx = ctx
+		// registered before the recover, like the metrics
+		defer func() {
+			s.endHandshakeStage(err)
+			s.handshakeSpanCtx = nil
+			tracinghelper.EndSpan(span, err)
+		}()
+	}
 	defer func() {
 		if rerr := recover(); rerr != nil {
 			fmt.Fprintf(os.Stderr, "caught panic: %s\n%s\n", rerr, debug.Stack())
@@ -46,9 +138,16 @@ func (s *secureSession) runHandshake(ctx context.Context) (err error) {
 		}
 	}()
 
-	kp, err := noise.DH25519.GenerateKeypair(rand.Reader)
-	if err != nil {
-		return fmt.Errorf("error generating static keypair: %w", err)
+	var kp noise.DHKey
+	if s.pipes != nil {
+		// Noise Pipes requires a static key that's stable across handshakes.
+		kp = s.pipes.static
+	} else {
+		kp, err = noise.DH25519.GenerateKeypair(rand.Reader)
+		if err != nil {
+			return fmt.Errorf("error generating static keypair: %w", err)
+		}
+		defer wipeBytes(kp.Private)
 	}
 
 	cfg := noise.Config{
@@ -58,10 +157,38 @@ func (s *secureSession) runHandshake(ctx context.Context) (err error) {
 		StaticKeypair: kp,
 		Prologue:      s.prologue,
 	}
+	hsSecrets := &handshakeCipherSuite{CipherSuite: cfg.CipherSuite, keyWiping: s.keyWiping}
+	cfg.CipherSuite = hsSecrets
+	if s.exportable {
+		s.keyRecorder = &keyRecordingCipherSuite{CipherSuite: cfg.CipherSuite}
+		cfg.CipherSuite = s.keyRecorder
+		defer func() {
+			s.keyRecorder.wipe()
+			s.keyRecorder = nil
+		}()
+	}
+	s.noiseInitiator = s.initiator
 
-	hs, err := noise.NewHandshakeState(cfg)
-	if err != nil {
-		return fmt.Errorf("error initializing handshake state: %w", err)
+	// Wipe the secrets that are only needed during the handshake.
+	defer func() {
+		hsSecrets.wipe(s.enc, s.dec)
+		if err == nil && s.enc != nil && s.dec != nil {
+			return
+		}
+		if s.enc != nil {
+			s.enc.wipe()
+		}
+		if s.dec != nil {
+			s.dec.wipe()
+		}
+	}()
+
+	if scope, ok := network.GetConnScope(ctx); ok {
+		s.handshakeScope = scope
+		defer func() { s.handshakeScope = nil }()
+	}
+	if n, ok := sec.GetNegotiation(ctx); ok {
+		s.negotiation = &n
 	}
 
 	// set a deadline to complete the handshake, if one has been supplied.
@@ -78,78 +205,134 @@ func (s *secureSession) runHandshake(ctx context.Context) (err error) {
 	defer pool.Put(hbuf)
 
 	if s.initiator {
-		// stage 0 //
-		// Handshake Msg Len = len(DH ephemeral key)
-		if err := s.sendHandshakeMessage(hs, nil, hbuf); err != nil {
-			return fmt.Errorf("error sending handshake message: %w", err)
+		if remoteStatic := s.pipes.remoteStatic(s.remoteID); remoteStatic != nil {
+			return s.runIKInitiator(ctx, cfg, remoteStatic, hbuf)
 		}
 
-		// stage 1 //
-		plaintext, err := s.readHandshakeMessage(hs)
+		hs, err := noise.NewHandshakeState(cfg)
 		if err != nil {
-			return fmt.Errorf("error reading handshake message: %w", err)
-		}
-		rcvdEd, err := s.handleRemoteHandshakePayload(plaintext, hs.PeerStatic())
-		if err != nil {
-			return err
-		}
-		if s.initiatorEarlyDataHandler != nil {
-			if err := s.initiatorEarlyDataHandler.Received(ctx, s.insecureConn, rcvdEd); err != nil {
-				return err
-			}
+			return fmt.Errorf("error initializing handshake state: %w", err)
 		}
 
-		// stage 2 //
-		// Handshake Msg Len = len(DHT static key) +  MAC(static key is encrypted) + len(Payload) + MAC(payload is encrypted)
-		var ed *pb.NoiseExtensions
-		if s.initiatorEarlyDataHandler != nil {
-			ed = s.initiatorEarlyDataHandler.Send(ctx, s.insecureConn, s.remoteID)
-		}
-		payload, err := s.generateHandshakePayload(kp, ed)
-		if err != nil {
-			return err
-		}
-		if err := s.sendHandshakeMessage(hs, payload, hbuf); err != nil {
+		// stage 0 //
+		// Handshake Msg Len = len(DH ephemeral key)
+		if err := s.sendHandshakeMessage(hs, nil, hbuf); err != nil {
 			return fmt.Errorf("error sending handshake message: %w", err)
 		}
-		return nil
+
+		// stage 1 and 2 //
+		return s.finishInitiatorHandshake(ctx, hs, kp, hbuf)
 	} else {
 		// stage 0 //
-		if _, err := s.readHandshakeMessage(hs); err != nil {
+		msg, release, err := s.readRawHandshakeMessage()
+		if err != nil {
 			return fmt.Errorf("error reading handshake message: %w", err)
 		}
-
-		// stage 1 //
-		// Handshake Msg Len = len(DH ephemeral key) + len(DHT static key) +  MAC(static key is encrypted) + len(Payload) +
-		// MAC(payload is encrypted)
-		var ed *pb.NoiseExtensions
-		if s.responderEarlyDataHandler != nil {
-			ed = s.responderEarlyDataHandler.Send(ctx, s.insecureConn, s.remoteID)
+		if s.pipes != nil && len(msg) > noise.DH25519.DHLen() {
+			// The first message of the XX handshake only contains the ephemeral key.
+			defer release()
+			return s.runIKResponder(ctx, cfg, msg, hbuf)
 		}
-		payload, err := s.generateHandshakePayload(kp, ed)
+
+		hs, err := noise.NewHandshakeState(cfg)
 		if err != nil {
-			return err
+			release()
+			return fmt.Errorf("error initializing handshake state: %w", err)
 		}
-		if err := s.sendHandshakeMessage(hs, payload, hbuf); err != nil {
-			return fmt.Errorf("error sending handshake message: %w", err)
-		}
-
-		// stage 2 //
-		plaintext, err := s.readHandshakeMessage(hs)
+		_, err = s.processHandshakeMessage(hs, msg)
+		release()
 		if err != nil {
 			return fmt.Errorf("error reading handshake message: %w", err)
 		}
-		rcvdEd, err := s.handleRemoteHandshakePayload(plaintext, hs.PeerStatic())
-		if err != nil {
+
+		// stage 1 and 2 //
+		return s.finishResponderHandshake(ctx, hs, kp, hbuf)
+	}
+}
+
+// finishInitiatorHandshake reads the responder's payload, and sends our payload.
+// It is used after the first message of the XX handshake.
+func (s *secureSession) finishInitiatorHandshake(ctx context.Context, hs *noise.HandshakeState, kp noise.DHKey, hbuf []byte) error {
+	plaintext, err := s.readHandshakeMessage(hs)
+	if err != nil {
+		return fmt.Errorf("error reading handshake message: %w", err)
+	}
+	if err := s.handleRemotePayload(ctx, plaintext, hs.PeerStatic()); err != nil {
+		return err
+	}
+
+	// Handshake Msg Len = len(DHT static key) +  MAC(static key is encrypted) + len(Payload) + MAC(payload is encrypted)
+	payload, err := s.generateOurPayload(ctx, kp)
+	if err != nil {
+		return err
+	}
+	if err := s.sendHandshakeMessage(hs, payload, hbuf); err != nil {
+		return fmt.Errorf("error sending handshake message: %w", err)
+	}
+	return nil
+}
+
+// finishResponderHandshake sends our payload, and reads the initiator's payload.
+// It is used after the first message of the XX handshake.
+func (s *secureSession) finishResponderHandshake(ctx context.Context, hs *noise.HandshakeState, kp noise.DHKey, hbuf []byte) error {
+	// Handshake Msg Len = len(DH ephemeral key) + len(DHT static key) +  MAC(static key is encrypted) + len(Payload) +
+	// MAC(payload is encrypted)
+	payload, err := s.generateOurPayload(ctx, kp)
+	if err != nil {
+		return err
+	}
+	if err := s.sendHandshakeMessage(hs, payload, hbuf); err != nil {
+		return fmt.Errorf("error sending handshake message: %w", err)
+	}
+
+	plaintext, err := s.readHandshakeMessage(hs)
+	if err != nil {
+		return fmt.Errorf("error reading handshake message: %w", err)
+	}
+	return s.handleRemotePayload(ctx, plaintext, hs.PeerStatic())
+}
+
+// earlyDataHandler returns the early data handler for our role.
+func (s *secureSession) earlyDataHandler() EarlyDataHandler {
+	if s.initiator {
+		return s.initiatorEarlyDataHandler
+	}
+	return s.responderEarlyDataHandler
+}
+
+// generateOurPayload generates our handshake payload, including the extensions.
+func (s *secureSession) generateOurPayload(ctx context.Context, kp noise.DHKey) ([]byte, error) {
+	var ed *pb.NoiseExtensions
+	if edh := s.earlyDataHandler(); edh != nil {
+		ed = edh.Send(ctx, s.insecureConn, s.remoteID)
+	}
+	if s.ik && s.noiseInitiator {
+		// This is the first IK message, which can be replayed.
+		ed = withoutEarlyData(ed)
+	}
+	return s.generateHandshakePayload(kp, s.addPipesExtension(s.addPaddingExtension(s.addNegotiationExtension(ed))))
+}
+
+// handleRemotePayload processes the remote peer's handshake payload, including the extensions.
+func (s *secureSession) handleRemotePayload(ctx context.Context, plaintext, remoteStatic []byte) error {
+	rcvdEd, err := s.handleRemoteHandshakePayload(plaintext, remoteStatic)
+	if err != nil {
+		return err
+	}
+	if s.ik && !s.noiseInitiator {
+		// This is the first IK message, which might be a replay.
+		rcvdEd = withoutEarlyData(rcvdEd)
+	}
+	if edh := s.earlyDataHandler(); edh != nil {
+		if err := edh.Received(ctx, s.insecureConn, rcvdEd); err != nil {
 			return err
 		}
-		if s.responderEarlyDataHandler != nil {
-			if err := s.responderEarlyDataHandler.Received(ctx, s.insecureConn, rcvdEd); err != nil {
-				return err
-			}
-		}
-		return nil
 	}
+	if err := s.verifyNegotiation(rcvdEd); err != nil {
+		return err
+	}
+	s.handlePipesExtension(rcvdEd, remoteStatic)
+	return s.negotiatePadding(rcvdEd)
 }
 
 // setCipherStates sets the initial cipher states that will be used to protect
@@ -158,21 +341,37 @@ func (s *secureSession) runHandshake(ctx context.Context) (err error) {
 // It is called when the final handshake message is processed by
 // either sendHandshakeMessage or readHandshakeMessage.
 func (s *secureSession) setCipherStates(cs1, cs2 *noise.CipherState) {
-	if s.initiator {
-		s.enc = cs1
-		s.dec = cs2
+	c1 := s.newCipherState(cs1)
+	c2 := s.newCipherState(cs2)
+	if s.noiseInitiator {
+		s.enc = c1
+		s.dec = c2
 	} else {
-		s.enc = cs2
-		s.dec = cs1
+		s.enc = c2
+		s.dec = c1
 	}
 }
 
+// newCipherState creates the cipherState for a cipher state returned at the end of the handshake.
+// If session export is enabled, it keeps the key of the cipher.
+func (s *secureSession) newCipherState(cs *noise.CipherState) *cipherState {
+	kc, ok := cs.Cipher().(*keyedCipher)
+	if !ok {
+		return newCipherState(cs.Cipher(), cs.Nonce())
+	}
+	c := newCipherState(kc.Cipher, cs.Nonce())
+	// The keys are only wiped with key wiping, so only allocate them in locked memory then.
+	c.keepKey(kc.key, s.keyWiping)
+	return c
+}
+
 // sendHandshakeMessage sends the next handshake message in the sequence.
 //
 // If payload is non-empty, it will be included in the handshake message.
 // If this is the final message in the sequence, calls setCipherStates
 // to initialize cipher states.
 func (s *secureSession) sendHandshakeMessage(hs *noise.HandshakeState, payload []byte, hbuf []byte) error {
+	s.startHandshakeStage()
 	// the first two bytes will be the length of the noise handshake message.
 	bz, cs1, cs2, err := hs.WriteMessage(hbuf[:LengthPrefixLength], payload)
 	if err != nil {
@@ -194,6 +393,27 @@ func (s *secureSession) sendHandshakeMessage(hs *noise.HandshakeState, payload [
 	return nil
 }
 
+// startHandshakeStage ends the span of the previous handshake stage, if any, and starts the span
+// of the next one. The stages are numbered like the handshake messages, starting at 0.
+func (s *secureSession) startHandshakeStage() {
+	if s.handshakeSpanCtx == nil {
+		return
+	}
+	s.endHandshakeStage(nil)
+	_, s.stageSpan = trace.SpanFromContext(s.handshakeSpanCtx).TracerProvider().Tracer(tracerName).
+		Start(s.handshakeSpanCtx, fmt.Sprintf("noise.stage%d", s.stage))
+	s.stage++
+}
+
+// endHandshakeStage ends the span of the current handshake stage, if any.
+func (s *secureSession) endHandshakeStage(err error) {
+	if s.stageSpan == nil {
+		return
+	}
+	tracinghelper.EndSpan(s.stageSpan, err)
+	s.stageSpan = nil
+}
+
 // readHandshakeMessage reads a message from the insecure conn and tries to
 // process it as the expected next message in the handshake sequence.
 //
@@ -202,51 +422,95 @@ func (s *secureSession) sendHandshakeMessage(hs *noise.HandshakeState, payload [
 // If this is the final message in the sequence, it calls setCipherStates
 // to initialize cipher states.
 func (s *secureSession) readHandshakeMessage(hs *noise.HandshakeState) ([]byte, error) {
-	l, err := s.readNextInsecureMsgLen()
+	msg, release, err := s.readRawHandshakeMessage()
 	if err != nil {
 		return nil, err
 	}
+	defer release()
+	return s.processHandshakeMessage(hs, msg)
+}
+
+// readRawHandshakeMessage reads a message from the insecure conn, without processing it.
+// The message is taken from the pool, release must be called once it's not needed any more.
+func (s *secureSession) readRawHandshakeMessage() (msg []byte, release func(), err error) {
+	s.startHandshakeStage()
+	l, err := s.readNextInsecureMsgLen()
+	if err != nil {
+		return nil, nil, err
+	}
+	if l > maxHandshakeMsgLength {
+		return nil, nil, fmt.Errorf("handshake message too large: %d bytes", l)
+	}
 
-	buf := pool.Get(l)
-	defer pool.Put(buf)
+	// The peer is not authenticated yet. Account for the memory in the connection's scope.
+	scope := s.handshakeScope
+	if scope != nil {
+		if err := scope.ReserveMemory(l, network.ReservationPriorityMedium); err != nil {
+			return nil, nil, fmt.Errorf("failed to reserve memory for handshake message: %w", err)
+		}
+	}
 
+	buf := pool.Get(l)
+	release = func() {
+		pool.Put(buf)
+		if scope != nil {
+			scope.ReleaseMemory(l)
+		}
+	}
 	if err := s.readNextMsgInsecure(buf); err != nil {
-		return nil, err
+		release()
+		return nil, nil, err
 	}
+	return buf, release, nil
+}
 
-	msg, cs1, cs2, err := hs.ReadMessage(nil, buf)
+// processHandshakeMessage processes msg as the next message in the handshake sequence,
+// and returns the decrypted payload.
+//
+// If this is the final message in the sequence, it calls setCipherStates
+// to initialize cipher states.
+func (s *secureSession) processHandshakeMessage(hs *noise.HandshakeState, msg []byte) ([]byte, error) {
+	payload, cs1, cs2, err := hs.ReadMessage(nil, msg)
 	if err != nil {
 		return nil, err
 	}
 	if cs1 != nil && cs2 != nil {
 		s.setCipherStates(cs1, cs2)
 	}
-	return msg, nil
+	return payload, nil
 }
 
 // generateHandshakePayload creates a libp2p handshake payload with a
 // signature of our static noise key.
 func (s *secureSession) generateHandshakePayload(localStatic noise.DHKey, ext *pb.NoiseExtensions) ([]byte, error) {
-	// obtain the public key from the handshake session, so we can sign it with
-	// our libp2p secret key.
-	localKeyRaw, err := crypto.MarshalPublicKey(s.LocalPublicKey())
-	if err != nil {
-		return nil, fmt.Errorf("error serializing libp2p identity key: %w", err)
+	if l := len(ext.GetEarlyData()); l > maxEarlyDataSize {
+		return nil, fmt.Errorf("early data too large: %d bytes", l)
 	}
 
-	// prepare payload to sign; perform signature.
-	toSign := append([]byte(payloadSigPrefix), localStatic.Public...)
-	signedPayload, err := s.localKey.Sign(toSign)
-	if err != nil {
-		return nil, fmt.Errorf("error sigining handshake payload: %w", err)
-	}
+	nhp := &pb.NoiseHandshakePayload{Extensions: ext}
+	// Anonymous initiators send neither an identity key nor a signature.
+	if !(s.initiator && s.anonymousInitiator) {
+		// obtain the public key from the handshake session, so we can sign it with
+		// our libp2p secret key.
+		localKeyRaw, err := crypto.MarshalPublicKey(s.LocalPublicKey())
+		if err != nil {
+			return nil, fmt.Errorf("error serializing libp2p identity key: %w", err)
+		}
 
-	// create payload
-	payloadEnc, err := proto.Marshal(&pb.NoiseHandshakePayload{
-		IdentityKey: localKeyRaw,
-		IdentitySig: signedPayload,
-		Extensions:  ext,
-	})
+		// prepare payload to sign; perform signature.
+		toSign := append([]byte(payloadSigPrefix), localStatic.Public...)
+		signedPayload, err := s.localKey.Sign(toSign)
+		if err != nil {
+			return nil, fmt.Errorf("error sigining handshake payload: %w", err)
+		}
+		nhp.IdentityKey = localKeyRaw
+		nhp.IdentitySig = signedPayload
+	}
+	if s.localPayloadVersion != payloadVersionLegacy {
+		nhp.Version = &s.localPayloadVersion
+	}
+	s.padHandshakePayload(nhp)
+	payloadEnc, err := proto.Marshal(nhp)
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling handshake payload: %w", err)
 	}
@@ -257,6 +521,10 @@ func (s *secureSession) generateHandshakePayload(localStatic noise.DHKey, ext *p
 // by the remote peer and validates the signature against the peer's static Noise key.
 // It returns the data attached to the payload.
 func (s *secureSession) handleRemoteHandshakePayload(payload []byte, remoteStatic []byte) (*pb.NoiseExtensions, error) {
+	if err := checkHandshakePayloadSize(payload); err != nil {
+		return nil, err
+	}
+
 	// unmarshal payload
 	nhp := new(pb.NoiseHandshakePayload)
 	err := proto.Unmarshal(payload, nhp)
@@ -264,11 +532,22 @@ func (s *secureSession) handleRemoteHandshakePayload(payload []byte, remoteStati
 		return nil, fmt.Errorf("error unmarshaling remote handshake payload: %w", err)
 	}
 
+	if !s.initiator && len(nhp.GetIdentityKey()) == 0 && len(nhp.GetIdentitySig()) == 0 {
+		if err := s.acceptAnonymousInitiator(); err != nil {
+			return nil, err
+		}
+		s.remotePayloadVersion = nhp.GetVersion()
+		return nhp.Extensions, nil
+	}
+
 	// unpack remote peer's public libp2p key
 	remotePubKey, err := crypto.UnmarshalPublicKey(nhp.GetIdentityKey())
 	if err != nil {
 		return nil, err
 	}
+	if err := s.keyPolicy.Check(remotePubKey); err != nil {
+		return nil, err
+	}
 	id, err := peer.IDFromPublicKey(remotePubKey)
 	if err != nil {
 		return nil, err
@@ -292,5 +571,91 @@ func (s *secureSession) handleRemoteHandshakePayload(payload []byte, remoteStati
 	// set remote peer key and id
 	s.remoteID = id
 	s.remoteKey = remotePubKey
+	s.remotePayloadVersion = nhp.GetVersion()
 	return nhp.Extensions, nil
 }
+
+// acceptAnonymousInitiator checks if we accept an initiator that didn't prove its identity,
+// and assigns it a synthetic identity.
+func (s *secureSession) acceptAnonymousInitiator() error {
+	if !s.allowAnonymous {
+		return errors.New("anonymous initiators not accepted")
+	}
+	if s.checkPeerID {
+		return fmt.Errorf("peer id mismatch: expected %s, but remote is anonymous", s.remoteID)
+	}
+	_, pub, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("error generating synthetic identity: %w", err)
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	s.remoteID = id
+	s.remoteKey = pub
+	s.anonymous = true
+	return nil
+}
+
+// payloadVersion returns the payload version used by the session, i.e. the lower of our payload
+// version and the remote's. It must only be called after the remote's handshake payload was processed.
+func (s *secureSession) payloadVersion() uint32 {
+	if s.remotePayloadVersion < s.localPayloadVersion {
+		return s.remotePayloadVersion
+	}
+	return s.localPayloadVersion
+}
+
+// checkHandshakePayloadSize checks the size of the fields of a serialized handshake payload,
+// without unmarshaling it.
+func checkHandshakePayloadSize(payload []byte) error {
+	var keySize, sigSize, extSize, paddingSize, unknownSize int
+	for len(payload) > 0 {
+		num, typ, n := protowire.ConsumeTag(payload)
+		if n < 0 {
+			return fmt.Errorf("error parsing remote handshake payload: %w", protowire.ParseError(n))
+		}
+		payload = payload[n:]
+		n = protowire.ConsumeFieldValue(num, typ, payload)
+		if n < 0 {
+			return fmt.Errorf("error parsing remote handshake payload: %w", protowire.ParseError(n))
+		}
+		payload = payload[n:]
+
+		// The version is a varint, and is unmarshaled without allocating.
+		// With any other wire type, it is kept as an unknown field.
+		if num == versionField && typ == protowire.VarintType {
+			continue
+		}
+
+		switch num {
+		case identityKeyField:
+			keySize += n
+			if keySize > maxIdentityKeySize {
+				return fmt.Errorf("identity key in handshake payload too large: %d bytes", keySize)
+			}
+		case identitySigField:
+			sigSize += n
+			if sigSize > maxIdentitySigSize {
+				return fmt.Errorf("identity signature in handshake payload too large: %d bytes", sigSize)
+			}
+		case extensionsField:
+			extSize += n
+			if extSize > maxExtensionsSize {
+				return fmt.Errorf("extensions in handshake payload too large: %d bytes", extSize)
+			}
+		case paddingField:
+			paddingSize += n
+			if paddingSize > maxPaddingSize {
+				return fmt.Errorf("padding in handshake payload too large: %d bytes", paddingSize)
+			}
+		default:
+			unknownSize += n
+			if unknownSize > maxUnknownFieldsSize {
+				return fmt.Errorf("unknown fields in handshake payload too large: %d bytes", unknownSize)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package noise
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/p2p/metricshelper"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricNamespace = "libp2p_noise"
+
+var (
+	handshakeDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricNamespace,
+			Name:      "handshake_duration_seconds",
+			Help:      "Duration of the Noise handshake",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 1.3, 35),
+		},
+		[]string{"role", "protocol", "outcome"},
+	)
+	collectors = []prometheus.Collector{
+		handshakeDuration,
+	}
+)
+
+// MetricsTracer tracks Noise handshakes.
+type MetricsTracer interface {
+	// CompletedHandshake is called when a handshake completes, successfully or not.
+	// protocol is the Noise protocol name, e.g. Noise_XX_25519_ChaChaPoly_SHA256.
+	CompletedHandshake(initiator bool, protocol string, d time.Duration, err error)
+}
+
+type metricsTracer struct{}
+
+var _ MetricsTracer = &metricsTracer{}
+
+type metricsTracerSetting struct {
+	reg prometheus.Registerer
+}
+
+type MetricsTracerOption func(*metricsTracerSetting)
+
+func WithRegisterer(reg prometheus.Registerer) MetricsTracerOption {
+	return func(s *metricsTracerSetting) {
+		if reg != nil {
+			s.reg = reg
+		}
+	}
+}
+
+func NewMetricsTracer(opts ...MetricsTracerOption) MetricsTracer {
+	setting := &metricsTracerSetting{reg: prometheus.DefaultRegisterer}
+	for _, opt := range opts {
+		opt(setting)
+	}
+	metricshelper.RegisterCollectors(setting.reg, collectors...)
+	return &metricsTracer{}
+}
+
+func (m *metricsTracer) CompletedHandshake(initiator bool, protocol string, d time.Duration, err error) {
+	tags := metricshelper.GetStringSlice()
+	defer metricshelper.PutStringSlice(tags)
+
+	if initiator {
+		*tags = append(*tags, "initiator")
+	} else {
+		*tags = append(*tags, "responder")
+	}
+	*tags = append(*tags, protocol)
+	if err == nil {
+		*tags = append(*tags, "success")
+	} else {
+		*tags = append(*tags, "failure")
+	}
+	handshakeDuration.WithLabelValues(*tags...).Observe(d.Seconds())
+}
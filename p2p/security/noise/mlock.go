@@ -0,0 +1,14 @@
+//go:build !noise_mlock || !(linux || darwin || freebsd)
+
+package noise
+
+// allocKey allocates a key on the Go heap. Build with the noise_mlock build tag to allocate keys in
+// locked memory if locked is set.
+func allocKey(locked bool) *[32]byte {
+	return new([32]byte)
+}
+
+// freeKey wipes k.
+func freeKey(k *[32]byte) {
+	wipeBytes(k[:])
+}
@@ -0,0 +1,85 @@
+//go:build noise_mlock && (linux || darwin || freebsd)
+
+package noise
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// With the noise_mlock build tag, the session keys owned by this package (the keys of the ciphers
+// used with key wiping, and the keys kept for session export) are allocated outside of the Go heap,
+// in memory mapped using mmap(2) and locked using mlock(2). This memory is never moved or copied by
+// the Go runtime, and it is never swapped to disk, so wiping a key removes the only copy we own.
+// Locking requires the memory lock limit (RLIMIT_MEMLOCK) to be large enough, a 4 KiB page holds
+// 128 keys. If memory can't be mapped or locked, this is logged, and the keys are allocated on the
+// Go heap.
+//
+// Without key wiping, the ChaCha20-Poly1305 ciphers keep their own copy of the key on the Go heap.
+// The handshake secrets are always allocated by the Noise library.
+
+var warnLockFailedOnce sync.Once
+
+const keySize = 32
+
+var lockedKeys struct {
+	sync.Mutex
+	// free are the unused keys on the locked pages
+	free []*[keySize]byte
+	// used are the keys handed out by allocKey
+	used map[*[keySize]byte]struct{}
+}
+
+// allocLockedPage maps a page, locks it, and adds its keys to the free list.
+func allocLockedPage() error {
+	pageSize := os.Getpagesize()
+	page, err := syscall.Mmap(-1, 0, pageSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return err
+	}
+	if err := syscall.Mlock(page); err != nil {
+		syscall.Munmap(page)
+		return err
+	}
+	for i := 0; i+keySize <= len(page); i += keySize {
+		lockedKeys.free = append(lockedKeys.free, (*[keySize]byte)(unsafe.Pointer(&page[i])))
+	}
+	return nil
+}
+
+// allocKey allocates a key. If locked is set, the key is allocated in locked memory. It must be
+// freed using freeKey.
+// The pages are never unmapped, since the number of concurrent sessions is limited.
+func allocKey(locked bool) *[keySize]byte {
+	if !locked {
+		return new([keySize]byte)
+	}
+	lockedKeys.Lock()
+	defer lockedKeys.Unlock()
+	if len(lockedKeys.free) == 0 {
+		if err := allocLockedPage(); err != nil {
+			warnLockFailedOnce.Do(func() { log.Warnw("failed to lock memory, keys might be swapped to disk", "error", err) })
+			return new([keySize]byte)
+		}
+	}
+	if lockedKeys.used == nil {
+		lockedKeys.used = make(map[*[keySize]byte]struct{})
+	}
+	k := lockedKeys.free[len(lockedKeys.free)-1]
+	lockedKeys.free = lockedKeys.free[:len(lockedKeys.free)-1]
+	lockedKeys.used[k] = struct{}{}
+	return k
+}
+
+// freeKey wipes k. If it was allocated in locked memory, the memory is reused for other keys.
+func freeKey(k *[keySize]byte) {
+	wipeBytes(k[:])
+	lockedKeys.Lock()
+	defer lockedKeys.Unlock()
+	if _, ok := lockedKeys.used[k]; ok {
+		delete(lockedKeys.used, k)
+		lockedKeys.free = append(lockedKeys.free, k)
+	}
+}
@@ -0,0 +1,34 @@
+//go:build noise_mlock && (linux || darwin || freebsd)
+
+package noise
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocLockedKey(t *testing.T) {
+	k := allocKey(true)
+	lockedKeys.Lock()
+	_, ok := lockedKeys.used[k]
+	lockedKeys.Unlock()
+	if !ok {
+		t.Skip("failed to lock memory, RLIMIT_MEMLOCK too low?")
+	}
+	k[0] = 42
+	freeKey(k)
+	require.Equal(t, [32]byte{}, *k)
+	lockedKeys.Lock()
+	_, ok = lockedKeys.used[k]
+	lockedKeys.Unlock()
+	require.False(t, ok)
+	// the memory is reused
+	require.Same(t, k, allocKey(true))
+
+	// keys that don't need to be locked are allocated on the heap, but still wiped
+	h := allocKey(false)
+	h[0] = 42
+	freeKey(h)
+	require.Equal(t, [32]byte{}, *h)
+}
@@ -0,0 +1,249 @@
+package noise
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/libp2p/go-libp2p/p2p/security/noise/pb"
+
+	pool "github.com/libp2p/go-buffer-pool"
+	"golang.org/x/crypto/chacha20poly1305"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// PaddingScheme is a scheme used to pad the messages of a session, hiding their exact length
+// from an observer of the connection.
+//
+// Padding is negotiated during the handshake, using the NoiseExtensions:
+//  1. The responder sends all the schemes it supports.
+//  2. The initiator picks the first of its own schemes that the responder supports, and sends it
+//     as the only scheme. If there is no such scheme, it sends none.
+//  3. The responder fails the handshake if the initiator sends a scheme it doesn't support, or
+//     more than one scheme.
+//
+// With the IK handshake (see pipes.go), the initiator sends its payload first, so the roles
+// of the initiator and the responder are swapped.
+//
+// If a scheme was negotiated, the plaintext of every transport message consists of the length
+// of the data as a 16-bit big-endian integer, the data, and zero bytes up to the padded length.
+// Handshake payloads are padded by every peer that enables padding, independently of the negotiation.
+type PaddingScheme string
+
+const (
+	// PaddingPadme pads messages using the Padmé scheme: a message of length L is padded such that
+	// only its O(log log L) most significant bits may be non-zero. This leaks at most O(log log L)
+	// bits of information about the length, with an overhead of at most 12%.
+	// See https://lbarman.ch/blog/padme/ for details.
+	PaddingPadme PaddingScheme = "padme"
+	// PaddingBuckets pads messages to the next power of two, and to at least 256 bytes.
+	// It leaks less information about the length than PaddingPadme, at the cost of up to 100% overhead.
+	PaddingBuckets PaddingScheme = "buckets"
+)
+
+// minPaddingBucket is the smallest size messages are padded to by PaddingBuckets.
+const minPaddingBucket = 256
+
+// maxHandshakePaddingSize is the maximum size of the padding of a handshake payload.
+// It is chosen such that the padding doesn't exceed the limit on unknown fields
+// applied by peers that don't support padding.
+const maxHandshakePaddingSize = maxUnknownFieldsSize - 8
+
+// paddingHeaderLength is the length of the length prefix of the data in a padded transport message.
+const paddingHeaderLength = 2
+
+// maxPaddedDataLength is the maximum amount of data in a padded transport message.
+const maxPaddedDataLength = MaxPlaintextLength - paddingHeaderLength
+
+var errInvalidPadding = errors.New("noise: invalid padding")
+
+// WithPadding enables padding of handshake and transport messages, to resist traffic analysis
+// based on message sizes. The schemes are given in order of preference. Transport messages
+// are only padded if both peers enable padding and support a common scheme.
+//
+// Padding increases the bandwidth used by the connection. It doesn't hide the timing of
+// messages, nor the total amount of data transferred.
+func WithPadding(schemes ...PaddingScheme) Option {
+	return func(t *Transport) error {
+		if len(schemes) == 0 {
+			return errors.New("noise: no padding scheme")
+		}
+		for _, s := range schemes {
+			if !s.valid() {
+				return fmt.Errorf("noise: unknown padding scheme: %q", s)
+			}
+		}
+		t.padding = schemes
+		return nil
+	}
+}
+
+func (p PaddingScheme) valid() bool {
+	return p == PaddingPadme || p == PaddingBuckets
+}
+
+// paddedLength returns the length a message of length l is padded to.
+func (p PaddingScheme) paddedLength(l int) int {
+	switch p {
+	case PaddingPadme:
+		if l < 2 {
+			return l
+		}
+		e := bits.Len(uint(l)) - 1
+		s := bits.Len(uint(e))
+		mask := 1<<(e-s) - 1
+		return (l + mask) &^ mask
+	case PaddingBuckets:
+		if l <= minPaddingBucket {
+			return minPaddingBucket
+		}
+		return 1 << bits.Len(uint(l-1))
+	default:
+		return l
+	}
+}
+
+// selectsPadding returns true if we select the padding scheme, i.e. if we send our payload last.
+// This is the initiator, unless the IK handshake is used (see pipes.go).
+func (s *secureSession) selectsPadding() bool {
+	return s.initiator != s.ik
+}
+
+// paddingExtension returns the padding schemes we send in our NoiseExtensions.
+// The peer that sends its payload last sends the negotiated scheme, so it must only
+// call this after processing the remote peer's extensions.
+func (s *secureSession) paddingExtension() []string {
+	if s.selectsPadding() {
+		if s.padding == "" {
+			return nil
+		}
+		return []string{string(s.padding)}
+	}
+	schemes := make([]string, 0, len(s.localPadding))
+	for _, p := range s.localPadding {
+		schemes = append(schemes, string(p))
+	}
+	return schemes
+}
+
+// addPaddingExtension returns ext with our padding schemes added.
+// ext is owned by the early data handler, so it is copied if it needs to be modified.
+func (s *secureSession) addPaddingExtension(ext *pb.NoiseExtensions) *pb.NoiseExtensions {
+	schemes := s.paddingExtension()
+	if len(schemes) == 0 {
+		return ext
+	}
+	if ext == nil {
+		ext = &pb.NoiseExtensions{}
+	} else {
+		ext = proto.Clone(ext).(*pb.NoiseExtensions)
+	}
+	ext.PaddingSchemes = schemes
+	return ext
+}
+
+// negotiatePadding sets the padding scheme used for transport messages, based on the
+// padding schemes sent by the remote peer.
+func (s *secureSession) negotiatePadding(ext *pb.NoiseExtensions) error {
+	remote := ext.GetPaddingSchemes()
+	if s.selectsPadding() {
+		for _, p := range s.localPadding {
+			for _, r := range remote {
+				if string(p) == r {
+					s.padding = p
+					return nil
+				}
+			}
+		}
+		return nil
+	}
+	switch len(remote) {
+	case 0:
+		return nil
+	case 1:
+		for _, p := range s.localPadding {
+			if string(p) == remote[0] {
+				s.padding = p
+				return nil
+			}
+		}
+		return fmt.Errorf("noise: remote selected unsupported padding scheme: %q", remote[0])
+	default:
+		return fmt.Errorf("noise: remote selected %d padding schemes", len(remote))
+	}
+}
+
+// padHandshakePayload adds padding to nhp, such that its serialized length is padded using
+// our preferred padding scheme. The padding is limited to maxHandshakePaddingSize.
+func (s *secureSession) padHandshakePayload(nhp *pb.NoiseHandshakePayload) {
+	if len(s.localPadding) == 0 {
+		return
+	}
+	size := proto.Size(nhp)
+	// An empty padding field takes two bytes: the tag, and the length.
+	need := s.localPadding[0].paddedLength(size+2) - size
+	// Find the longest padding that fits.
+	l := need - 2
+	if l > maxHandshakePaddingSize {
+		l = maxHandshakePaddingSize
+	}
+	for l > 0 && protowire.SizeTag(paddingField)+protowire.SizeBytes(l) > need {
+		l--
+	}
+	nhp.Padding = make([]byte, l)
+}
+
+// writePadded encrypts and sends data, using padded transport messages.
+// It must be called with the write lock held.
+func (s *secureSession) writePadded(data []byte) (int, error) {
+	pbuf := pool.Get(MaxPlaintextLength)
+	defer pool.Put(pbuf)
+	cbuf := pool.Get(MaxTransportMsgLength + LengthPrefixLength)
+	defer pool.Put(cbuf)
+
+	var written int
+	for written < len(data) {
+		end := written + maxPaddedDataLength
+		if end > len(data) {
+			end = len(data)
+		}
+
+		l := s.padding.paddedLength(paddingHeaderLength+end-written+chacha20poly1305.Overhead) - chacha20poly1305.Overhead
+		if l > MaxPlaintextLength {
+			l = MaxPlaintextLength
+		}
+		plaintext := pbuf[:l]
+		binary.BigEndian.PutUint16(plaintext, uint16(end-written))
+		n := copy(plaintext[paddingHeaderLength:], data[written:end])
+		for i := paddingHeaderLength + n; i < l; i++ {
+			plaintext[i] = 0
+		}
+
+		b, err := s.encrypt(cbuf[:LengthPrefixLength], plaintext)
+		if err != nil {
+			return 0, err
+		}
+		binary.BigEndian.PutUint16(b, uint16(len(b)-LengthPrefixLength))
+
+		if _, err := s.writeMsgInsecure(b); err != nil {
+			return written, err
+		}
+		written = end
+	}
+	return written, nil
+}
+
+// unpad moves the data of a decrypted padded transport message to the start of
+// msg, and returns its length.
+func unpad(msg []byte) (int, error) {
+	if len(msg) < paddingHeaderLength {
+		return 0, errInvalidPadding
+	}
+	n := int(binary.BigEndian.Uint16(msg))
+	if n > len(msg)-paddingHeaderLength {
+		return 0, errInvalidPadding
+	}
+	return copy(msg, msg[paddingHeaderLength:paddingHeaderLength+n]), nil
+}
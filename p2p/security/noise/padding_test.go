@@ -0,0 +1,237 @@
+package noise
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"net"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/p2p/security/noise/pb"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/chacha20poly1305"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestPaddedLength(t *testing.T) {
+	for _, tc := range []struct {
+		scheme   PaddingScheme
+		in, want int
+	}{
+		{PaddingPadme, 1, 1},
+		{PaddingPadme, 9, 10},
+		{PaddingPadme, 100, 104},
+		{PaddingPadme, 1000, 1024},
+		{PaddingPadme, 1025, 1088},
+		{PaddingPadme, 65535, 65536},
+		{PaddingBuckets, 1, 256},
+		{PaddingBuckets, 256, 256},
+		{PaddingBuckets, 257, 512},
+		{PaddingBuckets, 5000, 8192},
+	} {
+		require.Equal(t, tc.want, tc.scheme.paddedLength(tc.in), "%s(%d)", tc.scheme, tc.in)
+	}
+
+	// Padmé overhead is bounded by 12%.
+	for l := 2; l < 1<<16; l++ {
+		p := PaddingPadme.paddedLength(l)
+		require.GreaterOrEqual(t, p, l)
+		require.LessOrEqual(t, float64(p-l)/float64(l), 0.12)
+	}
+}
+
+func TestPaddingOption(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.New(rand.NewSource(1)))
+	require.NoError(t, err)
+	_, err = New(ID, priv, nil, WithPadding())
+	require.Error(t, err)
+	_, err = New(ID, priv, nil, WithPadding("foobar"))
+	require.Error(t, err)
+	tpt, err := New(ID, priv, nil, WithPadding(PaddingBuckets, PaddingPadme))
+	require.NoError(t, err)
+	require.Equal(t, []PaddingScheme{PaddingBuckets, PaddingPadme}, tpt.padding)
+}
+
+func TestPaddingNegotiation(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		init, resp []PaddingScheme
+		expected   PaddingScheme
+	}{
+		{name: "disabled"},
+		{name: "initiator only", init: []PaddingScheme{PaddingPadme}},
+		{name: "responder only", resp: []PaddingScheme{PaddingPadme}},
+		{name: "both", init: []PaddingScheme{PaddingPadme}, resp: []PaddingScheme{PaddingPadme}, expected: PaddingPadme},
+		{name: "no common scheme", init: []PaddingScheme{PaddingPadme}, resp: []PaddingScheme{PaddingBuckets}},
+		{
+			name:     "initiator preference",
+			init:     []PaddingScheme{PaddingBuckets, PaddingPadme},
+			resp:     []PaddingScheme{PaddingPadme, PaddingBuckets},
+			expected: PaddingBuckets,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+			initTransport.padding = tc.init
+			respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+			respTransport.padding = tc.resp
+
+			initConn, respConn := connect(t, initTransport, respTransport)
+			defer initConn.Close()
+			defer respConn.Close()
+
+			require.Equal(t, tc.expected, initConn.padding)
+			require.Equal(t, tc.expected, respConn.padding)
+
+			// Data is transferred correctly in both directions.
+			msg := []byte("hello")
+			_, err := initConn.Write(msg)
+			require.NoError(t, err)
+			buf := make([]byte, len(msg))
+			_, err = io.ReadFull(respConn, buf)
+			require.NoError(t, err)
+			require.Equal(t, msg, buf)
+			_, err = respConn.Write(msg)
+			require.NoError(t, err)
+			_, err = io.ReadFull(initConn, buf)
+			require.NoError(t, err)
+			require.Equal(t, msg, buf)
+		})
+	}
+}
+
+func TestPaddingUnsupportedScheme(t *testing.T) {
+	s := &secureSession{localPadding: []PaddingScheme{PaddingPadme}}
+	require.Error(t, s.negotiatePadding(&pb.NoiseExtensions{PaddingSchemes: []string{"buckets"}}))
+	require.Error(t, s.negotiatePadding(&pb.NoiseExtensions{PaddingSchemes: []string{"padme", "padme"}}))
+	require.NoError(t, s.negotiatePadding(&pb.NoiseExtensions{PaddingSchemes: []string{"padme"}}))
+	require.Equal(t, PaddingPadme, s.padding)
+}
+
+func TestPaddingExtensionDoesNotModifyInput(t *testing.T) {
+	s := &secureSession{localPadding: []PaddingScheme{PaddingPadme, PaddingBuckets}}
+	ext := &pb.NoiseExtensions{StreamMuxers: []string{"muxer1"}}
+	padded := s.addPaddingExtension(ext)
+	require.Equal(t, []string{"muxer1"}, padded.GetStreamMuxers())
+	require.Equal(t, []string{"padme", "buckets"}, padded.GetPaddingSchemes())
+	require.Empty(t, ext.GetPaddingSchemes())
+}
+
+func TestPaddedHandshakePayload(t *testing.T) {
+	for _, scheme := range []PaddingScheme{PaddingPadme, PaddingBuckets} {
+		t.Run(string(scheme), func(t *testing.T) {
+			for i := 0; i < 200; i++ {
+				s := &secureSession{localPadding: []PaddingScheme{scheme}}
+				nhp := &pb.NoiseHandshakePayload{IdentityKey: make([]byte, i), IdentitySig: make([]byte, 64)}
+				s.padHandshakePayload(nhp)
+				size := proto.Size(nhp)
+				// The padded length can't always be hit exactly, since the length of the
+				// padding field is a varint.
+				require.LessOrEqual(t, scheme.paddedLength(size)-size, 1)
+				require.NoError(t, checkHandshakePayloadSize(mustMarshal(t, nhp)))
+			}
+		})
+	}
+}
+
+func mustMarshal(t *testing.T, m proto.Message) []byte {
+	t.Helper()
+	b, err := proto.Marshal(m)
+	require.NoError(t, err)
+	return b
+}
+
+// recordingConn records the length of all writes.
+type recordingConn struct {
+	net.Conn
+	writes []int
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	c.writes = append(c.writes, len(b))
+	return c.Conn.Write(b)
+}
+
+func TestPaddedTransportMessages(t *testing.T) {
+	initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	initTransport.padding = []PaddingScheme{PaddingBuckets}
+	respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	respTransport.padding = []PaddingScheme{PaddingBuckets}
+
+	init, resp := newConnPair(t)
+	rinit := &recordingConn{Conn: init}
+	done := make(chan struct{})
+	var respConn *secureSession
+	go func() {
+		defer close(done)
+		c, err := respTransport.SecureInbound(context.Background(), resp, "")
+		require.NoError(t, err)
+		respConn = c.(*secureSession)
+	}()
+	c, err := initTransport.SecureOutbound(context.Background(), rinit, respTransport.localID)
+	require.NoError(t, err)
+	<-done
+	initConn := c.(*secureSession)
+	defer initConn.Close()
+	defer respConn.Close()
+	rinit.writes = nil
+
+	rnd := rand.New(rand.NewSource(1234))
+	for _, size := range []int{1, 100, 1000, 5000, MaxPlaintextLength, 100000} {
+		rinit.writes = nil
+		data := make([]byte, size)
+		rnd.Read(data)
+		n, err := initConn.Write(data)
+		require.NoError(t, err)
+		require.Equal(t, size, n)
+
+		for _, l := range rinit.writes {
+			l -= LengthPrefixLength
+			require.True(t, l == MaxTransportMsgLength || l == PaddingBuckets.paddedLength(l), "unpadded message length: %d", l)
+		}
+
+		// read with a buffer large enough to decrypt in place
+		received := make([]byte, 0, size)
+		buf := make([]byte, MaxTransportMsgLength)
+		for len(received) < size {
+			n, err := respConn.Read(buf)
+			require.NoError(t, err)
+			received = append(received, buf[:n]...)
+		}
+		require.True(t, bytes.Equal(data, received))
+
+		// and with a small buffer
+		_, err = initConn.Write(data)
+		require.NoError(t, err)
+		received = make([]byte, size)
+		_, err = io.ReadFull(respConn, received)
+		require.NoError(t, err)
+		require.True(t, bytes.Equal(data, received))
+	}
+}
+
+func TestInvalidPadding(t *testing.T) {
+	initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	initTransport.padding = []PaddingScheme{PaddingPadme}
+	respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	respTransport.padding = []PaddingScheme{PaddingPadme}
+	initConn, respConn := connect(t, initTransport, respTransport)
+	defer initConn.Close()
+	defer respConn.Close()
+
+	// The length in the padding header exceeds the message.
+	plaintext := make([]byte, 100)
+	binary.BigEndian.PutUint16(plaintext, 200)
+	b, err := initConn.encrypt(make([]byte, LengthPrefixLength, LengthPrefixLength+len(plaintext)+chacha20poly1305.Overhead), plaintext)
+	require.NoError(t, err)
+	binary.BigEndian.PutUint16(b, uint16(len(b)-LengthPrefixLength))
+	_, err = initConn.writeMsgInsecure(b)
+	require.NoError(t, err)
+
+	_, err = respConn.Read(make([]byte, 10))
+	require.ErrorIs(t, err, errInvalidPadding)
+}
@@ -0,0 +1,284 @@
+package noise
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/security/noise/pb"
+
+	"github.com/flynn/noise"
+	"google.golang.org/protobuf/proto"
+)
+
+// Noise Pipes
+//
+// By default, every handshake uses the XX pattern with a fresh static Noise key, which takes
+// 1.5 round trips. With Noise Pipes, a peer uses the same static Noise key for all handshakes,
+// and announces this in its NoiseExtensions. Peers remember the static keys of the peers that
+// support Noise Pipes. When connecting to such a peer again, the initiator uses the IK pattern,
+// which authenticates both peers in one round trip:
+//
+//	-> e, es, s, ss  (with the initiator's payload)
+//	<- e, ee, se     (with the responder's payload)
+//
+// The responder tells the patterns apart by the length of the first message: the first message
+// of the XX pattern only contains the ephemeral key. If the responder can't decrypt the first
+// message, e.g. because it changed its static key, it falls back to the XXfallback pattern,
+// reusing the initiator's ephemeral key:
+//
+//	<- e, ee, s, es  (with the responder's payload)
+//	-> s, se         (with the initiator's payload)
+//
+// The initiator tries to process the second message as the IK response first, and as the
+// XXfallback message if that fails. If the IK handshake fails, the cached static key is dropped,
+// so that the next handshake uses XX.
+//
+// Peers only use IK with peers that announced Noise Pipes support. Peers that don't support Noise
+// Pipes therefore never receive the first message of an IK handshake, unless they disabled
+// Noise Pipes since the last handshake. The IK handshake then fails, and the next one uses XX.
+
+// maxCachedStaticKeys is the maximum number of static keys of remote peers we remember.
+const maxCachedStaticKeys = 1024
+
+// WithNoisePipes enables Noise Pipes: handshakes with peers we've handshaked with before use the
+// IK pattern, which takes one round trip instead of 1.5, falling back to XX if needed.
+//
+// This requires using the same static Noise key for all handshakes, instead of a new one for
+// every handshake. Forward secrecy is still provided by the ephemeral keys. Since the static key
+// makes our handshakes linkable, Noise Pipes can't be combined with WithAnonymousDial.
+//
+// The first IK message is only encrypted using our ephemeral key and the responder's static key,
+// so an attacker that recorded it can replay it to the responder, which only notices once the
+// attacker fails to continue the session. For this reason, no early data (see
+// WithEarlyDataHandler and EarlyDataHandler) is sent in IK handshakes: the initiator's early data
+// is dropped, and the responder receives none. The responder's early data is sent as usual.
+func WithNoisePipes() Option {
+	return func(t *Transport) error {
+		kp, err := noise.DH25519.GenerateKeypair(rand.Reader)
+		if err != nil {
+			return fmt.Errorf("noise: failed to generate static key: %w", err)
+		}
+		t.pipes = &noisePipes{
+			static:        kp,
+			remoteStatics: make(map[peer.ID][]byte),
+		}
+		return nil
+	}
+}
+
+// noisePipes holds our static Noise key and the static Noise keys of remote peers.
+type noisePipes struct {
+	static noise.DHKey
+
+	mx            sync.Mutex
+	remoteStatics map[peer.ID][]byte
+	// order is the order in which the keys were added, oldest first
+	order []peer.ID
+}
+
+// remoteStatic returns the static key of p, or nil if it isn't known.
+// It is safe to call on a nil noisePipes.
+func (np *noisePipes) remoteStatic(p peer.ID) []byte {
+	if np == nil || p == "" {
+		return nil
+	}
+	np.mx.Lock()
+	defer np.mx.Unlock()
+	return np.remoteStatics[p]
+}
+
+func (np *noisePipes) addRemoteStatic(p peer.ID, key []byte) {
+	np.mx.Lock()
+	defer np.mx.Unlock()
+	if _, ok := np.remoteStatics[p]; !ok {
+		if len(np.order) >= maxCachedStaticKeys {
+			delete(np.remoteStatics, np.order[0])
+			np.order = np.order[1:]
+		}
+		np.order = append(np.order, p)
+	}
+	np.remoteStatics[p] = append([]byte(nil), key...)
+}
+
+func (np *noisePipes) removeRemoteStatic(p peer.ID) {
+	np.mx.Lock()
+	defer np.mx.Unlock()
+	if _, ok := np.remoteStatics[p]; !ok {
+		return
+	}
+	delete(np.remoteStatics, p)
+	for i, o := range np.order {
+		if o == p {
+			np.order = append(np.order[:i], np.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// addPipesExtension returns ext with our Noise Pipes support added.
+// ext is owned by the early data handler, so it is copied if it needs to be modified.
+func (s *secureSession) addPipesExtension(ext *pb.NoiseExtensions) *pb.NoiseExtensions {
+	if s.pipes == nil {
+		return ext
+	}
+	if ext == nil {
+		ext = &pb.NoiseExtensions{}
+	} else {
+		ext = proto.Clone(ext).(*pb.NoiseExtensions)
+	}
+	ext.NoisePipes = proto.Bool(true)
+	return ext
+}
+
+// handlePipesExtension remembers the remote's static key, if it supports Noise Pipes.
+func (s *secureSession) handlePipesExtension(ext *pb.NoiseExtensions, remoteStatic []byte) {
+	// Synthetic peer IDs are never dialed, so there's no point in remembering their static key.
+	if s.pipes == nil || s.anonymous {
+		return
+	}
+	if ext.GetNoisePipes() {
+		s.pipes.addRemoteStatic(s.remoteID, remoteStatic)
+	} else {
+		s.pipes.removeRemoteStatic(s.remoteID)
+	}
+}
+
+// withoutEarlyData returns a copy of ext without the application data, only keeping the extensions
+// used to set up the session. It is used for the first IK message, which is replayable.
+func withoutEarlyData(ext *pb.NoiseExtensions) *pb.NoiseExtensions {
+	if ext == nil {
+		return nil
+	}
+	ext = proto.Clone(ext).(*pb.NoiseExtensions)
+	ext.EarlyData = nil
+	ext.WebtransportCerthashes = nil
+	return ext
+}
+
+// runIKInitiator runs the IK handshake as the initiator, falling back to XXfallback if the
+// responder can't process our first message.
+func (s *secureSession) runIKInitiator(ctx context.Context, cfg noise.Config, remoteStatic []byte, hbuf []byte) (err error) {
+	defer func() {
+		if err != nil {
+			s.pipes.removeRemoteStatic(s.remoteID)
+		}
+	}()
+
+	cfg.Pattern = noise.HandshakeIK
+	cfg.PeerStatic = remoteStatic
+	hs, err := noise.NewHandshakeState(cfg)
+	if err != nil {
+		return fmt.Errorf("error initializing handshake state: %w", err)
+	}
+
+	// -> e, es, s, ss
+	s.ik = true
+	payload, err := s.generateOurPayload(ctx, cfg.StaticKeypair)
+	if err != nil {
+		return err
+	}
+	if err := s.sendHandshakeMessage(hs, payload, hbuf); err != nil {
+		return fmt.Errorf("error sending handshake message: %w", err)
+	}
+
+	msg, release, err := s.readRawHandshakeMessage()
+	if err != nil {
+		return fmt.Errorf("error reading handshake message: %w", err)
+	}
+	defer release()
+
+	// <- e, ee, se
+	if plaintext, err := s.processHandshakeMessage(hs, msg); err == nil {
+		s.connectionState.CipherSuite = pipesProtocolName(noise.HandshakeIK)
+		return s.handleRemotePayload(ctx, plaintext, hs.PeerStatic())
+	}
+
+	// <- e, ee, s, es
+	// The responder couldn't process our first message, and fell back to XXfallback.
+	// The responder is the initiator of the XXfallback pattern.
+	s.ik = false
+	s.noiseInitiator = false
+	cfg.Pattern = noise.HandshakeXXfallback
+	cfg.Initiator = false
+	cfg.PeerStatic = nil
+	cfg.EphemeralKeypair = hs.LocalEphemeral()
+	hs, err = noise.NewHandshakeState(cfg)
+	if err != nil {
+		return fmt.Errorf("error initializing handshake state: %w", err)
+	}
+	plaintext, err := s.processHandshakeMessage(hs, msg)
+	if err != nil {
+		return fmt.Errorf("error reading handshake message: %w", err)
+	}
+	if err := s.handleRemotePayload(ctx, plaintext, hs.PeerStatic()); err != nil {
+		return err
+	}
+
+	// -> s, se
+	payload, err = s.generateOurPayload(ctx, cfg.StaticKeypair)
+	if err != nil {
+		return err
+	}
+	if err := s.sendHandshakeMessage(hs, payload, hbuf); err != nil {
+		return fmt.Errorf("error sending handshake message: %w", err)
+	}
+	s.connectionState.CipherSuite = pipesProtocolName(noise.HandshakeXXfallback)
+	return nil
+}
+
+// runIKResponder runs the IK handshake as the responder, given the initiator's first message.
+// If we can't process the first message, it falls back to XXfallback.
+func (s *secureSession) runIKResponder(ctx context.Context, cfg noise.Config, msg []byte, hbuf []byte) error {
+	ikCfg := cfg
+	ikCfg.Pattern = noise.HandshakeIK
+	hs, err := noise.NewHandshakeState(ikCfg)
+	if err != nil {
+		return fmt.Errorf("error initializing handshake state: %w", err)
+	}
+
+	// -> e, es, s, ss
+	if plaintext, err := s.processHandshakeMessage(hs, msg); err == nil {
+		s.ik = true
+		if err := s.handleRemotePayload(ctx, plaintext, hs.PeerStatic()); err != nil {
+			return err
+		}
+
+		// <- e, ee, se
+		payload, err := s.generateOurPayload(ctx, cfg.StaticKeypair)
+		if err != nil {
+			return err
+		}
+		if err := s.sendHandshakeMessage(hs, payload, hbuf); err != nil {
+			return fmt.Errorf("error sending handshake message: %w", err)
+		}
+		s.connectionState.CipherSuite = pipesProtocolName(noise.HandshakeIK)
+		return nil
+	}
+
+	// We couldn't process the first message, probably because the initiator used an outdated
+	// static key. Fall back to XXfallback, using the initiator's ephemeral key.
+	// We're the initiator of the XXfallback pattern.
+	s.noiseInitiator = true
+	cfg.Pattern = noise.HandshakeXXfallback
+	cfg.Initiator = true
+	cfg.PeerEphemeral = msg[:noise.DH25519.DHLen()]
+	hs, err = noise.NewHandshakeState(cfg)
+	if err != nil {
+		return fmt.Errorf("error initializing handshake state: %w", err)
+	}
+	// <- e, ee, s, es
+	// -> s, se
+	if err := s.finishResponderHandshake(ctx, hs, cfg.StaticKeypair, hbuf); err != nil {
+		return err
+	}
+	s.connectionState.CipherSuite = pipesProtocolName(noise.HandshakeXXfallback)
+	return nil
+}
+
+// pipesProtocolName is the name of the Noise protocol, when using a Noise Pipes pattern.
+func pipesProtocolName(pattern noise.HandshakePattern) string {
+	return "Noise_" + pattern.Name + "_" + string(cipherSuite.Name())
+}
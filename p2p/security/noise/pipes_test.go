@@ -0,0 +1,162 @@
+package noise
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/security/noise/pb"
+
+	"github.com/flynn/noise"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func newPipesTransport(t *testing.T) *Transport {
+	tpt := newTestTransport(t, crypto.Ed25519, 2048)
+	require.NoError(t, WithNoisePipes()(tpt))
+	return tpt
+}
+
+// connectPipes runs a handshake, checks that data can be exchanged, and returns the Noise protocol name used.
+func connectPipes(t *testing.T, initTransport, respTransport *Transport) string {
+	t.Helper()
+	initConn, respConn := connect(t, initTransport, respTransport)
+	defer initConn.Close()
+	defer respConn.Close()
+	require.Equal(t, initConn.ConnState().CipherSuite, respConn.ConnState().CipherSuite)
+
+	msg := []byte("hello")
+	buf := make([]byte, len(msg))
+	_, err := initConn.Write(msg)
+	require.NoError(t, err)
+	_, err = io.ReadFull(respConn, buf)
+	require.NoError(t, err)
+	require.Equal(t, msg, buf)
+	_, err = respConn.Write(msg)
+	require.NoError(t, err)
+	_, err = io.ReadFull(initConn, buf)
+	require.NoError(t, err)
+	require.Equal(t, msg, buf)
+	return initConn.ConnState().CipherSuite
+}
+
+func TestNoisePipes(t *testing.T) {
+	initTransport := newPipesTransport(t)
+	respTransport := newPipesTransport(t)
+
+	// The first handshake uses XX.
+	require.Equal(t, protocolName, connectPipes(t, initTransport, respTransport))
+	require.Equal(t, respTransport.pipes.static.Public, initTransport.pipes.remoteStatic(respTransport.localID))
+	require.Equal(t, initTransport.pipes.static.Public, respTransport.pipes.remoteStatic(initTransport.localID))
+
+	// Subsequent handshakes use IK, in both directions.
+	require.Equal(t, pipesProtocolName(noise.HandshakeIK), connectPipes(t, initTransport, respTransport))
+	require.Equal(t, pipesProtocolName(noise.HandshakeIK), connectPipes(t, respTransport, initTransport))
+}
+
+func TestNoisePipesFallback(t *testing.T) {
+	initTransport := newPipesTransport(t)
+	respTransport := newPipesTransport(t)
+	require.Equal(t, protocolName, connectPipes(t, initTransport, respTransport))
+
+	// The responder changes its static key, e.g. because it restarted.
+	respTransport.pipes = newPipesTransport(t).pipes
+	require.Equal(t, pipesProtocolName(noise.HandshakeXXfallback), connectPipes(t, initTransport, respTransport))
+	require.Equal(t, respTransport.pipes.static.Public, initTransport.pipes.remoteStatic(respTransport.localID))
+
+	require.Equal(t, pipesProtocolName(noise.HandshakeIK), connectPipes(t, initTransport, respTransport))
+}
+
+func TestNoisePipesRemoteDisabled(t *testing.T) {
+	initTransport := newPipesTransport(t)
+	respTransport := newPipesTransport(t)
+	require.Equal(t, protocolName, connectPipes(t, initTransport, respTransport))
+
+	// The responder disables Noise Pipes. The IK handshake fails.
+	respTransport.pipes = nil
+	init, resp := newConnPair(t)
+	defer init.Close()
+	defer resp.Close()
+	go respTransport.SecureInbound(context.Background(), resp, "")
+	_, err := initTransport.SecureOutbound(context.Background(), init, respTransport.localID)
+	require.Error(t, err)
+	require.Nil(t, initTransport.pipes.remoteStatic(respTransport.localID))
+
+	// The next handshake uses XX.
+	require.Equal(t, protocolName, connectPipes(t, initTransport, respTransport))
+	require.Nil(t, initTransport.pipes.remoteStatic(respTransport.localID))
+}
+
+func TestNoisePipesPadding(t *testing.T) {
+	initTransport := newPipesTransport(t)
+	initTransport.padding = []PaddingScheme{PaddingBuckets, PaddingPadme}
+	respTransport := newPipesTransport(t)
+	respTransport.padding = []PaddingScheme{PaddingPadme, PaddingBuckets}
+	require.Equal(t, protocolName, connectPipes(t, initTransport, respTransport))
+
+	// With IK, the responder picks the padding scheme.
+	initConn, respConn := connect(t, initTransport, respTransport)
+	defer initConn.Close()
+	defer respConn.Close()
+	require.True(t, initConn.ik)
+	require.Equal(t, PaddingPadme, initConn.padding)
+	require.Equal(t, PaddingPadme, respConn.padding)
+}
+
+func TestNoisePipesCacheLimit(t *testing.T) {
+	np := newPipesTransport(t).pipes
+	for i := 0; i < maxCachedStaticKeys+10; i++ {
+		np.addRemoteStatic(peer.ID(rune(i)), []byte{byte(i)})
+	}
+	require.Len(t, np.remoteStatics, maxCachedStaticKeys)
+	require.Len(t, np.order, maxCachedStaticKeys)
+	require.Nil(t, np.remoteStatic(peer.ID(rune(0))))
+	require.NotNil(t, np.remoteStatic(peer.ID(rune(maxCachedStaticKeys+9))))
+
+	np.removeRemoteStatic(peer.ID(rune(maxCachedStaticKeys + 9)))
+	require.Len(t, np.order, maxCachedStaticKeys-1)
+}
+
+func TestNoisePipesEarlyData(t *testing.T) {
+	var initReceived, respReceived [][]byte
+	newTransport := func(data string, received *[][]byte) *Transport {
+		tpt := newPipesTransport(t)
+		require.NoError(t, WithEarlyDataHandler(
+			func() []byte { return []byte(data) },
+			func(b []byte) error { *received = append(*received, b); return nil },
+		)(tpt))
+		return tpt
+	}
+	initTransport := newTransport("from initiator", &initReceived)
+	respTransport := newTransport("from responder", &respReceived)
+	require.Equal(t, protocolName, connectPipes(t, initTransport, respTransport))
+	require.Equal(t, [][]byte{[]byte("from responder")}, initReceived)
+	require.Equal(t, [][]byte{[]byte("from initiator")}, respReceived)
+
+	// The first IK message is replayable, so it doesn't carry the initiator's early data.
+	require.Equal(t, pipesProtocolName(noise.HandshakeIK), connectPipes(t, initTransport, respTransport))
+	require.Len(t, initReceived, 2)
+	require.Equal(t, []byte("from responder"), initReceived[1])
+	require.Len(t, respReceived, 2)
+	require.Empty(t, respReceived[1])
+}
+
+func TestWithoutEarlyData(t *testing.T) {
+	ext := &pb.NoiseExtensions{
+		EarlyData:              []byte("foobar"),
+		WebtransportCerthashes: [][]byte{[]byte("hash")},
+		StreamMuxers:           []string{"/yamux/1.0.0"},
+		NoisePipes:             proto.Bool(true),
+	}
+	stripped := withoutEarlyData(ext)
+	require.Empty(t, stripped.EarlyData)
+	require.Empty(t, stripped.WebtransportCerthashes)
+	require.Equal(t, ext.StreamMuxers, stripped.StreamMuxers)
+	require.True(t, stripped.GetNoisePipes())
+	// The original extensions are not modified.
+	require.Equal(t, []byte("foobar"), ext.EarlyData)
+	require.Nil(t, withoutEarlyData(nil))
+}
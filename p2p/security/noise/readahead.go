@@ -0,0 +1,209 @@
+package noise
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+
+	pool "github.com/libp2p/go-buffer-pool"
+)
+
+// WithReadAhead enables pipelined decryption of transport messages: a background go-routine
+// reads and decrypts up to frames messages, while the application is still consuming the
+// previous ones. This increases the throughput of a single connection on paths with a high
+// bandwidth-delay product, at the cost of up to frames*64 KiB of memory per connection.
+// This memory is reserved in the connection's resource scope. If it can't be reserved,
+// the connection is used without read-ahead.
+//
+// Read deadlines set on the session only apply to the Read call, not to the underlying connection.
+// Read-ahead can't be combined with WithSessionExport, since the session state would include
+// messages that were already read off the wire.
+func WithReadAhead(frames int) Option {
+	return func(t *Transport) error {
+		if frames <= 0 {
+			return errors.New("noise: read-ahead needs to buffer at least one frame")
+		}
+		t.readAhead = frames
+		return nil
+	}
+}
+
+// readAheadFrame is a decrypted transport message.
+type readAheadFrame struct {
+	// data is the plaintext, taken from the pool
+	data []byte
+	err  error
+}
+
+// readAhead is the state of the read-ahead pipeline of a session.
+type readAhead struct {
+	frames chan readAheadFrame
+	// err is the error that ended the pipeline. Only accessed by Read, under the read lock.
+	err error
+
+	closeOnce sync.Once
+	closed    chan struct{}
+
+	mx       sync.Mutex
+	deadline time.Time
+	// deadlineChanged is closed (and replaced) when the read deadline is changed,
+	// to wake up a blocked Read call.
+	deadlineChanged chan struct{}
+}
+
+func newReadAhead(frames int) *readAhead {
+	return &readAhead{
+		frames:          make(chan readAheadFrame, frames),
+		closed:          make(chan struct{}),
+		deadlineChanged: make(chan struct{}),
+	}
+}
+
+func (r *readAhead) setDeadline(t time.Time) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.deadline = t
+	close(r.deadlineChanged)
+	r.deadlineChanged = make(chan struct{})
+}
+
+func (r *readAhead) getDeadline() (time.Time, <-chan struct{}) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.deadline, r.deadlineChanged
+}
+
+func (r *readAhead) close() {
+	r.closeOnce.Do(func() { close(r.closed) })
+}
+
+// startReadAhead starts the read-ahead pipeline. It must be called after the handshake completed.
+// If ctx carries the connection's resource scope, the memory used by the pipeline is reserved in it.
+func (s *secureSession) startReadAhead(ctx context.Context, frames int) {
+	// the queued frames, and the frame being read
+	mem := (frames + 1) * MaxTransportMsgLength
+	scope, ok := network.GetConnScope(ctx)
+	if ok {
+		if err := scope.ReserveMemory(mem, network.ReservationPriorityLow); err != nil {
+			log.Debugw("failed to reserve memory for read-ahead, disabling read-ahead", "error", err)
+			return
+		}
+	}
+	s.readAhead = newReadAhead(frames)
+	go s.readAheadLoop(scope, mem)
+}
+
+// readAheadLoop reads and decrypts messages from the insecure connection, until it encounters an error.
+// It releases mem in scope when it returns. scope may be nil.
+func (s *secureSession) readAheadLoop(scope network.ConnScope, mem int) {
+	if scope != nil {
+		defer scope.ReleaseMemory(mem)
+	}
+	if s.keyWiping {
+		defer s.dec.wipe()
+	}
+	for {
+		data, err := s.readFrame()
+		if err == nil && len(data) == 0 {
+			// nothing to deliver, e.g. a message only containing padding
+			pool.Put(data)
+			continue
+		}
+		select {
+		case s.readAhead.frames <- readAheadFrame{data: data, err: err}:
+		case <-s.readAhead.closed:
+			if data != nil {
+				pool.Put(data)
+			}
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readFrame reads and decrypts the next message from the insecure connection.
+// The returned buffer is taken from the pool.
+func (s *secureSession) readFrame() ([]byte, error) {
+	nextMsgLen, err := s.readNextInsecureMsgLen()
+	if err != nil {
+		return nil, err
+	}
+	cbuf := pool.Get(nextMsgLen)
+	if err := s.readNextMsgInsecure(cbuf); err != nil {
+		pool.Put(cbuf)
+		return nil, err
+	}
+	data, err := s.decrypt(cbuf[:0], cbuf)
+	if err != nil {
+		pool.Put(cbuf)
+		return nil, err
+	}
+	if s.padding != "" {
+		n, err := unpad(data)
+		if err != nil {
+			pool.Put(cbuf)
+			return nil, err
+		}
+		data = data[:n]
+	}
+	return data, nil
+}
+
+// readPipelined serves a Read call from the read-ahead pipeline.
+// The read lock must be held, and the queued buffer must be empty.
+func (s *secureSession) readPipelined(buf []byte) (int, error) {
+	ra := s.readAhead
+	if ra.err != nil {
+		return 0, ra.err
+	}
+	for {
+		deadline, deadlineChanged := ra.getDeadline()
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(d)
+			timeout = timer.C
+		}
+
+		select {
+		case f := <-ra.frames:
+			if timer != nil {
+				timer.Stop()
+			}
+			if f.err != nil {
+				ra.err = f.err
+				return 0, f.err
+			}
+			n := copy(buf, f.data)
+			if n == len(f.data) {
+				pool.Put(f.data)
+			} else {
+				s.qbuf, s.qseek = f.data, n
+			}
+			return n, nil
+		case <-ra.closed:
+			if timer != nil {
+				timer.Stop()
+			}
+			ra.err = net.ErrClosed
+			return 0, net.ErrClosed
+		case <-timeout:
+			return 0, os.ErrDeadlineExceeded
+		case <-deadlineChanged:
+			if timer != nil {
+				timer.Stop()
+			}
+		}
+	}
+}
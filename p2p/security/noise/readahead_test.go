@@ -0,0 +1,290 @@
+package noise
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/sec"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAhead(t *testing.T) {
+	for _, padding := range []bool{false, true} {
+		initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		require.NoError(t, WithReadAhead(2)(respTransport))
+		if padding {
+			initTransport.padding = []PaddingScheme{PaddingBuckets}
+			respTransport.padding = []PaddingScheme{PaddingBuckets}
+		}
+		initConn, respConn := connect(t, initTransport, respTransport)
+		require.NotNil(t, respConn.readAhead)
+
+		rnd := rand.New(rand.NewSource(1234))
+		for _, size := range []int{1, 100, 5000, MaxPlaintextLength, 500000} {
+			data := make([]byte, size)
+			rnd.Read(data)
+			go initConn.Write(data)
+
+			// read with a buffer large enough to hold a message
+			received := make([]byte, 0, size)
+			buf := make([]byte, MaxTransportMsgLength)
+			for len(received) < size {
+				n, err := respConn.Read(buf)
+				require.NoError(t, err)
+				received = append(received, buf[:n]...)
+			}
+			require.True(t, bytes.Equal(data, received))
+
+			// and with a small buffer
+			go initConn.Write(data)
+			received = make([]byte, size)
+			_, err := io.ReadFull(respConn, received)
+			require.NoError(t, err)
+			require.True(t, bytes.Equal(data, received))
+		}
+
+		require.NoError(t, initConn.Close())
+		_, err := respConn.Read(make([]byte, 1))
+		require.ErrorIs(t, err, io.EOF)
+		_, err = respConn.Read(make([]byte, 1))
+		require.ErrorIs(t, err, io.EOF)
+		require.NoError(t, respConn.Close())
+	}
+}
+
+func TestReadAheadDeadline(t *testing.T) {
+	initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	require.NoError(t, WithReadAhead(4)(respTransport))
+	initConn, respConn := connect(t, initTransport, respTransport)
+	defer initConn.Close()
+	defer respConn.Close()
+
+	buf := make([]byte, 10)
+	require.NoError(t, respConn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	start := time.Now()
+	_, err := respConn.Read(buf)
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// resetting the deadline unblocks a pending Read
+	require.NoError(t, respConn.SetReadDeadline(time.Now().Add(time.Hour)))
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := respConn.Read(buf)
+		errChan <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, respConn.SetReadDeadline(time.Now()))
+	select {
+	case err := <-errChan:
+		require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("Read didn't unblock")
+	}
+
+	// the session is still usable after the deadline was exceeded
+	require.NoError(t, respConn.SetReadDeadline(time.Time{}))
+	_, err = initConn.Write([]byte("foobar"))
+	require.NoError(t, err)
+	n, err := respConn.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "foobar", string(buf[:n]))
+}
+
+func TestReadAheadClose(t *testing.T) {
+	initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	require.NoError(t, WithReadAhead(4)(respTransport))
+	initConn, respConn := connect(t, initTransport, respTransport)
+	defer initConn.Close()
+
+	// closing the session unblocks a pending Read
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := respConn.Read(make([]byte, 10))
+		errChan <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, respConn.Close())
+	select {
+	case err := <-errChan:
+		require.ErrorIs(t, err, net.ErrClosed)
+	case <-time.After(time.Second):
+		t.Fatal("Read didn't unblock")
+	}
+
+	// and Read calls after Close return immediately
+	_, err := respConn.Read(make([]byte, 10))
+	require.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestReadAheadOptions(t *testing.T) {
+	priv, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 256)
+	require.NoError(t, err)
+	_, err = New(ID, priv, nil, WithReadAhead(0))
+	require.Error(t, err)
+	_, err = New(ID, priv, nil, WithReadAhead(4), WithSessionExport())
+	require.Error(t, err)
+}
+
+// benchReadAhead measures the throughput of a connection where the application spends time
+// processing the received data, which the read-ahead pipeline overlaps with decryption.
+// readAheadScope is a connection scope that only allows reserving memory with at least
+// the given priority.
+type readAheadScope struct {
+	network.ConnScope
+	minPriority uint8
+
+	mx       sync.Mutex
+	reserved int
+}
+
+func (s *readAheadScope) ReserveMemory(size int, prio uint8) error {
+	if prio < s.minPriority {
+		return errors.New("not enough memory")
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.reserved += size
+	return nil
+}
+
+func (s *readAheadScope) ReleaseMemory(size int) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.reserved -= size
+}
+
+func (s *readAheadScope) getReserved() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.reserved
+}
+
+func TestReadAheadMemoryAccounting(t *testing.T) {
+	connect := func(t *testing.T, scope network.ConnScope) (*secureSession, *secureSession) {
+		initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		require.NoError(t, WithReadAhead(2)(respTransport))
+		init, resp := newConnPair(t)
+
+		type result struct {
+			conn sec.SecureConn
+			err  error
+		}
+		resChan := make(chan result, 1)
+		go func() {
+			conn, err := initTransport.SecureOutbound(context.Background(), init, respTransport.localID)
+			resChan <- result{conn: conn, err: err}
+		}()
+		respConn, err := respTransport.SecureInbound(network.WithConnScope(context.Background(), scope), resp, "")
+		require.NoError(t, err)
+		res := <-resChan
+		require.NoError(t, res.err)
+		return res.conn.(*secureSession), respConn.(*secureSession)
+	}
+	transfer := func(t *testing.T, initConn, respConn *secureSession) {
+		go initConn.Write([]byte("foobar"))
+		buf := make([]byte, 6)
+		_, err := io.ReadFull(respConn, buf)
+		require.NoError(t, err)
+		require.Equal(t, "foobar", string(buf))
+	}
+
+	t.Run("reservation succeeds", func(t *testing.T) {
+		scope := &readAheadScope{minPriority: network.ReservationPriorityLow}
+		initConn, respConn := connect(t, scope)
+		defer initConn.Close()
+		require.NotNil(t, respConn.readAhead)
+		require.Equal(t, 3*MaxTransportMsgLength, scope.getReserved())
+		transfer(t, initConn, respConn)
+		require.NoError(t, respConn.Close())
+		require.Eventually(t, func() bool { return scope.getReserved() == 0 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("reservation fails", func(t *testing.T) {
+		scope := &readAheadScope{minPriority: network.ReservationPriorityMedium}
+		initConn, respConn := connect(t, scope)
+		defer initConn.Close()
+		defer respConn.Close()
+		require.Nil(t, respConn.readAhead)
+		require.Zero(t, scope.getReserved())
+		transfer(t, initConn, respConn)
+	})
+}
+
+func benchReadAhead(b *testing.B, frames int) {
+	priv, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 256)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var opts []Option
+	if frames > 0 {
+		opts = append(opts, WithReadAhead(frames))
+	}
+	respTpt, err := New(ID, priv, nil, opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	env := setupEnv(b)
+	env.respTpt = respTpt
+	initSession, respSession := env.connect(true)
+	defer initSession.Close()
+	defer respSession.Close()
+
+	const dataSize = 1 << 20
+	data := make([]byte, dataSize)
+	rand.New(env.rndSrc).Read(data)
+
+	go func() {
+		for {
+			if _, err := initSession.Write(data); err != nil {
+				return
+			}
+		}
+	}()
+
+	b.SetBytes(dataSize)
+	b.ResetTimer()
+	buf := make([]byte, MaxTransportMsgLength)
+	h := sha256.New()
+	for i := 0; i < b.N; i++ {
+		for read := 0; read < dataSize; {
+			l := len(buf)
+			if dataSize-read < l {
+				l = dataSize - read
+			}
+			n, err := respSession.Read(buf[:l])
+			if err != nil {
+				b.Fatal(err)
+			}
+			h.Write(buf[:n])
+			read += n
+		}
+	}
+}
+
+func BenchmarkReadAhead(b *testing.B) {
+	for _, frames := range []int{0, 1, 4, 16} {
+		name := "disabled"
+		if frames > 0 {
+			name = fmt.Sprintf("%d frames", frames)
+		}
+		b.Run(name, func(b *testing.B) { benchReadAhead(b, frames) })
+	}
+}
@@ -27,6 +27,10 @@ func (s *secureSession) Read(buf []byte) (int, error) {
 	s.readLock.Lock()
 	defer s.readLock.Unlock()
 
+	if s.exported {
+		return 0, errSessionExported
+	}
+
 	// 1. If we have queued received bytes:
 	//   1a. If len(buf) < len(queued), saturate buf, update seek pointer, return.
 	//   1b. If len(buf) >= len(queued), copy remaining to buf, release queued buffer back into pool, return.
@@ -48,6 +52,10 @@ func (s *secureSession) Read(buf []byte) (int, error) {
 		return copied, nil
 	}
 
+	if s.readAhead != nil {
+		return s.readPipelined(buf)
+	}
+
 	// length of the next encrypted message.
 	nextMsgLen, err := s.readNextInsecureMsgLen()
 	if err != nil {
@@ -65,6 +73,9 @@ func (s *secureSession) Read(buf []byte) (int, error) {
 		if err != nil {
 			return 0, err
 		}
+		if s.padding != "" {
+			return unpad(dbuf)
+		}
 
 		return len(dbuf), nil
 	}
@@ -73,12 +84,24 @@ func (s *secureSession) Read(buf []byte) (int, error) {
 	// and then decrypt in place, since we're retaining the buffer (or a view thereof).
 	cbuf := pool.Get(nextMsgLen)
 	if err := s.readNextMsgInsecure(cbuf); err != nil {
+		pool.Put(cbuf)
 		return 0, err
 	}
 
-	if s.qbuf, err = s.decrypt(cbuf[:0], cbuf); err != nil {
+	qbuf, err := s.decrypt(cbuf[:0], cbuf)
+	if err != nil {
+		pool.Put(cbuf)
 		return 0, err
 	}
+	if s.padding != "" {
+		n, err := unpad(qbuf)
+		if err != nil {
+			pool.Put(cbuf)
+			return 0, err
+		}
+		qbuf = qbuf[:n]
+	}
+	s.qbuf = qbuf
 
 	// copy as many bytes as we can; update seek pointer.
 	s.qseek = copy(buf, s.qbuf)
@@ -92,6 +115,14 @@ func (s *secureSession) Write(data []byte) (int, error) {
 	s.writeLock.Lock()
 	defer s.writeLock.Unlock()
 
+	if s.exported {
+		return 0, errSessionExported
+	}
+
+	if s.padding != "" {
+		return s.writePadded(data)
+	}
+
 	var (
 		written int
 		cbuf    []byte
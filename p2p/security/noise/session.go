@@ -7,12 +7,13 @@ import (
 	"sync"
 	"time"
 
-	"github.com/flynn/noise"
-
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/sec"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 type secureSession struct {
@@ -35,16 +36,74 @@ type secureSession struct {
 	qbuf  []byte  // queued bytes buffer.
 	rlen  [2]byte // work buffer to read in the incoming message length.
 
-	enc *noise.CipherState
-	dec *noise.CipherState
+	enc *cipherState
+	dec *cipherState
+
+	// keyRecorder is set during the handshake if session export is enabled
+	keyRecorder *keyRecordingCipherSuite
+	exportable  bool
+	// exported is set once the session was exported, after which it can't be used any more
+	exported bool
 
 	// noise prologue
 	prologue []byte
 
+	// handshakeScope is the resource scope used to account for memory allocated
+	// during the handshake, before the remote peer is authenticated. May be nil.
+	handshakeScope network.ConnScope
+
 	initiatorEarlyDataHandler, responderEarlyDataHandler EarlyDataHandler
 
+	// localPayloadVersion is the highest handshake payload version we support,
+	// remotePayloadVersion the one announced by the remote peer.
+	localPayloadVersion, remotePayloadVersion uint32
+
+	// localPadding are the padding schemes we support, in order of preference.
+	localPadding []PaddingScheme
+	// padding is the padding scheme negotiated for transport messages.
+	// Empty if transport messages are not padded.
+	padding PaddingScheme
+
+	// readAhead is the read-ahead pipeline. nil if read-ahead is disabled.
+	readAhead *readAhead
+
+	// keyWiping is set if the session keys are wiped when the session is closed
+	keyWiping bool
+
+	// keyPolicy restricts the identity key of the remote peer
+	keyPolicy *sec.KeyPolicy
+
+	// pipes is set if Noise Pipes is enabled. See pipes.go.
+	pipes *noisePipes
+	// ik is set if the session uses the IK handshake
+	ik bool
+	// noiseInitiator is set if we're the initiator of the Noise handshake pattern.
+	// It is the same as initiator, unless the handshake fell back to XXfallback.
+	noiseInitiator bool
+
+	// anonymousInitiator is set if we don't prove our identity when initiating the handshake.
+	anonymousInitiator bool
+	// allowAnonymous is set if we accept initiators that don't prove their identity.
+	allowAnonymous bool
+
+	// anonymous is set if the initiator didn't prove its identity, and remoteID is synthetic.
+	anonymous bool
+
+	// negotiation is the security protocol negotiation, if it was passed by the upgrader.
+	negotiation *sec.Negotiation
+
+	// handshakeSpanCtx is the context of the span of the handshake, and stageSpan is the span of
+	// the current handshake stage. Both are only set during the handshake, if it is traced.
+	handshakeSpanCtx context.Context
+	stageSpan        trace.Span
+	// stage is the number of the next handshake stage.
+	stage int
+
 	// ConnectionState holds state information releated to the secureSession entity.
 	connectionState network.ConnectionState
+
+	// metricsTracer records the outcome of the handshake. It may be nil.
+	metricsTracer MetricsTracer
 }
 
 // newSecureSession creates a Noise session over the given insecureConn Conn, using
@@ -61,6 +120,25 @@ func newSecureSession(tpt *Transport, ctx context.Context, insecure net.Conn, re
 		initiatorEarlyDataHandler: initiatorEDH,
 		responderEarlyDataHandler: responderEDH,
 		checkPeerID:               checkPeerID,
+		localPayloadVersion:       tpt.payloadVersion,
+		exportable:                tpt.sessionExport,
+		localPadding:              tpt.padding,
+		keyWiping:                 tpt.keyWiping,
+		pipes:                     tpt.pipes,
+		keyPolicy:                 tpt.keyPolicy,
+		anonymousInitiator:        initiator && tpt.anonymous,
+		allowAnonymous:            tpt.allowAnonymous,
+		metricsTracer:             tpt.metricsTracer,
+		connectionState:           network.ConnectionState{CipherSuite: protocolName},
+	}
+
+	// The handshake honors the context's deadline by setting a deadline on the underlying
+	// connection, and is aborted by closing the connection if the context is canceled.
+	// The handshake timeout only applies if the caller didn't set a deadline.
+	if _, ok := ctx.Deadline(); !ok && tpt.handshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, tpt.handshakeTimeout)
+		defer cancel()
 	}
 
 	// the go-routine we create to run the handshake will
@@ -74,6 +152,8 @@ func newSecureSession(tpt *Transport, ctx context.Context, insecure net.Conn, re
 	case err := <-respCh:
 		if err != nil {
 			_ = s.insecureConn.Close()
+		} else if tpt.readAhead > 0 {
+			s.startReadAhead(ctx, tpt.readAhead)
 		}
 		return s, err
 
@@ -116,10 +196,18 @@ func (s *secureSession) ConnState() network.ConnectionState {
 }
 
 func (s *secureSession) SetDeadline(t time.Time) error {
+	if s.readAhead != nil {
+		s.readAhead.setDeadline(t)
+		return s.insecureConn.SetWriteDeadline(t)
+	}
 	return s.insecureConn.SetDeadline(t)
 }
 
 func (s *secureSession) SetReadDeadline(t time.Time) error {
+	if s.readAhead != nil {
+		s.readAhead.setDeadline(t)
+		return nil
+	}
 	return s.insecureConn.SetReadDeadline(t)
 }
 
@@ -128,7 +216,40 @@ func (s *secureSession) SetWriteDeadline(t time.Time) error {
 }
 
 func (s *secureSession) Close() error {
-	return s.insecureConn.Close()
+	if s.readAhead != nil {
+		s.readAhead.close()
+	}
+	err := s.insecureConn.Close()
+	if s.keyWiping {
+		s.wipeKeys()
+	}
+	return err
+}
+
+// wipeKeys wipes the session keys. It waits for concurrent Read and Write calls to return.
+// With read-ahead, the decryption key is wiped by the read-ahead go-routine when it exits.
+func (s *secureSession) wipeKeys() {
+	s.writeLock.Lock()
+	if s.enc != nil {
+		s.enc.wipe()
+	}
+	s.writeLock.Unlock()
+
+	if s.readAhead != nil {
+		return
+	}
+	s.readLock.Lock()
+	if s.dec != nil {
+		s.dec.wipe()
+	}
+	s.readLock.Unlock()
+}
+
+// IsAnonymous returns true if c is a Noise session whose initiator didn't prove its identity.
+// The remote peer ID of such a session is synthetic. See AcceptAnonymousInitiators.
+func IsAnonymous(c sec.SecureConn) bool {
+	s, ok := c.(*secureSession)
+	return ok && s.anonymous
 }
 
 func SessionWithConnState(s *secureSession, muxer protocol.ID) *secureSession {
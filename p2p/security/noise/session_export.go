@@ -0,0 +1,188 @@
+package noise
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	pool "github.com/libp2p/go-buffer-pool"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"github.com/libp2p/go-libp2p/core/sec"
+
+	"github.com/flynn/noise"
+)
+
+const exportedSessionVersion = 1
+
+var errSessionExported = errors.New("noise: session was exported")
+
+// exportedSession is the serialized state of a session.
+type exportedSession struct {
+	Version   int
+	Initiator bool
+	LocalPeer peer.ID
+	// RemotePublicKey is the protobuf-serialized public key of the remote peer
+	RemotePublicKey []byte
+
+	EncKey, DecKey     [32]byte
+	EncNonce, DecNonce uint64
+
+	LocalPayloadVersion, RemotePayloadVersion uint32
+
+	Padding PaddingScheme `json:",omitempty"`
+
+	StreamMultiplexer         protocol.ID
+	UsedEarlyMuxerNegotiation bool
+
+	// Buffered is data that was read from the connection, but not processed yet.
+	Buffered []byte
+	// Queued is decrypted data that wasn't read by the application yet.
+	Queued []byte
+}
+
+// ExportSession exports the state of an established session, such that the connection
+// can be handed over to a different process, for example during a hot restart.
+// The new process passes the state to ImportSession, together with the underlying
+// connection (e.g. by passing its file descriptor).
+//
+// This only covers the Noise layer. The caller is responsible for the state of any
+// layers above, for example the stream multiplexer.
+//
+// ExportSession waits for pending Read and Write calls to return. Callers should
+// interrupt these, e.g. by setting a deadline, after making sure that the peer doesn't
+// send any more data. After exporting, the session can't be used any more, but the
+// underlying connection is left open.
+//
+// The exported state contains the session keys. It must be kept secret.
+// ExportSession requires the WithSessionExport option.
+func (t *Transport) ExportSession(conn sec.SecureConn) ([]byte, error) {
+	s, ok := conn.(*secureSession)
+	if !ok {
+		return nil, fmt.Errorf("noise: not a Noise session: %T", conn)
+	}
+	if !s.exportable {
+		return nil, errors.New("noise: session export not enabled")
+	}
+
+	s.readLock.Lock()
+	defer s.readLock.Unlock()
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	if s.exported {
+		return nil, errSessionExported
+	}
+	if s.enc == nil || s.dec == nil {
+		return nil, errors.New("noise: handshake incomplete")
+	}
+	remoteKey, err := crypto.MarshalPublicKey(s.remoteKey)
+	if err != nil {
+		return nil, err
+	}
+	state := exportedSession{
+		Version:                   exportedSessionVersion,
+		Initiator:                 s.initiator,
+		LocalPeer:                 s.localID,
+		RemotePublicKey:           remoteKey,
+		EncKey:                    *s.enc.k,
+		DecKey:                    *s.dec.k,
+		EncNonce:                  s.enc.n,
+		DecNonce:                  s.dec.n,
+		LocalPayloadVersion:       s.localPayloadVersion,
+		RemotePayloadVersion:      s.remotePayloadVersion,
+		Padding:                   s.padding,
+		StreamMultiplexer:         s.connectionState.StreamMultiplexer,
+		UsedEarlyMuxerNegotiation: s.connectionState.UsedEarlyMuxerNegotiation,
+	}
+	if n := s.insecureReader.Buffered(); n > 0 {
+		b, _ := s.insecureReader.Peek(n)
+		state.Buffered = append([]byte(nil), b...)
+	}
+	if s.qbuf != nil {
+		state.Queued = append([]byte(nil), s.qbuf[s.qseek:]...)
+		pool.Put(s.qbuf)
+		s.qseek, s.qbuf = 0, nil
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+
+	// Using the session after exporting it would reuse nonces.
+	s.exported = true
+	s.enc.wipe()
+	s.dec.wipe()
+	s.enc, s.dec = nil, nil
+	return b, nil
+}
+
+// ImportSession imports a session exported by ExportSession.
+// insecure is the underlying connection of the exported session.
+// The session must have been exported by a transport using the same identity key.
+func (t *Transport) ImportSession(insecure net.Conn, state []byte) (sec.SecureConn, error) {
+	var es exportedSession
+	if err := json.Unmarshal(state, &es); err != nil {
+		return nil, fmt.Errorf("noise: failed to parse session state: %w", err)
+	}
+	if es.Version != exportedSessionVersion {
+		return nil, fmt.Errorf("noise: unsupported session state version: %d", es.Version)
+	}
+	if es.LocalPeer != t.localID {
+		return nil, fmt.Errorf("noise: session was exported by %s, not by %s", es.LocalPeer, t.localID)
+	}
+	remoteKey, err := crypto.UnmarshalPublicKey(es.RemotePublicKey)
+	if err != nil {
+		return nil, err
+	}
+	remoteID, err := peer.IDFromPublicKey(remoteKey)
+	if err != nil {
+		return nil, err
+	}
+
+	newCipher := cipherSuite.Cipher
+	if t.keyWiping {
+		newCipher = func(k [32]byte) noise.Cipher { return newWipingCipher(k) }
+	}
+	var r io.Reader = insecure
+	if len(es.Buffered) > 0 {
+		r = io.MultiReader(bytes.NewReader(es.Buffered), insecure)
+	}
+	s := &secureSession{
+		initiator:            es.Initiator,
+		localID:              t.localID,
+		localKey:             t.privateKey,
+		remoteID:             remoteID,
+		remoteKey:            remoteKey,
+		insecureConn:         insecure,
+		insecureReader:       bufio.NewReader(r),
+		enc:                  newCipherState(newCipher(es.EncKey), es.EncNonce),
+		dec:                  newCipherState(newCipher(es.DecKey), es.DecNonce),
+		exportable:           t.sessionExport,
+		keyWiping:            t.keyWiping,
+		localPayloadVersion:  es.LocalPayloadVersion,
+		remotePayloadVersion: es.RemotePayloadVersion,
+		padding:              es.Padding,
+		connectionState: network.ConnectionState{
+			StreamMultiplexer:         es.StreamMultiplexer,
+			UsedEarlyMuxerNegotiation: es.UsedEarlyMuxerNegotiation,
+			CipherSuite:               protocolName,
+		},
+	}
+	if t.sessionExport {
+		// Only keep the keys if they're needed.
+		s.enc.keepKey(es.EncKey, t.keyWiping)
+		s.dec.keepKey(es.DecKey, t.keyWiping)
+	}
+	if len(es.Queued) > 0 {
+		s.qbuf = pool.Get(len(es.Queued))
+		copy(s.qbuf, es.Queued)
+	}
+	return s, nil
+}
@@ -0,0 +1,90 @@
+package noise
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionExport(t *testing.T) {
+	initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	respTransport.sessionExport = true
+
+	initConn, respConn := connect(t, initTransport, respTransport)
+	defer initConn.Close()
+	defer respConn.Close()
+
+	_, err := initConn.Write([]byte("hello"))
+	require.NoError(t, err)
+	_, err = initConn.Write([]byte("world"))
+	require.NoError(t, err)
+	// give the second message time to arrive, so that it's buffered when we read the first one
+	time.Sleep(50 * time.Millisecond)
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(respConn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "he", string(buf))
+
+	state, err := respTransport.ExportSession(respConn)
+	require.NoError(t, err)
+	_, err = respConn.Read(buf)
+	require.ErrorIs(t, err, errSessionExported)
+	_, err = respConn.Write([]byte("foobar"))
+	require.ErrorIs(t, err, errSessionExported)
+	_, err = respTransport.ExportSession(respConn)
+	require.ErrorIs(t, err, errSessionExported)
+
+	// The session can only be imported by a transport with the same identity.
+	_, err = initTransport.ImportSession(respConn.insecureConn, state)
+	require.Error(t, err)
+
+	newRespTransport := &Transport{
+		localID:        respTransport.localID,
+		privateKey:     respTransport.privateKey,
+		payloadVersion: currentPayloadVersion,
+	}
+	imported, err := newRespTransport.ImportSession(respConn.insecureConn, state)
+	require.NoError(t, err)
+	require.Equal(t, initTransport.localID, imported.RemotePeer())
+	require.True(t, initTransport.privateKey.GetPublic().Equals(imported.RemotePublicKey()))
+
+	buf = make([]byte, 8)
+	_, err = io.ReadFull(imported, buf)
+	require.NoError(t, err)
+	require.Equal(t, "lloworld", string(buf))
+
+	// the imported session continues where the exported one left off, in both directions
+	_, err = imported.Write([]byte("foobar"))
+	require.NoError(t, err)
+	buf = make([]byte, 6)
+	_, err = io.ReadFull(initConn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "foobar", string(buf))
+
+	_, err = initConn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf = make([]byte, 4)
+	_, err = io.ReadFull(imported, buf)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(buf))
+}
+
+func TestSessionExportDisabled(t *testing.T) {
+	initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+
+	initConn, respConn := connect(t, initTransport, respTransport)
+	defer initConn.Close()
+	defer respConn.Close()
+
+	_, err := respTransport.ExportSession(respConn)
+	require.Error(t, err)
+	// the session keys are not kept
+	require.Nil(t, respConn.enc.k)
+	require.Nil(t, respConn.dec.k)
+}
@@ -0,0 +1,65 @@
+// Package noise implements the Noise security handshake of libp2p, as specified in
+// https://github.com/libp2p/specs/tree/master/noise.
+//
+// Transport is the security transport used by the libp2p Host. To secure a connection
+// independently of a Host, for example in proxies or testing tools, use Client and Server.
+package noise
+
+import (
+	"context"
+	"net"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/sec"
+)
+
+// Client secures conn by running the Noise handshake as the initiator, authenticating with our
+// libp2p identity key privkey.
+// If remote is not empty, the handshake fails unless the responder proves that it is remote.
+// Otherwise, any responder is accepted. This is susceptible to MITM attacks; use RemotePeer and
+// RemotePublicKey of the returned connection to find out who we're talking to.
+//
+// opts configure the handshake like they configure a Transport, see New.
+// conn is closed if the handshake fails, or if opts are invalid.
+func Client(ctx context.Context, conn net.Conn, privkey crypto.PrivKey, remote peer.ID, opts ...Option) (sec.SecureConn, error) {
+	t, err := New(ID, privkey, nil, opts...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var st sec.SecureTransport = t
+	if remote == "" {
+		st, err = t.WithSessionOptions(DisablePeerIDCheck())
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	c, err := st.SecureOutbound(ctx, conn, remote)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Server secures conn by running the Noise handshake as the responder, authenticating with our
+// libp2p identity key privkey.
+// If remote is not empty, the handshake fails unless the initiator proves that it is remote.
+// Otherwise, any initiator is accepted; use RemotePeer and RemotePublicKey of the returned
+// connection to find out who we're talking to.
+//
+// opts configure the handshake like they configure a Transport, see New.
+// conn is closed if the handshake fails, or if opts are invalid.
+func Server(ctx context.Context, conn net.Conn, privkey crypto.PrivKey, remote peer.ID, opts ...Option) (sec.SecureConn, error) {
+	t, err := New(ID, privkey, nil, opts...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c, err := t.SecureInbound(ctx, conn, remote)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
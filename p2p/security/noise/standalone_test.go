@@ -0,0 +1,94 @@
+package noise
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/sec"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKey(t *testing.T) (crypto.PrivKey, peer.ID) {
+	t.Helper()
+	priv, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	return priv, id
+}
+
+func TestStandalone(t *testing.T) {
+	clientKey, clientID := newTestKey(t)
+	serverKey, serverID := newTestKey(t)
+
+	for _, tc := range []struct {
+		name                       string
+		expectServer, expectClient peer.ID
+	}{
+		{name: "expected peers", expectServer: serverID, expectClient: clientID},
+		{name: "any peer"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, s := newConnPair(t)
+			var server sec.SecureConn
+			var serverErr error
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				server, serverErr = Server(context.Background(), s, serverKey, tc.expectClient)
+			}()
+			client, err := Client(context.Background(), c, clientKey, tc.expectServer)
+			require.NoError(t, err)
+			<-done
+			require.NoError(t, serverErr)
+			defer client.Close()
+			defer server.Close()
+
+			require.Equal(t, serverID, client.RemotePeer())
+			require.Equal(t, clientID, server.RemotePeer())
+
+			_, err = client.Write([]byte("foobar"))
+			require.NoError(t, err)
+			b := make([]byte, 6)
+			_, err = io.ReadFull(server, b)
+			require.NoError(t, err)
+			require.Equal(t, "foobar", string(b))
+		})
+	}
+}
+
+func TestStandalonePeerIDMismatch(t *testing.T) {
+	clientKey, _ := newTestKey(t)
+	serverKey, _ := newTestKey(t)
+	_, otherID := newTestKey(t)
+
+	c, s := newConnPair(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// the server fails as soon as the client closes the connection
+		Server(context.Background(), s, serverKey, "")
+	}()
+	client, err := Client(context.Background(), c, clientKey, otherID)
+	require.Error(t, err)
+	require.Nil(t, client)
+	<-done
+}
+
+func TestStandaloneInvalidOptions(t *testing.T) {
+	key, _ := newTestKey(t)
+	for _, secure := range []func(context.Context, net.Conn, crypto.PrivKey, peer.ID, ...Option) (sec.SecureConn, error){Client, Server} {
+		c, s := newConnPair(t)
+		defer s.Close()
+		_, err := secure(context.Background(), c, key, "", WithHandshakeTimeout(-1))
+		require.Error(t, err)
+		// conn is closed
+		_, err = c.Write([]byte("foobar"))
+		require.ErrorIs(t, err, net.ErrClosed)
+	}
+}
@@ -2,7 +2,10 @@ package noise
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
+	"time"
 
 	"github.com/libp2p/go-libp2p/core/canonicallog"
 	"github.com/libp2p/go-libp2p/core/crypto"
@@ -12,25 +15,165 @@ import (
 	tptu "github.com/libp2p/go-libp2p/p2p/net/upgrader"
 	"github.com/libp2p/go-libp2p/p2p/security/noise/pb"
 
+	logging "github.com/ipfs/go-log/v2"
 	manet "github.com/multiformats/go-multiaddr/net"
 )
 
+var log = logging.Logger("noise")
+
 // ID is the protocol ID for noise
 const ID = "/noise"
 const maxProtoNum = 100
 
+// DefaultHandshakeTimeout is the default timeout for the Noise handshake. See WithHandshakeTimeout.
+const DefaultHandshakeTimeout = 15 * time.Second
+
 type Transport struct {
 	protocolID protocol.ID
 	localID    peer.ID
 	privateKey crypto.PrivKey
 	muxers     []protocol.ID
+	// payloadVersion is the handshake payload version we announce.
+	// It is always currentPayloadVersion, except in tests.
+	payloadVersion uint32
+	// sessionExport is set if sessions can be exported using ExportSession
+	sessionExport bool
+	// padding are the supported padding schemes, in order of preference
+	padding []PaddingScheme
+	// readAhead is the number of messages decrypted ahead of the application. 0 disables read-ahead.
+	readAhead int
+	// keyWiping is set if the session keys are wiped when the session is closed
+	keyWiping bool
+	// pipes is set if Noise Pipes is enabled
+	pipes *noisePipes
+	// keyPolicy restricts the identity keys of remote peers
+	keyPolicy *sec.KeyPolicy
+	// handshakeTimeout is the maximum duration of a handshake. 0 disables the timeout.
+	handshakeTimeout time.Duration
+	// see WithEarlyDataHandler
+	earlyDataSend func() []byte
+	earlyDataRecv func([]byte) error
+	// anonymous is set if we don't prove our identity when initiating a handshake
+	anonymous bool
+	// allowAnonymous is set if we accept initiators that don't prove their identity
+	allowAnonymous bool
+	metricsTracer  MetricsTracer
+}
+
+// Option is an option for the Noise transport.
+type Option func(*Transport) error
+
+// WithSessionExport allows exporting established sessions using ExportSession,
+// so that they can be imported by a different process using ImportSession.
+//
+// This requires keeping the session keys in memory for the lifetime of the session.
+// Only enable this if you need to hand over connections on a hot restart.
+func WithSessionExport() Option {
+	return func(t *Transport) error {
+		t.sessionExport = true
+		return nil
+	}
+}
+
+// WithEarlyDataHandler attaches application data to the handshake payload, so that it is exchanged
+// without an additional round trip after the handshake. Both send and recv are optional.
+//
+// send is called once per handshake. The data it returns must not be larger than 4 KiB.
+// recv is called with the data sent by the remote peer, after the remote peer has been
+// authenticated. The data is empty if the remote peer didn't send any, for example because it
+// doesn't support early data. If recv returns an error, the handshake fails.
+//
+// Note that the responder sends its payload before the initiator is authenticated. The early data
+// sent by the responder is encrypted, but it may be received by an impostor. With Noise Pipes, the
+// initiator's data is not sent on IK handshakes, since the first IK message is replayable (see
+// WithNoisePipes).
+//
+// Early data is not exchanged on sessions created using WithSessionOptions with the EarlyData option.
+func WithEarlyDataHandler(send func() []byte, recv func([]byte) error) Option {
+	return func(t *Transport) error {
+		if t.earlyDataSend != nil || t.earlyDataRecv != nil {
+			return errors.New("noise: only one early data handler can be set")
+		}
+		t.earlyDataSend = send
+		t.earlyDataRecv = recv
+		return nil
+	}
+}
+
+// WithHandshakeTimeout sets the maximum duration of a handshake if the context passed to
+// SecureInbound and SecureOutbound doesn't have a deadline. This prevents peers that stall the
+// handshake from keeping the connection (and the goroutine handling it) around forever.
+// A timeout of 0 disables it. Defaults to DefaultHandshakeTimeout.
+func WithHandshakeTimeout(d time.Duration) Option {
+	return func(t *Transport) error {
+		if d < 0 {
+			return fmt.Errorf("noise: invalid handshake timeout: %s", d)
+		}
+		t.handshakeTimeout = d
+		return nil
+	}
+}
+
+// WithKeyPolicy rejects handshakes with peers whose identity keys are not allowed by p.
+func WithKeyPolicy(p sec.KeyPolicy) Option {
+	return func(t *Transport) error {
+		t.keyPolicy = &p
+		return nil
+	}
+}
+
+// WithAnonymousDial makes outbound handshakes omit our libp2p identity, so that the responder
+// authenticates itself, but we don't. This is useful for clients like gateways and browsers that
+// only need to authenticate the server. The handshake fails unless the responder accepts anonymous
+// initiators (see AcceptAnonymousInitiators).
+//
+// Inbound handshakes are not affected.
+// It can't be combined with WithNoisePipes: the static Noise key used by Noise Pipes is the same
+// for all handshakes, which would make the anonymous sessions linkable.
+func WithAnonymousDial() Option {
+	return func(t *Transport) error {
+		t.anonymous = true
+		return nil
+	}
+}
+
+// AcceptAnonymousInitiators accepts inbound handshakes from initiators that don't prove their libp2p
+// identity (see WithAnonymousDial). Such connections are assigned a random, synthetic peer ID,
+// which is different for every connection. Use IsAnonymous to distinguish them from authenticated
+// connections.
+//
+// Anonymous initiators are never accepted if SecureInbound is called with a peer ID.
+func AcceptAnonymousInitiators() Option {
+	return func(t *Transport) error {
+		t.allowAnonymous = true
+		return nil
+	}
+}
+
+// WithMetricsTracer records the duration and outcome of handshakes using mt.
+// Transports constructed by libp2p record handshake metrics using libp2p.PrometheusRegisterer,
+// unless metrics are disabled.
+func WithMetricsTracer(mt MetricsTracer) Option {
+	return func(t *Transport) error {
+		t.metricsTracer = mt
+		return nil
+	}
+}
+
+// UseDefaultMetricsTracer records the duration and outcome of handshakes using mt, unless a
+// metrics tracer was configured using WithMetricsTracer. libp2p calls it if metrics are enabled.
+// It must be called before the transport is used.
+func (t *Transport) UseDefaultMetricsTracer(mt MetricsTracer) {
+	if t.metricsTracer == nil {
+		t.metricsTracer = mt
+	}
 }
 
 var _ sec.SecureTransport = &Transport{}
 
 // New creates a new Noise transport using the given private key as its
 // libp2p identity key.
-func New(id protocol.ID, privkey crypto.PrivKey, muxers []tptu.StreamMuxer) (*Transport, error) {
+func New(id protocol.ID, privkey crypto.PrivKey, muxers []tptu.StreamMuxer, opts ...Option) (*Transport, error) {
 	localID, err := peer.IDFromPrivateKey(privkey)
 	if err != nil {
 		return nil, err
@@ -41,12 +184,26 @@ func New(id protocol.ID, privkey crypto.PrivKey, muxers []tptu.StreamMuxer) (*Tr
 		muxerIDs = append(muxerIDs, m.ID)
 	}
 
-	return &Transport{
-		protocolID: id,
-		localID:    localID,
-		privateKey: privkey,
-		muxers:     muxerIDs,
-	}, nil
+	t := &Transport{
+		protocolID:       id,
+		localID:          localID,
+		privateKey:       privkey,
+		muxers:           muxerIDs,
+		payloadVersion:   currentPayloadVersion,
+		handshakeTimeout: DefaultHandshakeTimeout,
+	}
+	for _, opt := range opts {
+		if err := opt(t); err != nil {
+			return nil, err
+		}
+	}
+	if t.sessionExport && t.readAhead > 0 {
+		return nil, errors.New("noise: read-ahead can't be combined with session export")
+	}
+	if t.anonymous && t.pipes != nil {
+		return nil, errors.New("noise: anonymous dialing can't be combined with Noise Pipes")
+	}
+	return t, nil
 }
 
 // SecureInbound runs the Noise handshake as the responder.
@@ -110,9 +267,13 @@ func newTransportEDH(t *Transport) *transportEarlyDataHandler {
 }
 
 func (i *transportEarlyDataHandler) Send(context.Context, net.Conn, peer.ID) *pb.NoiseExtensions {
-	return &pb.NoiseExtensions{
+	ext := &pb.NoiseExtensions{
 		StreamMuxers: protocol.ConvertToStrings(i.transport.muxers),
 	}
+	if i.transport.earlyDataSend != nil {
+		ext.EarlyData = i.transport.earlyDataSend()
+	}
+	return ext
 }
 
 func (i *transportEarlyDataHandler) Received(_ context.Context, _ net.Conn, extension *pb.NoiseExtensions) error {
@@ -120,6 +281,11 @@ func (i *transportEarlyDataHandler) Received(_ context.Context, _ net.Conn, exte
 	if extension != nil && len(extension.StreamMuxers) <= maxProtoNum {
 		i.receivedMuxers = protocol.ConvertFromStrings(extension.GetStreamMuxers())
 	}
+	if i.transport.earlyDataRecv != nil {
+		if err := i.transport.earlyDataRecv(extension.GetEarlyData()); err != nil {
+			return fmt.Errorf("early data rejected: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -3,24 +3,36 @@ package noise
 import (
 	"bytes"
 	"context"
+	crand "crypto/rand"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"math/rand"
 	"net"
+	"sync"
 	"testing"
 	"time"
 
 	"golang.org/x/crypto/chacha20poly1305"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
+	cpb "github.com/libp2p/go-libp2p/core/crypto/pb"
+	"github.com/libp2p/go-libp2p/core/network"
+	mocknetwork "github.com/libp2p/go-libp2p/core/network/mocks"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/libp2p/go-libp2p/core/sec"
 	"github.com/libp2p/go-libp2p/p2p/security/noise/pb"
+	sectest "github.com/libp2p/go-libp2p/p2p/security/testsuite"
 
+	"github.com/flynn/noise"
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
 )
 
 func newTestTransport(t *testing.T, typ, bits int) *Transport {
@@ -33,8 +45,9 @@ func newTestTransport(t *testing.T, typ, bits int) *Transport {
 		t.Fatal(err)
 	}
 	return &Transport{
-		localID:    id,
-		privateKey: priv,
+		localID:        id,
+		privateKey:     priv,
+		payloadVersion: currentPayloadVersion,
 	}
 }
 
@@ -125,6 +138,88 @@ func TestDeadlines(t *testing.T) {
 	}
 }
 
+func TestHandshakeTimeout(t *testing.T) {
+	respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	require.NoError(t, WithHandshakeTimeout(100*time.Millisecond)(respTransport))
+
+	// The initiator never sends anything.
+	init, resp := newConnPair(t)
+	defer init.Close()
+
+	start := time.Now()
+	_, err := respTransport.SecureInbound(context.Background(), resp, "")
+	require.Error(t, err)
+	var neterr net.Error
+	require.True(t, errors.As(err, &neterr) && neterr.Timeout(), "expected a timeout error, got: %s", err)
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	// the deadline of the context takes precedence over the handshake timeout
+	init2, resp2 := newConnPair(t)
+	defer init2.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err = respTransport.SecureInbound(ctx, resp2, "")
+	require.Error(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 300*time.Millisecond)
+
+	require.Error(t, WithHandshakeTimeout(-time.Second)(respTransport))
+}
+
+func TestHandshakeContextCanceled(t *testing.T) {
+	respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+
+	init, resp := newConnPair(t)
+	defer init.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	_, err := respTransport.SecureInbound(ctx, resp, "")
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+type handshakeRecord struct {
+	initiator bool
+	protocol  string
+	err       error
+}
+
+type mockMetricsTracer struct {
+	mx      sync.Mutex
+	records []handshakeRecord
+}
+
+func (m *mockMetricsTracer) CompletedHandshake(initiator bool, protocol string, _ time.Duration, err error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.records = append(m.records, handshakeRecord{initiator: initiator, protocol: protocol, err: err})
+}
+
+func TestHandshakeMetrics(t *testing.T) {
+	initTracer, respTracer := &mockMetricsTracer{}, &mockMetricsTracer{}
+	initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	require.NoError(t, WithMetricsTracer(initTracer)(initTransport))
+	respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	require.NoError(t, WithMetricsTracer(respTracer)(respTransport))
+
+	initConn, respConn := connect(t, initTransport, respTransport)
+	defer initConn.Close()
+	defer respConn.Close()
+	require.Equal(t, []handshakeRecord{{initiator: true, protocol: protocolName}}, initTracer.records)
+	require.Equal(t, []handshakeRecord{{initiator: false, protocol: protocolName}}, respTracer.records)
+
+	// failed handshakes are recorded as well
+	init, resp := newConnPair(t)
+	init.Close()
+	_, err := respTransport.SecureInbound(context.Background(), resp, "")
+	require.Error(t, err)
+	require.Len(t, respTracer.records, 2)
+	require.Error(t, respTracer.records[1].err)
+
+	// the default tracer doesn't panic
+	NewMetricsTracer(WithRegisterer(prometheus.NewRegistry())).CompletedHandshake(true, protocolName, time.Second, nil)
+}
+
 func TestIDs(t *testing.T) {
 	initTransport := newTestTransport(t, crypto.Ed25519, 2048)
 	respTransport := newTestTransport(t, crypto.Ed25519, 2048)
@@ -234,6 +329,48 @@ func TestPeerIDMismatchInboundFailsHandshake(t *testing.T) {
 	<-done
 }
 
+func TestKeyPolicy(t *testing.T) {
+	t.Run("disallowed key type", func(t *testing.T) {
+		initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		require.NoError(t, WithKeyPolicy(sec.KeyPolicy{AllowedTypes: []cpb.KeyType{cpb.KeyType_ECDSA}})(respTransport))
+		init, resp := newConnPair(t)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			conn, err := initTransport.SecureOutbound(context.Background(), init, respTransport.localID)
+			if err == nil {
+				_, err = conn.Read([]byte{0})
+			}
+			assert.Error(t, err)
+		}()
+
+		_, err := respTransport.SecureInbound(context.Background(), resp, "")
+		require.ErrorIs(t, err, sec.ErrKeyNotAllowed)
+		<-done
+	})
+
+	t.Run("RSA key too small", func(t *testing.T) {
+		initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		respTransport := newTestTransport(t, crypto.RSA, 2048)
+		require.NoError(t, WithKeyPolicy(sec.KeyPolicy{MinRSABits: 3072})(initTransport))
+		init, resp := newConnPair(t)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, err := respTransport.SecureInbound(context.Background(), resp, "")
+			assert.Error(t, err)
+		}()
+
+		_, err := initTransport.SecureOutbound(context.Background(), init, respTransport.localID)
+		require.ErrorIs(t, err, sec.ErrKeyNotAllowed)
+		init.Close()
+		<-done
+	})
+}
+
 func TestPeerIDInboundCheckDisabled(t *testing.T) {
 	initTransport := newTestTransport(t, crypto.Ed25519, 2048)
 	respTransport := newTestTransport(t, crypto.Ed25519, 2048)
@@ -329,6 +466,8 @@ func TestHandshakeXX(t *testing.T) {
 	if !bytes.Equal(before, after) {
 		t.Errorf("Message mismatch. %v != %v", before, after)
 	}
+	require.Equal(t, "Noise_XX_25519_ChaChaPoly_SHA256", initConn.ConnState().CipherSuite)
+	require.Equal(t, "Noise_XX_25519_ChaChaPoly_SHA256", respConn.ConnState().CipherSuite)
 }
 
 func TestBufferEqEncPayload(t *testing.T) {
@@ -598,6 +737,74 @@ func TestEarlyDataRejected(t *testing.T) {
 	})
 }
 
+func TestEarlyDataHandler(t *testing.T) {
+	newTransport := func(t *testing.T, send func() []byte, recv func([]byte) error) *Transport {
+		tpt := newTestTransport(t, crypto.Ed25519, 2048)
+		require.NoError(t, WithEarlyDataHandler(send, recv)(tpt))
+		return tpt
+	}
+
+	t.Run("exchanging data", func(t *testing.T) {
+		var initReceived, respReceived []byte
+		initTransport := newTransport(t,
+			func() []byte { return []byte("from initiator") },
+			func(b []byte) error { initReceived = b; return nil },
+		)
+		respTransport := newTransport(t,
+			func() []byte { return []byte("from responder") },
+			func(b []byte) error { respReceived = b; return nil },
+		)
+		initConn, respConn := connect(t, initTransport, respTransport)
+		defer initConn.Close()
+		defer respConn.Close()
+		require.Equal(t, "from responder", string(initReceived))
+		require.Equal(t, "from initiator", string(respReceived))
+	})
+
+	t.Run("no data sent", func(t *testing.T) {
+		called := false
+		respTransport := newTransport(t, nil, func(b []byte) error {
+			called = true
+			require.Empty(t, b)
+			return nil
+		})
+		initConn, respConn := connect(t, newTestTransport(t, crypto.Ed25519, 2048), respTransport)
+		defer initConn.Close()
+		defer respConn.Close()
+		require.True(t, called)
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		initTransport := newTransport(t, nil, func([]byte) error { return errors.New("nope") })
+		respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		init, resp := newConnPair(t)
+		defer init.Close()
+		defer resp.Close()
+		go respTransport.SecureInbound(context.Background(), resp, "")
+		_, err := initTransport.SecureOutbound(context.Background(), init, respTransport.localID)
+		require.ErrorContains(t, err, "nope")
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		initTransport := newTransport(t, func() []byte { return make([]byte, maxEarlyDataSize+1) }, nil)
+		respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		init, resp := newConnPair(t)
+		defer init.Close()
+		defer resp.Close()
+		go respTransport.SecureInbound(context.Background(), resp, "")
+		_, err := initTransport.SecureOutbound(context.Background(), init, respTransport.localID)
+		require.ErrorContains(t, err, "early data too large")
+	})
+
+	t.Run("setting twice", func(t *testing.T) {
+		priv, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		require.NoError(t, err)
+		send := func() []byte { return nil }
+		_, err = New(ID, priv, nil, WithEarlyDataHandler(send, nil), WithEarlyDataHandler(send, nil))
+		require.Error(t, err)
+	})
+}
+
 func TestEarlyfffDataAcceptedWithNoHandler(t *testing.T) {
 	clientEDH := &earlyDataHandler{
 		send: func(ctx context.Context, conn net.Conn, id peer.ID) *pb.NoiseExtensions {
@@ -707,3 +914,296 @@ func TestHandshakeWithTransportEarlyData(t *testing.T) {
 		})
 	}
 }
+
+func TestHandshakePayloadTooLarge(t *testing.T) {
+	clientEDH := &earlyDataHandler{
+		send: func(ctx context.Context, conn net.Conn, id peer.ID) *pb.NoiseExtensions {
+			return &pb.NoiseExtensions{WebtransportCerthashes: [][]byte{make([]byte, maxExtensionsSize)}}
+		},
+	}
+	initTransport, err := newTestTransport(t, crypto.Ed25519, 2048).WithSessionOptions(EarlyData(clientEDH, nil))
+	require.NoError(t, err)
+	respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+
+	initConn, respConn := newConnPair(t)
+
+	errChan := make(chan error)
+	go func() {
+		_, err := respTransport.SecureInbound(context.Background(), initConn, "")
+		errChan <- err
+	}()
+
+	conn, err := initTransport.SecureOutbound(context.Background(), respConn, respTransport.localID)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	select {
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("timeout")
+	case err := <-errChan:
+		require.ErrorContains(t, err, "extensions in handshake payload too large")
+	}
+}
+
+func TestHandshakeMemoryAccounting(t *testing.T) {
+	handshake := func(t *testing.T, scope network.ConnScope) error {
+		initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		initConn, respConn := newConnPair(t)
+
+		errChan := make(chan error, 1)
+		go func() {
+			_, err := initTransport.SecureOutbound(context.Background(), initConn, respTransport.localID)
+			errChan <- err
+		}()
+		_, err := respTransport.SecureInbound(network.WithConnScope(context.Background(), scope), respConn, "")
+		respConn.Close()
+		<-errChan
+		return err
+	}
+
+	t.Run("reservation succeeds", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		scope := mocknetwork.NewMockResourceScopeSpan(ctrl)
+		var reserved int
+		// The responder reads two handshake messages.
+		scope.EXPECT().ReserveMemory(gomock.Any(), network.ReservationPriorityMedium).Do(func(size int, _ uint8) {
+			require.Zero(t, reserved)
+			reserved = size
+		}).Times(2)
+		scope.EXPECT().ReleaseMemory(gomock.Any()).Do(func(size int) {
+			require.Equal(t, reserved, size)
+			reserved = 0
+		}).Times(2)
+		require.NoError(t, handshake(t, scope))
+	})
+
+	t.Run("reservation fails", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		scope := mocknetwork.NewMockResourceScopeSpan(ctrl)
+		scope.EXPECT().ReserveMemory(gomock.Any(), gomock.Any()).Return(network.ErrResourceLimitExceeded)
+		require.ErrorIs(t, handshake(t, scope), network.ErrResourceLimitExceeded)
+	})
+}
+
+func TestCheckHandshakePayloadSize(t *testing.T) {
+	marshal := func(t *testing.T, p *pb.NoiseHandshakePayload) []byte {
+		b, err := proto.Marshal(p)
+		require.NoError(t, err)
+		return b
+	}
+	require.NoError(t, checkHandshakePayloadSize(marshal(t, &pb.NoiseHandshakePayload{
+		IdentityKey: make([]byte, 100),
+		IdentitySig: make([]byte, 100),
+		Extensions:  &pb.NoiseExtensions{StreamMuxers: []string{"/yamux/1.0.0"}},
+	})))
+	require.ErrorContains(t,
+		checkHandshakePayloadSize(marshal(t, &pb.NoiseHandshakePayload{IdentityKey: make([]byte, maxIdentityKeySize)})),
+		"identity key in handshake payload too large",
+	)
+	require.ErrorContains(t,
+		checkHandshakePayloadSize(marshal(t, &pb.NoiseHandshakePayload{IdentitySig: make([]byte, maxIdentitySigSize)})),
+		"identity signature in handshake payload too large",
+	)
+	// unknown fields
+	b := protowire.AppendTag(nil, 42, protowire.BytesType)
+	b = protowire.AppendBytes(b, make([]byte, maxUnknownFieldsSize))
+	require.ErrorContains(t, checkHandshakePayloadSize(b), "unknown fields in handshake payload too large")
+	// the version field with an unexpected wire type is an unknown field
+	b = protowire.AppendTag(nil, versionField, protowire.BytesType)
+	b = protowire.AppendBytes(b, make([]byte, maxUnknownFieldsSize))
+	require.ErrorContains(t, checkHandshakePayloadSize(b), "unknown fields in handshake payload too large")
+	// malformed payload
+	require.Error(t, checkHandshakePayloadSize([]byte{0xff}))
+}
+
+func TestPayloadVersionCompatibility(t *testing.T) {
+	// futurePayloadVersion emulates a peer that implements a payload format we don't know yet.
+	const futurePayloadVersion = currentPayloadVersion + 1
+	versions := []uint32{payloadVersionLegacy, payloadVersion1, futurePayloadVersion}
+
+	for _, initVersion := range versions {
+		for _, respVersion := range versions {
+			t.Run(fmt.Sprintf("initiator v%d, responder v%d", initVersion, respVersion), func(t *testing.T) {
+				initTransport := newTestTransportWithMuxers(t, crypto.Ed25519, 2048, []protocol.ID{"muxer1"})
+				initTransport.payloadVersion = initVersion
+				respTransport := newTestTransportWithMuxers(t, crypto.Ed25519, 2048, []protocol.ID{"muxer1"})
+				respTransport.payloadVersion = respVersion
+
+				initConn, respConn := connect(t, initTransport, respTransport)
+				defer initConn.Close()
+				defer respConn.Close()
+
+				expected := initVersion
+				if respVersion < expected {
+					expected = respVersion
+				}
+				require.Equal(t, expected, initConn.payloadVersion())
+				require.Equal(t, expected, respConn.payloadVersion())
+				require.Equal(t, respVersion, initConn.remotePayloadVersion)
+				require.Equal(t, initVersion, respConn.remotePayloadVersion)
+
+				// The extensions are understood regardless of the payload version.
+				require.Equal(t, protocol.ID("muxer1"), initConn.connectionState.StreamMultiplexer)
+				require.Equal(t, protocol.ID("muxer1"), respConn.connectionState.StreamMultiplexer)
+			})
+		}
+	}
+}
+
+func TestPayloadFromFutureVersion(t *testing.T) {
+	initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	initConn, respConn := connect(t, initTransport, respTransport)
+	defer initConn.Close()
+	defer respConn.Close()
+
+	kp, err := noise.DH25519.GenerateKeypair(crand.Reader)
+	require.NoError(t, err)
+	payload, err := initConn.generateHandshakePayload(kp, &pb.NoiseExtensions{StreamMuxers: []string{"muxer1"}})
+	require.NoError(t, err)
+
+	// A future version might add new fields to the payload and the extensions,
+	// for example a signature using a new prefix.
+	future := protowire.AppendTag(nil, versionField, protowire.VarintType)
+	future = protowire.AppendVarint(future, uint64(currentPayloadVersion+1))
+	future = protowire.AppendTag(future, 7, protowire.BytesType)
+	future = protowire.AppendBytes(future, []byte("new-prefix-signature"))
+	ext := protowire.AppendTag(nil, 4, protowire.BytesType)
+	ext = protowire.AppendBytes(ext, []byte("new-extension"))
+	future = protowire.AppendTag(future, extensionsField, protowire.BytesType)
+	future = protowire.AppendBytes(future, ext)
+
+	s := &secureSession{localPayloadVersion: currentPayloadVersion}
+	rcvdExt, err := s.handleRemoteHandshakePayload(append(payload, future...), kp.Public)
+	require.NoError(t, err)
+	require.Equal(t, initTransport.localID, s.remoteID)
+	require.Equal(t, currentPayloadVersion+1, s.remotePayloadVersion)
+	require.Equal(t, currentPayloadVersion, s.payloadVersion())
+	// Later occurrences of a message field are merged into earlier ones.
+	require.Equal(t, []string{"muxer1"}, rcvdExt.GetStreamMuxers())
+}
+
+func TestConformance(t *testing.T) {
+	sectest.SubtestAll(t, func(t *testing.T) (sec.SecureTransport, peer.ID) {
+		priv, _, err := crypto.GenerateEd25519Key(crand.Reader)
+		require.NoError(t, err)
+		tr, err := New(ID, priv, nil)
+		require.NoError(t, err)
+		return tr, tr.localID
+	})
+}
+
+func TestAnonymousInitiator(t *testing.T) {
+	t.Run("accepted", func(t *testing.T) {
+		initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		require.NoError(t, WithAnonymousDial()(initTransport))
+		require.NoError(t, AcceptAnonymousInitiators()(respTransport))
+		initConn, respConn := connect(t, initTransport, respTransport)
+		defer initConn.Close()
+		defer respConn.Close()
+
+		// The initiator authenticated the responder.
+		require.Equal(t, respTransport.localID, initConn.RemotePeer())
+		require.False(t, IsAnonymous(initConn))
+		// The responder assigned a synthetic identity to the initiator.
+		require.True(t, IsAnonymous(respConn))
+		require.NotEqual(t, initTransport.localID, respConn.RemotePeer())
+		id, err := peer.IDFromPublicKey(respConn.RemotePublicKey())
+		require.NoError(t, err)
+		require.Equal(t, respConn.RemotePeer(), id)
+
+		before := respConn.RemotePeer()
+		initConn2, respConn2 := connect(t, initTransport, respTransport)
+		defer initConn2.Close()
+		defer respConn2.Close()
+		require.NotEqual(t, before, respConn2.RemotePeer())
+
+		msg := []byte("hello")
+		_, err = initConn.Write(msg)
+		require.NoError(t, err)
+		buf := make([]byte, len(msg))
+		_, err = io.ReadFull(respConn, buf)
+		require.NoError(t, err)
+		require.Equal(t, msg, buf)
+	})
+
+	t.Run("not allowed", func(t *testing.T) {
+		initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		require.NoError(t, WithAnonymousDial()(initTransport))
+		init, resp := newConnPair(t)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			conn, err := initTransport.SecureOutbound(context.Background(), init, respTransport.localID)
+			if err == nil {
+				_, err = conn.Read([]byte{0})
+			}
+			assert.Error(t, err)
+		}()
+
+		_, err := respTransport.SecureInbound(context.Background(), resp, "")
+		require.Error(t, err)
+		<-done
+	})
+
+	t.Run("peer ID expected", func(t *testing.T) {
+		initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		require.NoError(t, WithAnonymousDial()(initTransport))
+		require.NoError(t, AcceptAnonymousInitiators()(respTransport))
+		init, resp := newConnPair(t)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			conn, err := initTransport.SecureOutbound(context.Background(), init, respTransport.localID)
+			if err == nil {
+				_, err = conn.Read([]byte{0})
+			}
+			assert.Error(t, err)
+		}()
+
+		_, err := respTransport.SecureInbound(context.Background(), resp, initTransport.localID)
+		require.Error(t, err)
+		<-done
+	})
+
+	t.Run("not combined with Noise Pipes", func(t *testing.T) {
+		priv, _, err := crypto.GenerateEd25519Key(crand.Reader)
+		require.NoError(t, err)
+		_, err = New(ID, priv, nil, WithAnonymousDial(), WithNoisePipes())
+		require.Error(t, err)
+		_, err = New(ID, priv, nil, WithNoisePipes(), WithAnonymousDial())
+		require.Error(t, err)
+		// accepting anonymous initiators is fine
+		_, err = New(ID, priv, nil, AcceptAnonymousInitiators(), WithNoisePipes())
+		require.NoError(t, err)
+	})
+
+	t.Run("responder still authenticated", func(t *testing.T) {
+		initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+		other := newTestTransport(t, crypto.Ed25519, 2048)
+		require.NoError(t, WithAnonymousDial()(initTransport))
+		require.NoError(t, AcceptAnonymousInitiators()(respTransport))
+		init, resp := newConnPair(t)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, err := respTransport.SecureInbound(context.Background(), resp, "")
+			assert.Error(t, err)
+		}()
+
+		_, err := initTransport.SecureOutbound(context.Background(), init, other.localID)
+		require.Error(t, err)
+		init.Close()
+		<-done
+	})
+}
@@ -0,0 +1,218 @@
+package noise
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/flynn/noise"
+	"golang.org/x/crypto/chacha20"
+	//lint:ignore SA1019 used to implement the full ChaCha20-Poly1305 construction
+	"golang.org/x/crypto/poly1305"
+)
+
+// WithKeyWiping wipes the session keys when the session is closed.
+// Closing the session waits for concurrent Read and Write calls to return.
+//
+// The ChaCha20-Poly1305 AEAD of golang.org/x/crypto/chacha20poly1305 keeps a copy of the key that
+// can't be accessed. With key wiping, the session ciphers are a ChaCha20-Poly1305 implementation of
+// this package instead, which owns its key (see wipingCipher). It doesn't use the assembly
+// implementation of the AEAD, so encryption and decryption are slower.
+//
+// Independent of this option, the secrets that are only used during the handshake (the ephemeral
+// and static Noise keys and the Diffie-Hellman outputs) are wiped once the handshake completes.
+// The static Noise key is kept if Noise Pipes is enabled.
+//
+// This option doesn't guarantee that no copies of the keys remain in memory: the Noise library
+// derives the session keys from the chaining key, and neither the chaining key nor its copies of
+// the derived keys can be wiped. Encrypting and decrypting also leaves ChaCha20 state derived from
+// the key on goroutine stacks, until the memory is reused.
+//
+// When building with the noise_mlock build tag, the session keys owned by this package are
+// allocated in locked memory, outside of the Go heap. See mlock_unix.go.
+func WithKeyWiping() Option {
+	return func(t *Transport) error {
+		t.keyWiping = true
+		return nil
+	}
+}
+
+var (
+	errKeysWiped = errors.New("noise: session keys were wiped")
+	errOpen      = errors.New("noise: message authentication failed")
+)
+
+func wipeBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// handshakeCipherSuite keeps track of the secrets created during a handshake,
+// so that they can be wiped once the handshake completes.
+type handshakeCipherSuite struct {
+	noise.CipherSuite
+	// keyWiping is set if the ciphers are wipingCiphers
+	keyWiping bool
+
+	dhOutputs     [][]byte
+	ephemeralKeys [][]byte
+	ciphers       []*wipingCipher
+}
+
+func (cs *handshakeCipherSuite) GenerateKeypair(rng io.Reader) (noise.DHKey, error) {
+	kp, err := cs.CipherSuite.GenerateKeypair(rng)
+	if err == nil {
+		cs.ephemeralKeys = append(cs.ephemeralKeys, kp.Private)
+	}
+	return kp, err
+}
+
+func (cs *handshakeCipherSuite) DH(privkey, pubkey []byte) ([]byte, error) {
+	out, err := cs.CipherSuite.DH(privkey, pubkey)
+	if err == nil {
+		cs.dhOutputs = append(cs.dhOutputs, out)
+	}
+	return out, err
+}
+
+func (cs *handshakeCipherSuite) Cipher(k [32]byte) noise.Cipher {
+	if !cs.keyWiping {
+		return cs.CipherSuite.Cipher(k)
+	}
+	c := newWipingCipher(k)
+	cs.ciphers = append(cs.ciphers, c)
+	return c
+}
+
+// wipe wipes the secrets created during the handshake. The keys of the ciphers used by the session
+// cipher states are kept.
+func (cs *handshakeCipherSuite) wipe(session ...*cipherState) {
+	for _, out := range cs.dhOutputs {
+		wipeBytes(out)
+	}
+	for _, k := range cs.ephemeralKeys {
+		wipeBytes(k)
+	}
+ciphers:
+	for _, c := range cs.ciphers {
+		for _, st := range session {
+			if st != nil && st.c == c {
+				continue ciphers
+			}
+		}
+		c.wipe()
+	}
+	cs.dhOutputs, cs.ephemeralKeys, cs.ciphers = nil, nil, nil
+}
+
+// wipingCipher is a ChaCha20-Poly1305 cipher that owns its key, so that the key can be wiped.
+// It implements the construction of RFC 8439 like the generic implementation of
+// golang.org/x/crypto/chacha20poly1305, using the ChaCha20 and Poly1305 primitives.
+//
+// wipingCipher is not safe for concurrent use, see aeadCipher.
+type wipingCipher struct {
+	// key is allocated by allocKey, and nil once the cipher was wiped
+	key   *[32]byte
+	nonce nonceBuffer
+}
+
+var _ noise.Cipher = &wipingCipher{}
+
+func newWipingCipher(k [32]byte) *wipingCipher {
+	c := &wipingCipher{key: allocKey(true)}
+	*c.key = k
+	return c
+}
+
+func (c *wipingCipher) Encrypt(out []byte, n uint64, ad, plaintext []byte) []byte {
+	return c.seal(out, c.nonce.set(n), ad, plaintext)
+}
+
+func (c *wipingCipher) Decrypt(out []byte, n uint64, ad, ciphertext []byte) ([]byte, error) {
+	return c.open(out, c.nonce.set(n), ad, ciphertext)
+}
+
+// seal implements the AEAD encryption of RFC 8439, section 2.8.
+func (c *wipingCipher) seal(out, nonce, ad, plaintext []byte) []byte {
+	ret, buf := sliceForAppend(out, len(plaintext)+poly1305.TagSize)
+	ciphertext, tag := buf[:len(plaintext)], buf[len(plaintext):]
+
+	var polyKey [32]byte
+	s, _ := chacha20.NewUnauthenticatedCipher(c.key[:], nonce)
+	s.XORKeyStream(polyKey[:], polyKey[:])
+	s.SetCounter(1) // skip the rest of the first block, which was used for the Poly1305 key
+	s.XORKeyStream(ciphertext, plaintext)
+	*s = chacha20.Cipher{}
+
+	p := poly1305.New(&polyKey)
+	wipeBytes(polyKey[:])
+	writeWithPadding(p, ad)
+	writeWithPadding(p, ciphertext)
+	writeLengths(p, len(ad), len(plaintext))
+	p.Sum(tag[:0])
+	return ret
+}
+
+// open implements the AEAD decryption of RFC 8439, section 2.8.
+// The tag is verified before anything is decrypted.
+func (c *wipingCipher) open(out, nonce, ad, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < poly1305.TagSize {
+		return nil, errOpen
+	}
+	tag := ciphertext[len(ciphertext)-poly1305.TagSize:]
+	ciphertext = ciphertext[:len(ciphertext)-poly1305.TagSize]
+
+	var polyKey [32]byte
+	s, _ := chacha20.NewUnauthenticatedCipher(c.key[:], nonce)
+	defer func() { *s = chacha20.Cipher{} }()
+	s.XORKeyStream(polyKey[:], polyKey[:])
+	s.SetCounter(1)
+
+	p := poly1305.New(&polyKey)
+	wipeBytes(polyKey[:])
+	writeWithPadding(p, ad)
+	writeWithPadding(p, ciphertext)
+	writeLengths(p, len(ad), len(ciphertext))
+	if !p.Verify(tag) {
+		return nil, errOpen
+	}
+	ret, plaintext := sliceForAppend(out, len(ciphertext))
+	s.XORKeyStream(plaintext, ciphertext)
+	return ret, nil
+}
+
+// wipe wipes the key. The cipher can't be used afterwards.
+func (c *wipingCipher) wipe() {
+	if c.key != nil {
+		freeKey(c.key)
+		c.key = nil
+	}
+}
+
+func writeWithPadding(p *poly1305.MAC, b []byte) {
+	p.Write(b)
+	if rem := len(b) % 16; rem != 0 {
+		var buf [16]byte
+		p.Write(buf[:16-rem])
+	}
+}
+
+func writeLengths(p *poly1305.MAC, adLen, dataLen int) {
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], uint64(adLen))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(dataLen))
+	p.Write(buf[:])
+}
+
+// sliceForAppend extends in by n bytes. It returns the extended slice, and the n bytes appended.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
@@ -0,0 +1,227 @@
+package noise
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func TestKeyWiping(t *testing.T) {
+	initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	initTransport.keyWiping = true
+
+	initConn, respConn := connect(t, initTransport, respTransport)
+	defer respConn.Close()
+
+	// the keys are not kept, since session export is disabled
+	require.Nil(t, initConn.enc.k)
+	require.Nil(t, initConn.dec.k)
+	// the ciphers own their keys
+	require.IsType(t, &wipingCipher{}, initConn.enc.c)
+	require.IsType(t, &wipingCipher{}, initConn.dec.c)
+	enc, dec := initConn.enc.c.(*wipingCipher).key, initConn.dec.c.(*wipingCipher).key
+	require.NotEqual(t, [32]byte{}, *enc)
+	require.NotEqual(t, [32]byte{}, *dec)
+
+	msg := []byte("foobar")
+	_, err := initConn.Write(msg)
+	require.NoError(t, err)
+	buf := make([]byte, len(msg))
+	_, err = io.ReadFull(respConn, buf)
+	require.NoError(t, err)
+	require.Equal(t, msg, buf)
+	_, err = respConn.Write(msg)
+	require.NoError(t, err)
+	_, err = io.ReadFull(initConn, buf)
+	require.NoError(t, err)
+	require.Equal(t, msg, buf)
+	require.NoError(t, initConn.Close())
+	require.Equal(t, [32]byte{}, *enc)
+	require.Equal(t, [32]byte{}, *dec)
+
+	require.Nil(t, initConn.enc.c)
+	require.Nil(t, initConn.dec.c)
+	_, err = initConn.encrypt(nil, []byte("foobar"))
+	require.ErrorIs(t, err, errKeysWiped)
+
+	// without key wiping, the ciphers are kept
+	require.NotNil(t, respConn.enc.c)
+	require.NotNil(t, respConn.dec.c)
+	require.IsType(t, &aeadCipher{}, respConn.enc.c)
+}
+
+func TestKeyWipingSessionExport(t *testing.T) {
+	initTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	respTransport := newTestTransport(t, crypto.Ed25519, 2048)
+	initTransport.keyWiping = true
+	initTransport.sessionExport = true
+
+	initConn, respConn := connect(t, initTransport, respTransport)
+	defer respConn.Close()
+
+	enc, dec := initConn.enc.k, initConn.dec.k
+	require.NotEqual(t, [32]byte{}, *enc)
+	require.NotEqual(t, [32]byte{}, *dec)
+	require.NoError(t, initConn.Close())
+	require.Equal(t, [32]byte{}, *enc)
+	require.Equal(t, [32]byte{}, *dec)
+	require.Nil(t, initConn.enc.k)
+	require.Nil(t, initConn.dec.k)
+}
+
+func TestHandshakeSecretsWiped(t *testing.T) {
+	cs := &handshakeCipherSuite{CipherSuite: cipherSuite}
+	kp, err := cs.GenerateKeypair(rand.Reader)
+	require.NoError(t, err)
+	out, err := cs.DH(kp.Private, kp.Public)
+	require.NoError(t, err)
+
+	cs.wipe()
+	require.Equal(t, make([]byte, len(kp.Private)), kp.Private)
+	require.Equal(t, make([]byte, len(out)), out)
+}
+
+func TestHandshakeCiphersWiped(t *testing.T) {
+	cs := &handshakeCipherSuite{CipherSuite: cipherSuite, keyWiping: true}
+	hs := cs.Cipher([32]byte{1}).(*wipingCipher)
+	session := newCipherState(cs.Cipher([32]byte{2}), 0)
+
+	key := hs.key
+	cs.wipe(session, nil)
+	require.Equal(t, [32]byte{}, *key)
+	require.Nil(t, hs.key)
+	require.Equal(t, [32]byte{2}, *session.c.(*wipingCipher).key)
+}
+
+func TestWipingCipher(t *testing.T) {
+	var k [32]byte
+	_, err := rand.Read(k[:])
+	require.NoError(t, err)
+	wc := newWipingCipher(k)
+	ac := chachaPolyFn{}.Cipher(k)
+
+	// The wiping cipher is interoperable with the ChaCha20-Poly1305 AEAD.
+	for _, size := range []int{0, 1, 15, 16, 17, 64, 1000} {
+		plaintext := make([]byte, size)
+		_, err := rand.Read(plaintext)
+		require.NoError(t, err)
+		ad := plaintext[:size/2]
+		n := uint64(size)
+
+		ciphertext := wc.Encrypt(nil, n, ad, plaintext)
+		require.Equal(t, ac.Encrypt(nil, n, ad, plaintext), ciphertext)
+		decrypted, err := ac.Decrypt(nil, n, ad, ciphertext)
+		require.NoError(t, err)
+		require.True(t, bytes.Equal(plaintext, decrypted))
+		decrypted, err = wc.Decrypt(nil, n, ad, ciphertext)
+		require.NoError(t, err)
+		require.True(t, bytes.Equal(plaintext, decrypted))
+
+		// in place
+		buf := append([]byte(nil), plaintext...)
+		ciphertext = wc.Encrypt(buf[:0], n, ad, buf)
+		decrypted, err = wc.Decrypt(ciphertext[:0], n, ad, ciphertext)
+		require.NoError(t, err)
+		require.True(t, bytes.Equal(plaintext, decrypted))
+
+		ciphertext = wc.Encrypt(nil, n, ad, plaintext)
+		ciphertext[0] ^= 1
+		_, err = wc.Decrypt(nil, n, ad, ciphertext)
+		require.ErrorIs(t, err, errOpen)
+		_, err = wc.Decrypt(nil, n+1, ad, wc.Encrypt(nil, n, ad, plaintext))
+		require.ErrorIs(t, err, errOpen)
+	}
+	_, err = wc.Decrypt(nil, 0, nil, make([]byte, 15))
+	require.ErrorIs(t, err, errOpen)
+
+	key := wc.key
+	wc.wipe()
+	require.Equal(t, [32]byte{}, *key)
+	require.Nil(t, wc.key)
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	require.NoError(t, err)
+	return b
+}
+
+// TestWipingCipherRFC8439 tests the wiping cipher against the AEAD test vector of RFC 8439,
+// section 2.8.2, and checks that tampered and forged messages are rejected.
+func TestWipingCipherRFC8439(t *testing.T) {
+	var k [32]byte
+	copy(k[:], mustDecodeHex(t, "808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f"))
+	nonce := mustDecodeHex(t, "07000000 4041424344454647")
+	ad := mustDecodeHex(t, "50515253c0c1c2c3c4c5c6c7")
+	plaintext := []byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+	expected := mustDecodeHex(t, ""+
+		"d31a8d34648e60db7b86afbc53ef7ec2 a4aded51296e08fea9e2b5a736ee62d6"+
+		"3dbea45e8ca9671282fafb69da92728b 1a71de0a9e060b2905d6a5b67ecd3b36"+
+		"92ddbd7f2d778b8c9803aee328091b58 fab324e4fad675945585808b4831d7bc"+
+		"3ff4def08e4b7a9de576d26586cec64b 6116"+
+		"1ae10b594f09e26a7e902ecbd0600691", // tag
+	)
+
+	wc := newWipingCipher(k)
+	defer wc.wipe()
+	ciphertext := wc.seal(nil, nonce, ad, plaintext)
+	require.Equal(t, expected, ciphertext)
+	aead, err := chacha20poly1305.New(k[:])
+	require.NoError(t, err)
+	require.Equal(t, aead.Seal(nil, nonce, plaintext, ad), ciphertext)
+	decrypted, err := wc.open(nil, nonce, ad, ciphertext)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, decrypted)
+
+	tamper := func(b []byte, i int) []byte {
+		b = append([]byte(nil), b...)
+		b[i] ^= 0x80
+		return b
+	}
+	// every bit of the ciphertext and the tag is authenticated
+	for _, i := range []int{0, len(plaintext) - 1, len(plaintext), len(ciphertext) - 1} {
+		_, err := wc.open(nil, nonce, ad, tamper(ciphertext, i))
+		require.ErrorIs(t, err, errOpen)
+	}
+	for i := range ad {
+		_, err := wc.open(nil, nonce, tamper(ad, i), ciphertext)
+		require.ErrorIs(t, err, errOpen)
+	}
+	_, err = wc.open(nil, tamper(nonce, 0), ad, ciphertext)
+	require.ErrorIs(t, err, errOpen)
+	_, err = wc.open(nil, nonce, nil, ciphertext)
+	require.ErrorIs(t, err, errOpen)
+	_, err = wc.open(nil, nonce, ad, ciphertext[:len(ciphertext)-1])
+	require.ErrorIs(t, err, errOpen)
+
+	// forged tags: the tag of an empty message, and the all zero and all one tags
+	forged := append([]byte(nil), ciphertext...)
+	tag := forged[len(plaintext):]
+	for _, f := range [][]byte{
+		wc.seal(nil, nonce, ad, nil),
+		make([]byte, chacha20poly1305.Overhead),
+		bytes.Repeat([]byte{0xff}, chacha20poly1305.Overhead),
+	} {
+		copy(tag, f)
+		_, err := wc.open(nil, nonce, ad, forged)
+		require.ErrorIs(t, err, errOpen)
+	}
+	_, err = wc.open(nil, nonce, ad, wc.seal(nil, nonce, ad, nil)[:chacha20poly1305.Overhead])
+	require.NoError(t, err)
+
+	// a rejected message isn't decrypted into the output buffer
+	out := make([]byte, 0, len(ciphertext))
+	_, err = wc.open(out, nonce, ad, tamper(ciphertext, 0))
+	require.ErrorIs(t, err, errOpen)
+	require.Equal(t, make([]byte, len(ciphertext)), out[:len(ciphertext)])
+}
@@ -0,0 +1,294 @@
+package sectest
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/sec"
+
+	"github.com/stretchr/testify/require"
+)
+
+// SubtestHandshake tests that both sides authenticate each other,
+// and that data can be sent in both directions.
+func SubtestHandshake(t *testing.T, newTransport NewTransport) {
+	clientTpt, clientID := newTransport(t)
+	serverTpt, serverID := newTransport(t)
+	clientConn, serverConn := newConnPair(t)
+	c, s := handshake(t, clientTpt, serverTpt, serverID, clientConn, serverConn)
+	require.NoError(t, c.err)
+	require.NoError(t, s.err)
+
+	require.Equal(t, clientID, c.conn.LocalPeer())
+	require.Equal(t, serverID, c.conn.RemotePeer())
+	require.Equal(t, serverID, s.conn.LocalPeer())
+	require.Equal(t, clientID, s.conn.RemotePeer())
+	require.NotNil(t, c.conn.RemotePublicKey())
+	require.NotNil(t, s.conn.RemotePublicKey())
+
+	sendAndReceive(t, c.conn, s.conn, []byte("hello server"))
+	sendAndReceive(t, s.conn, c.conn, []byte("hello client"))
+}
+
+// SubtestPeerIDMismatch tests that the handshake fails if the client expects a different server.
+func SubtestPeerIDMismatch(t *testing.T, newTransport NewTransport) {
+	clientTpt, _ := newTransport(t)
+	serverTpt, _ := newTransport(t)
+	_, otherID := newTransport(t)
+	clientConn, serverConn := newConnPair(t)
+	c, _ := handshake(t, clientTpt, serverTpt, otherID, clientConn, serverConn)
+	require.Error(t, c.err)
+}
+
+// SubtestTornReads tests the handshake and data transfer when the underlying connections
+// only transfer a few bytes at a time.
+func SubtestTornReads(t *testing.T, newTransport NewTransport) {
+	torn := func(c net.Conn) net.Conn { return &tornConn{Conn: c, maxRead: 1, maxWrite: 3} }
+	client, server := connect(t, newTransport, torn, torn)
+
+	msg := make([]byte, 1000)
+	_, err := crand.Read(msg)
+	require.NoError(t, err)
+	sendAndReceive(t, client, server, msg)
+	sendAndReceive(t, server, client, msg)
+
+	// read the message using a 1 byte buffer
+	runWithTimeout(t, "write", func() { _, err = client.Write(msg) })
+	require.NoError(t, err)
+	received := make([]byte, 0, len(msg))
+	buf := make([]byte, 1)
+	runWithTimeout(t, "read", func() {
+		for len(received) < len(msg) && err == nil {
+			var n int
+			n, err = server.Read(buf)
+			received = append(received, buf[:n]...)
+		}
+	})
+	require.NoError(t, err)
+	require.Equal(t, msg, received)
+}
+
+// SubtestHugeMessage tests writing a message that is a lot larger than
+// the maximum frame size of any security protocol.
+func SubtestHugeMessage(t *testing.T, newTransport NewTransport) {
+	client, server := connect(t, newTransport, nil, nil)
+
+	msg := make([]byte, 10<<20)
+	_, err := crand.Read(msg)
+	require.NoError(t, err)
+	sendAndReceive(t, client, server, msg)
+	sendAndReceive(t, server, client, msg)
+}
+
+// SubtestConcurrentReadWrite tests that both sides can read and write at the same time,
+// and that writes from multiple goroutines don't corrupt the data.
+func SubtestConcurrentReadWrite(t *testing.T, newTransport NewTransport) {
+	const (
+		writers = 4
+		msgs    = 100
+		msgSize = 1000
+	)
+	client, server := connect(t, newTransport, nil, nil)
+
+	// Every message consists of a single repeated byte identifying the writer,
+	// so interleaved messages can be detected.
+	writeAll := func(conn sec.SecureConn) error {
+		var wg sync.WaitGroup
+		errs := make(chan error, writers)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				msg := bytes.Repeat([]byte{byte(i)}, msgSize)
+				for j := 0; j < msgs; j++ {
+					if _, err := conn.Write(msg); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		return <-errs
+	}
+	readAll := func(conn sec.SecureConn) error {
+		counts := make(map[byte]int)
+		buf := make([]byte, msgSize)
+		for i := 0; i < writers*msgs; i++ {
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				return err
+			}
+			if !bytes.Equal(buf, bytes.Repeat(buf[:1], msgSize)) {
+				return io.ErrUnexpectedEOF
+			}
+			counts[buf[0]]++
+		}
+		for i := 0; i < writers; i++ {
+			if counts[byte(i)] != msgs {
+				return io.ErrUnexpectedEOF
+			}
+		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for _, conn := range []sec.SecureConn{client, server} {
+		conn := conn
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- writeAll(conn)
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- readAll(conn)
+		}()
+	}
+	runWithTimeout(t, "concurrent read / write", wg.Wait)
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+}
+
+// SubtestEarlyCloseHandshake tests that the handshake fails, and doesn't hang,
+// if the remote peer closes the connection before completing it.
+func SubtestEarlyCloseHandshake(t *testing.T, newTransport NewTransport) {
+	clientTpt, _ := newTransport(t)
+	_, serverID := newTransport(t)
+	clientConn, serverConn := newConnPair(t)
+	serverConn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var err error
+	runWithTimeout(t, "handshake", func() {
+		_, err = clientTpt.SecureOutbound(ctx, clientConn, serverID)
+	})
+	require.Error(t, err)
+}
+
+// SubtestCloseAfterHandshake tests that closing one side of a secure connection unblocks
+// reads on the other side, and that the closed connection can't be used anymore.
+func SubtestCloseAfterHandshake(t *testing.T, newTransport NewTransport) {
+	client, server := connect(t, newTransport, nil, nil)
+
+	var err, closeErr error
+	runWithTimeout(t, "read", func() {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, err = server.Read(make([]byte, 10))
+		}()
+		closeErr = client.Close()
+		<-done
+	})
+	require.NoError(t, closeErr)
+	require.Error(t, err)
+
+	_, err = client.Write([]byte("foobar"))
+	require.Error(t, err)
+	_, err = client.Read(make([]byte, 10))
+	require.Error(t, err)
+}
+
+// SubtestMalformedHandshake tests that the handshake fails, and doesn't hang,
+// if the remote peer sends garbage.
+func SubtestMalformedHandshake(t *testing.T, newTransport NewTransport) {
+	serverTpt, _ := newTransport(t)
+	clientConn, serverConn := newConnPair(t)
+
+	garbage := make([]byte, 1000)
+	_, err := crand.Read(garbage)
+	require.NoError(t, err)
+	go func() {
+		clientConn.Write(garbage)
+		// Close the connection, in case the garbage happened to be a prefix of a valid message.
+		clientConn.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	runWithTimeout(t, "handshake", func() {
+		_, err = serverTpt.SecureInbound(ctx, serverConn, "")
+	})
+	require.Error(t, err)
+}
+
+// SubtestTamperedFrame tests that a modified frame is detected,
+// and not returned to the application.
+func SubtestTamperedFrame(t *testing.T, newTransport NewTransport) {
+	var tc *tamperConn
+	client, server := connect(t, newTransport, func(c net.Conn) net.Conn {
+		tc = &tamperConn{Conn: c}
+		return tc
+	}, nil)
+
+	tc.tamper.Store(true)
+	runWithTimeout(t, "write", func() { client.Write([]byte("foobar")) })
+	requireReadFails(t, server)
+}
+
+// SubtestGarbageFrame tests that garbage sent after the handshake is detected,
+// and not returned to the application.
+func SubtestGarbageFrame(t *testing.T, newTransport NewTransport) {
+	var raw net.Conn
+	_, server := connect(t, newTransport, func(c net.Conn) net.Conn {
+		raw = c
+		return c
+	}, nil)
+
+	garbage := make([]byte, 1000)
+	_, err := crand.Read(garbage)
+	require.NoError(t, err)
+	go func() {
+		raw.Write(garbage)
+		// Close the connection, in case the garbage happened to be a prefix of a valid frame.
+		raw.Close()
+	}()
+	requireReadFails(t, server)
+}
+
+// requireReadFails reads from conn until an error occurs, and fails if any data is read.
+func requireReadFails(t *testing.T, conn sec.SecureConn) {
+	t.Helper()
+	var n int
+	var err error
+	runWithTimeout(t, "read", func() {
+		buf := make([]byte, 100)
+		for err == nil {
+			var read int
+			read, err = conn.Read(buf)
+			n += read
+		}
+	})
+	require.Error(t, err)
+	require.Zero(t, n, "read data that was tampered with")
+}
+
+// sendAndReceive writes msg to a, and checks that it's received by b.
+func sendAndReceive(t *testing.T, a, b sec.SecureConn, msg []byte) {
+	t.Helper()
+	var writeErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, writeErr = a.Write(msg)
+	}()
+	received := make([]byte, len(msg))
+	var readErr error
+	runWithTimeout(t, "read", func() {
+		_, readErr = io.ReadFull(b, received)
+		<-done
+	})
+	require.NoError(t, writeErr)
+	require.NoError(t, readErr)
+	require.Equal(t, msg, received)
+}
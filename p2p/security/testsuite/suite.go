@@ -0,0 +1,69 @@
+// Package sectest is a conformance test suite for security transports.
+//
+// It runs security transports through handshakes and data transfers over real TCP connections,
+// including torn reads, huge messages, concurrent reads and writes, early closes, and malformed
+// frames. Security transports implemented outside of go-libp2p can use it in their own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		sectest.SubtestAll(t, func(t *testing.T) (sec.SecureTransport, peer.ID) {
+//			// construct a transport with a fresh identity
+//		})
+//	}
+package sectest
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/sec"
+)
+
+// NewTransport constructs a security transport with a fresh identity.
+// It is called (at least) twice per subtest, once for the client and once for the server.
+type NewTransport func(t *testing.T) (sec.SecureTransport, peer.ID)
+
+// TransportTest is a security transport test case.
+type TransportTest func(t *testing.T, newTransport NewTransport)
+
+// Subtests are the subtests that every security transport must pass,
+// including transports that don't provide integrity protection, like plaintext.
+var Subtests = []TransportTest{
+	SubtestHandshake,
+	SubtestPeerIDMismatch,
+	SubtestTornReads,
+	SubtestHugeMessage,
+	SubtestConcurrentReadWrite,
+	SubtestEarlyCloseHandshake,
+	SubtestCloseAfterHandshake,
+	SubtestMalformedHandshake,
+}
+
+// IntegritySubtests are the subtests for security transports that protect the integrity of the data.
+var IntegritySubtests = []TransportTest{
+	SubtestTamperedFrame,
+	SubtestGarbageFrame,
+}
+
+// SubtestAll runs all subtests, including the IntegritySubtests.
+func SubtestAll(t *testing.T, newTransport NewTransport) {
+	Run(t, newTransport, Subtests)
+	Run(t, newTransport, IntegritySubtests)
+}
+
+// Run runs the given subtests.
+func Run(t *testing.T, newTransport NewTransport, tests []TransportTest) {
+	for _, f := range tests {
+		f := f
+		t.Run(getFunctionName(f), func(t *testing.T) {
+			f(t, newTransport)
+		})
+	}
+}
+
+func getFunctionName(i interface{}) string {
+	name := runtime.FuncForPC(reflect.ValueOf(i).Pointer()).Name()
+	return name[strings.LastIndex(name, ".")+1:]
+}
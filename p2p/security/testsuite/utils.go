@@ -0,0 +1,162 @@
+package sectest
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/sec"
+
+	"github.com/stretchr/testify/require"
+)
+
+// timeout is the maximum duration of any blocking operation in the test suite.
+// Operations that take longer are considered to hang.
+const timeout = 10 * time.Second
+
+// newConnPair creates a pair of connected TCP connections.
+func newConnPair(t *testing.T) (client, server net.Conn) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- c
+	}()
+	client, err = net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	server, ok := <-accepted
+	require.True(t, ok, "accept failed")
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+type handshakeResult struct {
+	conn sec.SecureConn
+	err  error
+}
+
+// handshake runs the handshake of the security transports on the given connections.
+func handshake(t *testing.T, clientTpt, serverTpt sec.SecureTransport, serverID peer.ID, clientConn, serverConn net.Conn) (client, server handshakeResult) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan handshakeResult, 1)
+	go func() {
+		c, err := serverTpt.SecureInbound(ctx, serverConn, "")
+		done <- handshakeResult{conn: c, err: err}
+	}()
+	c, err := clientTpt.SecureOutbound(ctx, clientConn, serverID)
+	client = handshakeResult{conn: c, err: err}
+	if err != nil {
+		// Unblock the server, in case it's waiting for the client.
+		clientConn.Close()
+	}
+	select {
+	case server = <-done:
+	case <-time.After(timeout):
+		t.Fatal("server handshake hung")
+	}
+	for _, r := range []handshakeResult{client, server} {
+		if r.conn != nil {
+			c := r.conn
+			t.Cleanup(func() { c.Close() })
+		}
+	}
+	return client, server
+}
+
+// connect establishes a secure connection between two fresh transports.
+// The raw client connection is wrapped by wrapClient, if set.
+func connect(t *testing.T, newTransport NewTransport, wrapClient, wrapServer func(net.Conn) net.Conn) (client, server sec.SecureConn) {
+	t.Helper()
+	clientTpt, _ := newTransport(t)
+	serverTpt, serverID := newTransport(t)
+	clientConn, serverConn := newConnPair(t)
+	if wrapClient != nil {
+		clientConn = wrapClient(clientConn)
+	}
+	if wrapServer != nil {
+		serverConn = wrapServer(serverConn)
+	}
+	c, s := handshake(t, clientTpt, serverTpt, serverID, clientConn, serverConn)
+	require.NoError(t, c.err, "client handshake failed")
+	require.NoError(t, s.err, "server handshake failed")
+	return c.conn, s.conn
+}
+
+// runWithTimeout runs f, and fails the test if it doesn't return within the timeout.
+func runWithTimeout(t *testing.T, name string, f func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatalf("%s hung", name)
+	}
+}
+
+// tornConn is a connection that returns at most maxRead bytes from every Read call,
+// and splits every Write into chunks of at most maxWrite bytes.
+type tornConn struct {
+	net.Conn
+	maxRead, maxWrite int
+}
+
+func (c *tornConn) Read(b []byte) (int, error) {
+	if len(b) > c.maxRead {
+		b = b[:c.maxRead]
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *tornConn) Write(b []byte) (int, error) {
+	var written int
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > c.maxWrite {
+			chunk = chunk[:c.maxWrite]
+		}
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// tamperConn is a connection that flips a bit in the data written once tampering is enabled.
+type tamperConn struct {
+	net.Conn
+	tamper atomic.Bool
+}
+
+func (c *tamperConn) Write(b []byte) (int, error) {
+	if !c.tamper.Load() || len(b) == 0 {
+		return c.Conn.Write(b)
+	}
+	tampered := make([]byte, len(b))
+	copy(tampered, b)
+	tampered[len(tampered)-1] ^= 0x1
+	return c.Conn.Write(tampered)
+}
@@ -18,6 +18,7 @@ import (
 
 	ic "github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/sec"
 )
 
 const certValidityPeriod = 100 * 365 * 24 * time.Hour // ~100 years
@@ -34,12 +35,15 @@ type signedKey struct {
 
 // Identity is used to secure connections
 type Identity struct {
-	config tls.Config
+	config    tls.Config
+	keyPolicy *sec.KeyPolicy
 }
 
 // IdentityConfig is used to configure an Identity
 type IdentityConfig struct {
 	CertTemplate *x509.Certificate
+	// KeyPolicy restricts the identity keys accepted from remote peers.
+	KeyPolicy *sec.KeyPolicy
 }
 
 // IdentityOption transforms an IdentityConfig to apply optional settings.
@@ -52,6 +56,13 @@ func WithCertTemplate(template *x509.Certificate) IdentityOption {
 	}
 }
 
+// WithRemoteKeyPolicy rejects the certificates of remote peers whose identity keys are not allowed by p.
+func WithRemoteKeyPolicy(p sec.KeyPolicy) IdentityOption {
+	return func(c *IdentityConfig) {
+		c.KeyPolicy = &p
+	}
+}
+
 // NewIdentity creates a new identity
 func NewIdentity(privKey ic.PrivKey, opts ...IdentityOption) (*Identity, error) {
 	config := IdentityConfig{}
@@ -83,6 +94,7 @@ func NewIdentity(privKey ic.PrivKey, opts ...IdentityOption) (*Identity, error)
 			NextProtos:             []string{alpn},
 			SessionTicketsDisabled: true,
 		},
+		keyPolicy: config.KeyPolicy,
 	}, nil
 }
 
@@ -124,6 +136,9 @@ func (i *Identity) ConfigForPeer(remote peer.ID) (*tls.Config, <-chan ic.PubKey)
 		if err != nil {
 			return err
 		}
+		if err := i.keyPolicy.Check(pubKey); err != nil {
+			return err
+		}
 		if remote != "" && !remote.MatchesPublicKey(pubKey) {
 			peerID, err := peer.IDFromPublicKey(pubKey)
 			if err != nil {
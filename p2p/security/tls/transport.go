@@ -31,12 +31,25 @@ type Transport struct {
 	privKey    ci.PrivKey
 	muxers     []protocol.ID
 	protocolID protocol.ID
+
+	identityOpts []IdentityOption
 }
 
 var _ sec.SecureTransport = &Transport{}
 
+// Option is an option for the TLS transport.
+type Option func(*Transport) error
+
+// WithKeyPolicy rejects handshakes with peers whose identity keys are not allowed by p.
+func WithKeyPolicy(p sec.KeyPolicy) Option {
+	return func(t *Transport) error {
+		t.identityOpts = append(t.identityOpts, WithRemoteKeyPolicy(p))
+		return nil
+	}
+}
+
 // New creates a TLS encrypted transport
-func New(id protocol.ID, key ci.PrivKey, muxers []tptu.StreamMuxer) (*Transport, error) {
+func New(id protocol.ID, key ci.PrivKey, muxers []tptu.StreamMuxer, opts ...Option) (*Transport, error) {
 	localPeer, err := peer.IDFromPrivateKey(key)
 	if err != nil {
 		return nil, err
@@ -51,8 +64,13 @@ func New(id protocol.ID, key ci.PrivKey, muxers []tptu.StreamMuxer) (*Transport,
 		privKey:    key,
 		muxers:     muxerIDs,
 	}
+	for _, opt := range opts {
+		if err := opt(t); err != nil {
+			return nil, err
+		}
+	}
 
-	identity, err := NewIdentity(key)
+	identity, err := NewIdentity(key, t.identityOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -173,6 +191,7 @@ func (t *Transport) setupConn(tlsConn *tls.Conn, remotePubKey ci.PubKey) (sec.Se
 		connectionState: network.ConnectionState{
 			StreamMultiplexer:         protocol.ID(nextProto),
 			UsedEarlyMuxerNegotiation: nextProto != "",
+			CipherSuite:               tls.CipherSuiteName(tlsConn.ConnectionState().CipherSuite),
 		},
 	}, nil
 }
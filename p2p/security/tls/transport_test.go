@@ -21,10 +21,12 @@ import (
 	"time"
 
 	ic "github.com/libp2p/go-libp2p/core/crypto"
+	pb "github.com/libp2p/go-libp2p/core/crypto/pb"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
 	"github.com/libp2p/go-libp2p/core/sec"
 	tptu "github.com/libp2p/go-libp2p/p2p/net/upgrader"
+	sectest "github.com/libp2p/go-libp2p/p2p/security/testsuite"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -253,6 +255,7 @@ func TestHandshakeWithNextProtoSucceeds(t *testing.T) {
 		require.True(t, serverConn.RemotePublicKey().Equals(clientKey.GetPublic()), "client public key mismatch")
 		require.Equal(t, clientConn.ConnState().StreamMultiplexer, expectedMuxer)
 		require.Equal(t, clientConn.ConnState().UsedEarlyMuxerNegotiation, expectedMuxer != "")
+		require.True(t, strings.HasPrefix(clientConn.ConnState().CipherSuite, "TLS_"))
 		// exchange some data
 		_, err = serverConn.Write([]byte("foobar"))
 		require.NoError(t, err)
@@ -703,3 +706,46 @@ func TestInvalidCerts(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyPolicy(t *testing.T) {
+	clientKey, _, err := ic.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	serverID, serverKey := createPeer(t)
+
+	serverTransport, err := New(ID, serverKey, nil, WithKeyPolicy(sec.KeyPolicy{AllowedTypes: []pb.KeyType{pb.KeyType_ECDSA}}))
+	require.NoError(t, err)
+	clientTransport, err := New(ID, clientKey, nil)
+	require.NoError(t, err)
+
+	clientInsecureConn, serverInsecureConn := connect(t)
+
+	errChan := make(chan error)
+	go func() {
+		_, err := serverTransport.SecureInbound(context.Background(), serverInsecureConn, "")
+		errChan <- err
+	}()
+
+	conn, err := clientTransport.SecureOutbound(context.Background(), clientInsecureConn, serverID)
+	if err == nil {
+		_, err = conn.Read([]byte{0})
+	}
+	require.Error(t, err)
+
+	var serverErr error
+	select {
+	case serverErr = <-errChan:
+	case <-time.After(250 * time.Millisecond):
+		t.Fatal("expected handshake to return on the server side")
+	}
+	require.ErrorIs(t, serverErr, sec.ErrKeyNotAllowed)
+}
+
+func TestConformance(t *testing.T) {
+	sectest.SubtestAll(t, func(t *testing.T) (sec.SecureTransport, peer.ID) {
+		priv, _, err := ic.GenerateEd25519Key(rand.Reader)
+		require.NoError(t, err)
+		tr, err := New(ID, priv, nil)
+		require.NoError(t, err)
+		return tr, tr.localPeer
+	})
+}
@@ -0,0 +1,25 @@
+// Package tracinghelper contains helpers for the OpenTelemetry tracing of libp2p components.
+package tracinghelper
+
+import (
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer returns the tracer named name of tp.
+// If tp is nil, tracing is disabled, and a tracer that doesn't record any spans is returned.
+func Tracer(tp trace.TracerProvider, name string) trace.Tracer {
+	if tp == nil {
+		tp = trace.NewNoopTracerProvider()
+	}
+	return tp.Tracer(name)
+}
+
+// EndSpan ends span, recording err as its status if it is not nil.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,34 @@
+package tracinghelper
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestEndSpan(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tracer := Tracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)), "test")
+
+	_, span := tracer.Start(context.Background(), "success")
+	EndSpan(span, nil)
+	_, span = tracer.Start(context.Background(), "failure")
+	EndSpan(span, errors.New("failed"))
+
+	spans := sr.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, codes.Unset, spans[0].Status().Code)
+	require.Equal(t, codes.Error, spans[1].Status().Code)
+	require.Equal(t, "failed", spans[1].Status().Description)
+}
+
+func TestNoopTracer(t *testing.T) {
+	_, span := Tracer(nil, "test").Start(context.Background(), "span")
+	require.False(t, span.IsRecording())
+	EndSpan(span, errors.New("failed"))
+}
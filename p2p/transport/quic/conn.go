@@ -2,6 +2,8 @@ package libp2pquic
 
 import (
 	"context"
+	"crypto/tls"
+	"sync"
 
 	ic "github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/network"
@@ -23,9 +25,23 @@ type conn struct {
 	remotePeerID    peer.ID
 	remotePubKey    ic.PubKey
 	remoteMultiaddr ma.Multiaddr
+
+	// messages is initialized by the first call to ReceiveMessage
+	messagesOnce sync.Once
+	messages     chan []byte
+	// messagesErr is set before the messages channel is closed
+	messagesErr error
 }
 
-var _ tpt.CapableConn = &conn{}
+// maxQueuedMessages is the number of received messages that are queued,
+// until they're read using ReceiveMessage. Any further messages are dropped.
+// The memory used by queued messages is reserved in the connection's scope.
+const maxQueuedMessages = 32
+
+var (
+	_ tpt.CapableConn     = &conn{}
+	_ network.MessageConn = &conn{}
+)
 
 // Close closes the connection.
 // It must be called even if the peer closed the connection in order for
@@ -87,5 +103,65 @@ func (c *conn) ConnState() network.ConnectionState {
 	if _, err := c.LocalMultiaddr().ValueForProtocol(ma.P_QUIC); err == nil {
 		t = "quic"
 	}
-	return network.ConnectionState{Transport: t}
+	return network.ConnectionState{
+		Transport:   t,
+		CipherSuite: tls.CipherSuiteName(c.quicConn.ConnectionState().TLS.CipherSuite),
+		KeyUpdates:  c.transport.connManager.KeyUpdates(c.quicConn),
+	}
+}
+
+// SupportsMessages says if the peer supports QUIC datagrams, which are used to send messages.
+func (c *conn) SupportsMessages() bool {
+	return c.quicConn.ConnectionState().SupportsDatagrams
+}
+
+// SendMessage sends a message in a QUIC datagram.
+func (c *conn) SendMessage(msg []byte) error {
+	if !c.SupportsMessages() {
+		return network.ErrMessagesNotSupported
+	}
+	return c.quicConn.SendMessage(msg)
+}
+
+// ReceiveMessage receives a message sent in a QUIC datagram.
+func (c *conn) ReceiveMessage(ctx context.Context) ([]byte, error) {
+	if !c.SupportsMessages() {
+		return nil, network.ErrMessagesNotSupported
+	}
+	c.messagesOnce.Do(func() {
+		c.messages = make(chan []byte, maxQueuedMessages)
+		go c.receiveMessages()
+	})
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			return nil, c.messagesErr
+		}
+		c.scope.ReleaseMemory(len(msg))
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *conn) receiveMessages() {
+	defer close(c.messages)
+	for {
+		msg, err := c.quicConn.ReceiveMessage()
+		if err != nil {
+			c.messagesErr = err
+			return
+		}
+		// Messages are unreliable, drop them early if we're running low on memory.
+		if err := c.scope.ReserveMemory(len(msg), network.ReservationPriorityLow); err != nil {
+			log.Debugw("dropping message, failed to reserve memory", "peer", c.remotePeerID, "error", err)
+			continue
+		}
+		select {
+		case c.messages <- msg:
+		default:
+			c.scope.ReleaseMemory(len(msg))
+			log.Debugw("dropping message, queue full", "peer", c.remotePeerID)
+		}
+	}
 }
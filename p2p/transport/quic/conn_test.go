@@ -305,6 +305,143 @@ func testStreams(t *testing.T, tc *connTestCase) {
 	require.Equal(t, data, []byte("foobar"))
 }
 
+func TestMessages(t *testing.T) {
+	for _, tc := range connTestCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			testMessages(t, tc)
+		})
+	}
+}
+
+func testMessages(t *testing.T, tc *connTestCase) {
+	serverID, serverKey := createPeer(t)
+	_, clientKey := createPeer(t)
+
+	serverTransport, err := NewTransport(serverKey, newConnManager(t, tc.Options...), nil, nil, nil)
+	require.NoError(t, err)
+	defer serverTransport.(io.Closer).Close()
+	ln := runServer(t, serverTransport, "/ip4/127.0.0.1/udp/0/quic-v1")
+	defer ln.Close()
+
+	clientTransport, err := NewTransport(clientKey, newConnManager(t, tc.Options...), nil, nil, nil)
+	require.NoError(t, err)
+	defer clientTransport.(io.Closer).Close()
+	conn, err := clientTransport.Dial(context.Background(), ln.Multiaddr(), serverID)
+	require.NoError(t, err)
+	defer conn.Close()
+	serverConn, err := ln.Accept()
+	require.NoError(t, err)
+	defer serverConn.Close()
+
+	mc, ok := conn.(network.MessageConn)
+	require.True(t, ok)
+	require.True(t, mc.SupportsMessages())
+	smc, ok := serverConn.(network.MessageConn)
+	require.True(t, ok)
+	require.True(t, smc.SupportsMessages())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, mc.SendMessage([]byte("foobar")))
+	msg, err := smc.ReceiveMessage(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []byte("foobar"), msg)
+
+	// messages must fit into a single packet
+	require.Error(t, mc.SendMessage(make([]byte, 2000)))
+
+	// ReceiveMessage respects the context
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer shortCancel()
+	_, err = mc.ReceiveMessage(shortCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// ReceiveMessage returns an error once the connection is closed
+	conn.Close()
+	_, err = smc.ReceiveMessage(ctx)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestMessagesResourceAccounting(t *testing.T) {
+	for _, tc := range connTestCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			testMessagesResourceAccounting(t, tc)
+		})
+	}
+}
+
+func testMessagesResourceAccounting(t *testing.T, tc *connTestCase) {
+	serverID, serverKey := createPeer(t)
+	clientID, clientKey := createPeer(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	serverRcmgr := mocknetwork.NewMockResourceManager(ctrl)
+	serverConnScope := mocknetwork.NewMockConnManagementScope(ctrl)
+	serverRcmgr.EXPECT().OpenConnection(network.DirInbound, false, gomock.Any()).Return(serverConnScope, nil)
+	serverConnScope.EXPECT().SetPeer(clientID)
+	// flow control window increases
+	serverConnScope.EXPECT().ReserveMemory(gomock.Any(), network.ReservationPriorityMedium).AnyTimes()
+	serverTransport, err := NewTransport(serverKey, newConnManager(t, tc.Options...), nil, nil, serverRcmgr)
+	require.NoError(t, err)
+	defer serverTransport.(io.Closer).Close()
+	ln := runServer(t, serverTransport, "/ip4/127.0.0.1/udp/0/quic-v1")
+	defer ln.Close()
+
+	clientTransport, err := NewTransport(clientKey, newConnManager(t, tc.Options...), nil, nil, nil)
+	require.NoError(t, err)
+	defer clientTransport.(io.Closer).Close()
+	conn, err := clientTransport.Dial(context.Background(), ln.Multiaddr(), serverID)
+	require.NoError(t, err)
+	defer conn.Close()
+	serverConn, err := ln.Accept()
+	require.NoError(t, err)
+	smc := serverConn.(network.MessageConn)
+	mc := conn.(network.MessageConn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// start receiving messages
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer shortCancel()
+	_, err = smc.ReceiveMessage(shortCtx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The memory of queued messages is reserved until the message is read.
+	reserved := make(chan struct{})
+	gomock.InOrder(
+		serverConnScope.EXPECT().ReserveMemory(6, network.ReservationPriorityLow).Do(func(int, uint8) { close(reserved) }),
+		serverConnScope.EXPECT().ReleaseMemory(6),
+	)
+	require.NoError(t, mc.SendMessage([]byte("foobar")))
+	select {
+	case <-reserved:
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+	msg, err := smc.ReceiveMessage(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []byte("foobar"), msg)
+
+	// Messages are dropped if the memory can't be reserved.
+	serverConnScope.EXPECT().ReserveMemory(3, network.ReservationPriorityLow).Return(errors.New("no memory"))
+	require.NoError(t, mc.SendMessage([]byte("foo")))
+	gomock.InOrder(
+		serverConnScope.EXPECT().ReserveMemory(4, network.ReservationPriorityLow),
+		serverConnScope.EXPECT().ReleaseMemory(4),
+	)
+	// make sure the first message arrives first
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, mc.SendMessage([]byte("test")))
+	msg, err = smc.ReceiveMessage(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []byte("test"), msg)
+
+	serverConnScope.EXPECT().Done()
+	serverConn.Close()
+}
+
 func TestHandshakeFailPeerIDMismatch(t *testing.T) {
 	for _, tc := range connTestCases {
 		t.Run(tc.Name, func(t *testing.T) {
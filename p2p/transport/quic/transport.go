@@ -1,10 +1,12 @@
 package libp2pquic
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"net"
 	"sync"
@@ -58,6 +60,7 @@ type transport struct {
 }
 
 var _ tpt.Transport = &transport{}
+var _ tpt.CapabilityReporter = &transport{}
 
 type holePunchKey struct {
 	addr string
@@ -71,9 +74,10 @@ type activeHolePunch struct {
 
 // NewTransport creates a new QUIC transport
 func NewTransport(key ic.PrivKey, connManager *quicreuse.ConnManager, psk pnet.PSK, gater connmgr.ConnectionGater, rcmgr network.ResourceManager) (tpt.Transport, error) {
-	if len(psk) > 0 {
-		log.Error("QUIC doesn't support private networks yet.")
-		return nil, errors.New("QUIC doesn't support private networks yet")
+	// Private networks are implemented by protecting the UDP packets in the ConnManager.
+	if len(psk) > 0 && !bytes.Equal(psk, connManager.PSK()) {
+		log.Error("QUIC needs a ConnManager configured with quicreuse.PrivateNetwork to support private networks.")
+		return nil, errors.New("QUIC ConnManager not configured for this private network")
 	}
 	localPeer, err := peer.IDFromPrivateKey(key)
 	if err != nil {
@@ -268,8 +272,13 @@ loop:
 	}
 }
 
-// Don't use mafmt.QUIC as we don't want to dial DNS addresses. Just /ip{4,6}/udp/quic
-var dialMatcher = mafmt.And(mafmt.IP, mafmt.Base(ma.P_UDP), mafmt.Or(mafmt.Base(ma.P_QUIC), mafmt.Base(ma.P_QUIC_V1)))
+// Don't use mafmt.QUIC as we don't want to dial DNS addresses. Just /ip{4,6}/udp/quic,
+// optionally with an /ip6zone for (link-local) IPv6 addresses.
+var dialMatcher = mafmt.And(
+	mafmt.Or(mafmt.IP, mafmt.And(mafmt.Base(ma.P_IP6ZONE), mafmt.Base(ma.P_IP6))),
+	mafmt.Base(ma.P_UDP),
+	mafmt.Or(mafmt.Base(ma.P_QUIC), mafmt.Base(ma.P_QUIC_V1)),
+)
 
 // CanDial determines if we can dial to an address
 func (t *transport) CanDial(addr ma.Multiaddr) bool {
@@ -339,6 +348,40 @@ func (t *transport) Listen(addr ma.Multiaddr) (tpt.Listener, error) {
 	return l, nil
 }
 
+// ListenAddrsWithPortSpread returns the listen addresses for n consecutive UDP ports, starting at
+// the port of the QUIC address addr. Listening on all of them spreads inbound connections across
+// multiple ports, which works around per-port conntrack and bandwidth limits some hosting providers
+// apply.
+//
+// All ports are advertised with the same priority; a listener can't make peers pick a particular
+// port. The spreading is done by the dialing peers: peers using a dial ranker wrapped with
+// swarm.SpreadQUICPorts dial a random port of the range first, and the other ports after the usual
+// QUIC dial delay. Peers using the default dial ranker dial the lowest port first.
+func ListenAddrsWithPortSpread(addr ma.Multiaddr, n int) ([]ma.Multiaddr, error) {
+	udpAddr, version, err := quicreuse.FromQuicMultiaddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if n < 1 {
+		return nil, fmt.Errorf("invalid number of ports: %d", n)
+	}
+	if udpAddr.Port == 0 {
+		return nil, errors.New("port spreading requires a fixed port")
+	}
+	if udpAddr.Port+n-1 > math.MaxUint16 {
+		return nil, fmt.Errorf("port range %d-%d exceeds the maximum port", udpAddr.Port, udpAddr.Port+n-1)
+	}
+	addrs := make([]ma.Multiaddr, 0, n)
+	for i := 0; i < n; i++ {
+		a, err := quicreuse.ToQuicMultiaddr(&net.UDPAddr{IP: udpAddr.IP, Port: udpAddr.Port + i, Zone: udpAddr.Zone}, version)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, a)
+	}
+	return addrs, nil
+}
+
 func (t *transport) allowWindowIncrease(conn quic.Connection, size uint64) bool {
 	// If the QUIC connection tries to increase the window before we've inserted it
 	// into our connections map (which we do right after dialing / accepting it),
@@ -363,6 +406,12 @@ func (t *transport) Protocols() []int {
 	return t.connManager.Protocols()
 }
 
+// Capabilities returns the capabilities of QUIC connections.
+// Datagrams are enabled on all connections, see network.MessageConn.
+func (t *transport) Capabilities(ma.Multiaddr) tpt.Capabilities {
+	return tpt.CapabilityDatagram
+}
+
 func (t *transport) String() string {
 	return "QUIC"
 }
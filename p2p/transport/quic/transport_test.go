@@ -46,10 +46,12 @@ func TestCanDial(t *testing.T) {
 		"/ip4/127.0.0.1/udp/1234",
 		"/ip4/5.5.5.5/tcp/1234",
 		"/dns/google.com/udp/443/quic-v1",
+		"/ip6zone/eth0/ip4/127.0.0.1/udp/1234/quic-v1",
 	}
 	valid := []string{
 		"/ip4/127.0.0.1/udp/1234/quic-v1",
 		"/ip4/5.5.5.5/udp/0/quic-v1",
+		"/ip6zone/eth0/ip6/fe80::1/udp/1234/quic-v1",
 	}
 	for _, s := range invalid {
 		invalidAddr, err := ma.NewMultiaddr(s)
@@ -66,3 +68,20 @@ func TestCanDial(t *testing.T) {
 		}
 	}
 }
+
+func TestListenAddrsWithPortSpread(t *testing.T) {
+	addrs, err := ListenAddrsWithPortSpread(ma.StringCast("/ip4/127.0.0.1/udp/4001/quic-v1"), 3)
+	require.NoError(t, err)
+	require.Equal(t, []ma.Multiaddr{
+		ma.StringCast("/ip4/127.0.0.1/udp/4001/quic-v1"),
+		ma.StringCast("/ip4/127.0.0.1/udp/4002/quic-v1"),
+		ma.StringCast("/ip4/127.0.0.1/udp/4003/quic-v1"),
+	}, addrs)
+
+	_, err = ListenAddrsWithPortSpread(ma.StringCast("/ip4/127.0.0.1/udp/0/quic-v1"), 3)
+	require.Error(t, err)
+	_, err = ListenAddrsWithPortSpread(ma.StringCast("/ip4/127.0.0.1/udp/65535/quic-v1"), 2)
+	require.Error(t, err)
+	_, err = ListenAddrsWithPortSpread(ma.StringCast("/ip4/127.0.0.1/tcp/4001"), 2)
+	require.Error(t, err)
+}
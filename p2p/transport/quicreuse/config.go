@@ -13,12 +13,12 @@ var quicConfig = &quic.Config{
 	MaxStreamReceiveWindow:     10 * (1 << 20), // 10 MB
 	MaxConnectionReceiveWindow: 15 * (1 << 20), // 15 MB
 	RequireAddressValidation: func(net.Addr) bool {
-		// TODO(#1535): require source address validation when under load
+		// address validation can be enabled using the WithRetry option
 		return false
 	},
 	KeepAlivePeriod: 15 * time.Second,
 	Versions:        []quic.VersionNumber{quic.Version1},
-	// We don't use datagrams (yet), but this is necessary for WebTransport
+	// Datagrams are used for connection messages (see network.MessageConn), and are necessary for WebTransport
 	EnableDatagrams: true,
 	// The multiaddress encodes the QUIC version, thus there's no need to send Version Negotiation packets.
 	DisableVersionNegotiationPackets: true,
@@ -7,6 +7,9 @@ import (
 	"net"
 	"sync"
 
+	"github.com/libp2p/go-libp2p/core/network"
+	ipnet "github.com/libp2p/go-libp2p/core/pnet"
+
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
 	"github.com/quic-go/quic-go"
@@ -27,6 +30,26 @@ type ConnManager struct {
 
 	srk quic.StatelessResetKey
 	mt  *metricsTracer
+
+	keyUpdates *keyUpdateTracker
+
+	// psk is the pre-shared key of the private network. If set, all packets are protected using the PSK.
+	psk ipnet.PSK
+
+	// proxy is the MASQUE proxy that outgoing connections are tunneled through. May be nil.
+	proxy *Proxy
+
+	// retry configures address validation for incoming connections. May be nil.
+	retry *RetryConfig
+	// handshakes tracks incoming handshakes, if retry is set.
+	handshakes *handshakeTracker
+
+	// fds accounts for the UDP sockets in the resource manager. May be nil.
+	fds network.FDManager
+
+	enableGSO bool
+	// gso is true if UDP GSO is enabled and supported by the kernel.
+	gso bool
 }
 
 type quicListenerEntry struct {
@@ -39,6 +62,7 @@ func NewConnManager(statelessResetKey quic.StatelessResetKey, opts ...Option) (*
 		enableReuseport: true,
 		quicListeners:   make(map[string]quicListenerEntry),
 		srk:             statelessResetKey,
+		keyUpdates:      newKeyUpdateTracker(),
 	}
 	for _, o := range opts {
 		if err := o(cm); err != nil {
@@ -46,32 +70,57 @@ func NewConnManager(statelessResetKey quic.StatelessResetKey, opts ...Option) (*
 		}
 	}
 
+	// Packets sent on a private network are protected one by one, so GSO can't be used.
+	if cm.enableGSO && len(cm.psk) == 0 {
+		cm.gso = checkGSO()
+	}
+
 	quicConf := quicConfig.Clone()
 
 	if cm.enableMetrics {
 		cm.mt = newMetricsTracer()
 	}
+	if cm.retry != nil {
+		cm.handshakes = newHandshakeTracker(*cm.retry, cm.mt != nil)
+	}
 	quicConf.Tracer = func(ctx context.Context, p quiclogging.Perspective, ci quic.ConnectionID) quiclogging.ConnectionTracer {
-		tracers := make([]quiclogging.ConnectionTracer, 0, 2)
+		tracers := make([]quiclogging.ConnectionTracer, 0, 4)
+		if t := cm.keyUpdates.TracerForConnection(ctx); t != nil {
+			tracers = append(tracers, t)
+		}
 		if qlogTracerDir != "" {
 			tracers = append(tracers, qloggerForDir(qlogTracerDir, p, ci))
 		}
 		if cm.mt != nil {
 			tracers = append(tracers, cm.mt.TracerForConnection(ctx, p, ci))
 		}
+		if cm.handshakes != nil && p == quiclogging.PerspectiveServer {
+			tracers = append(tracers, cm.handshakes.TracerForConnection())
+		}
 		return quiclogging.NewMultiplexedConnectionTracer(tracers...)
 	}
 	serverConfig := quicConf.Clone()
+	if cm.handshakes != nil {
+		serverConfig.RequireAddressValidation = cm.handshakes.RequireAddressValidation
+		serverConfig.MaxRetryTokenAge = cm.retry.MaxTokenAge
+	}
 
 	cm.clientConfig = quicConf
 	cm.serverConfig = serverConfig
 	if cm.enableReuseport {
-		cm.reuseUDP4 = newReuse(&statelessResetKey, cm.mt)
-		cm.reuseUDP6 = newReuse(&statelessResetKey, cm.mt)
+		cm.reuseUDP4 = newReuse(&statelessResetKey, cm.mt, cm.psk, cm.fds)
+		cm.reuseUDP6 = newReuse(&statelessResetKey, cm.mt, cm.psk, cm.fds)
 	}
 	return cm, nil
 }
 
+// GSOEnabled returns true if UDP Generic Segmentation Offload is used to send packets.
+// GSO is used if EnableGSO was passed, the application set QUIC_GO_ENABLE_GSO, and it's
+// supported by the kernel. It is never used on a private network.
+func (c *ConnManager) GSOEnabled() bool {
+	return c.gso
+}
+
 func (c *ConnManager) getReuse(network string) (*reuse, error) {
 	switch network {
 	case "udp4":
@@ -145,11 +194,11 @@ func (c *ConnManager) transportForListen(network string, laddr *net.UDPAddr) (re
 		return reuse.TransportForListen(network, laddr)
 	}
 
-	conn, err := listenAndOptimize(network, laddr)
+	conn, fd, err := listenUDP(network, laddr, c.psk, c.fds)
 	if err != nil {
 		return nil, err
 	}
-	tr := &singleOwnerTransport{Transport: quic.Transport{Conn: conn, StatelessResetKey: &c.srk}, packetConn: conn}
+	tr := &singleOwnerTransport{Transport: quic.Transport{Conn: conn, StatelessResetKey: &c.srk}, packetConn: conn, fd: fd}
 	if c.mt != nil {
 		tr.Transport.Tracer = c.mt
 	}
@@ -176,11 +225,23 @@ func (c *ConnManager) DialQUIC(ctx context.Context, raddr ma.Multiaddr, tlsConf
 		return nil, errors.New("unknown QUIC version")
 	}
 
+	proxy, ok := getProxy(ctx)
+	if !ok {
+		proxy = c.proxy
+	}
+	if proxy != nil {
+		return c.dialViaProxy(ctx, proxy, naddr, tlsConf, quicConf)
+	}
+
 	tr, err := c.TransportForDial(netw, naddr)
 	if err != nil {
 		return nil, err
 	}
-	conn, err := tr.Dial(ctx, naddr, tlsConf, quicConf)
+	var addr net.Addr = naddr
+	if len(c.psk) > 0 {
+		addr = wrapAddr(naddr)
+	}
+	conn, err := tr.Dial(ctx, addr, tlsConf, quicConf)
 	if err != nil {
 		tr.DecreaseCount()
 		return nil, err
@@ -188,6 +249,39 @@ func (c *ConnManager) DialQUIC(ctx context.Context, raddr ma.Multiaddr, tlsConf
 	return conn, nil
 }
 
+func (c *ConnManager) dialViaProxy(ctx context.Context, proxy *Proxy, raddr *net.UDPAddr, tlsConf *tls.Config, quicConf *quic.Config) (quic.Connection, error) {
+	proxyConn, err := dialProxy(ctx, proxy, raddr)
+	if err != nil {
+		return nil, err
+	}
+	var pconn net.PacketConn = proxyConn
+	var addr net.Addr = raddr
+	if len(c.psk) > 0 {
+		pconn, err = newPNetPacketConn(c.psk, proxyConn)
+		if err != nil {
+			proxyConn.Close()
+			return nil, err
+		}
+		addr = wrapAddr(raddr)
+	}
+	tr := &quic.Transport{Conn: pconn, StatelessResetKey: &c.srk}
+	if c.mt != nil {
+		tr.Tracer = c.mt
+	}
+	conn, err := tr.Dial(ctx, addr, tlsConf, quicConf)
+	if err != nil {
+		tr.Close()
+		pconn.Close()
+		return nil, err
+	}
+	go func() {
+		<-conn.Context().Done()
+		tr.Close()
+		pconn.Close()
+	}()
+	return conn, nil
+}
+
 func (c *ConnManager) TransportForDial(network string, raddr *net.UDPAddr) (refCountedQuicTransport, error) {
 	if c.enableReuseport {
 		reuse, err := c.getReuse(network)
@@ -204,11 +298,11 @@ func (c *ConnManager) TransportForDial(network string, raddr *net.UDPAddr) (refC
 	case "udp6":
 		laddr = &net.UDPAddr{IP: net.IPv6zero, Port: 0}
 	}
-	conn, err := listenAndOptimize(network, laddr)
+	conn, fd, err := listenUDP(network, laddr, c.psk, c.fds)
 	if err != nil {
 		return nil, err
 	}
-	tr := &singleOwnerTransport{Transport: quic.Transport{Conn: conn, StatelessResetKey: &c.srk}, packetConn: conn}
+	tr := &singleOwnerTransport{Transport: quic.Transport{Conn: conn, StatelessResetKey: &c.srk}, packetConn: conn, fd: fd}
 	if c.mt != nil {
 		tr.Transport.Tracer = c.mt
 	}
@@ -216,6 +310,12 @@ func (c *ConnManager) TransportForDial(network string, raddr *net.UDPAddr) (refC
 	return tr, nil
 }
 
+// PSK returns the pre-shared key of the private network, or nil if the ConnManager is not
+// configured to use a private network.
+func (c *ConnManager) PSK() ipnet.PSK {
+	return c.psk
+}
+
 func (c *ConnManager) Protocols() []int {
 	return []int{ma.P_QUIC_V1}
 }
@@ -230,11 +330,37 @@ func (c *ConnManager) Close() error {
 	return c.reuseUDP4.Close()
 }
 
-// listenAndOptimize same as net.ListenUDP, but also calls quic.OptimizeConn
-func listenAndOptimize(network string, laddr *net.UDPAddr) (net.PacketConn, error) {
+// listenUDP is the same as net.ListenUDP, but also calls quic.OptimizeConn.
+// If a PSK is given, the connection is protected using the PSK instead.
+// If fds is set, the socket's file descriptor is reserved in the resource manager. The returned
+// reservation must be released when the socket is closed.
+func listenUDP(network string, laddr *net.UDPAddr, psk ipnet.PSK, fds network.FDManager) (net.PacketConn, *fdReservation, error) {
+	fd, err := reserveFD(fds)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn, err := listenUDPConn(network, laddr, psk)
+	if err != nil {
+		fd.release()
+		return nil, nil, err
+	}
+	return conn, fd, nil
+}
+
+func listenUDPConn(network string, laddr *net.UDPAddr, psk ipnet.PSK) (net.PacketConn, error) {
 	conn, err := net.ListenUDP(network, laddr)
 	if err != nil {
 		return nil, err
 	}
+	if len(psk) > 0 {
+		// The protected connection doesn't support quic-go's optimizations (ECN, GSO),
+		// since those require access to the raw UDP connection.
+		pconn, err := newPNetPacketConn(psk, conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return pconn, nil
+	}
 	return quic.OptimizeConn(conn)
 }
@@ -0,0 +1,36 @@
+package quicreuse
+
+import (
+	"sync"
+
+	"github.com/libp2p/go-libp2p/core/network"
+)
+
+// fdTransportName is the transport name used when accounting for UDP sockets in the resource manager.
+// A UDP socket is shared by all QUIC and WebTransport connections and listeners using it.
+const fdTransportName = "udp"
+
+// fdReservation is a file descriptor reserved in the resource manager for a UDP socket.
+// A nil fdReservation is valid, and is used if file descriptors are not accounted for.
+type fdReservation struct {
+	mgr  network.FDManager
+	once sync.Once
+}
+
+func reserveFD(mgr network.FDManager) (*fdReservation, error) {
+	if mgr == nil {
+		return nil, nil
+	}
+	if err := mgr.ReserveFD(fdTransportName); err != nil {
+		return nil, err
+	}
+	return &fdReservation{mgr: mgr}, nil
+}
+
+// release releases the file descriptor. It is safe to call release multiple times.
+func (r *fdReservation) release() {
+	if r == nil {
+		return
+	}
+	r.once.Do(func() { r.mgr.ReleaseFD(fdTransportName) })
+}
@@ -0,0 +1,35 @@
+package quicreuse
+
+import (
+	"os"
+	"strconv"
+)
+
+// quic-go only uses UDP Generic Segmentation Offload (GSO) if this environment variable is set
+// when a socket is created. It then sends batches of packets with a single syscall.
+// quic-go doesn't support Generic Receive Offload (GRO) yet; received packets are batched
+// using recvmmsg regardless.
+//
+// The variable is process-wide and also affects every other quic-go user in the process,
+// so it's left to the application to set it. We never modify the environment.
+const gsoEnv = "QUIC_GO_ENABLE_GSO"
+
+// checkGSO returns whether GSO is used for QUIC sockets, i.e. whether the application
+// enabled it using the environment variable and the kernel supports it.
+// If GSO is supported but not enabled, it logs a recommendation to enable it.
+func checkGSO() bool {
+	if !gsoSupported() {
+		log.Debug("UDP GSO not supported by the kernel")
+		return false
+	}
+	if !gsoEnabled() {
+		log.Infof("UDP GSO is supported by the kernel, but not enabled. Set %s=true to enable it.", gsoEnv)
+		return false
+	}
+	return true
+}
+
+func gsoEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv(gsoEnv))
+	return enabled
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package quicreuse
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// gsoSupported checks if the kernel supports UDP Generic Segmentation Offload (Linux >= 4.18),
+// by setting the UDP_SEGMENT socket option on a temporary socket.
+func gsoSupported() bool {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return false
+	}
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.IPPROTO_UDP, unix.UDP_SEGMENT, 1)
+	}); err != nil {
+		return false
+	}
+	return serr == nil
+}
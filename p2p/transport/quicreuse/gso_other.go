@@ -0,0 +1,6 @@
+//go:build !linux
+
+package quicreuse
+
+// GSO is only supported on Linux.
+func gsoSupported() bool { return false }
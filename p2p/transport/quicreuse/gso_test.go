@@ -0,0 +1,43 @@
+package quicreuse
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnableGSO(t *testing.T) {
+	// restore the environment after the test
+	t.Setenv(gsoEnv, "")
+
+	cm, err := NewConnManager(quic.StatelessResetKey{})
+	require.NoError(t, err)
+	defer cm.Close()
+	require.False(t, cm.GSOEnabled())
+
+	// EnableGSO must not modify the environment
+	cm, err = NewConnManager(quic.StatelessResetKey{}, EnableGSO())
+	require.NoError(t, err)
+	defer cm.Close()
+	require.False(t, cm.GSOEnabled())
+	require.Empty(t, os.Getenv(gsoEnv))
+
+	t.Setenv(gsoEnv, "true")
+	cm, err = NewConnManager(quic.StatelessResetKey{}, EnableGSO())
+	require.NoError(t, err)
+	defer cm.Close()
+	// GSO is never used on a private network
+	pcm, err := NewConnManager(quic.StatelessResetKey{}, EnableGSO(), PrivateNetwork(make([]byte, 32)))
+	require.NoError(t, err)
+	defer pcm.Close()
+	require.False(t, pcm.GSOEnabled())
+
+	if runtime.GOOS != "linux" {
+		require.False(t, cm.GSOEnabled())
+		return
+	}
+	require.Equal(t, gsoSupported(), cm.GSOEnabled())
+}
@@ -0,0 +1,79 @@
+package quicreuse
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/logging"
+)
+
+// keyUpdateTracker counts the key updates of QUIC connections.
+// Connections are identified by the tracing ID quic-go stores in the connection's context.
+type keyUpdateTracker struct {
+	mx    sync.Mutex
+	conns map[uint64]*atomic.Uint64
+}
+
+func newKeyUpdateTracker() *keyUpdateTracker {
+	return &keyUpdateTracker{conns: make(map[uint64]*atomic.Uint64)}
+}
+
+func (t *keyUpdateTracker) TracerForConnection(ctx context.Context) logging.ConnectionTracer {
+	id, ok := ctx.Value(quic.ConnectionTracingKey).(uint64)
+	if !ok {
+		return nil
+	}
+	count := &atomic.Uint64{}
+	t.mx.Lock()
+	t.conns[id] = count
+	t.mx.Unlock()
+	return &keyUpdateConnTracer{tracker: t, id: id, count: count}
+}
+
+// count returns the number of key updates of the connection with the given tracing ID.
+func (t *keyUpdateTracker) count(id uint64) uint64 {
+	t.mx.Lock()
+	count, ok := t.conns[id]
+	t.mx.Unlock()
+	if !ok {
+		return 0
+	}
+	return count.Load()
+}
+
+func (t *keyUpdateTracker) remove(id uint64) {
+	t.mx.Lock()
+	delete(t.conns, id)
+	t.mx.Unlock()
+}
+
+type keyUpdateConnTracer struct {
+	logging.NullConnectionTracer
+
+	tracker *keyUpdateTracker
+	id      uint64
+	count   *atomic.Uint64
+}
+
+var _ logging.ConnectionTracer = &keyUpdateConnTracer{}
+
+func (t *keyUpdateConnTracer) UpdatedKey(logging.KeyPhase, bool) {
+	t.count.Add(1)
+}
+
+func (t *keyUpdateConnTracer) Close() {
+	t.tracker.remove(t.id)
+}
+
+// KeyUpdates returns the number of 1-RTT key updates performed on conn, no matter which side initiated them.
+// quic-go initiates the first key update after 100 packets, and subsequent key updates every 100,000 packets.
+// It returns 0 for connections that weren't established by this ConnManager.
+func (c *ConnManager) KeyUpdates(conn quic.Connection) uint64 {
+	id, ok := conn.Context().Value(quic.ConnectionTracingKey).(uint64)
+	if !ok {
+		return 0
+	}
+	return c.keyUpdates.count(id)
+}
@@ -0,0 +1,30 @@
+package quicreuse
+
+import (
+	"context"
+	"testing"
+
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyUpdateTracker(t *testing.T) {
+	tracker := newKeyUpdateTracker()
+	require.Nil(t, tracker.TracerForConnection(context.Background()))
+
+	tr := tracker.TracerForConnection(context.WithValue(context.Background(), quic.ConnectionTracingKey, uint64(42)))
+	require.NotNil(t, tr)
+	other := tracker.TracerForConnection(context.WithValue(context.Background(), quic.ConnectionTracingKey, uint64(43)))
+	require.NotNil(t, other)
+
+	tr.UpdatedKey(1, false)
+	tr.UpdatedKey(2, true)
+	other.UpdatedKey(1, true)
+	require.Equal(t, uint64(2), tracker.count(42))
+	require.Equal(t, uint64(1), tracker.count(43))
+	require.Zero(t, tracker.count(44))
+
+	tr.Close()
+	require.Zero(t, tracker.count(42))
+	require.Equal(t, uint64(1), tracker.count(43))
+}
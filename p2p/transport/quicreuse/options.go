@@ -1,5 +1,12 @@
 package quicreuse
 
+import (
+	"errors"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	ipnet "github.com/libp2p/go-libp2p/core/pnet"
+)
+
 type Option func(*ConnManager) error
 
 func DisableReuseport() Option {
@@ -16,3 +23,75 @@ func EnableMetrics() Option {
 		return nil
 	}
 }
+
+// EnableGSO makes the ConnManager check whether UDP Generic Segmentation Offload (GSO) is used.
+// With GSO, a batch of QUIC packets is sent using a single syscall, which improves throughput
+// and reduces CPU usage on high-bandwidth nodes. It's only supported on Linux.
+//
+// quic-go reads this setting from the QUIC_GO_ENABLE_GSO environment variable, which applies to
+// all QUIC sockets created by the process. The application has to set it (before starting the
+// host); this option doesn't modify the environment. If the kernel supports GSO but the variable
+// isn't set, a recommendation to set it is logged.
+func EnableGSO() Option {
+	return func(m *ConnManager) error {
+		m.enableGSO = true
+		return nil
+	}
+}
+
+// PrivateNetwork configures the ConnManager to only communicate with members of the
+// private network identified by psk. All UDP packets are protected using the psk.
+// To leave room for the packet protection overhead, QUIC packets are limited to 1200 bytes.
+func PrivateNetwork(psk ipnet.PSK) Option {
+	return func(m *ConnManager) error {
+		if len(psk) != 32 {
+			return errors.New("expected 32 byte PSK")
+		}
+		m.psk = psk
+		return nil
+	}
+}
+
+// ConnectUDPProxy configures the ConnManager to tunnel all outgoing QUIC connections through
+// a MASQUE proxy. Use WithProxy to configure a proxy for individual dials.
+//
+// When constructing a libp2p host, pass this option to libp2p.QUICReuse.
+func ConnectUDPProxy(p *Proxy) Option {
+	return func(m *ConnManager) error {
+		if err := p.validate(); err != nil {
+			return err
+		}
+		m.proxy = p
+		return nil
+	}
+}
+
+// WithRetry configures when the QUIC listener requires clients to validate their address
+// using a Retry packet. By default, address validation is never required.
+// See RetryConfig for details.
+//
+// When constructing a libp2p host, pass this option to libp2p.QUICReuse.
+func WithRetry(cfg RetryConfig) Option {
+	return func(m *ConnManager) error {
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		m.retry = &cfg
+		return nil
+	}
+}
+
+// WithResourceManager accounts for the file descriptors of the UDP sockets in the resource manager.
+// Every socket counts as a single file descriptor, no matter how many QUIC connections share it.
+// The resource manager needs to implement network.FDManager, otherwise this option has no effect.
+//
+// When constructing a libp2p host, the host's resource manager is used automatically,
+// unless the ConnManager is configured using libp2p.QUICReuse.
+func WithResourceManager(rcmgr network.ResourceManager) Option {
+	return func(m *ConnManager) error {
+		if fds, ok := rcmgr.(network.FDManager); ok {
+			m.fds = fds
+		}
+		return nil
+	}
+}
@@ -0,0 +1,59 @@
+package quicreuse
+
+import (
+	"net"
+
+	ipnet "github.com/libp2p/go-libp2p/core/pnet"
+	"github.com/libp2p/go-libp2p/p2p/net/pnet"
+)
+
+// pnetAddr is the address of a peer reached over a PSK-protected connection.
+//
+// quic-go sizes packets sent to a *net.UDPAddr (1252 bytes for IPv4, 1232 bytes for IPv6) such that
+// they fit into the minimum IPv6 MTU of 1280 bytes. The packet protection prepends a 24 byte nonce
+// to every packet, which would exceed that limit. For addresses of any other type, quic-go limits
+// packets to 1200 bytes, leaving enough room for the nonce.
+type pnetAddr struct {
+	*net.UDPAddr
+}
+
+// unwrapAddr returns the UDP address wrapped by a pnetAddr or a proxiedAddr, or addr itself.
+func unwrapAddr(addr net.Addr) net.Addr {
+	switch a := addr.(type) {
+	case *pnetAddr:
+		return a.UDPAddr
+	case *proxiedAddr:
+		return a.UDPAddr
+	}
+	return addr
+}
+
+// wrapAddr wraps a UDP address in a pnetAddr.
+func wrapAddr(addr net.Addr) net.Addr {
+	if a, ok := addr.(*net.UDPAddr); ok {
+		return &pnetAddr{UDPAddr: a}
+	}
+	return addr
+}
+
+// pnetPacketConn protects all packets using the PSK, and wraps the addresses of peers in a pnetAddr.
+type pnetPacketConn struct {
+	net.PacketConn
+}
+
+func newPNetPacketConn(psk ipnet.PSK, conn net.PacketConn) (net.PacketConn, error) {
+	pconn, err := pnet.NewProtectedPacketConn(psk, conn)
+	if err != nil {
+		return nil, err
+	}
+	return &pnetPacketConn{PacketConn: pconn}, nil
+}
+
+func (c *pnetPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	return n, wrapAddr(addr), err
+}
+
+func (c *pnetPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	return c.PacketConn.WriteTo(p, unwrapAddr(addr))
+}
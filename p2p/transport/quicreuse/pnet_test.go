@@ -0,0 +1,203 @@
+package quicreuse
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	libp2ptls "github.com/libp2p/go-libp2p/p2p/security/tls"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// maxPNetPacketSize is the size of the largest packet quic-go sends to an address that's not a *net.UDPAddr.
+	maxPNetPacketSize = 1200
+	// minIPv6UDPPayload is the maximum UDP payload that fits into the minimum IPv6 MTU.
+	minIPv6UDPPayload = 1280 - 40 - 8
+)
+
+func TestPNetFullSizePacket(t *testing.T) {
+	psk := make([]byte, 32)
+	rand.Read(psk)
+	laddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	c1, err := listenUDPConn("udp4", laddr, psk)
+	require.NoError(t, err)
+	defer c1.Close()
+	c2, err := listenUDPConn("udp4", laddr, psk)
+	require.NoError(t, err)
+	defer c2.Close()
+	raw, err := net.ListenUDP("udp4", laddr)
+	require.NoError(t, err)
+	defer raw.Close()
+
+	msg := make([]byte, maxPNetPacketSize)
+	rand.Read(msg)
+
+	// On the wire, the protected packet must fit into the minimum IPv6 MTU.
+	_, err = c1.WriteTo(msg, wrapAddr(raw.LocalAddr()))
+	require.NoError(t, err)
+	buf := make([]byte, 1500)
+	raw.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := raw.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Greater(t, n, len(msg))
+	require.LessOrEqual(t, n, minIPv6UDPPayload)
+
+	_, err = c1.WriteTo(msg, c2.LocalAddr())
+	require.NoError(t, err)
+	c2.SetReadDeadline(time.Now().Add(time.Second))
+	n, addr, err := c2.ReadFrom(buf)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(msg, buf[:n]))
+
+	// quic-go only sends packets larger than maxPNetPacketSize to a *net.UDPAddr.
+	_, ok := addr.(*net.UDPAddr)
+	require.False(t, ok)
+	require.Equal(t, c1.LocalAddr().String(), addr.String())
+	require.Equal(t, "127.0.0.1", ipKey(addr))
+	maddr, err := ToQuicMultiaddr(addr, quic.Version1)
+	require.NoError(t, err)
+	expected, err := ToQuicMultiaddr(c1.LocalAddr(), quic.Version1)
+	require.NoError(t, err)
+	require.True(t, maddr.Equal(expected))
+}
+
+// recordingUDPRelay forwards packets between a client and a server, and records the size of
+// every packet it forwards.
+type recordingUDPRelay struct {
+	conn   *net.UDPConn
+	server *net.UDPAddr
+
+	mx    sync.Mutex
+	sizes []int
+}
+
+func newRecordingUDPRelay(t *testing.T, server *net.UDPAddr) *recordingUDPRelay {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	r := &recordingUDPRelay{conn: conn, server: server}
+	go r.run()
+	return r
+}
+
+func (r *recordingUDPRelay) run() {
+	var client *net.UDPAddr
+	buf := make([]byte, 2000)
+	for {
+		n, addr, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		r.mx.Lock()
+		r.sizes = append(r.sizes, n)
+		r.mx.Unlock()
+		if addr.String() == r.server.String() {
+			if client != nil {
+				r.conn.WriteToUDP(buf[:n], client)
+			}
+			continue
+		}
+		client = addr
+		r.conn.WriteToUDP(buf[:n], r.server)
+	}
+}
+
+func (r *recordingUDPRelay) packetSizes() []int {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return append([]int(nil), r.sizes...)
+}
+
+// This test makes sure that quic-go limits the size of the packets it sends to a pnetAddr, and
+// that the protected packets fit into the minimum IPv6 MTU on the wire.
+// quic-go chooses the packet size based on the address type, so this could break when updating quic-go.
+func TestPNetOnWirePacketSize(t *testing.T) {
+	psk := make([]byte, 32)
+	rand.Read(psk)
+	serverCM, err := NewConnManager(quic.StatelessResetKey{}, PrivateNetwork(psk))
+	require.NoError(t, err)
+	defer serverCM.Close()
+	clientCM, err := NewConnManager(quic.StatelessResetKey{}, PrivateNetwork(psk))
+	require.NoError(t, err)
+	defer clientCM.Close()
+
+	_, serverTLSConf := getTLSConfForProto(t, "proto")
+	ln, err := serverCM.ListenQUIC(ma.StringCast("/ip4/127.0.0.1/udp/0/quic-v1"), serverTLSConf, nil)
+	require.NoError(t, err)
+	defer ln.Close()
+
+	relay := newRecordingUDPRelay(t, ln.Addr().(*net.UDPAddr))
+	raddr, err := ToQuicMultiaddr(relay.conn.LocalAddr(), quic.Version1)
+	require.NoError(t, err)
+
+	const dataLen = 100 << 10
+	done := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept(context.Background())
+		if err != nil {
+			done <- err
+			return
+		}
+		defer conn.CloseWithError(0, "")
+		str, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			done <- err
+			return
+		}
+		data, err := io.ReadAll(str)
+		if err == nil && len(data) != dataLen {
+			err = fmt.Errorf("expected %d bytes, got %d", dataLen, len(data))
+		}
+		if err == nil {
+			_, err = str.Write(data)
+		}
+		str.Close()
+		done <- err
+		// wait for the client to receive the data
+		<-conn.Context().Done()
+	}()
+
+	clientKey, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	clientIdentity, err := libp2ptls.NewIdentity(clientKey)
+	require.NoError(t, err)
+	clientTLSConf, _ := clientIdentity.ConfigForPeer("")
+	clientTLSConf.NextProtos = []string{"proto"}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := clientCM.DialQUIC(ctx, raddr, clientTLSConf, nil)
+	require.NoError(t, err)
+	defer conn.CloseWithError(0, "")
+	str, err := conn.OpenStream()
+	require.NoError(t, err)
+	_, err = str.Write(make([]byte, dataLen))
+	require.NoError(t, err)
+	require.NoError(t, str.Close())
+	data, err := io.ReadAll(str)
+	require.NoError(t, err)
+	require.Len(t, data, dataLen)
+	require.NoError(t, <-done)
+
+	sizes := relay.packetSizes()
+	require.NotEmpty(t, sizes)
+	var maxSize int
+	for _, s := range sizes {
+		if s > maxSize {
+			maxSize = s
+		}
+	}
+	// The largest packets are full-size QUIC packets plus the nonce.
+	require.Equal(t, maxPNetPacketSize+24, maxSize)
+	require.LessOrEqual(t, maxSize, minIPv6UDPPayload)
+}
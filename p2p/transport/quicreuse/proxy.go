@@ -0,0 +1,419 @@
+package quicreuse
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// Proxy is a MASQUE proxy that outgoing QUIC connections are tunneled through,
+// using CONNECT-UDP (RFC 9298). This allows nodes in networks that only allow
+// HTTP/3 egress to a proxy to dial QUIC-based transports.
+//
+// Only dials are proxied. Listening is not affected, and neither are dials of
+// transports that don't use QUIC.
+//
+// The proxied QUIC packets are sent in QUIC datagrams on the connection to the proxy, if they
+// fit into one (see maxProxiedDatagramSize). Larger packets, like the packets of at least 1200
+// bytes sent during the QUIC handshake, are sent in DATAGRAM capsules (RFC 9297) on the request
+// stream instead. These are delivered reliably and in order, so a lost packet delays the
+// following large packets.
+type Proxy struct {
+	// URITemplate is the URI template used for CONNECT-UDP requests.
+	// It must contain the {target_host} and {target_port} variables, for example:
+	// https://proxy.example.com/.well-known/masque/udp/{target_host}/{target_port}/
+	URITemplate string
+	// TLSConfig is the TLS configuration used for the connection to the proxy.
+	// Optional.
+	TLSConfig *tls.Config
+	// Header contains additional headers sent with the CONNECT-UDP request,
+	// e.g. for authenticating with the proxy. Optional.
+	Header http.Header
+}
+
+func (p *Proxy) validate() error {
+	if !strings.Contains(p.URITemplate, "{target_host}") || !strings.Contains(p.URITemplate, "{target_port}") {
+		return errors.New("proxy URI template must contain {target_host} and {target_port}")
+	}
+	u, err := url.Parse(p.URITemplate)
+	if err != nil {
+		return fmt.Errorf("invalid proxy URI template: %w", err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("invalid proxy URI scheme: %s", u.Scheme)
+	}
+	return nil
+}
+
+// targetURL expands the URI template for the target address.
+func (p *Proxy) targetURL(addr *net.UDPAddr) (*url.URL, error) {
+	// IPv6 addresses contain colons, which need to be percent-encoded (see Section 2 of RFC 9298).
+	host := strings.ReplaceAll(addr.IP.String(), ":", "%3A")
+	return url.Parse(strings.NewReplacer(
+		"{target_host}", host,
+		"{target_port}", strconv.Itoa(addr.Port),
+	).Replace(p.URITemplate))
+}
+
+type proxyKey struct{}
+
+// WithProxy returns a context that makes dials using this context tunnel QUIC through
+// the given proxy. It takes precedence over the proxy configured using ConnectUDPProxy.
+// A nil proxy disables proxying for dials using this context.
+func WithProxy(ctx context.Context, p *Proxy) context.Context {
+	return context.WithValue(ctx, proxyKey{}, p)
+}
+
+const (
+	// maxProxiedDatagramSize is the maximum size of the datagrams sent to the proxy, including
+	// the prefix. A DATAGRAM frame must fit into a single packet on the connection to the proxy.
+	// quic-go sends packets of at least 1232 bytes (the IPv6 minimum), and uses at most 41 of them
+	// for the short header with the longest connection ID (25 bytes) and the AEAD tag (16 bytes).
+	// The DATAGRAM frame header takes another 3 bytes. This is also below the 1200 bytes limit
+	// that quic-go enforces for DATAGRAM frames.
+	maxProxiedDatagramSize = 1232 - 41 - 3
+	// capsuleTypeDatagram is the type of the DATAGRAM capsule (RFC 9297).
+	capsuleTypeDatagram http3.CapsuleType = 0
+	// maxCapsuleSize is the maximum size of a capsule we accept: a context ID and a UDP payload.
+	maxCapsuleSize = 8 + 65535
+)
+
+func getProxy(ctx context.Context) (p *Proxy, ok bool) {
+	p, ok = ctx.Value(proxyKey{}).(*Proxy)
+	return p, ok
+}
+
+// dialProxy sends a CONNECT-UDP request to the proxy, returning a net.PacketConn that
+// tunnels packets to and from raddr.
+func dialProxy(ctx context.Context, p *Proxy, raddr *net.UDPAddr) (*proxiedPacketConn, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	u, err := p.targetURL(raddr)
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsConf *tls.Config
+	if p.TLSConfig != nil {
+		tlsConf = p.TLSConfig.Clone()
+	}
+	// Using a separate RoundTripper makes sure that every proxied connection uses its own
+	// connection to the proxy, so we don't need to demultiplex datagrams.
+	rt := &http3.RoundTripper{
+		TLSClientConfig: tlsConf,
+		EnableDatagrams: true,
+		QuicConfig: &quic.Config{
+			EnableDatagrams: true,
+			KeepAlivePeriod: 15 * time.Second,
+		},
+	}
+	header := p.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Capsule-Protocol", "?1")
+	req := (&http.Request{
+		Method: http.MethodConnect,
+		Proto:  "connect-udp",
+		Host:   u.Host,
+		URL:    u,
+		Header: header,
+	}).WithContext(ctx)
+
+	rsp, err := rt.RoundTripOpt(req, http3.RoundTripOpt{DontCloseRequestStream: true})
+	if err != nil {
+		rt.Close()
+		return nil, fmt.Errorf("CONNECT-UDP request failed: %w", err)
+	}
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		rsp.Body.Close()
+		rt.Close()
+		return nil, fmt.Errorf("CONNECT-UDP request failed: proxy returned status %d", rsp.StatusCode)
+	}
+	str := rsp.Body.(http3.HTTPStreamer).HTTPStream()
+	conn, ok := rsp.Body.(http3.Hijacker).StreamCreator().(quic.Connection)
+	if !ok {
+		str.CancelRead(0)
+		str.Close()
+		rt.Close()
+		return nil, errors.New("unexpected connection type")
+	}
+	if !conn.ConnectionState().SupportsDatagrams {
+		str.CancelRead(0)
+		str.Close()
+		rt.Close()
+		return nil, errors.New("proxy doesn't support datagrams")
+	}
+	return newProxiedPacketConn(conn, str, str.StreamID(), raddr, func() error {
+		str.CancelRead(0)
+		str.Close()
+		return rt.Close()
+	}), nil
+}
+
+// datagramConn is the part of the quic.Connection to the proxy used by the proxiedPacketConn.
+type datagramConn interface {
+	SendMessage([]byte) error
+	ReceiveMessage() ([]byte, error)
+	LocalAddr() net.Addr
+}
+
+// proxiedPacketConn is a net.PacketConn that sends packets to a single address
+// via a CONNECT-UDP proxy.
+type proxiedPacketConn struct {
+	conn datagramConn
+	// str is the request stream, used for packets sent in capsules
+	str   capsuleStream
+	raddr *net.UDPAddr
+	// prefix is prepended to every datagram:
+	// the quarter stream ID (RFC 9297), followed by context ID 0 (RFC 9298)
+	prefix  []byte
+	closeFn func() error
+
+	// capsuleMx makes sure that capsules aren't interleaved on the stream
+	capsuleMx sync.Mutex
+
+	packets   chan []byte
+	closeOnce sync.Once
+	closed    chan struct{}
+	closeErr  error
+
+	deadlineMx      sync.Mutex
+	readDeadline    time.Time
+	deadlineChanged chan struct{}
+}
+
+var _ net.PacketConn = &proxiedPacketConn{}
+
+// capsuleStream is the part of the request stream used by the proxiedPacketConn.
+type capsuleStream interface {
+	io.ReadWriter
+	SetWriteDeadline(time.Time) error
+}
+
+func newProxiedPacketConn(conn datagramConn, str capsuleStream, streamID quic.StreamID, raddr *net.UDPAddr, closeFn func() error) *proxiedPacketConn {
+	prefix := quicvarint.Append(nil, uint64(streamID)/4)
+	prefix = quicvarint.Append(prefix, 0)
+	c := &proxiedPacketConn{
+		conn:            conn,
+		str:             str,
+		raddr:           raddr,
+		prefix:          prefix,
+		closeFn:         closeFn,
+		packets:         make(chan []byte, 64),
+		closed:          make(chan struct{}),
+		deadlineChanged: make(chan struct{}),
+	}
+	go c.receive()
+	go c.receiveCapsules()
+	return c
+}
+
+func (c *proxiedPacketConn) receive() {
+	for {
+		b, err := c.conn.ReceiveMessage()
+		if err != nil {
+			c.close(err)
+			return
+		}
+		if len(b) < len(c.prefix) || string(b[:len(c.prefix)]) != string(c.prefix) {
+			// Datagram for a different stream, or with a context ID we don't know.
+			continue
+		}
+		c.deliver(b[len(c.prefix):])
+	}
+}
+
+// receiveCapsules receives the packets sent in DATAGRAM capsules on the request stream.
+func (c *proxiedPacketConn) receiveCapsules() {
+	r := quicvarint.NewReader(bufio.NewReader(c.str))
+	for {
+		ct, b, err := readCapsule(r)
+		if err != nil {
+			c.close(err)
+			return
+		}
+		if ct != capsuleTypeDatagram {
+			// Ignore unknown capsules (see Section 3.2 of RFC 9297).
+			continue
+		}
+		// The capsule contains the context ID, followed by the UDP payload.
+		if len(b) == 0 || b[0] != 0 {
+			continue
+		}
+		c.deliver(b[1:])
+	}
+}
+
+// readCapsule reads a capsule. http3.ParseCapsule can't be used, since its value reader fails on
+// short reads.
+func readCapsule(r quicvarint.Reader) (http3.CapsuleType, []byte, error) {
+	ct, err := quicvarint.Read(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	l, err := quicvarint.Read(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	if l > maxCapsuleSize {
+		return 0, nil, fmt.Errorf("capsule too large: %d bytes", l)
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return 0, nil, err
+	}
+	return http3.CapsuleType(ct), b, nil
+}
+
+func (c *proxiedPacketConn) deliver(b []byte) {
+	select {
+	case c.packets <- b:
+	default:
+		// Drop the packet. QUIC will retransmit the data.
+	}
+}
+
+func (c *proxiedPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		c.deadlineMx.Lock()
+		deadline := c.readDeadline
+		deadlineChanged := c.deadlineChanged
+		c.deadlineMx.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !deadline.IsZero() {
+			d := time.Until(deadline)
+			if d <= 0 {
+				return 0, nil, os.ErrDeadlineExceeded
+			}
+			timer = time.NewTimer(d)
+			timeout = timer.C
+		}
+		n, done, err := c.readOrWait(b, timeout, deadlineChanged)
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		if done {
+			return n, c.raddr, nil
+		}
+	}
+}
+
+// readOrWait reads a packet. It returns done = false if the deadline was changed while waiting.
+func (c *proxiedPacketConn) readOrWait(b []byte, timeout <-chan time.Time, deadlineChanged <-chan struct{}) (n int, done bool, err error) {
+	select {
+	case p := <-c.packets:
+		return copy(b, p), true, nil
+	case <-c.closed:
+		return 0, true, c.closeErr
+	case <-timeout:
+		return 0, true, os.ErrDeadlineExceeded
+	case <-deadlineChanged:
+		return 0, false, nil
+	}
+}
+
+func (c *proxiedPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	if ua, ok := addr.(*net.UDPAddr); !ok || !ua.IP.Equal(c.raddr.IP) || ua.Port != c.raddr.Port {
+		return 0, fmt.Errorf("proxied connection can only send to %s", c.raddr)
+	}
+	if len(c.prefix)+len(b) <= maxProxiedDatagramSize {
+		msg := make([]byte, 0, len(c.prefix)+len(b))
+		msg = append(msg, c.prefix...)
+		msg = append(msg, b...)
+		if err := c.conn.SendMessage(msg); err == nil {
+			return len(b), nil
+		}
+		// The proxy might not accept datagrams of this size. Try sending a capsule.
+	}
+	return c.writeCapsule(b)
+}
+
+// writeCapsule sends a packet in a DATAGRAM capsule on the request stream.
+func (c *proxiedPacketConn) writeCapsule(b []byte) (int, error) {
+	value := make([]byte, 0, 1+len(b))
+	value = append(value, 0) // context ID 0
+	value = append(value, b...)
+	c.capsuleMx.Lock()
+	defer c.capsuleMx.Unlock()
+	if err := http3.WriteCapsule(quicvarint.NewWriter(c.str), capsuleTypeDatagram, value); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *proxiedPacketConn) close(err error) {
+	c.closeOnce.Do(func() {
+		c.closeErr = err
+		close(c.closed)
+	})
+}
+
+func (c *proxiedPacketConn) Close() error {
+	c.close(net.ErrClosed)
+	return c.closeFn()
+}
+
+// proxiedAddr is the local address of a proxied connection, which is the local address of the
+// connection to the proxy. quic-go refuses to use two connections with the same local address,
+// so it uses a different network name.
+type proxiedAddr struct {
+	*net.UDPAddr
+}
+
+func (a *proxiedAddr) Network() string { return "connect-udp" }
+
+func (c *proxiedPacketConn) LocalAddr() net.Addr {
+	if a, ok := c.conn.LocalAddr().(*net.UDPAddr); ok {
+		return &proxiedAddr{UDPAddr: a}
+	}
+	return c.conn.LocalAddr()
+}
+
+func (c *proxiedPacketConn) SetDeadline(t time.Time) error {
+	if err := c.SetWriteDeadline(t); err != nil {
+		return err
+	}
+	return c.SetReadDeadline(t)
+}
+
+func (c *proxiedPacketConn) SetReadDeadline(t time.Time) error {
+	c.deadlineMx.Lock()
+	c.readDeadline = t
+	close(c.deadlineChanged)
+	c.deadlineChanged = make(chan struct{})
+	c.deadlineMx.Unlock()
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for packets sent in capsules, since writing to the request
+// stream blocks on flow control. Sending datagrams doesn't block.
+func (c *proxiedPacketConn) SetWriteDeadline(t time.Time) error {
+	return c.str.SetWriteDeadline(t)
+}
@@ -0,0 +1,340 @@
+package quicreuse
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	libp2ptls "github.com/libp2p/go-libp2p/p2p/security/tls"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyURITemplate(t *testing.T) {
+	for _, tmpl := range []string{
+		"",
+		"https://proxy.example.com/masque",
+		"https://proxy.example.com/masque/{target_host}",
+		"http://proxy.example.com/masque/{target_host}/{target_port}/",
+	} {
+		_, err := NewConnManager(quic.StatelessResetKey{}, ConnectUDPProxy(&Proxy{URITemplate: tmpl}))
+		require.Error(t, err, tmpl)
+	}
+
+	p := &Proxy{URITemplate: "https://proxy.example.com/.well-known/masque/udp/{target_host}/{target_port}/"}
+	require.NoError(t, p.validate())
+	u, err := p.targetURL(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1234})
+	require.NoError(t, err)
+	require.Equal(t, "https://proxy.example.com/.well-known/masque/udp/1.2.3.4/1234/", u.String())
+	require.Equal(t, "proxy.example.com", u.Host)
+	u, err = p.targetURL(&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 443})
+	require.NoError(t, err)
+	require.Equal(t, "https://proxy.example.com/.well-known/masque/udp/2001%3Adb8%3A%3A1/443/", u.String())
+}
+
+type mockDatagramConn struct {
+	sent     chan []byte
+	received chan []byte
+}
+
+func newMockDatagramConn() *mockDatagramConn {
+	return &mockDatagramConn{sent: make(chan []byte, 10), received: make(chan []byte, 10)}
+}
+
+func (c *mockDatagramConn) SendMessage(b []byte) error {
+	c.sent <- b
+	return nil
+}
+
+func (c *mockDatagramConn) ReceiveMessage() ([]byte, error) {
+	b, ok := <-c.received
+	if !ok {
+		return nil, errors.New("connection closed")
+	}
+	return b, nil
+}
+
+func (c *mockDatagramConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
+}
+
+func TestProxiedPacketConn(t *testing.T) {
+	raddr := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1234}
+	dc := newMockDatagramConn()
+	str, proxyStr := net.Pipe()
+	defer proxyStr.Close()
+	var closed bool
+	// stream 8 has the quarter stream ID 2
+	conn := newProxiedPacketConn(dc, str, 8, raddr, func() error { closed = true; return str.Close() })
+
+	_, err := conn.WriteTo([]byte("foobar"), &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 4321})
+	require.Error(t, err)
+	n, err := conn.WriteTo([]byte("foobar"), &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1234})
+	require.NoError(t, err)
+	require.Equal(t, 6, n)
+	require.Equal(t, append([]byte{2, 0}, "foobar"...), <-dc.sent)
+
+	// datagrams for other streams, or with a different context ID, are ignored
+	dc.received <- append([]byte{3, 0}, "other stream"...)
+	dc.received <- append(quicvarint.Append([]byte{2}, 42), "other context"...)
+	dc.received <- append([]byte{2, 0}, "raboof"...)
+	b := make([]byte, 100)
+	n, addr, err := conn.ReadFrom(b)
+	require.NoError(t, err)
+	require.Equal(t, "raboof", string(b[:n]))
+	require.Equal(t, raddr, addr)
+
+	// packets that don't fit into a datagram are sent in capsules
+	large := make([]byte, maxProxiedDatagramSize)
+	rand.Read(large)
+	go conn.WriteTo(large, raddr)
+	ct, value, err := readCapsule(quicvarint.NewReader(bufio.NewReader(proxyStr)))
+	require.NoError(t, err)
+	require.Equal(t, capsuleTypeDatagram, ct)
+	require.Equal(t, append([]byte{0}, large...), value)
+	require.Empty(t, dc.sent)
+
+	// packets are received in capsules, unknown capsules are ignored
+	go func() {
+		w := quicvarint.NewWriter(proxyStr)
+		http3.WriteCapsule(w, 42, []byte("unknown capsule"))
+		http3.WriteCapsule(w, capsuleTypeDatagram, append([]byte{1}, "other context"...))
+		http3.WriteCapsule(w, capsuleTypeDatagram, append([]byte{0}, large...))
+	}()
+	buf := make([]byte, 2000)
+	n, _, err = conn.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, large, buf[:n])
+
+	// deadlines
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, _, err = conn.ReadFrom(b)
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+
+	// changing the deadline unblocks ReadFrom
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Hour)))
+	errChan := make(chan error, 1)
+	go func() {
+		_, _, err := conn.ReadFrom(b)
+		errChan <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, conn.SetReadDeadline(time.Now()))
+	select {
+	case err := <-errChan:
+		require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("ReadFrom should have returned")
+	}
+	require.NoError(t, conn.SetReadDeadline(time.Time{}))
+
+	// writing capsules blocks until the proxy reads them, and respects the write deadline
+	require.NoError(t, conn.SetWriteDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = conn.WriteTo(large, raddr)
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	require.NoError(t, conn.SetWriteDeadline(time.Time{}))
+
+	// the connection is closed when the connection to the proxy is closed
+	close(dc.received)
+	_, _, err = conn.ReadFrom(b)
+	require.Error(t, err)
+	require.NoError(t, conn.Close())
+	require.True(t, closed)
+	_, err = conn.WriteTo([]byte("foobar"), raddr)
+	require.ErrorIs(t, err, net.ErrClosed)
+}
+
+// connectUDPProxy is a minimal CONNECT-UDP proxy (RFC 9298), using the quic-go HTTP/3 server.
+// It counts the packets received from the client in datagrams and in capsules.
+type connectUDPProxy struct {
+	addr                *net.UDPAddr
+	datagrams, capsules atomic.Int64
+}
+
+func newConnectUDPProxy(t *testing.T) *connectUDPProxy {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	p := &connectUDPProxy{addr: conn.LocalAddr().(*net.UDPAddr)}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+	cert, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	tlsConf := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{cert}, PrivateKey: key}}}
+	server := &http3.Server{TLSConfig: tlsConf, EnableDatagrams: true, Handler: http.HandlerFunc(p.handle)}
+	go server.Serve(conn)
+	t.Cleanup(func() {
+		server.Close()
+		conn.Close()
+	})
+	return p
+}
+
+func (p *connectUDPProxy) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect || r.Proto != "connect-udp" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	// The path is /masque/{target_host}/{target_port}/.
+	parts := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	host, err := url.PathUnescape(parts[1])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	target, err := net.ResolveUDPAddr("udp", net.JoinHostPort(host, parts[2]))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	uconn, err := net.DialUDP("udp", nil, target)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer uconn.Close()
+	w.Header().Set("Capsule-Protocol", "?1")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+
+	str := r.Body.(http3.HTTPStreamer).HTTPStream()
+	conn := w.(http3.Hijacker).StreamCreator().(quic.Connection)
+	prefix := quicvarint.Append(nil, uint64(str.StreamID())/4)
+	prefix = quicvarint.Append(prefix, 0)
+
+	go func() {
+		for {
+			b, err := conn.ReceiveMessage()
+			if err != nil {
+				return
+			}
+			if bytes.HasPrefix(b, prefix) {
+				p.datagrams.Add(1)
+				uconn.Write(b[len(prefix):])
+			}
+		}
+	}()
+	go func() {
+		defer uconn.Close()
+		r := quicvarint.NewReader(bufio.NewReader(str))
+		for {
+			ct, b, err := readCapsule(r)
+			if err != nil {
+				return
+			}
+			if ct == capsuleTypeDatagram && len(b) > 0 && b[0] == 0 {
+				p.capsules.Add(1)
+				uconn.Write(b[1:])
+			}
+		}
+	}()
+
+	buf := make([]byte, 1500)
+	for {
+		n, err := uconn.Read(buf)
+		if err != nil {
+			return
+		}
+		if len(prefix)+n <= maxProxiedDatagramSize {
+			if err := conn.SendMessage(append(prefix[:len(prefix):len(prefix)], buf[:n]...)); err == nil {
+				continue
+			}
+		}
+		if err := http3.WriteCapsule(quicvarint.NewWriter(str), capsuleTypeDatagram, append([]byte{0}, buf[:n]...)); err != nil {
+			return
+		}
+	}
+}
+
+func TestDialViaConnectUDPProxy(t *testing.T) {
+	proxy := newConnectUDPProxy(t)
+
+	serverCM, err := NewConnManager(quic.StatelessResetKey{})
+	require.NoError(t, err)
+	defer serverCM.Close()
+	_, serverTLSConf := getTLSConfForProto(t, "proto")
+	ln, err := serverCM.ListenQUIC(ma.StringCast("/ip4/127.0.0.1/udp/0/quic-v1"), serverTLSConf, nil)
+	require.NoError(t, err)
+	defer ln.Close()
+
+	clientCM, err := NewConnManager(quic.StatelessResetKey{}, ConnectUDPProxy(&Proxy{
+		URITemplate: fmt.Sprintf("https://127.0.0.1:%d/masque/{target_host}/{target_port}/", proxy.addr.Port),
+		TLSConfig:   &tls.Config{InsecureSkipVerify: true},
+	}))
+	require.NoError(t, err)
+	defer clientCM.Close()
+
+	const dataLen = 100 << 10
+	done := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept(context.Background())
+		if err != nil {
+			done <- err
+			return
+		}
+		defer conn.CloseWithError(0, "")
+		str, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			done <- err
+			return
+		}
+		data, err := io.ReadAll(str)
+		if err == nil {
+			_, err = str.Write(data)
+		}
+		str.Close()
+		done <- err
+		// wait for the client to receive the data
+		<-conn.Context().Done()
+	}()
+
+	clientKey, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	clientIdentity, err := libp2ptls.NewIdentity(clientKey)
+	require.NoError(t, err)
+	clientTLSConf, _ := clientIdentity.ConfigForPeer("")
+	clientTLSConf.NextProtos = []string{"proto"}
+	raddr, err := ToQuicMultiaddr(ln.Addr(), quic.Version1)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := clientCM.DialQUIC(ctx, raddr, clientTLSConf, nil)
+	require.NoError(t, err)
+	defer conn.CloseWithError(0, "")
+	str, err := conn.OpenStream()
+	require.NoError(t, err)
+	_, err = str.Write(make([]byte, dataLen))
+	require.NoError(t, err)
+	require.NoError(t, str.Close())
+	data, err := io.ReadAll(str)
+	require.NoError(t, err)
+	require.Len(t, data, dataLen)
+	require.NoError(t, <-done)
+
+	// The handshake packets are too large for datagrams, and are sent in capsules.
+	// Smaller packets, like the ones that only contain acknowledgments, are sent in datagrams.
+	require.NotZero(t, proxy.capsules.Load())
+	require.NotZero(t, proxy.datagrams.Load())
+}
@@ -14,7 +14,7 @@ var (
 )
 
 func ToQuicMultiaddr(na net.Addr, version quic.VersionNumber) (ma.Multiaddr, error) {
-	udpMA, err := manet.FromNetAddr(na)
+	udpMA, err := manet.FromNetAddr(unwrapAddr(na))
 	if err != nil {
 		return nil, err
 	}
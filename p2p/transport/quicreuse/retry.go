@@ -0,0 +1,187 @@
+package quicreuse
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go/logging"
+)
+
+// RetryConfig configures when the QUIC listener requires clients to validate their address
+// before it starts a handshake.
+//
+// A client that hasn't validated its address is sent a Retry packet containing a token, and has to
+// resend its Initial packet including that token. This costs the client a round trip, but makes it
+// impossible to use the listener for reflection attacks: the Retry packet is smaller than the Initial
+// packet that triggered it, and no handshake state is kept for spoofed source addresses.
+//
+// Independently of this configuration, QUIC limits the amount of data sent to an unvalidated address
+// to three times the amount of data received from it. This amplification limit is enforced by
+// quic-go and can't be changed. Packets dropped to prevent DoS are counted by the
+// quic_packets_dropped_total metric, with reason "dos_prevention".
+type RetryConfig struct {
+	// Always requires address validation for every new connection.
+	Always bool
+	// MaxHandshakes requires address validation once the number of handshakes in progress
+	// reaches this value. Zero disables this limit.
+	MaxHandshakes int
+	// MaxHandshakesPerIP requires address validation once the number of handshakes in progress
+	// with a single IP address reaches this value. IPv6 addresses are counted per /64 prefix,
+	// since hosts are usually assigned a whole /64. Zero disables this limit.
+	MaxHandshakesPerIP int
+	// MaxTokenAge is the maximum age of the token sent in a Retry packet.
+	// If zero, quic-go's default is used.
+	MaxTokenAge time.Duration
+}
+
+func (c *RetryConfig) validate() error {
+	if c.MaxHandshakes < 0 || c.MaxHandshakesPerIP < 0 {
+		return errors.New("handshake limits must not be negative")
+	}
+	if c.MaxTokenAge < 0 {
+		return errors.New("token age must not be negative")
+	}
+	return nil
+}
+
+// Reasons for requiring address validation, used as metrics labels.
+const (
+	retryReasonAlways       = "always"
+	retryReasonHandshakes   = "handshakes"
+	retryReasonHandshakesIP = "handshakes_per_ip"
+)
+
+// handshakeTracker tracks the server handshakes in progress, and decides whether
+// address validation is required for new connections.
+type handshakeTracker struct {
+	cfg     RetryConfig
+	metrics bool
+
+	mutex sync.Mutex
+	total int
+	perIP map[string]int
+}
+
+func newHandshakeTracker(cfg RetryConfig, metrics bool) *handshakeTracker {
+	return &handshakeTracker{
+		cfg:     cfg,
+		metrics: metrics,
+		perIP:   make(map[string]int),
+	}
+}
+
+// RequireAddressValidation is used as the quic.Config.RequireAddressValidation callback.
+func (t *handshakeTracker) RequireAddressValidation(addr net.Addr) bool {
+	reason := t.retryReason(addr)
+	if reason == "" {
+		return false
+	}
+	if t.metrics {
+		retriesRequired.WithLabelValues(reason).Inc()
+	}
+	return true
+}
+
+func (t *handshakeTracker) retryReason(addr net.Addr) string {
+	if t.cfg.Always {
+		return retryReasonAlways
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.cfg.MaxHandshakes > 0 && t.total >= t.cfg.MaxHandshakes {
+		return retryReasonHandshakes
+	}
+	if t.cfg.MaxHandshakesPerIP > 0 && t.perIP[ipKey(addr)] >= t.cfg.MaxHandshakesPerIP {
+		return retryReasonHandshakesIP
+	}
+	return ""
+}
+
+func (t *handshakeTracker) startHandshake(ip string) {
+	t.mutex.Lock()
+	t.total++
+	t.perIP[ip]++
+	t.mutex.Unlock()
+	if t.metrics {
+		handshakesInProgress.Inc()
+	}
+}
+
+func (t *handshakeTracker) finishHandshake(ip string) {
+	t.mutex.Lock()
+	t.total--
+	t.perIP[ip]--
+	if t.perIP[ip] <= 0 {
+		delete(t.perIP, ip)
+	}
+	t.mutex.Unlock()
+	if t.metrics {
+		handshakesInProgress.Dec()
+	}
+}
+
+// TracerForConnection returns a tracer that tracks the handshake of a server connection.
+func (t *handshakeTracker) TracerForConnection() logging.ConnectionTracer {
+	return &handshakeConnTracer{tracker: t}
+}
+
+// ipv6PrefixLen is the length of the prefix that IPv6 handshakes are counted by.
+const ipv6PrefixLen = 64
+
+func ipKey(addr net.Addr) string {
+	if a, ok := unwrapAddr(addr).(*net.UDPAddr); ok {
+		if a.IP.To4() != nil {
+			return a.IP.String()
+		}
+		return (&net.IPNet{IP: a.IP.Mask(net.CIDRMask(ipv6PrefixLen, 128)), Mask: net.CIDRMask(ipv6PrefixLen, 128)}).String()
+	}
+	return addr.String()
+}
+
+type handshakeConnTracer struct {
+	logging.NullConnectionTracer
+
+	tracker *handshakeTracker
+
+	mutex    sync.Mutex
+	ip       string
+	started  bool
+	finished bool
+}
+
+var _ logging.ConnectionTracer = &handshakeConnTracer{}
+
+func (h *handshakeConnTracer) StartedConnection(_, remote net.Addr, _, _ logging.ConnectionID) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.started {
+		return
+	}
+	h.started = true
+	h.ip = ipKey(remote)
+	h.tracker.startHandshake(h.ip)
+}
+
+func (h *handshakeConnTracer) DroppedEncryptionLevel(level logging.EncryptionLevel) {
+	if level == logging.EncryptionHandshake {
+		h.finish()
+	}
+}
+
+func (h *handshakeConnTracer) Close() {
+	h.finish()
+}
+
+// finish marks the handshake as no longer in progress, either because it completed,
+// or because the connection was closed.
+func (h *handshakeConnTracer) finish() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if !h.started || h.finished {
+		return
+	}
+	h.finished = true
+	h.tracker.finishHandshake(h.ip)
+}
@@ -0,0 +1,84 @@
+package quicreuse
+
+import (
+	"net"
+	"testing"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/logging"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryOption(t *testing.T) {
+	_, err := NewConnManager(quic.StatelessResetKey{}, WithRetry(RetryConfig{MaxHandshakes: -1}))
+	require.Error(t, err)
+
+	cm, err := NewConnManager(quic.StatelessResetKey{})
+	require.NoError(t, err)
+	defer cm.Close()
+	require.False(t, cm.serverConfig.RequireAddressValidation(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1234}))
+
+	cm, err = NewConnManager(quic.StatelessResetKey{}, WithRetry(RetryConfig{Always: true}), EnableMetrics())
+	require.NoError(t, err)
+	defer cm.Close()
+	require.True(t, cm.serverConfig.RequireAddressValidation(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1234}))
+	// address validation is only relevant for the server
+	require.False(t, cm.clientConfig.RequireAddressValidation(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1234}))
+}
+
+func TestRetryHandshakeLimits(t *testing.T) {
+	tr := newHandshakeTracker(RetryConfig{MaxHandshakes: 3, MaxHandshakesPerIP: 2}, false)
+	addr1 := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1234}
+	addr2 := &net.UDPAddr{IP: net.IPv4(5, 6, 7, 8), Port: 1234}
+
+	start := func(addr net.Addr) logging.ConnectionTracer {
+		ct := tr.TracerForConnection()
+		ct.StartedConnection(&net.UDPAddr{}, addr, quic.ConnectionID{}, quic.ConnectionID{})
+		return ct
+	}
+
+	c1 := start(addr1)
+	require.False(t, tr.RequireAddressValidation(addr1))
+	c2 := start(&net.UDPAddr{IP: addr1.IP, Port: 4321})
+	require.Equal(t, retryReasonHandshakesIP, tr.retryReason(addr1))
+	require.False(t, tr.RequireAddressValidation(addr2))
+	c3 := start(addr2)
+	require.Equal(t, retryReasonHandshakes, tr.retryReason(addr2))
+
+	// completing the handshake frees up a slot
+	c1.DroppedEncryptionLevel(logging.EncryptionInitial)
+	require.True(t, tr.RequireAddressValidation(addr2))
+	c1.DroppedEncryptionLevel(logging.EncryptionHandshake)
+	require.False(t, tr.RequireAddressValidation(addr2))
+	// closing the connection after the handshake completed doesn't free up another slot
+	c1.Close()
+	require.Equal(t, 2, tr.total)
+	c4 := start(addr2)
+	require.True(t, tr.RequireAddressValidation(addr1))
+
+	// closing the connection during the handshake frees up a slot as well
+	c2.Close()
+	require.False(t, tr.RequireAddressValidation(addr1))
+	c4.Close()
+	c3.DroppedEncryptionLevel(logging.EncryptionHandshake)
+	c3.Close()
+	require.Zero(t, tr.total)
+	require.Empty(t, tr.perIP)
+}
+
+func TestRetryHandshakeLimitsIPv6(t *testing.T) {
+	tr := newHandshakeTracker(RetryConfig{MaxHandshakesPerIP: 2}, false)
+	start := func(addr net.Addr) {
+		tr.TracerForConnection().StartedConnection(&net.UDPAddr{}, addr, quic.ConnectionID{}, quic.ConnectionID{})
+	}
+
+	// addresses in the same /64 are counted together
+	start(&net.UDPAddr{IP: net.ParseIP("2001:db8:1:2::1"), Port: 1234})
+	start(&net.UDPAddr{IP: net.ParseIP("2001:db8:1:2:ffff::2"), Port: 1234})
+	require.Equal(t, retryReasonHandshakesIP, tr.retryReason(&net.UDPAddr{IP: net.ParseIP("2001:db8:1:2::3"), Port: 1234}))
+	require.False(t, tr.RequireAddressValidation(&net.UDPAddr{IP: net.ParseIP("2001:db8:1:3::1"), Port: 1234}))
+	require.Equal(t, map[string]int{"2001:db8:1:2::/64": 2}, tr.perIP)
+
+	// IPv4-mapped addresses are counted per address
+	require.Equal(t, "1.2.3.4", ipKey(&net.UDPAddr{IP: net.ParseIP("::ffff:1.2.3.4"), Port: 1234}))
+}
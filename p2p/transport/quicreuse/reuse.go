@@ -7,6 +7,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/network"
+	ipnet "github.com/libp2p/go-libp2p/core/pnet"
+
 	"github.com/google/gopacket/routing"
 	"github.com/libp2p/go-netroute"
 	"github.com/quic-go/quic-go"
@@ -33,11 +36,13 @@ type singleOwnerTransport struct {
 
 	// Used to write packets directly around QUIC.
 	packetConn net.PacketConn
+	// fd is the file descriptor reserved for packetConn. May be nil.
+	fd *fdReservation
 }
 
 func (c *singleOwnerTransport) IncreaseCount() {}
 func (c *singleOwnerTransport) DecreaseCount() {
-	c.Transport.Close()
+	c.Close()
 }
 
 func (c *singleOwnerTransport) LocalAddr() net.Addr {
@@ -45,6 +50,7 @@ func (c *singleOwnerTransport) LocalAddr() net.Addr {
 }
 
 func (c *singleOwnerTransport) Close() error {
+	defer c.fd.release()
 	// TODO(when we drop support for go 1.19) use errors.Join
 	c.Transport.Close()
 	return c.packetConn.Close()
@@ -66,6 +72,8 @@ type refcountedTransport struct {
 
 	// Used to write packets directly around QUIC.
 	packetConn net.PacketConn
+	// fd is the file descriptor reserved for packetConn. May be nil.
+	fd *fdReservation
 
 	mutex       sync.Mutex
 	refCount    int
@@ -80,6 +88,7 @@ func (c *refcountedTransport) IncreaseCount() {
 }
 
 func (c *refcountedTransport) Close() error {
+	defer c.fd.release()
 	// TODO(when we drop support for go 1.19) use errors.Join
 	c.Transport.Close()
 	return c.packetConn.Close()
@@ -126,9 +135,11 @@ type reuse struct {
 
 	statelessResetKey *quic.StatelessResetKey
 	metricsTracer     *metricsTracer
+	psk               ipnet.PSK
+	fds               network.FDManager
 }
 
-func newReuse(srk *quic.StatelessResetKey, mt *metricsTracer) *reuse {
+func newReuse(srk *quic.StatelessResetKey, mt *metricsTracer, psk ipnet.PSK, fds network.FDManager) *reuse {
 	r := &reuse{
 		unicast:           make(map[string]map[int]*refcountedTransport),
 		globalListeners:   make(map[int]*refcountedTransport),
@@ -137,6 +148,8 @@ func newReuse(srk *quic.StatelessResetKey, mt *metricsTracer) *reuse {
 		gcStopChan:        make(chan struct{}),
 		statelessResetKey: srk,
 		metricsTracer:     mt,
+		psk:               psk,
+		fds:               fds,
 	}
 	go r.gc()
 	return r
@@ -265,14 +278,14 @@ func (r *reuse) transportForDialLocked(network string, source *net.IP) (*refcoun
 	case "udp6":
 		addr = &net.UDPAddr{IP: net.IPv6zero, Port: 0}
 	}
-	conn, err := listenAndOptimize(network, addr)
+	conn, fd, err := listenUDP(network, addr, r.psk, r.fds)
 	if err != nil {
 		return nil, err
 	}
 	tr := &refcountedTransport{Transport: quic.Transport{
 		Conn:              conn,
 		StatelessResetKey: r.statelessResetKey,
-	}, packetConn: conn}
+	}, packetConn: conn, fd: fd}
 	if r.metricsTracer != nil {
 		tr.Transport.Tracer = r.metricsTracer
 	}
@@ -314,7 +327,7 @@ func (r *reuse) TransportForListen(network string, laddr *net.UDPAddr) (*refcoun
 		}
 	}
 
-	conn, err := listenAndOptimize(network, laddr)
+	conn, fd, err := listenUDP(network, laddr, r.psk, r.fds)
 	if err != nil {
 		return nil, err
 	}
@@ -322,7 +335,7 @@ func (r *reuse) TransportForListen(network string, laddr *net.UDPAddr) (*refcoun
 	tr := &refcountedTransport{Transport: quic.Transport{
 		Conn:              conn,
 		StatelessResetKey: r.statelessResetKey,
-	}, packetConn: conn}
+	}, packetConn: conn, fd: fd}
 	if r.metricsTracer != nil {
 		tr.Transport.Tracer = r.metricsTracer
 	}
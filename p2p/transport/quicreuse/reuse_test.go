@@ -6,9 +6,12 @@ import (
 	"os"
 	"runtime/pprof"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/network"
+
 	"github.com/libp2p/go-netroute"
 	"github.com/stretchr/testify/require"
 )
@@ -61,7 +64,7 @@ func cleanup(t *testing.T, reuse *reuse) {
 }
 
 func TestReuseListenOnAllIPv4(t *testing.T) {
-	reuse := newReuse(nil, nil)
+	reuse := newReuse(nil, nil, nil, nil)
 	require.Eventually(t, isGarbageCollectorRunning, 500*time.Millisecond, 50*time.Millisecond, "expected garbage collector to be running")
 	cleanup(t, reuse)
 
@@ -73,7 +76,7 @@ func TestReuseListenOnAllIPv4(t *testing.T) {
 }
 
 func TestReuseListenOnAllIPv6(t *testing.T) {
-	reuse := newReuse(nil, nil)
+	reuse := newReuse(nil, nil, nil, nil)
 	require.Eventually(t, isGarbageCollectorRunning, 500*time.Millisecond, 50*time.Millisecond, "expected garbage collector to be running")
 	cleanup(t, reuse)
 
@@ -86,7 +89,7 @@ func TestReuseListenOnAllIPv6(t *testing.T) {
 }
 
 func TestReuseCreateNewGlobalConnOnDial(t *testing.T) {
-	reuse := newReuse(nil, nil)
+	reuse := newReuse(nil, nil, nil, nil)
 	cleanup(t, reuse)
 
 	addr, err := net.ResolveUDPAddr("udp4", "1.1.1.1:1234")
@@ -100,7 +103,7 @@ func TestReuseCreateNewGlobalConnOnDial(t *testing.T) {
 }
 
 func TestReuseConnectionWhenDialing(t *testing.T) {
-	reuse := newReuse(nil, nil)
+	reuse := newReuse(nil, nil, nil, nil)
 	cleanup(t, reuse)
 
 	addr, err := net.ResolveUDPAddr("udp4", "0.0.0.0:0")
@@ -117,7 +120,7 @@ func TestReuseConnectionWhenDialing(t *testing.T) {
 }
 
 func TestReuseConnectionWhenListening(t *testing.T) {
-	reuse := newReuse(nil, nil)
+	reuse := newReuse(nil, nil, nil, nil)
 	cleanup(t, reuse)
 
 	raddr, err := net.ResolveUDPAddr("udp4", "1.1.1.1:1234")
@@ -132,7 +135,7 @@ func TestReuseConnectionWhenListening(t *testing.T) {
 }
 
 func TestReuseConnectionWhenDialBeforeListen(t *testing.T) {
-	reuse := newReuse(nil, nil)
+	reuse := newReuse(nil, nil, nil, nil)
 	cleanup(t, reuse)
 
 	// dial any address
@@ -166,7 +169,7 @@ func TestReuseListenOnSpecificInterface(t *testing.T) {
 	if platformHasRoutingTables() {
 		t.Skip("this test only works on platforms that support routing tables")
 	}
-	reuse := newReuse(nil, nil)
+	reuse := newReuse(nil, nil, nil, nil)
 	cleanup(t, reuse)
 
 	router, err := netroute.New()
@@ -203,7 +206,7 @@ func TestReuseGarbageCollect(t *testing.T) {
 		maxUnusedDuration = 10 * maxUnusedDuration
 	}
 
-	reuse := newReuse(nil, nil)
+	reuse := newReuse(nil, nil, nil, nil)
 	cleanup(t, reuse)
 
 	numGlobals := func() int {
@@ -238,3 +241,55 @@ func TestReuseGarbageCollect(t *testing.T) {
 	}
 	require.Eventually(t, func() bool { return numGlobals() == 0 }, 4*garbageCollectInterval, 10*time.Millisecond)
 }
+
+type mockFDManager struct {
+	mx    sync.Mutex
+	fds   map[string]int
+	limit int
+}
+
+func (m *mockFDManager) ReserveFD(transport string) error {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	if m.fds[transport] >= m.limit {
+		return network.ErrResourceLimitExceeded
+	}
+	m.fds[transport]++
+	return nil
+}
+
+func (m *mockFDManager) ReleaseFD(transport string) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	m.fds[transport]--
+}
+
+func (m *mockFDManager) count() int {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+	return m.fds[fdTransportName]
+}
+
+func TestReuseFDAccounting(t *testing.T) {
+	fds := &mockFDManager{fds: make(map[string]int), limit: 1}
+	reuse := newReuse(nil, nil, nil, fds)
+	defer reuse.Close()
+
+	tr, err := reuse.TransportForListen("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	require.NoError(t, err)
+	require.Equal(t, 1, fds.count())
+	// reusing the socket doesn't use another file descriptor
+	dialTr, err := reuse.TransportForDial("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234})
+	require.NoError(t, err)
+	require.Equal(t, tr, dialTr)
+	require.Equal(t, 1, fds.count())
+	// a new socket exceeds the limit
+	_, err = reuse.TransportForListen("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	require.ErrorIs(t, err, network.ErrResourceLimitExceeded)
+
+	require.NoError(t, tr.Close())
+	require.Zero(t, fds.count())
+	// closing again doesn't release the file descriptor twice
+	tr.Close()
+	require.Zero(t, fds.count())
+}
@@ -23,6 +23,10 @@ var (
 	droppedPackets   *prometheus.CounterVec
 	lostPackets      *prometheus.CounterVec
 	connErrors       *prometheus.CounterVec
+	keyUpdates       *prometheus.CounterVec
+
+	retriesRequired      *prometheus.CounterVec
+	handshakesInProgress prometheus.Gauge
 )
 
 type aggregatingCollector struct {
@@ -164,6 +168,29 @@ func initMetrics() {
 		[]string{encLevel, "reason"},
 	)
 	prometheus.MustRegister(lostPackets)
+	keyUpdates = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "quic_key_updates_total",
+			Help: "QUIC 1-RTT key updates",
+		},
+		[]string{"initiator"},
+	)
+	prometheus.MustRegister(keyUpdates)
+	retriesRequired = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "quic_retries_required_total",
+			Help: "Incoming QUIC connections required to validate their address",
+		},
+		[]string{"reason"},
+	)
+	prometheus.MustRegister(retriesRequired)
+	handshakesInProgress = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "quic_server_handshakes_in_progress",
+			Help: "Incoming QUIC handshakes in progress",
+		},
+	)
+	prometheus.MustRegister(handshakesInProgress)
 	collector = newAggregatingCollector()
 	prometheus.MustRegister(collector)
 }
@@ -349,6 +376,14 @@ func (m *metricsConnTracer) DroppedEncryptionLevel(level logging.EncryptionLevel
 	}
 }
 
+func (m *metricsConnTracer) UpdatedKey(_ logging.KeyPhase, remote bool) {
+	initiator := "local"
+	if remote {
+		initiator = "remote"
+	}
+	keyUpdates.WithLabelValues(initiator).Inc()
+}
+
 func (m *metricsConnTracer) Close() {
 	if m.handshakeComplete {
 		closedConns.WithLabelValues(m.getDirection()).Inc()
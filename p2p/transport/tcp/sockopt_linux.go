@@ -0,0 +1,51 @@
+//go:build linux
+
+package tcp
+
+import (
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fastOpenQueueLength is the maximum number of pending TFO requests of a listener.
+const fastOpenQueueLength = 256
+
+const fastOpenSupported = true
+
+// setKeepAliveInterval sets the interval between keepalive probes.
+// Depending on the Go version, net.TCPConn.SetKeepAlivePeriod only sets the idle time before the first probe.
+func setKeepAliveInterval(c syscall.RawConn, d time.Duration) error {
+	secs := int(d / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return setsockoptInt(c, unix.IPPROTO_TCP, unix.TCP_KEEPINTVL, secs)
+}
+
+func setKeepAliveCount(c syscall.RawConn, n int) error {
+	return setsockoptInt(c, unix.IPPROTO_TCP, unix.TCP_KEEPCNT, n)
+}
+
+// fastOpenListen is used as the Control function of a listener,
+// allowing clients to send data in the SYN.
+func fastOpenListen(_, _ string, c syscall.RawConn) error {
+	return setsockoptInt(c, unix.IPPROTO_TCP, unix.TCP_FASTOPEN, fastOpenQueueLength)
+}
+
+// fastOpenConnect is used as the Control function of a dialer,
+// allowing the kernel to send data in the SYN if it has a TFO cookie for the server.
+func fastOpenConnect(_, _ string, c syscall.RawConn) error {
+	return setsockoptInt(c, unix.IPPROTO_TCP, unix.TCP_FASTOPEN_CONNECT, 1)
+}
+
+func setsockoptInt(c syscall.RawConn, level, opt, value int) error {
+	var serr error
+	if err := c.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), level, opt, value)
+	}); err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,50 @@
+//go:build linux
+
+package tcp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func getsockoptInt(t *testing.T, conn *net.TCPConn, level, opt int) int {
+	t.Helper()
+	rc, err := conn.SyscallConn()
+	require.NoError(t, err)
+	var val int
+	var serr error
+	require.NoError(t, rc.Control(func(fd uintptr) {
+		val, serr = unix.GetsockoptInt(int(fd), level, opt)
+	}))
+	require.NoError(t, serr)
+	return val
+}
+
+func TestConfigureConn(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	tcpConn := conn.(*net.TCPConn)
+
+	tr, err := NewTCPTransport(nil, nil, KeepAlive(7*time.Second), KeepAliveCount(4), WithSocketBuffers(1<<16, 1<<16))
+	require.NoError(t, err)
+	tr.configureConn(conn)
+	require.Equal(t, 1, getsockoptInt(t, tcpConn, unix.SOL_SOCKET, unix.SO_KEEPALIVE))
+	require.Equal(t, 7, getsockoptInt(t, tcpConn, unix.IPPROTO_TCP, unix.TCP_KEEPIDLE))
+	require.Equal(t, 7, getsockoptInt(t, tcpConn, unix.IPPROTO_TCP, unix.TCP_KEEPINTVL))
+	require.Equal(t, 4, getsockoptInt(t, tcpConn, unix.IPPROTO_TCP, unix.TCP_KEEPCNT))
+	// the kernel doubles the buffer size to account for bookkeeping overhead
+	require.GreaterOrEqual(t, getsockoptInt(t, tcpConn, unix.SOL_SOCKET, unix.SO_RCVBUF), 1<<16)
+
+	tr, err = NewTCPTransport(nil, nil, KeepAlive(0))
+	require.NoError(t, err)
+	tr.configureConn(conn)
+	require.Equal(t, 0, getsockoptInt(t, tcpConn, unix.SOL_SOCKET, unix.SO_KEEPALIVE))
+}
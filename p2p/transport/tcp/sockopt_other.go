@@ -0,0 +1,21 @@
+//go:build !linux
+
+package tcp
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+const fastOpenSupported = false
+
+var errSockoptUnsupported = errors.New("socket option not supported on this platform")
+
+func setKeepAliveInterval(syscall.RawConn, time.Duration) error { return errSockoptUnsupported }
+
+func setKeepAliveCount(syscall.RawConn, int) error { return errSockoptUnsupported }
+
+func fastOpenListen(_, _ string, _ syscall.RawConn) error { return errSockoptUnsupported }
+
+func fastOpenConnect(_, _ string, _ syscall.RawConn) error { return errSockoptUnsupported }
@@ -26,6 +26,8 @@ var log = logging.Logger("tcp-tpt")
 
 const keepAlivePeriod = 30 * time.Second
 
+var errSyscallConnUnavailable = errors.New("raw connection not available")
+
 type canKeepAlive interface {
 	SetKeepAlive(bool) error
 	SetKeepAlivePeriod(time.Duration) error
@@ -33,12 +35,15 @@ type canKeepAlive interface {
 
 var _ canKeepAlive = &net.TCPConn{}
 
-func tryKeepAlive(conn net.Conn, keepAlive bool) {
+// tryKeepAlive enables TCP keepalives with the given period.
+// A period of 0 disables keepalives.
+func tryKeepAlive(conn net.Conn, period time.Duration) {
 	keepAliveConn, ok := conn.(canKeepAlive)
 	if !ok {
 		log.Errorf("Can't set TCP keepalives.")
 		return
 	}
+	keepAlive := period > 0
 	if err := keepAliveConn.SetKeepAlive(keepAlive); err != nil {
 		// Sometimes we seem to get "invalid argument" results from this function on Darwin.
 		// This might be due to a closed connection, but I can't reproduce that on Linux.
@@ -52,9 +57,12 @@ func tryKeepAlive(conn net.Conn, keepAlive bool) {
 		}
 		return
 	}
+	if !keepAlive {
+		return
+	}
 
 	if runtime.GOOS != "openbsd" {
-		if err := keepAliveConn.SetKeepAlivePeriod(keepAlivePeriod); err != nil {
+		if err := keepAliveConn.SetKeepAlivePeriod(period); err != nil {
 			log.Errorw("failed set keepalive period", "error", err)
 		}
 	}
@@ -74,6 +82,7 @@ func tryLinger(conn net.Conn, sec int) {
 type tcpListener struct {
 	manet.Listener
 	sec int
+	tr  *TcpTransport
 }
 
 func (ll *tcpListener) Accept() (manet.Conn, error) {
@@ -82,7 +91,7 @@ func (ll *tcpListener) Accept() (manet.Conn, error) {
 		return nil, err
 	}
 	tryLinger(c, ll.sec)
-	tryKeepAlive(c, true)
+	ll.tr.configureConn(c)
 	// We're not calling OpenConnection in the resource manager here,
 	// since the manet.Conn doesn't allow us to save the scope.
 	// It's the caller's (usually the p2p/net/upgrader) responsibility
@@ -113,6 +122,63 @@ func WithMetrics() Option {
 	}
 }
 
+// WithFastOpen enables TCP Fast Open (TFO), allowing data to be sent in the SYN
+// when reconnecting to a peer, saving a round trip on connection establishment.
+// TFO is currently only supported on Linux, and needs to be enabled in the kernel
+// (net.ipv4.tcp_fastopen). On other platforms, this option has no effect.
+//
+// When dialing with TFO, the SYN is only sent with the first write, so dial errors
+// surface during the handshake of the security protocol. Simultaneous connects
+// (used for hole punching) never use TFO.
+func WithFastOpen() Option {
+	return func(tr *TcpTransport) error {
+		tr.fastOpen = true
+		return nil
+	}
+}
+
+// KeepAlive sets the TCP keepalive period, i.e. the idle time before the first keepalive
+// probe is sent, and the interval between subsequent probes.
+// A period of 0 disables TCP keepalives. Defaults to 30s.
+func KeepAlive(period time.Duration) Option {
+	return func(tr *TcpTransport) error {
+		if period < 0 {
+			return errors.New("keepalive period must be non-negative")
+		}
+		tr.keepAlivePeriod = period
+		tr.customSockopts = true
+		return nil
+	}
+}
+
+// KeepAliveCount sets the number of unacknowledged keepalive probes after which
+// the connection is considered dead. This is currently only supported on Linux.
+// By default, the system default is used.
+func KeepAliveCount(n int) Option {
+	return func(tr *TcpTransport) error {
+		if n <= 0 {
+			return errors.New("keepalive count must be positive")
+		}
+		tr.keepAliveCount = n
+		tr.customSockopts = true
+		return nil
+	}
+}
+
+// WithSocketBuffers sets the size of the receive and the send buffer of TCP sockets, in bytes.
+// A size of 0 keeps the system default.
+func WithSocketBuffers(read, write int) Option {
+	return func(tr *TcpTransport) error {
+		if read < 0 || write < 0 {
+			return errors.New("socket buffer sizes must be non-negative")
+		}
+		tr.readBuffer = read
+		tr.writeBuffer = write
+		tr.customSockopts = true
+		return nil
+	}
+}
+
 // TcpTransport is the TCP transport.
 type TcpTransport struct {
 	// Connection upgrader for upgrading insecure stream connections to
@@ -125,6 +191,15 @@ type TcpTransport struct {
 	// TCP connect timeout
 	connectTimeout time.Duration
 
+	fastOpen        bool
+	keepAlivePeriod time.Duration // 0 disables keepalives
+	keepAliveCount  int           // 0 means system default
+	readBuffer      int           // 0 means system default
+	writeBuffer     int           // 0 means system default
+	// customSockopts is set if socket options were configured, which then also need to be applied
+	// to accepted connections
+	customSockopts bool
+
 	rcmgr network.ResourceManager
 
 	reuse reuseport.Transport
@@ -139,19 +214,32 @@ func NewTCPTransport(upgrader transport.Upgrader, rcmgr network.ResourceManager,
 		rcmgr = &network.NullResourceManager{}
 	}
 	tr := &TcpTransport{
-		upgrader:       upgrader,
-		connectTimeout: defaultConnectTimeout, // can be set by using the WithConnectionTimeout option
-		rcmgr:          rcmgr,
+		upgrader:        upgrader,
+		connectTimeout:  defaultConnectTimeout, // can be set by using the WithConnectionTimeout option
+		keepAlivePeriod: keepAlivePeriod,
+		rcmgr:           rcmgr,
 	}
 	for _, o := range opts {
 		if err := o(tr); err != nil {
 			return nil, err
 		}
 	}
+	if tr.fastOpen && !fastOpenSupported {
+		log.Warn("TCP Fast Open is not supported on this platform")
+		tr.fastOpen = false
+	}
+	if tr.fastOpen {
+		tr.reuse.DialControl = fastOpenDialControl
+		tr.reuse.ListenControl = fastOpenListen
+	}
 	return tr, nil
 }
 
-var dialMatcher = mafmt.And(mafmt.IP, mafmt.Base(ma.P_TCP))
+// dialMatcher also matches IPv6 (link-local) addresses scoped to a zone, i.e. /ip6zone/<zone>/ip6/...
+var dialMatcher = mafmt.And(
+	mafmt.Or(mafmt.IP, mafmt.And(mafmt.Base(ma.P_IP6ZONE), mafmt.Base(ma.P_IP6))),
+	mafmt.Base(ma.P_TCP),
+)
 
 // CanDial returns true if this transport believes it can dial the given
 // multiaddr.
@@ -171,6 +259,11 @@ func (t *TcpTransport) maDial(ctx context.Context, raddr ma.Multiaddr) (manet.Co
 		return t.reuse.DialContext(ctx, raddr)
 	}
 	var d manet.Dialer
+	if t.fastOpen {
+		d.Dialer.Control = func(nw, address string, c syscall.RawConn) error {
+			return fastOpenDialControl(ctx, nw, address, c)
+		}
+	}
 	return d.DialContext(ctx, raddr)
 }
 
@@ -195,7 +288,9 @@ func (t *TcpTransport) dialWithScope(ctx context.Context, raddr ma.Multiaddr, p
 		log.Debugw("resource manager blocked outgoing connection for peer", "peer", p, "addr", raddr, "error", err)
 		return nil, err
 	}
-	conn, err := t.maDial(ctx, raddr)
+	dctx, cancel := network.WithDialStage(ctx, network.DialStageTransport)
+	conn, err := t.maDial(dctx, raddr)
+	cancel()
 	if err != nil {
 		return nil, err
 	}
@@ -203,7 +298,7 @@ func (t *TcpTransport) dialWithScope(ctx context.Context, raddr ma.Multiaddr, p
 	// linger is 0, connections are _reset_ instead of closed with a FIN.
 	// This means we can immediately reuse the 5-tuple and reconnect.
 	tryLinger(conn, 0)
-	tryKeepAlive(conn, true)
+	t.configureConn(conn)
 	c := conn
 	if t.enableMetrics {
 		var err error
@@ -219,6 +314,69 @@ func (t *TcpTransport) dialWithScope(ctx context.Context, raddr ma.Multiaddr, p
 	return t.upgrader.Upgrade(ctx, t, c, direction, p, connScope)
 }
 
+// fastOpenDialControl enables TFO on outgoing connections.
+// With TFO, the SYN is only sent with the first write. TFO therefore can't be used for
+// simultaneous connects (used for hole punching), where the server side never writes first.
+func fastOpenDialControl(ctx context.Context, nw, address string, c syscall.RawConn) error {
+	if ok, _, _ := network.GetSimultaneousConnect(ctx); ok {
+		return nil
+	}
+	if err := fastOpenConnect(nw, address, c); err != nil {
+		log.Debugw("failed to enable TCP Fast Open", "error", err)
+	}
+	return nil
+}
+
+// configureConn applies the configured socket options to a connection.
+func (t *TcpTransport) configureConn(conn net.Conn) {
+	tryKeepAlive(conn, t.keepAlivePeriod)
+	if t.customSockopts && t.keepAlivePeriod > 0 {
+		if err := trySetsockopt(conn, func(c syscall.RawConn) error { return setKeepAliveInterval(c, t.keepAlivePeriod) }); err != nil {
+			log.Debugw("failed to set keepalive interval", "error", err)
+		}
+	}
+	if t.keepAliveCount > 0 && t.keepAlivePeriod > 0 {
+		if err := trySetsockopt(conn, func(c syscall.RawConn) error { return setKeepAliveCount(c, t.keepAliveCount) }); err != nil {
+			log.Debugw("failed to set keepalive count", "error", err)
+		}
+	}
+
+	type canSetBuffers interface {
+		SetReadBuffer(int) error
+		SetWriteBuffer(int) error
+	}
+	if t.readBuffer == 0 && t.writeBuffer == 0 {
+		return
+	}
+	bufConn, ok := conn.(canSetBuffers)
+	if !ok {
+		log.Debug("can't set TCP socket buffers")
+		return
+	}
+	if t.readBuffer > 0 {
+		if err := bufConn.SetReadBuffer(t.readBuffer); err != nil {
+			log.Debugw("failed to set read buffer", "error", err)
+		}
+	}
+	if t.writeBuffer > 0 {
+		if err := bufConn.SetWriteBuffer(t.writeBuffer); err != nil {
+			log.Debugw("failed to set write buffer", "error", err)
+		}
+	}
+}
+
+func trySetsockopt(conn net.Conn, set func(syscall.RawConn) error) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return errSyscallConnUnavailable
+	}
+	c, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	return set(c)
+}
+
 // UseReuseport returns true if reuseport is enabled and available.
 func (t *TcpTransport) UseReuseport() bool {
 	return !t.disableReuseport && ReuseportIsAvailable()
@@ -228,6 +386,18 @@ func (t *TcpTransport) maListen(laddr ma.Multiaddr) (manet.Listener, error) {
 	if t.UseReuseport() {
 		return t.reuse.Listen(laddr)
 	}
+	if t.fastOpen {
+		network, addr, err := manet.DialArgs(laddr)
+		if err != nil {
+			return nil, err
+		}
+		lc := net.ListenConfig{Control: fastOpenListen}
+		l, err := lc.Listen(context.Background(), network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return manet.WrapNetListener(l)
+	}
 	return manet.Listen(laddr)
 }
 
@@ -238,7 +408,9 @@ func (t *TcpTransport) Listen(laddr ma.Multiaddr) (transport.Listener, error) {
 		return nil, err
 	}
 	if t.enableMetrics {
-		list = newTracingListener(&tcpListener{list, 0})
+		list = newTracingListener(&tcpListener{list, 0, t})
+	} else if t.customSockopts {
+		list = &tcpListener{list, 0, t}
 	}
 	return t.upgrader.UpgradeListener(t, list), nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/network"
@@ -45,6 +46,36 @@ func TestTcpTransport(t *testing.T) {
 	envReuseportVal = true
 }
 
+func TestTcpTransportSocketOptions(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		opts := []Option{WithFastOpen(), KeepAlive(10 * time.Second), KeepAliveCount(3), WithSocketBuffers(1<<20, 1<<20)}
+		peerA, ia := makeInsecureMuxer(t)
+		_, ib := makeInsecureMuxer(t)
+
+		ua, err := tptu.New(ia, muxers, nil, nil, nil)
+		require.NoError(t, err)
+		ta, err := NewTCPTransport(ua, nil, opts...)
+		require.NoError(t, err)
+		ub, err := tptu.New(ib, muxers, nil, nil, nil)
+		require.NoError(t, err)
+		tb, err := NewTCPTransport(ub, nil, opts...)
+		require.NoError(t, err)
+
+		zero := "/ip4/127.0.0.1/tcp/0"
+		ttransport.SubtestTransport(t, ta, tb, zero, peerA)
+
+		envReuseportVal = false
+	}
+	envReuseportVal = true
+
+	_, err := NewTCPTransport(nil, nil, KeepAlive(-time.Second))
+	require.Error(t, err)
+	_, err = NewTCPTransport(nil, nil, KeepAliveCount(0))
+	require.Error(t, err)
+	_, err = NewTCPTransport(nil, nil, WithSocketBuffers(-1, 0))
+	require.Error(t, err)
+}
+
 func TestTcpTransportWithMetrics(t *testing.T) {
 	peerA, ia := makeInsecureMuxer(t)
 	_, ib := makeInsecureMuxer(t)
@@ -130,6 +161,15 @@ func TestTcpTransportCantDialDNS(t *testing.T) {
 	envReuseportVal = true
 }
 
+func TestTcpTransportCanDialIP6Zone(t *testing.T) {
+	var u transport.Upgrader
+	tpt, err := NewTCPTransport(u, nil)
+	require.NoError(t, err)
+
+	require.True(t, tpt.CanDial(ma.StringCast("/ip6zone/eth0/ip6/fe80::1/tcp/1234")))
+	require.False(t, tpt.CanDial(ma.StringCast("/ip6zone/eth0/ip4/127.0.0.1/tcp/1234")))
+}
+
 func TestTcpTransportCantListenUtp(t *testing.T) {
 	for i := 0; i < 2; i++ {
 		utpa, err := ma.NewMultiaddr("/ip4/127.0.0.1/udp/0/utp")
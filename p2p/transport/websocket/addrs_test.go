@@ -22,6 +22,15 @@ func TestMultiaddrParsing(t *testing.T) {
 	if wsaddr.String() != "ws://127.0.0.1:5555" {
 		t.Fatalf("expected ws://127.0.0.1:5555, got %s", wsaddr)
 	}
+
+	// the zone of scoped IPv6 addresses is escaped
+	wsaddr, err = parseMultiaddr(ma.StringCast("/ip6zone/eth0/ip6/fe80::1/tcp/5555/ws"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wsaddr.String() != "ws://[fe80::1%25eth0]:5555" {
+		t.Fatalf("expected ws://[fe80::1%%25eth0]:5555, got %s", wsaddr)
+	}
 }
 
 type httpAddr struct {
@@ -3,6 +3,7 @@ package websocket
 import (
 	"io"
 	"net"
+	"os"
 	"sync"
 	"time"
 
@@ -25,6 +26,19 @@ type Conn struct {
 	closeOnce          sync.Once
 
 	readLock, writeLock sync.Mutex
+
+	// Write coalescing. Only used if coalesceDelay is larger than 0.
+	// All fields are protected by the writeLock.
+	coalesceDelay   time.Duration
+	coalesceMaxSize int
+	writeBuf        []byte
+	flushTimer      *time.Timer
+	// writeDeadline is the deadline set using SetWriteDeadline.
+	// Buffered writes are flushed before the deadline expires.
+	writeDeadline time.Time
+	// writeErr is the error that occurred when flushing the write buffer asynchronously.
+	// It is returned by subsequent writes.
+	writeErr error
 }
 
 var _ net.Conn = (*Conn)(nil)
@@ -92,6 +106,10 @@ func (c *Conn) Write(b []byte) (n int, err error) {
 	c.writeLock.Lock()
 	defer c.writeLock.Unlock()
 
+	if c.coalesceDelay > 0 {
+		return c.writeCoalesced(b)
+	}
+
 	if err := c.Conn.WriteMessage(c.DefaultMessageType, b); err != nil {
 		return 0, err
 	}
@@ -99,12 +117,101 @@ func (c *Conn) Write(b []byte) (n int, err error) {
 	return len(b), nil
 }
 
+// setWriteCoalescing enables coalescing small writes into a single WebSocket message.
+// Writes are buffered until maxSize bytes are buffered, or until delay has passed.
+func (c *Conn) setWriteCoalescing(delay time.Duration, maxSize int) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.coalesceDelay = delay
+	c.coalesceMaxSize = maxSize
+}
+
+// writeCoalesced buffers b, to be sent together with other writes.
+// The caller must hold the writeLock.
+func (c *Conn) writeCoalesced(b []byte) (int, error) {
+	if c.writeErr != nil {
+		return 0, c.writeErr
+	}
+	if !c.writeDeadline.IsZero() && !time.Now().Before(c.writeDeadline) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	if len(c.writeBuf) > 0 && len(c.writeBuf)+len(b) > c.coalesceMaxSize {
+		if err := c.flushLocked(); err != nil {
+			return 0, err
+		}
+	}
+	// Large writes don't benefit from coalescing. Send them right away.
+	if len(b) >= c.coalesceMaxSize {
+		if err := c.Conn.WriteMessage(c.DefaultMessageType, b); err != nil {
+			c.writeErr = err
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	c.writeBuf = append(c.writeBuf, b...)
+	// If the deadline expires before the buffer would be flushed, send the data right away,
+	// so that a deadline error is returned from this call to Write.
+	if !c.writeDeadline.IsZero() && time.Until(c.writeDeadline) <= c.coalesceDelay {
+		if err := c.flushLocked(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if c.flushTimer == nil {
+		c.flushTimer = time.AfterFunc(c.coalesceDelay, c.flushAsync)
+	}
+	return len(b), nil
+}
+
+func (c *Conn) flushAsync() {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if c.writeErr != nil {
+		return
+	}
+	c.flushLocked()
+}
+
+// flushLocked sends the buffered writes.
+// The caller must hold the writeLock.
+func (c *Conn) flushLocked() error {
+	if c.flushTimer != nil {
+		c.flushTimer.Stop()
+		c.flushTimer = nil
+	}
+	if len(c.writeBuf) == 0 {
+		return nil
+	}
+	err := c.Conn.WriteMessage(c.DefaultMessageType, c.writeBuf)
+	c.writeBuf = c.writeBuf[:0]
+	if err != nil {
+		c.writeErr = err
+	}
+	return err
+}
+
 // Close closes the connection. Only the first call to Close will receive the
 // close error, subsequent and concurrent calls will return nil.
 // This method is thread-safe.
 func (c *Conn) Close() error {
 	var err error
 	c.closeOnce.Do(func() {
+		// Send any buffered writes before closing the connection.
+		c.writeLock.Lock()
+		var err0 error
+		if c.coalesceDelay > 0 {
+			if c.writeErr == nil {
+				err0 = c.flushLocked()
+			}
+			c.writeErr = net.ErrClosed
+		}
+		c.writeLock.Unlock()
+
 		err1 := c.Conn.WriteControl(
 			ws.CloseMessage,
 			ws.FormatCloseMessage(ws.CloseNormalClosure, "closed"),
@@ -112,6 +219,8 @@ func (c *Conn) Close() error {
 		)
 		err2 := c.Conn.Close()
 		switch {
+		case err0 != nil:
+			err = err0
 		case err1 != nil:
 			err = err1
 		case err2 != nil:
@@ -150,6 +259,13 @@ func (c *Conn) SetWriteDeadline(t time.Time) error {
 	c.writeLock.Lock()
 	defer c.writeLock.Unlock()
 
+	// Data written before the deadline was changed is sent using the old deadline.
+	if c.coalesceDelay > 0 && c.writeErr == nil {
+		if err := c.flushLocked(); err != nil {
+			return err
+		}
+	}
+	c.writeDeadline = t
 	return c.Conn.SetWriteDeadline(t)
 }
 
@@ -11,6 +11,8 @@ import (
 
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
+
+	ws "github.com/gorilla/websocket"
 )
 
 type listener struct {
@@ -20,6 +22,10 @@ type listener struct {
 	// so we can't rely on checking if server.TLSConfig is set.
 	isWss bool
 
+	upgrader ws.Upgrader
+	// setupConn is called for every accepted connection. May be nil.
+	setupConn func(*Conn)
+
 	laddr ma.Multiaddr
 
 	closed   chan struct{}
@@ -73,6 +79,7 @@ func newListener(a ma.Multiaddr, tlsConf *tls.Config) (*listener, error) {
 	parsed.restMultiaddr = laddr
 
 	ln := &listener{
+		upgrader: upgrader,
 		nl:       nl,
 		laddr:    parsed.toMultiaddr(),
 		incoming: make(chan *Conn),
@@ -96,14 +103,18 @@ func (l *listener) serve() {
 }
 
 func (l *listener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	c, err := upgrader.Upgrade(w, r, nil)
+	c, err := l.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		// The upgrader writes a response for us.
 		return
 	}
 
+	conn := NewConn(c, l.isWss)
+	if l.setupConn != nil {
+		l.setupConn(conn)
+	}
 	select {
-	case l.incoming <- NewConn(c, l.isWss):
+	case l.incoming <- conn:
 	case <-l.closed:
 		c.Close()
 	}
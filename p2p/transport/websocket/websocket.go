@@ -2,8 +2,10 @@
 package websocket
 
 import (
+	"compress/flate"
 	"context"
 	"crypto/tls"
+	"errors"
 	"net"
 	"net/http"
 	"time"
@@ -22,8 +24,9 @@ import (
 // WsFmt is multiaddr formatter for WsProtocol
 var WsFmt = mafmt.And(mafmt.TCP, mafmt.Base(ma.P_WS))
 
+// dialMatcher also matches IPv6 (link-local) addresses scoped to a zone, i.e. /ip6zone/<zone>/ip6/...
 var dialMatcher = mafmt.And(
-	mafmt.Or(mafmt.IP, mafmt.DNS),
+	mafmt.Or(mafmt.IP, mafmt.And(mafmt.Base(ma.P_IP6ZONE), mafmt.Base(ma.P_IP6)), mafmt.DNS),
 	mafmt.Base(ma.P_TCP),
 	mafmt.Or(
 		mafmt.Base(ma.P_WS),
@@ -80,6 +83,46 @@ func WithTLSConfig(conf *tls.Config) Option {
 	}
 }
 
+// WithCompression enables negotiation of the permessage-deflate extension (RFC 7692),
+// using the given compression level (see compress/flate).
+// Messages are only compressed if the peer enables compression as well.
+//
+// Note that compression only pays off for compressible data. Data that was encrypted by a
+// security protocol before being sent over the WebSocket doesn't compress.
+func WithCompression(level int) Option {
+	return func(t *WebsocketTransport) error {
+		if level < flate.HuffmanOnly || level > flate.BestCompression {
+			return errors.New("websocket: invalid compression level")
+		}
+		t.compress = true
+		t.compressionLevel = level
+		return nil
+	}
+}
+
+// WithWriteCoalescing enables coalescing small writes into a single WebSocket message.
+// Writes are buffered until maxSize bytes are buffered, or for at most delay.
+// This reduces the framing overhead for protocols that send many small messages,
+// at the cost of added latency.
+//
+// Buffered data is flushed before the write deadline changes, and before it expires: if the
+// deadline is closer than delay, writes are sent right away.
+// Errors that occur when sending buffered data are returned by the next call to Write, Close
+// or SetWriteDeadline.
+func WithWriteCoalescing(delay time.Duration, maxSize int) Option {
+	return func(t *WebsocketTransport) error {
+		if delay <= 0 {
+			return errors.New("websocket: coalescing delay must be positive")
+		}
+		if maxSize <= 0 {
+			return errors.New("websocket: coalescing size must be positive")
+		}
+		t.coalesceDelay = delay
+		t.coalesceMaxSize = maxSize
+		return nil
+	}
+}
+
 // WebsocketTransport is the actual go-libp2p transport
 type WebsocketTransport struct {
 	upgrader transport.Upgrader
@@ -87,6 +130,11 @@ type WebsocketTransport struct {
 
 	tlsClientConf *tls.Config
 	tlsConf       *tls.Config
+
+	compress         bool
+	compressionLevel int
+	coalesceDelay    time.Duration
+	coalesceMaxSize  int
 }
 
 var _ transport.Transport = (*WebsocketTransport)(nil)
@@ -170,7 +218,9 @@ func (t *WebsocketTransport) Dial(ctx context.Context, raddr ma.Multiaddr, p pee
 }
 
 func (t *WebsocketTransport) dialWithScope(ctx context.Context, raddr ma.Multiaddr, p peer.ID, connScope network.ConnManagementScope) (transport.CapableConn, error) {
-	macon, err := t.maDial(ctx, raddr)
+	dctx, cancel := network.WithDialStage(ctx, network.DialStageTransport)
+	macon, err := t.maDial(dctx, raddr)
+	cancel()
 	if err != nil {
 		return nil, err
 	}
@@ -187,7 +237,10 @@ func (t *WebsocketTransport) maDial(ctx context.Context, raddr ma.Multiaddr) (ma
 		return nil, err
 	}
 	isWss := wsurl.Scheme == "wss"
-	dialer := ws.Dialer{HandshakeTimeout: 30 * time.Second}
+	dialer := ws.Dialer{
+		HandshakeTimeout:  30 * time.Second,
+		EnableCompression: t.compress,
+	}
 	if isWss {
 		sni := ""
 		sni, err = raddr.ValueForProtocol(ma.P_SNI)
@@ -220,7 +273,9 @@ func (t *WebsocketTransport) maDial(ctx context.Context, raddr ma.Multiaddr) (ma
 		return nil, err
 	}
 
-	mnc, err := manet.WrapNetConn(NewConn(wscon, isWss))
+	c := NewConn(wscon, isWss)
+	t.setupConn(c)
+	mnc, err := manet.WrapNetConn(c)
 	if err != nil {
 		wscon.Close()
 		return nil, err
@@ -233,10 +288,23 @@ func (t *WebsocketTransport) maListen(a ma.Multiaddr) (manet.Listener, error) {
 	if err != nil {
 		return nil, err
 	}
+	l.upgrader.EnableCompression = t.compress
+	l.setupConn = t.setupConn
 	go l.serve()
 	return l, nil
 }
 
+// setupConn applies the compression and write coalescing settings to a new connection.
+func (t *WebsocketTransport) setupConn(c *Conn) {
+	if t.compress {
+		// The level was validated when the option was applied.
+		_ = c.SetCompressionLevel(t.compressionLevel)
+	}
+	if t.coalesceDelay > 0 {
+		c.setWriteCoalescing(t.coalesceDelay, t.coalesceMaxSize)
+	}
+}
+
 func (t *WebsocketTransport) Listen(a ma.Multiaddr) (transport.Listener, error) {
 	malist, err := t.maListen(a)
 	if err != nil {
@@ -1,6 +1,8 @@
 package websocket
 
 import (
+	"bytes"
+	"compress/flate"
 	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
@@ -15,6 +17,8 @@ import (
 	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -31,7 +35,9 @@ import (
 	"github.com/libp2p/go-libp2p/p2p/security/noise"
 	ttransport "github.com/libp2p/go-libp2p/p2p/transport/testsuite"
 
+	ws "github.com/gorilla/websocket"
 	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
 	"github.com/stretchr/testify/require"
 )
 
@@ -138,6 +144,12 @@ func TestCanDial(t *testing.T) {
 	if !d.CanDial(ma.StringCast("/dnsaddr/example.com/tcp/5555/tls/sni/example.com/ws")) {
 		t.Fatal("expected to match secure websocket maddr with sni, but did not")
 	}
+	if !d.CanDial(ma.StringCast("/ip6zone/eth0/ip6/fe80::1/tcp/5555/ws")) {
+		t.Fatal("expected to match scoped IPv6 websocket maddr, but did not")
+	}
+	if d.CanDial(ma.StringCast("/ip6zone/eth0/ip4/127.0.0.1/tcp/5555/ws")) {
+		t.Fatal("expected to not match scoped IPv4 websocket maddr, but did")
+	}
 }
 
 // testWSSServer returns a client hello info
@@ -548,3 +560,148 @@ func TestResolveMultiaddr(t *testing.T) {
 		})
 	}
 }
+
+func TestCompressionNegotiation(t *testing.T) {
+	_, err := New(nil, nil, WithCompression(42))
+	require.Error(t, err)
+
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("compression enabled: %t", enabled), func(t *testing.T) {
+			var opts []Option
+			if enabled {
+				opts = append(opts, WithCompression(flate.BestSpeed))
+			}
+			_, u := newUpgrader(t)
+			tpt, err := New(u, &network.NullResourceManager{}, opts...)
+			require.NoError(t, err)
+			l, err := tpt.maListen(ma.StringCast("/ip4/127.0.0.1/tcp/0/ws"))
+			require.NoError(t, err)
+			defer l.Close()
+
+			wsurl, err := parseMultiaddr(l.Multiaddr())
+			require.NoError(t, err)
+			conn, resp, err := (&ws.Dialer{EnableCompression: true}).Dial(wsurl.String(), nil)
+			require.NoError(t, err)
+			defer conn.Close()
+			require.Equal(t, enabled, strings.Contains(resp.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate"))
+			lc, err := l.Accept()
+			require.NoError(t, err)
+			lc.Close()
+
+			// exchange data with a peer that uses the same settings
+			msg := bytes.Repeat([]byte("foobar"), 1000)
+			go func() {
+				c, err := tpt.maDial(context.Background(), l.Multiaddr())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer c.Close()
+				c.Write(msg)
+			}()
+			c, err := l.Accept()
+			require.NoError(t, err)
+			defer c.Close()
+			out, err := io.ReadAll(c)
+			require.NoError(t, err)
+			require.Equal(t, msg, out)
+		})
+	}
+}
+
+func TestWriteCoalescing(t *testing.T) {
+	_, err := New(nil, nil, WithWriteCoalescing(0, 100))
+	require.Error(t, err)
+	_, err = New(nil, nil, WithWriteCoalescing(time.Millisecond, 0))
+	require.Error(t, err)
+
+	msgs := make(chan []byte, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		for {
+			_, msg, err := c.ReadMessage()
+			if err != nil {
+				close(msgs)
+				return
+			}
+			msgs <- msg
+		}
+	}))
+	defer server.Close()
+	addr, err := manet.FromNetAddr(server.Listener.Addr())
+	require.NoError(t, err)
+
+	_, u := newUpgrader(t)
+	tpt, err := New(u, &network.NullResourceManager{}, WithWriteCoalescing(50*time.Millisecond, 100))
+	require.NoError(t, err)
+	c, err := tpt.maDial(context.Background(), addr.Encapsulate(wsComponent))
+	require.NoError(t, err)
+
+	nextMsg := func() []byte {
+		t.Helper()
+		select {
+		case msg := <-msgs:
+			return msg
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+			return nil
+		}
+	}
+
+	// small writes are coalesced until the delay has passed
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		n, err := c.Write([]byte("foobar"))
+		require.NoError(t, err)
+		require.Equal(t, 6, n)
+	}
+	require.Equal(t, bytes.Repeat([]byte("foobar"), 5), nextMsg())
+	require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	// buffered data is sent before it would exceed the maximum size
+	_, err = c.Write(make([]byte, 60))
+	require.NoError(t, err)
+	_, err = c.Write(make([]byte, 60))
+	require.NoError(t, err)
+	require.Len(t, nextMsg(), 60)
+	require.Len(t, nextMsg(), 60)
+
+	// large writes are sent right away
+	_, err = c.Write(make([]byte, 200))
+	require.NoError(t, err)
+	require.Len(t, nextMsg(), 200)
+
+	// buffered data is sent when the write deadline changes
+	start = time.Now()
+	_, err = c.Write([]byte("foobar"))
+	require.NoError(t, err)
+	require.NoError(t, c.SetWriteDeadline(time.Now().Add(time.Hour)))
+	require.Equal(t, []byte("foobar"), nextMsg())
+	require.Less(t, time.Since(start), 50*time.Millisecond)
+
+	// writes are sent right away if the deadline expires before the buffer would be flushed
+	require.NoError(t, c.SetWriteDeadline(time.Now().Add(10*time.Millisecond)))
+	start = time.Now()
+	_, err = c.Write([]byte("foobar"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("foobar"), nextMsg())
+	require.Less(t, time.Since(start), 50*time.Millisecond)
+
+	// writes after the deadline fail, without breaking the connection
+	require.NoError(t, c.SetWriteDeadline(time.Now().Add(-time.Second)))
+	_, err = c.Write([]byte("foobar"))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	require.NoError(t, c.SetWriteDeadline(time.Time{}))
+
+	// buffered data is sent when the connection is closed
+	_, err = c.Write([]byte("foobar"))
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+	require.Equal(t, []byte("foobar"), nextMsg())
+	_, err = c.Write([]byte("foobar"))
+	require.Error(t, err)
+}
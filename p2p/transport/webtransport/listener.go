@@ -61,7 +61,7 @@ func newListener(reuseListener quicreuse.Listener, t *transport, isStaticTLSConf
 	}
 	ln.ctx, ln.ctxCancel = context.WithCancel(context.Background())
 	mux := http.NewServeMux()
-	mux.HandleFunc(webtransportHTTPEndpoint, ln.httpHandler)
+	mux.HandleFunc(t.httpPath, ln.httpHandler)
 	ln.server.H3.Handler = mux
 	go func() {
 		defer close(ln.serverClosed)
@@ -83,10 +83,16 @@ func (l *listener) httpHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	remoteMultiaddr, err := stringToWebtransportMultiaddr(r.RemoteAddr)
+	remoteAddr, err := clientAddr(r, l.transport.trustedProxies)
+	if err != nil {
+		log.Debugw("invalid forwarded client address", "remote", r.RemoteAddr, "error", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	remoteMultiaddr, err := stringToWebtransportMultiaddr(remoteAddr)
 	if err != nil {
 		// This should never happen.
-		log.Errorw("converting remote address failed", "remote", r.RemoteAddr, "error", err)
+		log.Errorw("converting remote address failed", "remote", remoteAddr, "error", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -97,17 +103,17 @@ func (l *listener) httpHandler(w http.ResponseWriter, r *http.Request) {
 
 	connScope, err := l.transport.rcmgr.OpenConnection(network.DirInbound, false, remoteMultiaddr)
 	if err != nil {
-		log.Debugw("resource manager blocked incoming connection", "addr", r.RemoteAddr, "error", err)
+		log.Debugw("resource manager blocked incoming connection", "addr", remoteAddr, "error", err)
 		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
-	err = l.httpHandlerWithConnScope(w, r, connScope)
+	err = l.httpHandlerWithConnScope(w, r, remoteMultiaddr, connScope)
 	if err != nil {
 		connScope.Done()
 	}
 }
 
-func (l *listener) httpHandlerWithConnScope(w http.ResponseWriter, r *http.Request, connScope network.ConnManagementScope) error {
+func (l *listener) httpHandlerWithConnScope(w http.ResponseWriter, r *http.Request, remote ma.Multiaddr, connScope network.ConnManagementScope) error {
 	sess, err := l.server.Upgrade(w, r)
 	if err != nil {
 		log.Debugw("upgrade failed", "error", err)
@@ -116,7 +122,7 @@ func (l *listener) httpHandlerWithConnScope(w http.ResponseWriter, r *http.Reque
 		return err
 	}
 	ctx, cancel := context.WithTimeout(l.ctx, handshakeTimeout)
-	sconn, err := l.handshake(ctx, sess)
+	sconn, err := l.handshake(ctx, sess, remote)
 	if err != nil {
 		cancel()
 		log.Debugw("handshake failed", "error", err)
@@ -132,7 +138,7 @@ func (l *listener) httpHandlerWithConnScope(w http.ResponseWriter, r *http.Reque
 	}
 
 	if err := connScope.SetPeer(sconn.RemotePeer()); err != nil {
-		log.Debugw("resource manager blocked incoming connection for peer", "peer", sconn.RemotePeer(), "addr", r.RemoteAddr, "error", err)
+		log.Debugw("resource manager blocked incoming connection for peer", "peer", sconn.RemotePeer(), "addr", remote, "error", err)
 		sess.CloseWithError(1, "")
 		return err
 	}
@@ -142,7 +148,7 @@ func (l *listener) httpHandlerWithConnScope(w http.ResponseWriter, r *http.Reque
 	select {
 	case l.queue <- conn:
 	default:
-		log.Debugw("accept queue full, dropping incoming connection", "peer", sconn.RemotePeer(), "addr", r.RemoteAddr, "error", err)
+		log.Debugw("accept queue full, dropping incoming connection", "peer", sconn.RemotePeer(), "addr", remote, "error", err)
 		sess.CloseWithError(1, "")
 		return errors.New("accept queue full")
 	}
@@ -159,15 +165,14 @@ func (l *listener) Accept() (tpt.CapableConn, error) {
 	}
 }
 
-func (l *listener) handshake(ctx context.Context, sess *webtransport.Session) (*connSecurityMultiaddrs, error) {
+// handshake runs the Noise handshake on sess.
+// remote is the client's address, which differs from the session's remote address if the
+// session was forwarded by a trusted proxy.
+func (l *listener) handshake(ctx context.Context, sess *webtransport.Session, remote ma.Multiaddr) (*connSecurityMultiaddrs, error) {
 	local, err := toWebtransportMultiaddr(sess.LocalAddr())
 	if err != nil {
 		return nil, fmt.Errorf("error determiniting local addr: %w", err)
 	}
-	remote, err := toWebtransportMultiaddr(sess.RemoteAddr())
-	if err != nil {
-		return nil, fmt.Errorf("error determiniting remote addr: %w", err)
-	}
 
 	str, err := sess.AcceptStream(ctx)
 	if err != nil {
@@ -6,16 +6,19 @@ import (
 	"net"
 	"strconv"
 
+	"github.com/libp2p/go-libp2p/p2p/transport/quicreuse"
+
 	ma "github.com/multiformats/go-multiaddr"
-	manet "github.com/multiformats/go-multiaddr/net"
 	"github.com/multiformats/go-multibase"
 	"github.com/multiformats/go-multihash"
+	"github.com/quic-go/quic-go"
 )
 
-var webtransportMA = ma.StringCast("/quic-v1/webtransport")
+var webtransportMA = ma.StringCast("/webtransport")
 
 func toWebtransportMultiaddr(na net.Addr) (ma.Multiaddr, error) {
-	addr, err := manet.FromNetAddr(na)
+	// Use quicreuse to convert the address, since it might be wrapped by the quicreuse.ConnManager.
+	addr, err := quicreuse.ToQuicMultiaddr(na, quic.Version1)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,132 @@
+package libp2pwebtransport
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// The following options allow running the WebTransport listener behind an HTTP/3 reverse proxy.
+// The proxy terminates the client's QUIC connection, and forwards the WebTransport session to us,
+// usually using a certificate issued by a CA it trusts instead of a self-signed certificate.
+
+// WithTLSConfig sets the tls.Config used by the listener, e.g. to use a certificate that's trusted
+// by a reverse proxy. The certificate is not rotated, and the listen address doesn't contain the
+// /certhash components, so dialers need to verify it using the WebPKI (see WithTLSClientConfig).
+func WithTLSConfig(c *tls.Config) Option {
+	return func(t *transport) error {
+		if c == nil {
+			return errors.New("tls.Config must not be nil")
+		}
+		t.staticTLSConf = c
+		return nil
+	}
+}
+
+// WithHTTPPath sets the URL path on which the listener accepts WebTransport sessions, for example
+// when the reverse proxy forwards them on a different path.
+// Defaults to /.well-known/libp2p-webtransport.
+func WithHTTPPath(path string) Option {
+	return func(t *transport) error {
+		if !strings.HasPrefix(path, "/") {
+			return errors.New("HTTP path must start with a /")
+		}
+		t.httpPath = path
+		return nil
+	}
+}
+
+// WithTrustedProxies makes the listener use the client address from the Forwarded and
+// X-Forwarded-For headers of requests sent by the given proxies. The client address is used as the
+// remote address of the connection, i.e. for connection gating, resource management and metrics.
+// Headers of requests sent by other peers are ignored.
+func WithTrustedProxies(proxies ...*net.IPNet) Option {
+	return func(t *transport) error {
+		t.trustedProxies = append(t.trustedProxies, proxies...)
+		return nil
+	}
+}
+
+func isTrustedProxy(ip net.IP, proxies []*net.IPNet) bool {
+	for _, n := range proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the address of the client that sent r, in host:port form.
+// If r was sent by a trusted proxy, this is the address of the last hop before the trusted proxies,
+// as reported by the Forwarded header, or by the X-Forwarded-For header if there is no Forwarded
+// header. If the forwarded address doesn't contain a port, the port is 0.
+func clientAddr(r *http.Request, proxies []*net.IPNet) (string, error) {
+	if len(proxies) == 0 {
+		return r.RemoteAddr, nil
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "", err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isTrustedProxy(ip, proxies) {
+		return r.RemoteAddr, nil
+	}
+
+	var hops []string
+	if fwd := r.Header.Values("Forwarded"); len(fwd) > 0 {
+		hops = parseForwarded(fwd)
+	} else {
+		for _, h := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(h, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+	}
+	// Walk the hops backwards, skipping our trusted proxies.
+	// Everything before the first untrusted hop could have been forged by the client.
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := normalizeForwardedAddr(hops[i])
+		if !ok {
+			return "", errors.New("invalid forwarded address")
+		}
+		ahost, _, _ := net.SplitHostPort(addr)
+		if i > 0 && isTrustedProxy(net.ParseIP(ahost), proxies) {
+			continue
+		}
+		return addr, nil
+	}
+	// The proxy didn't forward the client address.
+	return r.RemoteAddr, nil
+}
+
+// parseForwarded returns the values of the for parameters of a Forwarded header (RFC 7239).
+func parseForwarded(headers []string) []string {
+	var hops []string
+	for _, h := range headers {
+		for _, elem := range strings.Split(h, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(k, "for") {
+					hops = append(hops, strings.Trim(v, `"`))
+				}
+			}
+		}
+	}
+	return hops
+}
+
+// normalizeForwardedAddr converts an address from a forwarding header, which is an IP address
+// (IPv6 addresses are enclosed in brackets if a port is included), optionally followed by a port,
+// to host:port form.
+func normalizeForwardedAddr(s string) (string, bool) {
+	if ip := net.ParseIP(strings.Trim(s, "[]")); ip != nil {
+		return net.JoinHostPort(ip.String(), "0"), true
+	}
+	host, port, err := net.SplitHostPort(s)
+	if err != nil || net.ParseIP(host) == nil {
+		return "", false
+	}
+	return net.JoinHostPort(host, port), true
+}
@@ -0,0 +1,48 @@
+package libp2pwebtransport
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientAddr(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	trusted := []*net.IPNet{proxies}
+
+	newRequest := func(remote string, header http.Header) *http.Request {
+		return &http.Request{RemoteAddr: remote, Header: header}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		remote   string
+		header   http.Header
+		proxies  []*net.IPNet
+		expected string
+		err      bool
+	}{
+		{name: "no trusted proxies", remote: "10.0.0.1:1234", header: http.Header{"X-Forwarded-For": {"1.2.3.4"}}, expected: "10.0.0.1:1234"},
+		{name: "untrusted proxy", remote: "5.6.7.8:1234", header: http.Header{"X-Forwarded-For": {"1.2.3.4"}}, proxies: trusted, expected: "5.6.7.8:1234"},
+		{name: "no header", remote: "10.0.0.1:1234", proxies: trusted, expected: "10.0.0.1:1234"},
+		{name: "X-Forwarded-For", remote: "10.0.0.1:1234", header: http.Header{"X-Forwarded-For": {"1.2.3.4"}}, proxies: trusted, expected: "1.2.3.4:0"},
+		{name: "X-Forwarded-For, forged hop", remote: "10.0.0.1:1234", header: http.Header{"X-Forwarded-For": {"9.9.9.9, 1.2.3.4, 10.0.0.2"}}, proxies: trusted, expected: "1.2.3.4:0"},
+		{name: "X-Forwarded-For, only proxies", remote: "10.0.0.1:1234", header: http.Header{"X-Forwarded-For": {"10.0.0.3", "10.0.0.2"}}, proxies: trusted, expected: "10.0.0.3:0"},
+		{name: "Forwarded", remote: "10.0.0.1:1234", header: http.Header{"Forwarded": {`for="[2001:db8::1]:4711";proto=https, for=10.0.0.2`}}, proxies: trusted, expected: "[2001:db8::1]:4711"},
+		{name: "Forwarded takes precedence", remote: "10.0.0.1:1234", header: http.Header{"Forwarded": {"for=1.2.3.4"}, "X-Forwarded-For": {"5.6.7.8"}}, proxies: trusted, expected: "1.2.3.4:0"},
+		{name: "invalid address", remote: "10.0.0.1:1234", header: http.Header{"Forwarded": {"for=unknown"}}, proxies: trusted, err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, err := clientAddr(newRequest(tc.remote, tc.header), tc.proxies)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, addr)
+		})
+	}
+}
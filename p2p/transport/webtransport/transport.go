@@ -8,6 +8,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -53,6 +56,8 @@ func WithClock(cl clock.Clock) Option {
 // This option is most useful for setting a custom tls.Config.RootCAs certificate pool.
 // When dialing a multiaddr that contains a /certhash component, this library will set InsecureSkipVerify and
 // overwrite the VerifyPeerCertificate callback.
+// Multiaddrs without a /certhash component (see WithTLSConfig) are verified using the WebPKI, against the
+// RootCAs of the config, or the system's roots if RootCAs is nil.
 func WithTLSClientConfig(c *tls.Config) Option {
 	return func(t *transport) error {
 		t.tlsClientConf = c
@@ -75,6 +80,8 @@ type transport struct {
 	hasCertManager atomic.Bool // set to true once the certManager is initialized
 	staticTLSConf  *tls.Config
 	tlsClientConf  *tls.Config
+	httpPath       string
+	trustedProxies []*net.IPNet
 
 	noise *noise.Transport
 
@@ -87,9 +94,11 @@ var _ tpt.Resolver = &transport{}
 var _ io.Closer = &transport{}
 
 func New(key ic.PrivKey, psk pnet.PSK, connManager *quicreuse.ConnManager, gater connmgr.ConnectionGater, rcmgr network.ResourceManager, opts ...Option) (tpt.Transport, error) {
-	if len(psk) > 0 {
-		log.Error("WebTransport doesn't support private networks yet.")
-		return nil, errors.New("WebTransport doesn't support private networks yet")
+	// Private networks are implemented by protecting the UDP packets in the ConnManager.
+	// Note that browsers can't connect to nodes in a private network.
+	if len(psk) > 0 && !bytes.Equal(psk, connManager.PSK()) {
+		log.Error("WebTransport needs a ConnManager configured with quicreuse.PrivateNetwork to support private networks.")
+		return nil, errors.New("WebTransport ConnManager not configured for this private network")
 	}
 	if rcmgr == nil {
 		rcmgr = &network.NullResourceManager{}
@@ -106,6 +115,7 @@ func New(key ic.PrivKey, psk pnet.PSK, connManager *quicreuse.ConnManager, gater
 		clock:       clock.New(),
 		connManager: connManager,
 		conns:       map[uint64]*conn{},
+		httpPath:    webtransportHTTPEndpoint,
 	}
 	for _, opt := range opts {
 		if err := opt(t); err != nil {
@@ -141,17 +151,22 @@ func (t *transport) dialWithScope(ctx context.Context, raddr ma.Multiaddr, p pee
 	if err != nil {
 		return nil, err
 	}
-	url := fmt.Sprintf("https://%s%s?type=noise", addr, webtransportHTTPEndpoint)
+	// url.URL escapes the zone of scoped IPv6 addresses
+	reqURL := (&url.URL{Scheme: "https", Host: addr, Path: webtransportHTTPEndpoint, RawQuery: "type=noise"}).String()
 	certHashes, err := extractCertHashes(raddr)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(certHashes) == 0 {
-		return nil, errors.New("can't dial webtransport without certhashes")
-	}
-
 	sni, _ := extractSNI(raddr)
+	if sni == "" && len(certHashes) == 0 {
+		// The certificate is verified using the WebPKI, for the IP address we're dialing.
+		sni, _, _ = net.SplitHostPort(addr)
+		// strip the zone of scoped IPv6 addresses
+		if i := strings.IndexByte(sni, '%'); i >= 0 {
+			sni = sni[:i]
+		}
+	}
 
 	if err := scope.SetPeer(p); err != nil {
 		log.Debugw("resource manager blocked outgoing connection for peer", "peer", p, "addr", raddr, "error", err)
@@ -159,7 +174,7 @@ func (t *transport) dialWithScope(ctx context.Context, raddr ma.Multiaddr, p pee
 	}
 
 	maddr, _ := ma.SplitFunc(raddr, func(c ma.Component) bool { return c.Protocol().Code == ma.P_WEBTRANSPORT })
-	sess, err := t.dial(ctx, maddr, url, sni, certHashes)
+	sess, err := t.dial(ctx, maddr, reqURL, sni, certHashes)
 	if err != nil {
 		return nil, err
 	}
@@ -198,6 +213,7 @@ func (t *transport) dial(ctx context.Context, addr ma.Multiaddr, url, sni string
 			return verifyRawCerts(rawCerts, certHashes)
 		}
 	}
+	// Without certificate hashes, the certificate is verified by crypto/tls, using the WebPKI.
 	conn, err := t.connManager.DialQUIC(ctx, addr, tlsConf, t.allowWindowIncrease)
 	if err != nil {
 		return nil, err
@@ -310,8 +326,6 @@ func (t *transport) Listen(laddr ma.Multiaddr) (tpt.Listener, error) {
 		if t.listenOnceErr != nil {
 			return nil, t.listenOnceErr
 		}
-	} else {
-		return nil, errors.New("static TLS config not supported on WebTransport")
 	}
 	tlsConf := t.staticTLSConf.Clone()
 	if tlsConf == nil {
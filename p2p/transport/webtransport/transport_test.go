@@ -3,13 +3,17 @@ package libp2pwebtransport_test
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
 	"net"
 	"os"
 	"runtime"
@@ -217,6 +221,46 @@ func TestCanDial(t *testing.T) {
 	}
 }
 
+// loopbackZone returns the name of the loopback interface, which can be used as the zone of ::1.
+func loopbackZone(t *testing.T) string {
+	ifaces, err := net.Interfaces()
+	require.NoError(t, err)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			return iface.Name
+		}
+	}
+	t.Skip("no loopback interface")
+	return ""
+}
+
+func TestDialScopedIP6(t *testing.T) {
+	zone := loopbackZone(t)
+	serverID, serverKey := newIdentity(t)
+	tr, err := libp2pwebtransport.New(serverKey, nil, newConnManager(t), nil, nil)
+	require.NoError(t, err)
+	defer tr.(io.Closer).Close()
+	ln, err := tr.Listen(ma.StringCast("/ip6/::1/udp/0/quic-v1/webtransport"))
+	if err != nil {
+		t.Skipf("IPv6 not available: %s", err)
+	}
+	defer ln.Close()
+
+	raddr := ma.StringCast("/ip6zone/" + zone).Encapsulate(ln.Multiaddr())
+	_, clientKey := newIdentity(t)
+	tr2, err := libp2pwebtransport.New(clientKey, nil, newConnManager(t), nil, nil)
+	require.NoError(t, err)
+	defer tr2.(io.Closer).Close()
+	require.True(t, tr2.CanDial(raddr))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := tr2.Dial(ctx, raddr, serverID)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, serverID, conn.RemotePeer())
+}
+
 func TestListenAddrValidity(t *testing.T) {
 	valid := []ma.Multiaddr{
 		ma.StringCast("/ip6/::/udp/0/quic-v1/webtransport/"),
@@ -261,6 +305,122 @@ func TestListenerAddrs(t *testing.T) {
 	require.Equal(t, hashes1, hashes2)
 }
 
+func TestListenWithTLSConfig(t *testing.T) {
+	_, key := newIdentity(t)
+	tr, err := libp2pwebtransport.New(key, nil, newConnManager(t), nil, &network.NullResourceManager{}, libp2pwebtransport.WithTLSConfig(&tls.Config{}))
+	require.NoError(t, err)
+	defer tr.(io.Closer).Close()
+
+	ln, err := tr.Listen(ma.StringCast("/ip4/127.0.0.1/udp/0/quic-v1/webtransport"))
+	require.NoError(t, err)
+	defer ln.Close()
+	require.Empty(t, extractCertHashes(ln.Multiaddr()))
+	_, ok := tr.(interface {
+		AddCertHashes(ma.Multiaddr) (ma.Multiaddr, bool)
+	}).AddCertHashes(ln.Multiaddr())
+	require.False(t, ok)
+}
+
+// newWebPKICert returns a CA certificate pool, and a certificate for 127.0.0.1 issued by that CA.
+func newWebPKICert(t *testing.T) (*x509.CertPool, tls.Certificate) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return pool, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestDialWithoutCertHashes(t *testing.T) {
+	pool, cert := newWebPKICert(t)
+	serverID, serverKey := newIdentity(t)
+	tr, err := libp2pwebtransport.New(serverKey, nil, newConnManager(t), nil, nil,
+		libp2pwebtransport.WithTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+	)
+	require.NoError(t, err)
+	defer tr.(io.Closer).Close()
+	ln, err := tr.Listen(ma.StringCast("/ip4/127.0.0.1/udp/0/quic-v1/webtransport"))
+	require.NoError(t, err)
+	defer ln.Close()
+	require.Empty(t, extractCertHashes(ln.Multiaddr()))
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		_, clientKey := newIdentity(t)
+		cl, err := libp2pwebtransport.New(clientKey, nil, newConnManager(t), nil, nil)
+		require.NoError(t, err)
+		defer cl.(io.Closer).Close()
+		_, err = cl.Dial(context.Background(), ln.Multiaddr(), serverID)
+		require.ErrorContains(t, err, "certificate signed by unknown authority")
+	})
+
+	t.Run("trusted certificate", func(t *testing.T) {
+		_, clientKey := newIdentity(t)
+		cl, err := libp2pwebtransport.New(clientKey, nil, newConnManager(t), nil, nil,
+			libp2pwebtransport.WithTLSClientConfig(&tls.Config{RootCAs: pool}),
+		)
+		require.NoError(t, err)
+		defer cl.(io.Closer).Close()
+
+		errChan := make(chan error, 1)
+		go func() {
+			conn, err := cl.Dial(context.Background(), ln.Multiaddr(), serverID)
+			if err != nil {
+				errChan <- err
+				return
+			}
+			str, err := conn.OpenStream(context.Background())
+			if err != nil {
+				errChan <- err
+				return
+			}
+			_, err = str.Write([]byte("foobar"))
+			str.Close()
+			errChan <- err
+		}()
+		conn, err := ln.Accept()
+		require.NoError(t, err)
+		defer conn.Close()
+		str, err := conn.AcceptStream()
+		require.NoError(t, err)
+		data, err := io.ReadAll(str)
+		require.NoError(t, err)
+		require.Equal(t, "foobar", string(data))
+		require.NoError(t, <-errChan)
+	})
+}
+
+func TestInvalidHTTPPath(t *testing.T) {
+	_, key := newIdentity(t)
+	_, err := libp2pwebtransport.New(key, nil, newConnManager(t), nil, &network.NullResourceManager{}, libp2pwebtransport.WithHTTPPath("foo"))
+	require.Error(t, err)
+}
+
 func TestResourceManagerDialing(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -0,0 +1,182 @@
+package libp2p
+
+// This file contains the deployment profiles.
+
+import (
+	"fmt"
+	"time"
+
+	rcmgr "github.com/libp2p/go-libp2p/p2p/host/resource-manager"
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	ws "github.com/libp2p/go-libp2p/p2p/transport/websocket"
+	webtransport "github.com/libp2p/go-libp2p/p2p/transport/webtransport"
+)
+
+// ProfileServer configures libp2p for a publicly reachable server: it keeps more connections
+// open, and runs the relay and AutoNAT services for other peers.
+var ProfileServer Option = profile("server")
+
+// ProfileLaptop configures libp2p for a machine behind a home or office NAT: it tries to open
+// ports on the router using UPnP / NAT-PMP, and enables hole punching.
+var ProfileLaptop Option = profile("laptop")
+
+// ProfileMobile configures libp2p for a mobile device: it keeps few connections open, limits the
+// resources libp2p uses, enables hole punching, and enables address synthesis for IPv6-only
+// carrier networks using NAT64.
+var ProfileMobile Option = profile("mobile")
+
+// ProfileBrowserGateway configures libp2p for a publicly reachable node serving browser peers: it
+// listens on all transports supported by browsers (WebSocket and WebTransport), in addition to
+// TCP and QUIC, and runs the relay service so that browsers can reach each other.
+var ProfileBrowserGateway Option = profile("browser-gateway")
+
+// profile selects a deployment profile.
+//
+// A profile only applies to the settings that weren't configured by any other option, no matter
+// if that option comes before or after the profile. Profiles are applied together with the
+// fallback defaults, so they have no effect when using NewWithoutDefaults.
+func profile(name string) Option {
+	return func(cfg *Config) error {
+		if cfg.Profile != "" {
+			return fmt.Errorf("cannot specify multiple profiles")
+		}
+		cfg.Profile = name
+		return nil
+	}
+}
+
+// Complete list of the options of every profile, and when to apply them.
+var profiles = map[string][]struct {
+	fallback func(cfg *Config) bool
+	opt      Option
+}{
+	"server": {
+		{
+			fallback: func(cfg *Config) bool { return cfg.ConnManager == nil },
+			opt:      connManagerOption(600, 900),
+		},
+		{
+			fallback: func(cfg *Config) bool { return !cfg.RelayServiceCustom },
+			opt:      EnableRelayService(),
+		},
+		{
+			fallback: func(cfg *Config) bool { return !cfg.NATServiceCustom },
+			opt:      EnableNATService(),
+		},
+	},
+	"laptop": {
+		{
+			fallback: func(cfg *Config) bool { return cfg.NATManager == nil },
+			opt:      NATPortMap(),
+		},
+		{
+			fallback: func(cfg *Config) bool { return !cfg.HolePunchingCustom },
+			opt:      EnableHolePunching(),
+		},
+	},
+	"mobile": {
+		{
+			fallback: func(cfg *Config) bool { return cfg.ConnManager == nil },
+			opt:      connManagerOption(32, 64, connmgr.WithGracePeriod(30*time.Second)),
+		},
+		{
+			fallback: func(cfg *Config) bool { return cfg.ResourceManager == nil },
+			opt:      scaledResourceManager(128<<20, 256),
+		},
+		{
+			fallback: func(cfg *Config) bool { return !cfg.HolePunchingCustom },
+			opt:      EnableHolePunching(),
+		},
+		{
+			// NAT64 detection only has an effect on IPv6-only networks, so it's always enabled.
+			fallback: func(cfg *Config) bool { return true },
+			opt: func(cfg *Config) error {
+				cfg.SwarmOpts = append(cfg.SwarmOpts, swarm.WithNAT64Detection())
+				return nil
+			},
+		},
+	},
+	"browser-gateway": {
+		{
+			fallback: func(cfg *Config) bool { return cfg.Transports == nil && cfg.PSK == nil },
+			opt: ChainOptions(
+				Transport(tcp.NewTCPTransport),
+				Transport(quic.NewTransport),
+				Transport(ws.New),
+				Transport(webtransport.New),
+			),
+		},
+		{
+			fallback: func(cfg *Config) bool { return cfg.ListenAddrs == nil },
+			opt: ListenAddrStrings(
+				"/ip4/0.0.0.0/tcp/0",
+				"/ip4/0.0.0.0/tcp/0/ws",
+				"/ip4/0.0.0.0/udp/0/quic-v1",
+				"/ip4/0.0.0.0/udp/0/quic-v1/webtransport",
+				"/ip6/::/tcp/0",
+				"/ip6/::/tcp/0/ws",
+				"/ip6/::/udp/0/quic-v1",
+				"/ip6/::/udp/0/quic-v1/webtransport",
+			),
+		},
+		{
+			fallback: func(cfg *Config) bool { return cfg.ConnManager == nil },
+			opt:      connManagerOption(600, 900),
+		},
+		{
+			fallback: func(cfg *Config) bool { return !cfg.RelayServiceCustom },
+			opt:      EnableRelayService(),
+		},
+		{
+			fallback: func(cfg *Config) bool { return !cfg.NATServiceCustom },
+			opt:      EnableNATService(),
+		},
+	},
+}
+
+// applyProfile applies the options of the configured profile, for the settings that weren't configured.
+func applyProfile(cfg *Config) error {
+	if cfg.Profile == "" {
+		return nil
+	}
+	opts, ok := profiles[cfg.Profile]
+	if !ok {
+		return fmt.Errorf("unknown profile: %s", cfg.Profile)
+	}
+	for _, o := range opts {
+		if !o.fallback(cfg) {
+			continue
+		}
+		if err := cfg.Apply(o.opt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func connManagerOption(low, high int, opts ...connmgr.Option) Option {
+	return func(cfg *Config) error {
+		mgr, err := connmgr.NewConnManager(low, high, opts...)
+		if err != nil {
+			return err
+		}
+		return cfg.Apply(ConnectionManager(mgr))
+	}
+}
+
+// scaledResourceManager configures a resource manager using the default limits, scaled to the
+// given amount of memory and number of file descriptors.
+func scaledResourceManager(memory int64, numFD int) Option {
+	return func(cfg *Config) error {
+		limits := rcmgr.DefaultLimits
+		SetDefaultServiceLimits(&limits)
+		mgr, err := rcmgr.NewResourceManager(rcmgr.NewFixedLimiter(limits.Scale(memory, numFD)))
+		if err != nil {
+			return err
+		}
+		return cfg.Apply(ResourceManager(mgr))
+	}
+}
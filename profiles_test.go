@@ -0,0 +1,62 @@
+package libp2p
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p/p2p/net/connmgr"
+
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileDefaults(t *testing.T) {
+	var cfg Config
+	require.NoError(t, cfg.Apply(ProfileMobile, FallbackDefaults))
+	defer cfg.ConnManager.Close()
+	defer cfg.ResourceManager.Close()
+	require.Equal(t, 32, cfg.ConnManager.(*connmgr.BasicConnMgr).GetInfo().LowWater)
+	require.True(t, cfg.EnableHolePunching)
+	require.Len(t, cfg.SwarmOpts, 1)
+	require.False(t, cfg.EnableRelayService)
+
+	cfg = Config{}
+	require.NoError(t, cfg.Apply(ProfileBrowserGateway, FallbackDefaults))
+	defer cfg.ConnManager.Close()
+	defer cfg.ResourceManager.Close()
+	require.True(t, cfg.EnableRelayService)
+	require.True(t, cfg.AutoNATConfig.EnableService)
+	require.Contains(t, cfg.ListenAddrs, ma.StringCast("/ip4/0.0.0.0/tcp/0/ws"))
+}
+
+func TestProfileOverride(t *testing.T) {
+	cm, err := connmgr.NewConnManager(1, 2)
+	require.NoError(t, err)
+	defer cm.Close()
+	addr := ma.StringCast("/ip4/127.0.0.1/tcp/0")
+
+	var cfg Config
+	require.NoError(t, cfg.Apply(ProfileServer, ConnectionManager(cm), ListenAddrs(addr), FallbackDefaults))
+	defer cfg.ResourceManager.Close()
+	require.Equal(t, cm, cfg.ConnManager)
+	require.Equal(t, []ma.Multiaddr{addr}, cfg.ListenAddrs)
+	require.True(t, cfg.EnableRelayService)
+}
+
+func TestProfileDisableServices(t *testing.T) {
+	var cfg Config
+	require.NoError(t, cfg.Apply(DisableRelayService(), ProfileServer, DisableNATService(), FallbackDefaults))
+	defer cfg.ConnManager.Close()
+	defer cfg.ResourceManager.Close()
+	require.False(t, cfg.EnableRelayService)
+	require.False(t, cfg.AutoNATConfig.EnableService)
+
+	cfg = Config{}
+	require.NoError(t, cfg.Apply(ProfileLaptop, DisableHolePunching(), FallbackDefaults))
+	defer cfg.ResourceManager.Close()
+	require.False(t, cfg.EnableHolePunching)
+}
+
+func TestMultipleProfiles(t *testing.T) {
+	var cfg Config
+	require.Error(t, cfg.Apply(ProfileServer, ProfileLaptop))
+}